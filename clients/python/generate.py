@@ -0,0 +1,210 @@
+"""Generates selfstack_client.py from the API's OpenAPI spec.
+
+    python3 generate.py ../../docs/openapi.json > selfstack_client.py
+
+``make openapi`` regenerates both the spec and the client. The client is
+thin on purpose: one method per operation taking and returning plain dicts,
+so it follows the spec without a model layer to keep in step.
+"""
+
+import json
+import keyword
+import re
+import sys
+
+HEADER = '''"""Client for the Selfstack API.
+
+Generated from docs/openapi.json by generate.py; do not edit. Standard
+library only. Each method is one API operation; request and response bodies
+are plain dicts shaped as the spec's schemas.
+
+    from selfstack_client import SelfstackClient
+    c = SelfstackClient("http://localhost:8080", api_key="...")
+    c.ingest({"id": "deploys", "title": "Deploys", "text": "..."})
+    for r in c.search({"query": "how do we deploy?"})["results"]:
+        print(r["score"], r["title"])
+"""
+
+import json
+import urllib.error
+import urllib.parse
+import urllib.request
+
+__all__ = ["SelfstackClient", "SelfstackError"]
+
+API_VERSION = %(version)r
+
+
+class SelfstackError(Exception):
+    """An error response from the server, in either of its error shapes."""
+
+    def __init__(self, status, message="", code="", details=""):
+        super().__init__(f"status {status}: {message} ({code})" if code else f"status {status}: {message}")
+        self.status = status
+        self.message = message
+        self.code = code
+        self.details = details
+
+
+def _error(e):
+    try:
+        body = json.load(e)
+    except ValueError:
+        body = {}
+    err = body.get("error", "") if isinstance(body, dict) else ""
+    if isinstance(err, dict):
+        # The OpenAI-compatible endpoints nest the error
+        return SelfstackError(e.code, err.get("message", ""), err.get("code", ""))
+    return SelfstackError(e.code, err, body.get("code", ""), body.get("details", ""))
+
+
+def _query_value(v):
+    if isinstance(v, bool):
+        return "true" if v else "false"
+    if hasattr(v, "isoformat"):
+        return v.isoformat()
+    return str(v)
+
+
+def _events(resp):
+    """Yields the JSON chunks of a server-sent event stream until [DONE]."""
+    with resp:
+        for line in resp:
+            line = line.decode().strip()
+            if not line.startswith("data:"):
+                continue
+            data = line[len("data:"):].strip()
+            if data == "[DONE]":
+                return
+            yield json.loads(data)
+    raise SelfstackError(0, "stream ended before [DONE]")
+
+
+def _lines(resp):
+    """Yields the JSON objects of a response sent one per line."""
+    with resp:
+        for line in resp:
+            if line.strip():
+                yield json.loads(line)
+
+
+class SelfstackClient:
+    """Calls one Selfstack instance."""
+
+    def __init__(self, endpoint, api_key=None, timeout=30.0):
+        self.endpoint = endpoint.rstrip("/")
+        self.api_key = api_key
+        self.timeout = timeout
+
+    def _request(self, method, path, query=None, body=None, content_type="application/json", ok=(200,), stream=None):
+        url = self.endpoint + path
+        query = {k: _query_value(v) for k, v in (query or {}).items() if v is not None}
+        if query:
+            url += "?" + urllib.parse.urlencode(query)
+        req = urllib.request.Request(url, data=body, method=method)
+        if body is not None:
+            req.add_header("Content-Type", content_type)
+        if self.api_key:
+            req.add_header(%(key_header)r, self.api_key)
+        try:
+            resp = urllib.request.urlopen(req, timeout=self.timeout)
+        except urllib.error.HTTPError as e:
+            if e.code not in ok:
+                raise _error(e) from None
+            resp = e
+        if stream:
+            return stream(resp)
+        with resp:
+            return json.load(resp)
+'''
+
+
+def snake(name):
+    return re.sub(r"(?<!^)(?=[A-Z])", "_", name).lower()
+
+
+def ident(name):
+    return name + "_" if keyword.iskeyword(name) else name
+
+
+def schema_name(schema):
+    ref = schema.get("$ref", "")
+    if ref:
+        return ref.rsplit("/", 1)[-1]
+    if schema.get("type") == "object" and "additionalProperties" in schema:
+        return "dict"
+    return schema.get("type", "any")
+
+
+def operation(method, path, op):
+    name = snake(op["operationId"])
+    params = op.get("parameters", [])
+    path_params = [p for p in params if p["in"] == "path"]
+    query_params = [p for p in params if p["in"] == "query"]
+    request = op.get("requestBody", {}).get("content", {})
+    ok = sorted(int(status) for status in op["responses"] if status != "default")
+    content = op["responses"]["200"]["content"]
+    ndjson = "application/x-ndjson" in content
+    response = content["application/x-ndjson" if ndjson else "application/json"]
+
+    args = ["self"] + [ident(p["name"]) for p in path_params]
+    if request:
+        args.append("body")
+    if query_params:
+        args.append("*")
+        args += [ident(p["name"]) + "=None" for p in query_params]
+
+    doc = [op["summary"] + ".", "", f"{method.upper()} {path} -> {schema_name(response['schema'])}"]
+    if "application/x-ndjson" in request:
+        doc.append("body is an iterable of dicts, sent one per line.")
+    elif request:
+        doc.append(f"body is a {schema_name(request['application/json']['schema'])}.")
+    if ndjson:
+        doc.append("Returns an iterator of them, read as the server sends them.")
+    if "text/event-stream" in content:
+        doc.append('With body["stream"] set, returns an iterator of chunks instead.')
+    for p in query_params:
+        if p.get("description"):
+            doc.append(f"{ident(p['name'])}: {p['description']}.")
+
+    url = path
+    for p in path_params:
+        url = url.replace("{%s}" % p["name"], "{urllib.parse.quote(str(%s), safe='')}" % ident(p["name"]))
+    url = f'f"{url}"' if path_params else f'"{url}"'
+
+    call = [f'"{method.upper()}"', url]
+    if query_params:
+        call.append("query={" + ", ".join(f'"{p["name"]}": {ident(p["name"])}' for p in query_params) + "}")
+    if "application/x-ndjson" in request:
+        call.append('body=b"".join(json.dumps(d).encode() + b"\\n" for d in body)')
+        call.append('content_type="application/x-ndjson"')
+    elif request:
+        call.append("body=json.dumps(body).encode()")
+    if ok != [200]:
+        call.append(f"ok={tuple(ok)!r}")
+    if ndjson:
+        call.append("stream=_lines")
+
+    lines = [f"    def {name}({', '.join(args)}):", '        """' + doc[0]]
+    lines += [f"        {line}" if line else "" for line in doc[1:]]
+    lines.append('        """')
+    if "text/event-stream" in content:
+        lines.append('        if body.get("stream"):')
+        lines.append(f"            return self._request({', '.join(call)}, stream=_events)")
+    lines.append(f"        return self._request({', '.join(call)})")
+    return "\n".join(lines)
+
+
+def generate(spec):
+    """Returns the source of selfstack_client.py for spec."""
+    scheme = next(iter(spec["components"]["securitySchemes"].values()))
+    out = [HEADER % {"version": spec["info"]["version"], "key_header": scheme["name"]}]
+    for path, methods in spec["paths"].items():
+        for method, op in methods.items():
+            out.append(operation(method, path, op))
+    return "\n\n".join(out) + "\n"
+
+
+if __name__ == "__main__":
+    with open(sys.argv[1]) as f:
+        sys.stdout.write(generate(json.load(f)))
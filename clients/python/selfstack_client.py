@@ -0,0 +1,469 @@
+"""Client for the Selfstack API.
+
+Generated from docs/openapi.json by generate.py; do not edit. Standard
+library only. Each method is one API operation; request and response bodies
+are plain dicts shaped as the spec's schemas.
+
+    from selfstack_client import SelfstackClient
+    c = SelfstackClient("http://localhost:8080", api_key="...")
+    c.ingest({"id": "deploys", "title": "Deploys", "text": "..."})
+    for r in c.search({"query": "how do we deploy?"})["results"]:
+        print(r["score"], r["title"])
+"""
+
+import json
+import urllib.error
+import urllib.parse
+import urllib.request
+
+__all__ = ["SelfstackClient", "SelfstackError"]
+
+API_VERSION = '1.0.0'
+
+
+class SelfstackError(Exception):
+    """An error response from the server, in either of its error shapes."""
+
+    def __init__(self, status, message="", code="", details=""):
+        super().__init__(f"status {status}: {message} ({code})" if code else f"status {status}: {message}")
+        self.status = status
+        self.message = message
+        self.code = code
+        self.details = details
+
+
+def _error(e):
+    try:
+        body = json.load(e)
+    except ValueError:
+        body = {}
+    err = body.get("error", "") if isinstance(body, dict) else ""
+    if isinstance(err, dict):
+        # The OpenAI-compatible endpoints nest the error
+        return SelfstackError(e.code, err.get("message", ""), err.get("code", ""))
+    return SelfstackError(e.code, err, body.get("code", ""), body.get("details", ""))
+
+
+def _query_value(v):
+    if isinstance(v, bool):
+        return "true" if v else "false"
+    if hasattr(v, "isoformat"):
+        return v.isoformat()
+    return str(v)
+
+
+def _events(resp):
+    """Yields the JSON chunks of a server-sent event stream until [DONE]."""
+    with resp:
+        for line in resp:
+            line = line.decode().strip()
+            if not line.startswith("data:"):
+                continue
+            data = line[len("data:"):].strip()
+            if data == "[DONE]":
+                return
+            yield json.loads(data)
+    raise SelfstackError(0, "stream ended before [DONE]")
+
+
+def _lines(resp):
+    """Yields the JSON objects of a response sent one per line."""
+    with resp:
+        for line in resp:
+            if line.strip():
+                yield json.loads(line)
+
+
+class SelfstackClient:
+    """Calls one Selfstack instance."""
+
+    def __init__(self, endpoint, api_key=None, timeout=30.0):
+        self.endpoint = endpoint.rstrip("/")
+        self.api_key = api_key
+        self.timeout = timeout
+
+    def _request(self, method, path, query=None, body=None, content_type="application/json", ok=(200,), stream=None):
+        url = self.endpoint + path
+        query = {k: _query_value(v) for k, v in (query or {}).items() if v is not None}
+        if query:
+            url += "?" + urllib.parse.urlencode(query)
+        req = urllib.request.Request(url, data=body, method=method)
+        if body is not None:
+            req.add_header("Content-Type", content_type)
+        if self.api_key:
+            req.add_header('X-API-Key', self.api_key)
+        try:
+            resp = urllib.request.urlopen(req, timeout=self.timeout)
+        except urllib.error.HTTPError as e:
+            if e.code not in ok:
+                raise _error(e) from None
+            resp = e
+        if stream:
+            return stream(resp)
+        with resp:
+            return json.load(resp)
+
+
+    def backfill(self, body):
+        """Load documents, one ingest request per line, through the bulk load path.
+
+        POST /admin/backfill -> BackfillResponse
+        body is an iterable of dicts, sent one per line.
+        """
+        return self._request("POST", "/admin/backfill", body=b"".join(json.dumps(d).encode() + b"\n" for d in body), content_type="application/x-ndjson")
+
+    def capacity(self, *, days=None):
+        """Index and WAL size with growth projections.
+
+        GET /admin/capacity -> CapacityResponse
+        days: How far ahead to project.
+        """
+        return self._request("GET", "/admin/capacity", query={"days": days})
+
+    def changelog(self, *, from_lsn=None, format=None, include_embeddings=None):
+        """Document and collection changes in LSN order, one per line, ending with where to continue.
+
+        GET /admin/changelog -> ChangelogEntry
+        Returns an iterator of them, read as the server sends them.
+        from_lsn: First LSN to return (default 0, everything).
+        format: ndjson, the only format.
+        include_embeddings: Include each document's embedding; needs an EMBEDDING_EXPORT_KEYS key.
+        """
+        return self._request("GET", "/admin/changelog", query={"from_lsn": from_lsn, "format": format, "include_embeddings": include_embeddings}, stream=_lines)
+
+    def import_changelog(self, body, *, dry_run=None):
+        """Replay an exported changelog, one change per line, through the WAL.
+
+        POST /admin/changelog -> ChangelogImportResponse
+        body is an iterable of dicts, sent one per line.
+        dry_run: Validate every line without writing anything.
+        """
+        return self._request("POST", "/admin/changelog", query={"dry_run": dry_run}, body=b"".join(json.dumps(d).encode() + b"\n" for d in body), content_type="application/x-ndjson")
+
+    def compact(self):
+        """Force compaction of sealed WAL segments.
+
+        POST /admin/compaction -> dict
+        """
+        return self._request("POST", "/admin/compaction")
+
+    def compaction_plan(self, *, force=None):
+        """What compaction would do.
+
+        GET /admin/compaction/plan -> CompactionPlan
+        force: Plan as if compaction were forced.
+        """
+        return self._request("GET", "/admin/compaction/plan", query={"force": force})
+
+    def list_flags(self):
+        """Feature flags.
+
+        GET /admin/flags -> FlagsResponse
+        """
+        return self._request("GET", "/admin/flags")
+
+    def clear_flag(self, name):
+        """Drop a feature flag's override.
+
+        DELETE /admin/flags/{name} -> State
+        """
+        return self._request("DELETE", f"/admin/flags/{urllib.parse.quote(str(name), safe='')}")
+
+    def set_flag(self, name, body):
+        """Override a feature flag.
+
+        PUT /admin/flags/{name} -> State
+        body is a SetFlagRequest.
+        """
+        return self._request("PUT", f"/admin/flags/{urllib.parse.quote(str(name), safe='')}", body=json.dumps(body).encode())
+
+    def collect_garbage(self, *, dry_run=None):
+        """Quarantine orphaned WAL files and delete expired ones.
+
+        POST /admin/gc -> GCReport
+        dry_run: Report what would be done without doing it.
+        """
+        return self._request("POST", "/admin/gc", query={"dry_run": dry_run})
+
+    def bulk_status(self):
+        """Bulk ingest queue.
+
+        GET /admin/ingest/bulk -> BulkStatusResponse
+        """
+        return self._request("GET", "/admin/ingest/bulk")
+
+    def list_keys(self):
+        """The API keys, with expiry and last use.
+
+        GET /admin/keys -> KeyListResponse
+        """
+        return self._request("GET", "/admin/keys")
+
+    def create_key(self, body):
+        """Create an API key; its secret is returned only this once.
+
+        POST /admin/keys -> KeySecretResponse
+        body is a CreateKeyRequest.
+        """
+        return self._request("POST", "/admin/keys", body=json.dumps(body).encode(), ok=(200, 201))
+
+    def delete_key(self, id):
+        """Revoke an API key at once.
+
+        DELETE /admin/keys/{id} -> DeleteResponse
+        """
+        return self._request("DELETE", f"/admin/keys/{urllib.parse.quote(str(id), safe='')}")
+
+    def get_key(self, id):
+        """An API key.
+
+        GET /admin/keys/{id} -> APIKey
+        """
+        return self._request("GET", f"/admin/keys/{urllib.parse.quote(str(id), safe='')}")
+
+    def update_key(self, id, body):
+        """Rename an API key or change its namespaces or expiry.
+
+        PATCH /admin/keys/{id} -> APIKey
+        body is a UpdateKeyRequest.
+        """
+        return self._request("PATCH", f"/admin/keys/{urllib.parse.quote(str(id), safe='')}", body=json.dumps(body).encode())
+
+    def rotate_key(self, id, *, overlap=None):
+        """Replace an API key; the old one keeps working for the overlap.
+
+        POST /admin/keys/{id}/rotate -> KeySecretResponse
+        overlap: How long the old key keeps working, e.g. 1h (default 24h).
+        """
+        return self._request("POST", f"/admin/keys/{urllib.parse.quote(str(id), safe='')}/rotate", query={"overlap": overlap})
+
+    def log_levels(self):
+        """Default log level and per-module overrides.
+
+        GET /admin/log-levels -> LevelState
+        """
+        return self._request("GET", "/admin/log-levels")
+
+    def clear_log_level(self, module):
+        """Drop a module's log level override.
+
+        DELETE /admin/log-levels/{module} -> LevelState
+        """
+        return self._request("DELETE", f"/admin/log-levels/{urllib.parse.quote(str(module), safe='')}")
+
+    def set_log_level(self, module, body):
+        """Override a module's log level until restart.
+
+        PUT /admin/log-levels/{module} -> LevelState
+        body is a SetLogLevelRequest.
+        """
+        return self._request("PUT", f"/admin/log-levels/{urllib.parse.quote(str(module), safe='')}", body=json.dumps(body).encode())
+
+    def reset_store(self, *, confirm=None):
+        """Wipe every document, alias, and WAL segment; for test environments.
+
+        POST /admin/reset -> ResetReport
+        confirm: Must be true.
+        """
+        return self._request("POST", "/admin/reset", query={"confirm": confirm})
+
+    def segment_events(self, *, segment_id=None, segment_type=None, since=None, limit=None):
+        """WAL segment lifecycle audit trail.
+
+        GET /admin/segments/events -> SegmentEventsResponse
+        segment_type: wal or cmp.
+        """
+        return self._request("GET", "/admin/segments/events", query={"segment_id": segment_id, "segment_type": segment_type, "since": since, "limit": limit})
+
+    def slo(self):
+        """Latency objectives and whether they're met.
+
+        GET /admin/slo -> SLOResponse
+        """
+        return self._request("GET", "/admin/slo")
+
+    def usage(self, *, key=None, period=None, from_=None, to=None):
+        """Metered usage per key and period.
+
+        GET /admin/usage -> UsageResponse
+        period: month (default) or day.
+        """
+        return self._request("GET", "/admin/usage", query={"key": key, "period": period, "from": from_, "to": to})
+
+    def duplicates(self, *, collection=None, limit=None):
+        """Groups of near-duplicate documents with merge/delete suggestions.
+
+        GET /analytics/duplicates -> DuplicatesResponse
+        limit: Groups to return (default 100).
+        """
+        return self._request("GET", "/analytics/duplicates", query={"collection": collection, "limit": limit})
+
+    def list_collections(self):
+        """List the collections.
+
+        GET /collections -> CollectionListResponse
+        """
+        return self._request("GET", "/collections")
+
+    def put_collection(self, body):
+        """Create (201) or replace a collection.
+
+        POST /collections -> CollectionResponse
+        body is a CollectionConfig.
+        """
+        return self._request("POST", "/collections", body=json.dumps(body).encode(), ok=(200, 201))
+
+    def delete_collection(self, name):
+        """Delete an empty collection.
+
+        DELETE /collections/{name} -> DeleteResponse
+        """
+        return self._request("DELETE", f"/collections/{urllib.parse.quote(str(name), safe='')}")
+
+    def get_collection(self, name):
+        """A collection's config and document count.
+
+        GET /collections/{name} -> CollectionResponse
+        """
+        return self._request("GET", f"/collections/{urllib.parse.quote(str(name), safe='')}")
+
+    def list_deleted(self, *, since=None, limit=None):
+        """Recently deleted documents.
+
+        GET /documents/deleted -> DeletedListResponse
+        limit: 1 to 1000, default 100.
+        """
+        return self._request("GET", "/documents/deleted", query={"since": since, "limit": limit})
+
+    def delete_document(self, id):
+        """Delete a document.
+
+        DELETE /documents/{id} -> DeleteResponse
+        """
+        return self._request("DELETE", f"/documents/{urllib.parse.quote(str(id), safe='')}")
+
+    def get_document(self, id, *, include_embedding=None):
+        """Fetch a document.
+
+        GET /documents/{id} -> DocumentResponse
+        include_embedding: Include the stored embedding; needs a key in EMBEDDING_EXPORT_KEYS.
+        """
+        return self._request("GET", f"/documents/{urllib.parse.quote(str(id), safe='')}", query={"include_embedding": include_embedding})
+
+    def move_document(self, id, body):
+        """Change a document's ID or collection atomically.
+
+        POST /documents/{id}/move -> DocumentResponse
+        body is a MoveRequest.
+        """
+        return self._request("POST", f"/documents/{urllib.parse.quote(str(id), safe='')}/move", body=json.dumps(body).encode())
+
+    def restore_document(self, id):
+        """Restore a deleted document.
+
+        POST /documents/{id}/restore -> DocumentResponse
+        """
+        return self._request("POST", f"/documents/{urllib.parse.quote(str(id), safe='')}/restore")
+
+    def similar_documents(self, id, *, limit=None):
+        """Documents most like a stored one, by its stored embedding.
+
+        GET /documents/{id}/similar -> SimilarResponse
+        limit: 1 to 100, default 10.
+        """
+        return self._request("GET", f"/documents/{urllib.parse.quote(str(id), safe='')}/similar", query={"limit": limit})
+
+    def health(self):
+        """Health, document count, and storage capabilities.
+
+        GET /health -> HealthResponse
+        """
+        return self._request("GET", "/health")
+
+    def ingest(self, body):
+        """Ingest a document; bulk-priority ingests are queued (202).
+
+        POST /ingest -> IngestResponse
+        body is a IngestRequest.
+        """
+        return self._request("POST", "/ingest", body=json.dumps(body).encode(), ok=(200, 202))
+
+    def ready(self):
+        """Readiness; 503 until the startup warmup finishes.
+
+        GET /readyz -> ReadyResponse
+        """
+        return self._request("GET", "/readyz", ok=(200, 503))
+
+    def resolve(self, *, alias=None):
+        """Look up a document by an alias set at ingest.
+
+        GET /resolve -> ResolveResponse
+        alias: URL, file path, or other alias.
+        """
+        return self._request("GET", "/resolve", query={"alias": alias})
+
+    def retrieve(self, body):
+        """Scored chunks for retriever plugins.
+
+        POST /retrieve -> RetrieveResponse
+        body is a RetrieveRequest.
+        """
+        return self._request("POST", "/retrieve", body=json.dumps(body).encode())
+
+    def run(self, body):
+        """Answer a query from the documents, with citations.
+
+        POST /run -> RunResponse
+        body is a RunRequest.
+        """
+        return self._request("POST", "/run", body=json.dumps(body).encode())
+
+    def search(self, body):
+        """Semantic or keyword search.
+
+        POST /search -> SearchResponse
+        body is a SearchRequest.
+        """
+        return self._request("POST", "/search", body=json.dumps(body).encode())
+
+    def suggest(self, *, q=None, collection=None, limit=None):
+        """Past queries starting with a prefix.
+
+        GET /suggest -> SuggestResponse
+        q: Prefix.
+        """
+        return self._request("GET", "/suggest", query={"q": q, "collection": collection, "limit": limit})
+
+    def create_chat_completion(self, body):
+        """OpenAI-compatible chat completion answered from the documents.
+
+        POST /v1/chat/completions -> OpenAIChatResponse
+        body is a OpenAIChatRequest.
+        With body["stream"] set, returns an iterator of chunks instead.
+        """
+        if body.get("stream"):
+            return self._request("POST", "/v1/chat/completions", body=json.dumps(body).encode(), stream=_events)
+        return self._request("POST", "/v1/chat/completions", body=json.dumps(body).encode())
+
+    def create_embeddings(self, body):
+        """OpenAI-compatible embeddings.
+
+        POST /v1/embeddings -> OpenAIEmbeddingResponse
+        body is a OpenAIEmbeddingRequest.
+        """
+        return self._request("POST", "/v1/embeddings", body=json.dumps(body).encode())
+
+    def list_models(self):
+        """Collections as OpenAI models.
+
+        GET /v1/models -> OpenAIModelList
+        """
+        return self._request("GET", "/v1/models")
+
+    def version(self):
+        """Version, git SHA, build time, Go version, and instance ID.
+
+        GET /version -> VersionResponse
+        """
+        return self._request("GET", "/version")
@@ -0,0 +1,101 @@
+"""Client for Selfstack's /retrieve endpoint.
+
+Standard library only. ``SelfstackRetriever`` returns plain dicts;
+``langchain_retriever`` and ``llamaindex_retriever`` wrap it for those
+frameworks when they are installed.
+
+    from selfstack_retriever import SelfstackRetriever
+    r = SelfstackRetriever("http://localhost:8080", api_key="...")
+    for doc in r.retrieve("how do we deploy?", top_k=4):
+        print(doc["score"], doc["metadata"]["source_uri"])
+"""
+
+import json
+import urllib.error
+import urllib.request
+
+__all__ = ["SelfstackError", "SelfstackRetriever", "langchain_retriever", "llamaindex_retriever"]
+
+
+class SelfstackError(Exception):
+    """An error response from the server."""
+
+    def __init__(self, status, message="", code=""):
+        super().__init__(f"status {status}: {message} ({code})" if code else f"status {status}")
+        self.status = status
+        self.message = message
+        self.code = code
+
+
+class SelfstackRetriever:
+    """Retrieves scored chunks from one Selfstack instance."""
+
+    def __init__(self, endpoint, api_key=None, collection=None, top_k=4, timeout=10.0):
+        self.endpoint = endpoint.rstrip("/")
+        self.api_key = api_key
+        self.collection = collection
+        self.top_k = top_k
+        self.timeout = timeout
+
+    def retrieve(self, query, top_k=None, collection=None, mode=None, min_score=None):
+        """Returns the documents best matching query, best first.
+
+        Each is a dict with id, page_content, score, and metadata; metadata
+        has doc_id, title, source, source_uri, collection, and created_at
+        besides the document's own metadata.
+        """
+        body = {"query": query, "top_k": top_k or self.top_k}
+        if collection or self.collection:
+            body["collection"] = collection or self.collection
+        if mode:
+            body["mode"] = mode
+        if min_score is not None:
+            body["min_score"] = min_score
+
+        req = urllib.request.Request(
+            self.endpoint + "/retrieve",
+            data=json.dumps(body).encode(),
+            headers={"Content-Type": "application/json"},
+            method="POST",
+        )
+        if self.api_key:
+            req.add_header("Authorization", "Bearer " + self.api_key)
+        try:
+            with urllib.request.urlopen(req, timeout=self.timeout) as resp:
+                return json.load(resp)["documents"]
+        except urllib.error.HTTPError as e:
+            try:
+                err = json.load(e)
+            except ValueError:
+                err = {}
+            raise SelfstackError(e.code, err.get("error", ""), err.get("code", "")) from None
+
+
+def langchain_retriever(client):
+    """Wraps client as a LangChain retriever (needs langchain-core)."""
+    from langchain_core.documents import Document
+    from langchain_core.retrievers import BaseRetriever
+
+    class _Retriever(BaseRetriever):
+        def _get_relevant_documents(self, query, *, run_manager=None):
+            return [
+                Document(page_content=d["page_content"], metadata={**d["metadata"], "score": d["score"]}, id=d["id"])
+                for d in client.retrieve(query)
+            ]
+
+    return _Retriever()
+
+
+def llamaindex_retriever(client):
+    """Wraps client as a LlamaIndex retriever (needs llama-index-core)."""
+    from llama_index.core.retrievers import BaseRetriever
+    from llama_index.core.schema import NodeWithScore, TextNode
+
+    class _Retriever(BaseRetriever):
+        def _retrieve(self, query_bundle):
+            return [
+                NodeWithScore(node=TextNode(id_=d["id"], text=d["page_content"], metadata=d["metadata"]), score=d["score"])
+                for d in client.retrieve(query_bundle.query_str)
+            ]
+
+    return _Retriever()
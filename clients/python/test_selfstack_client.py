@@ -0,0 +1,131 @@
+"""Contract tests: the generated client against a live server.
+
+    SELFSTACK_URL=http://localhost:8080 python3 -m unittest discover clients/python
+
+Tests that need a server are skipped when SELFSTACK_URL is unset. The server
+should be a scratch instance; the tests write documents and collections.
+"""
+
+import json
+import os
+import unittest
+import uuid
+
+import generate
+from selfstack_client import SelfstackClient, SelfstackError
+
+HERE = os.path.dirname(os.path.abspath(__file__))
+SPEC = os.path.join(HERE, "..", "..", "docs", "openapi.json")
+URL = os.environ.get("SELFSTACK_URL")
+
+
+class GeneratedTest(unittest.TestCase):
+    def test_up_to_date(self):
+        with open(SPEC) as f:
+            want = generate.generate(json.load(f))
+        with open(os.path.join(HERE, "selfstack_client.py")) as f:
+            self.assertEqual(f.read(), want, "selfstack_client.py is out of date; run make openapi")
+
+
+@unittest.skipUnless(URL, "SELFSTACK_URL is not set")
+class ContractTest(unittest.TestCase):
+    @classmethod
+    def setUpClass(cls):
+        cls.client = SelfstackClient(URL, api_key=os.environ.get("SELFSTACK_API_KEY"))
+        cls.collection = "contract-" + uuid.uuid4().hex[:8]
+        cls.client.put_collection({"name": cls.collection})
+
+    def doc(self, text="Deploys go out from the release branch every Tuesday."):
+        return {"id": str(uuid.uuid4()), "source": "contract-test", "title": "Deploys", "text": text, "collection": self.collection}
+
+    def test_health(self):
+        self.assertIn(self.client.health()["status"], ("healthy", "degraded"))
+        self.assertIn("ready", self.client.ready())
+        self.assertTrue(self.client.version()["version"])
+
+    def test_documents(self):
+        c = self.client
+        doc = self.doc()
+        self.assertTrue(c.ingest(doc)["success"])
+
+        got = c.get_document(doc["id"])
+        self.assertEqual((got["title"], got["text"], got["collection"]), (doc["title"], doc["text"], self.collection))
+
+        results = c.search({"query": "release branch deploys", "collection": self.collection})["results"]
+        self.assertIn(doc["id"], [r["doc_id"] for r in results])
+        self.assertTrue(c.retrieve({"query": "release branch", "collection": self.collection})["documents"])
+
+        self.assertTrue(c.delete_document(doc["id"])["success"])
+        with self.assertRaises(SelfstackError) as cm:
+            c.get_document(doc["id"])
+        self.assertEqual(cm.exception.status, 404)
+        self.assertIn(doc["id"], [d["id"] for d in c.list_deleted(limit=1000)["documents"]])
+        self.assertEqual(c.restore_document(doc["id"])["id"], doc["id"])
+
+    def test_errors(self):
+        with self.assertRaises(SelfstackError) as cm:
+            self.client.search({"query": ""})
+        self.assertEqual(cm.exception.status, 400)
+        self.assertTrue(cm.exception.code)
+
+        with self.assertRaises(SelfstackError) as cm:
+            self.client.create_chat_completion({"model": "", "messages": []})
+        self.assertEqual(cm.exception.status, 400)
+        self.assertTrue(cm.exception.message)
+
+    def test_collections(self):
+        c = self.client
+        name = self.collection + "-c"
+        c.put_collection({"name": name})
+        self.assertEqual(c.get_collection(name)["name"], name)
+        self.assertIn(name, [col["name"] for col in c.list_collections()["collections"]])
+        self.assertTrue(c.delete_collection(name)["success"])
+
+    def test_backfill(self):
+        docs = [self.doc(f"Backfilled document {i}.") for i in range(3)]
+        report = self.client.backfill(docs)
+        self.assertEqual((report["documents"], report["failed"]), (3, 0))
+        self.assertEqual(self.client.get_document(docs[0]["id"])["id"], docs[0]["id"])
+
+    def test_openai(self):
+        c = self.client
+        self.client.ingest(self.doc())
+        self.assertEqual(c.list_models()["object"], "list")
+
+        req = {"model": self.collection, "messages": [{"role": "user", "content": "When do deploys go out?"}]}
+        reply = c.create_chat_completion(req)
+        self.assertEqual(reply["object"], "chat.completion")
+        self.assertTrue(reply["choices"][0]["message"]["content"])
+
+        chunks = list(c.create_chat_completion({**req, "stream": True}))
+        self.assertTrue(chunks)
+        self.assertTrue(all(ch["object"] == "chat.completion.chunk" for ch in chunks))
+
+        emb = c.create_embeddings({"model": self.collection, "input": ["deploys", "releases"]})
+        self.assertEqual(len(emb["data"]), 2)
+
+    def test_admin(self):
+        c = self.client
+        self.assertIn("flags", c.list_flags())
+        self.assertIn("default", c.log_levels())
+        self.assertIsInstance(c.segment_events(limit=5)["events"], list)
+        self.assertIn("objectives", c.slo())
+        c.capacity(days=7)
+        c.compaction_plan(force=True)
+
+    def test_changelog(self):
+        c = self.client
+        doc = self.doc()
+        c.ingest(doc)
+        entries = list(c.changelog())
+        self.assertEqual(entries[-1]["op"], "end")
+        self.assertIn(doc["id"], [e.get("doc_id") for e in entries])
+        self.assertEqual([e["op"] for e in c.changelog(from_lsn=entries[-1]["next_lsn"])], ["end"])
+
+        report = c.import_changelog(entries, dry_run=True)
+        self.assertTrue(report["dry_run"])
+        self.assertEqual(report["next_lsn"], entries[-1]["next_lsn"])
+
+
+if __name__ == "__main__":
+    unittest.main()
@@ -3,23 +3,35 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
-	"os"
 	"path/filepath"
-	"strings"
 	"time"
 
 	apihttp "github.com/dsjohal14/selfstack/internal/http"
+	"github.com/dsjohal14/selfstack/internal/libs/access"
+	"github.com/dsjohal14/selfstack/internal/libs/buildinfo"
+	"github.com/dsjohal14/selfstack/internal/libs/capacity"
+	"github.com/dsjohal14/selfstack/internal/libs/chaos"
 	"github.com/dsjohal14/selfstack/internal/libs/config"
+	"github.com/dsjohal14/selfstack/internal/libs/diag"
+	"github.com/dsjohal14/selfstack/internal/libs/events"
+	"github.com/dsjohal14/selfstack/internal/libs/flags"
+	"github.com/dsjohal14/selfstack/internal/libs/jobs"
+	"github.com/dsjohal14/selfstack/internal/libs/membudget"
 	"github.com/dsjohal14/selfstack/internal/libs/obs"
+	"github.com/dsjohal14/selfstack/internal/libs/slo"
+	"github.com/dsjohal14/selfstack/internal/libs/supervise"
+	"github.com/dsjohal14/selfstack/internal/scope/analytics"
 	"github.com/dsjohal14/selfstack/internal/scope/db"
-	"github.com/dsjohal14/selfstack/internal/scope/db/wal"
+	"github.com/dsjohal14/selfstack/internal/scope/ingest"
+	"github.com/dsjohal14/selfstack/internal/scope/shard"
+	"github.com/dsjohal14/selfstack/internal/scope/worker"
+	"github.com/dsjohal14/selfstack/migrations"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
-	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/rs/zerolog"
 )
 
 func main() {
@@ -28,116 +40,452 @@ func main() {
 	if err != nil {
 		log.Fatalf("failed to load config: %v", err)
 	}
+	allInOne := flag.Bool("all-in-one", cfg.AllInOne, "also run the worker in this process, sharing its storage (ALL_IN_ONE)")
+	flag.Parse()
 
-	// Init logger
-	obs.InitLogger(cfg.LogLevel)
-	logger := obs.Logger("api")
+	// Init logger: stderr, a rotated file, and/or syslog, with per-module levels
+	closeLogs, err := obs.SetupLogging(obs.LogConfig{
+		Level:          cfg.LogLevel,
+		Modules:        cfg.Log.Modules,
+		Stderr:         cfg.Log.Stderr,
+		File:           cfg.Log.File,
+		FileMaxSize:    int64(cfg.Log.FileMaxSizeMB) << 20,
+		FileMaxAge:     cfg.Log.FileMaxAge,
+		FileMaxBackups: cfg.Log.FileMaxBackups,
+		Syslog:         cfg.Log.Syslog,
+		SyslogTag:      cfg.Log.SyslogTag,
+	})
+	if err != nil {
+		log.Fatalf("failed to set up logging: %v", err)
+	}
+	defer func() { _ = closeLogs.Close() }()
 
-	// Create data directory
-	dataDir := os.Getenv("DATA_DIR")
-	if dataDir == "" {
-		dataDir = filepath.Join(".", "data")
+	// The instance ID tells deployments apart in logs, metrics, and peer requests
+	build := buildinfo.Get()
+	build.InstanceID, err = buildinfo.LoadInstanceID(cfg.Storage.DataDir)
+	if err != nil {
+		log.Fatalf("failed to load instance ID: %v", err)
 	}
+	obs.SetInstance(build.InstanceID)
+	obs.DefaultRegistry.SetConstLabel("instance", build.InstanceID)
+	obs.DefaultRegistry.CounterVec("selfstack_build_info", "Version of the running binary; always 1", "version").WithLabel(build.Version).Inc()
 
-	// Initialize storage based on mode
-	// WAL + Postgres is the default mode for production durability
-	// Set WAL_DISABLED=true to use legacy in-memory store
-	var store db.Storage
-	walDisabled := strings.ToLower(os.Getenv("WAL_DISABLED")) == "true"
-	dbConnString := os.Getenv("DATABASE_URL")
+	// Panics recovered in handlers and background work leave a diagnostic
+	// bundle in DATA_DIR/diagnostics and flag /health
+	diag.Default.SetDir(filepath.Join(cfg.Storage.DataDir, diag.BundleDir))
+	diag.Default.SetConfig(cfg.Redacted())
+	diag.Default.AddState("build", func() any { return build })
 
-	if walDisabled {
-		logger.Info().Msg("WAL disabled, using legacy store")
-		store, err = db.NewStore(dataDir)
-	} else {
-		store, err = initWALStore(dataDir, dbConnString, logger)
+	logger := obs.Logger("api")
+	logger.Info().Str("version", build.Version).Str("commit", build.Commit).Msg("starting selfstack")
+
+	// Background loops (WAL sync, compaction, scheduled jobs) are restarted
+	// if they fail; /readyz reports them
+	supervisor := supervise.New(obs.Logger("supervisor"))
+
+	// Memory ceilings let the index refuse ingests and the caches evict
+	// instead of the process being OOM-killed
+	indexBudget := membudget.New(membudget.ModuleIndex, int64(cfg.Memory.IndexMB)<<20, nil)
+	resultBudget := membudget.New(membudget.ModuleResultCache, int64(cfg.Memory.ResultCacheMB)<<20, nil)
+
+	// Storage, the compactor, and the worker announce what they did on the
+	// event bus; the events webhook hears about compaction and refresh runs
+	bus := events.New(obs.Logger("events"))
+	defer bus.Close()
+	if url := cfg.Hooks.EventsWebhook; url != "" {
+		webhook := events.NewWebhook(url, cfg.Hooks.WebhookTimeout, obs.Logger("events"))
+		webhook.Subscribe(bus, events.TopicCompactionRun, events.TopicRefreshRun)
+	}
+	diag.Default.AddState("events", func() any { return bus.Stats() })
+
+	// Open storage; WAL is the default backend for production durability.
+	// STORAGE_BACKEND (or WAL_DISABLED=true) selects another one.
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	openCfg := db.OpenConfig{
+		Backend:     db.Backend(cfg.Storage.Backend),
+		DataDir:     cfg.Storage.DataDir,
+		DatabaseURL: cfg.Storage.ManifestURL,
+		WAL: db.WALOpenOptions{
+			Compaction:         cfg.Storage.WALCompaction,
+			MinGarbageRatio:    cfg.Storage.WALGarbageRatio,
+			SyncImmediate:      cfg.Storage.WALSyncImmediate,
+			SyncMethod:         cfg.Storage.WALSyncMethod,
+			ArchiveDir:         cfg.Storage.WALArchiveDir,
+			KeywordIndex:       cfg.Storage.WALKeywordIndex,
+			NodeID:             cfg.Storage.WALNodeID,
+			StagingWindow:      cfg.Storage.WALStagingWindow,
+			AsyncApply:         cfg.Storage.WALAsyncApply,
+			DedupWindow:        cfg.Storage.WALDedupWindow,
+			Supervisor:         supervisor,
+			Events:             bus,
+			SyncDir:            cfg.Storage.WALSyncDir,
+			Lock:               cfg.Storage.WALLock,
+			AllowUnsafeFS:      cfg.Storage.WALAllowUnsafeFS,
+			Compression:        cfg.Storage.WALCompression,
+			CheckpointInterval: cfg.Storage.WALCheckpointInterval,
+			MaxSegmentAge:      cfg.Storage.WALMaxSegmentAge,
+			GCGrace:            cfg.Storage.WALGCGrace,
+			WriteBytesPerSec:   int64(cfg.Storage.WALWriteRateMB) << 20,
+			WriteBurst:         int64(cfg.Storage.WALWriteBurstMB) << 20,
+			IndexBudget:        indexBudget,
+		},
+		Logger: obs.Logger("storage"),
 	}
+	if cfg.Storage.AutoMigrate {
+		openCfg.Migrations = migrations.FS
+	}
+	store, caps, err := db.Open(ctx, openCfg)
+	cancel()
 	if err != nil {
 		logger.Fatal().Err(err).Msg("failed to initialize store")
 	}
 	defer func() { _ = store.Close() }()
 
-	// Create HTTP handler
-	handler := apihttp.NewHandler(store, logger)
+	logger.Info().Interface("capabilities", caps).Msg("storage ready")
+	if ws, ok := store.(*db.WALStore); ok {
+		diag.Default.AddState("wal", func() any { return ws.Status() })
+	}
 
-	// Setup router
-	r := setupRouter(handler)
+	collections, err := openCollections(openCfg, cfg.CollectionsFile)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("failed to initialize collections")
+	}
+	defer func() { _ = collections.Close() }()
 
-	// Start server
-	addr := fmt.Sprintf("%s:%s", cfg.APIHost, cfg.APIPort)
-	logger.Info().Str("addr", addr).Msg("starting API server")
+	// Collection changes are logged next to the documents so a cold start
+	// recovers them too
+	if log, ok := store.(db.SchemaLog); ok {
+		logCtx, logCancel := context.WithTimeout(context.Background(), 30*time.Second)
+		logged, report, err := db.NewLoggedCollectionRegistry(logCtx, collections, log)
+		logCancel()
+		if err != nil {
+			logger.Fatal().Err(err).Msg("failed to reconcile collections with the WAL")
+		}
+		collections = logged
+		if len(report.Restored) > 0 {
+			logger.Warn().Strs("collections", report.Restored).Msg("collection registry was empty; restored collections from the WAL")
+		}
+		if len(report.EmbedderChanged) > 0 {
+			logger.Warn().Strs("collections", report.EmbedderChanged).Msg("embedding model changed while the store was down; documents written before keep their old embeddings")
+		}
+		if len(report.Logged) > 0 {
+			logger.Info().Strs("collections", report.Logged).Msg("logged collections to the WAL")
+		}
+	}
 
-	if err := http.ListenAndServe(addr, r); err != nil {
-		logger.Fatal().Err(err).Msg("server failed")
+	// The worker runs refresh policies, which re-fetch and expire
+	// connector-fed documents. All-in-one mode runs it here with the API's
+	// storage; otherwise cmd/worker runs it.
+	scheduler := jobs.NewScheduler(obs.Logger("jobs"), jobs.WithSupervisor(supervisor))
+	bg, err := worker.New(store, collections, worker.Config{
+		RefreshPolicies: cfg.RefreshPolicies,
+		RefreshInterval: cfg.RefreshInterval,
+		OutboundAllow:   cfg.Outbound.Allow,
+		OutboundDeny:    cfg.Outbound.Deny,
+		Events:          bus,
+	}, obs.Logger("refresh"))
+	if err != nil {
+		logger.Fatal().Err(err).Msg("failed to initialize refresh policies")
+	}
+	if refresher := bg.Refresher(); refresher != nil {
+		ingest.RegisterPreIngestHook("refresh:last-seen", refresher.StampSeen)
+	}
+	if *allInOne {
+		bg.Schedule(scheduler)
+		logger.Info().Msg("running the worker in-process (all-in-one)")
 	}
-}
 
-func setupRouter(h *apihttp.Handler) *chi.Mux {
-	r := chi.NewRouter()
+	// In a sharded deployment this node stores the doc IDs it owns and fans searches out
+	var handlerOpts []apihttp.HandlerOption
+	if cfg.Shard.ID != "" {
+		router, closeRoutes, err := newShardRouter(cfg, build.InstanceID)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("failed to initialize sharding")
+		}
+		defer closeRoutes()
+		handlerOpts = append(handlerOpts, apihttp.WithSharding(router))
+		scheduler.Every("shard-routes", cfg.Shard.RefreshInterval, router.Refresh)
+		logger.Info().Str("shard", router.Self()).Int("shards", len(router.Table().Shards)).Msg("sharding enabled")
+	}
 
-	// Middleware
-	r.Use(middleware.Logger)
-	r.Use(middleware.Recoverer)
-	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
+	// Recent and popular queries back /suggest; flushed every minute to the
+	// store's KV entries, or a file for backends without them
+	if cfg.QueryLog {
+		var queries *db.QueryLog
+		if kv, ok := store.(db.KV); ok {
+			queries, err = db.NewKVQueryLog(kv, cfg.QueryLogSize)
+		} else {
+			queries, err = db.NewQueryLog(filepath.Join(cfg.Storage.DataDir, "queries.json"), cfg.QueryLogSize)
+		}
+		if err != nil {
+			logger.Fatal().Err(err).Msg("failed to open query log")
+		}
+		defer func() { _ = queries.Close() }()
+		handlerOpts = append(handlerOpts, apihttp.WithQueryLog(queries))
+		scheduler.Every("query-log", time.Minute, func(context.Context) error { return queries.Flush() })
+	}
 
-	// Routes
-	r.Get("/health", h.HandleHealth)
-	r.Post("/ingest", h.HandleIngest)
-	r.Post("/search", h.HandleSearch)
-	r.Post("/run", h.HandleRun)
+	// Aliases map external keys to document IDs for /resolve; stored like
+	// the query log, but written through on every change
+	var aliases *db.AliasTable
+	if kv, ok := store.(db.KV); ok {
+		aliases = db.NewKVAliasTable(kv)
+	} else if aliases, err = db.NewAliasTable(filepath.Join(cfg.Storage.DataDir, "aliases.json")); err != nil {
+		logger.Fatal().Err(err).Msg("failed to open alias table")
+	}
+	handlerOpts = append(handlerOpts, apihttp.WithAliases(aliases))
 
-	return r
-}
+	// Managed API keys for /admin/keys; stored like the aliases
+	var keys *db.APIKeyStore
+	if kv, ok := store.(db.KV); ok {
+		keys, err = db.NewKVAPIKeyStore(kv)
+	} else {
+		keys, err = db.NewAPIKeyStore(filepath.Join(cfg.Storage.DataDir, "api_keys.json"))
+	}
+	if err != nil {
+		logger.Fatal().Err(err).Msg("failed to open API keys")
+	}
+	handlerOpts = append(handlerOpts, apihttp.WithAPIKeys(keys, cfg.KeyAdminKeys, cfg.APIKeysRequired))
+	if cfg.TLS.ClientCAFile != "" {
+		handlerOpts = append(handlerOpts, apihttp.WithClientCerts(cfg.TLS.Principals))
+	}
+	if len(cfg.IPAllowlist) > 0 {
+		handlerOpts = append(handlerOpts, apihttp.WithIPAllowlist(access.NewAllowlist(cfg.IPAllowlist)))
+	}
 
-// initWALStore creates a WAL-backed store with optional Postgres manifest
-func initWALStore(dataDir, dbConnString string, logger zerolog.Logger) (*db.WALStore, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+	// Usage per API key backs /admin/usage; stored like the query log
+	if cfg.Usage {
+		var usage *db.UsageLog
+		if kv, ok := store.(db.KV); ok {
+			usage, err = db.NewKVUsageLog(kv, cfg.UsageRetention)
+		} else {
+			usage, err = db.NewUsageLog(filepath.Join(cfg.Storage.DataDir, "usage.json"), cfg.UsageRetention)
+		}
+		if err != nil {
+			logger.Fatal().Err(err).Msg("failed to open usage log")
+		}
+		defer func() { _ = usage.Close() }()
+		handlerOpts = append(handlerOpts, apihttp.WithUsage(usage))
+		scheduler.Every("usage", time.Minute, func(context.Context) error { return usage.Flush() })
+	}
 
-	config := db.DefaultWALStoreConfig(dataDir)
+	// Feature flags gate risky subsystems; runtime overrides are kept in the
+	// store's KV entries where it has them
+	var flagOpts []flags.Option
+	if kv, ok := store.(db.KV); ok {
+		flagOpts = append(flagOpts, flags.WithStore(kv))
+	}
+	featureFlags, err := flags.New(cfg.FeatureFlags, flagOpts...)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("failed to initialize feature flags")
+	}
+	handlerOpts = append(handlerOpts, apihttp.WithFlags(featureFlags))
 
-	// Connect to Postgres if configured
-	if dbConnString != "" {
-		pool, err := pgxpool.New(ctx, dbConnString)
+	// Index and WAL sizes are sampled for the growth rates at /admin/capacity
+	capacityTracker := capacity.NewTracker(cfg.CapacityWindow)
+	handlerOpts = append(handlerOpts, apihttp.WithCapacity(capacityTracker))
+	if ws, ok := store.(*db.WALStore); ok {
+		scheduler.Every("capacity", capacity.SampleInterval, func(context.Context) error {
+			capacityTracker.Record(ws.CapacitySample())
+			return nil
+		})
+	}
+
+	// Files left in the WAL directory by interrupted compactions and
+	// snapshots are quarantined, then deleted after WAL_GC_GRACE
+	if ws, ok := store.(*db.WALStore); ok && cfg.Storage.WALGCInterval > 0 {
+		scheduler.Every("wal-gc", cfg.Storage.WALGCInterval, func(ctx context.Context) error {
+			report, err := ws.CollectGarbage(ctx, false)
+			if report != nil && len(report.Quarantined)+len(report.Deleted) > 0 {
+				logger.Info().Int("quarantined", len(report.Quarantined)).Int("deleted", len(report.Deleted)).
+					Int64("reclaimed_bytes", report.ReclaimedBytes).Msg("collected orphaned WAL files")
+			}
+			return err
+		})
+	}
+
+	// Near-duplicates are found offline and served from the last report
+	if corpus, ok := store.(analytics.Corpus); ok && cfg.DuplicatesInterval > 0 {
+		duplicates := analytics.NewDuplicates(corpus, float32(cfg.DuplicatesThreshold))
+		duplicates.Subscribe(bus)
+		handlerOpts = append(handlerOpts, apihttp.WithDuplicates(duplicates))
+		scheduler.Every("duplicates", cfg.DuplicatesInterval, duplicates.Run)
+	}
+
+	scheduler.Start(context.Background())
+	defer scheduler.Stop()
+
+	// External ingest hooks run after any compiled-in ones: WASM transforms, then the webhook
+	if dir := cfg.Hooks.WASMDir; dir != "" {
+		limits := ingest.DefaultWASMLimits()
+		limits.MemoryPages = uint32(cfg.Hooks.WASMMemoryLimitMB) * 16 // 64 KiB pages
+		limits.Timeout = cfg.Hooks.WASMTimeout
+		transforms, err := ingest.LoadWASMTransforms(context.Background(), dir, limits)
 		if err != nil {
-			return nil, fmt.Errorf("failed to connect to database: %w", err)
+			logger.Fatal().Err(err).Str("dir", dir).Msg("failed to load wasm transforms")
 		}
+		for _, t := range transforms {
+			defer func(t *ingest.WASMTransform) { _ = t.Close(context.Background()) }(t)
+			ingest.RegisterPreIngestHook("wasm:"+t.Name(), t.Pre)
+			logger.Info().Str("module", t.Name()).Msg("loaded wasm transform")
+		}
+	}
+	if url := cfg.Hooks.PreIngestWebhook; url != "" {
+		ingest.RegisterPreIngestHook("webhook", ingest.NewWebhook(url, cfg.Hooks.WebhookTimeout).Pre)
+	}
+	if url := cfg.Hooks.PostIngestWebhook; url != "" {
+		ingest.RegisterPostIngestHook("webhook", ingest.NewWebhook(url, cfg.Hooks.WebhookTimeout).Post)
+	}
+	pre, post := ingest.Default().Len()
+	logger.Info().Int("pre", pre).Int("post", post).Msg("ingest hooks ready")
 
-		// Test connection
-		if err := pool.Ping(ctx); err != nil {
-			pool.Close()
-			return nil, fmt.Errorf("failed to ping database: %w", err)
+	// Create HTTP handler
+	handlerOpts = append(handlerOpts,
+		apihttp.WithSlowOpThreshold(cfg.SlowOpThreshold),
+		apihttp.WithLoadShedding(apihttp.ShedConfig(cfg.Shed)),
+		apihttp.WithBuildInfo(build),
+		apihttp.WithSupervisor(supervisor),
+		apihttp.WithCollections(collections),
+		apihttp.WithResultCache("search", cfg.SearchCacheTTL, cfg.SearchCacheSize),
+		apihttp.WithResultCache("run", cfg.RunCacheTTL, cfg.RunCacheSize),
+		apihttp.WithResultCache("answer", cfg.AnswerCacheTTL, cfg.AnswerCacheSize),
+		apihttp.WithResultCacheBudget(resultBudget),
+	)
+	if cfg.Memory.EmbeddingCacheMB > 0 {
+		handlerOpts = append(handlerOpts, apihttp.WithEmbeddingCache(membudget.New(membudget.ModuleEmbeddingCache, int64(cfg.Memory.EmbeddingCacheMB)<<20, nil)))
+	}
+	if len(cfg.SLOs) > 0 {
+		handlerOpts = append(handlerOpts, apihttp.WithSLOs(slo.NewTracker(cfg.SLOs, cfg.SLOWindow)))
+	}
+	if cfg.BulkIngest {
+		handlerOpts = append(handlerOpts, apihttp.WithBulkIngest(apihttp.BulkConfig(cfg.Bulk)))
+	}
+	if len(cfg.EmbeddingExportKeys) > 0 {
+		handlerOpts = append(handlerOpts, apihttp.WithEmbeddingExport(cfg.EmbeddingExportKeys))
+	}
+	if len(cfg.ResetKeys) > 0 {
+		handlerOpts = append(handlerOpts, apihttp.WithReset(cfg.ResetKeys))
+		logger.Warn().Str("environment", cfg.Environment).Msg("store reset is enabled; keys in RESET_KEYS can wipe every document")
+	}
+	if len(cfg.Chaos) > 0 {
+		rules := make([]string, len(cfg.Chaos))
+		for i, r := range cfg.Chaos {
+			rules[i] = r.String()
 		}
+		logger.Warn().Str("environment", cfg.Environment).Strs("rules", rules).Msg("chaos injection is enabled; requests will fail on purpose")
+		handlerOpts = append(handlerOpts, apihttp.WithChaos(chaos.NewInjector(cfg.Chaos)))
+	}
+	handler := apihttp.NewHandler(store, obs.Logger("http"), handlerOpts...)
 
-		config.DB = pool
-		// Compaction is enabled by default when Postgres is available
-		// Set WAL_COMPACTION=false to disable
-		config.EnableCompaction = strings.ToLower(os.Getenv("WAL_COMPACTION")) != "false"
+	// Bulk ingests are written in batches whenever interactive ingests let up
+	if cfg.BulkIngest {
+		handler.StartBulkIngest(context.Background())
+	}
 
-		logger.Info().
-			Bool("compaction", config.EnableCompaction).
-			Msg("using Postgres-backed WAL manifest")
-	} else {
-		logger.Info().Msg("using in-memory WAL manifest (no Postgres)")
+	// Warm the index and embedders in the background; /readyz fails until done
+	if cfg.Warmup {
+		handler.StartWarmup(context.Background(), cfg.WarmupQueries)
 	}
 
-	// Configure sync policy
-	if strings.ToLower(os.Getenv("WAL_SYNC_IMMEDIATE")) == "false" {
-		config.SyncPolicy = wal.DefaultSyncPolicy()
-		logger.Info().Msg("using batched WAL sync policy")
-	} else {
-		config.SyncPolicy = wal.ImmediateSyncPolicy()
-		logger.Info().Msg("using immediate WAL sync policy")
+	// Setup router
+	r := setupRouter(handler)
+
+	// Start server
+	addr := fmt.Sprintf("%s:%s", cfg.APIHost, cfg.APIPort)
+	if cfg.TLS.CertFile == "" {
+		logger.Info().Str("addr", addr).Msg("starting API server")
+		if err := http.ListenAndServe(addr, r); err != nil {
+			logger.Fatal().Err(err).Msg("server failed")
+		}
+		return
 	}
 
-	logger.Info().Str("wal_dir", config.WALDir).Msg("initializing WAL store")
+	tlsConfig, err := access.ServerTLS(cfg.TLS.CertFile, cfg.TLS.KeyFile, cfg.TLS.ClientCAFile, cfg.TLS.ClientAuth)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("failed to set up TLS")
+	}
+	clientAuth := "off"
+	if cfg.TLS.ClientCAFile != "" {
+		clientAuth = cfg.TLS.ClientAuth
+	}
+	logger.Info().Str("addr", addr).Str("client_certs", clientAuth).Msg("starting API server with TLS")
+	server := &http.Server{Addr: addr, Handler: r, TLSConfig: tlsConfig}
+	if err := server.ListenAndServeTLS("", ""); err != nil {
+		logger.Fatal().Err(err).Msg("server failed")
+	}
+}
 
-	store, err := db.NewWALStore(ctx, config)
+// openCollections opens the collection registry and seeds it from seedFile
+// (COLLECTIONS_CONFIG), replacing stored configs of the same name
+func openCollections(openCfg db.OpenConfig, seedFile string) (db.CollectionRegistry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	reg, err := db.OpenCollectionRegistry(ctx, openCfg)
+	if err != nil {
+		return nil, err
+	}
+	if seedFile == "" {
+		return reg, nil
+	}
+
+	seed, err := db.LoadCollectionsFile(seedFile)
 	if err != nil {
+		_ = reg.Close()
 		return nil, err
 	}
+	for _, c := range seed {
+		if err := reg.Put(ctx, c); err != nil {
+			_ = reg.Close()
+			return nil, fmt.Errorf("failed to seed collection %s: %w", c.Name, err)
+		}
+	}
+	openCfg.Logger.Info().Int("collections", len(seed)).Str("file", seedFile).Msg("seeded collections")
+	return reg, nil
+}
+
+// newShardRouter loads the routing table from SHARD_ROUTES, or from Postgres
+// when that's unset. The returned func releases the table's source.
+func newShardRouter(cfg *config.Config, instanceID string) (*shard.Router, func(), error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
-	logger.Info().Int("doc_count", store.Count()).Msg("WAL store initialized")
-	return store, nil
+	if file := cfg.Shard.RoutesFile; file != "" {
+		router, err := shard.NewRouter(ctx, cfg.Shard.ID, cfg.Shard.Secret, shard.FileSource(file), cfg.Shard.Timeout, shard.WithInstanceID(instanceID))
+		return router, func() {}, err
+	}
+	if cfg.Storage.ManifestURL == "" {
+		return nil, nil, fmt.Errorf("sharding needs SHARD_ROUTES or DATABASE_URL for the routing table")
+	}
+	src, err := shard.NewPostgresSource(ctx, cfg.Storage.ManifestURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	router, err := shard.NewRouter(ctx, cfg.Shard.ID, cfg.Shard.Secret, src, cfg.Shard.Timeout, shard.WithInstanceID(instanceID))
+	if err != nil {
+		src.Close()
+		return nil, nil, err
+	}
+	return router, src.Close, nil
+}
+
+func setupRouter(h *apihttp.Handler) *chi.Mux {
+	r := chi.NewRouter()
+
+	// Middleware
+	r.Use(middleware.Logger)
+	r.Use(h.Recoverer)
+	r.Use(middleware.RequestID)
+	r.Use(h.CheckIP) // Before RealIP, which trusts X-Forwarded-For
+	r.Use(middleware.RealIP)
+	r.Use(h.StampInstance)
+	r.Use(h.Authenticate)
+	r.Use(h.ShedLoad)
+	r.Use(h.InjectChaos)
+	r.Use(h.ReadBarrier)
+
+	r.Method(http.MethodGet, "/metrics", obs.DefaultRegistry.Handler())
+	h.Routes(r)
+
+	return r
 }
@@ -0,0 +1,142 @@
+// Package main compares `go test -bench` output against a baseline and fails
+// when a benchmark regressed beyond a threshold.
+//
+// Usage:
+//
+//	go run ./cmd/benchcmp [-threshold 0.2] baseline.txt new.txt
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// procSuffix is the -GOMAXPROCS suffix go test appends to benchmark names
+var procSuffix = regexp.MustCompile(`-\d+$`)
+
+// compared are the units checked for regressions; others are only printed
+var compared = map[string]bool{"ns/op": true, "allocs/op": true}
+
+func main() {
+	threshold := flag.Float64("threshold", 0.20, "fail when a metric grows by more than this fraction")
+	flag.Parse()
+	if flag.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "usage: benchcmp [-threshold 0.2] baseline.txt new.txt")
+		os.Exit(2)
+	}
+
+	base, err := parseFile(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "benchcmp: %v\n", err)
+		os.Exit(2)
+	}
+	next, err := parseFile(flag.Arg(1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "benchcmp: %v\n", err)
+		os.Exit(2)
+	}
+
+	if regressions := compare(base, next, *threshold); regressions > 0 {
+		fmt.Printf("\n%d regression(s) above %.0f%%\n", regressions, *threshold*100)
+		os.Exit(1)
+	}
+}
+
+// results maps benchmark name -> unit -> samples
+type results map[string]map[string][]float64
+
+// parseFile reads benchmark lines like
+// "BenchmarkAppend/batched-8  1000  1234 ns/op  56 B/op  2 allocs/op"
+func parseFile(path string) (results, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	res := make(results)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || !strings.HasPrefix(fields[0], "Benchmark") {
+			continue
+		}
+		if _, err := strconv.Atoi(fields[1]); err != nil {
+			continue // Not a result line (e.g. a log line starting with the name)
+		}
+		name := procSuffix.ReplaceAllString(fields[0], "")
+		if res[name] == nil {
+			res[name] = make(map[string][]float64)
+		}
+		for i := 2; i+1 < len(fields); i += 2 {
+			v, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				break
+			}
+			unit := fields[i+1]
+			res[name][unit] = append(res[name][unit], v)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return res, nil
+}
+
+// compare prints a table of median values and returns the number of
+// compared metrics that grew by more than threshold
+func compare(base, next results, threshold float64) int {
+	names := make([]string, 0, len(next))
+	for name := range next {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	regressions := 0
+	fmt.Printf("%-50s %-10s %14s %14s %8s\n", "benchmark", "unit", "baseline", "new", "delta")
+	for _, name := range names {
+		units := make([]string, 0, len(next[name]))
+		for unit := range next[name] {
+			units = append(units, unit)
+		}
+		sort.Strings(units)
+
+		for _, unit := range units {
+			newVal := median(next[name][unit])
+			baseSamples, ok := base[name][unit]
+			if !ok {
+				fmt.Printf("%-50s %-10s %14s %14.4g %8s\n", name, unit, "-", newVal, "new")
+				continue
+			}
+			baseVal := median(baseSamples)
+
+			delta := 0.0
+			if baseVal != 0 {
+				delta = (newVal - baseVal) / baseVal
+			}
+			mark := ""
+			if compared[unit] && delta > threshold {
+				mark = "  REGRESSION"
+				regressions++
+			}
+			fmt.Printf("%-50s %-10s %14.4g %14.4g %+7.1f%%%s\n", name, unit, baseVal, newVal, delta*100, mark)
+		}
+	}
+	return regressions
+}
+
+func median(samples []float64) float64 {
+	s := append([]float64(nil), samples...)
+	sort.Float64s(s)
+	n := len(s)
+	if n%2 == 1 {
+		return s[n/2]
+	}
+	return (s[n/2-1] + s[n/2]) / 2
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+func newBackfillCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "backfill FILE",
+		Short: "Load a large corpus of documents through the bulk load path",
+		Long: "Streams FILE (- for stdin), one ingest request per line (NDJSON), to /admin/backfill.\n" +
+			"Records are synced to the WAL in batches and the index is built once at the end, so\n" +
+			"documents become searchable when the backfill finishes. Meant for initial loads.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var in io.Reader = cmd.InOrStdin()
+			if args[0] != "-" {
+				f, err := os.Open(args[0])
+				if err != nil {
+					return fmt.Errorf("failed to open %s: %w", args[0], err)
+				}
+				defer func() { _ = f.Close() }()
+				in = f
+			}
+
+			client, err := newClient()
+			if err != nil {
+				return err
+			}
+			report, err := client.Backfill(cmd.Context(), in)
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			fmt.Fprintf(out, "documents:    %d (%d records, %d bytes)\n", report.Documents, report.Records, report.Bytes)
+			fmt.Fprintf(out, "failed:       %d\n", report.Failed)
+			fmt.Fprintf(out, "write:        %.0fms (%d syncs)\n", report.WriteMS, report.Syncs)
+			fmt.Fprintf(out, "index:        %.0fms\n", report.IndexMS)
+			fmt.Fprintf(out, "throughput:   %.0f docs/s\n", report.DocsPerSec)
+			for _, e := range report.Errors {
+				fmt.Fprintf(out, "  document %d (%s): %s [%s]\n", e.Document, e.ID, e.Error, e.Code)
+			}
+			if report.Error != "" {
+				return fmt.Errorf("backfill stopped early: %s", report.Error)
+			}
+			return nil
+		},
+	}
+}
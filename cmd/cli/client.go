@@ -0,0 +1,48 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+
+	"github.com/dsjohal14/selfstack/internal/libs/access"
+	"github.com/dsjohal14/selfstack/pkg/selfstack"
+)
+
+// apiAddr is the base URL of the API server, set by the --addr flag
+var apiAddr string
+
+// newClient returns a client for the API server at apiAddr, sending the
+// API key in SELFSTACK_API_KEY if set. For servers using mutual TLS, it
+// presents the certificate in SELFSTACK_CLIENT_CERT and SELFSTACK_CLIENT_KEY,
+// and trusts the CAs in SELFSTACK_CA_CERT instead of the system's.
+func newClient() (*selfstack.Client, error) {
+	var opts []selfstack.Option
+	if key := os.Getenv("SELFSTACK_API_KEY"); key != "" {
+		opts = append(opts, selfstack.WithAPIKey(key))
+	}
+
+	certFile, keyFile, caFile := os.Getenv("SELFSTACK_CLIENT_CERT"), os.Getenv("SELFSTACK_CLIENT_KEY"), os.Getenv("SELFSTACK_CA_CERT")
+	if (certFile == "") != (keyFile == "") {
+		return nil, fmt.Errorf("SELFSTACK_CLIENT_CERT and SELFSTACK_CLIENT_KEY must be set together")
+	}
+	if certFile != "" || caFile != "" {
+		cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+		if certFile != "" {
+			cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load client certificate: %w", err)
+			}
+			cfg.Certificates = []tls.Certificate{cert}
+		}
+		if caFile != "" {
+			pool, err := access.LoadCertPool(caFile)
+			if err != nil {
+				return nil, err
+			}
+			cfg.RootCAs = pool
+		}
+		opts = append(opts, selfstack.WithTLS(cfg))
+	}
+	return selfstack.New(apiAddr, opts...)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/dsjohal14/selfstack/internal/scope/db/wal"
+	"github.com/spf13/cobra"
+)
+
+func newCompactCmd() *cobra.Command {
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "compact",
+		Short: "Force compaction of sealed WAL segments",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			client, err := newClient()
+			if err != nil {
+				return err
+			}
+			if dryRun {
+				plan, err := client.CompactionPlan(cmd.Context(), true)
+				if err != nil {
+					return err
+				}
+				printPlan(cmd, plan)
+				return nil
+			}
+
+			if err := client.Compact(cmd.Context()); err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), "compaction complete")
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "show what compaction would do without running it")
+	return cmd
+}
+
+// printPlan writes a human-readable compaction plan
+func printPlan(cmd *cobra.Command, plan *wal.CompactionPlan) {
+	out := cmd.OutOrStdout()
+	if !plan.WouldCompact {
+		fmt.Fprintf(out, "nothing to compact: %s\n", plan.Reason)
+		return
+	}
+
+	fmt.Fprintf(out, "segments:            %v\n", plan.Segments)
+	fmt.Fprintf(out, "input:               %d records, %d bytes\n", plan.InputRecords, plan.InputBytes)
+	fmt.Fprintf(out, "live records:        %d\n", plan.LiveRecords)
+	fmt.Fprintf(out, "tombstones:          %d\n", plan.Tombstones)
+	fmt.Fprintf(out, "superseded (drop):   %d\n", plan.SupersededRecords)
+	fmt.Fprintf(out, "tombstones (drop):   %d\n", plan.TombstonesDropped)
+	fmt.Fprintf(out, "checkpoints (drop):  %d\n", plan.CheckpointsDropped)
+	fmt.Fprintf(out, "estimated output:    %d bytes\n", plan.EstimatedOutputBytes)
+	fmt.Fprintf(out, "bytes reclaimed:     %d\n", plan.BytesReclaimed)
+}
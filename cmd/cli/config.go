@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/dsjohal14/selfstack/internal/libs/config"
+	"github.com/spf13/cobra"
+)
+
+func newConfigCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Show the API's configuration",
+	}
+	cmd.AddCommand(newConfigShowCmd(), newConfigReferenceCmd())
+	return cmd
+}
+
+func newConfigShowCmd() *cobra.Command {
+	var (
+		resolved bool
+		asJSON   bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "show",
+		Short: "Print every setting, where it comes from, and its value",
+		Long: "Reads the same environment (and CONFIG_FILE) as the API and prints each setting\n" +
+			"with its source: env, file, or default. Secrets are redacted. With --resolved,\n" +
+			"the configuration is loaded and validated as the API does on startup, and values\n" +
+			"are printed as parsed, e.g. durations normalized and WAL_DISABLED applied.",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			var cfg *config.Config
+			if resolved {
+				var err error
+				if cfg, err = config.Load(); err != nil {
+					return fmt.Errorf("invalid configuration: %w", err)
+				}
+			}
+			settings, err := config.Settings(cfg)
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			if asJSON {
+				enc := json.NewEncoder(out)
+				enc.SetIndent("", "  ")
+				return enc.Encode(settings)
+			}
+			tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+			for _, s := range settings {
+				fmt.Fprintf(tw, "%s\t%s\t%s\n", s.Env, s.Source, s.Value)
+			}
+			return tw.Flush()
+		},
+	}
+
+	cmd.Flags().BoolVar(&resolved, "resolved", false, "load and validate the configuration and print the parsed values")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "print the settings as JSON")
+	return cmd
+}
+
+func newConfigReferenceCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "reference",
+		Short: "Print a Markdown reference of every setting and its default",
+		Long:  "Generated from the Config struct tags; docs/config.md is its output (make config-docs).",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return config.Reference(cmd.OutOrStdout())
+		},
+	}
+}
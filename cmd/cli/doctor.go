@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/config"
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+	"github.com/dsjohal14/selfstack/internal/scope/doctor"
+	"github.com/dsjohal14/selfstack/migrations"
+	"github.com/spf13/cobra"
+)
+
+func newDoctorCmd() *cobra.Command {
+	var (
+		minFreeMB int
+		timeout   time.Duration
+		asJSON    bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check that this environment can run the API",
+		Long: "Reads the same environment as the API (DATA_DIR, DATABASE_URL, STORAGE_BACKEND, ...)\n" +
+			"and checks the data directory is writable and lockable, Postgres is reachable and\n" +
+			"migrated, every WAL segment parses, the manifest matches the segments on disk,\n" +
+			"each collection's embedder answers, and there is enough free disk space. Exits 1\n" +
+			"if any check fails; warnings don't fail. Nothing is modified.",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			cfg, err := config.Load()
+			if err != nil {
+				return fmt.Errorf("invalid configuration: %w", err)
+			}
+
+			report := doctor.Run(cmd.Context(), doctor.Config{
+				Backend:      db.Backend(cfg.Storage.Backend),
+				DataDir:      cfg.Storage.DataDir,
+				DatabaseURL:  cfg.Storage.ManifestURL,
+				Migrations:   migrations.FS,
+				AutoMigrate:  cfg.Storage.AutoMigrate,
+				MinFreeBytes: uint64(minFreeMB) << 20,
+				Timeout:      timeout,
+
+				AllowUnsafeFS: cfg.Storage.WALAllowUnsafeFS,
+			})
+
+			out := cmd.OutOrStdout()
+			if asJSON {
+				enc := json.NewEncoder(out)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(report); err != nil {
+					return err
+				}
+			} else {
+				for _, res := range report.Results {
+					fmt.Fprintf(out, "%-4s  %-12s  %s\n", strings.ToUpper(string(res.Status)), res.Check, res.Detail)
+				}
+			}
+
+			if n := report.Failed(); n > 0 {
+				return fmt.Errorf("%d of %d checks failed", n, len(report.Results))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVar(&minFreeMB, "min-free-mb", doctor.DefaultMinFreeBytes>>20, "free disk space the data directory needs, in MiB")
+	cmd.Flags().DurationVar(&timeout, "timeout", 5*time.Second, "timeout for each network check")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "print the report as JSON")
+	return cmd
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/dsjohal14/selfstack/internal/scope/db/wal"
+	"github.com/spf13/cobra"
+)
+
+func newGCCmd() *cobra.Command {
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "gc",
+		Short: "Quarantine orphaned files in the WAL directory and delete expired ones",
+		Long: "Moves files nothing refers to, like temp files and segments left by an interrupted\n" +
+			"compaction, into the WAL directory's " + wal.QuarantineDir + " subdirectory, and deletes the ones\n" +
+			"quarantined longer than WAL_GC_GRACE. Move a file back out of " + wal.QuarantineDir + " to keep it.",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			client, err := newClient()
+			if err != nil {
+				return err
+			}
+			report, err := client.CollectGarbage(cmd.Context(), dryRun)
+			if err != nil {
+				return err
+			}
+			printGCReport(cmd, report)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "show what would be quarantined and deleted without doing it")
+	return cmd
+}
+
+// printGCReport writes a human-readable garbage collection report
+func printGCReport(cmd *cobra.Command, report *wal.GCReport) {
+	out := cmd.OutOrStdout()
+	verb := ""
+	if report.DryRun {
+		verb = "would be "
+	}
+	for _, f := range report.Quarantined {
+		fmt.Fprintf(out, "%squarantined  %s (%s, %d bytes)\n", verb, f.Name, f.Reason, f.Bytes)
+	}
+	for _, f := range report.Deleted {
+		fmt.Fprintf(out, "%sdeleted      %s (%d bytes)\n", verb, f.Name, f.Bytes)
+	}
+	for _, f := range report.Unknown {
+		fmt.Fprintf(out, "unknown      %s (%d bytes, not in the manifest; left in place)\n", f.Name, f.Bytes)
+	}
+	fmt.Fprintf(out, "%d files %squarantined (%d bytes), %d %sdeleted (%d bytes reclaimed)\n",
+		len(report.Quarantined), verb, report.QuarantinedBytes, len(report.Deleted), verb, report.ReclaimedBytes)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+func newImportChangelogCmd() *cobra.Command {
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "import-changelog FILE",
+		Short: "Replay an exported changelog into another instance",
+		Long: "Streams FILE (- for stdin), as GET /admin/changelog exported it, to POST /admin/changelog.\n" +
+			"Collections and documents are written through the WAL in the order of the export, so an\n" +
+			"empty instance becomes a copy of the exporter's. Documents exported without embeddings\n" +
+			"are embedded again. Prints the next_lsn to export from for a later incremental import.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var in io.Reader = cmd.InOrStdin()
+			if args[0] != "-" {
+				f, err := os.Open(args[0])
+				if err != nil {
+					return fmt.Errorf("failed to open %s: %w", args[0], err)
+				}
+				defer func() { _ = f.Close() }()
+				in = f
+			}
+
+			client, err := newClient()
+			if err != nil {
+				return err
+			}
+			report, err := client.ImportChangelog(cmd.Context(), in, dryRun)
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			if report.DryRun {
+				fmt.Fprintln(out, "dry run: nothing was written")
+			}
+			fmt.Fprintf(out, "applied:      %d (%d documents, %d deletes, %d collections)\n",
+				report.Applied, report.Documents, report.Deletes, report.Collections)
+			fmt.Fprintf(out, "failed:       %d\n", report.Failed)
+			fmt.Fprintf(out, "last lsn:     %d\n", report.LastLSN)
+			if report.NextLSN != 0 {
+				fmt.Fprintf(out, "next lsn:     %d\n", report.NextLSN)
+			}
+			for _, e := range report.Errors {
+				fmt.Fprintf(out, "  line %d (%s %s): %s [%s]\n", e.Line, e.Op, e.ID, e.Error, e.Code)
+			}
+			if report.Error != "" {
+				return fmt.Errorf("import stopped early: %s", report.Error)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Validate every line without writing anything")
+	return cmd
+}
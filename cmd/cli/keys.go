@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dsjohal14/selfstack/pkg/selfstack"
+	"github.com/spf13/cobra"
+)
+
+func newKeysCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "keys",
+		Short: "Create, list, rotate, and revoke API keys",
+		Long: "Manages the API's keys at /admin/keys. SELFSTACK_API_KEY must be a key listed in\n" +
+			"the API's KEY_ADMIN_KEYS.",
+	}
+	cmd.AddCommand(newKeysCreateCmd(), newKeysListCmd(), newKeysRotateCmd(), newKeysDeleteCmd())
+	return cmd
+}
+
+func newKeysCreateCmd() *cobra.Command {
+	var req selfstack.CreateKeyRequest
+
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create an API key and print its secret, which is shown only once",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			client, err := newClient()
+			if err != nil {
+				return err
+			}
+			key, err := client.CreateKey(cmd.Context(), req)
+			if err != nil {
+				return err
+			}
+			printKeySecret(cmd, key)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&req.Name, "name", "", "what the key is for")
+	cmd.Flags().StringSliceVar(&req.Namespaces, "namespace", nil, "collection the key may use (repeatable; default all)")
+	cmd.Flags().IntVar(&req.ExpiresInDays, "expires-in-days", 0, "days until the key expires (0 = never)")
+	return cmd
+}
+
+func newKeysListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List the API keys with their namespaces, expiry, and last use",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			client, err := newClient()
+			if err != nil {
+				return err
+			}
+			resp, err := client.Keys(cmd.Context())
+			if err != nil {
+				return err
+			}
+			tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "ID\tNAME\tNAMESPACES\tEXPIRES\tLAST USED\tROTATED TO")
+			for _, k := range resp.Keys {
+				namespaces := strings.Join(k.Namespaces, ",")
+				if namespaces == "" {
+					namespaces = "*"
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", k.ID, k.Name, namespaces, formatKeyTime(k.ExpiresAt), formatKeyTime(k.LastUsedAt), k.RotatedTo)
+			}
+			return tw.Flush()
+		},
+	}
+}
+
+func newKeysRotateCmd() *cobra.Command {
+	var overlap time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "rotate <id>",
+		Short: "Replace an API key and print the new secret; the old key works for the overlap",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := newClient()
+			if err != nil {
+				return err
+			}
+			key, err := client.RotateKey(cmd.Context(), args[0], overlap)
+			if err != nil {
+				return err
+			}
+			printKeySecret(cmd, key)
+			return nil
+		},
+	}
+
+	cmd.Flags().DurationVar(&overlap, "overlap", 0, "how long the old key keeps working (default 24h)")
+	return cmd
+}
+
+func newKeysDeleteCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "delete <id>",
+		Short: "Revoke an API key at once",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := newClient()
+			if err != nil {
+				return err
+			}
+			if err := client.DeleteKey(cmd.Context(), args[0]); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "deleted %s\n", args[0])
+			return nil
+		},
+	}
+}
+
+// printKeySecret writes a new key and its secret
+func printKeySecret(cmd *cobra.Command, key *selfstack.KeySecretResponse) {
+	out := cmd.OutOrStdout()
+	fmt.Fprintf(out, "id:      %s\n", key.ID)
+	fmt.Fprintf(out, "usage:   %s\n", key.UsageKey)
+	fmt.Fprintf(out, "expires: %s\n", formatKeyTime(key.ExpiresAt))
+	fmt.Fprintf(out, "secret:  %s\n", key.Secret)
+	fmt.Fprintln(out, "the secret is not shown again; store it now")
+}
+
+// formatKeyTime formats an optional key timestamp, "-" for none
+func formatKeyTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
@@ -1,9 +1,42 @@
 // Package main implements the Selfstack CLI for interacting with the system via command line.
 package main
 
-import "github.com/spf13/cobra"
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
 
 func main() {
-	root := &cobra.Command{Use: "selfstack", Short: "Selfstack CLI"}
-	_ = root.Execute()
+	root := &cobra.Command{Use: "selfstack", Short: "Selfstack CLI", SilenceUsage: true}
+	root.PersistentFlags().StringVar(&apiAddr, "addr", getEnv("SELFSTACK_URL", "http://localhost:8080"), "API server address")
+
+	root.AddCommand(newBackfillCmd())
+	root.AddCommand(newChangesCmd())
+	root.AddCommand(newCompactCmd())
+	root.AddCommand(newConfigCmd())
+	root.AddCommand(newDoctorCmd())
+	root.AddCommand(newGCCmd())
+	root.AddCommand(newImportChangelogCmd())
+	root.AddCommand(newKeysCmd())
+	root.AddCommand(newMigrateCmd())
+	root.AddCommand(newOpenAPICmd())
+	root.AddCommand(newResetCmd())
+	root.AddCommand(newRestoreCmd())
+	root.AddCommand(newRewindCmd())
+	root.AddCommand(newWALCmd())
+
+	if err := root.Execute(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// getEnv gets an environment variable with a default value
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
 }
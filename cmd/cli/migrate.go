@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+	"github.com/dsjohal14/selfstack/internal/scope/db/wal"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/spf13/cobra"
+)
+
+func newMigrateCmd() *cobra.Command {
+	var (
+		from       string
+		to         string
+		sampleSize int
+		dbURL      string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "migrate-legacy",
+		Short: "Replay a legacy (WAL_DISABLED) data directory into a new WAL store",
+		Long: "Reads metadata.jsonl and vectors.bin from --from and writes every document as an\n" +
+			"INSERT record into the WAL under --to/wal, then verifies the document count and a\n" +
+			"sample of embeddings. Run it with the API server stopped. Legacy files are not modified.",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			ctx := cmd.Context()
+			if to == "" {
+				to = from
+			}
+
+			config := db.DefaultWALStoreConfig(to)
+			config.SyncPolicy = wal.DefaultSyncPolicy() // Batched; the migration flushes at the end
+			if dbURL != "" {
+				pool, err := pgxpool.New(ctx, dbURL)
+				if err != nil {
+					return fmt.Errorf("failed to connect to database: %w", err)
+				}
+				defer pool.Close()
+				config.DB = pool
+			}
+
+			store, err := db.NewWALStore(ctx, config)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = store.Close() }()
+
+			report, err := db.MigrateLegacyStore(ctx, from, store, sampleSize)
+			if err != nil {
+				return fmt.Errorf("migration failed: %w", err)
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "migrated %d documents (%d read, %d sampled and verified) in %v\n",
+				report.DocsWritten, report.DocsRead, report.Sampled, report.Duration)
+			fmt.Fprintln(cmd.OutOrStdout(), "start the API without WAL_DISABLED to use the new store")
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&from, "from", getEnv("DATA_DIR", "./data"), "legacy data directory")
+	cmd.Flags().StringVar(&to, "to", "", "WAL store data directory (default: same as --from)")
+	cmd.Flags().IntVar(&sampleSize, "sample", 100, "documents to compare after migration")
+	cmd.Flags().StringVar(&dbURL, "database-url", os.Getenv("DATABASE_URL"), "Postgres manifest connection string")
+	return cmd
+}
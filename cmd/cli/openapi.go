@@ -0,0 +1,18 @@
+package main
+
+import (
+	httpapi "github.com/dsjohal14/selfstack/internal/http"
+	"github.com/spf13/cobra"
+)
+
+func newOpenAPICmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "openapi",
+		Short: "Print the API's OpenAPI 3 spec",
+		Long: "Generated from the route table and DTOs; docs/openapi.json is its output, and the\n" +
+			"Python client in clients/python is generated from that (make openapi).",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return httpapi.OpenAPI(cmd.OutOrStdout())
+		},
+	}
+}
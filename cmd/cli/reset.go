@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+func newResetCmd() *cobra.Command {
+	var yes bool
+
+	cmd := &cobra.Command{
+		Use:   "reset",
+		Short: "Wipe every document from the store, for CI and staging",
+		Long: "Deletes every document and alias, and the WAL segments and manifest entries holding\n" +
+			"them, in one atomic step. Collections and feature flag overrides are kept. The API\n" +
+			"only allows it for the keys in RESET_KEYS, which it refuses in production; set\n" +
+			"SELFSTACK_API_KEY to the key to send.",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if !yes {
+				return fmt.Errorf("reset deletes every document in the store at %s; rerun with --yes", apiAddr)
+			}
+			client, err := newClient()
+			if err != nil {
+				return err
+			}
+			report, err := client.Reset(cmd.Context())
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "reset at LSN %d: %d documents, %d aliases, and %d segments (%d bytes) removed in %s\n",
+				report.LSN, report.DocsRemoved, report.AliasesRemoved, report.SegmentsRemoved, report.BytesRemoved, report.Duration)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&yes, "yes", false, "confirm deleting every document")
+	return cmd
+}
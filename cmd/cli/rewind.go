@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/spf13/cobra"
+)
+
+func newRewindCmd() *cobra.Command {
+	var (
+		dataDir string
+		at      string
+		lsn     uint64
+		dbURL   string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "rewind",
+		Short: "Rewind a WAL store in place to how it was at an LSN or a point in time",
+		Long: "Opens the WAL store under --data-dir and appends records that undo every document\n" +
+			"change after --at or --lsn, as when undoing an accidental bulk delete. History is kept,\n" +
+			"so a rewind can itself be rewound. The WAL is locked by the API, so stop it first; to\n" +
+			"look at an earlier state without changing the store, use restore instead.",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			ctx := cmd.Context()
+			target, err := parseRecoveryTarget(at, lsn, time.Now())
+			if err != nil {
+				return err
+			}
+
+			config := db.DefaultWALStoreConfig(dataDir)
+			if dbURL != "" {
+				pool, err := pgxpool.New(ctx, dbURL)
+				if err != nil {
+					return fmt.Errorf("failed to connect to database: %w", err)
+				}
+				defer pool.Close()
+				config.DB = pool
+			}
+
+			store, err := db.NewWALStore(ctx, config)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = store.Close() }()
+
+			report, err := store.RewindTo(ctx, target)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "rewound to %s: %d documents restored, %d deleted (%d records after it) in %v\n",
+				target, report.Restored, report.Deleted, report.RecordsSkipped, report.Duration)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&dataDir, "data-dir", getEnv("DATA_DIR", "./data"), "data directory of the store to rewind")
+	cmd.Flags().StringVar(&at, "at", "", "time to rewind to, e.g. 14:05 or 2024-03-01T14:05:00Z")
+	cmd.Flags().Uint64Var(&lsn, "lsn", 0, "last LSN to keep, instead of --at")
+	cmd.Flags().StringVar(&dbURL, "database-url", getEnv("DATABASE_URL", ""), "Postgres manifest connection string")
+	cmd.MarkFlagsOneRequired("at", "lsn")
+	cmd.MarkFlagsMutuallyExclusive("at", "lsn")
+	return cmd
+}
@@ -0,0 +1,646 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dsjohal14/selfstack/internal/relay"
+	"github.com/dsjohal14/selfstack/internal/scope/db/wal"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/spf13/cobra"
+)
+
+func newWALCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "wal",
+		Short: "Inspect WAL directories offline",
+	}
+	cmd.AddCommand(newWALReplayCmd(), newWALStatsCmd(), newWALVerifyCmd(), newWALRepairCmd())
+	return cmd
+}
+
+func newWALReplayCmd() *cobra.Command {
+	var (
+		dir        string
+		filters    []string
+		format     string
+		ops        bool
+		embeddings bool
+		at         string
+		lsn        uint64
+	)
+
+	cmd := &cobra.Command{
+		Use:   "replay",
+		Short: "Replay a WAL directory offline and print the documents or operations it holds",
+		Long: "Replays the WAL in --dir the way recovery does, without a server or manifest, and prints\n" +
+			"the resulting document states, or with --ops the raw operation stream. Nothing in --dir is\n" +
+			"modified, so it can run against a copy of production data, or a live directory. --at or\n" +
+			"--lsn stop the replay at an earlier point, as for restore.\n\n" +
+			"--filter KEY=VALUE (repeatable, all must match) keeps doc_id, collection, source, or, with\n" +
+			"--ops, type (e.g. DELETE); a VALUE ending in * matches a prefix. Deleted documents are\n" +
+			"printed as {\"id\":...,\"deleted\":true}, which a collection or source filter leaves out.",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			ctx := cmd.Context()
+			f, err := parseReplayFilters(filters, ops)
+			if err != nil {
+				return err
+			}
+			if _, err := os.Stat(dir); err != nil {
+				return fmt.Errorf("no WAL directory: %w", err)
+			}
+			if format != "ndjson" && format != "text" {
+				return fmt.Errorf("invalid --format %q: must be ndjson or text", format)
+			}
+			var target wal.RecoveryTarget
+			if at != "" || lsn != 0 {
+				if target, err = parseRecoveryTarget(at, lsn, time.Now()); err != nil {
+					return err
+				}
+			}
+
+			out := newReplayWriter(cmd.OutOrStdout(), format, embeddings)
+			if ops {
+				n := 0
+				err := wal.ScanOps(dir, target, func(op wal.Op) error {
+					if !f.matchOp(op) {
+						return nil
+					}
+					n++
+					return out.op(op)
+				})
+				if err != nil {
+					return err
+				}
+				if err := out.flush(); err != nil {
+					return err
+				}
+				fmt.Fprintf(cmd.ErrOrStderr(), "%d operations\n", n)
+				return nil
+			}
+
+			replayed, err := wal.ReplayDocs(ctx, dir, target)
+			if err != nil {
+				return err
+			}
+			live, deleted := 0, 0
+			for i := range replayed.Docs {
+				if doc := &replayed.Docs[i]; f.matchDoc(doc.DocID, doc.Collection, doc.Source) {
+					live++
+					if err := out.doc(doc); err != nil {
+						return err
+					}
+				}
+			}
+			for _, id := range replayed.Deleted {
+				if f.matchDoc(id, "", "") {
+					deleted++
+					if err := out.deleted(id); err != nil {
+						return err
+					}
+				}
+			}
+			if err := out.flush(); err != nil {
+				return err
+			}
+			stats := replayed.Stats
+			fmt.Fprintf(cmd.ErrOrStderr(), "%d documents, %d deleted, from %d records (%d snapshot records, %d after the target skipped, %d corrupt) up to LSN %d\n",
+				live, deleted, stats.RecordsLoaded, stats.SnapshotRecords, stats.SkippedAfter, stats.CorruptRecords, stats.MaxLSN)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&dir, "dir", filepath.Join(getEnv("DATA_DIR", "./data"), "wal"), "WAL directory to replay")
+	cmd.Flags().StringArrayVar(&filters, "filter", nil, "KEY=VALUE to keep, e.g. doc_id=doc-1 or collection=notes (repeatable)")
+	cmd.Flags().StringVar(&format, "format", "ndjson", "output format: ndjson or text")
+	cmd.Flags().BoolVar(&ops, "ops", false, "print the operation stream instead of the resulting documents")
+	cmd.Flags().BoolVar(&embeddings, "embeddings", false, "include embeddings in ndjson output")
+	cmd.Flags().StringVar(&at, "at", "", "stop at this time, e.g. 14:05 or 2024-03-01T14:05:00Z")
+	cmd.Flags().Uint64Var(&lsn, "lsn", 0, "stop after this LSN, instead of --at")
+	cmd.MarkFlagsMutuallyExclusive("at", "lsn")
+	return cmd
+}
+
+func newWALStatsCmd() *cobra.Command {
+	var (
+		dir      string
+		format   string
+		top      int
+		segments bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "stats",
+		Short: "Summarize the records in a WAL directory",
+		Long: "Reads every segment in --dir and prints record counts by type, histograms of record sizes\n" +
+			"and ages, the most-written keys, and how much of each segment is dead: checkpoints and\n" +
+			"records a newer one for the same key replaced, which compaction would drop. Nothing in\n" +
+			"--dir is modified, and corrupt regions are skipped and counted.",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if _, err := os.Stat(dir); err != nil {
+				return fmt.Errorf("no WAL directory: %w", err)
+			}
+			if format != "text" && format != "json" {
+				return fmt.Errorf("invalid --format %q: must be text or json", format)
+			}
+			stats, err := wal.ScanStats(dir, time.Now(), top)
+			if err != nil {
+				return err
+			}
+			if format == "json" {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				return enc.Encode(stats)
+			}
+			return printWALStats(cmd.OutOrStdout(), stats, segments)
+		},
+	}
+
+	cmd.Flags().StringVar(&dir, "dir", filepath.Join(getEnv("DATA_DIR", "./data"), "wal"), "WAL directory to read")
+	cmd.Flags().StringVar(&format, "format", "text", "output format: text or json")
+	cmd.Flags().IntVar(&top, "top", 10, "number of most-written keys to list")
+	cmd.Flags().BoolVar(&segments, "segments", false, "list every segment in text output, not just the totals")
+	return cmd
+}
+
+func newWALVerifyCmd() *cobra.Command {
+	var (
+		dir    string
+		dbURL  string
+		format string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Check every record and segment in a WAL directory",
+		Long: "Reads every segment in --dir and checks record checksums, footers, that LSNs increase\n" +
+			"within each segment, and that the WAL segments hold every LSN once, with gaps only where\n" +
+			"a compacted segment took over. With --database-url it also checks the Postgres manifest\n" +
+			"agrees with the files. Nothing is modified. Exits 1 if any error is found; a torn tail on\n" +
+			"the newest segment, which recovery drops, and files gc would quarantine only warn.",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			ctx := cmd.Context()
+			if _, err := os.Stat(dir); err != nil {
+				return fmt.Errorf("no WAL directory: %w", err)
+			}
+			if format != "text" && format != "json" {
+				return fmt.Errorf("invalid --format %q: must be text or json", format)
+			}
+			var manifest wal.ManifestStore
+			if dbURL != "" {
+				pool, err := pgxpool.New(ctx, dbURL)
+				if err != nil {
+					return fmt.Errorf("failed to connect to database: %w", err)
+				}
+				defer pool.Close()
+				manifest = wal.NewPostgresManifest(pool)
+			}
+
+			report, err := wal.VerifyAll(ctx, dir, manifest)
+			if err != nil {
+				return err
+			}
+			if format == "json" {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				err = enc.Encode(report)
+			} else {
+				err = printWALVerify(cmd.OutOrStdout(), report)
+			}
+			if err != nil {
+				return err
+			}
+			if !report.OK() {
+				return fmt.Errorf("%d errors found", report.Errors)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&dir, "dir", filepath.Join(getEnv("DATA_DIR", "./data"), "wal"), "WAL directory to verify")
+	cmd.Flags().StringVar(&dbURL, "database-url", getEnv("DATABASE_URL", ""), "Postgres manifest to cross-check; empty checks the files alone")
+	cmd.Flags().StringVar(&format, "format", "text", "output format: text or json")
+	return cmd
+}
+
+func newWALRepairCmd() *cobra.Command {
+	var (
+		dir         string
+		dbURL       string
+		resync      bool
+		dryRun      bool
+		format      string
+		compression string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "repair SEGMENT",
+		Short: "Rewrite a damaged segment keeping only its valid records",
+		Long: "Rewrites SEGMENT, a file in --dir as verify names it, without its corrupt records, for when\n" +
+			"no archive or replica holds a good copy. Without --resync the segment is cut at the first\n" +
+			"corrupt record; with it the valid records after each corrupt region are kept, as recovery\n" +
+			"keeps them. A batch a corrupt region cuts short is dropped whole. The dropped bytes are\n" +
+			"copied into --dir/.quarantine first, and with --database-url the Postgres manifest gets the\n" +
+			"new checksum. The directory is locked, so stop the API first.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			if format != "text" && format != "json" {
+				return fmt.Errorf("invalid --format %q: must be text or json", format)
+			}
+			path := filepath.Join(dir, filepath.Base(args[0]))
+			if _, err := os.Stat(path); err != nil {
+				return fmt.Errorf("no segment: %w", err)
+			}
+			fs, _ := wal.DetectFilesystem(dir)
+			lock, err := wal.LockDir(dir, wal.LockAuto, fs)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = lock.Unlock() }()
+
+			opts := wal.RepairSegmentOptions{Resync: resync, DryRun: dryRun}
+			if compression != "" {
+				c, err := wal.ParseCompression(compression)
+				if err != nil {
+					return err
+				}
+				opts.Compression = c
+			}
+			if dbURL != "" {
+				pool, err := pgxpool.New(ctx, dbURL)
+				if err != nil {
+					return fmt.Errorf("failed to connect to database: %w", err)
+				}
+				defer pool.Close()
+				opts.Manifest = wal.NewPostgresManifest(pool)
+			}
+
+			report, err := wal.RepairSegment(wal.WithSegmentActor(ctx, wal.ActorAdmin, "wal repair"), path, opts)
+			if err != nil {
+				return err
+			}
+			if format == "json" {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				return enc.Encode(report)
+			}
+			printWALRepair(cmd.OutOrStdout(), report)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&dir, "dir", filepath.Join(getEnv("DATA_DIR", "./data"), "wal"), "WAL directory holding the segment")
+	cmd.Flags().StringVar(&dbURL, "database-url", getEnv("DATABASE_URL", ""), "Postgres manifest to update; empty leaves it alone")
+	cmd.Flags().BoolVar(&resync, "resync", false, "keep the valid records after a corrupt region instead of cutting the segment there")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "report what would be dropped without changing anything")
+	cmd.Flags().StringVar(&compression, "compression", getEnv("WAL_COMPRESSION", ""), "compress the rewritten segment: none or zstd; empty keeps the segment's own")
+	cmd.Flags().StringVar(&format, "format", "text", "output format: text or json")
+	return cmd
+}
+
+// printWALRepair prints the dropped regions, then what the segment kept
+func printWALRepair(out io.Writer, report *wal.RepairReport) {
+	if len(report.Regions) == 0 {
+		fmt.Fprintf(out, "%s: nothing to repair (%d records)\n", report.Segment, report.Records)
+		return
+	}
+	for _, r := range report.Regions {
+		fmt.Fprintf(out, "  dropped %d bytes at offset %d", r.Bytes, r.Offset)
+		if r.Records > 0 {
+			fmt.Fprintf(out, " (%d valid records of a cut batch)", r.Records)
+		}
+		fmt.Fprintln(out)
+	}
+	verb := "repaired"
+	if report.DryRun {
+		verb = "would repair"
+	}
+	fmt.Fprintf(out, "%s %s: kept %d records (LSNs %d to %d), dropped %d bytes and %d records\n",
+		verb, report.Segment, report.Records, report.MinLSN, report.MaxLSN, report.DroppedBytes, report.DroppedRecords)
+	if report.Quarantine != "" {
+		fmt.Fprintf(out, "dropped bytes copied to %s\n", report.Quarantine)
+	}
+	if report.Manifest {
+		fmt.Fprintf(out, "manifest updated (checksum %s)\n", report.Checksum)
+	}
+}
+
+// printWALVerify prints the issues found, then a summary line
+func printWALVerify(out io.Writer, report *wal.VerifyReport) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	if len(report.Issues) > 0 {
+		fmt.Fprintln(w, "SEVERITY\tSEGMENT\tCHECK\tDETAIL")
+		for _, issue := range report.Issues {
+			segment := issue.Segment
+			if segment == "" {
+				segment = "-"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", strings.ToUpper(string(issue.Severity)), segment, issue.Check, issue.Detail)
+		}
+		fmt.Fprintln(w)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	manifest := "files only"
+	if report.Manifest {
+		manifest = "checked against the manifest"
+	}
+	_, err := fmt.Fprintf(out, "%d segments, %d records, %s: %d errors, %d warnings\n",
+		len(report.Segments), report.Records, manifest, report.Errors, report.Warnings)
+	return err
+}
+
+// printWALStats prints the totals, histograms, hot keys and, with
+// segments, one line per segment
+func printWALStats(out io.Writer, stats *wal.WALStats, segments bool) error {
+	fmt.Fprintf(out, "%d segments, %s on disk, %d records (%s), %d snapshots (%s)\n",
+		len(stats.Segments), formatBytes(stats.FileBytes), stats.Records, formatBytes(stats.Bytes), stats.Snapshots, formatBytes(stats.SnapshotBytes))
+	fmt.Fprintf(out, "Dead: %d records, %s (%.1f%%)\n", stats.DeadRecords, formatBytes(stats.DeadBytes), stats.DeadRatio*100)
+	fmt.Fprintf(out, "Keys: %d written, %d live, %d deleted\n", stats.DistinctKeys, stats.LiveKeys, stats.Tombstones)
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\nTYPE\tRECORDS")
+	types := make([]string, 0, len(stats.Types))
+	for t := range stats.Types {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	for _, t := range types {
+		fmt.Fprintf(w, "%s\t%d\n", t, stats.Types[t])
+	}
+	printHistogram(w, "SIZE", stats.SizeHistogram, stats.Records)
+	printHistogram(w, "AGE", stats.AgeHistogram, stats.Records)
+
+	if len(stats.HotKeys) > 0 {
+		fmt.Fprintln(w, "\nKEY\tKIND\tWRITES\tBYTES\tLAST LSN")
+		for _, k := range stats.HotKeys {
+			key := k.Key
+			if k.Deleted {
+				key += " (deleted)"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%d\n", key, k.Kind, k.Writes, formatBytes(k.Bytes), k.LastLSN)
+		}
+	}
+
+	if segments {
+		fmt.Fprintln(w, "\nSEGMENT\tFILE\tRECORDS\tLSNS\tNEWEST\tDEAD\tNOTE")
+		for _, seg := range stats.Segments {
+			newest := "-"
+			if seg.Newest != nil {
+				newest = seg.Newest.Format(time.RFC3339)
+			}
+			note := seg.Error
+			if seg.Corrupt > 0 {
+				note = strings.TrimSpace(fmt.Sprintf("%d corrupt regions skipped (%s) %s", seg.Corrupt, formatBytes(seg.SkippedBytes), note))
+			}
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d-%d\t%s\t%.1f%%\t%s\n",
+				seg.Segment, formatBytes(seg.FileBytes), seg.Records, seg.MinLSN, seg.MaxLSN, newest, seg.DeadRatio*100, note)
+		}
+	}
+	return w.Flush()
+}
+
+// printHistogram prints buckets with a bar scaled to the share of total
+func printHistogram(w io.Writer, title string, buckets []wal.Bucket, total int) {
+	fmt.Fprintf(w, "\n%s\tRECORDS\tBYTES\t\n", title)
+	for _, b := range buckets {
+		bar := ""
+		if total > 0 {
+			bar = strings.Repeat("#", (b.Count*40+total-1)/total)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", b.Label, b.Count, formatBytes(b.Bytes), bar)
+	}
+}
+
+// formatBytes renders n in binary units, e.g. "1.5 GiB"
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// replayFilter keeps the documents or operations matching every condition
+type replayFilter map[string]string
+
+// parseReplayFilters reads --filter KEY=VALUE flags; type only applies to
+// operations
+func parseReplayFilters(flags []string, ops bool) (replayFilter, error) {
+	f := make(replayFilter)
+	for _, flag := range flags {
+		key, value, ok := strings.Cut(flag, "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("invalid --filter %q: want KEY=VALUE, e.g. doc_id=doc-1", flag)
+		}
+		switch key {
+		case "doc_id", "collection", "source":
+		case "type":
+			if !ops {
+				return nil, fmt.Errorf("--filter type only applies with --ops")
+			}
+			value = strings.ToUpper(value)
+		default:
+			return nil, fmt.Errorf("invalid --filter %q: key must be doc_id, collection, source, or type", flag)
+		}
+		f[key] = value
+	}
+	return f, nil
+}
+
+// match reports whether value passes the condition on key, if any
+func (f replayFilter) match(key, value string) bool {
+	want, ok := f[key]
+	if !ok {
+		return true
+	}
+	if prefix, isPrefix := strings.CutSuffix(want, "*"); isPrefix {
+		return strings.HasPrefix(value, prefix)
+	}
+	return value == want
+}
+
+func (f replayFilter) matchDoc(id, collection, source string) bool {
+	return f.match("doc_id", id) && f.match("collection", collection) && f.match("source", source)
+}
+
+// matchOp matches doc_id against the keys of document records only, so
+// doc_id=x doesn't pick up a KV entry or collection named x
+func (f replayFilter) matchOp(op wal.Op) bool {
+	var id, collection, source string
+	switch {
+	case op.Doc != nil:
+		id, collection, source = op.Key, op.Doc.Collection, op.Doc.Source
+	case op.Delete != nil:
+		id = op.Key
+	}
+	return f.matchDoc(id, collection, source) && f.match("type", op.Type.String())
+}
+
+// replayWriter prints documents and operations as ndjson or text
+type replayWriter struct {
+	json       *json.Encoder
+	text       *tabwriter.Writer
+	header     bool
+	embeddings bool
+}
+
+func newReplayWriter(w io.Writer, format string, embeddings bool) *replayWriter {
+	if format == "text" {
+		return &replayWriter{text: tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)}
+	}
+	return &replayWriter{json: json.NewEncoder(w), embeddings: embeddings}
+}
+
+// replayDoc is the ndjson form of a document
+type replayDoc struct {
+	ID         string            `json:"id"`
+	Collection string            `json:"collection,omitempty"`
+	Source     string            `json:"source,omitempty"`
+	Title      string            `json:"title,omitempty"`
+	Text       string            `json:"text,omitempty"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+	CreatedAt  *time.Time        `json:"created_at,omitempty"`
+	LSN        uint64            `json:"lsn,omitempty"`
+	Embedding  *relay.Embedding  `json:"embedding,omitempty"`
+	Deleted    bool              `json:"deleted,omitempty"`
+}
+
+// replayOp is the ndjson form of an operation
+type replayOp struct {
+	LSN       uint64     `json:"lsn"`
+	At        *time.Time `json:"at,omitempty"`
+	Type      string     `json:"type"`
+	Segment   string     `json:"segment"`
+	Origin    uint16     `json:"origin,omitempty"`
+	Batch     bool       `json:"batch,omitempty"`
+	Key       string     `json:"key,omitempty"`
+	Doc       *replayDoc `json:"doc,omitempty"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	DeletedBy string     `json:"deleted_by,omitempty"`
+	Value     any        `json:"value,omitempty"`
+	KVDeleted bool       `json:"kv_deleted,omitempty"`
+}
+
+func (w *replayWriter) toDoc(doc *wal.RecoveredDoc) replayDoc {
+	d := replayDoc{ID: doc.DocID, Collection: doc.Collection, Source: doc.Source, Title: doc.Title, Text: doc.Text, Metadata: doc.Metadata, CreatedAt: optionalTime(doc.CreatedAt), LSN: doc.LSN}
+	if w.embeddings {
+		d.Embedding = &doc.Embedding
+	}
+	return d
+}
+
+func (w *replayWriter) doc(doc *wal.RecoveredDoc) error {
+	if w.text == nil {
+		return w.json.Encode(w.toDoc(doc))
+	}
+	w.textHeader("ID\tCOLLECTION\tLSN\tTITLE")
+	_, err := fmt.Fprintf(w.text, "%s\t%s\t%d\t%s\n", doc.DocID, doc.Collection, doc.LSN, doc.Title)
+	return err
+}
+
+func (w *replayWriter) deleted(id string) error {
+	if w.text == nil {
+		return w.json.Encode(replayDoc{ID: id, Deleted: true})
+	}
+	w.textHeader("ID\tCOLLECTION\tLSN\tTITLE")
+	_, err := fmt.Fprintf(w.text, "%s\t-\t-\t(deleted)\n", id)
+	return err
+}
+
+func (w *replayWriter) op(op wal.Op) error {
+	var at *time.Time
+	if op.At != 0 {
+		at = optionalTime(op.At.Wall())
+	}
+	if w.text != nil {
+		w.textHeader("LSN\tAT\tTYPE\tKEY\tDETAIL")
+		when := "-"
+		if at != nil {
+			when = at.Format(time.RFC3339Nano)
+		}
+		_, err := fmt.Fprintf(w.text, "%d\t%s\t%s\t%s\t%s\n", op.LSN, when, op.Type, op.Key, opDetail(op))
+		return err
+	}
+
+	o := replayOp{LSN: op.LSN, At: at, Type: op.Type.String(), Segment: op.Segment, Origin: op.Origin, Batch: op.Batch, Key: op.Key, KVDeleted: op.KVDeleted}
+	if op.Doc != nil {
+		d := w.toDoc(op.Doc)
+		d.LSN = 0 // The op's
+		o.Doc = &d
+	}
+	if op.Delete != nil {
+		o.DeletedAt, o.DeletedBy = optionalTime(op.Delete.DeletedAt), op.Delete.DeletedBy
+	}
+	if len(op.Value) > 0 {
+		o.Value = jsonValue(op.Value)
+	}
+	return w.json.Encode(o)
+}
+
+// opDetail summarizes an operation for text output
+func opDetail(op wal.Op) string {
+	switch {
+	case op.Doc != nil && op.Doc.Collection != "":
+		return fmt.Sprintf("collection=%s title=%q", op.Doc.Collection, op.Doc.Title)
+	case op.Doc != nil:
+		return fmt.Sprintf("title=%q", op.Doc.Title)
+	case op.Delete != nil && op.Delete.DeletedBy != "":
+		return "by " + op.Delete.DeletedBy
+	case op.KVDeleted:
+		return "(deleted)"
+	case len(op.Value) > 0:
+		return fmt.Sprintf("%d bytes", len(op.Value))
+	}
+	return ""
+}
+
+func (w *replayWriter) textHeader(header string) {
+	if !w.header {
+		fmt.Fprintln(w.text, header)
+		w.header = true
+	}
+}
+
+func (w *replayWriter) flush() error {
+	if w.text != nil {
+		return w.text.Flush()
+	}
+	return nil
+}
+
+// jsonValue returns a KV value or collection config as JSON when it is,
+// as a string when it's text, and as base64 otherwise
+func jsonValue(b []byte) any {
+	if json.Valid(b) {
+		return json.RawMessage(b)
+	}
+	if utf8.Valid(b) {
+		return string(b)
+	}
+	return b
+}
+
+// optionalTime returns nil for the zero time, so it's left out of JSON
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	t = t.UTC()
+	return &t
+}
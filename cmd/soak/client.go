@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// client is a minimal Selfstack API client
+type client struct {
+	base string
+	http *http.Client
+}
+
+func newClient(addr string) *client {
+	return &client{base: strings.TrimRight(addr, "/"), http: &http.Client{Timeout: 10 * time.Second}}
+}
+
+type ingestRequest struct {
+	ID     string `json:"id"`
+	Source string `json:"source"`
+	Title  string `json:"title"`
+	Text   string `json:"text"`
+}
+
+type document struct {
+	ID   string `json:"id"`
+	Text string `json:"text"`
+}
+
+type searchResponse struct {
+	Results []struct {
+		DocID string `json:"doc_id"`
+		Text  string `json:"text"`
+	} `json:"results"`
+}
+
+type healthResponse struct {
+	DocCount int `json:"doc_count"`
+}
+
+// do sends a request and decodes a JSON response into out (if non-nil),
+// returning the HTTP status
+func (c *client) do(ctx context.Context, method, path string, body, out any) (int, error) {
+	var rd io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		rd = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, rd)
+	if err != nil {
+		return 0, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if out != nil && resp.StatusCode < 300 {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp.StatusCode, fmt.Errorf("failed to decode %s %s: %w", method, path, err)
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+// ingest writes a document; ok is true only for an acknowledged write
+func (c *client) ingest(ctx context.Context, id, text string) (bool, error) {
+	status, err := c.do(ctx, http.MethodPost, "/ingest", ingestRequest{ID: id, Source: "soak", Title: id, Text: text}, nil)
+	return err == nil && status == http.StatusOK, err
+}
+
+// remove deletes a document; a 404 means it was already gone
+func (c *client) remove(ctx context.Context, id string) (bool, error) {
+	status, err := c.do(ctx, http.MethodDelete, "/documents/"+id, nil, nil)
+	return err == nil && (status == http.StatusOK || status == http.StatusNotFound), err
+}
+
+// get fetches a document; found is false on 404
+func (c *client) get(ctx context.Context, id string) (doc document, found bool, err error) {
+	status, err := c.do(ctx, http.MethodGet, "/documents/"+id, nil, &doc)
+	if err != nil {
+		return doc, false, err
+	}
+	switch status {
+	case http.StatusOK:
+		return doc, true, nil
+	case http.StatusNotFound:
+		return doc, false, nil
+	default:
+		return doc, false, fmt.Errorf("GET /documents/%s: status %d", id, status)
+	}
+}
+
+func (c *client) search(ctx context.Context, query string) (*searchResponse, error) {
+	var resp searchResponse
+	status, err := c.do(ctx, http.MethodPost, "/search", map[string]any{"query": query, "limit": 20}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("search: status %d", status)
+	}
+	return &resp, nil
+}
+
+func (c *client) count(ctx context.Context) (int, error) {
+	var resp healthResponse
+	status, err := c.do(ctx, http.MethodGet, "/health", nil, &resp)
+	if err != nil {
+		return 0, err
+	}
+	if status != http.StatusOK {
+		return 0, fmt.Errorf("health: status %d", status)
+	}
+	return resp.DocCount, nil
+}
+
+// waitReady polls /health until it answers or the timeout elapses
+func (c *client) waitReady(ctx context.Context, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		if _, err := c.count(ctx); err == nil {
+			return nil
+		} else if time.Now().After(deadline) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(250 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,169 @@
+// Package main implements a chaos/soak tester that drives a Selfstack API with
+// mixed workloads, optionally kills and restarts it, and checks invariants.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+type options struct {
+	addr        string
+	duration    time.Duration
+	workers     int
+	docs        int
+	seed        int64
+	apiCmd      string
+	killEvery   time.Duration
+	checkEvery  time.Duration
+	reportEvery time.Duration
+}
+
+func main() {
+	var opts options
+	flag.StringVar(&opts.addr, "addr", getEnv("SELFSTACK_URL", "http://localhost:8080"), "API server address")
+	flag.DurationVar(&opts.duration, "duration", 10*time.Minute, "how long to run")
+	flag.IntVar(&opts.workers, "workers", 8, "concurrent workload goroutines")
+	flag.IntVar(&opts.docs, "docs", 500, "size of the document ID space")
+	flag.Int64Var(&opts.seed, "seed", time.Now().UnixNano(), "random seed")
+	flag.StringVar(&opts.apiCmd, "api-cmd", "", "command that starts the API locally; enables kill/restart chaos (e.g. \"go run ./cmd/api\")")
+	flag.DurationVar(&opts.killEvery, "kill-every", 45*time.Second, "mean time between SIGKILLs of the API (with -api-cmd)")
+	flag.DurationVar(&opts.checkEvery, "check-every", 15*time.Second, "how often to pause writes and compare counts")
+	flag.DurationVar(&opts.reportEvery, "report-every", 10*time.Second, "progress report interval")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	violations, err := run(ctx, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "soak: %v\n", err)
+		os.Exit(2)
+	}
+	if violations > 0 {
+		fmt.Fprintf(os.Stderr, "soak: %d invariant violation(s)\n", violations)
+		os.Exit(1)
+	}
+	fmt.Println("soak: no invariant violations")
+}
+
+// run drives the workload until the duration elapses or ctx is canceled
+func run(ctx context.Context, opts options) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, opts.duration)
+	defer cancel()
+
+	fmt.Printf("soak: addr=%s workers=%d docs=%d seed=%d chaos=%v\n",
+		opts.addr, opts.workers, opts.docs, opts.seed, opts.apiCmd != "")
+
+	client := newClient(opts.addr)
+	model := newModel(opts.docs, fmt.Sprintf("soak-%d", opts.seed))
+	stats := &stats{}
+
+	var proc *apiProcess
+	if opts.apiCmd != "" {
+		proc = newAPIProcess(strings.Fields(opts.apiCmd))
+		if err := proc.Start(); err != nil {
+			return 0, err
+		}
+		defer proc.Stop()
+	}
+	if err := client.waitReady(ctx, time.Minute); err != nil {
+		return 0, err
+	}
+	baseline, err := client.count(ctx)
+	if err != nil {
+		return 0, err
+	}
+	model.baseline = baseline
+
+	// Workers hold gate for reading; the checker and chaos loop take it
+	// exclusively so counts are compared and kills happen between requests
+	var gate sync.RWMutex
+	var wg sync.WaitGroup
+
+	for i := 0; i < opts.workers; i++ {
+		rng := rand.New(rand.NewSource(opts.seed + int64(i)))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				gate.RLock()
+				step(ctx, client, model, stats, rng)
+				gate.RUnlock()
+			}
+		}()
+	}
+
+	checkTicker := time.NewTicker(opts.checkEvery)
+	defer checkTicker.Stop()
+	reportTicker := time.NewTicker(opts.reportEvery)
+	defer reportTicker.Stop()
+
+	chaosRNG := rand.New(rand.NewSource(opts.seed - 1))
+	var killC <-chan time.Time
+	if proc != nil {
+		killC = time.After(jitter(chaosRNG, opts.killEvery))
+	}
+
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			break loop
+		case <-reportTicker.C:
+			stats.report()
+		case <-checkTicker.C:
+			gate.Lock()
+			checkCount(ctx, client, model, stats)
+			gate.Unlock()
+		case <-killC:
+			gate.Lock()
+			stats.kills.Add(1)
+			fmt.Println("soak: killing API")
+			if err := proc.Restart(); err != nil {
+				gate.Unlock()
+				return stats.violations(), err
+			}
+			if err := client.waitReady(ctx, time.Minute); err != nil && ctx.Err() == nil {
+				gate.Unlock()
+				return stats.violations(), fmt.Errorf("API did not come back after restart: %w", err)
+			}
+			// Every acknowledged write must have survived the crash
+			verifyAll(ctx, client, model, stats)
+			gate.Unlock()
+			killC = time.After(jitter(chaosRNG, opts.killEvery))
+		}
+	}
+
+	wg.Wait()
+
+	// Final full verification
+	finalCtx, finalCancel := context.WithTimeout(context.Background(), time.Minute)
+	defer finalCancel()
+	verifyAll(finalCtx, client, model, stats)
+	checkCount(finalCtx, client, model, stats)
+	stats.report()
+
+	return stats.violations(), nil
+}
+
+// jitter returns a duration uniformly distributed in [d/2, 3d/2)
+func jitter(rng *rand.Rand, d time.Duration) time.Duration {
+	return d/2 + time.Duration(rng.Int63n(int64(d)))
+}
+
+// getEnv gets an environment variable with a default value
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
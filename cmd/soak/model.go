@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// docState is the client-side view of one document
+type docState struct {
+	mu        sync.Mutex // Held for the duration of any request touching the doc
+	live      bool
+	text      string
+	uncertain bool   // A write failed, so the server may or may not have applied it
+	version   uint64 // Odd while a write is in flight (read without mu by search checks)
+}
+
+// model tracks what the server should contain given acknowledged writes
+type model struct {
+	prefix   string
+	baseline int // Documents already present before the run
+	docs     []docState
+}
+
+func newModel(size int, prefix string) *model {
+	return &model{prefix: prefix, docs: make([]docState, size)}
+}
+
+func (m *model) id(i int) string {
+	return fmt.Sprintf("%s-%06d", m.prefix, i)
+}
+
+// index maps a document ID back to its slot, or -1 for foreign documents
+func (m *model) index(id string) int {
+	var i int
+	if _, err := fmt.Sscanf(id, m.prefix+"-%06d", &i); err != nil || i < 0 || i >= len(m.docs) || m.id(i) != id {
+		return -1
+	}
+	return i
+}
+
+// liveCount returns the expected document count and how many docs are uncertain
+func (m *model) liveCount() (live, uncertain int) {
+	for i := range m.docs {
+		d := &m.docs[i]
+		d.mu.Lock()
+		if d.uncertain {
+			uncertain++
+		} else if d.live {
+			live++
+		}
+		d.mu.Unlock()
+	}
+	return live, uncertain
+}
+
+func (d *docState) loadVersion() uint64 {
+	return atomic.LoadUint64(&d.version)
+}
+
+// beginWrite marks a write as in flight. Caller holds d.mu.
+func (d *docState) beginWrite() uint64 {
+	return atomic.AddUint64(&d.version, 1)
+}
+
+// endWrite marks the in-flight write as finished. Caller holds d.mu.
+func (d *docState) endWrite() {
+	atomic.AddUint64(&d.version, 1)
+}
+
+// stats are counters reported periodically and at exit
+type stats struct {
+	ingests, deletes, searches, gets atomic.Int64
+	errors, kills, checks            atomic.Int64
+	violationCount                   atomic.Int64
+}
+
+func (s *stats) violation(format string, args ...any) {
+	s.violationCount.Add(1)
+	fmt.Printf("VIOLATION: "+format+"\n", args...)
+}
+
+func (s *stats) violations() int {
+	return int(s.violationCount.Load())
+}
+
+func (s *stats) report() {
+	fmt.Printf("soak: ingests=%d deletes=%d searches=%d gets=%d errors=%d kills=%d checks=%d violations=%d\n",
+		s.ingests.Load(), s.deletes.Load(), s.searches.Load(), s.gets.Load(),
+		s.errors.Load(), s.kills.Load(), s.checks.Load(), s.violationCount.Load())
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// apiProcess runs the API as a child process so it can be killed and restarted
+type apiProcess struct {
+	args []string
+	cmd  *exec.Cmd
+	done chan struct{}
+}
+
+func newAPIProcess(args []string) *apiProcess {
+	return &apiProcess{args: args}
+}
+
+// Start launches the API. Acknowledged writes must survive SIGKILL, so
+// WAL_SYNC_IMMEDIATE is forced on.
+func (p *apiProcess) Start() error {
+	cmd := exec.Command(p.args[0], p.args[1:]...)
+	cmd.Env = append(os.Environ(), "WAL_SYNC_IMMEDIATE=true")
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	// Own process group so wrappers like `go run` are killed with the server
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start API: %w", err)
+	}
+	p.cmd = cmd
+	p.done = make(chan struct{})
+	go func() {
+		_ = cmd.Wait()
+		close(p.done)
+	}()
+	return nil
+}
+
+// Stop SIGKILLs the API and waits for it to exit
+func (p *apiProcess) Stop() {
+	if p.cmd == nil {
+		return
+	}
+	_ = syscall.Kill(-p.cmd.Process.Pid, syscall.SIGKILL)
+	<-p.done
+	p.cmd = nil
+}
+
+// Restart kills the API without warning and starts it again
+func (p *apiProcess) Restart() error {
+	p.Stop()
+	return p.Start()
+}
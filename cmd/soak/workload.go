@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// vocabulary seeds document text and search queries
+var vocabulary = strings.Fields(`alpha bravo charlie delta echo foxtrot golf hotel
+india juliet kilo lima mike november oscar papa quebec romeo sierra tango
+uniform victor whiskey xray yankee zulu ledger invoice meeting travel receipt`)
+
+func randomText(rng *rand.Rand, id string, version uint64) string {
+	words := make([]string, 8)
+	for i := range words {
+		words[i] = vocabulary[rng.Intn(len(vocabulary))]
+	}
+	return fmt.Sprintf("%s v%d %s", id, version, strings.Join(words, " "))
+}
+
+// step runs one randomly chosen operation and checks what it observed
+func step(ctx context.Context, c *client, m *model, s *stats, rng *rand.Rand) {
+	switch n := rng.Intn(100); {
+	case n < 50:
+		doIngest(ctx, c, m, s, rng)
+	case n < 65:
+		doDelete(ctx, c, m, s, rng)
+	case n < 85:
+		doSearch(ctx, c, m, s, rng)
+	default:
+		doGet(ctx, c, m, s, rng)
+	}
+}
+
+// doIngest inserts or updates a document
+func doIngest(ctx context.Context, c *client, m *model, s *stats, rng *rand.Rand) {
+	i := rng.Intn(len(m.docs))
+	d := &m.docs[i]
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	id := m.id(i)
+	text := randomText(rng, id, d.beginWrite())
+	defer d.endWrite()
+	ok, _ := c.ingest(ctx, id, text)
+	if ctx.Err() != nil && !ok {
+		d.uncertain = true
+		return
+	}
+	s.ingests.Add(1)
+	if !ok {
+		s.errors.Add(1)
+		d.uncertain = true
+		return
+	}
+	d.live, d.text, d.uncertain = true, text, false
+}
+
+// doDelete deletes a document that may or may not exist
+func doDelete(ctx context.Context, c *client, m *model, s *stats, rng *rand.Rand) {
+	i := rng.Intn(len(m.docs))
+	d := &m.docs[i]
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.beginWrite()
+	defer d.endWrite()
+	ok, _ := c.remove(ctx, m.id(i))
+	if ctx.Err() != nil && !ok {
+		d.uncertain = true
+		return
+	}
+	s.deletes.Add(1)
+	if !ok {
+		s.errors.Add(1)
+		d.uncertain = true
+		return
+	}
+	d.live, d.text, d.uncertain = false, "", false
+}
+
+// doGet reads one document and compares it with the model
+func doGet(ctx context.Context, c *client, m *model, s *stats, rng *rand.Rand) {
+	i := rng.Intn(len(m.docs))
+	d := &m.docs[i]
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	doc, found, err := c.get(ctx, m.id(i))
+	if err != nil {
+		if ctx.Err() == nil {
+			s.errors.Add(1)
+		}
+		return
+	}
+	s.gets.Add(1)
+	checkDoc(m, s, i, d, doc, found)
+}
+
+// doSearch runs a query and checks that results agree with the model. Docs
+// with a write in flight at any point during the search are skipped.
+func doSearch(ctx context.Context, c *client, m *model, s *stats, rng *rand.Rand) {
+	query := vocabulary[rng.Intn(len(vocabulary))] + " " + vocabulary[rng.Intn(len(vocabulary))]
+
+	before := make([]uint64, len(m.docs))
+	for i := range m.docs {
+		before[i] = m.docs[i].loadVersion()
+	}
+
+	resp, err := c.search(ctx, query)
+	if err != nil {
+		if ctx.Err() == nil {
+			s.errors.Add(1)
+		}
+		return
+	}
+	s.searches.Add(1)
+
+	for _, r := range resp.Results {
+		i := m.index(r.DocID)
+		if i < 0 {
+			continue
+		}
+		d := &m.docs[i]
+		d.mu.Lock()
+		stable := before[i]%2 == 0 && d.loadVersion() == before[i] && !d.uncertain
+		live, text := d.live, d.text
+		d.mu.Unlock()
+		if !stable {
+			continue
+		}
+		if !live {
+			s.violation("search %q returned deleted doc %s", query, r.DocID)
+		} else if r.Text != text {
+			s.violation("search %q returned stale text for %s: got %q, want %q", query, r.DocID, r.Text, text)
+		}
+	}
+}
+
+// checkDoc compares a GET result with the model. Caller holds d.mu.
+func checkDoc(m *model, s *stats, i int, d *docState, doc document, found bool) {
+	if d.uncertain {
+		return
+	}
+	id := m.id(i)
+	switch {
+	case found && !d.live:
+		s.violation("GET %s returned a deleted document", id)
+	case !found && d.live:
+		s.violation("GET %s: acknowledged document is missing", id)
+	case found && doc.Text != d.text:
+		s.violation("GET %s returned stale text: got %q, want %q", id, doc.Text, d.text)
+	}
+}
+
+// resolve settles an uncertain doc from what the server reports. Only safe
+// when no requests are in flight. Caller holds d.mu.
+func resolve(d *docState, doc document, found bool) {
+	d.live, d.uncertain = found, false
+	d.text = ""
+	if found {
+		d.text = doc.Text
+	}
+}
+
+// verifyAll GETs every document, checking certain ones and resolving
+// uncertain ones. Callers must ensure no workers are running.
+func verifyAll(ctx context.Context, c *client, m *model, s *stats) {
+	for i := range m.docs {
+		d := &m.docs[i]
+		d.mu.Lock()
+		doc, found, err := c.get(ctx, m.id(i))
+		if err != nil {
+			d.mu.Unlock()
+			if ctx.Err() == nil {
+				s.errors.Add(1)
+			}
+			continue
+		}
+		if d.uncertain {
+			resolve(d, doc, found)
+		} else {
+			checkDoc(m, s, i, d, doc, found)
+		}
+		d.mu.Unlock()
+	}
+}
+
+// checkCount compares the server's document count with the model. Uncertain
+// docs are resolved first. Callers must ensure no workers are running.
+func checkCount(ctx context.Context, c *client, m *model, s *stats) {
+	if _, uncertain := m.liveCount(); uncertain > 0 {
+		verifyAll(ctx, c, m, s)
+	}
+	live, uncertain := m.liveCount()
+	if uncertain > 0 {
+		return // Server unreachable; try again next round
+	}
+
+	got, err := c.count(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			s.errors.Add(1)
+		}
+		return
+	}
+	s.checks.Add(1)
+	if want := m.baseline + live; got != want {
+		s.violation("doc_count is %d, model expects %d", got, want)
+	}
+}
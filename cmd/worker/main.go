@@ -1,9 +1,127 @@
-// Package main implements the background worker for async job processing.
+// Package main implements the background worker, which runs refresh
+// policies apart from the API. Refresh policies need the WAL backend, and
+// the API locks the WAL directory, so no configuration of this binary
+// refreshes the API's documents: it refuses to start on the WAL backend
+// (the default). Run refreshes in the API with ALL_IN_ONE=true instead.
 package main
 
-import "github.com/rs/zerolog/log"
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/config"
+	"github.com/dsjohal14/selfstack/internal/libs/events"
+	"github.com/dsjohal14/selfstack/internal/libs/jobs"
+	"github.com/dsjohal14/selfstack/internal/libs/membudget"
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+	"github.com/dsjohal14/selfstack/internal/libs/supervise"
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+	"github.com/dsjohal14/selfstack/internal/scope/worker"
+)
 
 func main() {
-	log.Info().Msg("worker started")
-	select {}
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
+
+	closeLogs, err := obs.SetupLogging(obs.LogConfig{
+		Level:          cfg.LogLevel,
+		Modules:        cfg.Log.Modules,
+		Stderr:         cfg.Log.Stderr,
+		File:           cfg.Log.File,
+		FileMaxSize:    int64(cfg.Log.FileMaxSizeMB) << 20,
+		FileMaxAge:     cfg.Log.FileMaxAge,
+		FileMaxBackups: cfg.Log.FileMaxBackups,
+		Syslog:         cfg.Log.Syslog,
+		SyslogTag:      cfg.Log.SyslogTag,
+	})
+	if err != nil {
+		log.Fatalf("failed to set up logging: %v", err)
+	}
+	defer func() { _ = closeLogs.Close() }()
+
+	logger := obs.Logger("worker")
+	if err := worker.CheckStandalone(db.Backend(cfg.Storage.Backend)); err != nil {
+		logger.Fatal().Err(err).Msg("refusing to start")
+	}
+	if cfg.AllInOne {
+		logger.Warn().Msg("ALL_IN_ONE is true, so the API runs the worker too; set ALL_IN_ONE=false for the API to avoid running refreshes twice")
+	}
+	supervisor := supervise.New(obs.Logger("supervisor"))
+
+	// Storage and refresh runs announce what they did on the event bus;
+	// the events webhook hears about compaction and refresh runs
+	bus := events.New(obs.Logger("events"))
+	defer bus.Close()
+	if url := cfg.Hooks.EventsWebhook; url != "" {
+		webhook := events.NewWebhook(url, cfg.Hooks.WebhookTimeout, obs.Logger("events"))
+		webhook.Subscribe(bus, events.TopicCompactionRun, events.TopicRefreshRun)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	openCfg := db.OpenConfig{
+		Backend:     db.Backend(cfg.Storage.Backend),
+		DataDir:     cfg.Storage.DataDir,
+		DatabaseURL: cfg.Storage.ManifestURL,
+		WAL: db.WALOpenOptions{
+			Compaction:         cfg.Storage.WALCompaction,
+			MinGarbageRatio:    cfg.Storage.WALGarbageRatio,
+			SyncImmediate:      cfg.Storage.WALSyncImmediate,
+			SyncMethod:         cfg.Storage.WALSyncMethod,
+			ArchiveDir:         cfg.Storage.WALArchiveDir,
+			KeywordIndex:       cfg.Storage.WALKeywordIndex,
+			NodeID:             cfg.Storage.WALNodeID,
+			Supervisor:         supervisor,
+			Events:             bus,
+			SyncDir:            cfg.Storage.WALSyncDir,
+			Lock:               cfg.Storage.WALLock,
+			AllowUnsafeFS:      cfg.Storage.WALAllowUnsafeFS,
+			Compression:        cfg.Storage.WALCompression,
+			CheckpointInterval: cfg.Storage.WALCheckpointInterval,
+			MaxSegmentAge:      cfg.Storage.WALMaxSegmentAge,
+			IndexBudget:        membudget.New(membudget.ModuleIndex, int64(cfg.Memory.IndexMB)<<20, nil),
+		},
+		Logger: obs.Logger("storage"),
+	}
+	store, _, err := db.Open(ctx, openCfg)
+	if err != nil {
+		cancel()
+		logger.Fatal().Err(err).Msg("failed to initialize store")
+	}
+	defer func() { _ = store.Close() }()
+
+	collections, err := db.OpenCollectionRegistry(ctx, openCfg)
+	cancel()
+	if err != nil {
+		logger.Fatal().Err(err).Msg("failed to initialize collections")
+	}
+	defer func() { _ = collections.Close() }()
+
+	bg, err := worker.New(store, collections, worker.Config{
+		RefreshPolicies: cfg.RefreshPolicies,
+		RefreshInterval: cfg.RefreshInterval,
+		OutboundAllow:   cfg.Outbound.Allow,
+		OutboundDeny:    cfg.Outbound.Deny,
+		Events:          bus,
+	}, obs.Logger("refresh"))
+	if err != nil {
+		logger.Fatal().Err(err).Msg("failed to initialize refresh policies")
+	}
+
+	scheduler := jobs.NewScheduler(obs.Logger("jobs"), jobs.WithSupervisor(supervisor))
+	bg.Schedule(scheduler)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	scheduler.Start(ctx)
+	logger.Info().Msg("worker started")
+
+	<-ctx.Done()
+	logger.Info().Msg("worker stopping")
+	scheduler.Stop()
 }
@@ -0,0 +1,58 @@
+package httpapi
+
+import (
+	"fmt"
+	"strings"
+	"unsafe"
+
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+)
+
+// Answer cache lookups, the result label on the answer cache metric
+const (
+	answerHit    = "hit"    // Answered from the cache or an identical run in flight
+	answerMiss   = "miss"   // Composed and cached
+	answerBypass = "bypass" // The request set no_cache
+)
+
+// runAnswer is what a run composes, kept by the answer cache
+type runAnswer struct {
+	answer    string
+	citations []Citation
+	markers   []CitationMarker
+	queries   []string // Searched, for debug responses
+}
+
+// answerKey identifies a run's answer by its question and everything that
+// shapes the answer. Unlike coalesceKey the question is normalized, so a
+// dashboard and a user asking the same thing in different case share an
+// answer, though their embeddings could differ slightly.
+func answerKey(collection, mode string, limit int, minScore float32, style, query string) string {
+	return fmt.Sprintf("%s\x00%s\x00%d\x00%g\x00%s\x00%s", collection, mode, limit, minScore, style, normalizeQuestion(query))
+}
+
+// normalizeQuestion folds case and whitespace, as the query log does
+func normalizeQuestion(q string) string {
+	return strings.ToLower(strings.Join(strings.Fields(q), " "))
+}
+
+// runAnswerBytes estimates the memory of a cached answer
+func runAnswerBytes(a runAnswer) int64 {
+	n := int64(len(a.answer)) + int64(len(a.markers))*int64(unsafe.Sizeof(CitationMarker{}))
+	n += int64(len(a.citations)) * int64(unsafe.Sizeof(Citation{}))
+	for _, c := range a.citations {
+		n += int64(len(c.DocID) + len(c.Title) + len(c.Text) + len(c.Source) + len(c.Relevance) + len(c.ChunkOf))
+	}
+	for _, m := range a.markers {
+		n += int64(len(m.Marker) + len(m.DocID))
+	}
+	for _, q := range a.queries {
+		n += int64(len(q)) + 16
+	}
+	return n
+}
+
+// newAnswerCacheCounter registers the answer cache metric in reg
+func newAnswerCacheCounter(reg *obs.Registry) *obs.CounterVec {
+	return reg.CounterVec("selfstack_answer_cache_total", "Run answers by answer cache outcome", "result")
+}
@@ -0,0 +1,73 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+	"github.com/dsjohal14/selfstack/internal/relay"
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestAnswerCache(t *testing.T) {
+	store, _ := setupWALTestHandler(t)
+	reg := obs.NewRegistry()
+	handler := NewHandler(store, obs.Logger("test"),
+		WithMetrics(reg),
+		WithResultCache("answer", time.Minute, 0),
+	)
+	r := chi.NewRouter()
+	r.Post("/ingest", handler.HandleIngest)
+	r.Post("/run", handler.HandleRun)
+
+	run := func(req RunRequest) RunResponse {
+		t.Helper()
+		req.MinScore = -1
+		w := doJSON(r, http.MethodPost, "/run", req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("run failed: %d %s", w.Code, w.Body.String())
+		}
+		var resp RunResponse
+		_ = json.NewDecoder(w.Body).Decode(&resp)
+		return resp
+	}
+	lookups := func(result string) uint64 {
+		return reg.CounterVec("selfstack_answer_cache_total", "", "result").WithLabel(result).Value()
+	}
+
+	doc := IngestRequest{ID: "550e8400-e29b-41d4-a716-446655440010", Source: "test", Title: "Runbook", Text: "restart the ingest worker"}
+	if w := doJSON(r, http.MethodPost, "/ingest", doc); w.Code != http.StatusOK {
+		t.Fatalf("ingest failed: %d %s", w.Code, w.Body.String())
+	}
+
+	first := run(RunRequest{Query: "How do I restart the worker?"})
+	if first.Cached || len(first.Citations) != 1 {
+		t.Fatalf("expected a fresh answer with 1 citation, got cached=%v %d", first.Cached, len(first.Citations))
+	}
+	// Case and whitespace don't matter; the question is echoed as asked
+	again := run(RunRequest{Query: "how do i  restart the WORKER?"})
+	if !again.Cached || again.Answer != first.Answer || again.Query != "how do i  restart the WORKER?" {
+		t.Errorf("expected the cached answer, got cached=%v %q", again.Cached, again.Query)
+	}
+	// A different shape of answer isn't shared
+	if resp := run(RunRequest{Query: "How do I restart the worker?", CitationStyle: CitationStyleInline}); resp.Cached {
+		t.Errorf("expected another citation style to miss")
+	}
+	if resp := run(RunRequest{Query: "How do I restart the worker?", NoCache: true}); resp.Cached {
+		t.Errorf("expected no_cache to bypass the cache")
+	}
+	if lookups(answerHit) != 1 || lookups(answerMiss) != 2 || lookups(answerBypass) != 1 {
+		t.Errorf("unexpected lookups: %d hits, %d misses, %d bypasses", lookups(answerHit), lookups(answerMiss), lookups(answerBypass))
+	}
+
+	// A write advances the watermark, so the answer is composed again
+	if err := store.Add(db.Document{ID: "550e8400-e29b-41d4-a716-446655440011", Title: "Runbook 2", Text: "restart the worker after deploys", Embedding: relay.DeterministicEmbed("restart the worker after deploys")}); err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+	if resp := run(RunRequest{Query: "How do I restart the worker?"}); resp.Cached || len(resp.Citations) != 2 {
+		t.Errorf("expected a fresh answer with 2 citations, got cached=%v %d", resp.Cached, len(resp.Citations))
+	}
+}
@@ -0,0 +1,278 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+	"github.com/go-chi/chi/v5"
+)
+
+// authExempt are the paths served without an API key, for probes and
+// metrics scrapers
+var authExempt = map[string]bool{"/health": true, "/readyz": true, "/version": true, "/metrics": true}
+
+// apiKeyContext is the context key of the managed key a request was sent with
+type apiKeyContext struct{}
+
+// WithAPIKeys checks requests against the managed keys in keys, which
+// requests sent with one of admins (see keySet) manage at /admin/keys. With required, requests need a live
+// managed key or one of admins; otherwise requests without a managed key
+// are let through as before.
+func WithAPIKeys(keys *db.APIKeyStore, admins []string, required bool) HandlerOption {
+	return func(h *Handler) {
+		h.keys = keys
+		h.keysRequired = required
+		h.keyAdmins = newKeySet(admins)
+	}
+}
+
+// isAdminPath reports whether path is an administrative endpoint, which
+// namespace-scoped keys may not use
+func isAdminPath(path string) bool {
+	return strings.HasPrefix(path, "/admin/") || strings.HasPrefix(path, "/analytics/")
+}
+
+// authError writes an authentication error in the shape the endpoint's
+// clients parse
+func authError(w http.ResponseWriter, r *http.Request, status int, message, code string) {
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="selfstack"`)
+	}
+	if strings.HasPrefix(r.URL.Path, "/v1/") {
+		openAIError(w, status, message, code)
+		return
+	}
+	writeError(w, status, message, code)
+}
+
+// Authenticate identifies the request by its client certificate (see
+// WithClientCerts) and checks its API key against the managed keys.
+// Expired keys are refused, and namespace-scoped keys may not use the
+// admin endpoints. Requests another shard forwards with the shard secret
+// need no key. Without WithAPIKeys every request is let through.
+func (h *Handler) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if authExempt[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// Another shard forwarding for a client the node it called
+		// already authenticated
+		if h.isHop(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		r, ok := h.identifyCert(w, r)
+		if !ok {
+			return
+		}
+		if h.keys == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if secret := requestKey(r); secret != "" {
+			key, err := h.keys.Authenticate(r.Context(), secret, time.Now())
+			switch {
+			case err == nil:
+				if len(key.Namespaces) > 0 && isAdminPath(r.URL.Path) {
+					authError(w, r, http.StatusForbidden, "namespace-scoped API keys may not use admin endpoints", "NAMESPACE_FORBIDDEN")
+					return
+				}
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyContext{}, key)))
+				return
+			case errors.Is(err, db.ErrKeyExpired):
+				msg := "API key " + key.ID + " has expired"
+				if key.RotatedTo != "" {
+					msg += "; it was replaced by " + key.RotatedTo
+				}
+				authError(w, r, http.StatusUnauthorized, msg, "KEY_EXPIRED")
+				return
+			}
+		}
+		// Left are keys the store doesn't know, admitted only when listed
+		// by hash: AnyKey vouches for managed keys and certificates alone
+		if h.keysRequired && certPrincipal(r) == "" && !h.keyAdmins.allows(r) {
+			authError(w, r, http.StatusUnauthorized, "a valid API key or client certificate is required", "UNAUTHORIZED")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// mayUseCollection reports whether the request's API key may use the
+// named collection. Requests without a managed key may use any.
+func mayUseCollection(r *http.Request, name string) bool {
+	key, ok := r.Context().Value(apiKeyContext{}).(db.APIKey)
+	return !ok || key.Allows(name)
+}
+
+// scopedKey reports whether the request was sent with a namespace-scoped key
+func scopedKey(r *http.Request) bool {
+	key, ok := r.Context().Value(apiKeyContext{}).(db.APIKey)
+	return ok && len(key.Namespaces) > 0
+}
+
+// allowedCollections drops the collections the request's API key may not use
+func allowedCollections(r *http.Request, configs []db.CollectionConfig) []db.CollectionConfig {
+	if !scopedKey(r) {
+		return configs
+	}
+	allowed := configs[:0:0]
+	for _, c := range configs {
+		if mayUseCollection(r, c.Name) {
+			allowed = append(allowed, c)
+		}
+	}
+	return allowed
+}
+
+// mayManageKeys reports whether r may manage API keys, writing a 403 if not
+func (h *Handler) mayManageKeys(w http.ResponseWriter, r *http.Request) bool {
+	if h.keys == nil {
+		writeError(w, http.StatusNotImplemented, "API keys are not enabled", "NOT_SUPPORTED")
+		return false
+	}
+	if h.keyAdmins.allows(r) {
+		return true
+	}
+	writeError(w, http.StatusForbidden, "this API key may not manage API keys; list it in KEY_ADMIN_KEYS", "KEY_ADMIN_FORBIDDEN")
+	return false
+}
+
+// writeKeyError reports a failed key operation
+func (h *Handler) writeKeyError(w http.ResponseWriter, id string, err error) {
+	switch {
+	case errors.Is(err, db.ErrKeyNotFound):
+		writeError(w, http.StatusNotFound, "API key not found: "+id, "KEY_NOT_FOUND")
+	case errors.Is(err, db.ErrInvalidKey):
+		writeError(w, http.StatusBadRequest, err.Error(), "INVALID_KEY")
+	case errors.Is(err, db.ErrKeyRotated), errors.Is(err, db.ErrKeyExpired):
+		writeError(w, http.StatusConflict, err.Error(), "KEY_NOT_ROTATABLE")
+	default:
+		h.logger.Error().Err(err).Str("key_id", id).Msg("API key operation failed")
+		writeError(w, http.StatusInternalServerError, "failed to store API key", "STORE_ERROR")
+	}
+}
+
+// HandleCreateKey creates an API key and returns it with its secret, which
+// is never shown again
+func (h *Handler) HandleCreateKey(w http.ResponseWriter, r *http.Request) {
+	if !h.mayManageKeys(w, r) {
+		return
+	}
+	var req CreateKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON", "INVALID_JSON")
+		return
+	}
+	spec := db.KeySpec{Name: req.Name, Namespaces: req.Namespaces, ExpiresAt: req.ExpiresAt}
+	switch {
+	case req.ExpiresInDays < 0:
+		writeError(w, http.StatusBadRequest, "expires_in_days must be positive", "INVALID_PARAM")
+		return
+	case req.ExpiresInDays > 0 && req.ExpiresAt != nil:
+		writeError(w, http.StatusBadRequest, "set expires_at or expires_in_days, not both", "INVALID_PARAM")
+		return
+	case req.ExpiresInDays > 0:
+		expires := time.Now().UTC().AddDate(0, 0, req.ExpiresInDays)
+		spec.ExpiresAt = &expires
+	}
+
+	key, secret, err := h.keys.Create(r.Context(), spec)
+	if err != nil {
+		h.writeKeyError(w, "", err)
+		return
+	}
+	h.logger.Info().Str("key_id", key.ID).Strs("namespaces", key.Namespaces).Str("by", usageKey(r)).Msg("API key created")
+	writeJSON(w, http.StatusCreated, KeySecretResponse{APIKey: key, Secret: secret})
+}
+
+// HandleListKeys lists the API keys, oldest first
+func (h *Handler) HandleListKeys(w http.ResponseWriter, r *http.Request) {
+	if !h.mayManageKeys(w, r) {
+		return
+	}
+	keys := h.keys.List()
+	writeJSON(w, http.StatusOK, KeyListResponse{Keys: keys, Count: len(keys)})
+}
+
+// HandleGetKey returns an API key
+func (h *Handler) HandleGetKey(w http.ResponseWriter, r *http.Request) {
+	if !h.mayManageKeys(w, r) {
+		return
+	}
+	id := chi.URLParam(r, "id")
+	key, found := h.keys.Get(id)
+	if !found {
+		h.writeKeyError(w, id, db.ErrKeyNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, key)
+}
+
+// HandleUpdateKey renames an API key or changes its namespaces or expiry
+func (h *Handler) HandleUpdateKey(w http.ResponseWriter, r *http.Request) {
+	if !h.mayManageKeys(w, r) {
+		return
+	}
+	var req UpdateKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON", "INVALID_JSON")
+		return
+	}
+	id := chi.URLParam(r, "id")
+	key, err := h.keys.Update(r.Context(), id, db.KeyUpdate{Name: req.Name, Namespaces: req.Namespaces, ExpiresAt: req.ExpiresAt})
+	if err != nil {
+		h.writeKeyError(w, id, err)
+		return
+	}
+	h.logger.Info().Str("key_id", key.ID).Strs("namespaces", key.Namespaces).Str("by", usageKey(r)).Msg("API key updated")
+	writeJSON(w, http.StatusOK, key)
+}
+
+// HandleRotateKey replaces an API key with a new one and returns the new
+// key with its secret. The old key keeps working for the overlap.
+// Query params: overlap (duration, default 24h)
+func (h *Handler) HandleRotateKey(w http.ResponseWriter, r *http.Request) {
+	if !h.mayManageKeys(w, r) {
+		return
+	}
+	overlap := db.DefaultRotationOverlap
+	if v := r.URL.Query().Get("overlap"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			writeError(w, http.StatusBadRequest, "overlap must be a duration like 1h", "INVALID_PARAM")
+			return
+		}
+		overlap = d
+	}
+
+	id := chi.URLParam(r, "id")
+	key, secret, err := h.keys.Rotate(r.Context(), id, overlap)
+	if err != nil {
+		h.writeKeyError(w, id, err)
+		return
+	}
+	h.logger.Info().Str("key_id", id).Str("new_key_id", key.ID).Dur("overlap", overlap).Str("by", usageKey(r)).Msg("API key rotated")
+	writeJSON(w, http.StatusOK, KeySecretResponse{APIKey: key, Secret: secret})
+}
+
+// HandleDeleteKey revokes an API key at once
+func (h *Handler) HandleDeleteKey(w http.ResponseWriter, r *http.Request) {
+	if !h.mayManageKeys(w, r) {
+		return
+	}
+	id := chi.URLParam(r, "id")
+	if err := h.keys.Delete(r.Context(), id); err != nil {
+		h.writeKeyError(w, id, err)
+		return
+	}
+	h.logger.Info().Str("key_id", id).Str("by", usageKey(r)).Msg("API key deleted")
+	writeJSON(w, http.StatusOK, DeleteResponse{ID: id, Success: true})
+}
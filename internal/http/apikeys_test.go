@@ -0,0 +1,186 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestAPIKeys(t *testing.T) {
+	store, err := db.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	keys, _ := db.NewAPIKeyStore("")
+
+	const admin = "admin-secret"
+	sum := sha256.Sum256([]byte(admin))
+	h := NewHandler(store, obs.Logger("test"), WithAPIKeys(keys, []string{KeyHashPrefix + hex.EncodeToString(sum[:])}, true))
+	router := chi.NewRouter()
+	router.Use(h.Authenticate)
+	h.Routes(router)
+
+	call := func(method, path, secret string, body any) *httptest.ResponseRecorder {
+		t.Helper()
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewReader(data))
+		if secret != "" {
+			req.Header.Set("Authorization", "Bearer "+secret)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	create := func(req CreateKeyRequest) KeySecretResponse {
+		t.Helper()
+		w := call(http.MethodPost, "/admin/keys", admin, req)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("create failed: %d %s", w.Code, w.Body.String())
+		}
+		var resp KeySecretResponse
+		_ = json.NewDecoder(w.Body).Decode(&resp)
+		return resp
+	}
+	search := func(secret, collection string) int {
+		return call(http.MethodPost, "/search", secret, SearchRequest{Query: "keys", Collection: collection}).Code
+	}
+
+	if w := call(http.MethodGet, "/health", "", nil); w.Code != http.StatusOK {
+		t.Errorf("expected /health without a key, got %d", w.Code)
+	}
+	if w := call(http.MethodPost, "/search", "", SearchRequest{Query: "keys"}); w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("expected 401 without a key, got %d", w.Code)
+	}
+	if code := search("made-up", ""); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 with an unknown key, got %d", code)
+	}
+	if w := call(http.MethodPost, "/ingest", admin, IngestRequest{ID: "doc-1", Source: "test", Title: "Keys", Text: "managed keys"}); w.Code != http.StatusOK {
+		t.Fatalf("ingest failed: %d %s", w.Code, w.Body.String())
+	}
+
+	scoped := create(CreateKeyRequest{Name: "default only", Namespaces: []string{db.DefaultCollection}, ExpiresInDays: 30})
+	if scoped.Secret == "" || scoped.ExpiresAt == nil {
+		t.Fatalf("expected a secret and an expiry, got %+v", scoped)
+	}
+	if code := search(scoped.Secret, ""); code != http.StatusOK {
+		t.Errorf("expected the scoped key to search its collection, got %d", code)
+	}
+	if code := search(scoped.Secret, "other"); code != http.StatusForbidden {
+		t.Errorf("expected 403 for another collection, got %d", code)
+	}
+	if w := call(http.MethodGet, "/admin/keys", scoped.Secret, nil); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 on admin endpoints for a scoped key, got %d", w.Code)
+	}
+	other := create(CreateKeyRequest{Namespaces: []string{"other"}})
+	if w := call(http.MethodGet, "/documents/doc-1", other.Secret, nil); w.Code != http.StatusNotFound {
+		t.Errorf("expected documents of other collections to be hidden, got %d", w.Code)
+	}
+
+	// Rotating with no overlap ends the old key at once
+	w := call(http.MethodPost, "/admin/keys/"+scoped.ID+"/rotate?overlap=0s", admin, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("rotate failed: %d %s", w.Code, w.Body.String())
+	}
+	var rotated KeySecretResponse
+	_ = json.NewDecoder(w.Body).Decode(&rotated)
+	if w := call(http.MethodPost, "/search", scoped.Secret, SearchRequest{Query: "keys"}); w.Code != http.StatusUnauthorized || !bytes.Contains(w.Body.Bytes(), []byte("KEY_EXPIRED")) {
+		t.Errorf("expected the rotated key to have expired, got %d %s", w.Code, w.Body.String())
+	}
+	if code := search(rotated.Secret, ""); code != http.StatusOK {
+		t.Errorf("expected the new key to work, got %d", code)
+	}
+	if w := call(http.MethodPost, "/admin/keys/"+scoped.ID+"/rotate", admin, nil); w.Code != http.StatusConflict {
+		t.Errorf("expected a second rotation to conflict, got %d", w.Code)
+	}
+
+	w = call(http.MethodGet, "/admin/keys/"+rotated.ID, admin, nil)
+	var got db.APIKey
+	_ = json.NewDecoder(w.Body).Decode(&got)
+	if got.LastUsedAt == nil || got.Name != "default only" {
+		t.Errorf("expected the new key's name and last use, got %+v", got)
+	}
+	if w := call(http.MethodPatch, "/admin/keys/"+rotated.ID, admin, UpdateKeyRequest{Namespaces: []string{}}); w.Code != http.StatusOK {
+		t.Fatalf("update failed: %d %s", w.Code, w.Body.String())
+	}
+	if code := search(rotated.Secret, "other"); code == http.StatusForbidden {
+		t.Error("expected an unscoped key to use any collection")
+	}
+
+	if w := call(http.MethodDelete, "/admin/keys/"+rotated.ID, admin, nil); w.Code != http.StatusOK {
+		t.Fatalf("delete failed: %d %s", w.Code, w.Body.String())
+	}
+	if code := search(rotated.Secret, ""); code != http.StatusUnauthorized {
+		t.Errorf("expected a deleted key to be refused, got %d", code)
+	}
+	w = call(http.MethodGet, "/admin/keys", admin, nil)
+	var list KeyListResponse
+	_ = json.NewDecoder(w.Body).Decode(&list)
+	if list.Count != 2 {
+		t.Errorf("expected the rotated and other keys, got %+v", list)
+	}
+}
+
+func TestAPIKeysRequiredAnyAdmin(t *testing.T) {
+	store, err := db.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	keys, _ := db.NewAPIKeyStore("")
+
+	h := NewHandler(store, obs.Logger("test"), WithAPIKeys(keys, []string{AnyKey}, true))
+	router := chi.NewRouter()
+	router.Use(h.Authenticate)
+	h.Routes(router)
+
+	// * admits managed keys, not any secret a request makes up
+	search := func(secret string) int {
+		data, _ := json.Marshal(SearchRequest{Query: "keys"})
+		req := httptest.NewRequest(http.MethodPost, "/search", bytes.NewReader(data))
+		if secret != "" {
+			req.Header.Set("X-API-Key", secret)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := search(""); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a key, got %d", code)
+	}
+	if code := search("any-secret"); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a made-up key, got %d", code)
+	}
+
+	// Only a managed key may mint another
+	mint := func(secret string) int {
+		data, _ := json.Marshal(CreateKeyRequest{Name: "minted"})
+		req := httptest.NewRequest(http.MethodPost, "/admin/keys", bytes.NewReader(data))
+		req.Header.Set("X-API-Key", secret)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := mint("any-secret"); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 minting with a made-up key, got %d", code)
+	}
+	_, secret, err := keys.Create(context.Background(), db.KeySpec{Name: "managed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := search(secret); code != http.StatusOK {
+		t.Errorf("expected a managed key admitted, got %d", code)
+	}
+	if code := mint(secret); code != http.StatusCreated {
+		t.Errorf("expected a managed key to mint under *, got %d", code)
+	}
+}
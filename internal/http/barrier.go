@@ -0,0 +1,43 @@
+package httpapi
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+)
+
+// ReadBarrierHeader asks for a request to see every write acknowledged
+// before it, when the store indexes writes in the background
+// (WAL_ASYNC_APPLY). Reads otherwise may lag recent writes.
+const ReadBarrierHeader = "X-Selfstack-Read-Barrier"
+
+// barrierer is a store that can wait for its acknowledged writes to be
+// visible to reads, like the WAL store with asynchronous apply
+type barrierer interface {
+	Barrier(ctx context.Context) error
+}
+
+// ReadBarrier is middleware that waits for the writes acknowledged so far
+// to be indexed before serving requests that set ReadBarrierHeader
+func (h *Handler) ReadBarrier(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if on, _ := strconv.ParseBool(r.Header.Get(ReadBarrierHeader)); on && !h.awaitWrites(w, r) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// awaitWrites waits for the writes acknowledged so far to be indexed. It
+// answers the request and returns false if the client gave up first.
+func (h *Handler) awaitWrites(w http.ResponseWriter, r *http.Request) bool {
+	b, ok := h.store.(barrierer)
+	if !ok {
+		return true
+	}
+	if err := b.Barrier(r.Context()); err != nil {
+		writeError(w, http.StatusServiceUnavailable, "request ended before recent writes were indexed", "READ_BARRIER")
+		return false
+	}
+	return true
+}
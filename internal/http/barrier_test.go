@@ -0,0 +1,136 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/events"
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+)
+
+// countingBarrierStore counts barriers and fails them with err
+type countingBarrierStore struct {
+	*db.WALStore
+	calls *int
+	err   error
+}
+
+func (s countingBarrierStore) Barrier(context.Context) error {
+	*s.calls++
+	return s.err
+}
+
+func TestReadBarrier(t *testing.T) {
+	store, _ := setupWALTestHandler(t)
+	var calls int
+	h := NewHandler(countingBarrierStore{WALStore: store, calls: &calls}, obs.Logger("test"))
+
+	r := chi.NewRouter()
+	r.Use(h.ReadBarrier)
+	r.Post("/search", func(w http.ResponseWriter, _ *http.Request) {})
+
+	serve := func(barrier string) int {
+		req := httptest.NewRequest(http.MethodPost, "/search", nil)
+		if barrier != "" {
+			req.Header.Set(ReadBarrierHeader, barrier)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Only requests that ask wait for the index
+	if code := serve(""); code != http.StatusOK || calls != 0 {
+		t.Errorf("expected no barrier without the header, got %d after %d calls", code, calls)
+	}
+	if code := serve("true"); code != http.StatusOK || calls != 1 {
+		t.Errorf("expected one barrier, got %d after %d calls", code, calls)
+	}
+
+	h.store = countingBarrierStore{WALStore: store, calls: &calls, err: context.Canceled}
+	if code := serve("1"); code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 when the barrier gives up, got %d", code)
+	}
+}
+
+func TestIngestAsyncApply(t *testing.T) {
+	store, r := setupWALTestHandler(t, func(c *db.WALStoreConfig) { c.AsyncApply = true })
+
+	// A re-ingest right after the first replaces it even if the first
+	// isn't indexed yet
+	for _, text := range []string{"first version", "second version"} {
+		body, _ := json.Marshal(IngestRequest{ID: "doc-1", Source: "test", Title: "Doc", Text: text, CreatedAt: time.Now()})
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/ingest", bytes.NewReader(body)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("ingest failed with %d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	if err := store.Barrier(context.Background()); err != nil {
+		t.Fatalf("barrier failed: %v", err)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/documents/doc-1", nil))
+	if w.Code != http.StatusOK || !bytes.Contains(w.Body.Bytes(), []byte("second version")) {
+		t.Errorf("expected the second version, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestWritesSkipBarrier(t *testing.T) {
+	// Holding up the subscriber holds up the index behind the WAL
+	release := make(chan struct{})
+	bus := events.New(zerolog.Nop())
+	t.Cleanup(bus.Close)
+	bus.Subscribe(events.TopicWALApplied, "test", func(events.Event) { <-release }, events.Sync())
+	store, _ := setupWALTestHandler(t, func(c *db.WALStoreConfig) {
+		c.AsyncApply = true
+		c.Events = bus
+	})
+	released := false
+	unblock := func() {
+		if !released {
+			released = true
+			close(release)
+		}
+	}
+	t.Cleanup(unblock) // Before the store closes, which drains the applier
+	var calls int
+	h := NewHandler(countingBarrierStore{WALStore: store, calls: &calls}, obs.Logger("test"))
+	h.caps = db.CapabilitiesOf(store)
+	r := chi.NewRouter()
+	h.Routes(r)
+
+	// Writes find the documents queued before them without waiting for
+	// the index
+	for _, text := range []string{"first version", "second version"} {
+		if w := doJSON(r, http.MethodPost, "/ingest", IngestRequest{ID: "doc-1", Source: "test", Title: "Doc", Text: text}); w.Code != http.StatusOK {
+			t.Fatalf("ingest failed with %d: %s", w.Code, w.Body.String())
+		}
+	}
+	if w := doJSON(r, http.MethodPost, "/documents/doc-1/move", MoveRequest{ID: "doc-2"}); w.Code != http.StatusOK {
+		t.Fatalf("expected the queued doc-1 moved, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := doJSON(r, http.MethodDelete, "/documents/doc-2", nil); w.Code != http.StatusOK {
+		t.Fatalf("expected the queued doc-2 deleted, got %d: %s", w.Code, w.Body.String())
+	}
+	if calls != 0 {
+		t.Errorf("expected no barriers on the write path, got %d", calls)
+	}
+
+	unblock()
+	if err := store.Barrier(context.Background()); err != nil {
+		t.Fatalf("barrier failed: %v", err)
+	}
+	if store.Count() != 0 {
+		t.Errorf("expected every version gone, got %d documents", store.Count())
+	}
+}
@@ -0,0 +1,268 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+)
+
+// Ingest priorities
+const (
+	IngestInteractive = "interactive" // Written before the response, at low latency
+	IngestBulk        = "bulk"        // Queued and written in batches when idle
+)
+
+// bulkPoll is how often queued bulk ingests are checked for an idle moment
+const bulkPoll = 100 * time.Millisecond
+
+// BulkConfig sets how bulk ingests, like backfills, are queued and written.
+// They are acknowledged once queued and written in batches with a single
+// fsync while no interactive ingests are running, so a backfill doesn't
+// slow the live product down.
+type BulkConfig struct {
+	Keys      []string      // Usage keys (key_... at /admin/usage) whose ingests are bulk by default
+	QueueSize int           // Queued ingests; more are rejected with 503
+	BatchSize int           // Ingests written per batch
+	MaxWait   time.Duration // Longest an ingest waits for an idle moment
+}
+
+// bulkIngest is a queued bulk ingest
+type bulkIngest struct {
+	r      *http.Request // The client's request, for routing and metering; its body is read
+	req    IngestRequest
+	queued time.Time
+}
+
+// bulkQueue holds bulk ingests until the server is idle
+type bulkQueue struct {
+	config BulkConfig
+	keys   map[string]bool
+
+	interactive atomic.Int64 // Interactive ingests in flight
+	written     atomic.Int64
+	failed      atomic.Int64
+
+	mu    sync.Mutex
+	items []bulkIngest
+}
+
+// WithBulkIngest queues bulk priority ingests and writes them in batches
+// when the server is idle; see StartBulkIngest. Without it bulk ingests are
+// written at once, like interactive ones.
+func WithBulkIngest(config BulkConfig) HandlerOption {
+	return func(h *Handler) {
+		if config.QueueSize <= 0 {
+			config.QueueSize = 10000
+		}
+		if config.BatchSize <= 0 {
+			config.BatchSize = 500
+		}
+		if config.MaxWait <= 0 {
+			config.MaxWait = 30 * time.Second
+		}
+		keys := make(map[string]bool, len(config.Keys))
+		for _, k := range config.Keys {
+			keys[k] = true
+		}
+		h.bulk = &bulkQueue{config: config, keys: keys}
+	}
+}
+
+// ingestPriority is the priority req asks for, or its API key's default.
+// Requests from other shards are always interactive: the shard the client
+// called queues them.
+func (h *Handler) ingestPriority(r *http.Request, req IngestRequest) (string, error) {
+	switch req.Priority {
+	case IngestInteractive, IngestBulk:
+	case "":
+		if h.bulk != nil && h.bulk.keys[usageKey(r)] {
+			req.Priority = IngestBulk
+		} else {
+			req.Priority = IngestInteractive
+		}
+	default:
+		return "", fmt.Errorf("invalid priority %q: want interactive or bulk", req.Priority)
+	}
+	if h.bulk == nil || h.isHop(r) {
+		return IngestInteractive, nil
+	}
+	return req.Priority, nil
+}
+
+// enqueueBulk queues a validated ingest and answers 202, or 503 when the
+// queue is full
+func (h *Handler) enqueueBulk(w http.ResponseWriter, r *http.Request, req IngestRequest) {
+	q := h.bulk
+	q.mu.Lock()
+	full := len(q.items) >= q.config.QueueSize
+	if !full {
+		// Queued ingests are written at the batch's consistency and
+		// forwarded to their shard at interactive priority
+		req.Consistency, req.Priority = "", ""
+		q.items = append(q.items, bulkIngest{r: r.Clone(context.Background()), req: req, queued: time.Now()})
+	}
+	q.mu.Unlock()
+
+	if full {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(q.config.MaxWait.Seconds()))))
+		writeError(w, http.StatusServiceUnavailable, "bulk ingest queue is full; retry later", "BULK_QUEUE_FULL")
+		return
+	}
+	writeJSON(w, http.StatusAccepted, IngestResponse{
+		ID:      req.ID,
+		Success: true,
+		Message: "document queued for bulk ingest",
+		Queued:  true,
+	})
+}
+
+// idle reports whether no interactive ingests are running and no writes
+// are waiting on the WAL
+func (h *Handler) idle() bool {
+	if h.bulk.interactive.Load() > 0 {
+		return false
+	}
+	if q, ok := h.store.(queueDepther); ok && q.QueueDepth() > 0 {
+		return false
+	}
+	return true
+}
+
+// take removes the next batch from the queue: when idle, or once the
+// oldest ingest has waited MaxWait
+func (q *bulkQueue) take(idle bool, now time.Time) []bulkIngest {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.items) == 0 || (!idle && now.Sub(q.items[0].queued) < q.config.MaxWait) {
+		return nil
+	}
+	n := min(len(q.items), q.config.BatchSize)
+	batch := make([]bulkIngest, n)
+	copy(batch, q.items)
+	q.items = q.items[n:]
+	return batch
+}
+
+// StartBulkIngest writes queued bulk ingests in the background until ctx is
+// canceled. The returned channel is closed once it stops. Ingests still
+// queued then are lost; their clients were only told they were queued.
+func (h *Handler) StartBulkIngest(ctx context.Context) <-chan struct{} {
+	loop := func(ctx context.Context) error {
+		ticker := time.NewTicker(bulkPoll)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+				// Keep writing batches while the server stays idle
+				for ctx.Err() == nil {
+					if h.writeBulk(ctx) == 0 {
+						break
+					}
+				}
+			}
+		}
+	}
+	if h.supervisor != nil {
+		return h.supervisor.Go(ctx, "ingest-bulk", loop)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer h.diag.Recover("ingest-bulk")
+		_ = loop(ctx)
+	}()
+	return done
+}
+
+// writeBulk writes the next batch of queued ingests, if it's time to, and
+// returns how many it took. The batch is committed with one fsync.
+func (h *Handler) writeBulk(ctx context.Context) int {
+	if h.bulk == nil {
+		return 0
+	}
+	batch := h.bulk.take(h.idle(), time.Now())
+	if len(batch) == 0 {
+		return 0
+	}
+
+	start := time.Now()
+	var written int
+	for _, item := range batch {
+		rec := &bulkRecorder{header: make(http.Header)}
+		h.ingest(rec, item.r.WithContext(ctx), item.req, db.ConsistencyAsync)
+		if rec.status == http.StatusOK {
+			written++
+			continue
+		}
+		var resp ErrorResponse
+		_ = json.Unmarshal(rec.body.Bytes(), &resp)
+		h.logger.Warn().Str("doc_id", item.req.ID).Int("status", rec.status).Str("code", resp.Code).Str("error", resp.Error).Msg("bulk ingest failed")
+	}
+
+	if commit, ok := h.store.(committer); ok && written > 0 {
+		if err := commit.Commit(ctx, db.ConsistencyFsync); err != nil {
+			h.logger.Error().Err(err).Int("documents", written).Msg("failed to commit bulk ingests")
+		}
+	}
+	h.bulk.written.Add(int64(written))
+	h.bulk.failed.Add(int64(len(batch) - written))
+
+	h.logger.Info().
+		Int("written", written).
+		Int("failed", len(batch)-written).
+		Dur("duration", time.Since(start)).
+		Msg("bulk ingest batch written")
+	return len(batch)
+}
+
+// bulkRecorder captures the response to a queued ingest
+type bulkRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bulkRecorder) Header() http.Header { return b.header }
+
+func (b *bulkRecorder) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(p)
+}
+
+func (b *bulkRecorder) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+// HandleBulkStatus reports the bulk ingest queue
+func (h *Handler) HandleBulkStatus(w http.ResponseWriter, r *http.Request) {
+	if h.bulk == nil {
+		writeError(w, http.StatusNotImplemented, "bulk ingest is disabled (set INGEST_BULK=true)", "NOT_SUPPORTED")
+		return
+	}
+	q := h.bulk
+	q.mu.Lock()
+	resp := BulkStatusResponse{Queued: len(q.items), QueueSize: q.config.QueueSize}
+	if len(q.items) > 0 {
+		resp.OldestWaitMS = time.Since(q.items[0].queued).Milliseconds()
+	}
+	q.mu.Unlock()
+	resp.Written = q.written.Load()
+	resp.Failed = q.failed.Load()
+	resp.Idle = h.idle()
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,129 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestBulkIngest(t *testing.T) {
+	store, _ := setupWALTestHandler(t)
+	usage, _ := db.NewUsageLog("", 0)
+	keyed := httptest.NewRequest(http.MethodPost, "/", nil)
+	keyed.Header.Set("X-API-Key", "sk-backfill")
+	backfill := usageKey(keyed)
+
+	h := NewHandler(store, obs.Logger("test"), WithUsage(usage),
+		WithBulkIngest(BulkConfig{Keys: []string{backfill}, BatchSize: 2, MaxWait: time.Hour}))
+	r := chi.NewRouter()
+	r.Post("/ingest", h.HandleIngest)
+	r.Get("/admin/ingest/bulk", h.HandleBulkStatus)
+
+	send := func(req IngestRequest, key string) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(req)
+		hr := httptest.NewRequest(http.MethodPost, "/ingest", bytes.NewReader(data))
+		if key != "" {
+			hr.Header.Set("X-API-Key", key)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, hr)
+		return w
+	}
+	doc := func(id string) IngestRequest {
+		return IngestRequest{ID: id, Source: "test", Title: id, Text: "backfilled notes " + id}
+	}
+
+	// Bulk by request and by key; the key can still ask for interactive
+	bulk := doc("bulk-1")
+	bulk.Priority = IngestBulk
+	w := send(bulk, "")
+	var resp IngestResponse
+	_ = json.NewDecoder(w.Body).Decode(&resp)
+	if w.Code != http.StatusAccepted || !resp.Queued {
+		t.Fatalf("bulk ingest = %d %+v", w.Code, resp)
+	}
+	if w := send(doc("bulk-2"), "sk-backfill"); w.Code != http.StatusAccepted {
+		t.Fatalf("keyed ingest = %d %s", w.Code, w.Body.String())
+	}
+	missing := doc("bulk-3")
+	missing.Collection = "missing"
+	if w := send(missing, "sk-backfill"); w.Code != http.StatusAccepted {
+		t.Fatalf("keyed ingest = %d %s", w.Code, w.Body.String())
+	}
+	live := doc("live")
+	live.Priority = IngestInteractive
+	if w := send(live, "sk-backfill"); w.Code != http.StatusOK {
+		t.Fatalf("interactive ingest = %d %s", w.Code, w.Body.String())
+	}
+	invalid := doc("invalid")
+	invalid.Priority = "urgent"
+	if w := send(invalid, ""); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid priority = %d, want 400", w.Code)
+	}
+	if _, found := store.Get("bulk-1"); found {
+		t.Fatal("bulk ingest was written before the server was idle")
+	}
+
+	// Nothing is written while an interactive ingest is running
+	h.bulk.interactive.Add(1)
+	if n := h.writeBulk(context.Background()); n != 0 {
+		t.Errorf("wrote %d while busy", n)
+	}
+	h.bulk.interactive.Add(-1)
+
+	if n := h.writeBulk(context.Background()); n != 2 {
+		t.Fatalf("first batch = %d, want 2", n)
+	}
+	if n := h.writeBulk(context.Background()); n != 1 {
+		t.Fatalf("second batch = %d, want 1", n)
+	}
+	for _, id := range []string{"bulk-1", "bulk-2", "live"} {
+		if _, found := store.Get(id); !found {
+			t.Errorf("%s was not written", id)
+		}
+	}
+	if recs := usage.Usage(db.UsageQuery{Key: backfill}); len(recs) != 1 || recs[0].IngestedDocs != 2 {
+		t.Errorf("backfill usage = %+v", recs)
+	}
+
+	w = doJSON(r, http.MethodGet, "/admin/ingest/bulk", nil)
+	var status BulkStatusResponse
+	_ = json.NewDecoder(w.Body).Decode(&status)
+	if status.Queued != 0 || status.Written != 2 || status.Failed != 1 || !status.Idle {
+		t.Errorf("status = %+v", status)
+	}
+}
+
+func TestBulkQueue(t *testing.T) {
+	store, _ := setupWALTestHandler(t)
+	h := NewHandler(store, obs.Logger("test"), WithBulkIngest(BulkConfig{QueueSize: 1, MaxWait: time.Minute}))
+	r := chi.NewRouter()
+	r.Post("/ingest", h.HandleIngest)
+
+	req := IngestRequest{ID: "a", Source: "test", Title: "A", Priority: IngestBulk}
+	if w := doJSON(r, http.MethodPost, "/ingest", req); w.Code != http.StatusAccepted {
+		t.Fatalf("first = %d", w.Code)
+	}
+	req.ID = "b"
+	w := doJSON(r, http.MethodPost, "/ingest", req)
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "60" {
+		t.Errorf("full queue = %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	// A busy server still writes ingests that have waited MaxWait
+	now := time.Now()
+	if batch := h.bulk.take(false, now); batch != nil {
+		t.Errorf("took %d before MaxWait", len(batch))
+	}
+	if batch := h.bulk.take(false, now.Add(time.Minute)); len(batch) != 1 || batch[0].req.ID != "a" {
+		t.Errorf("overdue batch = %+v", batch)
+	}
+}
@@ -0,0 +1,67 @@
+package httpapi
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/chaos"
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+)
+
+// ChaosHeader names the faults injected into a response, so client teams
+// can tell injected failures from real ones
+const ChaosHeader = "X-Selfstack-Chaos"
+
+// WithChaos injects in's faults into requests (CHAOS_RULES), for testing
+// clients against failures outside production
+func WithChaos(in *chaos.Injector) HandlerOption {
+	return func(h *Handler) {
+		h.chaos = in
+		h.chaosFaults = newChaosCounter(obs.DefaultRegistry)
+	}
+}
+
+// newChaosCounter registers the injected fault metric in reg
+func newChaosCounter(reg *obs.Registry) *obs.CounterVec {
+	return reg.CounterVec("selfstack_chaos_faults_total", "Faults injected by CHAOS_RULES", "fault")
+}
+
+// InjectChaos is middleware that injects faults into requests by the chaos
+// rules. Health, readiness, metrics, and admin requests are left alone, so
+// probes and operators see the server as it is.
+func (h *Handler) InjectChaos(next http.Handler) http.Handler {
+	if h.chaos == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requestPriority(r) == PriorityCritical {
+			next.ServeHTTP(w, r)
+			return
+		}
+		d := h.chaos.Decide(r.URL.Path)
+		if d.Delay > 0 {
+			h.chaosFaults.WithLabel(string(chaos.FaultLatency)).Inc()
+			w.Header().Add(ChaosHeader, string(chaos.FaultLatency))
+			timer := time.NewTimer(d.Delay)
+			select {
+			case <-timer.C:
+			case <-r.Context().Done():
+				timer.Stop()
+				return
+			}
+		}
+		switch {
+		case d.Drop:
+			h.chaosFaults.WithLabel(string(chaos.FaultDrop)).Inc()
+			// The server closes the connection without a response, or
+			// resets the stream over HTTP/2
+			panic(http.ErrAbortHandler)
+		case d.Status != 0:
+			h.chaosFaults.WithLabel(string(chaos.FaultError)).Inc()
+			w.Header().Add(ChaosHeader, string(chaos.FaultError))
+			writeError(w, d.Status, "injected failure", "CHAOS_INJECTED")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
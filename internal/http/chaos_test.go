@@ -0,0 +1,77 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/chaos"
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestInjectChaos(t *testing.T) {
+	store, _ := setupWALTestHandler(t)
+	rules, err := chaos.Parse("/search:error:100:502,/run:latency:100:20ms,/ingest:drop:100,*:error:100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewHandler(store, obs.Logger("test"), WithChaos(chaos.NewInjector(rules)))
+
+	r := chi.NewRouter()
+	r.Use(h.Recoverer)
+	r.Use(h.InjectChaos)
+	ok := func(w http.ResponseWriter, _ *http.Request) {}
+	r.Post("/search", ok)
+	r.Post("/run", ok)
+	r.Post("/ingest", ok)
+	r.Get("/health", ok)
+	r.Get("/admin/slo", ok)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	post := func(path string) (*http.Response, error) {
+		return http.Post(srv.URL+path, "application/json", nil)
+	}
+
+	resp, err := post("/search")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway || resp.Header.Get(ChaosHeader) != "error" {
+		t.Errorf("/search: got %d, %s %q", resp.StatusCode, ChaosHeader, resp.Header.Get(ChaosHeader))
+	}
+
+	// The catch-all's error is injected after the latency
+	start := time.Now()
+	resp, err = post("/run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("/run: answered in %s, expected at least 20ms", elapsed)
+	}
+	if got := resp.Header.Values(ChaosHeader); resp.StatusCode != http.StatusServiceUnavailable || len(got) != 2 {
+		t.Errorf("/run: got %d, %s %q", resp.StatusCode, ChaosHeader, got)
+	}
+
+	if resp, err := post("/ingest"); err == nil {
+		_ = resp.Body.Close()
+		t.Errorf("/ingest: expected the connection to be dropped, got %d", resp.StatusCode)
+	}
+
+	// Probes and admin requests are never faulted, even by *
+	for _, path := range []string{"/health", "/admin/slo"} {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || resp.Header.Get(ChaosHeader) != "" {
+			t.Errorf("%s: got %d, %s %q", path, resp.StatusCode, ChaosHeader, resp.Header.Get(ChaosHeader))
+		}
+	}
+}
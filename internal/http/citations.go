@@ -0,0 +1,169 @@
+package httpapi
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Citation styles for /run answers
+const (
+	CitationStyleList     = "list"     // Numbered summary of each citation (default)
+	CitationStyleInline   = "inline"   // Each claim followed by a [n] marker
+	CitationStyleFootnote = "footnote" // Each claim followed by [^n]; sources listed as footnotes
+)
+
+// maxClaimLen caps the text quoted from a citation in an answer
+const maxClaimLen = 100
+
+// Citations a /run answer is composed from
+const (
+	defaultRunLimit = 3
+	maxRunLimit     = 20
+
+	// citationPoolFactor is how many results are fetched per citation, so
+	// duplicates folded away still leave enough distinct ones
+	citationPoolFactor = 2
+
+	// nearIdenticalText is the word overlap (Jaccard similarity) at or above
+	// which two citations' texts count as the same
+	nearIdenticalText = 0.9
+)
+
+// validCitationStyle reports whether style is a known citation style or empty
+func validCitationStyle(style string) bool {
+	switch style {
+	case "", CitationStyleList, CitationStyleInline, CitationStyleFootnote:
+		return true
+	default:
+		return false
+	}
+}
+
+// dedupeCitations folds citations of a document already cited, through
+// another of its chunks, and ones whose text is near-identical to an
+// earlier one's into that earlier, higher-ranked citation, and returns at
+// most limit of those left
+func dedupeCitations(citations []Citation, limit int) []Citation {
+	kept := make([]Citation, 0, min(len(citations), limit))
+	parents := make(map[string]int) // Parent document -> index in kept
+	words := make([]map[string]bool, 0, limit)
+	for _, cit := range citations {
+		parent := cit.DocID
+		if cit.ChunkOf != "" {
+			parent = cit.ChunkOf
+		}
+		if i, ok := parents[parent]; ok {
+			kept[i].Duplicates++
+			continue
+		}
+		w := wordSet(cit.Text)
+		dup := -1
+		for i := range kept {
+			if jaccard(w, words[i]) >= nearIdenticalText {
+				dup = i
+				break
+			}
+		}
+		if dup >= 0 {
+			kept[dup].Duplicates++
+			parents[parent] = dup
+			continue
+		}
+		if len(kept) == limit {
+			continue // Still folded into the kept ones above
+		}
+		parents[parent] = len(kept)
+		kept = append(kept, cit)
+		words = append(words, w)
+	}
+	return kept
+}
+
+// wordSet returns the lowercased words of text, ignoring punctuation
+func wordSet(text string) map[string]bool {
+	words := make(map[string]bool)
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}) {
+		words[w] = true
+	}
+	return words
+}
+
+// jaccard is the share of words two sets have in common; 0 if either is
+// empty, so citations without text are never folded together
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for w := range a {
+		if b[w] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+// composeAnswer creates a simple answer from citations. Inline and footnote
+// answers also return where each marker is, so UIs can link claims to
+// their sources.
+// TODO: Replace with real LLM-based answer generation in V1
+func composeAnswer(query string, citations []Citation, style string) (string, []CitationMarker) {
+	if len(citations) == 0 {
+		return fmt.Sprintf("No relevant documents found for query: %s", query), nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Based on %d document(s):\n\n", len(citations))
+
+	switch style {
+	case CitationStyleInline, CitationStyleFootnote:
+		format := "[%d]"
+		if style == CitationStyleFootnote {
+			format = "[^%d]"
+		}
+		markers := make([]CitationMarker, len(citations))
+		for i, cit := range citations {
+			b.WriteString(claim(cit.Text))
+			if style == CitationStyleInline {
+				b.WriteByte(' ')
+			}
+			markers[i] = CitationMarker{Marker: fmt.Sprintf(format, i+1), Citation: i, DocID: cit.DocID, Offset: b.Len()}
+			b.WriteString(markers[i].Marker)
+			b.WriteByte('\n')
+		}
+		if style == CitationStyleFootnote {
+			b.WriteByte('\n')
+			for i, cit := range citations {
+				fmt.Fprintf(&b, "%s: %s (%s)\n", markers[i].Marker, cit.Title, cit.Source)
+			}
+		}
+		return b.String(), markers
+	default:
+		for i, cit := range citations {
+			fmt.Fprintf(&b, "%d. [%s] %s (score: %.3f)\n   %s\n\n",
+				i+1, cit.Source, cit.Title, cit.Score, truncate(cit.Text, maxClaimLen))
+		}
+		return b.String(), nil
+	}
+}
+
+// claim is the text an inline or footnote answer quotes from a citation:
+// its first sentence, truncated
+func claim(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if i := strings.IndexAny(text, ".!?"); i >= 0 {
+		text = text[:i+1]
+	}
+	return truncate(text, maxClaimLen)
+}
+
+// truncate cuts text to n bytes, marking the cut with "..."
+func truncate(text string, n int) string {
+	if len(text) <= n {
+		return text
+	}
+	return text[:n] + "..."
+}
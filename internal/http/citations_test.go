@@ -0,0 +1,110 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestComposeAnswerStyles(t *testing.T) {
+	citations := []Citation{
+		{DocID: "a", Title: "Planning", Source: "notion", Text: "Q3 planning starts in July. Owners are assigned later."},
+		{DocID: "b", Title: "On-call", Source: "wiki", Text: "The on-call rotation is weekly"},
+	}
+
+	list, markers := composeAnswer("q", citations, "")
+	if markers != nil || !strings.Contains(list, "1. [notion] Planning") {
+		t.Errorf("expected the default list style, got %q %v", list, markers)
+	}
+
+	for _, tt := range []struct {
+		style  string
+		first  string
+		claims []string
+	}{
+		{CitationStyleInline, "[1]", []string{"Q3 planning starts in July. [1]", "The on-call rotation is weekly [2]"}},
+		{CitationStyleFootnote, "[^1]", []string{"Q3 planning starts in July.[^1]", "[^2]: On-call (wiki)"}},
+	} {
+		answer, markers := composeAnswer("q", citations, tt.style)
+		if len(markers) != 2 {
+			t.Fatalf("%s: expected 2 markers, got %v", tt.style, markers)
+		}
+		for _, c := range tt.claims {
+			if !strings.Contains(answer, c) {
+				t.Errorf("%s: expected %q in %q", tt.style, c, answer)
+			}
+		}
+		for i, m := range markers {
+			if m.Citation != i || m.DocID != citations[i].DocID || !strings.HasPrefix(answer[m.Offset:], m.Marker) {
+				t.Errorf("%s: marker %d doesn't point at itself: %+v", tt.style, i, m)
+			}
+		}
+		if markers[0].Marker != tt.first {
+			t.Errorf("%s: expected first marker %s, got %s", tt.style, tt.first, markers[0].Marker)
+		}
+	}
+}
+
+func TestHandleRunCitationStyle(t *testing.T) {
+	_, router := setupTestHandler(t)
+	doc := IngestRequest{ID: "cite-1", Source: "test", Title: "AI", Text: "Artificial intelligence is transforming technology"}
+	if w := doJSON(router, http.MethodPost, "/ingest", doc); w.Code != http.StatusOK {
+		t.Fatalf("ingest failed: %d %s", w.Code, w.Body.String())
+	}
+
+	w := doJSON(router, http.MethodPost, "/run", RunRequest{Query: "AI technology", CitationStyle: CitationStyleInline})
+	var resp RunResponse
+	_ = json.NewDecoder(w.Body).Decode(&resp)
+	if w.Code != http.StatusOK || len(resp.Markers) != 1 || resp.Markers[0].DocID != "cite-1" {
+		t.Fatalf("expected one marker for cite-1, got %d %+v", w.Code, resp.Markers)
+	}
+
+	if w := doJSON(router, http.MethodPost, "/run", RunRequest{Query: "AI", CitationStyle: "endnote"}); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown citation style, got %d", w.Code)
+	}
+}
+
+func TestDedupeCitations(t *testing.T) {
+	citations := []Citation{
+		{DocID: "guide#0", ChunkOf: "guide", Text: "Install the agent with the package manager."},
+		{DocID: "faq", Text: "Rotate keys every 90 days."},
+		{DocID: "guide#3", ChunkOf: "guide", Text: "Configure the agent's upstream."},
+		{DocID: "faq-copy", Text: "Rotate keys every 90 days!"},
+		{DocID: "other", Text: "Backups run nightly."},
+		{DocID: "spare", Text: "Logs are kept for a week."},
+	}
+	got := dedupeCitations(citations, 3)
+	if len(got) != 3 || got[0].DocID != "guide#0" || got[1].DocID != "faq" || got[2].DocID != "other" {
+		t.Fatalf("expected guide, faq, and other, got %+v", got)
+	}
+	if got[0].Duplicates != 1 || got[1].Duplicates != 1 || got[2].Duplicates != 0 {
+		t.Errorf("expected one duplicate each folded into guide and faq, got %+v", got)
+	}
+
+	// Citations without text aren't folded together
+	if got := dedupeCitations([]Citation{{DocID: "a"}, {DocID: "b"}}, 3); len(got) != 2 {
+		t.Errorf("expected both empty citations kept, got %+v", got)
+	}
+}
+
+func TestHandleRunLimit(t *testing.T) {
+	_, router := setupTestHandler(t)
+	for _, id := range []string{"l-1", "l-2", "l-3", "l-4", "l-5"} {
+		doc := IngestRequest{ID: id, Source: "test", Title: id, Text: "Deploy notes for service " + id}
+		if w := doJSON(router, http.MethodPost, "/ingest", doc); w.Code != http.StatusOK {
+			t.Fatalf("ingest failed: %d %s", w.Code, w.Body.String())
+		}
+	}
+
+	w := doJSON(router, http.MethodPost, "/run", RunRequest{Query: "deploy notes", Limit: 5, MinScore: -1})
+	var resp RunResponse
+	_ = json.NewDecoder(w.Body).Decode(&resp)
+	if w.Code != http.StatusOK || len(resp.Citations) != 5 {
+		t.Fatalf("expected 5 citations, got %d %+v", w.Code, resp.Citations)
+	}
+
+	if w := doJSON(router, http.MethodPost, "/run", RunRequest{Query: "deploy", Limit: maxRunLimit + 1}); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a limit over %d, got %d", maxRunLimit, w.Code)
+	}
+}
@@ -0,0 +1,79 @@
+package httpapi
+
+import (
+	"context"
+	"net/http"
+	"net/netip"
+
+	"github.com/dsjohal14/selfstack/internal/libs/access"
+)
+
+// CertKeyPrefix starts the usage key of requests identified by a client
+// certificate instead of an API key, e.g. cert_ingest
+const CertKeyPrefix = "cert_"
+
+// principalContext is the context key of the principal a request's client
+// certificate was mapped to
+type principalContext struct{}
+
+// WithIPAllowlist refuses requests from addresses the allowlist leaves out
+// of their route
+func WithIPAllowlist(a *access.Allowlist) HandlerOption {
+	return func(h *Handler) {
+		h.ipAllowlist = a
+	}
+}
+
+// WithClientCerts identifies requests sent over mutual TLS by their
+// verified client certificate, as the principal principals maps its CN to,
+// or the CN itself when principals is empty. Certificates of other CNs are
+// refused. The principal stands in for an API key: it's metered as
+// cert_PRINCIPAL, which the *_KEYS settings can list, and satisfies
+// API_KEYS_REQUIRED.
+func WithClientCerts(principals map[string]string) HandlerOption {
+	return func(h *Handler) {
+		h.clientCerts = true
+		h.certPrincipals = principals
+	}
+}
+
+// CheckIP refuses requests from addresses the IP allowlist leaves out of
+// their route. It checks the connection's address, so it must run before
+// middleware.RealIP: X-Forwarded-For can be set by anyone.
+func (h *Handler) CheckIP(next http.Handler) http.Handler {
+	if h.ipAllowlist == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addr, err := netip.ParseAddrPort(r.RemoteAddr)
+		if err != nil || !h.ipAllowlist.Allows(r.URL.Path, addr.Addr()) {
+			h.logger.Warn().Str("remote_addr", r.RemoteAddr).Str("path", r.URL.Path).Msg("request refused by IP allowlist")
+			authError(w, r, http.StatusForbidden, "this address may not use "+r.URL.Path, "IP_FORBIDDEN")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// identifyCert adds the principal of the request's verified client
+// certificate to its context. It reports false, having written a 403, for
+// a certificate whose CN isn't mapped to a principal.
+func (h *Handler) identifyCert(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	if !h.clientCerts || r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return r, true
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	principal, ok := access.Principal(cert, h.certPrincipals)
+	if !ok {
+		authError(w, r, http.StatusForbidden, "client certificate "+cert.Subject.CommonName+" is not mapped to a principal", "CERT_FORBIDDEN")
+		return r, false
+	}
+	return r.WithContext(context.WithValue(r.Context(), principalContext{}, principal)), true
+}
+
+// certPrincipal returns the principal of the request's client certificate;
+// empty for none
+func certPrincipal(r *http.Request) string {
+	principal, _ := r.Context().Value(principalContext{}).(string)
+	return principal
+}
@@ -0,0 +1,169 @@
+package httpapi
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/access"
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestCheckIP(t *testing.T) {
+	rules, err := access.ParseRules("/admin/*=10.1.0.0/16,/search=10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewHandler(nil, obs.Logger("test"), WithIPAllowlist(access.NewAllowlist(rules)))
+	ok := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) })
+	handler := h.CheckIP(ok)
+
+	tests := []struct {
+		path, remote string
+		forwarded    string
+		want         int
+	}{
+		{"/search", "10.9.9.9:4000", "", http.StatusOK},
+		{"/search", "192.168.1.1:4000", "", http.StatusForbidden},
+		{"/search", "192.168.1.1:4000", "10.9.9.9", http.StatusForbidden}, // X-Forwarded-For isn't trusted
+		{"/admin/keys", "10.9.9.9:4000", "", http.StatusForbidden},
+		{"/admin/keys", "[::ffff:10.1.0.1]:4000", "", http.StatusOK},
+		{"/health", "203.0.113.7:4000", "", http.StatusOK}, // No rule matches
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		req.RemoteAddr = tt.remote
+		if tt.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s from %s: got %d, want %d", tt.path, tt.remote, w.Code, tt.want)
+		}
+	}
+}
+
+func TestClientCerts(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := newTestCert(t, dir, "ca", "selfstack test CA", nil, nil)
+	newTestCert(t, dir, "server", "127.0.0.1", ca, caKey)
+	newTestCert(t, dir, "ingest", "ingest-worker.internal", ca, caKey)
+	newTestCert(t, dir, "laptop", "laptop", ca, caKey)
+
+	store, err := db.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	keys, _ := db.NewAPIKeyStore("")
+	h := NewHandler(store, obs.Logger("test"),
+		WithAPIKeys(keys, []string{CertKeyPrefix + "ingest"}, true),
+		WithClientCerts(map[string]string{"ingest-worker.internal": "ingest"}),
+	)
+	router := chi.NewRouter()
+	router.Use(h.Authenticate)
+	h.Routes(router)
+
+	tlsConfig, err := access.ServerTLS(filepath.Join(dir, "server.pem"), filepath.Join(dir, "server.key"), filepath.Join(dir, "ca.pem"), access.ClientAuthOptional)
+	if err != nil {
+		t.Fatalf("ServerTLS failed: %v", err)
+	}
+	server := httptest.NewUnstartedServer(router)
+	server.TLS = tlsConfig
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	roots, err := access.LoadCertPool(filepath.Join(dir, "ca.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func(client string) int {
+		t.Helper()
+		cfg := &tls.Config{RootCAs: roots}
+		if client != "" {
+			cert, err := tls.LoadX509KeyPair(filepath.Join(dir, client+".pem"), filepath.Join(dir, client+".key"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg.Certificates = []tls.Certificate{cert}
+		}
+		hc := &http.Client{Transport: &http.Transport{TLSClientConfig: cfg}}
+		resp, err := hc.Get(server.URL + "/admin/keys")
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// The ingest principal is listed in the key admins as cert_ingest
+	if code := get("ingest"); code != http.StatusOK {
+		t.Errorf("expected the mapped certificate to manage keys, got %d", code)
+	}
+	if code := get("laptop"); code != http.StatusForbidden {
+		t.Errorf("expected an unmapped certificate to be refused, got %d", code)
+	}
+	if code := get(""); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a certificate or key, got %d", code)
+	}
+}
+
+// newTestCert writes name.pem and name.key to dir: a CA when parent is
+// nil, otherwise a certificate for cn signed by parent
+func newTestCert(t *testing.T, dir, name, cn string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if ip := net.ParseIP(cn); ip != nil {
+		tmpl.IPAddresses = []net.IP{ip}
+	}
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
@@ -0,0 +1,201 @@
+package httpapi
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/dsjohal14/selfstack/internal/libs/membudget"
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+)
+
+// DefaultResultCacheSize is the number of results each cache keeps when
+// no size is configured
+const DefaultResultCacheSize = 1024
+
+// resultGen identifies the state results were computed against: the store's
+// index watermark plus writes it can't see, like collection changes
+type resultGen struct {
+	lsn    uint64
+	writes uint64
+}
+
+// resultCache coalesces identical in-flight operations so concurrent callers
+// share one execution, and optionally keeps results in an LRU for a short
+// TTL. Cached results only match callers at the same generation, so any
+// write makes them unreachable and they age out of the LRU.
+type resultCache[T any] struct {
+	ttl  time.Duration // 0 coalesces in-flight calls only
+	size int
+
+	budget *membudget.Budget // Evicts while exceeded; nil for no cap
+	sizeOf func(T) int64     // Estimated memory of a result
+
+	mu      sync.Mutex
+	flights map[string]*flight[T]
+	entries map[string]*list.Element // Values are *cachedResult[T]
+	lru     *list.List               // Most recently used first
+}
+
+type flight[T any] struct {
+	done chan struct{}
+	val  T
+	err  error
+}
+
+type cachedResult[T any] struct {
+	key     string
+	val     T
+	gen     resultGen
+	expires time.Time
+	bytes   int64 // Counted against the budget
+}
+
+// cachedResultOverhead is the memory of a cache entry beyond its key and
+// value: the entry, the list element, and the map entry
+const cachedResultOverhead = 160
+
+func newResultCache[T any](ttl time.Duration, size int) *resultCache[T] {
+	if size <= 0 {
+		size = DefaultResultCacheSize
+	}
+	return &resultCache[T]{
+		ttl:     ttl,
+		size:    size,
+		flights: make(map[string]*flight[T]),
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// do returns the cached or in-flight result for key at gen, or runs fn.
+// shared reports whether the result came from another caller. Errors are
+// shared with callers already waiting but never cached.
+func (c *resultCache[T]) do(key string, gen resultGen, fn func() (T, error)) (val T, shared bool, err error) {
+	flightKey := fmt.Sprintf("%d\x00%d\x00%s", gen.lsn, gen.writes, key)
+
+	c.mu.Lock()
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*cachedResult[T])
+		if e.gen == gen && time.Now().Before(e.expires) {
+			c.lru.MoveToFront(el)
+			c.mu.Unlock()
+			return e.val, true, nil
+		}
+		c.removeLocked(el)
+	}
+	if f, ok := c.flights[flightKey]; ok {
+		c.mu.Unlock()
+		<-f.done
+		return f.val, true, f.err
+	}
+	f := &flight[T]{done: make(chan struct{})}
+	c.flights[flightKey] = f
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.flights, flightKey)
+		if c.ttl > 0 && f.err == nil {
+			c.storeLocked(&cachedResult[T]{key: key, val: f.val, gen: gen, expires: time.Now().Add(c.ttl)})
+		}
+		c.mu.Unlock()
+		close(f.done)
+	}()
+	f.val, f.err = fn()
+	return f.val, false, f.err
+}
+
+// storeLocked caches e unless a newer generation's result is already cached,
+// evicting the least recently used results when full or over budget
+func (c *resultCache[T]) storeLocked(e *cachedResult[T]) {
+	if el, ok := c.entries[e.key]; ok {
+		old := el.Value.(*cachedResult[T])
+		if old.gen.lsn > e.gen.lsn || old.gen.writes > e.gen.writes {
+			return
+		}
+		c.removeLocked(el)
+	}
+	if c.sizeOf != nil {
+		e.bytes = int64(len(e.key)) + c.sizeOf(e.val) + cachedResultOverhead
+	}
+	c.entries[e.key] = c.lru.PushFront(e)
+	c.budget.Add(e.bytes)
+	for c.lru.Len() > c.size || (c.budget.Exceeded() && c.lru.Len() > 0) {
+		c.removeLocked(c.lru.Back())
+	}
+}
+
+// removeLocked drops a cached result
+func (c *resultCache[T]) removeLocked(el *list.Element) {
+	e := el.Value.(*cachedResult[T])
+	c.lru.Remove(el)
+	delete(c.entries, e.key)
+	c.budget.Add(-e.bytes)
+}
+
+// setBudget counts cached results, sized by sizeOf, against b
+func (c *resultCache[T]) setBudget(b *membudget.Budget, sizeOf func(T) int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.budget = b
+	c.sizeOf = sizeOf
+}
+
+// searchResultsBytes estimates the memory of search results
+func searchResultsBytes(results []db.SearchResult) int64 {
+	n := int64(len(results)) * int64(unsafe.Sizeof(db.SearchResult{}))
+	for _, r := range results {
+		n += int64(len(r.DocID) + len(r.Title) + len(r.Text) + len(r.Source) + len(r.Collection))
+		for k, v := range r.Metadata {
+			n += int64(len(k)+len(v)) + 48
+		}
+	}
+	return n
+}
+
+// count returns the number of cached results
+func (c *resultCache[T]) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// coalesceKey identifies an operation by its query and resolved filters.
+// Callers trim the query and fill in defaults first, so requests that only
+// differ in surrounding whitespace or omitted defaults share a key. Case and
+// inner whitespace are kept: embedders hash the raw text.
+func coalesceKey(op, collection, mode string, limit int, query string) string {
+	return fmt.Sprintf("%s\x00%s\x00%s\x00%d\x00%s", op, collection, mode, limit, query)
+}
+
+// newCoalescedCounter registers the shared result metric in reg
+func newCoalescedCounter(reg *obs.Registry) *obs.CounterVec {
+	return reg.CounterVec("selfstack_coalesced_ops_total", "Searches and runs answered by another request's scan or the result cache", "op")
+}
+
+// indexWatermarker is implemented by stores that track which writes their
+// index reflects
+type indexWatermarker interface {
+	IndexLSN() uint64
+}
+
+// resultGen returns the generation searches run now are computed against.
+// Stores with a watermark invalidate results on every write by themselves,
+// including writes that bypass the handler.
+func (h *Handler) resultGen() resultGen {
+	gen := resultGen{writes: h.writeGen.Load()}
+	if wm, ok := h.store.(indexWatermarker); ok {
+		gen.lsn = wm.IndexLSN()
+	}
+	return gen
+}
+
+// invalidateResults drops cached search and run results; call it after
+// every write to the store or collection settings
+func (h *Handler) invalidateResults() {
+	h.writeGen.Add(1)
+}
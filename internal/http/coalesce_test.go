@@ -0,0 +1,224 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/membudget"
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+	"github.com/dsjohal14/selfstack/internal/relay"
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestResultCacheCoalescesConcurrentCalls(t *testing.T) {
+	c := newResultCache[int](0, 0)
+	release := make(chan struct{})
+	var calls atomic.Int32
+
+	const callers = 20
+	var wg sync.WaitGroup
+	results := make([]int, callers)
+	var shared atomic.Int32
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			v, s, _ := c.do("k", resultGen{}, func() (int, error) {
+				calls.Add(1)
+				<-release
+				return 42, nil
+			})
+			results[i] = v
+			if s {
+				shared.Add(1)
+			}
+		}(i)
+	}
+
+	// Give the other callers time to join the in-flight call
+	for {
+		c.mu.Lock()
+		inFlight := len(c.flights) > 0
+		c.mu.Unlock()
+		if inFlight {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := calls.Load(); n != int32(callers-shared.Load()) {
+		t.Errorf("expected one call per unshared result, got %d calls and %d shared", n, shared.Load())
+	}
+	if calls.Load() == callers {
+		t.Error("expected concurrent callers to share a call")
+	}
+	for i, v := range results {
+		if v != 42 {
+			t.Errorf("caller %d got %d", i, v)
+		}
+	}
+
+	// Without a TTL nothing is kept once the call finishes
+	if _, s, _ := c.do("k", resultGen{}, func() (int, error) { return 7, nil }); s {
+		t.Error("expected no cached result with a zero TTL")
+	}
+}
+
+func TestResultCacheTTLAndGeneration(t *testing.T) {
+	c := newResultCache[int](50*time.Millisecond, 0)
+	calls := 0
+	fn := func() (int, error) { calls++; return calls, nil }
+
+	if v, s, _ := c.do("k", resultGen{lsn: 1}, fn); v != 1 || s {
+		t.Fatalf("expected a fresh result, got %d shared=%v", v, s)
+	}
+	if v, s, _ := c.do("k", resultGen{lsn: 1}, fn); v != 1 || !s {
+		t.Errorf("expected the cached result, got %d shared=%v", v, s)
+	}
+	if v, _, _ := c.do("other", resultGen{lsn: 1}, fn); v != 2 {
+		t.Errorf("expected a different key to run, got %d", v)
+	}
+	if v, s, _ := c.do("k", resultGen{lsn: 2}, fn); v != 3 || s {
+		t.Errorf("expected a write to invalidate the result, got %d shared=%v", v, s)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if v, s, _ := c.do("k", resultGen{lsn: 2}, fn); v != 4 || s {
+		t.Errorf("expected the result to expire, got %d shared=%v", v, s)
+	}
+}
+
+func TestResultCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newResultCache[string](time.Minute, 2)
+	fn := func(v string) func() (string, error) { return func() (string, error) { return v, nil } }
+
+	c.do("a", resultGen{}, fn("a"))
+	c.do("b", resultGen{}, fn("b"))
+	c.do("a", resultGen{}, fn("a")) // a is now the most recently used
+	c.do("c", resultGen{}, fn("c"))
+
+	if n := c.count(); n != 2 {
+		t.Errorf("expected 2 cached results, got %d", n)
+	}
+	if _, shared, _ := c.do("a", resultGen{}, fn("a")); !shared {
+		t.Error("expected a to stay cached")
+	}
+	if _, shared, _ := c.do("b", resultGen{}, fn("b")); shared {
+		t.Error("expected b to be evicted")
+	}
+}
+
+func TestResultCacheEvictsWithinBudget(t *testing.T) {
+	budget := membudget.New(membudget.ModuleResultCache, 2*(cachedResultOverhead+11), nil)
+	c := newResultCache[string](time.Minute, 0)
+	c.setBudget(budget, func(v string) int64 { return int64(len(v)) })
+	fn := func(v string) func() (string, error) { return func() (string, error) { return v, nil } }
+
+	c.do("a", resultGen{}, fn("aaaaaaaaaa"))
+	c.do("b", resultGen{}, fn("bbbbbbbbbb"))
+	c.do("c", resultGen{}, fn("cccccccccc"))
+
+	if n := c.count(); n != 2 {
+		t.Errorf("expected 2 cached results, got %d", n)
+	}
+	if _, shared, _ := c.do("a", resultGen{}, fn("aaaaaaaaaa")); shared {
+		t.Error("expected a to be evicted")
+	}
+	if budget.Exceeded() {
+		t.Errorf("budget exceeded: used %d of %d", budget.Used(), budget.Limit())
+	}
+}
+
+func TestSearchCacheInvalidatedByWrites(t *testing.T) {
+	store, _ := setupWALTestHandler(t)
+	reg := obs.NewRegistry()
+	handler := NewHandler(store, obs.Logger("test"),
+		WithMetrics(reg),
+		WithResultCache("search", time.Minute, 0),
+	)
+	r := chi.NewRouter()
+	r.Post("/ingest", handler.HandleIngest)
+	r.Post("/search", handler.HandleSearch)
+	r.Delete("/documents/{id}", handler.HandleDeleteDocument)
+
+	search := func(query string) SearchResponse {
+		t.Helper()
+		w := doJSON(r, http.MethodPost, "/search", SearchRequest{Query: query, Debug: true})
+		if w.Code != http.StatusOK {
+			t.Fatalf("search failed: %d %s", w.Code, w.Body.String())
+		}
+		var resp SearchResponse
+		_ = json.NewDecoder(w.Body).Decode(&resp)
+		return resp
+	}
+
+	doc := IngestRequest{ID: "550e8400-e29b-41d4-a716-446655440000", Source: "test", Title: "Cache", Text: "cached text"}
+	if w := doJSON(r, http.MethodPost, "/ingest", doc); w.Code != http.StatusOK {
+		t.Fatalf("ingest failed: %d %s", w.Code, w.Body.String())
+	}
+
+	if resp := search("cached text"); resp.Count != 1 || resp.Timings.Shared {
+		t.Fatalf("expected one fresh result, got %d shared=%v", resp.Count, resp.Timings.Shared)
+	}
+	// Surrounding whitespace and an omitted mode share the key
+	if resp := search("  cached text "); resp.Count != 1 || !resp.Timings.Shared {
+		t.Errorf("expected the cached result, got %d shared=%v", resp.Count, resp.Timings.Shared)
+	}
+	if got := reg.CounterVec("selfstack_coalesced_ops_total", "", "op").WithLabel("search").Value(); got != 1 {
+		t.Errorf("expected 1 coalesced search, got %d", got)
+	}
+
+	if w := doJSON(r, http.MethodDelete, "/documents/"+doc.ID, nil); w.Code != http.StatusOK {
+		t.Fatalf("delete failed: %d %s", w.Code, w.Body.String())
+	}
+	if resp := search("cached text"); resp.Count != 0 || resp.Timings.Shared {
+		t.Errorf("expected the delete to invalidate the cache, got %d shared=%v", resp.Count, resp.Timings.Shared)
+	}
+}
+
+func TestSearchCacheFollowsIndexWatermark(t *testing.T) {
+	store, _ := setupWALTestHandler(t)
+	handler := NewHandler(store, obs.Logger("test"), WithResultCache("search", time.Minute, 0))
+	r := chi.NewRouter()
+	r.Post("/search", handler.HandleSearch)
+
+	count := func() int {
+		t.Helper()
+		w := doJSON(r, http.MethodPost, "/search", SearchRequest{Query: "watermark"})
+		var resp SearchResponse
+		_ = json.NewDecoder(w.Body).Decode(&resp)
+		return resp.Count
+	}
+
+	if n := count(); n != 0 {
+		t.Fatalf("expected no results, got %d", n)
+	}
+	// Writes that bypass the handler still advance the watermark
+	if err := store.Add(db.Document{ID: "550e8400-e29b-41d4-a716-446655440001", Title: "W", Text: "watermark", Embedding: relay.DeterministicEmbed("watermark")}); err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+	if n := count(); n != 1 {
+		t.Errorf("expected the new document after a store write, got %d", n)
+	}
+}
+
+func TestResultCacheDoesNotCacheErrors(t *testing.T) {
+	c := newResultCache[int](time.Minute, 0)
+	errEmbed := errors.New("embedder down")
+
+	if _, _, err := c.do("k", resultGen{}, func() (int, error) { return 0, errEmbed }); err != errEmbed {
+		t.Fatalf("expected the call's error, got %v", err)
+	}
+	if v, s, err := c.do("k", resultGen{}, func() (int, error) { return 1, nil }); err != nil || s || v != 1 {
+		t.Errorf("expected a failed call to run again, got %d shared=%v err=%v", v, s, err)
+	}
+}
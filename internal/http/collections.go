@@ -0,0 +1,232 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/relay"
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+)
+
+// Metadata keys set on chunked documents and ACL defaults
+const (
+	metaChunkOf  = "chunk_of"
+	metaChunk    = "chunk"
+	metaACLRead  = "acl_read"
+	metaACLWrite = "acl_write"
+
+	// Names the embedder used because the collection's was unavailable, so
+	// the document can be found and re-embedded later
+	metaEmbeddingFallback = "embedding_fallback"
+
+	// Hash of the content and metadata a document was ingested with, to
+	// detect re-deliveries of an unchanged document
+	metaContentHash = "content_hash"
+)
+
+// collection is a collection config with its models built
+type collection struct {
+	db.CollectionConfig
+	embedder relay.Embedder
+	reranker relay.Reranker  // nil for none
+	queries  *embeddingCache // Query embeddings; nil caches none
+}
+
+// searchFilter restricts a search to the collection's live documents
+func (c *collection) searchFilter(now time.Time) db.SearchFilter {
+	return db.SearchFilter{Collection: c.Name, CreatedAfter: c.RetentionCutoff(now)}
+}
+
+// guardedEmbedder is implemented by embedders that call a remote provider
+// through a circuit breaker and can fail or fall back
+type guardedEmbedder interface {
+	EmbedGuarded(ctx context.Context, text string) (relay.Embedding, string, error)
+}
+
+// embed embeds text with the collection's embedder. fallback names the
+// embedder used instead when the collection's was unavailable.
+func (c *collection) embed(ctx context.Context, text string) (emb relay.Embedding, fallback string, err error) {
+	if g, ok := c.embedder.(guardedEmbedder); ok {
+		return g.EmbedGuarded(ctx, text)
+	}
+	return c.embedder.Embed(text), "", nil
+}
+
+// writeEmbedError reports an embedder that failed without a fallback
+func (h *Handler) writeEmbedError(w http.ResponseWriter, coll *collection, err error) {
+	h.logger.Warn().Err(err).Str("collection", coll.Name).Str("embedder", coll.embedder.Name()).Msg("embedder unavailable")
+	var open *relay.CircuitOpenError
+	if errors.As(err, &open) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(open.Until).Seconds()))))
+	}
+	writeError(w, http.StatusServiceUnavailable, "embedder unavailable: "+err.Error(), "EMBEDDER_UNAVAILABLE")
+}
+
+// resolveCollection loads the named collection (default when empty),
+// writing a 404 if it doesn't exist or a 403 if the API key may not use it
+func (h *Handler) resolveCollection(w http.ResponseWriter, r *http.Request, name string) (*collection, bool) {
+	if name == "" {
+		name = db.DefaultCollection
+	}
+	if !mayUseCollection(r, name) {
+		writeError(w, http.StatusForbidden, "this API key may not use collection "+name, "NAMESPACE_FORBIDDEN")
+		return nil, false
+	}
+
+	coll, found, err := h.loadCollection(r.Context(), name)
+	if err != nil {
+		h.logger.Error().Err(err).Str("collection", name).Msg("failed to load collection")
+		writeError(w, http.StatusInternalServerError, "failed to load collection", "COLLECTION_ERROR")
+		return nil, false
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "collection not found: "+name, "COLLECTION_NOT_FOUND")
+		return nil, false
+	}
+	return coll, true
+}
+
+// loadCollection loads the named collection and builds its models
+func (h *Handler) loadCollection(ctx context.Context, name string) (*collection, bool, error) {
+	cfg, found := db.DefaultCollectionConfig(), name == db.DefaultCollection
+	if h.collections != nil {
+		var err error
+		cfg, found, err = h.collections.Get(ctx, name)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	if !found {
+		return nil, false, nil
+	}
+
+	embedder, reranker, err := cfg.Models()
+	if err != nil {
+		return nil, true, fmt.Errorf("invalid collection config: %w", err)
+	}
+	return &collection{CollectionConfig: cfg, embedder: embedder, reranker: reranker, queries: h.embeddings}, true, nil
+}
+
+// chunkID is the document ID of the nth (1-based) chunk of docID
+func chunkID(docID string, n int) string {
+	return fmt.Sprintf("%s:chunk:%d", docID, n)
+}
+
+// chunkText splits text into windows of cfg.Size words, each repeating the
+// last cfg.Overlap words of the previous one. Text that fits in one chunk
+// (or chunking disabled) returns nil.
+func chunkText(text string, cfg db.ChunkingConfig) []string {
+	if cfg.Size <= 0 {
+		return nil
+	}
+	words := strings.Fields(text)
+	if len(words) <= cfg.Size {
+		return nil
+	}
+
+	step := cfg.Size - cfg.Overlap
+	var chunks []string
+	for start := 0; start < len(words); start += step {
+		end := start + cfg.Size
+		if end > len(words) {
+			end = len(words)
+		}
+		chunks = append(chunks, strings.Join(words[start:end], " "))
+		if end == len(words) {
+			break
+		}
+	}
+	return chunks
+}
+
+// withACLDefaults returns a copy of metadata with the collection's ACL
+// defaults filled in where the document didn't set its own
+func withACLDefaults(metadata map[string]string, acl db.ACLConfig) map[string]string {
+	out := make(map[string]string, len(metadata)+2)
+	for k, v := range metadata {
+		out[k] = v
+	}
+	if _, ok := out[metaACLRead]; !ok && len(acl.Read) > 0 {
+		out[metaACLRead] = strings.Join(acl.Read, ",")
+	}
+	if _, ok := out[metaACLWrite]; !ok && len(acl.Write) > 0 {
+		out[metaACLWrite] = strings.Join(acl.Write, ",")
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// chunkDocs expands a document into its chunks, or returns it unchanged
+func chunkDocs(doc db.Document, chunks []string) []db.Document {
+	if len(chunks) == 0 {
+		return []db.Document{doc}
+	}
+	docs := make([]db.Document, len(chunks))
+	for i, text := range chunks {
+		chunk := doc
+		chunk.ID = chunkID(doc.ID, i+1)
+		chunk.Text = text
+		chunk.Metadata = make(map[string]string, len(doc.Metadata)+2)
+		for k, v := range doc.Metadata {
+			chunk.Metadata[k] = v
+		}
+		chunk.Metadata[metaChunkOf] = doc.ID
+		chunk.Metadata[metaChunk] = strconv.Itoa(i + 1)
+		docs[i] = chunk
+	}
+	return docs
+}
+
+// rerank reorders store results with the collection's reranker
+func rerank(reranker relay.Reranker, query string, results []db.SearchResult) []db.SearchResult {
+	if reranker == nil || len(results) < 2 {
+		return results
+	}
+
+	byID := make(map[string]db.SearchResult, len(results))
+	candidates := make([]relay.Candidate, len(results))
+	for i, r := range results {
+		byID[r.DocID] = r
+		candidates[i] = relay.Candidate{ID: r.DocID, Text: r.Title + " " + r.Text, Score: r.Score}
+	}
+
+	reranker.Rerank(query, candidates)
+
+	out := make([]db.SearchResult, len(candidates))
+	for i, c := range candidates {
+		out[i] = byID[c.ID]
+		out[i].Score = c.Score
+	}
+	return out
+}
+
+// minScore is the score results must reach: the request's threshold, or
+// the collection's for semantic scores when the request sets none
+func (c *collection) minScore(requested float32, semantic bool) float32 {
+	if requested != 0 || !semantic {
+		return requested
+	}
+	return c.MinScore
+}
+
+// aboveScore drops results scoring below min; a zero min keeps them all
+func aboveScore(results []db.SearchResult, min float32) []db.SearchResult {
+	if min == 0 {
+		return results
+	}
+	kept := make([]db.SearchResult, 0, len(results))
+	for _, r := range results {
+		if r.Score >= min {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
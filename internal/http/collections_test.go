@@ -0,0 +1,92 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+	"github.com/dsjohal14/selfstack/internal/relay"
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+)
+
+func TestCollectionEmbedders(t *testing.T) {
+	store, _ := setupWALTestHandler(t)
+	reg, err := db.NewFileCollectionRegistry(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to open registry: %v", err)
+	}
+	_ = reg.Put(context.Background(), db.CollectionConfig{Name: "code", Embedder: relay.ProviderHashing, Reranker: relay.RerankerLexical})
+	handler := NewHandler(store, obs.Logger("test"), WithCollections(reg))
+
+	post := func(fn http.HandlerFunc, body any) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		fn(w, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(data)))
+		return w
+	}
+
+	if w := post(handler.HandleIngest, IngestRequest{ID: "c1", Source: "git", Title: "config.go", Text: "func parseConfig(path string) error", Collection: "code"}); w.Code != http.StatusOK {
+		t.Fatalf("ingest failed: %d %s", w.Code, w.Body.String())
+	}
+
+	// Stored with the hashing embedder
+	doc, _ := store.Get("c1")
+	hashing, _ := relay.NewEmbedder(relay.ProviderHashing, 0)
+	if doc.Embedding != hashing.Embed(doc.Text) {
+		t.Error("document should be embedded with the collection's embedder")
+	}
+
+	w := post(handler.HandleSearch, SearchRequest{Query: "parseConfig", Collection: "code"})
+	var resp SearchResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusOK || resp.Count != 1 || resp.Results[0].DocID != "c1" {
+		t.Fatalf("unexpected search response: %d %s", w.Code, w.Body.String())
+	}
+
+	for _, fn := range []http.HandlerFunc{handler.HandleSearch, handler.HandleRun} {
+		if w := post(fn, SearchRequest{Query: "x", Collection: "missing"}); w.Code != http.StatusNotFound {
+			t.Errorf("expected 404 for unknown collection, got %d", w.Code)
+		}
+	}
+}
+
+// downEmbedder is a remote embedder that always fails
+type downEmbedder struct{}
+
+func (downEmbedder) Name() string                 { return "remote" }
+func (downEmbedder) Dimensions() int              { return relay.EmbeddingDim }
+func (downEmbedder) Embed(string) relay.Embedding { return relay.Embedding{} }
+func (downEmbedder) EmbedContext(context.Context, string) (relay.Embedding, error) {
+	return relay.Embedding{}, errors.New("provider returned 503")
+}
+
+func TestCollectionEmbedFallback(t *testing.T) {
+	breaker := relay.NewBreaker("remote", relay.WithThreshold(1))
+	coll := &collection{
+		CollectionConfig: db.DefaultCollectionConfig(),
+		embedder:         relay.NewGuardedEmbedder(downEmbedder{}, breaker, relay.WithFallback(relay.DefaultEmbedder())),
+	}
+	emb, fallback, err := coll.embed(context.Background(), "hello")
+	if err != nil || fallback != relay.ProviderDeterministic || emb != relay.DeterministicEmbed("hello") {
+		t.Fatalf("expected the fallback embedding, got fallback=%q err=%v", fallback, err)
+	}
+
+	// Fail fast: the breaker is open now
+	coll.embedder = relay.NewGuardedEmbedder(downEmbedder{}, breaker)
+	if _, _, err := coll.embed(context.Background(), "hello"); !errors.Is(err, relay.ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen, got %v", err)
+	}
+
+	store, _ := setupWALTestHandler(t)
+	handler := NewHandler(store, obs.Logger("test"))
+	w := httptest.NewRecorder()
+	handler.writeEmbedError(w, coll, relay.ErrCircuitOpen)
+	if w.Code != http.StatusServiceUnavailable || !bytes.Contains(w.Body.Bytes(), []byte("EMBEDDER_UNAVAILABLE")) {
+		t.Errorf("expected 503 EMBEDDER_UNAVAILABLE, got %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,98 @@
+package httpapi
+
+import (
+	"fmt"
+
+	"github.com/dsjohal14/selfstack/internal/relay"
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+)
+
+// MMR settings
+const (
+	defaultMMRLambda = 0.7 // Mostly relevance, enough diversity to skip near-duplicates
+	mmrPoolFactor    = 3   // Candidates fetched per result returned
+
+	// Chunks of the same document count as at least this similar, since
+	// embedders that aren't semantic see no likeness between them
+	sameDocSimilarity = 0.9
+)
+
+// mmrLambda validates a request's diversity settings and returns the lambda
+// to use, or 0 when diversification is off
+func mmrLambda(diversify bool, lambda float32) (float32, error) {
+	if lambda < 0 || lambda > 1 {
+		return 0, fmt.Errorf("mmr_lambda must be between 0 and 1")
+	}
+	if !diversify {
+		return 0, nil
+	}
+	if lambda == 0 {
+		return defaultMMRLambda, nil
+	}
+	return lambda, nil
+}
+
+// mmrPool is how many candidates to fetch for limit results
+func mmrPool(limit int, lambda float32) int {
+	if lambda == 0 {
+		return limit
+	}
+	return limit * mmrPoolFactor
+}
+
+// diversify picks limit of results by Maximal Marginal Relevance, comparing
+// results by their stored embeddings (or the collection's embedding of
+// their text where the store can't look them up)
+func (h *Handler) diversify(coll *collection, results []db.SearchResult, limit int, lambda float32) []db.SearchResult {
+	if lambda == 0 || len(results) <= 1 {
+		if len(results) > limit {
+			results = results[:limit]
+		}
+		return results
+	}
+
+	getter, _ := h.store.(documentGetter)
+	embs := make([]relay.Embedding, len(results))
+	parents := make([]string, len(results))
+	relevance := make([]float32, len(results))
+	for i, r := range results {
+		doc, found := db.Document{}, false
+		if getter != nil {
+			doc, found = getter.Get(r.DocID)
+		}
+		if found {
+			embs[i] = doc.Embedding
+		} else {
+			embs[i] = coll.embedder.Embed(r.Text)
+		}
+		parents[i] = r.DocID
+		if p := r.Metadata[metaChunkOf]; p != "" {
+			parents[i] = p
+		}
+		relevance[i] = r.Score
+	}
+
+	similarity := func(i, j int) float32 {
+		sim := relay.CosineSimilarity(embs[i], embs[j])
+		if parents[i] == parents[j] && sim < sameDocSimilarity {
+			sim = sameDocSimilarity
+		}
+		return sim
+	}
+
+	picked := relay.MMR(relevance, similarity, limit, lambda)
+	out := make([]db.SearchResult, len(picked))
+	for i, idx := range picked {
+		out[i] = results[idx]
+	}
+	return out
+}
+
+// diversityMode extends a coalescing mode with the MMR lambda, so
+// diversified and plain results aren't shared
+func diversityMode(mode string, lambda float32) string {
+	if lambda == 0 {
+		return mode
+	}
+	return fmt.Sprintf("%s+mmr=%g", mode, lambda)
+}
@@ -0,0 +1,48 @@
+package httpapi
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+	"github.com/dsjohal14/selfstack/internal/relay"
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+)
+
+func TestDiversifySkipsSameDocumentChunks(t *testing.T) {
+	store, _ := setupWALTestHandler(t)
+	handler := NewHandler(store, obs.Logger("test"))
+	coll, _, _ := handler.loadCollection(context.Background(), db.DefaultCollection)
+
+	results := []db.SearchResult{
+		{DocID: "a:chunk:1", Score: 0.9, Text: "first chunk", Metadata: map[string]string{metaChunkOf: "a"}},
+		{DocID: "a:chunk:2", Score: 0.89, Text: "second chunk", Metadata: map[string]string{metaChunkOf: "a"}},
+		{DocID: "b", Score: 0.8, Text: "another document"},
+	}
+	for _, r := range results {
+		if err := store.Add(db.Document{ID: r.DocID, Text: r.Text, Metadata: r.Metadata, Embedding: relay.DeterministicEmbed(r.Text)}); err != nil {
+			t.Fatalf("add failed: %v", err)
+		}
+	}
+
+	if got := handler.diversify(coll, results, 2, 0); got[1].DocID != "a:chunk:2" {
+		t.Errorf("expected results unchanged without MMR, got %v", got)
+	}
+	if got := handler.diversify(coll, results, 2, 0.5); len(got) != 2 || got[0].DocID != "a:chunk:1" || got[1].DocID != "b" {
+		t.Errorf("expected the second chunk skipped for b, got %+v", got)
+	}
+}
+
+func TestMMRLambdaValidation(t *testing.T) {
+	_, router := setupWALTestHandler(t)
+	for _, path := range []string{"/search", "/run"} {
+		w := doJSON(router, http.MethodPost, path, map[string]any{"query": "x", "diversify": true, "mmr_lambda": 1.5})
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400 for mmr_lambda 1.5, got %d", path, w.Code)
+		}
+		if w := doJSON(router, http.MethodPost, path, map[string]any{"query": "x", "diversify": true}); w.Code != http.StatusOK {
+			t.Errorf("%s: expected 200 with the default lambda, got %d %s", path, w.Code, w.Body.String())
+		}
+	}
+}
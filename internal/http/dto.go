@@ -1,12 +1,63 @@
 // Package httpapi provides HTTP handlers and data transfer objects for the Selfstack API.
 package httpapi
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/capacity"
+	"github.com/dsjohal14/selfstack/internal/libs/diag"
+	"github.com/dsjohal14/selfstack/internal/libs/flags"
+	"github.com/dsjohal14/selfstack/internal/libs/slo"
+	"github.com/dsjohal14/selfstack/internal/libs/supervise"
+	"github.com/dsjohal14/selfstack/internal/scope/analytics"
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+	"github.com/dsjohal14/selfstack/internal/scope/db/wal"
+)
 
 // HealthResponse represents the health check response
 type HealthResponse struct {
-	Status   string `json:"status"`
-	DocCount int    `json:"doc_count"`
+	Status       string          `json:"status"` // healthy, or degraded after a recovered panic
+	DocCount     int             `json:"doc_count"`
+	Capabilities db.Capabilities `json:"capabilities"`
+	Panics       int             `json:"panics,omitempty"`     // Recovered since startup
+	LastPanic    *diag.Bundle    `json:"last_panic,omitempty"` // Its diagnostic bundle
+}
+
+// VersionResponse is the build and instance a server is running
+type VersionResponse struct {
+	Version    string `json:"version"`    // Semver of the release, or "dev"
+	Commit     string `json:"commit"`     // Git SHA
+	BuildTime  string `json:"build_time"` // RFC 3339
+	GoVersion  string `json:"go_version"`
+	InstanceID string `json:"instance_id,omitempty"` // Persisted in DATA_DIR/instance_id
+}
+
+// ReadyResponse is the readiness status; Warmup is omitted if none ran
+type ReadyResponse struct {
+	Ready      bool               `json:"ready"`
+	Warmup     *WarmupReport      `json:"warmup,omitempty"`
+	Background []supervise.Status `json:"background,omitempty"` // Supervised background loops
+}
+
+// WarmupReport describes the startup warmup
+type WarmupReport struct {
+	Status    string         `json:"status"` // warming or ready
+	StartedAt time.Time      `json:"started_at"`
+	TotalMS   float64        `json:"total_ms"`
+	EmbedMS   float64        `json:"embed_ms"`  // Priming collection embedders
+	ScanMS    float64        `json:"scan_ms"`   // Touching every stored vector
+	Documents int            `json:"documents"` // Documents scanned
+	Embedders int            `json:"embedders"` // Collections whose embedder was primed
+	Canaries  []CanaryResult `json:"canaries,omitempty"`
+	Errors    []string       `json:"errors,omitempty"`
+}
+
+// CanaryResult is one warmup canary query
+type CanaryResult struct {
+	Query   string  `json:"query"`
+	Results int     `json:"results"`
+	TookMS  float64 `json:"took_ms"`
 }
 
 // IngestRequest represents document ingestion request
@@ -18,6 +69,76 @@ type IngestRequest struct {
 	Text      string            `json:"text"`   // Full text content
 	Metadata  map[string]string `json:"metadata,omitempty"`
 	CreatedAt time.Time         `json:"created_at,omitempty"` // Auto-set if not provided
+
+	Collection string `json:"collection,omitempty"` // Target collection (default: "default")
+
+	// Consistency is fsync, batched, or async (default: the WAL sync policy)
+	Consistency string `json:"consistency,omitempty"`
+
+	// Priority is interactive or bulk (default: the API key's priority).
+	// Bulk ingests are queued and written in batches when the server is idle.
+	Priority string `json:"priority,omitempty"`
+
+	// Aliases are stable external keys, like a URL or file path, that
+	// resolve to this document at /resolve. Each is taken from any document
+	// it pointed at before.
+	Aliases []string `json:"aliases,omitempty"`
+
+	// OpID identifies the ingest so a retry, e.g. after a timeout, isn't
+	// written again (default: the Idempotency-Key header). Retries with
+	// the same ID are recognized for WAL_DEDUP_WINDOW.
+	OpID string `json:"op_id,omitempty"`
+}
+
+// ResolveResponse is the document an alias points at
+type ResolveResponse struct {
+	Alias    string            `json:"alias"`
+	ID       string            `json:"id"`
+	Document *DocumentResponse `json:"document,omitempty"` // Null if the document is gone or can't be looked up
+}
+
+// DocumentResponse is a stored document (without its embedding)
+type DocumentResponse struct {
+	ID        string            `json:"id"`
+	Source    string            `json:"source"`
+	Title     string            `json:"title"`
+	Text      string            `json:"text"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+
+	Collection string `json:"collection"`
+
+	Embedding []float32 `json:"embedding,omitempty"` // Only with include_embedding
+}
+
+// DeletedDocumentResponse is a deleted document still recorded in the WAL
+type DeletedDocumentResponse struct {
+	ID         string     `json:"id"`
+	DeletedAt  *time.Time `json:"deleted_at"`           // Null for deletes made before it was recorded
+	DeletedBy  string     `json:"deleted_by,omitempty"` // Set once deletes are attributed
+	Restorable bool       `json:"restorable"`           // False once compaction dropped the last version
+	Source     string     `json:"source,omitempty"`
+	Title      string     `json:"title,omitempty"`
+	Collection string     `json:"collection,omitempty"`
+}
+
+// DeletedListResponse lists recently deleted documents
+type DeletedListResponse struct {
+	Documents []DeletedDocumentResponse `json:"documents"`
+	Count     int                       `json:"count"`
+}
+
+// MoveRequest gives a document a new ID, collection, or both; empty fields
+// keep the current value
+type MoveRequest struct {
+	ID         string `json:"id,omitempty"`
+	Collection string `json:"collection,omitempty"`
+}
+
+// DeleteResponse represents a delete response
+type DeleteResponse struct {
+	ID      string `json:"id"`
+	Success bool   `json:"success"`
 }
 
 // IngestResponse represents ingestion response
@@ -25,12 +146,80 @@ type IngestResponse struct {
 	ID      string `json:"id"`
 	Success bool   `json:"success"`
 	Message string `json:"message,omitempty"`
+	Chunks  int    `json:"chunks,omitempty"` // Set when the collection chunked the document
+
+	// The stored version already has this content and metadata, so nothing
+	// was written
+	Unchanged bool `json:"unchanged,omitempty"`
+
+	// The ingest was queued at bulk priority and will be written later
+	Queued bool `json:"queued,omitempty"`
+
+	// An ingest with the same op_id was already written, so nothing was
+	// written again
+	Replayed bool `json:"replayed,omitempty"`
+}
+
+// BulkStatusResponse reports the bulk ingest queue
+type BulkStatusResponse struct {
+	Queued       int   `json:"queued"`
+	QueueSize    int   `json:"queue_size"`
+	OldestWaitMS int64 `json:"oldest_wait_ms,omitempty"` // How long the next ingest has been queued
+	Written      int64 `json:"written"`                  // Since startup
+	Failed       int64 `json:"failed"`                   // Since startup; see the log for why
+	Idle         bool  `json:"idle"`                     // No interactive ingests are running, so batches are being written
+}
+
+// BackfillResponse reports a backfill
+type BackfillResponse struct {
+	Documents  int             `json:"documents"` // Stored, before chunking
+	Records    int             `json:"records"`   // WAL records written, counting every chunk
+	Failed     int             `json:"failed"`    // Skipped as invalid
+	Errors     []BackfillError `json:"errors,omitempty"`
+	Bytes      int64           `json:"bytes"` // WAL payload bytes written
+	Syncs      int             `json:"syncs"`
+	WriteMS    float64         `json:"write_ms"`
+	IndexMS    float64         `json:"index_ms"`
+	DocsPerSec float64         `json:"docs_per_sec"`
+	Error      string          `json:"error,omitempty"` // Why the load stopped early; what was written is kept
+}
+
+// BackfillError is a document a backfill skipped
+type BackfillError struct {
+	Document int    `json:"document"` // Position in the stream, from 1
+	ID       string `json:"id,omitempty"`
+	Error    string `json:"error"`
+	Code     string `json:"code"`
 }
 
 // SearchRequest represents search request
 type SearchRequest struct {
 	Query string `json:"query"`
 	Limit int    `json:"limit,omitempty"` // Default: 10
+
+	// Vector searches by a raw embedding from the client's own pipeline
+	// instead of embedding Query, which is then optional and only used to
+	// rerank. It must have the index's dimension and is normalized.
+	Vector []float32 `json:"vector,omitempty"`
+
+	Mode  string `json:"mode,omitempty"`  // semantic (default) or keyword
+	Debug bool   `json:"debug,omitempty"` // Include a timing breakdown in the response
+
+	Collection string `json:"collection,omitempty"` // Selects the embedder and reranker (default: "default")
+
+	// Diversify selects results by Maximal Marginal Relevance so
+	// near-duplicates don't fill the top slots; MMRLambda trades relevance
+	// (1) for diversity (0) and defaults to 0.7
+	Diversify bool    `json:"diversify,omitempty"`
+	MMRLambda float32 `json:"mmr_lambda,omitempty"`
+
+	// MinScore drops results scoring below it; 0 uses the collection's
+	// min_score in semantic mode
+	MinScore float32 `json:"min_score,omitempty"`
+
+	// IncludeEmbedding returns each result's stored embedding, for API
+	// keys listed in EMBEDDING_EXPORT_KEYS
+	IncludeEmbedding bool `json:"include_embedding,omitempty"`
 }
 
 // SearchResult represents a single search result with score
@@ -42,6 +231,10 @@ type SearchResult struct {
 	Source    string            `json:"source"`
 	Metadata  map[string]string `json:"metadata,omitempty"`
 	CreatedAt time.Time         `json:"created_at"`
+
+	Collection string `json:"collection"`
+
+	Embedding []float32 `json:"embedding,omitempty"` // Only with include_embedding
 }
 
 // SearchResponse represents search results
@@ -49,11 +242,84 @@ type SearchResponse struct {
 	Results []SearchResult `json:"results"`
 	Count   int            `json:"count"`
 	Query   string         `json:"query"`
+	Timings *Timings       `json:"timings,omitempty"` // Only with debug: true
+
+	FailedShards []string `json:"failed_shards,omitempty"` // Shards whose results are missing (sharded deployments)
+}
+
+// SimilarResponse lists the documents most like a stored one
+type SimilarResponse struct {
+	DocID   string         `json:"doc_id"`
+	Results []SearchResult `json:"results"`
+	Count   int            `json:"count"`
+}
+
+// RetrieveRequest is a /retrieve request, in the shape retriever plugins
+// of RAG frameworks send
+type RetrieveRequest struct {
+	Query      string  `json:"query"`
+	TopK       int     `json:"top_k,omitempty"` // Default: 4, max: 100
+	Collection string  `json:"collection,omitempty"`
+	Mode       string  `json:"mode,omitempty"`      // semantic (default) or keyword
+	MinScore   float32 `json:"min_score,omitempty"` // As in SearchRequest
+}
+
+// RetrievedDocument is a scored chunk in the shape of a LangChain Document
+// or LlamaIndex node: its text, and metadata that includes its parent
+// document and a source URI
+type RetrievedDocument struct {
+	ID          string            `json:"id"`
+	PageContent string            `json:"page_content"`
+	Score       float32           `json:"score"` // Relevance, higher is better
+	Metadata    map[string]string `json:"metadata"`
+}
+
+// RetrieveResponse lists the retrieved documents, best first
+type RetrieveResponse struct {
+	Query     string              `json:"query"`
+	Documents []RetrievedDocument `json:"documents"`
+
+	FailedShards []string `json:"failed_shards,omitempty"`
 }
 
 // RunRequest represents agent run request
 type RunRequest struct {
 	Query string `json:"query"`
+	Debug bool   `json:"debug,omitempty"` // Include a timing breakdown in the response
+
+	Collection string `json:"collection,omitempty"` // Selects the embedder and reranker (default: "default")
+
+	// CitationStyle is list (default), inline ([1] markers after each
+	// claim), or footnote ([^1] markers and a footnote per source)
+	CitationStyle string `json:"citation_style,omitempty"`
+
+	Diversify bool    `json:"diversify,omitempty"`  // As for /search
+	MMRLambda float32 `json:"mmr_lambda,omitempty"` // As for /search
+
+	// MinScore drops citations scoring below it (0 uses the collection's
+	// min_score); with none left the answer says no documents are relevant
+	MinScore float32 `json:"min_score,omitempty"`
+
+	// Strategy is single (default) or multi_query, which also searches
+	// rule-based reformulations of the query and fuses the results
+	Strategy string `json:"strategy,omitempty"`
+
+	// Limit is the most citations the answer is composed from (default 3,
+	// max 20), after chunks of one document and near-identical texts are
+	// folded into a single citation
+	Limit int `json:"limit,omitempty"`
+
+	// NoCache composes a fresh answer even if ANSWER_CACHE_TTL is set and
+	// the question was answered against the same index, without caching it
+	NoCache bool `json:"no_cache,omitempty"`
+}
+
+// CitationMarker maps a marker in the answer to the citation it refers to
+type CitationMarker struct {
+	Marker   string `json:"marker"`   // e.g. "[1]" or "[^1]"
+	Citation int    `json:"citation"` // Index into citations
+	DocID    string `json:"doc_id"`
+	Offset   int    `json:"offset"` // Byte offset of the marker in the answer
 }
 
 // Citation represents a cited document in the answer
@@ -64,13 +330,100 @@ type Citation struct {
 	Text      string  `json:"text"`
 	Source    string  `json:"source"`
 	Relevance string  `json:"relevance,omitempty"` // Why this doc was cited
+
+	ChunkOf    string `json:"chunk_of,omitempty"`   // Document the cited chunk was split from
+	Duplicates int    `json:"duplicates,omitempty"` // Other chunks of the document, or near-identical results, folded into this citation
 }
 
 // RunResponse represents agent response with citations
 type RunResponse struct {
-	Answer    string     `json:"answer"`
-	Citations []Citation `json:"citations"`
-	Query     string     `json:"query"`
+	Answer    string           `json:"answer"`
+	Citations []Citation       `json:"citations"`
+	Markers   []CitationMarker `json:"markers,omitempty"` // Inline and footnote styles only
+	Query     string           `json:"query"`
+	Timings   *Timings         `json:"timings,omitempty"` // Only with debug: true
+	Cached    bool             `json:"cached,omitempty"`  // Answered from the answer cache or an identical run in flight
+
+	SubQueries []string `json:"sub_queries,omitempty"` // Queries searched; debug with multi_query only
+}
+
+// Timings is the server-side latency breakdown of a search or run
+type Timings struct {
+	EmbedMS    float64 `json:"embed_ms"`
+	ScanMS     float64 `json:"scan_ms"`
+	RerankMS   float64 `json:"rerank_ms"`
+	GenerateMS float64 `json:"generate_ms,omitempty"` // Run only
+	TotalMS    float64 `json:"total_ms"`
+	Candidates int     `json:"candidates"`       // Documents in the scanned index
+	Shards     int     `json:"shards"`           // Index shards queried
+	Shared     bool    `json:"shared,omitempty"` // Answered by an identical concurrent or cached request
+}
+
+// CollectionResponse is a collection config with its document count
+type CollectionResponse struct {
+	db.CollectionConfig
+	Documents int `json:"documents"`
+}
+
+// CollectionListResponse lists the collections
+type CollectionListResponse struct {
+	Collections []CollectionResponse `json:"collections"`
+	Count       int                  `json:"count"`
+}
+
+// SegmentEventsResponse represents the segment lifecycle audit trail
+type SegmentEventsResponse struct {
+	Events []wal.SegmentEvent `json:"events"`
+	Count  int                `json:"count"`
+}
+
+// ChangelogEntry is one line of /admin/changelog: a change to a document or
+// collection, or the line that ends the stream
+type ChangelogEntry struct {
+	LSN   uint64     `json:"lsn,omitempty"`
+	Op    string     `json:"op"`              // insert, update, delete, collection, collection_delete, or embedder_change; end or error last
+	At    *time.Time `json:"at,omitempty"`    // When it was written; absent for records from before timestamps
+	Batch bool       `json:"batch,omitempty"` // More changes of its atomic batch follow; apply them together
+
+	DocID      string            `json:"doc_id,omitempty"`
+	Collection string            `json:"collection,omitempty"` // The document's, or the one a collection op changes
+	Source     string            `json:"source,omitempty"`
+	Title      string            `json:"title,omitempty"`
+	Text       string            `json:"text,omitempty"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+	CreatedAt  *time.Time        `json:"created_at,omitempty"`
+	Embedding  []float32         `json:"embedding,omitempty"` // Only with include_embeddings
+	DeletedAt  *time.Time        `json:"deleted_at,omitempty"`
+	DeletedBy  string            `json:"deleted_by,omitempty"`
+
+	Config json.RawMessage `json:"config,omitempty"` // Collection ops: the collection's config
+
+	NextLSN uint64 `json:"next_lsn,omitempty"` // End: the from_lsn to continue from
+	Error   string `json:"error,omitempty"`    // Error: why the stream stopped early
+}
+
+// ChangelogImportResponse reports a changelog import
+type ChangelogImportResponse struct {
+	Applied     int                    `json:"applied"`     // Changes written, or that would be on a dry run
+	Documents   int                    `json:"documents"`   // Inserts and updates among them
+	Deletes     int                    `json:"deletes"`     // Document deletes among them
+	Collections int                    `json:"collections"` // Collection changes and deletes among them
+	Failed      int                    `json:"failed"`      // Skipped as invalid
+	Errors      []ChangelogImportError `json:"errors,omitempty"`
+	LastLSN     uint64                 `json:"last_lsn,omitempty"` // The exporter's LSN of the last line read
+	NextLSN     uint64                 `json:"next_lsn,omitempty"` // From the end line: the from_lsn to export from next
+	DryRun      bool                   `json:"dry_run,omitempty"`
+	Error       string                 `json:"error,omitempty"` // Why the import stopped early; what was written is kept
+}
+
+// ChangelogImportError is a change an import skipped
+type ChangelogImportError struct {
+	Line  int    `json:"line"` // Position in the stream, from 1
+	LSN   uint64 `json:"lsn,omitempty"`
+	Op    string `json:"op"`
+	ID    string `json:"id,omitempty"`
+	Error string `json:"error"`
+	Code  string `json:"code"`
 }
 
 // ErrorResponse represents API error response
@@ -79,3 +432,216 @@ type ErrorResponse struct {
 	Code    string `json:"code,omitempty"`
 	Details string `json:"details,omitempty"`
 }
+
+// Suggestion is a past query offered for type-ahead
+type Suggestion struct {
+	Query    string    `json:"query"`
+	Count    int       `json:"count"` // Times run with results
+	LastUsed time.Time `json:"last_used"`
+}
+
+// SuggestResponse lists query suggestions, best first
+type SuggestResponse struct {
+	Suggestions []Suggestion `json:"suggestions"`
+	Count       int          `json:"count"`
+}
+
+// SetFlagRequest overrides a feature flag
+type SetFlagRequest struct {
+	Enabled *bool `json:"enabled"`
+}
+
+// FlagsResponse lists the feature flags
+type FlagsResponse struct {
+	Flags []flags.State `json:"flags"`
+	Count int           `json:"count"`
+}
+
+// CreateKeyRequest creates an API key
+type CreateKeyRequest struct {
+	Name          string     `json:"name,omitempty"`
+	Namespaces    []string   `json:"namespaces,omitempty"`      // Collections the key may use; omit for all
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`      // Omit (and expires_in_days) for a key that doesn't expire
+	ExpiresInDays int        `json:"expires_in_days,omitempty"` // Instead of expires_at
+}
+
+// UpdateKeyRequest changes an API key; omitted fields are left as they are
+type UpdateKeyRequest struct {
+	Name       *string    `json:"name,omitempty"`
+	Namespaces []string   `json:"namespaces"` // [] allows every collection; null leaves them
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+}
+
+// KeySecretResponse is a new API key with its secret, which is shown only
+// this once
+type KeySecretResponse struct {
+	db.APIKey
+	Secret string `json:"secret"`
+}
+
+// KeyListResponse lists the API keys
+type KeyListResponse struct {
+	Keys  []db.APIKey `json:"keys"`
+	Count int         `json:"count"`
+}
+
+// SetLogLevelRequest changes a module's log level
+type SetLogLevelRequest struct {
+	Level string `json:"level"`
+}
+
+// UsagePeriod is the usage of every key in a period
+type UsagePeriod struct {
+	Period string `json:"period"` // 2006-01, or 2006-01-02 by day
+	db.Usage
+}
+
+// UsageResponse reports metered usage
+type UsageResponse struct {
+	Period string           `json:"period"` // month or day
+	Keys   []db.UsageRecord `json:"keys"`   // Per key and period
+	Global []UsagePeriod    `json:"global"` // Per period
+	Total  db.Usage         `json:"total"`
+}
+
+// SLOResponse reports the latency objectives
+type SLOResponse struct {
+	Objectives []slo.Status `json:"objectives"`
+	Met        bool         `json:"met"` // Every objective is met over its window
+}
+
+// CapacityResponse reports the size of the index and WAL, and their growth
+type CapacityResponse struct {
+	Index       db.IndexSize        `json:"index"`
+	IndexLimit  int64               `json:"index_limit_bytes"` // INDEX_MEMORY_LIMIT_MB in bytes; 0 is unlimited
+	WALBytes    int64               `json:"wal_bytes"`         // Segments on disk
+	WALSegments int                 `json:"wal_segments"`
+	Growth      *capacity.Growth    `json:"growth,omitempty"`     // Omitted until sizes have been sampled twice
+	Projection  *CapacityProjection `json:"projection,omitempty"` // Omitted with growth
+}
+
+// DuplicatesResponse is the latest near-duplicate report
+type DuplicatesResponse struct {
+	GeneratedAt time.Time                  `json:"generated_at"`
+	Threshold   float32                    `json:"threshold"`
+	Scanned     int                        `json:"scanned"` // Documents compared, counting a chunked one once
+	TookMS      float64                    `json:"took_ms"`
+	Groups      []analytics.DuplicateGroup `json:"groups"` // Largest first, the document to keep first in each
+	Count       int                        `json:"count"`
+	Total       int                        `json:"total"` // Groups before limit
+}
+
+// CapacityProjection is the size of the store after Days at the current
+// growth rate
+type CapacityProjection struct {
+	Days        int        `json:"days"`
+	Documents   int64      `json:"documents"`
+	IndexBytes  int64      `json:"index_bytes"`
+	WALBytes    int64      `json:"wal_bytes"`
+	IndexFullAt *time.Time `json:"index_full_at,omitempty"` // When the index reaches its limit; omitted without a limit or growth
+}
+
+// OpenAI-compatible facade; see handlers_openai.go. Fields clients send
+// that Selfstack has no use for, like temperature, are ignored.
+
+// OpenAIEmbeddingRequest is a /v1/embeddings request
+type OpenAIEmbeddingRequest struct {
+	Input          json.RawMessage `json:"input"` // A string or an array of strings
+	Model          string          `json:"model"`
+	EncodingFormat string          `json:"encoding_format,omitempty"` // float (default) or base64
+	Dimensions     int             `json:"dimensions,omitempty"`
+	User           string          `json:"user,omitempty"`
+}
+
+// OpenAIEmbedding is one embedding of a /v1/embeddings response; Embedding
+// is a []float32, or a base64 string of little-endian float32s
+type OpenAIEmbedding struct {
+	Object    string `json:"object"` // Always "embedding"
+	Index     int    `json:"index"`
+	Embedding any    `json:"embedding"`
+}
+
+// OpenAIEmbeddingResponse is a /v1/embeddings response
+type OpenAIEmbeddingResponse struct {
+	Object string            `json:"object"` // Always "list"
+	Data   []OpenAIEmbedding `json:"data"`
+	Model  string            `json:"model"`
+	Usage  OpenAIUsage       `json:"usage"`
+}
+
+// OpenAIUsage is the estimated token usage of a request
+type OpenAIUsage struct {
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens,omitempty"`
+	TotalTokens      int64 `json:"total_tokens"`
+}
+
+// OpenAIChatMessage is a chat message. Content is a string, or an array of
+// parts of which only the text parts are read.
+type OpenAIChatMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+// OpenAIChatRequest is a /v1/chat/completions request
+type OpenAIChatRequest struct {
+	Model    string              `json:"model"`
+	Messages []OpenAIChatMessage `json:"messages"`
+	Stream   bool                `json:"stream,omitempty"`
+	User     string              `json:"user,omitempty"`
+}
+
+// OpenAIReply is the assistant message of a completion, or the part of it
+// a stream chunk adds
+type OpenAIReply struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+// OpenAIChoice is a completion choice; a response has one
+type OpenAIChoice struct {
+	Index        int          `json:"index"`
+	Message      *OpenAIReply `json:"message,omitempty"` // Responses
+	Delta        *OpenAIReply `json:"delta,omitempty"`   // Stream chunks
+	FinishReason *string      `json:"finish_reason"`
+}
+
+// OpenAIChatResponse is a /v1/chat/completions response or stream chunk.
+// Citations, which OpenAI clients ignore, lists the documents the answer
+// was composed from.
+type OpenAIChatResponse struct {
+	ID        string         `json:"id"`
+	Object    string         `json:"object"` // chat.completion or chat.completion.chunk
+	Created   int64          `json:"created"`
+	Model     string         `json:"model"`
+	Choices   []OpenAIChoice `json:"choices"`
+	Usage     *OpenAIUsage   `json:"usage,omitempty"`
+	Citations []Citation     `json:"citations,omitempty"`
+}
+
+// OpenAIModel is a collection listed at /v1/models
+type OpenAIModel struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"` // Always "model"
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+// OpenAIModelList is a /v1/models response
+type OpenAIModelList struct {
+	Object string        `json:"object"` // Always "list"
+	Data   []OpenAIModel `json:"data"`
+}
+
+// OpenAIErrorResponse is an error in the shape OpenAI clients parse
+type OpenAIErrorResponse struct {
+	Error OpenAIError `json:"error"`
+}
+
+// OpenAIError describes an error; Code is the Selfstack error code
+type OpenAIError struct {
+	Message string  `json:"message"`
+	Type    string  `json:"type"`
+	Param   *string `json:"param"`
+	Code    string  `json:"code,omitempty"`
+}
@@ -0,0 +1,112 @@
+package httpapi
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"unsafe"
+
+	"github.com/dsjohal14/selfstack/internal/libs/membudget"
+	"github.com/dsjohal14/selfstack/internal/relay"
+)
+
+// cachedEmbeddingOverhead is the memory of a cache entry beyond its key: the
+// embedding, the list element, and the map entry
+const cachedEmbeddingOverhead = int64(unsafe.Sizeof(cachedEmbedding{})) + 96
+
+// embeddingCache keeps query embeddings so repeated queries skip the
+// embedder, which matters for remote ones. The least recently used are
+// evicted to keep it within its memory budget. A nil cache keeps nothing.
+type embeddingCache struct {
+	budget *membudget.Budget
+
+	mu      sync.Mutex
+	entries map[string]*list.Element // Values are *cachedEmbedding
+	lru     *list.List               // Most recently used first
+}
+
+type cachedEmbedding struct {
+	key   string
+	emb   relay.Embedding
+	bytes int64
+}
+
+// newEmbeddingCache creates a cache bounded by budget, which must have a
+// limit
+func newEmbeddingCache(budget *membudget.Budget) *embeddingCache {
+	return &embeddingCache{
+		budget:  budget,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// embeddingKey identifies the embedding of text by an embedder
+func embeddingKey(e relay.Embedder, text string) string {
+	return fmt.Sprintf("%s\x00%d\x00%s", e.Name(), e.Dimensions(), text)
+}
+
+// get returns the cached embedding for key
+func (c *embeddingCache) get(key string) (relay.Embedding, bool) {
+	if c == nil {
+		return relay.Embedding{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return relay.Embedding{}, false
+	}
+	c.lru.MoveToFront(el)
+	return el.Value.(*cachedEmbedding).emb, true
+}
+
+// put caches emb for key, evicting the least recently used embeddings
+// while the budget is exceeded
+func (c *embeddingCache) put(key string, emb relay.Embedding) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(el)
+		return
+	}
+	e := &cachedEmbedding{key: key, emb: emb, bytes: int64(len(key)) + cachedEmbeddingOverhead}
+	c.entries[key] = c.lru.PushFront(e)
+	c.budget.Add(e.bytes)
+	for c.budget.Exceeded() && c.lru.Len() > 0 {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		evicted := oldest.Value.(*cachedEmbedding)
+		delete(c.entries, evicted.key)
+		c.budget.Add(-evicted.bytes)
+	}
+}
+
+// count returns the number of cached embeddings
+func (c *embeddingCache) count() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// embedQuery embeds a query with the collection's embedder, reusing the
+// cached embedding of the same text. Fallback embeddings aren't cached, so
+// the query is embedded properly once the embedder is back.
+func (c *collection) embedQuery(ctx context.Context, text string) (emb relay.Embedding, fallback string, err error) {
+	key := embeddingKey(c.embedder, text)
+	if emb, ok := c.queries.get(key); ok {
+		return emb, "", nil
+	}
+	emb, fallback, err = c.embed(ctx, text)
+	if err == nil && fallback == "" {
+		c.queries.put(key, emb)
+	}
+	return emb, fallback, err
+}
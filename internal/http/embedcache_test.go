@@ -0,0 +1,63 @@
+package httpapi
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/dsjohal14/selfstack/internal/libs/membudget"
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+	"github.com/dsjohal14/selfstack/internal/relay"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestEmbeddingCacheEvictsWithinBudget(t *testing.T) {
+	// Room for two short keys
+	budget := membudget.New(membudget.ModuleEmbeddingCache, 2*(cachedEmbeddingOverhead+1), nil)
+	c := newEmbeddingCache(budget)
+
+	c.put("a", relay.DeterministicEmbed("a"))
+	c.put("b", relay.DeterministicEmbed("b"))
+	if _, ok := c.get("a"); !ok { // a is now the most recently used
+		t.Fatal("expected a to be cached")
+	}
+	c.put("c", relay.DeterministicEmbed("c"))
+
+	if n := c.count(); n != 2 {
+		t.Errorf("expected 2 cached embeddings, got %d", n)
+	}
+	if _, ok := c.get("b"); ok {
+		t.Error("expected b to be evicted")
+	}
+	if emb, ok := c.get("a"); !ok || emb != relay.DeterministicEmbed("a") {
+		t.Error("expected a to stay cached")
+	}
+	if budget.Exceeded() {
+		t.Errorf("budget exceeded: used %d of %d", budget.Used(), budget.Limit())
+	}
+
+	var none *embeddingCache
+	none.put("a", relay.DeterministicEmbed("a"))
+	if _, ok := none.get("a"); ok {
+		t.Error("a nil cache shouldn't keep anything")
+	}
+}
+
+func TestSearchReusesCachedQueryEmbedding(t *testing.T) {
+	store, _ := setupWALTestHandler(t)
+	budget := membudget.New(membudget.ModuleEmbeddingCache, 1<<20, nil)
+	handler := NewHandler(store, obs.Logger("test"), WithEmbeddingCache(budget))
+	r := chi.NewRouter()
+	r.Post("/search", handler.HandleSearch)
+
+	for i := 0; i < 2; i++ {
+		if w := doJSON(r, http.MethodPost, "/search", SearchRequest{Query: "planning notes", Limit: 5}); w.Code != http.StatusOK {
+			t.Fatalf("search failed: %d %s", w.Code, w.Body.String())
+		}
+	}
+	if n := handler.embeddings.count(); n != 1 {
+		t.Errorf("expected 1 cached embedding, got %d", n)
+	}
+	if budget.Used() == 0 {
+		t.Error("expected the cached embedding to count against the budget")
+	}
+}
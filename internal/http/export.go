@@ -0,0 +1,42 @@
+package httpapi
+
+import (
+	"net/http"
+)
+
+// AnyKey in a key list admits any request sent with a live managed key or a
+// verified client certificate, never one sent with neither
+const AnyKey = "*"
+
+// WithEmbeddingExport lets requests sent with one of keys (see keySet) ask
+// for stored embeddings. Without it embeddings are never returned.
+func WithEmbeddingExport(keys []string) HandlerOption {
+	return func(h *Handler) {
+		h.exportKeys = newKeySet(keys)
+	}
+}
+
+// mayExportEmbeddings reports whether r may be sent embeddings, writing a
+// 403 if not. Requests other shards forward with the shard secret were
+// checked by the node the client called.
+func (h *Handler) mayExportEmbeddings(w http.ResponseWriter, r *http.Request) bool {
+	if h.isHop(r) || h.exportKeys.allows(r) {
+		return true
+	}
+	writeError(w, http.StatusForbidden, "this API key may not export embeddings; list it in EMBEDDING_EXPORT_KEYS", "EMBEDDING_EXPORT_FORBIDDEN")
+	return false
+}
+
+// embeddingOf returns the stored embedding of docID, or nil if the store
+// can't look it up
+func (h *Handler) embeddingOf(docID string) []float32 {
+	getter, ok := h.store.(documentGetter)
+	if !ok {
+		return nil
+	}
+	doc, found := getter.Get(docID)
+	if !found {
+		return nil
+	}
+	return doc.Embedding[:]
+}
@@ -0,0 +1,98 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+	"github.com/dsjohal14/selfstack/internal/relay"
+	"github.com/dsjohal14/selfstack/internal/scope/shard"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestEmbeddingExport(t *testing.T) {
+	store, router := setupWALTestHandler(t)
+	ingestDoc(t, router, IngestRequest{ID: "doc-1", Source: "test", Title: "Hello", Text: "world"})
+
+	sum := sha256.Sum256([]byte("sk-export"))
+	h := NewHandler(store, obs.Logger("test"), WithEmbeddingExport([]string{KeyHashPrefix + hex.EncodeToString(sum[:])}))
+	r := chi.NewRouter()
+	r.Get("/documents/{id}", h.HandleGetDocument)
+	r.Post("/search", h.HandleSearch)
+
+	send := func(method, path, key string, body any) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewReader(data))
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	want := relay.DeterministicEmbed("world")
+
+	w := send(http.MethodGet, "/documents/doc-1?include_embedding=true", "sk-export", nil)
+	var doc DocumentResponse
+	_ = json.NewDecoder(w.Body).Decode(&doc)
+	if w.Code != http.StatusOK || len(doc.Embedding) != relay.EmbeddingDim || doc.Embedding[0] != want[0] {
+		t.Fatalf("expected the stored embedding, got %d %+v", w.Code, doc)
+	}
+
+	w = send(http.MethodPost, "/search", "sk-export", SearchRequest{Query: "world", IncludeEmbedding: true})
+	var resp SearchResponse
+	_ = json.NewDecoder(w.Body).Decode(&resp)
+	if w.Code != http.StatusOK || resp.Count != 1 || len(resp.Results[0].Embedding) != relay.EmbeddingDim {
+		t.Fatalf("expected a result with its embedding, got %d %+v", w.Code, resp)
+	}
+
+	// Embeddings are left out unless asked for, and other keys may not ask
+	w = send(http.MethodGet, "/documents/doc-1", "sk-other", nil)
+	doc = DocumentResponse{}
+	_ = json.NewDecoder(w.Body).Decode(&doc)
+	if w.Code != http.StatusOK || doc.Embedding != nil {
+		t.Errorf("expected no embedding, got %d %+v", w.Code, doc)
+	}
+	if w := send(http.MethodGet, "/documents/doc-1?include_embedding=true", "sk-other", nil); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for another key, got %d", w.Code)
+	}
+	if w := send(http.MethodPost, "/search", "", SearchRequest{Query: "world", IncludeEmbedding: true}); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 without a key, got %d", w.Code)
+	}
+	// Claiming to be another shard doesn't get around the key list, on a
+	// sharded node either, unless the shard secret proves it
+	table, _ := shard.EvenTable([]shard.Shard{{ID: "a", URL: "http://a"}})
+	shards, err := shard.NewRouter(context.Background(), "a", testShardSecret, staticRoutes{table}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sharded := chi.NewRouter()
+	sharded.Get("/documents/{id}", NewHandler(store, obs.Logger("test"), WithSharding(shards)).HandleGetDocument)
+	for name, tc := range map[string]struct {
+		handler http.Handler
+		secret  string
+		want    int
+	}{
+		"unsharded":   {r, "", http.StatusForbidden},
+		"no secret":   {sharded, "", http.StatusForbidden},
+		"with secret": {sharded, testShardSecret, http.StatusOK},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/documents/doc-1?include_embedding=true", nil)
+		req.Header.Set(shard.HopHeader, "b")
+		if tc.secret != "" {
+			req.Header.Set(shard.SecretHeader, tc.secret)
+		}
+		w := httptest.NewRecorder()
+		tc.handler.ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Errorf("%s: expected %d for a hop, got %d", name, tc.want, w.Code)
+		}
+	}
+}
@@ -3,23 +3,198 @@ package httpapi
 import (
 	"encoding/json"
 	"net/http"
+	"sync/atomic"
+	"time"
 
+	"github.com/dsjohal14/selfstack/internal/libs/access"
+	"github.com/dsjohal14/selfstack/internal/libs/buildinfo"
+	"github.com/dsjohal14/selfstack/internal/libs/capacity"
+	"github.com/dsjohal14/selfstack/internal/libs/chaos"
+	"github.com/dsjohal14/selfstack/internal/libs/diag"
+	"github.com/dsjohal14/selfstack/internal/libs/flags"
+	"github.com/dsjohal14/selfstack/internal/libs/membudget"
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+	"github.com/dsjohal14/selfstack/internal/libs/slo"
+	"github.com/dsjohal14/selfstack/internal/libs/supervise"
+	"github.com/dsjohal14/selfstack/internal/scope/analytics"
 	"github.com/dsjohal14/selfstack/internal/scope/db"
+	"github.com/dsjohal14/selfstack/internal/scope/ingest"
+	"github.com/dsjohal14/selfstack/internal/scope/shard"
 	"github.com/rs/zerolog"
 )
 
 // Handler contains HTTP handlers for the API
 type Handler struct {
 	store  db.Storage
+	caps   db.Capabilities
 	logger zerolog.Logger
+
+	slowOpThreshold time.Duration   // 0 disables the slow op log
+	slowOps         *obs.CounterVec // Slow searches/runs by op
+
+	collections db.CollectionRegistry // Per-collection settings; nil means only the default collection
+	hooks       *ingest.Hooks         // Pre/post-ingest hooks
+
+	searchCache *resultCache[[]db.SearchResult] // Coalesces identical searches
+	runCache    *resultCache[[]db.SearchResult] // Coalesces identical runs
+	answerCache *resultCache[runAnswer]         // Composed run answers; nil caches none
+	writeGen    atomic.Uint64                   // Bumped on every write; invalidates cached results
+	coalesced   *obs.CounterVec                 // Searches/runs answered by a shared result
+	answers     *obs.CounterVec                 // Run answers by answer cache outcome
+
+	resultBudget *membudget.Budget // Caps the memory of both result caches; nil for no cap
+	embeddings   *embeddingCache   // Query embeddings; nil caches none
+
+	warmup warmupState // Startup warmup progress for /readyz
+
+	shards *shard.Router // Routes ingests and fans out searches; nil when not sharded
+
+	queries *db.QueryLog // Recent and popular queries for /suggest; nil disables it
+
+	aliases *db.AliasTable // External keys of documents for /resolve; nil ignores aliases
+
+	usage *db.UsageLog // Usage per API key for /admin/usage; nil disables metering
+
+	slos *slo.Tracker // Latency objectives for /admin/slo; nil measures none
+
+	capacity *capacity.Tracker // Growth of the index and WAL for /admin/capacity; nil reports none
+
+	duplicates *analytics.Duplicates // Near-duplicate report for /analytics/duplicates; nil disables it
+
+	shed *shedder // Rejects requests under overload; nil never sheds
+
+	chaos       *chaos.Injector // Faults injected for testing clients; nil injects none
+	chaosFaults *obs.CounterVec // Injected faults by kind
+
+	bulk *bulkQueue // Bulk ingests waiting for an idle moment; nil writes them at once
+
+	exportKeys keySet // Clients that may ask for stored embeddings
+	resetKeys  keySet // Clients that may wipe the store
+
+	keys         *db.APIKeyStore // Managed API keys; nil checks none
+	keyAdmins    keySet          // Clients that may manage them
+	keysRequired bool            // Refuse requests without a live managed key or an admin key
+
+	ipAllowlist    *access.Allowlist // Addresses allowed per route; nil allows all
+	clientCerts    bool              // Identify requests by their verified client certificate
+	certPrincipals map[string]string // Client certificate CNs mapped to principals; empty uses the CN
+
+	flags *flags.Set // Gates risky subsystems
+
+	build buildinfo.Info // Reported at /version
+
+	diag *diag.Collector // Captures panics; its bundles flag /health
+
+	supervisor *supervise.Supervisor // Background loops reported at /readyz; nil reports none
+}
+
+// HandlerOption configures a Handler
+type HandlerOption func(*Handler)
+
+// WithSlowOpThreshold logs and counts searches/runs slower than d (0 disables)
+func WithSlowOpThreshold(d time.Duration) HandlerOption {
+	return func(h *Handler) {
+		h.slowOpThreshold = d
+	}
+}
+
+// WithMetrics registers handler metrics in reg instead of obs.DefaultRegistry
+func WithMetrics(reg *obs.Registry) HandlerOption {
+	return func(h *Handler) {
+		h.slowOps = newSlowOpsCounter(reg)
+		h.coalesced = newCoalescedCounter(reg)
+		h.answers = newAnswerCacheCounter(reg)
+	}
+}
+
+// WithResultCache keeps up to size results of op ("search", "run", or
+// "answer") for ttl after they are computed, evicting the least recently
+// used. Identical concurrent searches and runs are coalesced regardless;
+// answers are only cached with a ttl. Cached results stop matching once a
+// write advances the store's index watermark.
+func WithResultCache(op string, ttl time.Duration, size int) HandlerOption {
+	return func(h *Handler) {
+		switch op {
+		case "search":
+			h.searchCache = newResultCache[[]db.SearchResult](ttl, size)
+		case "run":
+			h.runCache = newResultCache[[]db.SearchResult](ttl, size)
+		case "answer":
+			h.answerCache = nil
+			if ttl > 0 {
+				h.answerCache = newResultCache[runAnswer](ttl, size)
+			}
+		}
+	}
+}
+
+// WithResultCacheBudget evicts cached search results, run results, and
+// answers, least recently used first, while b is exceeded. The caches
+// share b.
+func WithResultCacheBudget(b *membudget.Budget) HandlerOption {
+	return func(h *Handler) {
+		h.resultBudget = b
+	}
+}
+
+// WithEmbeddingCache caches query embeddings within b, evicting the least
+// recently used. b needs a limit; without this option nothing is cached.
+func WithEmbeddingCache(b *membudget.Budget) HandlerOption {
+	return func(h *Handler) {
+		h.embeddings = newEmbeddingCache(b)
+	}
+}
+
+// WithCollections resolves and manages per-collection settings in reg
+func WithCollections(reg db.CollectionRegistry) HandlerOption {
+	return func(h *Handler) {
+		h.collections = reg
+	}
+}
+
+// WithSupervisor reports the loops sup runs at /readyz, which fails once
+// one of them is given up on
+func WithSupervisor(sup *supervise.Supervisor) HandlerOption {
+	return func(h *Handler) {
+		h.supervisor = sup
+	}
+}
+
+// WithIngestHooks runs hooks on ingest instead of the ones registered with
+// ingest.RegisterPreIngestHook/RegisterPostIngestHook
+func WithIngestHooks(hooks *ingest.Hooks) HandlerOption {
+	return func(h *Handler) {
+		h.hooks = hooks
+	}
 }
 
 // NewHandler creates a new HTTP handler
-func NewHandler(store db.Storage, logger zerolog.Logger) *Handler {
-	return &Handler{
-		store:  store,
-		logger: logger,
+func NewHandler(store db.Storage, logger zerolog.Logger, opts ...HandlerOption) *Handler {
+	h := &Handler{
+		store:   store,
+		caps:    db.CapabilitiesOf(store),
+		logger:  logger,
+		slowOps: newSlowOpsCounter(obs.DefaultRegistry),
+		hooks:   ingest.Default(),
+		flags:   flags.Defaults(),
+		build:   buildinfo.Get(),
+		diag:    diag.Default,
+
+		searchCache: newResultCache[[]db.SearchResult](0, 0),
+		runCache:    newResultCache[[]db.SearchResult](0, 0),
+		coalesced:   newCoalescedCounter(obs.DefaultRegistry),
+		answers:     newAnswerCacheCounter(obs.DefaultRegistry),
+	}
+	h.warmup.report.Status = WarmupPending
+	for _, opt := range opts {
+		opt(h)
+	}
+	h.searchCache.setBudget(h.resultBudget, searchResultsBytes)
+	h.runCache.setBudget(h.resultBudget, searchResultsBytes)
+	if h.answerCache != nil {
+		h.answerCache.setBudget(h.resultBudget, runAnswerBytes)
 	}
+	return h
 }
 
 // Helper functions used across all handlers
@@ -0,0 +1,152 @@
+package httpapi
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+	"github.com/dsjohal14/selfstack/internal/scope/db/wal"
+)
+
+// walStore returns the WAL-backed store, writing a 501 if the configured
+// backend doesn't support WAL admin operations
+func (h *Handler) walStore(w http.ResponseWriter) (*db.WALStore, bool) {
+	ws, ok := h.store.(*db.WALStore)
+	if !ok || !h.caps.SegmentAdmin {
+		writeError(w, http.StatusNotImplemented, "operation requires the WAL storage backend", "NOT_SUPPORTED")
+		return nil, false
+	}
+	return ws, true
+}
+
+// HandleSegmentEvents returns the segment lifecycle audit trail
+// Query params: segment_id, segment_type (wal|cmp), since (RFC3339), limit
+func (h *Handler) HandleSegmentEvents(w http.ResponseWriter, r *http.Request) {
+	ws, ok := h.walStore(w)
+	if !ok {
+		return
+	}
+
+	q := r.URL.Query()
+	var filter wal.SegmentEventFilter
+
+	if v := q.Get("segment_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "segment_id must be a positive integer", "INVALID_PARAM")
+			return
+		}
+		filter.SegmentID = &id
+	}
+
+	switch t := wal.SegmentType(q.Get("segment_type")); t {
+	case "", wal.SegmentTypeWAL, wal.SegmentTypeCompacted:
+		filter.SegmentType = t
+	default:
+		writeError(w, http.StatusBadRequest, "segment_type must be wal or cmp", "INVALID_PARAM")
+		return
+	}
+
+	if v := q.Get("since"); v != "" {
+		since, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "since must be an RFC3339 timestamp", "INVALID_PARAM")
+			return
+		}
+		filter.Since = since
+	}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			writeError(w, http.StatusBadRequest, "limit must be a non-negative integer", "INVALID_PARAM")
+			return
+		}
+		if limit > 1000 {
+			limit = 1000 // Max limit for performance
+		}
+		filter.Limit = limit
+	}
+
+	events, err := ws.SegmentEvents(r.Context(), filter)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to load segment events")
+		writeError(w, http.StatusInternalServerError, "failed to load segment events", "MANIFEST_ERROR")
+		return
+	}
+	if events == nil {
+		events = []wal.SegmentEvent{}
+	}
+
+	writeJSON(w, http.StatusOK, SegmentEventsResponse{
+		Events: events,
+		Count:  len(events),
+	})
+}
+
+// HandleCompactionPlan previews what a compaction run would do
+// Query params: force=true previews a forced compaction of all sealed segments
+func (h *Handler) HandleCompactionPlan(w http.ResponseWriter, r *http.Request) {
+	ws, ok := h.walStore(w)
+	if !ok {
+		return
+	}
+
+	force := r.URL.Query().Get("force") == "true"
+	plan, err := ws.CompactionPlan(r.Context(), force)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to plan compaction")
+		writeError(w, http.StatusInternalServerError, "failed to plan compaction", "COMPACTION_ERROR")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, plan)
+}
+
+// HandleCompact forces a compaction of all sealed WAL segments
+func (h *Handler) HandleCompact(w http.ResponseWriter, r *http.Request) {
+	ws, ok := h.walStore(w)
+	if !ok {
+		return
+	}
+	if !h.caps.Compaction {
+		writeError(w, http.StatusConflict, "compaction is not enabled", "COMPACTION_DISABLED")
+		return
+	}
+
+	ctx := wal.WithSegmentActor(r.Context(), wal.ActorAdmin, "forced via admin API")
+	if err := ws.ForceCompaction(ctx); err != nil {
+		h.logger.Error().Err(err).Msg("forced compaction failed")
+		writeError(w, http.StatusInternalServerError, "compaction failed", "COMPACTION_ERROR")
+		return
+	}
+
+	h.logger.Info().Msg("forced compaction completed")
+	writeJSON(w, http.StatusOK, map[string]bool{"success": true})
+}
+
+// HandleGC quarantines orphaned files in the WAL directory and deletes the
+// ones past their grace period, or with dry_run=true reports what it would do
+func (h *Handler) HandleGC(w http.ResponseWriter, r *http.Request) {
+	ws, ok := h.walStore(w)
+	if !ok {
+		return
+	}
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+	report, err := ws.CollectGarbage(r.Context(), dryRun)
+	if report == nil {
+		h.logger.Error().Err(err).Msg("WAL garbage collection failed")
+		writeError(w, http.StatusInternalServerError, "garbage collection failed", "GC_ERROR")
+		return
+	}
+	// Files that couldn't be moved are left for the next pass
+	if err != nil {
+		h.logger.Warn().Err(err).Msg("WAL garbage collection skipped files")
+	}
+	if !dryRun {
+		h.logger.Info().Int("quarantined", len(report.Quarantined)).Int("deleted", len(report.Deleted)).
+			Int64("reclaimed_bytes", report.ReclaimedBytes).Msg("WAL garbage collection completed")
+	}
+	writeJSON(w, http.StatusOK, report)
+}
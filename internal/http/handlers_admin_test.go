@@ -0,0 +1,239 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+	"github.com/dsjohal14/selfstack/internal/scope/db/wal"
+	"github.com/go-chi/chi/v5"
+)
+
+func setupWALTestHandler(t *testing.T, mutate ...func(*db.WALStoreConfig)) (*db.WALStore, *chi.Mux) {
+	t.Helper()
+	config := db.DefaultWALStoreConfig(t.TempDir())
+	config.SyncPolicy = wal.ImmediateSyncPolicy()
+	for _, fn := range mutate {
+		fn(&config)
+	}
+
+	store, err := db.NewWALStore(context.Background(), config)
+	if err != nil {
+		t.Fatalf("failed to create WAL store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	obs.InitLogger("error")
+	handler := NewHandler(store, obs.Logger("test"))
+
+	r := chi.NewRouter()
+	r.Get("/health", handler.HandleHealth)
+	r.Get("/readyz", handler.HandleReady)
+	r.Post("/ingest", handler.HandleIngest)
+	r.Post("/search", handler.HandleSearch)
+	r.Post("/run", handler.HandleRun)
+	r.Get("/documents/deleted", handler.HandleListDeleted)
+	r.Get("/documents/{id}", handler.HandleGetDocument)
+	r.Delete("/documents/{id}", handler.HandleDeleteDocument)
+	r.Post("/documents/{id}/restore", handler.HandleRestoreDocument)
+	r.Post("/collections", handler.HandlePutCollection)
+	r.Get("/collections", handler.HandleListCollections)
+	r.Get("/collections/{name}", handler.HandleGetCollection)
+	r.Delete("/collections/{name}", handler.HandleDeleteCollection)
+	r.Get("/admin/changelog", handler.HandleChangelog)
+	r.Get("/admin/segments/events", handler.HandleSegmentEvents)
+	r.Get("/admin/compaction/plan", handler.HandleCompactionPlan)
+	r.Post("/admin/compaction", handler.HandleCompact)
+	r.Post("/admin/gc", handler.HandleGC)
+	return store, r
+}
+
+// ingestDoc posts a document and fails the test on a non-200 response
+func ingestDoc(t *testing.T, router http.Handler, doc IngestRequest) {
+	t.Helper()
+	body, _ := json.Marshal(doc)
+	req := httptest.NewRequest(http.MethodPost, "/ingest", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("ingest of %s failed: %d %s", doc.ID, w.Code, w.Body.String())
+	}
+}
+
+func TestHandleSegmentEvents(t *testing.T) {
+	_, router := setupWALTestHandler(t, func(c *db.WALStoreConfig) {
+		c.MaxSegmentSize = 1024 // Force rotation on the first document
+	})
+
+	ingestDoc(t, router, IngestRequest{ID: "doc-1", Source: "test", Title: "Rotate", Text: strings.Repeat("x", 2048)})
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/segments/events?segment_id=1", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp SegmentEventsResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Count == 0 {
+		t.Fatal("expected events for segment 1")
+	}
+	if resp.Events[0].ToStatus != wal.SegmentStatusSealed || resp.Events[0].Actor != wal.ActorWriter {
+		t.Errorf("expected latest event to be a writer seal, got %+v", resp.Events[0])
+	}
+}
+
+func TestHandleSegmentEventsInvalidParams(t *testing.T) {
+	_, router := setupWALTestHandler(t)
+
+	for _, query := range []string{"segment_id=abc", "segment_type=bogus", "since=yesterday", "limit=-1"} {
+		req := httptest.NewRequest(http.MethodGet, "/admin/segments/events?"+query, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, w.Code)
+		}
+	}
+}
+
+func TestHandleSegmentEventsRequiresWAL(t *testing.T) {
+	handler, _ := setupTestHandler(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/segments/events", nil)
+	w := httptest.NewRecorder()
+	handler.HandleSegmentEvents(w, req)
+
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("expected status 501, got %d", w.Code)
+	}
+}
+
+func TestHandleCompactionPlan(t *testing.T) {
+	_, router := setupWALTestHandler(t, func(cfg *db.WALStoreConfig) {
+		cfg.MaxSegmentSize = 1024
+	})
+
+	for i := 0; i < 20; i++ {
+		ingestDoc(t, router, IngestRequest{
+			ID:     fmt.Sprintf("doc-%d", i),
+			Source: "test",
+			Title:  "Doc",
+			Text:   strings.Repeat("lorem ipsum ", 20),
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/compaction/plan?force=true", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var plan wal.CompactionPlan
+	if err := json.NewDecoder(w.Body).Decode(&plan); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if !plan.WouldCompact || len(plan.Segments) < 2 {
+		t.Errorf("expected a forced plan over the sealed segments, got %+v", plan)
+	}
+	if plan.LiveRecords != 20 {
+		t.Errorf("expected 20 live records, got %d", plan.LiveRecords)
+	}
+}
+
+func TestHandleCompactRequiresCompaction(t *testing.T) {
+	_, router := setupWALTestHandler(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/compaction", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected status 409 without compaction enabled, got %d", w.Code)
+	}
+}
+
+func TestHandleGC(t *testing.T) {
+	var walDir string
+	_, router := setupWALTestHandler(t, func(c *db.WALStoreConfig) { walDir = c.WALDir })
+
+	// A snapshot temp file left by a crash
+	orphan := filepath.Join(walDir, "snapshot_000000000007.snap.tmp")
+	if err := os.WriteFile(orphan, []byte("partial"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	_ = os.Chtimes(orphan, old, old)
+
+	for _, path := range []string{"/admin/gc?dry_run=true", "/admin/gc"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: unexpected status %d: %s", path, w.Code, w.Body.String())
+		}
+		var report wal.GCReport
+		_ = json.NewDecoder(w.Body).Decode(&report)
+		if len(report.Quarantined) != 1 || report.Quarantined[0].Reason != wal.OrphanTemp || report.QuarantinedBytes != 7 {
+			t.Errorf("%s: expected the temp file quarantined, got %+v", path, report)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(walDir, wal.QuarantineDir, filepath.Base(orphan))); err != nil {
+		t.Errorf("expected the file in quarantine: %v", err)
+	}
+}
+
+func TestHandleReset(t *testing.T) {
+	store, router := setupWALTestHandler(t)
+	ingestDoc(t, router, IngestRequest{ID: "doc-1", Source: "test", Title: "Reset", Text: "wiped"})
+
+	reset := func(h *Handler, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.Header.Set("X-API-Key", "sk-reset")
+		h.HandleReset(w, req)
+		return w
+	}
+	if w := reset(NewHandler(store, obs.Logger("test")), "/admin/reset?confirm=true"); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 without RESET_KEYS, got %d", w.Code)
+	}
+	// * vouches for managed keys and certificates, not for any secret
+	if w := reset(NewHandler(store, obs.Logger("test"), WithReset([]string{AnyKey})), "/admin/reset?confirm=true"); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for an unmanaged key under *, got %d", w.Code)
+	}
+	sum := sha256.Sum256([]byte("sk-reset"))
+	h := NewHandler(store, obs.Logger("test"), WithReset([]string{KeyHashPrefix + hex.EncodeToString(sum[:])}))
+	if w := reset(h, "/admin/reset"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without confirm, got %d", w.Code)
+	}
+	if store.Count() != 1 {
+		t.Fatalf("expected the refused resets to keep the document, got %d", store.Count())
+	}
+
+	w := reset(h, "/admin/reset?confirm=true")
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+	}
+	var report db.ResetReport
+	_ = json.NewDecoder(w.Body).Decode(&report)
+	if report.DocsRemoved != 1 || store.Count() != 0 {
+		t.Errorf("expected the document removed, got %+v and %d left", report, store.Count())
+	}
+}
@@ -0,0 +1,74 @@
+package httpapi
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+)
+
+// maxAliasesPerIngest limits the aliases one ingest can set
+const maxAliasesPerIngest = 100
+
+// WithAliases maps the aliases set on ingest to document IDs and serves
+// /resolve from table
+func WithAliases(table *db.AliasTable) HandlerOption {
+	return func(h *Handler) {
+		h.aliases = table
+	}
+}
+
+// validateAliases checks the aliases of an ingest request
+func validateAliases(aliases []string) error {
+	if len(aliases) > maxAliasesPerIngest {
+		return fmt.Errorf("at most %d aliases per document", maxAliasesPerIngest)
+	}
+	for _, alias := range aliases {
+		if err := db.ValidateAlias(alias); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setAliases points the aliases of an ingested document at it
+func (h *Handler) setAliases(r *http.Request, docID string, aliases []string) error {
+	if h.aliases == nil || len(aliases) == 0 {
+		return nil
+	}
+	return h.aliases.Set(r.Context(), docID, aliases...)
+}
+
+// HandleResolve returns the document an alias points at. Aliases live on
+// the shard that stores their document, so in a sharded deployment clients
+// resolve on the shard they ingested through.
+func (h *Handler) HandleResolve(w http.ResponseWriter, r *http.Request) {
+	if h.aliases == nil {
+		writeError(w, http.StatusNotImplemented, "aliases are not enabled", "NOT_SUPPORTED")
+		return
+	}
+	alias := r.URL.Query().Get("alias")
+	if alias == "" {
+		writeError(w, http.StatusBadRequest, "alias is required", "MISSING_PARAM")
+		return
+	}
+
+	id, found := h.aliases.Resolve(alias)
+	if !found {
+		writeError(w, http.StatusNotFound, "alias not found", "ALIAS_NOT_FOUND")
+		return
+	}
+	resp := ResolveResponse{Alias: alias, ID: id}
+	if getter, ok := h.store.(documentGetter); ok {
+		if doc, found := getter.Get(id); found {
+			d := documentResponse(doc)
+			resp.Document = &d
+		}
+	}
+	// Namespace-scoped keys only see aliases of documents in their collections
+	if scopedKey(r) && (resp.Document == nil || !mayUseCollection(r, resp.Document.Collection)) {
+		writeError(w, http.StatusNotFound, "alias not found", "ALIAS_NOT_FOUND")
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,69 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestHandleResolve(t *testing.T) {
+	store, _ := setupWALTestHandler(t)
+	aliases, err := db.NewAliasTable(filepath.Join(t.TempDir(), "aliases.json"))
+	if err != nil {
+		t.Fatalf("failed to open alias table: %v", err)
+	}
+	h := NewHandler(store, obs.Logger("test"), WithAliases(aliases))
+	r := chi.NewRouter()
+	r.Post("/ingest", h.HandleIngest)
+	r.Get("/resolve", h.HandleResolve)
+	r.Delete("/documents/{id}", h.HandleDeleteDocument)
+	r.Post("/documents/{id}/move", h.HandleMoveDocument)
+
+	resolve := func(alias string) (int, ResolveResponse) {
+		w := doJSON(r, http.MethodGet, "/resolve?alias="+url.QueryEscape(alias), nil)
+		var resp ResolveResponse
+		_ = json.NewDecoder(w.Body).Decode(&resp)
+		return w.Code, resp
+	}
+
+	const page = "https://wiki.example.com/runbooks/deploys?v=2"
+	ingestDoc(t, r, IngestRequest{ID: "doc-1", Source: "wiki", Title: "Deploys", Text: "deploy runbook", Aliases: []string{page, "runbooks/deploys.md"}})
+	if code, resp := resolve(page); code != http.StatusOK || resp.ID != "doc-1" || resp.Document == nil || resp.Document.Title != "Deploys" {
+		t.Fatalf("resolve = %d %+v", code, resp)
+	}
+
+	// Re-delivering an unchanged document still moves its aliases to it
+	ingestDoc(t, r, IngestRequest{ID: "doc-2", Source: "wiki", Title: "Deploys v2", Text: "new runbook"})
+	ingestDoc(t, r, IngestRequest{ID: "doc-2", Source: "wiki", Title: "Deploys v2", Text: "new runbook", Aliases: []string{page}})
+	if _, resp := resolve(page); resp.ID != "doc-2" {
+		t.Errorf("alias points at %q after re-ingest, want doc-2", resp.ID)
+	}
+
+	if w := doJSON(r, http.MethodPost, "/documents/doc-1/move", MoveRequest{ID: "doc-3"}); w.Code != http.StatusOK {
+		t.Fatalf("move = %d %s", w.Code, w.Body.String())
+	}
+	if _, resp := resolve("runbooks/deploys.md"); resp.ID != "doc-3" {
+		t.Errorf("alias points at %q after move, want doc-3", resp.ID)
+	}
+	if w := doJSON(r, http.MethodDelete, "/documents/doc-3", nil); w.Code != http.StatusOK {
+		t.Fatalf("delete = %d", w.Code)
+	}
+	if code, _ := resolve("runbooks/deploys.md"); code != http.StatusNotFound {
+		t.Errorf("alias of a deleted document = %d, want 404", code)
+	}
+
+	if code, _ := resolve(""); code != http.StatusBadRequest {
+		t.Errorf("missing alias = %d, want 400", code)
+	}
+	w := doJSON(r, http.MethodPost, "/ingest", IngestRequest{ID: "doc-4", Source: "wiki", Title: "Bad", Aliases: []string{strings.Repeat("x", db.MaxAliasLen+1)}})
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "INVALID_ALIAS") {
+		t.Errorf("oversized alias = %d %s", w.Code, w.Body.String())
+	}
+}
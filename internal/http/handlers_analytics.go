@@ -0,0 +1,65 @@
+package httpapi
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/dsjohal14/selfstack/internal/scope/analytics"
+)
+
+// defaultDuplicateGroups is how many groups /analytics/duplicates returns
+// by default
+const defaultDuplicateGroups = 100
+
+// WithDuplicates serves the near-duplicate reports d builds at
+// /analytics/duplicates
+func WithDuplicates(d *analytics.Duplicates) HandlerOption {
+	return func(h *Handler) {
+		h.duplicates = d
+	}
+}
+
+// HandleDuplicates returns the latest near-duplicate report, largest groups
+// first
+// Query params: collection, limit
+func (h *Handler) HandleDuplicates(w http.ResponseWriter, r *http.Request) {
+	if h.duplicates == nil {
+		writeError(w, http.StatusNotImplemented, "duplicate reports are disabled (DUPLICATES_INTERVAL=0) or need the WAL storage backend", "NOT_SUPPORTED")
+		return
+	}
+	q := r.URL.Query()
+	limit := defaultDuplicateGroups
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "limit must be a positive integer", "INVALID_PARAM")
+			return
+		}
+		limit = n
+	}
+	report, ok := h.duplicates.Report()
+	if !ok {
+		writeError(w, http.StatusServiceUnavailable, "the first duplicate report hasn't finished yet", "REPORT_NOT_READY")
+		return
+	}
+
+	resp := DuplicatesResponse{
+		GeneratedAt: report.GeneratedAt,
+		Threshold:   report.Threshold,
+		Scanned:     report.Scanned,
+		TookMS:      report.TookMS,
+		Groups:      []analytics.DuplicateGroup{},
+	}
+	collection := q.Get("collection")
+	for _, g := range report.Groups {
+		if collection != "" && g.Collection != collection {
+			continue
+		}
+		resp.Total++
+		if len(resp.Groups) < limit {
+			resp.Groups = append(resp.Groups, g)
+		}
+	}
+	resp.Count = len(resp.Groups)
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,62 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+	"github.com/dsjohal14/selfstack/internal/scope/analytics"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestHandleDuplicates(t *testing.T) {
+	store, _ := setupWALTestHandler(t)
+	duplicates := analytics.NewDuplicates(store, 0)
+	handler := NewHandler(store, obs.Logger("test"), WithDuplicates(duplicates))
+	r := chi.NewRouter()
+	r.Post("/ingest", handler.HandleIngest)
+	r.Get("/analytics/duplicates", handler.HandleDuplicates)
+
+	if w := doJSON(r, http.MethodGet, "/analytics/duplicates", nil); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 before the first report, got %d", w.Code)
+	}
+
+	ingestDoc(t, r, IngestRequest{ID: "doc-1", Source: "drive", Title: "Plan", Text: "roadmap for the next quarter"})
+	ingestDoc(t, r, IngestRequest{ID: "doc-2", Source: "dropbox", Title: "Plan", Text: "roadmap for the next quarter"})
+	ingestDoc(t, r, IngestRequest{ID: "doc-3", Source: "drive", Title: "Recipes", Text: "how to bake bread"})
+	if err := duplicates.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	w := doJSON(r, http.MethodGet, "/analytics/duplicates", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+	}
+	var resp DuplicatesResponse
+	_ = json.NewDecoder(w.Body).Decode(&resp)
+	if resp.Scanned != 3 || resp.Count != 1 || resp.Total != 1 {
+		t.Fatalf("unexpected report %+v", resp)
+	}
+	if docs := resp.Groups[0].Documents; len(docs) != 2 || docs[1].Suggestion != analytics.SuggestDelete {
+		t.Errorf("expected the pair with one suggested for deletion, got %+v", docs)
+	}
+
+	w = doJSON(r, http.MethodGet, "/analytics/duplicates?collection=other", nil)
+	resp = DuplicatesResponse{}
+	_ = json.NewDecoder(w.Body).Decode(&resp)
+	if resp.Total != 0 || resp.Groups == nil {
+		t.Errorf("expected no groups in another collection, got %+v", resp)
+	}
+	if w := doJSON(r, http.MethodGet, "/analytics/duplicates?limit=0", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for limit=0, got %d", w.Code)
+	}
+
+	handler = NewHandler(store, obs.Logger("test"))
+	r = chi.NewRouter()
+	r.Get("/analytics/duplicates", handler.HandleDuplicates)
+	if w := doJSON(r, http.MethodGet, "/analytics/duplicates", nil); w.Code != http.StatusNotImplemented {
+		t.Errorf("expected 501 without a report, got %d", w.Code)
+	}
+}
@@ -0,0 +1,209 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+	"github.com/dsjohal14/selfstack/internal/scope/ingest"
+)
+
+// maxBackfillErrors is how many failed documents a backfill reports
+const maxBackfillErrors = 100
+
+// backfiller is a store with a bulk load path, like the WAL store
+type backfiller interface {
+	BeginBackfill() *db.Backfill
+}
+
+// skippedError marks a document a backfill reports and moves past
+type skippedError struct {
+	code string
+	err  error
+}
+
+func (e *skippedError) Error() string { return e.err.Error() }
+
+// skipDoc skips a document with an error code and message
+func skipDoc(code, format string, args ...any) error {
+	return &skippedError{code: code, err: fmt.Errorf(format, args...)}
+}
+
+// HandleBackfill loads a stream of documents, one ingest request per line
+// (NDJSON), through the store's bulk path: WAL records are synced in
+// batches and the index is built once at the end. It's meant for initial
+// loads: unchanged documents are rewritten, chunks left over from an
+// earlier version aren't removed, collection document quotas aren't
+// enforced, and post-ingest hooks don't run. Invalid documents are
+// reported and skipped; a store error or malformed line stops the load.
+func (h *Handler) HandleBackfill(w http.ResponseWriter, r *http.Request) {
+	bf, ok := h.store.(backfiller)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, "backfill needs the WAL storage backend", "NOT_SUPPORTED")
+		return
+	}
+
+	ctx := r.Context()
+	backfill := bf.BeginBackfill()
+	h.logger.Info().Msg("backfill started")
+
+	var resp BackfillResponse
+	var usage db.Usage
+	colls := make(map[string]*collection)
+	dec := json.NewDecoder(r.Body)
+	for n := 1; ; n++ {
+		var req IngestRequest
+		if err := dec.Decode(&req); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			resp.Error = fmt.Sprintf("invalid JSON in document %d: %v", n, err)
+			break
+		}
+
+		docs, err := h.prepareBackfill(r, req, colls)
+		if err == nil {
+			for _, doc := range docs {
+				if err = backfill.Add(ctx, doc); err != nil {
+					break
+				}
+				usage.IngestedDocs++
+				usage.Tokens += estimateTokens(doc.Text)
+			}
+		}
+		if err == nil {
+			err = h.setAliases(r, req.ID, req.Aliases)
+		}
+		var skipped *skippedError
+		switch {
+		case err == nil:
+			resp.Documents++
+			usage.IngestedBytes += int64(len(req.Text))
+			continue
+		case errors.As(err, &skipped):
+			resp.Failed++
+			if len(resp.Errors) < maxBackfillErrors {
+				resp.Errors = append(resp.Errors, BackfillError{Document: n, ID: req.ID, Error: err.Error(), Code: skipped.code})
+			}
+			continue
+		}
+		h.logger.Error().Err(err).Str("doc_id", req.ID).Msg("backfill failed")
+		resp.Error = fmt.Sprintf("failed to store document %d: %v", n, err)
+		break
+	}
+
+	// Whatever was written is indexed, even when the load stopped early
+	stats, err := backfill.Finish()
+	if err != nil && resp.Error == "" {
+		resp.Error = err.Error()
+	}
+	h.invalidateResults()
+	h.meter(r, usage)
+
+	resp.Records = stats.Documents
+	resp.Bytes = stats.Bytes
+	resp.Syncs = stats.Syncs
+	resp.WriteMS = float64(stats.WriteTime) / float64(time.Millisecond)
+	resp.IndexMS = float64(stats.IndexTime) / float64(time.Millisecond)
+	if secs := (stats.WriteTime + stats.IndexTime).Seconds(); secs > 0 {
+		resp.DocsPerSec = float64(resp.Documents) / secs
+	}
+
+	h.logger.Info().
+		Int("documents", resp.Documents).
+		Int("records", resp.Records).
+		Int("failed", resp.Failed).
+		Float64("docs_per_sec", resp.DocsPerSec).
+		Dur("write", stats.WriteTime).
+		Dur("index", stats.IndexTime).
+		Str("error", resp.Error).
+		Msg("backfill finished")
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// prepareBackfill validates a backfilled document and turns it into the
+// documents to store: enriched by the pre-ingest hooks, chunked, and
+// embedded. colls caches the collections loaded so far.
+func (h *Handler) prepareBackfill(r *http.Request, req IngestRequest, colls map[string]*collection) ([]db.Document, error) {
+	switch {
+	case req.ID == "":
+		return nil, skipDoc("MISSING_ID", "id is required")
+	case req.Source == "":
+		return nil, skipDoc("MISSING_SOURCE", "source is required")
+	case req.Title == "":
+		return nil, skipDoc("MISSING_TITLE", "title is required")
+	}
+	if err := validateAliases(req.Aliases); err != nil {
+		return nil, skipDoc("INVALID_ALIAS", "%v", err)
+	}
+	if req.Text == "" {
+		req.Text = req.Title
+	}
+	if req.CreatedAt.IsZero() {
+		req.CreatedAt = time.Now()
+	}
+	if h.shards != nil {
+		if owner, local := h.shards.Owner(req.ID); !local {
+			return nil, skipDoc("WRONG_SHARD", "document belongs to shard %s", owner.ID)
+		}
+	}
+
+	name := req.Collection
+	if name == "" {
+		name = db.DefaultCollection
+	}
+	coll, ok := colls[name]
+	if !ok {
+		var found bool
+		var err error
+		if coll, found, err = h.loadCollection(r.Context(), name); err != nil {
+			return nil, fmt.Errorf("failed to load collection %s: %w", name, err)
+		}
+		if !found {
+			return nil, skipDoc("COLLECTION_NOT_FOUND", "collection not found: %s", name)
+		}
+		colls[name] = coll
+	}
+
+	doc := db.Document{
+		ID:         req.ID,
+		Source:     req.Source,
+		Title:      req.Title,
+		Text:       req.Text,
+		Metadata:   withACLDefaults(req.Metadata, coll.ACL),
+		CreatedAt:  req.CreatedAt,
+		Collection: coll.Name,
+	}
+	if err := h.hooks.RunPre(r.Context(), &doc); err != nil {
+		if ingest.IsVeto(err) {
+			return nil, skipDoc("DOCUMENT_REJECTED", "%v", err)
+		}
+		return nil, skipDoc("HOOK_ERROR", "pre-ingest hook failed: %v", err)
+	}
+	if limit := coll.Quotas.MaxDocumentBytes; limit > 0 && len(doc.Text) > limit {
+		return nil, skipDoc("DOCUMENT_TOO_LARGE", "text is %d bytes, collection %s allows %d", len(doc.Text), coll.Name, limit)
+	}
+	if cutoff := coll.RetentionCutoff(time.Now()); !cutoff.IsZero() && doc.CreatedAt.Before(cutoff) {
+		return nil, skipDoc("EXPIRED_DOCUMENT", "created_at is older than the %d day retention of collection %s", coll.RetentionDays, coll.Name)
+	}
+
+	doc.Metadata = withContentHash(doc)
+	docs := chunkDocs(doc, chunkText(doc.Text, coll.Chunking))
+	for i := range docs {
+		emb, fallback, err := coll.embed(r.Context(), docs[i].Text)
+		if err != nil {
+			return nil, skipDoc("EMBEDDER_UNAVAILABLE", "embedder unavailable: %v", err)
+		}
+		docs[i].Embedding = emb
+		if fallback != "" {
+			if docs[i].Metadata == nil {
+				docs[i].Metadata = make(map[string]string, 1)
+			}
+			docs[i].Metadata[metaEmbeddingFallback] = fallback
+		}
+	}
+	return docs, nil
+}
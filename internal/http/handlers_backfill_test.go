@@ -0,0 +1,52 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+)
+
+func TestHandleBackfill(t *testing.T) {
+	store, r := setupWALTestHandler(t)
+	h := NewHandler(store, obs.Logger("test"))
+	r.Post("/admin/backfill", h.HandleBackfill)
+
+	body := strings.Join([]string{
+		`{"id": "a", "source": "archive", "title": "Alpha", "text": "first archived note"}`,
+		`{"id": "b", "source": "archive", "title": "Beta"}`,
+		`{"id": "", "source": "archive", "title": "No ID"}`,
+		`{"id": "c", "source": "archive", "title": "Gamma", "collection": "missing"}`,
+		`{"id": "d", "source": "archive", "title": "Delta"}`,
+	}, "\n")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/backfill", strings.NewReader(body)))
+
+	var resp BackfillResponse
+	_ = json.NewDecoder(w.Body).Decode(&resp)
+	if w.Code != http.StatusOK || resp.Documents != 3 || resp.Records != 3 || resp.Failed != 2 || resp.Error != "" {
+		t.Fatalf("backfill = %d %+v", w.Code, resp)
+	}
+	if len(resp.Errors) != 2 || resp.Errors[0].Document != 3 || resp.Errors[0].Code != "MISSING_ID" || resp.Errors[1].Code != "COLLECTION_NOT_FOUND" {
+		t.Errorf("errors = %+v", resp.Errors)
+	}
+	if w := doJSON(r, http.MethodGet, "/documents/a", nil); w.Code != http.StatusOK {
+		t.Errorf("backfilled document: %d", w.Code)
+	}
+
+	// A malformed line stops the load; what came before is kept
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/backfill",
+		strings.NewReader(`{"id": "e", "source": "archive", "title": "Epsilon"}`+"\n{oops\n"+`{"id": "f", "source": "archive", "title": "Phi"}`)))
+	resp = BackfillResponse{}
+	_ = json.NewDecoder(w.Body).Decode(&resp)
+	if resp.Documents != 1 || !strings.Contains(resp.Error, "document 2") {
+		t.Errorf("malformed backfill = %+v", resp)
+	}
+	if _, found := store.Get("e"); !found {
+		t.Error("document before the malformed line was not kept")
+	}
+}
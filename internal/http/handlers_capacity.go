@@ -0,0 +1,69 @@
+package httpapi
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/capacity"
+)
+
+// defaultProjectionDays is how far ahead /admin/capacity projects growth
+const defaultProjectionDays = 30
+
+// WithCapacity reports the growth of the index and WAL that t has sampled
+// (see db.WALStore.CapacitySample)
+func WithCapacity(t *capacity.Tracker) HandlerOption {
+	return func(h *Handler) {
+		h.capacity = t
+	}
+}
+
+// HandleCapacity reports the memory the index holds, the WAL's disk usage,
+// and how both are growing, so operators can scale before hitting limits
+// Query params: days (projection horizon, default 30)
+func (h *Handler) HandleCapacity(w http.ResponseWriter, r *http.Request) {
+	ws, ok := h.walStore(w)
+	if !ok {
+		return
+	}
+	days := defaultProjectionDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "days must be a positive integer", "INVALID_PARAM")
+			return
+		}
+		days = n
+	}
+
+	resp := CapacityResponse{
+		Index:      ws.Index().Size(),
+		IndexLimit: ws.IndexBudget().Limit(),
+	}
+	resp.WALBytes, resp.WALSegments = ws.DiskUsage()
+
+	if h.capacity != nil {
+		if growth, ok := h.capacity.Growth(); ok {
+			resp.Growth = &growth
+			resp.Projection = project(resp, growth, days)
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// project extends the current sizes in resp by growth for days
+func project(resp CapacityResponse, growth capacity.Growth, days int) *CapacityProjection {
+	horizon := time.Duration(days) * 24 * time.Hour
+	p := &CapacityProjection{
+		Days:       days,
+		Documents:  capacity.Project(int64(resp.Index.Documents), growth.DocumentsPerDay, horizon),
+		IndexBytes: capacity.Project(resp.Index.TotalBytes, growth.IndexBytesPerDay, horizon),
+		WALBytes:   capacity.Project(resp.WALBytes, growth.WALBytesPerDay, horizon),
+	}
+	if d, ok := capacity.Until(resp.Index.TotalBytes, resp.IndexLimit, growth.IndexBytesPerDay); ok {
+		at := time.Now().Add(d).UTC()
+		p.IndexFullAt = &at
+	}
+	return p
+}
@@ -0,0 +1,66 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/capacity"
+	"github.com/dsjohal14/selfstack/internal/libs/membudget"
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestHandleCapacity(t *testing.T) {
+	budget := membudget.New(membudget.ModuleIndex, 1<<30, nil)
+	store, _ := setupWALTestHandler(t, func(c *db.WALStoreConfig) { c.IndexBudget = budget })
+	tracker := capacity.NewTracker(2 * time.Hour)
+	handler := NewHandler(store, obs.Logger("test"), WithCapacity(tracker))
+	r := chi.NewRouter()
+	r.Post("/ingest", handler.HandleIngest)
+	r.Get("/admin/capacity", handler.HandleCapacity)
+
+	first := store.CapacitySample()
+	ingestDoc(t, r, IngestRequest{ID: "doc-1", Source: "test", Title: "Capacity", Text: "planning notes"})
+
+	// Growth is omitted until there are two samples
+	w := doJSON(r, http.MethodGet, "/admin/capacity", nil)
+	var resp CapacityResponse
+	_ = json.NewDecoder(w.Body).Decode(&resp)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+	}
+	if resp.Index.Documents != 1 || resp.Index.TextBytes == 0 || resp.Index.VectorBytes == 0 || resp.Index.TotalBytes < resp.Index.TextBytes+resp.Index.VectorBytes {
+		t.Errorf("index = %+v", resp.Index)
+	}
+	if resp.IndexLimit != 1<<30 || resp.WALBytes == 0 || resp.WALSegments == 0 {
+		t.Errorf("limit = %d, wal = %d bytes in %d segments", resp.IndexLimit, resp.WALBytes, resp.WALSegments)
+	}
+	if resp.Growth != nil || resp.Projection != nil {
+		t.Errorf("expected no growth yet, got %+v", resp.Growth)
+	}
+
+	// One document an hour
+	first.At = time.Now().Add(-time.Hour)
+	tracker.Record(first)
+	tracker.Record(store.CapacitySample())
+
+	w = doJSON(r, http.MethodGet, "/admin/capacity?days=10", nil)
+	resp = CapacityResponse{}
+	_ = json.NewDecoder(w.Body).Decode(&resp)
+	if resp.Growth == nil || resp.Projection == nil {
+		t.Fatalf("expected growth and a projection, got %+v", resp)
+	}
+	if d := resp.Growth.DocumentsPerDay; d < 23.9 || d > 24.1 {
+		t.Errorf("documents per day = %v, want 24", d)
+	}
+	if p := resp.Projection; p.Days != 10 || p.Documents < 240 || p.IndexBytes <= resp.Index.TotalBytes || p.IndexFullAt == nil {
+		t.Errorf("projection = %+v", p)
+	}
+
+	if w := doJSON(r, http.MethodGet, "/admin/capacity?days=0", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for days=0, got %d", w.Code)
+	}
+}
@@ -0,0 +1,114 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dsjohal14/selfstack/internal/scope/db/wal"
+)
+
+// changelogFlushEvery is how many changelog lines are written between
+// flushes, so a client sees progress without a flush per line
+const changelogFlushEvery = 256
+
+// HandleChangelog streams the document and collection changes from
+// from_lsn up to the index watermark as ndjson, then an end line with the
+// from_lsn to continue from. A mirror bootstraps from 0 and calls again
+// with each end line's next_lsn. Lines are written as the segments are
+// read, so a slow client slows the read instead of the server buffering.
+// Query params: from_lsn, format (ndjson), include_embeddings
+func (h *Handler) HandleChangelog(w http.ResponseWriter, r *http.Request) {
+	ws, ok := h.walStore(w)
+	if !ok {
+		return
+	}
+
+	q := r.URL.Query()
+	var from uint64
+	if v := q.Get("from_lsn"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "from_lsn must be a non-negative integer", "INVALID_PARAM")
+			return
+		}
+		from = n
+	}
+	if f := q.Get("format"); f != "" && f != "ndjson" {
+		writeError(w, http.StatusBadRequest, "format must be ndjson", "INVALID_PARAM")
+		return
+	}
+	embeddings := q.Get("include_embeddings") == "true"
+	if embeddings && !h.mayExportEmbeddings(w, r) {
+		return
+	}
+
+	changes, err := ws.OpenChangelog(from)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error(), "STORE_ERROR")
+		return
+	}
+	defer func() { _ = changes.Close() }()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("X-Changelog-Through", strconv.FormatUint(changes.Through(), 10))
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+
+	for n := 1; changes.Next(); n++ {
+		if err := enc.Encode(changelogEntry(changes.Op(), embeddings)); err != nil {
+			return // The client went away
+		}
+		if n%changelogFlushEvery == 0 {
+			if r.Context().Err() != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+	if err := changes.Err(); err != nil {
+		h.logger.Error().Err(err).Uint64("from_lsn", from).Msg("changelog read failed")
+		_ = enc.Encode(ChangelogEntry{Op: "error", Error: err.Error()})
+		return
+	}
+	_ = enc.Encode(ChangelogEntry{Op: "end", NextLSN: changes.Through() + 1})
+}
+
+// changelogEntry converts a WAL record to its changelog line
+func changelogEntry(op wal.Op, embeddings bool) ChangelogEntry {
+	e := ChangelogEntry{LSN: op.LSN, Op: strings.ToLower(op.Type.String()), Batch: op.Batch}
+	if op.At != 0 {
+		at := op.At.Wall()
+		e.At = &at
+	}
+
+	switch {
+	case op.Doc != nil:
+		d := op.Doc
+		e.DocID, e.Collection = d.DocID, d.Collection
+		e.Source, e.Title, e.Text, e.Metadata = d.Source, d.Title, d.Text, d.Metadata
+		if !d.CreatedAt.IsZero() {
+			created := d.CreatedAt
+			e.CreatedAt = &created
+		}
+		if embeddings {
+			e.Embedding = d.Embedding[:]
+		}
+	case op.Delete != nil:
+		e.DocID, e.DeletedBy = op.Key, op.Delete.DeletedBy
+		if !op.Delete.DeletedAt.IsZero() {
+			deleted := op.Delete.DeletedAt
+			e.DeletedAt = &deleted
+		}
+	default:
+		e.Collection = op.Key
+		if json.Valid(op.Value) {
+			e.Config = op.Value
+		}
+	}
+	return e
+}
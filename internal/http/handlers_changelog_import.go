@@ -0,0 +1,321 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/relay"
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+	"github.com/dsjohal14/selfstack/internal/scope/db/wal"
+)
+
+// changelogImport is the state of an import as it reads the stream
+type changelogImport struct {
+	resp  ChangelogImportResponse
+	usage db.Usage
+
+	colls   map[string]*collection // Collections loaded so far
+	defined map[string]bool        // Dry run: collections the stream defines (true) or deletes (false)
+
+	pending   []db.BatchOp // Document changes of the batch being read
+	deletedBy string       // Who the pending deletes are recorded as made by
+	lastLSN   uint64
+}
+
+// HandleImportChangelog replays a changelog exported by GET
+// /admin/changelog, one change per line (NDJSON), through the WAL. Changes
+// are written in the stream's order, which must follow increasing LSNs,
+// and a batch's document changes are written as one atomic batch again, so
+// an empty instance ends up with the exporter's documents and collections.
+// Documents exported without embeddings are embedded by their collection;
+// they aren't chunked again and the ingest hooks don't run. Invalid changes
+// are reported and skipped; a store error, malformed or out-of-order line,
+// or an error line stops the import, keeping what was written. With
+// dry_run=true every line is validated and nothing is written.
+// Query params: dry_run
+func (h *Handler) HandleImportChangelog(w http.ResponseWriter, r *http.Request) {
+	ws, ok := h.walStore(w)
+	if !ok {
+		return
+	}
+
+	imp := &changelogImport{colls: make(map[string]*collection), defined: make(map[string]bool)}
+	imp.resp.DryRun = r.URL.Query().Get("dry_run") == "true"
+	ctx := db.WithConsistency(r.Context(), db.ConsistencyAsync)
+	h.logger.Info().Bool("dry_run", imp.resp.DryRun).Msg("changelog import started")
+
+	dec := json.NewDecoder(r.Body)
+	ended := false
+	for n := 1; !ended; n++ {
+		var e ChangelogEntry
+		if err := dec.Decode(&e); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			imp.resp.Error = fmt.Sprintf("invalid JSON on line %d: %v", n, err)
+			break
+		}
+		if e.LSN != 0 {
+			if e.LSN <= imp.lastLSN {
+				imp.resp.Error = fmt.Sprintf("line %d has LSN %d after LSN %d; changes must be in LSN order", n, e.LSN, imp.lastLSN)
+				break
+			}
+			imp.lastLSN = e.LSN
+		}
+
+		var err error
+		switch e.Op {
+		case "end":
+			imp.resp.NextLSN, ended = e.NextLSN, true
+			continue
+		case "error":
+			imp.resp.Error = "the export failed before its end: " + e.Error
+		case "insert", "update":
+			err = h.importDocument(ctx, imp, e)
+		case "delete":
+			err = importDelete(imp, e)
+		case "collection", "embedder_change", "collection_delete":
+			if err = h.flushImport(ctx, ws, imp); err == nil {
+				err = h.importCollection(ctx, imp, e)
+			}
+		default:
+			err = skipDoc("INVALID_OP", "unknown op %q", e.Op)
+		}
+		if err == nil && !e.Batch {
+			err = h.flushImport(ctx, ws, imp)
+		}
+		if imp.resp.Error != "" {
+			break
+		}
+
+		var skipped *skippedError
+		switch {
+		case err == nil:
+			continue
+		case errors.As(err, &skipped):
+			imp.resp.Failed++
+			if len(imp.resp.Errors) < maxBackfillErrors {
+				imp.resp.Errors = append(imp.resp.Errors, ChangelogImportError{
+					Line: n, LSN: e.LSN, Op: e.Op, ID: e.DocID, Error: err.Error(), Code: skipped.code,
+				})
+			}
+			continue
+		}
+		h.logger.Error().Err(err).Int("line", n).Uint64("lsn", e.LSN).Msg("changelog import failed")
+		imp.resp.Error = fmt.Sprintf("failed to apply line %d: %v", n, err)
+		break
+	}
+
+	// A batch cut off by the end of the stream is written like any other:
+	// the export only ends mid-batch when the file was cut short
+	if err := h.flushImport(ctx, ws, imp); err != nil && imp.resp.Error == "" {
+		imp.resp.Error = err.Error()
+	}
+	if !ended && imp.resp.Error == "" {
+		imp.resp.Error = "the changelog ended without its end line; it may have been cut short"
+	}
+	if !imp.resp.DryRun {
+		if err := ws.Commit(r.Context(), db.ConsistencyFsync); err != nil && imp.resp.Error == "" {
+			imp.resp.Error = err.Error()
+		}
+		h.invalidateResults()
+		h.meter(r, imp.usage)
+	}
+	imp.resp.LastLSN = imp.lastLSN
+
+	h.logger.Info().
+		Int("applied", imp.resp.Applied).
+		Int("failed", imp.resp.Failed).
+		Uint64("last_lsn", imp.resp.LastLSN).
+		Bool("dry_run", imp.resp.DryRun).
+		Str("error", imp.resp.Error).
+		Msg("changelog import finished")
+	writeJSON(w, http.StatusOK, imp.resp)
+}
+
+// importDocument validates an inserted or updated document and adds it to
+// the pending batch, embedding it when the export left its embedding out
+func (h *Handler) importDocument(ctx context.Context, imp *changelogImport, e ChangelogEntry) error {
+	switch {
+	case e.DocID == "":
+		return skipDoc("MISSING_ID", "doc_id is required")
+	case e.Source == "":
+		return skipDoc("MISSING_SOURCE", "source is required")
+	case e.Title == "":
+		return skipDoc("MISSING_TITLE", "title is required")
+	case len(e.Embedding) != 0 && len(e.Embedding) != relay.EmbeddingDim:
+		return skipDoc("INVALID_EMBEDDING", "embedding has %d dimensions, the index has %d", len(e.Embedding), relay.EmbeddingDim)
+	}
+	if h.shards != nil {
+		if owner, local := h.shards.Owner(e.DocID); !local {
+			return skipDoc("WRONG_SHARD", "document belongs to shard %s", owner.ID)
+		}
+	}
+
+	name := e.Collection
+	if name == "" {
+		name = db.DefaultCollection
+	}
+	coll, err := h.importCollectionFor(ctx, imp, name)
+	if err != nil || imp.resp.DryRun {
+		if err == nil {
+			imp.resp.Applied++
+			imp.resp.Documents++
+		}
+		return err
+	}
+
+	doc := db.Document{
+		ID:         e.DocID,
+		Source:     e.Source,
+		Title:      e.Title,
+		Text:       e.Text,
+		Metadata:   e.Metadata,
+		Collection: name,
+	}
+	if e.CreatedAt != nil {
+		doc.CreatedAt = *e.CreatedAt
+	} else {
+		doc.CreatedAt = time.Now()
+	}
+	if len(e.Embedding) != 0 {
+		copy(doc.Embedding[:], e.Embedding)
+	} else {
+		emb, fallback, err := coll.embed(ctx, doc.Text)
+		if err != nil {
+			return skipDoc("EMBEDDER_UNAVAILABLE", "embedder unavailable: %v", err)
+		}
+		doc.Embedding = emb
+		if fallback != "" {
+			if doc.Metadata == nil {
+				doc.Metadata = make(map[string]string, 1)
+			}
+			doc.Metadata[metaEmbeddingFallback] = fallback
+		}
+		imp.usage.Tokens += estimateTokens(doc.Text)
+	}
+
+	imp.pending = append(imp.pending, db.BatchOp{Doc: doc})
+	imp.resp.Applied++
+	imp.resp.Documents++
+	imp.usage.IngestedDocs++
+	imp.usage.IngestedBytes += int64(len(doc.Text))
+	return nil
+}
+
+// importDelete adds a delete to the pending batch
+func importDelete(imp *changelogImport, e ChangelogEntry) error {
+	if e.DocID == "" {
+		return skipDoc("MISSING_ID", "doc_id is required")
+	}
+	if !imp.resp.DryRun {
+		if len(imp.pending) == 0 || imp.deletedBy == "" {
+			imp.deletedBy = e.DeletedBy
+		}
+		imp.pending = append(imp.pending, db.BatchOp{Delete: e.DocID})
+	}
+	imp.resp.Applied++
+	imp.resp.Deletes++
+	return nil
+}
+
+// importCollection stores or deletes a collection through the registry,
+// which logs the change to the WAL
+func (h *Handler) importCollection(ctx context.Context, imp *changelogImport, e ChangelogEntry) error {
+	if h.collections == nil {
+		return skipDoc("NOT_SUPPORTED", "collections are not configured")
+	}
+	delete(imp.colls, e.Collection)
+
+	if e.Op == "collection_delete" {
+		switch {
+		case e.Collection == "":
+			return skipDoc("MISSING_COLLECTION", "collection is required")
+		case e.Collection == db.DefaultCollection:
+			return skipDoc("INVALID_COLLECTION", "the default collection can't be deleted")
+		}
+		if imp.resp.DryRun {
+			imp.defined[e.Collection] = false
+		} else if count := h.store.CountCollection(e.Collection); count > 0 {
+			return skipDoc("COLLECTION_NOT_EMPTY", "collection %s still holds %d documents", e.Collection, count)
+		} else if err := h.collections.Delete(ctx, e.Collection); err != nil {
+			return fmt.Errorf("failed to delete collection %s: %w", e.Collection, err)
+		}
+		imp.resp.Applied++
+		imp.resp.Collections++
+		return nil
+	}
+
+	var cfg db.CollectionConfig
+	if len(e.Config) == 0 {
+		return skipDoc("MISSING_CONFIG", "config is required")
+	}
+	if err := json.Unmarshal(e.Config, &cfg); err != nil {
+		return skipDoc("INVALID_COLLECTION", "invalid config: %v", err)
+	}
+	if cfg.Name == "" {
+		cfg.Name = e.Collection
+	}
+	if err := cfg.Validate(); err != nil {
+		return skipDoc("INVALID_COLLECTION", "%v", err)
+	}
+	delete(imp.colls, cfg.Name)
+	if imp.resp.DryRun {
+		imp.defined[cfg.Name] = true
+	} else if err := h.collections.Put(ctx, cfg); err != nil {
+		return fmt.Errorf("failed to store collection %s: %w", cfg.Name, err)
+	}
+	imp.resp.Applied++
+	imp.resp.Collections++
+	return nil
+}
+
+// importCollectionFor loads a document's collection, caching it; a dry
+// run also accepts collections the stream defined earlier
+func (h *Handler) importCollectionFor(ctx context.Context, imp *changelogImport, name string) (*collection, error) {
+	if coll, ok := imp.colls[name]; ok {
+		return coll, nil
+	}
+	if defined, ok := imp.defined[name]; ok {
+		if !defined {
+			return nil, skipDoc("COLLECTION_NOT_FOUND", "collection not found: %s", name)
+		}
+		return nil, nil
+	}
+	coll, found, err := h.loadCollection(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load collection %s: %w", name, err)
+	}
+	if !found {
+		return nil, skipDoc("COLLECTION_NOT_FOUND", "collection not found: %s", name)
+	}
+	imp.colls[name] = coll
+	return coll, nil
+}
+
+// flushImport writes the pending document changes, as one atomic batch
+// when there are several
+func (h *Handler) flushImport(ctx context.Context, ws *db.WALStore, imp *changelogImport) error {
+	ops := imp.pending
+	imp.pending = nil
+	if len(ops) == 0 {
+		return nil
+	}
+	if imp.deletedBy != "" {
+		ctx = wal.WithDeletedBy(ctx, imp.deletedBy)
+		imp.deletedBy = ""
+	}
+
+	switch {
+	case len(ops) > 1:
+		return ws.WriteBatch(ctx, ops)
+	case ops[0].Delete != "":
+		return ws.DeleteWithContext(ctx, ops[0].Delete)
+	default:
+		return ws.AddWithContext(ctx, ops[0].Doc)
+	}
+}
@@ -0,0 +1,93 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+)
+
+func TestHandleImportChangelog(t *testing.T) {
+	source, from := setupCollectionsTestHandler(t)
+	importChangelog := func(router http.Handler, query, body string) ChangelogImportResponse {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/admin/changelog?"+query, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var resp ChangelogImportResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("bad response: %v", err)
+		}
+		return resp
+	}
+
+	// The source's registry isn't logged, so its collection is written
+	// into the export by hand, ahead of the documents that use it
+	doJSON(from, http.MethodPost, "/collections", db.CollectionConfig{Name: "notes"})
+	ingestDoc(t, from, IngestRequest{ID: "doc-1", Source: "test", Title: "One", Text: "first", Collection: "notes"})
+	ingestDoc(t, from, IngestRequest{ID: "doc-2", Source: "test", Title: "Two", Text: "second"})
+	doJSON(from, http.MethodDelete, "/documents/doc-2", nil)
+	export := httptest.NewRecorder()
+	from.ServeHTTP(export, httptest.NewRequest(http.MethodGet, "/admin/changelog", nil))
+	changelog := `{"op":"collection","collection":"notes","config":{"name":"notes"}}` + "\n" + export.Body.String()
+
+	// A dry run validates, counting the collection the stream defines,
+	// and writes nothing
+	target, to := setupCollectionsTestHandler(t)
+	resp := importChangelog(to, "dry_run=true", changelog)
+	if !resp.DryRun || resp.Applied != 4 || resp.Documents != 2 || resp.Deletes != 1 || resp.Collections != 1 || resp.Error != "" {
+		t.Fatalf("unexpected dry run %+v", resp)
+	}
+	if target.Count() != 0 {
+		t.Fatalf("dry run stored %d documents", target.Count())
+	}
+
+	resp = importChangelog(to, "", changelog)
+	if resp.Applied != 4 || resp.Failed != 0 || resp.Error != "" || resp.NextLSN == 0 || resp.LastLSN != resp.NextLSN-1 {
+		t.Fatalf("unexpected import %+v", resp)
+	}
+	want, _ := source.Get("doc-1")
+	got, found := target.Get("doc-1")
+	if !found || got.Collection != "notes" || got.Text != "first" || !got.CreatedAt.Equal(want.CreatedAt) || got.Metadata[metaContentHash] != want.Metadata[metaContentHash] {
+		t.Errorf("expected doc-1 as exported, got %+v", got)
+	}
+	if _, found := target.Get("doc-2"); found {
+		t.Error("expected doc-2 to stay deleted")
+	}
+	if w := doJSON(to, http.MethodGet, "/collections/notes", nil); w.Code != http.StatusOK {
+		t.Errorf("expected the imported collection, got %d", w.Code)
+	}
+
+	// Invalid changes are skipped; a line out of LSN order stops the import
+	resp = importChangelog(to, "", strings.Join([]string{
+		`{"lsn":1,"op":"insert","source":"test","title":"No ID"}`,
+		`{"lsn":2,"op":"rename","doc_id":"doc-1"}`,
+		`{"lsn":3,"op":"insert","doc_id":"doc-3","source":"test","title":"Lost","collection":"missing"}`,
+		`{"lsn":5,"op":"insert","doc_id":"doc-4","source":"test","title":"Four"}`,
+		`{"lsn":4,"op":"delete","doc_id":"doc-4"}`,
+	}, "\n"))
+	codes := make([]string, len(resp.Errors))
+	for i, e := range resp.Errors {
+		codes[i] = e.Code
+	}
+	if resp.Applied != 1 || resp.Failed != 3 || strings.Join(codes, " ") != "MISSING_ID INVALID_OP COLLECTION_NOT_FOUND" || !strings.Contains(resp.Error, "LSN order") {
+		t.Errorf("unexpected import %+v", resp)
+	}
+	if _, found := target.Get("doc-4"); !found {
+		t.Error("expected doc-4 written before the out-of-order line")
+	}
+
+	// A stream without its end line, or that ends with an error, reports it
+	if resp := importChangelog(to, "", `{"op":"delete","doc_id":"doc-4"}`); resp.Applied != 1 || !strings.Contains(resp.Error, "end line") {
+		t.Errorf("expected a missing end line, got %+v", resp)
+	}
+	if resp := importChangelog(to, "", `{"op":"error","error":"disk gone"}`); !strings.Contains(resp.Error, "disk gone") {
+		t.Errorf("expected the export's error, got %+v", resp)
+	}
+}
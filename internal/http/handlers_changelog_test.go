@@ -0,0 +1,66 @@
+package httpapi
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestHandleChangelog(t *testing.T) {
+	_, router := setupWALTestHandler(t)
+	changelog := func(query string) (int, []ChangelogEntry) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/admin/changelog?"+query, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var entries []ChangelogEntry
+		for scanner := bufio.NewScanner(w.Body); scanner.Scan(); {
+			var e ChangelogEntry
+			if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+				t.Fatalf("bad changelog line %q: %v", scanner.Text(), err)
+			}
+			entries = append(entries, e)
+		}
+		return w.Code, entries
+	}
+
+	ingestDoc(t, router, IngestRequest{ID: "doc-1", Source: "test", Title: "One", Text: "first", Metadata: map[string]string{"team": "ops"}})
+	ingestDoc(t, router, IngestRequest{ID: "doc-2", Source: "test", Title: "Two", Text: "second"})
+	req := httptest.NewRequest(http.MethodDelete, "/documents/doc-1", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	code, entries := changelog("")
+	if code != http.StatusOK || len(entries) != 4 {
+		t.Fatalf("expected 3 changes and an end line, got %d %+v", code, entries)
+	}
+	if e := entries[0]; e.Op != "insert" || e.DocID != "doc-1" || e.Text != "first" || e.Metadata["team"] != "ops" || e.At == nil || e.Embedding != nil {
+		t.Errorf("unexpected insert %+v", e)
+	}
+	if e := entries[2]; e.Op != "delete" || e.DocID != "doc-1" || e.LSN <= entries[1].LSN {
+		t.Errorf("unexpected delete %+v", e)
+	}
+	end := entries[3]
+	if end.Op != "end" || end.NextLSN <= entries[2].LSN {
+		t.Fatalf("unexpected end line %+v", end)
+	}
+
+	// Continuing from the end line returns only what came after
+	ingestDoc(t, router, IngestRequest{ID: "doc-3", Source: "test", Title: "Three", Text: "third"})
+	_, entries = changelog("format=ndjson&from_lsn=" + strconv.FormatUint(end.NextLSN, 10))
+	if len(entries) != 2 || entries[0].DocID != "doc-3" || entries[1].Op != "end" {
+		t.Errorf("expected doc-3 and an end line, got %+v", entries)
+	}
+
+	// Embeddings need an export key
+	if code, _ := changelog("include_embeddings=true"); code != http.StatusForbidden {
+		t.Errorf("expected 403 for embeddings, got %d", code)
+	}
+	for _, query := range []string{"from_lsn=-1", "from_lsn=abc", "format=csv"} {
+		if code, _ := changelog(query); code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, code)
+		}
+	}
+}
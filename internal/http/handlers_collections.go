@@ -0,0 +1,148 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+	"github.com/go-chi/chi/v5"
+)
+
+// HandlePutCollection creates or replaces a collection
+func (h *Handler) HandlePutCollection(w http.ResponseWriter, r *http.Request) {
+	if h.collections == nil {
+		writeError(w, http.StatusNotImplemented, "collections are not configured", "NOT_SUPPORTED")
+		return
+	}
+
+	var cfg db.CollectionConfig
+	if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+		h.logger.Warn().Err(err).Msg("invalid collection request")
+		writeError(w, http.StatusBadRequest, "invalid JSON", "INVALID_JSON")
+		return
+	}
+	if err := cfg.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error(), "INVALID_COLLECTION")
+		return
+	}
+	if !mayUseCollection(r, cfg.Name) {
+		writeError(w, http.StatusForbidden, "this API key may not use collection "+cfg.Name, "NAMESPACE_FORBIDDEN")
+		return
+	}
+
+	_, existed, err := h.collections.Get(r.Context(), cfg.Name)
+	if err != nil {
+		h.logger.Error().Err(err).Str("collection", cfg.Name).Msg("failed to load collection")
+		writeError(w, http.StatusInternalServerError, "failed to load collection", "COLLECTION_ERROR")
+		return
+	}
+	if err := h.collections.Put(r.Context(), cfg); err != nil {
+		h.logger.Error().Err(err).Str("collection", cfg.Name).Msg("failed to store collection")
+		writeError(w, http.StatusInternalServerError, "failed to store collection", "COLLECTION_ERROR")
+		return
+	}
+	h.invalidateResults()
+
+	// Return what the registry stored, including its timestamps
+	stored, _, err := h.collections.Get(r.Context(), cfg.Name)
+	if err != nil {
+		stored = cfg
+	}
+
+	status := http.StatusCreated
+	if existed {
+		status = http.StatusOK
+	}
+	h.logger.Info().Str("collection", cfg.Name).Bool("replaced", existed).Msg("collection stored")
+	writeJSON(w, status, h.collectionResponse(stored))
+}
+
+// HandleListCollections lists the collections, including the default one,
+// that the API key may use
+func (h *Handler) HandleListCollections(w http.ResponseWriter, r *http.Request) {
+	configs, err := h.listCollections(r.Context())
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to list collections")
+		writeError(w, http.StatusInternalServerError, "failed to list collections", "COLLECTION_ERROR")
+		return
+	}
+	configs = allowedCollections(r, configs)
+
+	resp := CollectionListResponse{Collections: make([]CollectionResponse, len(configs)), Count: len(configs)}
+	for i, c := range configs {
+		resp.Collections[i] = h.collectionResponse(c)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// listCollections returns the stored collections, with the default
+// collection first when nothing is stored for it
+func (h *Handler) listCollections(ctx context.Context) ([]db.CollectionConfig, error) {
+	var stored []db.CollectionConfig
+	if h.collections != nil {
+		var err error
+		if stored, err = h.collections.List(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if !hasCollection(stored, db.DefaultCollection) {
+		stored = append([]db.CollectionConfig{db.DefaultCollectionConfig()}, stored...)
+	}
+	return stored, nil
+}
+
+// HandleGetCollection returns a single collection
+func (h *Handler) HandleGetCollection(w http.ResponseWriter, r *http.Request) {
+	coll, ok := h.resolveCollection(w, r, chi.URLParam(r, "name"))
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, h.collectionResponse(coll.CollectionConfig))
+}
+
+// HandleDeleteCollection deletes an empty collection. The default
+// collection can't be deleted.
+func (h *Handler) HandleDeleteCollection(w http.ResponseWriter, r *http.Request) {
+	if h.collections == nil {
+		writeError(w, http.StatusNotImplemented, "collections are not configured", "NOT_SUPPORTED")
+		return
+	}
+
+	name := chi.URLParam(r, "name")
+	if name == db.DefaultCollection {
+		writeError(w, http.StatusBadRequest, "the default collection can't be deleted", "INVALID_COLLECTION")
+		return
+	}
+	if _, ok := h.resolveCollection(w, r, name); !ok {
+		return
+	}
+	if count := h.store.CountCollection(name); count > 0 {
+		writeError(w, http.StatusConflict, "collection still holds documents; delete them first", "COLLECTION_NOT_EMPTY")
+		return
+	}
+
+	if err := h.collections.Delete(r.Context(), name); err != nil {
+		h.logger.Error().Err(err).Str("collection", name).Msg("failed to delete collection")
+		writeError(w, http.StatusInternalServerError, "failed to delete collection", "COLLECTION_ERROR")
+		return
+	}
+	h.invalidateResults()
+
+	h.logger.Info().Str("collection", name).Msg("collection deleted")
+	writeJSON(w, http.StatusOK, DeleteResponse{ID: name, Success: true})
+}
+
+// collectionResponse adds the document count to a collection config
+func (h *Handler) collectionResponse(cfg db.CollectionConfig) CollectionResponse {
+	return CollectionResponse{CollectionConfig: cfg, Documents: h.store.CountCollection(cfg.Name)}
+}
+
+func hasCollection(configs []db.CollectionConfig, name string) bool {
+	for _, c := range configs {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,215 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+	"github.com/go-chi/chi/v5"
+)
+
+func setupCollectionsTestHandler(t *testing.T) (*db.WALStore, *chi.Mux) {
+	t.Helper()
+	store, _ := setupWALTestHandler(t)
+	reg, err := db.NewFileCollectionRegistry(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to open registry: %v", err)
+	}
+	handler := NewHandler(store, obs.Logger("test"), WithCollections(reg))
+
+	r := chi.NewRouter()
+	r.Post("/ingest", handler.HandleIngest)
+	r.Post("/search", handler.HandleSearch)
+	r.Post("/run", handler.HandleRun)
+	r.Delete("/documents/{id}", handler.HandleDeleteDocument)
+	r.Post("/documents/{id}/move", handler.HandleMoveDocument)
+	r.Get("/documents/{id}/similar", handler.HandleSimilarDocuments)
+	r.Post("/collections", handler.HandlePutCollection)
+	r.Get("/collections", handler.HandleListCollections)
+	r.Get("/collections/{name}", handler.HandleGetCollection)
+	r.Delete("/collections/{name}", handler.HandleDeleteCollection)
+	r.Get("/admin/changelog", handler.HandleChangelog)
+	r.Post("/admin/changelog", handler.HandleImportChangelog)
+	return store, r
+}
+
+func doJSON(router http.Handler, method, path string, body any) *httptest.ResponseRecorder {
+	var reader *bytes.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(method, path, reader))
+	return w
+}
+
+func TestCollectionsCRUD(t *testing.T) {
+	_, router := setupCollectionsTestHandler(t)
+
+	w := doJSON(router, http.MethodPost, "/collections", db.CollectionConfig{Name: "notes", Chunking: db.ChunkingConfig{Size: 50, Overlap: 10}})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := doJSON(router, http.MethodPost, "/collections", db.CollectionConfig{Name: "notes", RetentionDays: 30}); w.Code != http.StatusOK {
+		t.Fatalf("expected 200 on replace, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := doJSON(router, http.MethodPost, "/collections", db.CollectionConfig{Name: "Bad Name"}); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid name, got %d", w.Code)
+	}
+
+	w = doJSON(router, http.MethodGet, "/collections/notes", nil)
+	var got CollectionResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &got)
+	if w.Code != http.StatusOK || got.RetentionDays != 30 || got.Chunking.Size != 0 {
+		t.Fatalf("expected the replaced config, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = doJSON(router, http.MethodGet, "/collections", nil)
+	var list CollectionListResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &list)
+	if list.Count != 2 || list.Collections[0].Name != db.DefaultCollection || list.Collections[1].Name != "notes" {
+		t.Fatalf("expected default and notes, got %s", w.Body.String())
+	}
+
+	ingestDoc(t, router, IngestRequest{ID: "n1", Source: "test", Title: "Note", Collection: "notes"})
+	if w := doJSON(router, http.MethodDelete, "/collections/notes", nil); w.Code != http.StatusConflict {
+		t.Errorf("expected 409 for a non-empty collection, got %d", w.Code)
+	}
+	if w := doJSON(router, http.MethodDelete, "/documents/n1", nil); w.Code != http.StatusOK {
+		t.Fatalf("document delete failed: %d", w.Code)
+	}
+	if w := doJSON(router, http.MethodDelete, "/collections/notes", nil); w.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := doJSON(router, http.MethodGet, "/collections/notes", nil); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 after delete, got %d", w.Code)
+	}
+	if w := doJSON(router, http.MethodDelete, "/collections/default", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 deleting the default collection, got %d", w.Code)
+	}
+}
+
+func TestCollectionIsolation(t *testing.T) {
+	_, router := setupCollectionsTestHandler(t)
+	doJSON(router, http.MethodPost, "/collections", db.CollectionConfig{Name: "a"})
+	doJSON(router, http.MethodPost, "/collections", db.CollectionConfig{Name: "b"})
+
+	ingestDoc(t, router, IngestRequest{ID: "a1", Source: "test", Title: "Shared words", Collection: "a"})
+	ingestDoc(t, router, IngestRequest{ID: "b1", Source: "test", Title: "Shared words", Collection: "b"})
+
+	w := doJSON(router, http.MethodPost, "/search", SearchRequest{Query: "shared words", Collection: "b"})
+	var resp SearchResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Count != 1 || resp.Results[0].DocID != "b1" || resp.Results[0].Collection != "b" {
+		t.Fatalf("expected only b1, got %s", w.Body.String())
+	}
+
+	// An ID can't move between collections by re-ingesting
+	w = doJSON(router, http.MethodPost, "/ingest", IngestRequest{ID: "a1", Source: "test", Title: "Moved", Collection: "b"})
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected 409, got %d", w.Code)
+	}
+}
+
+func TestCollectionSettingsEnforced(t *testing.T) {
+	store, router := setupCollectionsTestHandler(t)
+	doJSON(router, http.MethodPost, "/collections", db.CollectionConfig{
+		Name:          "limited",
+		Chunking:      db.ChunkingConfig{Size: 4, Overlap: 1},
+		RetentionDays: 7,
+		Quotas:        db.QuotaConfig{MaxDocuments: 3, MaxDocumentBytes: 64},
+		ACL:           db.ACLConfig{Read: []string{"team-a", "team-b"}},
+	})
+
+	// 10 words in windows of 4 with 1 overlap: 1-4, 4-7, 7-10
+	w := doJSON(router, http.MethodPost, "/ingest", IngestRequest{ID: "long", Source: "test", Title: "Long", Text: "one two three four five six seven eight nine ten", Collection: "limited"})
+	var ingest IngestResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &ingest)
+	if w.Code != http.StatusOK || ingest.Chunks != 3 {
+		t.Fatalf("expected 3 chunks, got %d %s", w.Code, w.Body.String())
+	}
+	chunk, found := store.Get("long:chunk:2")
+	if !found || chunk.Text != "four five six seven" || chunk.Metadata[metaChunkOf] != "long" || chunk.Metadata[metaACLRead] != "team-a,team-b" {
+		t.Fatalf("unexpected chunk: %+v", chunk)
+	}
+
+	cases := []struct {
+		name string
+		req  IngestRequest
+		code int
+	}{
+		{"too large", IngestRequest{ID: "big", Text: strings.Repeat("x", 65)}, http.StatusRequestEntityTooLarge},
+		{"expired", IngestRequest{ID: "old", CreatedAt: time.Now().AddDate(0, 0, -8)}, http.StatusBadRequest},
+		{"over quota", IngestRequest{ID: "extra"}, http.StatusForbidden},
+		{"replace within quota", IngestRequest{ID: "long", Text: "short now"}, http.StatusOK},
+	}
+	for _, tc := range cases {
+		tc.req.Source, tc.req.Title, tc.req.Collection = "test", "Doc", "limited"
+		if w := doJSON(router, http.MethodPost, "/ingest", tc.req); w.Code != tc.code {
+			t.Errorf("%s: expected %d, got %d: %s", tc.name, tc.code, w.Code, w.Body.String())
+		}
+	}
+
+	// Re-ingesting unchunked text replaced the chunks
+	if n := store.CountCollection("limited"); n != 1 {
+		t.Errorf("expected 1 document after replace, got %d", n)
+	}
+	for n := 1; n <= 3; n++ {
+		if _, found := store.Get(fmt.Sprintf("long:chunk:%d", n)); found {
+			t.Errorf("chunk %d should have been removed", n)
+		}
+	}
+}
+
+func TestCollectionMinScore(t *testing.T) {
+	_, router := setupCollectionsTestHandler(t)
+	doJSON(router, http.MethodPost, "/collections", db.CollectionConfig{Name: "strict", MinScore: 0.99})
+	if w := doJSON(router, http.MethodPost, "/ingest", IngestRequest{ID: "s1", Source: "test", Title: "Doc", Text: "exact match text", Collection: "strict"}); w.Code != http.StatusOK {
+		t.Fatalf("ingest failed: %d %s", w.Code, w.Body.String())
+	}
+
+	count := func(req SearchRequest) int {
+		t.Helper()
+		req.Collection = "strict"
+		var resp SearchResponse
+		_ = json.Unmarshal(doJSON(router, http.MethodPost, "/search", req).Body.Bytes(), &resp)
+		return resp.Count
+	}
+	if n := count(SearchRequest{Query: "exact match text"}); n != 1 {
+		t.Errorf("expected the exact match above the threshold, got %d", n)
+	}
+	if n := count(SearchRequest{Query: "something else"}); n != 0 {
+		t.Errorf("expected the collection threshold to drop a weak hit, got %d", n)
+	}
+	if n := count(SearchRequest{Query: "something else", MinScore: -1}); n != 1 {
+		t.Errorf("expected the request threshold to override the collection's, got %d", n)
+	}
+
+	w := doJSON(router, http.MethodPost, "/run", RunRequest{Query: "something else", Collection: "strict"})
+	var run RunResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &run)
+	if len(run.Citations) != 0 || !strings.HasPrefix(run.Answer, "No relevant documents") {
+		t.Errorf("expected a no-relevant-documents answer, got %q with %d citations", run.Answer, len(run.Citations))
+	}
+}
+
+func TestChunkText(t *testing.T) {
+	if chunks := chunkText("a b c", db.ChunkingConfig{Size: 3}); chunks != nil {
+		t.Errorf("text that fits one chunk should not be split, got %v", chunks)
+	}
+	got := chunkText("a b c d e", db.ChunkingConfig{Size: 2})
+	want := []string{"a b", "c d", "e"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
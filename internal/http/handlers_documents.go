@@ -0,0 +1,417 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/relay"
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+	"github.com/go-chi/chi/v5"
+)
+
+// documentGetter is implemented by stores that support lookup by ID
+type documentGetter interface {
+	Get(docID string) (db.Document, bool)
+}
+
+// documentDeleter is implemented by stores that support deletes
+type documentDeleter interface {
+	Delete(docID string) error
+}
+
+// deletedLister is implemented by stores that keep deleted documents until compaction
+type deletedLister interface {
+	ListDeleted(since time.Time) ([]db.DeletedDocument, error)
+	Restore(ctx context.Context, docID string) (db.Document, error)
+}
+
+// HandleGetDocument returns a single document by ID, with its stored
+// embedding if include_embedding is set and the API key may export it
+func (h *Handler) HandleGetDocument(w http.ResponseWriter, r *http.Request) {
+	getter, ok := h.store.(documentGetter)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, "document lookup is not supported by this storage backend", "NOT_SUPPORTED")
+		return
+	}
+
+	includeEmbedding := r.URL.Query().Get("include_embedding") == "true"
+	if includeEmbedding && !h.mayExportEmbeddings(w, r) {
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	doc, found := getter.Get(id)
+	if !found || !mayUseCollection(r, db.CollectionOf(doc)) {
+		writeError(w, http.StatusNotFound, "document not found", "NOT_FOUND")
+		return
+	}
+
+	resp := documentResponse(doc)
+	if includeEmbedding {
+		resp.Embedding = doc.Embedding[:]
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// HandleSimilarDocuments returns the documents most like a stored one,
+// searching its collection with its stored embedding so nothing is
+// re-embedded. A chunked document is represented by the centroid of its
+// chunks. The document and its chunks are left out of the results.
+func (h *Handler) HandleSimilarDocuments(w http.ResponseWriter, r *http.Request) {
+	getter, ok := h.store.(documentGetter)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, "document lookup is not supported by this storage backend", "NOT_SUPPORTED")
+		return
+	}
+
+	limit := 10
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 100 {
+			writeError(w, http.StatusBadRequest, "limit must be between 1 and 100", "INVALID_PARAM")
+			return
+		}
+		limit = n
+	}
+
+	id := chi.URLParam(r, "id")
+	parts := h.existingParts(getter, id)
+	if len(parts) == 0 {
+		writeError(w, http.StatusNotFound, "document not found", "NOT_FOUND")
+		return
+	}
+	var (
+		collection string
+		embs       []relay.Embedding
+	)
+	for part := range parts {
+		doc, _ := getter.Get(part)
+		collection = db.CollectionOf(doc)
+		embs = append(embs, doc.Embedding)
+	}
+	if !mayUseCollection(r, collection) {
+		writeError(w, http.StatusNotFound, "document not found", "NOT_FOUND")
+		return
+	}
+
+	coll, ok := h.resolveCollection(w, r, collection)
+	if !ok {
+		return
+	}
+
+	// Ask for enough extra results to make up for the excluded parts
+	found := h.store.SearchFiltered(relay.Centroid(embs...), limit+len(parts), coll.searchFilter(time.Now()))
+	similar := make([]db.SearchResult, 0, limit)
+	for _, res := range found {
+		if parts[res.DocID] || len(similar) == limit {
+			continue
+		}
+		similar = append(similar, res)
+	}
+	similar = aboveScore(similar, coll.MinScore)
+
+	h.meter(r, db.Usage{Searches: 1})
+
+	results := searchResults(similar)
+	writeJSON(w, http.StatusOK, SimilarResponse{DocID: id, Results: results, Count: len(results)})
+}
+
+// HandleDeleteDocument deletes a document by ID
+func (h *Handler) HandleDeleteDocument(w http.ResponseWriter, r *http.Request) {
+	_, canDelete := h.store.(documentDeleter)
+	getter, canGet := h.writeView()
+	if !canDelete || !canGet || !h.caps.Delete {
+		writeError(w, http.StatusNotImplemented, "delete is not supported by this storage backend", "NOT_SUPPORTED")
+		return
+	}
+
+	// A chunked document is deleted along with all of its chunks, including
+	// ones written but not indexed yet
+	id := chi.URLParam(r, "id")
+	parts := h.existingParts(getter, id)
+	if len(parts) == 0 || !h.mayUseParts(r, getter, parts) {
+		writeError(w, http.StatusNotFound, "document not found", "NOT_FOUND")
+		return
+	}
+
+	if err := h.deleteParts(parts); err != nil {
+		h.logger.Error().Err(err).Str("doc_id", id).Msg("failed to delete document")
+		writeError(w, http.StatusInternalServerError, "failed to delete document", "STORE_ERROR")
+		return
+	}
+	if h.aliases != nil {
+		if err := h.aliases.RemoveDoc(r.Context(), id); err != nil {
+			h.logger.Warn().Err(err).Str("doc_id", id).Msg("failed to remove aliases of deleted document")
+		}
+	}
+
+	h.logger.Info().Str("doc_id", id).Msg("document deleted")
+	writeJSON(w, http.StatusOK, DeleteResponse{ID: id, Success: true})
+}
+
+// HandleListDeleted lists recently deleted documents that are still in the WAL
+func (h *Handler) HandleListDeleted(w http.ResponseWriter, r *http.Request) {
+	lister, ok := h.store.(deletedLister)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, "deleted documents are only kept by the WAL backend", "NOT_SUPPORTED")
+		return
+	}
+
+	var since time.Time
+	if v := r.URL.Query().Get("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "since must be an RFC3339 time", "INVALID_PARAM")
+			return
+		}
+		since = t
+	}
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 1000 {
+			writeError(w, http.StatusBadRequest, "limit must be between 1 and 1000", "INVALID_PARAM")
+			return
+		}
+		limit = n
+	}
+
+	deleted, err := lister.ListDeleted(since)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to list deleted documents")
+		writeError(w, http.StatusInternalServerError, "failed to list deleted documents", "STORE_ERROR")
+		return
+	}
+	if scopedKey(r) {
+		allowed := deleted[:0]
+		for _, d := range deleted {
+			if d.Previous != nil && mayUseCollection(r, db.CollectionOf(*d.Previous)) {
+				allowed = append(allowed, d)
+			}
+		}
+		deleted = allowed
+	}
+	if len(deleted) > limit {
+		deleted = deleted[:limit]
+	}
+
+	docs := make([]DeletedDocumentResponse, len(deleted))
+	for i, d := range deleted {
+		docs[i] = DeletedDocumentResponse{ID: d.ID, DeletedBy: d.DeletedBy, Restorable: d.Previous != nil}
+		if !d.DeletedAt.IsZero() {
+			at := d.DeletedAt
+			docs[i].DeletedAt = &at
+		}
+		if d.Previous != nil {
+			docs[i].Source = d.Previous.Source
+			docs[i].Title = d.Previous.Title
+			docs[i].Collection = db.CollectionOf(*d.Previous)
+		}
+	}
+	writeJSON(w, http.StatusOK, DeletedListResponse{Documents: docs, Count: len(docs)})
+}
+
+// HandleRestoreDocument re-adds the last version of a deleted document
+func (h *Handler) HandleRestoreDocument(w http.ResponseWriter, r *http.Request) {
+	lister, ok := h.store.(deletedLister)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, "deleted documents are only kept by the WAL backend", "NOT_SUPPORTED")
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	if scopedKey(r) && !h.mayRestore(r, lister, id) {
+		writeError(w, http.StatusNotFound, "no deleted document with that id", "NOT_FOUND")
+		return
+	}
+	doc, err := lister.Restore(r.Context(), id)
+	switch {
+	case errors.Is(err, db.ErrNotDeleted):
+		writeError(w, http.StatusNotFound, "no deleted document with that id", "NOT_FOUND")
+		return
+	case errors.Is(err, db.ErrNotRestorable):
+		writeError(w, http.StatusGone, err.Error(), "NOT_RESTORABLE")
+		return
+	case err != nil:
+		h.logger.Error().Err(err).Str("doc_id", id).Msg("failed to restore document")
+		writeError(w, http.StatusInternalServerError, "failed to restore document", "STORE_ERROR")
+		return
+	}
+	h.invalidateResults()
+
+	h.logger.Info().Str("doc_id", id).Msg("document restored")
+	writeJSON(w, http.StatusOK, documentResponse(doc))
+}
+
+// documentMover is implemented by stores that rename documents atomically
+type documentMover interface {
+	MoveDocuments(ctx context.Context, moves []db.Move) error
+}
+
+// HandleMoveDocument changes a document's ID, collection, or both. A
+// chunked document moves with all of its chunks, and the old and new IDs
+// are swapped in one atomic WAL batch, so readers never see neither or
+// both. Moving to another collection re-embeds the text with its embedder.
+func (h *Handler) HandleMoveDocument(w http.ResponseWriter, r *http.Request) {
+	mover, ok := h.store.(documentMover)
+	getter, canGet := h.writeView()
+	if !ok || !canGet {
+		writeError(w, http.StatusNotImplemented, "moves need the WAL storage backend", "NOT_SUPPORTED")
+		return
+	}
+
+	var req MoveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON", "INVALID_JSON")
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	parts := h.existingParts(getter, id)
+	if len(parts) == 0 {
+		writeError(w, http.StatusNotFound, "document not found", "NOT_FOUND")
+		return
+	}
+	docs := make([]db.Document, 0, len(parts))
+	for part := range parts {
+		doc, _ := getter.Get(part)
+		docs = append(docs, doc)
+	}
+	sort.Slice(docs, func(i, j int) bool { return docs[i].ID < docs[j].ID })
+	if !mayUseCollection(r, db.CollectionOf(docs[0])) {
+		writeError(w, http.StatusNotFound, "document not found", "NOT_FOUND")
+		return
+	}
+
+	newID := req.ID
+	if newID == "" {
+		newID = id
+	}
+	from := db.CollectionOf(docs[0])
+	to := req.Collection
+	if to == "" {
+		to = from
+	}
+	if newID == id && to == from {
+		writeError(w, http.StatusBadRequest, "id or collection must change", "INVALID_MOVE")
+		return
+	}
+	if h.shards != nil {
+		if owner, local := h.shards.Owner(newID); !local {
+			writeError(w, http.StatusBadRequest, "new id belongs to shard "+owner.ID+"; moves can't cross shards", "CROSS_SHARD_MOVE")
+			return
+		}
+	}
+	coll, ok := h.resolveCollection(w, r, to)
+	if !ok {
+		return
+	}
+	if newID != id {
+		for taken := range h.existingParts(getter, newID) {
+			if !parts[taken] {
+				writeError(w, http.StatusConflict, "document already exists: "+taken, "ID_CONFLICT")
+				return
+			}
+		}
+	}
+	if limit := coll.Quotas.MaxDocuments; limit > 0 && to != from {
+		if count := h.store.CountCollection(coll.Name); count+len(docs) > limit {
+			writeError(w, http.StatusForbidden,
+				fmt.Sprintf("collection %s holds %d of %d documents", coll.Name, count, limit), "QUOTA_EXCEEDED")
+			return
+		}
+	}
+
+	moves := make([]db.Move, len(docs))
+	for i, doc := range docs {
+		moved := doc
+		moved.ID = newID
+		moved.Collection = coll.Name
+		if parent := doc.Metadata[metaChunkOf]; parent != "" {
+			n, _ := strconv.Atoi(doc.Metadata[metaChunk])
+			moved.ID = chunkID(newID, n)
+			moved.Metadata = make(map[string]string, len(doc.Metadata))
+			for k, v := range doc.Metadata {
+				moved.Metadata[k] = v
+			}
+			moved.Metadata[metaChunkOf] = newID
+		}
+		if to != from {
+			emb, _, err := coll.embed(r.Context(), moved.Text)
+			if err != nil {
+				h.writeEmbedError(w, coll, err)
+				return
+			}
+			moved.Embedding = emb
+		}
+		moves[i] = db.Move{From: doc.ID, Doc: moved}
+	}
+
+	err := mover.MoveDocuments(r.Context(), moves)
+	switch {
+	case errors.Is(err, db.ErrMoveTargetExists):
+		writeError(w, http.StatusConflict, err.Error(), "ID_CONFLICT")
+		return
+	case errors.Is(err, db.ErrMoveSourceMissing):
+		writeError(w, http.StatusNotFound, "document not found", "NOT_FOUND")
+		return
+	case err != nil:
+		h.logger.Error().Err(err).Str("doc_id", id).Msg("failed to move document")
+		writeError(w, http.StatusInternalServerError, "failed to move document", "STORE_ERROR")
+		return
+	}
+	h.invalidateResults()
+	if h.aliases != nil {
+		if err := h.aliases.Move(r.Context(), id, newID); err != nil {
+			h.logger.Warn().Err(err).Str("doc_id", id).Msg("failed to move aliases")
+		}
+	}
+
+	h.logger.Info().Str("doc_id", id).Str("new_id", newID).Str("collection", coll.Name).Int("parts", len(moves)).Msg("document moved")
+	writeJSON(w, http.StatusOK, documentResponse(moves[0].Doc))
+}
+
+// documentResponse converts a stored document
+func documentResponse(doc db.Document) DocumentResponse {
+	return DocumentResponse{
+		ID:        doc.ID,
+		Source:    doc.Source,
+		Title:     doc.Title,
+		Text:      doc.Text,
+		Metadata:  doc.Metadata,
+		CreatedAt: doc.CreatedAt,
+
+		Collection: db.CollectionOf(doc),
+	}
+}
+
+// mayUseParts reports whether the request's API key may use the collection
+// of a document's parts, which share one
+func (h *Handler) mayUseParts(r *http.Request, getter documentGetter, parts map[string]bool) bool {
+	for part := range parts {
+		doc, _ := getter.Get(part)
+		return mayUseCollection(r, db.CollectionOf(doc))
+	}
+	return true
+}
+
+// mayRestore reports whether the request's API key may use the collection
+// the deleted document id was in
+func (h *Handler) mayRestore(r *http.Request, lister deletedLister, id string) bool {
+	deleted, err := lister.ListDeleted(time.Time{})
+	if err != nil {
+		return false
+	}
+	for _, d := range deleted {
+		if d.ID == id && d.Previous != nil {
+			return mayUseCollection(r, db.CollectionOf(*d.Previous))
+		}
+	}
+	return false
+}
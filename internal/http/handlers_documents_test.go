@@ -0,0 +1,190 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+)
+
+func TestHandleGetAndDeleteDocument(t *testing.T) {
+	_, router := setupWALTestHandler(t)
+	ingestDoc(t, router, IngestRequest{ID: "doc-1", Source: "test", Title: "Hello", Text: "world"})
+
+	do := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	w := do(http.MethodGet, "/documents/doc-1")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	var doc DocumentResponse
+	_ = json.NewDecoder(w.Body).Decode(&doc)
+	if doc.ID != "doc-1" || doc.Text != "world" {
+		t.Errorf("unexpected document: %+v", doc)
+	}
+
+	if w := do(http.MethodDelete, "/documents/doc-1"); w.Code != http.StatusOK {
+		t.Fatalf("expected delete to succeed, got %d", w.Code)
+	}
+	if w := do(http.MethodGet, "/documents/doc-1"); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 after delete, got %d", w.Code)
+	}
+	if w := do(http.MethodDelete, "/documents/doc-1"); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 deleting a missing document, got %d", w.Code)
+	}
+}
+
+func TestHandleSimilarDocuments(t *testing.T) {
+	_, router := setupCollectionsTestHandler(t)
+	doJSON(router, http.MethodPost, "/collections", db.CollectionConfig{Name: "notes", Chunking: db.ChunkingConfig{Size: 4}})
+	ingestDoc(t, router, IngestRequest{ID: "doc-1", Source: "test", Title: "One", Text: "alpha"})
+	ingestDoc(t, router, IngestRequest{ID: "doc-2", Source: "test", Title: "Two", Text: "beta"})
+	ingestDoc(t, router, IngestRequest{ID: "doc-3", Source: "test", Title: "Three", Text: "gamma"})
+	ingestDoc(t, router, IngestRequest{ID: "long", Source: "test", Title: "Long", Text: "one two three four five six seven eight", Collection: "notes"})
+	ingestDoc(t, router, IngestRequest{ID: "short", Source: "test", Title: "Short", Text: "one two", Collection: "notes"})
+
+	similar := func(path string) (int, SimilarResponse) {
+		w := doJSON(router, http.MethodGet, path, nil)
+		var resp SimilarResponse
+		_ = json.NewDecoder(w.Body).Decode(&resp)
+		return w.Code, resp
+	}
+
+	code, resp := similar("/documents/doc-1/similar")
+	if code != http.StatusOK || resp.DocID != "doc-1" || resp.Count != 2 {
+		t.Fatalf("expected the 2 other default documents, got %d %+v", code, resp)
+	}
+	for _, r := range resp.Results {
+		if r.DocID == "doc-1" || r.Collection != db.DefaultCollection {
+			t.Errorf("unexpected result: %+v", r)
+		}
+	}
+	if _, resp := similar("/documents/doc-1/similar?limit=1"); resp.Count != 1 {
+		t.Errorf("expected 1 result with limit=1, got %d", resp.Count)
+	}
+
+	// A chunked document leaves out all of its chunks
+	code, resp = similar("/documents/long/similar")
+	if code != http.StatusOK || resp.Count != 1 || resp.Results[0].DocID != "short" {
+		t.Errorf("expected only the other notes document, got %d %+v", code, resp)
+	}
+
+	if code, _ := similar("/documents/missing/similar"); code != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing document, got %d", code)
+	}
+	if code, _ := similar("/documents/doc-1/similar?limit=0"); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a bad limit, got %d", code)
+	}
+}
+
+func TestHandleDeleteDocumentRequiresSupport(t *testing.T) {
+	handler, _ := setupTestHandler(t)
+
+	w := httptest.NewRecorder()
+	handler.HandleDeleteDocument(w, httptest.NewRequest(http.MethodDelete, "/documents/doc-1", nil))
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("expected status 501 on the legacy store, got %d", w.Code)
+	}
+}
+
+func TestHandleListDeletedAndRestore(t *testing.T) {
+	_, router := setupWALTestHandler(t)
+	before := time.Now().Add(-time.Second)
+	ingestDoc(t, router, IngestRequest{ID: "doc-1", Source: "test", Title: "Hello", Text: "world"})
+	ingestDoc(t, router, IngestRequest{ID: "doc-2", Source: "test", Title: "Kept", Text: "still here"})
+
+	do := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+	if w := do(http.MethodDelete, "/documents/doc-1"); w.Code != http.StatusOK {
+		t.Fatalf("delete failed: %d", w.Code)
+	}
+
+	w := do(http.MethodGet, "/documents/deleted?since="+before.UTC().Format(time.RFC3339))
+	var list DeletedListResponse
+	_ = json.NewDecoder(w.Body).Decode(&list)
+	if w.Code != http.StatusOK || list.Count != 1 {
+		t.Fatalf("expected one deleted document, got %d %+v", w.Code, list)
+	}
+	d := list.Documents[0]
+	if d.ID != "doc-1" || !d.Restorable || d.Title != "Hello" || d.DeletedAt == nil || d.DeletedAt.Before(before) {
+		t.Errorf("unexpected deleted document: %+v", d)
+	}
+
+	if w := do(http.MethodGet, "/documents/deleted?since=yesterday"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a bad since, got %d", w.Code)
+	}
+	if w := do(http.MethodGet, "/documents/deleted?since="+time.Now().Add(time.Hour).UTC().Format(time.RFC3339)); !strings.Contains(w.Body.String(), `"count":0`) {
+		t.Errorf("expected nothing deleted after a future since, got %s", w.Body.String())
+	}
+
+	if w := do(http.MethodPost, "/documents/doc-1/restore"); w.Code != http.StatusOK {
+		t.Fatalf("restore failed: %d %s", w.Code, w.Body.String())
+	}
+	w = do(http.MethodGet, "/documents/doc-1")
+	var doc DocumentResponse
+	_ = json.NewDecoder(w.Body).Decode(&doc)
+	if w.Code != http.StatusOK || doc.Text != "world" {
+		t.Errorf("expected the restored document, got %d %+v", w.Code, doc)
+	}
+	if w := do(http.MethodPost, "/documents/doc-2/restore"); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 restoring a live document, got %d", w.Code)
+	}
+	if w := do(http.MethodGet, "/documents/deleted"); !strings.Contains(w.Body.String(), `"count":0`) {
+		t.Errorf("restored documents should no longer be listed, got %s", w.Body.String())
+	}
+}
+
+func TestHandleMoveDocument(t *testing.T) {
+	store, router := setupCollectionsTestHandler(t)
+	doJSON(router, http.MethodPost, "/collections", map[string]any{"name": "notes", "chunking": map[string]int{"size": 3}})
+	ingestDoc(t, router, IngestRequest{ID: "plan", Source: "test", Title: "Plan", Text: "one two three four five", Collection: "notes"})
+	ingestDoc(t, router, IngestRequest{ID: "taken", Source: "test", Title: "Taken"})
+
+	// The chunks move with the document
+	w := doJSON(router, http.MethodPost, "/documents/plan/move", MoveRequest{ID: "plan-2026"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("move failed: %d %s", w.Code, w.Body.String())
+	}
+	if _, found := store.Get("plan:chunk:1"); found {
+		t.Error("old chunk still exists")
+	}
+	chunk, found := store.Get("plan-2026:chunk:2")
+	if !found || chunk.Metadata["chunk_of"] != "plan-2026" || chunk.Collection != "notes" {
+		t.Errorf("moved chunk = %+v (found=%v)", chunk, found)
+	}
+
+	// To another collection, keeping the ID
+	if w := doJSON(router, http.MethodPost, "/documents/taken/move", MoveRequest{Collection: "notes"}); w.Code != http.StatusOK {
+		t.Fatalf("collection move failed: %d %s", w.Code, w.Body.String())
+	}
+	if d, _ := store.Get("taken"); d.Collection != "notes" {
+		t.Errorf("taken is in %q, want notes", d.Collection)
+	}
+
+	tests := []struct {
+		path string
+		req  MoveRequest
+		code int
+	}{
+		{"/documents/missing/move", MoveRequest{ID: "x"}, http.StatusNotFound},
+		{"/documents/taken/move", MoveRequest{}, http.StatusBadRequest},
+		{"/documents/taken/move", MoveRequest{ID: "plan-2026:chunk:1"}, http.StatusConflict},
+		{"/documents/taken/move", MoveRequest{Collection: "nope"}, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if w := doJSON(router, http.MethodPost, tt.path, tt.req); w.Code != tt.code {
+			t.Errorf("%s %+v = %d, want %d", tt.path, tt.req, w.Code, tt.code)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/dsjohal14/selfstack/internal/libs/flags"
+	"github.com/dsjohal14/selfstack/internal/relay"
+	"github.com/go-chi/chi/v5"
+)
+
+// WithFlags gates subsystems on fs instead of the flag defaults
+func WithFlags(fs *flags.Set) HandlerOption {
+	return func(h *Handler) {
+		h.flags = fs
+	}
+}
+
+// rerankerOf returns the collection's reranker, or nil while the reranker
+// flag is off
+func (h *Handler) rerankerOf(coll *collection) relay.Reranker {
+	if !h.flags.Enabled(flags.Reranker) {
+		return nil
+	}
+	return coll.reranker
+}
+
+// HandleListFlags returns every feature flag with its current value
+func (h *Handler) HandleListFlags(w http.ResponseWriter, _ *http.Request) {
+	states := h.flags.List()
+	writeJSON(w, http.StatusOK, FlagsResponse{Flags: states, Count: len(states)})
+}
+
+// HandleSetFlag overrides a feature flag until the override is cleared
+func (h *Handler) HandleSetFlag(w http.ResponseWriter, r *http.Request) {
+	var req SetFlagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Enabled == nil {
+		writeError(w, http.StatusBadRequest, `body must be {"enabled": true|false}`, "INVALID_JSON")
+		return
+	}
+	name := chi.URLParam(r, "name")
+	if err := h.flags.Override(r.Context(), name, *req.Enabled); err != nil {
+		h.writeFlagError(w, name, err)
+		return
+	}
+	// Cached results may have been computed with the old value
+	h.invalidateResults()
+
+	h.logger.Info().Str("flag", name).Bool("enabled", *req.Enabled).Msg("feature flag overridden")
+	writeJSON(w, http.StatusOK, h.flags.Get(name))
+}
+
+// HandleClearFlag drops a runtime override, so config or the default
+// applies again
+func (h *Handler) HandleClearFlag(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	if err := h.flags.ClearOverride(r.Context(), name); err != nil {
+		h.writeFlagError(w, name, err)
+		return
+	}
+	h.invalidateResults()
+
+	h.logger.Info().Str("flag", name).Msg("feature flag override cleared")
+	writeJSON(w, http.StatusOK, h.flags.Get(name))
+}
+
+func (h *Handler) writeFlagError(w http.ResponseWriter, name string, err error) {
+	if errors.Is(err, flags.ErrUnknownFlag) {
+		writeError(w, http.StatusNotFound, err.Error(), "FLAG_NOT_FOUND")
+		return
+	}
+	h.logger.Error().Err(err).Str("flag", name).Msg("failed to change feature flag")
+	writeError(w, http.StatusInternalServerError, "failed to change feature flag", "STORE_ERROR")
+}
@@ -0,0 +1,65 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/dsjohal14/selfstack/internal/libs/flags"
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestHandleFlags(t *testing.T) {
+	store, _ := setupWALTestHandler(t)
+	handler := NewHandler(store, obs.Logger("test"), WithFlags(flags.Defaults()))
+	r := chi.NewRouter()
+	r.Post("/ingest", handler.HandleIngest)
+	r.Post("/run", handler.HandleRun)
+	r.Get("/admin/flags", handler.HandleListFlags)
+	r.Put("/admin/flags/{name}", handler.HandleSetFlag)
+	r.Delete("/admin/flags/{name}", handler.HandleClearFlag)
+
+	ingestDoc(t, r, IngestRequest{ID: "d1", Source: "test", Title: "Deploys", Text: "How deploys are rolled back"})
+	subQueries := func() []string {
+		t.Helper()
+		w := doJSON(r, http.MethodPost, "/run", RunRequest{Query: "how are deploys rolled back?", Strategy: StrategyMultiQuery, Debug: true})
+		var resp RunResponse
+		_ = json.NewDecoder(w.Body).Decode(&resp)
+		return resp.SubQueries
+	}
+	if len(subQueries()) < 2 {
+		t.Fatal("expected multi-query retrieval while the flag is on")
+	}
+
+	w := doJSON(r, http.MethodPut, "/admin/flags/multi_query", map[string]bool{"enabled": false})
+	var st flags.State
+	_ = json.NewDecoder(w.Body).Decode(&st)
+	if w.Code != http.StatusOK || st.Enabled || st.Source != flags.SourceOverride {
+		t.Fatalf("unexpected override response: %d %s", w.Code, w.Body.String())
+	}
+	if got := subQueries(); got != nil {
+		t.Errorf("expected a single query with the flag off, got %v", got)
+	}
+
+	if w := doJSON(r, http.MethodDelete, "/admin/flags/multi_query", nil); w.Code != http.StatusOK {
+		t.Errorf("expected 200 clearing the override, got %d", w.Code)
+	}
+	if len(subQueries()) < 2 {
+		t.Error("expected multi-query retrieval back after clearing the override")
+	}
+
+	if w := doJSON(r, http.MethodPut, "/admin/flags/hnsw", map[string]bool{"enabled": true}); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown flag, got %d", w.Code)
+	}
+	if w := doJSON(r, http.MethodPut, "/admin/flags/mmr", map[string]string{}); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without enabled, got %d", w.Code)
+	}
+
+	w = doJSON(r, http.MethodGet, "/admin/flags", nil)
+	var list FlagsResponse
+	_ = json.NewDecoder(w.Body).Decode(&list)
+	if list.Count != 3 || list.Flags[0].Name != flags.MMR {
+		t.Errorf("expected the three flags sorted by name, got %s", w.Body.String())
+	}
+}
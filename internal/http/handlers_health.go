@@ -5,8 +5,14 @@ import "net/http"
 // HandleHealth returns API health status and document count
 func (h *Handler) HandleHealth(w http.ResponseWriter, _ *http.Request) {
 	resp := HealthResponse{
-		Status:   "healthy",
-		DocCount: h.store.Count(),
+		Status:       "healthy",
+		DocCount:     h.store.Count(),
+		Capabilities: h.caps,
+	}
+	if bundles := h.diag.Bundles(); len(bundles) > 0 {
+		resp.Status = "degraded"
+		resp.Panics = len(bundles)
+		resp.LastPanic = &bundles[len(bundles)-1]
 	}
 
 	h.logger.Debug().Int("doc_count", h.store.Count()).Msg("health check")
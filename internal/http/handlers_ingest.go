@@ -1,14 +1,37 @@
 package httpapi
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"sort"
 	"time"
 
-	"github.com/dsjohal14/selfstack/internal/relay"
+	"github.com/dsjohal14/selfstack/internal/libs/membudget"
 	"github.com/dsjohal14/selfstack/internal/scope/db"
+	"github.com/dsjohal14/selfstack/internal/scope/ingest"
 )
 
+// committer is a store that can acknowledge writes at a per-request
+// consistency level. Other backends write synchronously and ignore it.
+type committer interface {
+	AddWithContext(ctx context.Context, doc db.Document) error
+	Commit(ctx context.Context, c db.Consistency) error
+}
+
+// operationLog is a store that remembers which documents a client
+// operation wrote, so retried ingests can be recognized
+type operationLog interface {
+	OperationApplied(opID, docID string) bool
+}
+
+// maxOpIDLen caps the length of an ingest's operation ID
+const maxOpIDLen = 128
+
 // HandleIngest ingests a new document into the system
 // Validates required fields per Doc contract schema
 func (h *Handler) HandleIngest(w http.ResponseWriter, r *http.Request) {
@@ -35,32 +58,220 @@ func (h *Handler) HandleIngest(w http.ResponseWriter, r *http.Request) {
 	if req.Text == "" {
 		req.Text = req.Title // Use title as text if empty
 	}
+	if err := validateAliases(req.Aliases); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error(), "INVALID_ALIAS")
+		return
+	}
+	if req.OpID == "" {
+		req.OpID = r.Header.Get("Idempotency-Key")
+	}
+	if len(req.OpID) > maxOpIDLen {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("op_id is longer than %d bytes", maxOpIDLen), "INVALID_OP_ID")
+		return
+	}
+	consistency, err := db.ParseConsistency(req.Consistency)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error(), "INVALID_CONSISTENCY")
+		return
+	}
+	priority, err := h.ingestPriority(r, req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error(), "INVALID_PRIORITY")
+		return
+	}
+
+	// Bulk ingests wait for an idle moment; interactive ones hold them off
+	if priority == IngestBulk {
+		h.enqueueBulk(w, r, req)
+		return
+	}
+	if h.bulk != nil {
+		h.bulk.interactive.Add(1)
+		defer h.bulk.interactive.Add(-1)
+	}
+	h.ingest(w, r, req, consistency)
+}
+
+// ingest stores a validated ingest request: it routes it to the owning
+// shard, runs the hooks, enforces the collection's settings, chunks and
+// embeds the document, and writes it at the given consistency
+func (h *Handler) ingest(w http.ResponseWriter, r *http.Request, req IngestRequest, consistency db.Consistency) {
+	// In a sharded deployment only the shard owning the ID stores it
+	if h.routeIngest(w, r, req) {
+		return
+	}
 
 	// Set created_at if not provided
+	createdAt := req.CreatedAt
 	if req.CreatedAt.IsZero() {
 		req.CreatedAt = time.Now()
 	}
 
-	// Generate embedding from text (AI layer - relay)
-	embedding := relay.DeterministicEmbed(req.Text)
+	coll, ok := h.resolveCollection(w, r, req.Collection)
+	if !ok {
+		return
+	}
 
-	// Create document
+	// Create document and let the pre-ingest hooks enrich or reject it
 	doc := db.Document{
-		ID:        req.ID,
-		Source:    req.Source,
-		Title:     req.Title,
-		Text:      req.Text,
-		Metadata:  req.Metadata,
-		CreatedAt: req.CreatedAt,
-		Embedding: embedding,
+		ID:         req.ID,
+		Source:     req.Source,
+		Title:      req.Title,
+		Text:       req.Text,
+		Metadata:   withACLDefaults(req.Metadata, coll.ACL),
+		CreatedAt:  req.CreatedAt,
+		Collection: coll.Name,
+	}
+	if err := h.hooks.RunPre(r.Context(), &doc); err != nil {
+		if ingest.IsVeto(err) {
+			h.logger.Info().Err(err).Str("doc_id", req.ID).Msg("document rejected by hook")
+			writeError(w, http.StatusUnprocessableEntity, err.Error(), "DOCUMENT_REJECTED")
+			return
+		}
+		h.logger.Error().Err(err).Str("doc_id", req.ID).Msg("pre-ingest hook failed")
+		writeError(w, http.StatusInternalServerError, "pre-ingest hook failed", "HOOK_ERROR")
+		return
 	}
 
-	// Store document
-	if err := h.store.Add(doc); err != nil {
-		h.logger.Error().Err(err).Str("doc_id", req.ID).Msg("failed to store document")
-		writeError(w, http.StatusInternalServerError, "failed to store document", "STORE_ERROR")
+	// Enforce collection settings before anything is written
+	if limit := coll.Quotas.MaxDocumentBytes; limit > 0 && len(doc.Text) > limit {
+		writeError(w, http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("text is %d bytes, collection %s allows %d", len(doc.Text), coll.Name, limit), "DOCUMENT_TOO_LARGE")
 		return
 	}
+	if cutoff := coll.RetentionCutoff(time.Now()); !cutoff.IsZero() && doc.CreatedAt.Before(cutoff) {
+		writeError(w, http.StatusBadRequest,
+			fmt.Sprintf("created_at is older than the %d day retention of collection %s", coll.RetentionDays, coll.Name), "EXPIRED_DOCUMENT")
+		return
+	}
+
+	// Documents replaced by this ingest: the whole doc or its chunks,
+	// including ones an earlier ingest wrote but hasn't indexed yet
+	getter, canGet := h.writeView()
+	stale := h.existingParts(getter, req.ID)
+	if canGet {
+		for id := range stale {
+			if prev, _ := getter.Get(id); db.CollectionOf(prev) != coll.Name {
+				writeError(w, http.StatusConflict,
+					fmt.Sprintf("document %s belongs to collection %s", req.ID, db.CollectionOf(prev)), "COLLECTION_MISMATCH")
+				return
+			}
+		}
+	}
+
+	// Split into chunks when the collection asks for it
+	doc.Metadata = withContentHash(doc)
+	chunks := chunkText(doc.Text, coll.Chunking)
+	docs := chunkDocs(doc, chunks)
+
+	// A retry of an ingest that was already written, e.g. after the
+	// client timed out, is answered without embedding or writing it again
+	if h.replayed(req.OpID, docs) {
+		h.logger.Info().Str("doc_id", req.ID).Str("op_id", req.OpID).Msg("ingest already applied")
+		if err := h.setAliases(r, req.ID, req.Aliases); err != nil {
+			h.logger.Error().Err(err).Str("doc_id", req.ID).Msg("failed to store aliases")
+			writeError(w, http.StatusInternalServerError, "failed to store aliases", "ALIAS_ERROR")
+			return
+		}
+		writeJSON(w, http.StatusOK, IngestResponse{
+			ID:       req.ID,
+			Success:  true,
+			Message:  "ingest already applied",
+			Chunks:   len(chunks),
+			Replayed: true,
+		})
+		return
+	}
+
+	// Connectors re-deliver unchanged documents every sync; skip those
+	// instead of writing (and embedding) the same version again
+	if h.unchanged(stale, docs, createdAt) {
+		h.logger.Debug().Str("doc_id", req.ID).Str("collection", coll.Name).Msg("document unchanged")
+		if err := h.setAliases(r, req.ID, req.Aliases); err != nil {
+			h.logger.Error().Err(err).Str("doc_id", req.ID).Msg("failed to store aliases")
+			writeError(w, http.StatusInternalServerError, "failed to store aliases", "ALIAS_ERROR")
+			return
+		}
+		writeJSON(w, http.StatusOK, IngestResponse{
+			ID:        req.ID,
+			Success:   true,
+			Message:   "document unchanged",
+			Chunks:    len(chunks),
+			Unchanged: true,
+		})
+		return
+	}
+
+	if limit := coll.Quotas.MaxDocuments; limit > 0 {
+		// Replaced parts are overwritten or deleted, so only the net change counts
+		if count := h.store.CountCollection(coll.Name); count+len(docs)-len(stale) > limit {
+			writeError(w, http.StatusForbidden,
+				fmt.Sprintf("collection %s holds %d of %d documents", coll.Name, count, limit), "QUOTA_EXCEEDED")
+			return
+		}
+	}
+
+	// Writes at a requested consistency are committed together after the
+	// last one; writes under an operation ID are recorded with it
+	commit, _ := h.store.(committer)
+	add := h.store.Add
+	ctx := r.Context()
+	if req.OpID != "" {
+		ctx = db.WithOperationID(ctx, req.OpID)
+	}
+	if commit != nil && (consistency != db.ConsistencyDefault || req.OpID != "") {
+		if consistency != db.ConsistencyDefault {
+			ctx = db.WithConsistency(ctx, consistency)
+		}
+		add = func(doc db.Document) error { return commit.AddWithContext(ctx, doc) }
+	}
+
+	// Generate embeddings with the collection's embedder (AI layer - relay)
+	// before storing anything, so an unavailable embedder leaves no partial
+	// document behind
+	for i := range docs {
+		emb, fallback, err := coll.embed(ctx, docs[i].Text)
+		if err != nil {
+			h.writeEmbedError(w, coll, err)
+			return
+		}
+		docs[i].Embedding = emb
+		if fallback != "" {
+			if docs[i].Metadata == nil {
+				docs[i].Metadata = make(map[string]string, 1)
+			}
+			docs[i].Metadata[metaEmbeddingFallback] = fallback
+		}
+	}
+
+	for i := range docs {
+		if err := add(docs[i]); err != nil {
+			if errors.Is(err, membudget.ErrExceeded) {
+				h.logger.Warn().Err(err).Str("doc_id", docs[i].ID).Msg("index memory budget exceeded")
+				writeError(w, http.StatusInsufficientStorage, err.Error(), "INDEX_MEMORY_EXCEEDED")
+				return
+			}
+			h.logger.Error().Err(err).Str("doc_id", docs[i].ID).Msg("failed to store document")
+			writeError(w, http.StatusInternalServerError, "failed to store document", "STORE_ERROR")
+			return
+		}
+		h.invalidateResults()
+		delete(stale, docs[i].ID)
+	}
+
+	if err := h.deleteParts(stale); err != nil {
+		h.logger.Error().Err(err).Str("doc_id", req.ID).Msg("failed to remove replaced chunks")
+		writeError(w, http.StatusInternalServerError, "failed to remove replaced chunks", "STORE_ERROR")
+		return
+	}
+
+	if commit != nil && consistency != db.ConsistencyDefault {
+		if err := commit.Commit(ctx, consistency); err != nil {
+			h.logger.Error().Err(err).Str("doc_id", req.ID).Str("consistency", string(consistency)).Msg("failed to commit document")
+			writeError(w, http.StatusInternalServerError, "failed to commit document", "STORE_ERROR")
+			return
+		}
+	}
 
 	// Flush to disk for legacy file-based store only
 	// WALStore handles its own durability via sync policy and doesn't need explicit flush
@@ -72,15 +283,154 @@ func (h *Handler) HandleIngest(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	usage := db.Usage{IngestedDocs: int64(len(docs)), IngestedBytes: int64(len(doc.Text))}
+	for i := range docs {
+		usage.Tokens += estimateTokens(docs[i].Text)
+	}
+	h.meter(r, usage)
+
+	if err := h.setAliases(r, req.ID, req.Aliases); err != nil {
+		h.logger.Error().Err(err).Str("doc_id", req.ID).Msg("failed to store aliases")
+		writeError(w, http.StatusInternalServerError, "document stored but its aliases were not", "ALIAS_ERROR")
+		return
+	}
+
+	if err := h.hooks.RunPost(r.Context(), doc); err != nil {
+		h.logger.Warn().Err(err).Str("doc_id", req.ID).Msg("post-ingest hook failed")
+	}
+
 	h.logger.Info().
 		Str("doc_id", req.ID).
-		Str("source", req.Source).
-		Str("title", req.Title).
+		Str("source", doc.Source).
+		Str("title", doc.Title).
+		Str("collection", coll.Name).
+		Int("chunks", len(chunks)).
 		Msg("document ingested")
 
 	writeJSON(w, http.StatusOK, IngestResponse{
 		ID:      req.ID,
 		Success: true,
 		Message: "document ingested successfully",
+		Chunks:  len(chunks),
 	})
 }
+
+// withContentHash returns the metadata of doc with its content hash: a
+// SHA-256 of the source, title, text, and metadata
+func withContentHash(doc db.Document) map[string]string {
+	keys := make([]string, 0, len(doc.Metadata))
+	for k := range doc.Metadata {
+		if k != metaContentHash {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	hash := sha256.New()
+	for _, field := range []string{doc.Source, doc.Title, doc.Text} {
+		fmt.Fprintf(hash, "%d:%s", len(field), field)
+	}
+	metadata := make(map[string]string, len(keys)+1)
+	for _, k := range keys {
+		fmt.Fprintf(hash, "%d:%s%d:%s", len(k), k, len(doc.Metadata[k]), doc.Metadata[k])
+		metadata[k] = doc.Metadata[k]
+	}
+	metadata[metaContentHash] = hex.EncodeToString(hash.Sum(nil))
+	return metadata
+}
+
+// unchanged reports whether the stored parts of a document are exactly
+// docs with the same content hash (and created_at, when the ingest set
+// one). Parts stored with a fallback embedding count as changed, so
+// re-delivering them re-embeds them.
+func (h *Handler) unchanged(stale map[string]bool, docs []db.Document, createdAt time.Time) bool {
+	getter, ok := h.writeView()
+	if !ok || len(stale) != len(docs) {
+		return false
+	}
+	for _, doc := range docs {
+		prev, found := getter.Get(doc.ID)
+		if !found || !stale[doc.ID] ||
+			prev.Metadata[metaContentHash] != doc.Metadata[metaContentHash] ||
+			prev.Metadata[metaEmbeddingFallback] != "" ||
+			(!createdAt.IsZero() && !prev.CreatedAt.Equal(createdAt)) {
+			return false
+		}
+	}
+	return true
+}
+
+// replayed reports whether the operation opID already wrote every part of
+// a document. Backends that don't track operations never replay.
+func (h *Handler) replayed(opID string, docs []db.Document) bool {
+	ops, ok := h.store.(operationLog)
+	if opID == "" || !ok {
+		return false
+	}
+	for _, doc := range docs {
+		if !ops.OperationApplied(opID, doc.ID) {
+			return false
+		}
+	}
+	return true
+}
+
+// pendingGetter is a store that can look documents up as its writes see
+// them, including writes not indexed yet (see WAL_ASYNC_APPLY)
+type pendingGetter interface {
+	GetLatest(docID string) (db.Document, bool)
+}
+
+// latestGetter looks documents up with GetLatest
+type latestGetter struct{ pendingGetter }
+
+func (g latestGetter) Get(docID string) (db.Document, bool) {
+	return g.GetLatest(docID)
+}
+
+// writeView returns the document lookup of handlers that read a document
+// before replacing it, which must see the writes before theirs even when
+// they aren't indexed yet. ok is false for backends without lookup.
+func (h *Handler) writeView() (getter documentGetter, ok bool) {
+	if p, ok := h.store.(pendingGetter); ok {
+		return latestGetter{p}, true
+	}
+	getter, ok = h.store.(documentGetter)
+	return getter, ok
+}
+
+// existingParts returns the stored IDs of a document as getter sees them:
+// the document itself and any chunks it was split into. A nil getter, of a
+// backend without lookup, returns none.
+func (h *Handler) existingParts(getter documentGetter, docID string) map[string]bool {
+	parts := make(map[string]bool)
+	if getter == nil {
+		return parts
+	}
+	if _, found := getter.Get(docID); found {
+		parts[docID] = true
+	}
+	for n := 1; ; n++ {
+		id := chunkID(docID, n)
+		if _, found := getter.Get(id); !found {
+			break
+		}
+		parts[id] = true
+	}
+	return parts
+}
+
+// deleteParts deletes the given documents; backends without deletes keep them
+func (h *Handler) deleteParts(ids map[string]bool) error {
+	deleter, ok := h.store.(documentDeleter)
+	if !ok || !h.caps.Delete {
+		return nil
+	}
+	for id := range ids {
+		if err := deleter.Delete(id); err != nil {
+			return fmt.Errorf("failed to delete %s: %w", id, err)
+		}
+		h.invalidateResults()
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/membudget"
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+	"github.com/dsjohal14/selfstack/internal/scope/db/wal"
+	"github.com/dsjohal14/selfstack/internal/scope/ingest"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestIngestHooks(t *testing.T) {
+	store, _ := setupWALTestHandler(t)
+
+	var posted []string
+	hooks := ingest.NewHooks()
+	hooks.AddPre("enrich", func(_ context.Context, doc *db.Document) error {
+		if doc.Metadata == nil {
+			doc.Metadata = make(map[string]string)
+		}
+		doc.Metadata["enriched"] = "yes"
+		return nil
+	})
+	hooks.AddPre("veto", func(_ context.Context, doc *db.Document) error {
+		switch doc.Source {
+		case "spam":
+			return ingest.Veto("spam source")
+		case "flaky":
+			return errors.New("dependency down")
+		}
+		return nil
+	})
+	hooks.AddPost("record", func(_ context.Context, doc db.Document) error {
+		posted = append(posted, doc.ID)
+		return errors.New("post failures don't fail the ingest")
+	})
+	handler := NewHandler(store, obs.Logger("test"), WithIngestHooks(hooks))
+	r := chi.NewRouter()
+	r.Post("/ingest", handler.HandleIngest)
+
+	ingestDoc(t, r, IngestRequest{ID: "ok", Source: "test", Title: "Fine"})
+	if doc, _ := store.Get("ok"); doc.Metadata["enriched"] != "yes" {
+		t.Errorf("expected the pre hook's metadata, got %v", doc.Metadata)
+	}
+	if len(posted) != 1 || posted[0] != "ok" {
+		t.Errorf("expected the post hook to see ok, got %v", posted)
+	}
+
+	if w := doJSON(r, http.MethodPost, "/ingest", IngestRequest{ID: "s", Source: "spam", Title: "Buy"}); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422 for a vetoed document, got %d", w.Code)
+	}
+	if w := doJSON(r, http.MethodPost, "/ingest", IngestRequest{ID: "f", Source: "flaky", Title: "Doc"}); w.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500 for a failing hook, got %d", w.Code)
+	}
+	if _, found := store.Get("s"); found {
+		t.Error("vetoed document should not be stored")
+	}
+	if len(posted) != 1 {
+		t.Errorf("post hooks should only run for stored documents, got %v", posted)
+	}
+}
+
+func TestIngestConsistency(t *testing.T) {
+	store, router := setupWALTestHandler(t, func(c *db.WALStoreConfig) {
+		c.SyncPolicy = wal.SyncPolicy{Interval: 5 * time.Millisecond}
+	})
+
+	for _, level := range []string{"fsync", "batched", "async"} {
+		doc := IngestRequest{ID: "doc-" + level, Source: "test", Title: "Doc", Consistency: level}
+		if w := doJSON(router, http.MethodPost, "/ingest", doc); w.Code != http.StatusOK {
+			t.Errorf("%s ingest failed: %d %s", level, w.Code, w.Body.String())
+		}
+		if _, ok := store.Get(doc.ID); !ok {
+			t.Errorf("%s: document not stored", level)
+		}
+	}
+
+	w := doJSON(router, http.MethodPost, "/ingest", IngestRequest{ID: "x", Source: "test", Title: "Doc", Consistency: "eventual"})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown consistency, got %d", w.Code)
+	}
+}
+
+func TestIngestUnchanged(t *testing.T) {
+	store, r := setupWALTestHandler(t)
+
+	doc := IngestRequest{ID: "feed-1", Source: "rss", Title: "Post", Text: "Same text", Metadata: map[string]string{"url": "https://example.com/1"}}
+	send := func(req IngestRequest) IngestResponse {
+		t.Helper()
+		w := doJSON(r, http.MethodPost, "/ingest", req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("ingest failed: %d %s", w.Code, w.Body.String())
+		}
+		var resp IngestResponse
+		_ = json.NewDecoder(w.Body).Decode(&resp)
+		return resp
+	}
+
+	if resp := send(doc); resp.Unchanged {
+		t.Fatal("expected the first ingest to be written")
+	}
+	lsn := store.IndexLSN()
+
+	if resp := send(doc); !resp.Unchanged {
+		t.Error("expected a re-delivery to be unchanged")
+	}
+	if store.IndexLSN() != lsn {
+		t.Errorf("expected no WAL write for an unchanged document, LSN went from %d to %d", lsn, store.IndexLSN())
+	}
+
+	doc.Metadata = map[string]string{"url": "https://example.com/1", "author": "kim"}
+	if resp := send(doc); resp.Unchanged {
+		t.Error("expected new metadata to be written")
+	}
+	doc.CreatedAt = time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	if resp := send(doc); resp.Unchanged {
+		t.Error("expected a new created_at to be written")
+	}
+	if resp := send(doc); !resp.Unchanged {
+		t.Error("expected the same created_at to be unchanged")
+	}
+}
+
+func TestIngestOperationID(t *testing.T) {
+	store, r := setupWALTestHandler(t)
+	send := func(req IngestRequest, key string) IngestResponse {
+		t.Helper()
+		body, _ := json.Marshal(req)
+		httpReq := httptest.NewRequest(http.MethodPost, "/ingest", bytes.NewReader(body))
+		if key != "" {
+			httpReq.Header.Set("Idempotency-Key", key)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httpReq)
+		if w.Code != http.StatusOK {
+			t.Fatalf("ingest failed: %d %s", w.Code, w.Body.String())
+		}
+		var resp IngestResponse
+		_ = json.NewDecoder(w.Body).Decode(&resp)
+		return resp
+	}
+
+	// Retries get new created_at values, so only the key recognizes them
+	doc := IngestRequest{ID: "doc-1", Source: "test", Title: "Doc", Text: "first", CreatedAt: time.Now()}
+	if resp := send(doc, "retry-1"); resp.Replayed {
+		t.Fatal("expected the first ingest to be written")
+	}
+	lsn := store.IndexLSN()
+	doc.CreatedAt = doc.CreatedAt.Add(time.Second)
+	if resp := send(doc, "retry-1"); !resp.Replayed || !resp.Success {
+		t.Errorf("expected the retry to be replayed, got %+v", resp)
+	}
+	doc.OpID = "retry-1"
+	if resp := send(doc, ""); !resp.Replayed || store.IndexLSN() != lsn {
+		t.Errorf("expected op_id to replay too without a WAL write, got %+v", resp)
+	}
+
+	// Another operation, or another document under the same key, is written
+	doc.OpID, doc.Text = "retry-2", "second"
+	if resp := send(doc, ""); resp.Replayed {
+		t.Error("expected a new operation to be written")
+	}
+	if resp := send(IngestRequest{ID: "doc-2", Source: "test", Title: "Doc"}, "retry-1"); resp.Replayed {
+		t.Error("expected another document under the key to be written")
+	}
+	if stored, _ := store.Get("doc-1"); stored.Text != "second" {
+		t.Errorf("expected the second operation's text, got %q", stored.Text)
+	}
+
+	w := doJSON(r, http.MethodPost, "/ingest", IngestRequest{ID: "x", Source: "test", Title: "Doc", OpID: strings.Repeat("k", maxOpIDLen+1)})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an overlong op_id, got %d", w.Code)
+	}
+}
+
+func TestIngestRefusedOverIndexBudget(t *testing.T) {
+	budget := membudget.New(membudget.ModuleIndex, 1, nil)
+	_, r := setupWALTestHandler(t, func(c *db.WALStoreConfig) { c.IndexBudget = budget })
+
+	w := doJSON(r, http.MethodPost, "/ingest", IngestRequest{ID: "doc-1", Source: "test", Title: "Too big"})
+	if w.Code != http.StatusInsufficientStorage {
+		t.Fatalf("expected 507 over the index budget, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Code != "INDEX_MEMORY_EXCEEDED" {
+		t.Errorf("expected INDEX_MEMORY_EXCEEDED, got %q", resp.Code)
+	}
+
+	// Reads keep working
+	if w := doJSON(r, http.MethodPost, "/search", SearchRequest{Query: "anything"}); w.Code != http.StatusOK {
+		t.Errorf("expected search to keep working, got %d", w.Code)
+	}
+}
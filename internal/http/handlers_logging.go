@@ -0,0 +1,45 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+	"github.com/go-chi/chi/v5"
+)
+
+// HandleGetLogLevels returns the default log level and per-module overrides
+func (h *Handler) HandleGetLogLevels(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, obs.Levels())
+}
+
+// HandleSetLogLevel changes a module's log level until the process exits;
+// the module "default" changes the level of modules without an override
+func (h *Handler) HandleSetLogLevel(w http.ResponseWriter, r *http.Request) {
+	var req SetLogLevelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Level == "" {
+		writeError(w, http.StatusBadRequest, `body must be {"level": "debug"}`, "INVALID_JSON")
+		return
+	}
+	module := chi.URLParam(r, "module")
+	if err := obs.SetModuleLevel(module, req.Level); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error(), "INVALID_LOG_LEVEL")
+		return
+	}
+
+	h.logger.Info().Str("module", module).Str("level", req.Level).Msg("log level changed")
+	writeJSON(w, http.StatusOK, obs.Levels())
+}
+
+// HandleClearLogLevel drops a module's override, so the default applies again
+func (h *Handler) HandleClearLogLevel(w http.ResponseWriter, r *http.Request) {
+	module := chi.URLParam(r, "module")
+	if module == obs.DefaultModule {
+		writeError(w, http.StatusBadRequest, "the default level can be changed but not cleared", "INVALID_LOG_LEVEL")
+		return
+	}
+	obs.ClearModuleLevel(module)
+
+	h.logger.Info().Str("module", module).Msg("log level override cleared")
+	writeJSON(w, http.StatusOK, obs.Levels())
+}
@@ -0,0 +1,59 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestHandleLogLevels(t *testing.T) {
+	store, _ := setupWALTestHandler(t)
+	handler := NewHandler(store, obs.Logger("test"))
+	r := chi.NewRouter()
+	r.Get("/admin/log-levels", handler.HandleGetLogLevels)
+	r.Put("/admin/log-levels/{module}", handler.HandleSetLogLevel)
+	r.Delete("/admin/log-levels/{module}", handler.HandleClearLogLevel)
+
+	saved := obs.Levels()
+	defer func() {
+		_ = obs.SetLevel(saved.Default)
+		obs.ClearModuleLevel("wal")
+	}()
+
+	w := doJSON(r, http.MethodPut, "/admin/log-levels/wal", SetLogLevelRequest{Level: "debug"})
+	var st obs.LevelState
+	_ = json.NewDecoder(w.Body).Decode(&st)
+	if w.Code != http.StatusOK || st.Modules["wal"] != "debug" {
+		t.Fatalf("unexpected response setting a module level: %d %s", w.Code, w.Body.String())
+	}
+
+	w = doJSON(r, http.MethodGet, "/admin/log-levels", nil)
+	st = obs.LevelState{}
+	_ = json.NewDecoder(w.Body).Decode(&st)
+	if st.Modules["wal"] != "debug" || st.Default != saved.Default {
+		t.Errorf("unexpected levels %+v", st)
+	}
+
+	w = doJSON(r, http.MethodDelete, "/admin/log-levels/wal", nil)
+	st = obs.LevelState{}
+	_ = json.NewDecoder(w.Body).Decode(&st)
+	if w.Code != http.StatusOK || st.Modules["wal"] != "" {
+		t.Errorf("expected the override to be cleared, got %d %s", w.Code, w.Body.String())
+	}
+
+	if w := doJSON(r, http.MethodPut, "/admin/log-levels/default", SetLogLevelRequest{Level: "warn"}); w.Code != http.StatusOK || obs.Levels().Default != "warn" {
+		t.Errorf("expected the default level to change, got %d %s", w.Code, w.Body.String())
+	}
+	if w := doJSON(r, http.MethodPut, "/admin/log-levels/wal", SetLogLevelRequest{Level: "loud"}); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown level, got %d", w.Code)
+	}
+	if w := doJSON(r, http.MethodPut, "/admin/log-levels/wal", map[string]string{}); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without a level, got %d", w.Code)
+	}
+	if w := doJSON(r, http.MethodDelete, "/admin/log-levels/default", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 clearing the default, got %d", w.Code)
+	}
+}
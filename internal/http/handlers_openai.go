@@ -0,0 +1,337 @@
+package httpapi
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/relay"
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+)
+
+// The /v1 endpoints mimic OpenAI's API so existing tools and SDKs can use
+// Selfstack by changing their base URL. A request's model names the
+// collection to use; models that aren't collections, like gpt-4o, use the
+// default collection, so clients configured for OpenAI work unchanged.
+
+// maxEmbeddingInputs limits the inputs of one /v1/embeddings request, as
+// OpenAI does
+const maxEmbeddingInputs = 2048
+
+// openAIError writes an error in the shape OpenAI clients parse
+func openAIError(w http.ResponseWriter, status int, message, code string) {
+	errType := "invalid_request_error"
+	if status >= http.StatusInternalServerError {
+		errType = "server_error"
+	}
+	writeJSON(w, status, OpenAIErrorResponse{Error: OpenAIError{Message: message, Type: errType, Code: code}})
+}
+
+// openAICollection loads the collection a model names, or the default
+// collection if it names none
+func (h *Handler) openAICollection(w http.ResponseWriter, r *http.Request, model string) (*collection, bool) {
+	if model != "" && !mayUseCollection(r, model) {
+		openAIError(w, http.StatusForbidden, "this API key may not use collection "+model, "NAMESPACE_FORBIDDEN")
+		return nil, false
+	}
+	if model != "" {
+		coll, found, err := h.loadCollection(r.Context(), model)
+		if err != nil {
+			h.logger.Error().Err(err).Str("collection", model).Msg("failed to load collection")
+			openAIError(w, http.StatusInternalServerError, "failed to load collection", "COLLECTION_ERROR")
+			return nil, false
+		}
+		if found {
+			return coll, true
+		}
+	}
+	if !mayUseCollection(r, db.DefaultCollection) {
+		openAIError(w, http.StatusForbidden, "this API key may not use the default collection; name a collection as the model", "NAMESPACE_FORBIDDEN")
+		return nil, false
+	}
+	coll, _, err := h.loadCollection(r.Context(), db.DefaultCollection)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to load the default collection")
+		openAIError(w, http.StatusInternalServerError, "failed to load collection", "COLLECTION_ERROR")
+		return nil, false
+	}
+	return coll, true
+}
+
+// openAIEmbedError reports an embedder that failed without a fallback
+func (h *Handler) openAIEmbedError(w http.ResponseWriter, coll *collection, err error) {
+	h.logger.Warn().Err(err).Str("collection", coll.Name).Str("embedder", coll.embedder.Name()).Msg("embedder unavailable")
+	var open *relay.CircuitOpenError
+	if errors.As(err, &open) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(open.Until).Seconds()))))
+	}
+	openAIError(w, http.StatusServiceUnavailable, "embedder unavailable: "+err.Error(), "EMBEDDER_UNAVAILABLE")
+}
+
+// HandleOpenAIEmbeddings embeds text with the embedder of the collection
+// the model names, as OpenAI's /v1/embeddings does
+func (h *Handler) HandleOpenAIEmbeddings(w http.ResponseWriter, r *http.Request) {
+	var req OpenAIEmbeddingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		openAIError(w, http.StatusBadRequest, "invalid JSON", "INVALID_JSON")
+		return
+	}
+	inputs, err := embeddingInputs(req.Input)
+	if err != nil {
+		openAIError(w, http.StatusBadRequest, err.Error(), "INVALID_INPUT")
+		return
+	}
+	if req.EncodingFormat != "" && req.EncodingFormat != "float" && req.EncodingFormat != "base64" {
+		openAIError(w, http.StatusBadRequest, "encoding_format must be float or base64", "INVALID_ENCODING_FORMAT")
+		return
+	}
+
+	coll, ok := h.openAICollection(w, r, req.Model)
+	if !ok {
+		return
+	}
+	dims := coll.embedder.Dimensions()
+	if req.Dimensions != 0 && req.Dimensions != dims {
+		openAIError(w, http.StatusBadRequest,
+			fmt.Sprintf("collection %s embeds with %d dimensions", coll.Name, dims), "INVALID_DIMENSIONS")
+		return
+	}
+
+	resp := OpenAIEmbeddingResponse{Object: "list", Data: make([]OpenAIEmbedding, len(inputs)), Model: req.Model}
+	if resp.Model == "" {
+		resp.Model = coll.Name
+	}
+	for i, text := range inputs {
+		emb, _, err := coll.embedQuery(r.Context(), text)
+		if err != nil {
+			h.openAIEmbedError(w, coll, err)
+			return
+		}
+		resp.Data[i] = OpenAIEmbedding{Object: "embedding", Index: i, Embedding: emb[:dims]}
+		if req.EncodingFormat == "base64" {
+			resp.Data[i].Embedding = encodeFloats(emb[:dims])
+		}
+		resp.Usage.PromptTokens += estimateTokens(text)
+	}
+	resp.Usage.TotalTokens = resp.Usage.PromptTokens
+	h.meter(r, db.Usage{Tokens: resp.Usage.TotalTokens})
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// embeddingInputs decodes the input of an embeddings request: a string or
+// an array of strings. Token arrays aren't supported, as Selfstack's
+// embedders take text.
+func embeddingInputs(raw json.RawMessage) ([]string, error) {
+	var one string
+	if err := json.Unmarshal(raw, &one); err == nil {
+		if one == "" {
+			return nil, fmt.Errorf("input must not be empty")
+		}
+		return []string{one}, nil
+	}
+	var many []string
+	if err := json.Unmarshal(raw, &many); err != nil {
+		return nil, fmt.Errorf("input must be a string or an array of strings")
+	}
+	if len(many) == 0 || len(many) > maxEmbeddingInputs {
+		return nil, fmt.Errorf("input must have 1 to %d strings", maxEmbeddingInputs)
+	}
+	for _, s := range many {
+		if s == "" {
+			return nil, fmt.Errorf("input must not contain empty strings")
+		}
+	}
+	return many, nil
+}
+
+// encodeFloats encodes v as base64 little-endian float32s, OpenAI's base64
+// encoding format
+func encodeFloats(v []float32) string {
+	buf := make([]byte, 4*len(v))
+	for i, f := range v {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(f))
+	}
+	return base64.StdEncoding.EncodeToString(buf)
+}
+
+// HandleOpenAIChat answers the last user message like /run does, from the
+// documents of the collection the model names, as OpenAI's
+// /v1/chat/completions does. The answer is composed from the retrieved
+// documents with footnote citations, which are also listed in the
+// response's citations field.
+func (h *Handler) HandleOpenAIChat(w http.ResponseWriter, r *http.Request) {
+	var req OpenAIChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		openAIError(w, http.StatusBadRequest, "invalid JSON", "INVALID_JSON")
+		return
+	}
+	query, prompt, err := chatQuery(req.Messages)
+	if err != nil {
+		openAIError(w, http.StatusBadRequest, err.Error(), "INVALID_MESSAGES")
+		return
+	}
+
+	coll, ok := h.openAICollection(w, r, req.Model)
+	if !ok {
+		return
+	}
+
+	timings := newOpTimings()
+	timings.Candidates = h.store.CountCollection(coll.Name)
+	results, shared, err := h.runSearch(r, coll, query, []string{query}, "semantic", defaultRunLimit, 0, timings)
+	if err != nil {
+		h.openAIEmbedError(w, coll, err)
+		return
+	}
+	if shared {
+		timings.Shared = true
+		h.coalesced.WithLabel("run").Inc()
+	}
+	citations := dedupeCitations(citationsOf(aboveScore(results, coll.minScore(0, true))), defaultRunLimit)
+	answer, _ := composeAnswer(query, citations, CitationStyleFootnote)
+	timings.lap(&timings.Generate)
+	timings.Results = len(citations)
+
+	usage := OpenAIUsage{PromptTokens: estimateTokens(prompt...), CompletionTokens: estimateTokens(answer)}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	h.recordQuery(r, coll.Name, query, len(citations))
+	h.meter(r, db.Usage{Runs: 1, Tokens: usage.TotalTokens})
+	h.observeSlowOp("run", query, "semantic", defaultRunLimit, timings)
+	h.observeLatency(r, "run", timings)
+
+	h.logger.Info().
+		Str("query", query).
+		Str("collection", coll.Name).
+		Int("citations", len(citations)).
+		Bool("stream", req.Stream).
+		Msg("chat completion")
+
+	model := req.Model
+	if model == "" {
+		model = coll.Name
+	}
+	resp := OpenAIChatResponse{
+		ID:        "chatcmpl-" + randomHex(12),
+		Object:    "chat.completion",
+		Created:   time.Now().Unix(),
+		Model:     model,
+		Citations: citations,
+	}
+	stop := "stop"
+	if !req.Stream {
+		resp.Choices = []OpenAIChoice{{Message: &OpenAIReply{Role: "assistant", Content: answer}, FinishReason: &stop}}
+		resp.Usage = &usage
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	// The answer is ready at once, so the stream is the role, the whole
+	// answer, and the finish reason
+	resp.Object = "chat.completion.chunk"
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	chunks := []OpenAIChoice{
+		{Delta: &OpenAIReply{Role: "assistant"}},
+		{Delta: &OpenAIReply{Content: answer}},
+		{Delta: &OpenAIReply{}, FinishReason: &stop},
+	}
+	for i, choice := range chunks {
+		chunk := resp
+		chunk.Choices = []OpenAIChoice{choice}
+		if i != len(chunks)-1 {
+			chunk.Citations = nil
+		}
+		data, _ := json.Marshal(chunk)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// chatQuery returns the text of the last user message, which is what a
+// chat completion retrieves and answers for, and the text of every message
+// for usage
+func chatQuery(messages []OpenAIChatMessage) (string, []string, error) {
+	if len(messages) == 0 {
+		return "", nil, fmt.Errorf("messages must not be empty")
+	}
+	var query string
+	texts := make([]string, 0, len(messages))
+	for i, m := range messages {
+		text, err := messageText(m.Content)
+		if err != nil {
+			return "", nil, fmt.Errorf("message %d: %w", i, err)
+		}
+		texts = append(texts, text)
+		if m.Role == "user" {
+			query = strings.TrimSpace(text)
+		}
+	}
+	if query == "" {
+		return "", nil, fmt.Errorf("messages must include a user message with text")
+	}
+	return query, texts, nil
+}
+
+// messageText returns the text of a message's content: a string, or the
+// text parts of an array of parts
+func messageText(content json.RawMessage) (string, error) {
+	if len(bytes.TrimSpace(content)) == 0 || string(bytes.TrimSpace(content)) == "null" {
+		return "", nil
+	}
+	var text string
+	if err := json.Unmarshal(content, &text); err == nil {
+		return text, nil
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(content, &parts); err != nil {
+		return "", fmt.Errorf("content must be a string or an array of parts")
+	}
+	var texts []string
+	for _, p := range parts {
+		if p.Type == "text" {
+			texts = append(texts, p.Text)
+		}
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+// HandleOpenAIModels lists the collections as models, as OpenAI's
+// /v1/models does
+func (h *Handler) HandleOpenAIModels(w http.ResponseWriter, r *http.Request) {
+	configs, err := h.listCollections(r.Context())
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to list collections")
+		openAIError(w, http.StatusInternalServerError, "failed to list collections", "COLLECTION_ERROR")
+		return
+	}
+	configs = allowedCollections(r, configs)
+	resp := OpenAIModelList{Object: "list", Data: make([]OpenAIModel, len(configs))}
+	for i, c := range configs {
+		resp.Data[i] = OpenAIModel{ID: c.Name, Object: "model", Created: c.CreatedAt.Unix(), OwnedBy: "selfstack"}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// randomHex returns n random bytes as hex
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,110 @@
+package httpapi
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestOpenAIFacade(t *testing.T) {
+	store, _ := setupWALTestHandler(t)
+	h := NewHandler(store, obs.Logger("test"))
+	r := chi.NewRouter()
+	r.Post("/ingest", h.HandleIngest)
+	r.Get("/v1/models", h.HandleOpenAIModels)
+	r.Post("/v1/embeddings", h.HandleOpenAIEmbeddings)
+	r.Post("/v1/chat/completions", h.HandleOpenAIChat)
+	ingestDoc(t, r, IngestRequest{ID: "deploys", Source: "wiki", Title: "Deploy runbook", Text: "how do we deploy"})
+
+	var models OpenAIModelList
+	_ = json.NewDecoder(doJSON(r, http.MethodGet, "/v1/models", nil).Body).Decode(&models)
+	if len(models.Data) != 1 || models.Data[0].ID != "default" {
+		t.Errorf("models = %+v", models)
+	}
+
+	// Unknown models use the default collection
+	w := doJSON(r, http.MethodPost, "/v1/embeddings", map[string]any{"model": "text-embedding-3-small", "input": []string{"a", "b"}})
+	var emb struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+		Model string      `json:"model"`
+		Usage OpenAIUsage `json:"usage"`
+	}
+	_ = json.NewDecoder(w.Body).Decode(&emb)
+	if w.Code != http.StatusOK || len(emb.Data) != 2 || emb.Data[1].Index != 1 || len(emb.Data[0].Embedding) != 128 || emb.Model != "text-embedding-3-small" || emb.Usage.TotalTokens == 0 {
+		t.Fatalf("embeddings = %d %+v", w.Code, emb)
+	}
+	w = doJSON(r, http.MethodPost, "/v1/embeddings", map[string]any{"input": "a", "encoding_format": "base64"})
+	var b64 struct {
+		Data []struct {
+			Embedding string `json:"embedding"`
+		} `json:"data"`
+	}
+	_ = json.NewDecoder(w.Body).Decode(&b64)
+	if raw, err := base64.StdEncoding.DecodeString(b64.Data[0].Embedding); err != nil || len(raw) != 4*128 {
+		t.Errorf("base64 embedding: %d bytes, %v", len(raw), err)
+	}
+	w = doJSON(r, http.MethodPost, "/v1/embeddings", map[string]any{"input": []int{1, 2}})
+	var apiErr OpenAIErrorResponse
+	_ = json.NewDecoder(w.Body).Decode(&apiErr)
+	if w.Code != http.StatusBadRequest || apiErr.Error.Type != "invalid_request_error" || apiErr.Error.Code != "INVALID_INPUT" {
+		t.Errorf("token input = %d %+v", w.Code, apiErr)
+	}
+
+	chat := map[string]any{
+		"model": "gpt-4o",
+		"messages": []map[string]any{
+			{"role": "system", "content": "You are helpful."},
+			{"role": "user", "content": []map[string]string{{"type": "text", "text": "how do we deploy"}}},
+		},
+	}
+	w = doJSON(r, http.MethodPost, "/v1/chat/completions", chat)
+	var completion OpenAIChatResponse
+	_ = json.NewDecoder(w.Body).Decode(&completion)
+	if w.Code != http.StatusOK || completion.Object != "chat.completion" || len(completion.Choices) != 1 {
+		t.Fatalf("completion = %d %+v", w.Code, completion)
+	}
+	msg := completion.Choices[0].Message
+	if msg == nil || msg.Role != "assistant" || !strings.Contains(msg.Content, "Deploy runbook") || len(completion.Citations) == 0 || completion.Citations[0].DocID != "deploys" {
+		t.Errorf("completion message = %+v, citations %+v", msg, completion.Citations)
+	}
+	if completion.Usage == nil || completion.Usage.TotalTokens != completion.Usage.PromptTokens+completion.Usage.CompletionTokens {
+		t.Errorf("usage = %+v", completion.Usage)
+	}
+
+	chat["stream"] = true
+	w = doJSON(r, http.MethodPost, "/v1/chat/completions", chat)
+	if ct := w.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("stream content type = %q", ct)
+	}
+	var content strings.Builder
+	var events []string
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		events = append(events, data)
+		var chunk OpenAIChatResponse
+		if json.Unmarshal([]byte(data), &chunk) == nil && len(chunk.Choices) == 1 && chunk.Choices[0].Delta != nil {
+			content.WriteString(chunk.Choices[0].Delta.Content)
+		}
+	}
+	if len(events) != 4 || events[3] != "[DONE]" || content.String() != msg.Content {
+		t.Errorf("stream events = %v", events)
+	}
+
+	w = doJSON(r, http.MethodPost, "/v1/chat/completions", map[string]any{"messages": []map[string]string{{"role": "system", "content": "hi"}}})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("chat without a user message = %d", w.Code)
+	}
+}
@@ -0,0 +1,98 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Metadata keys of retrieved documents, besides the stored metadata
+const (
+	retrieveDocID      = "doc_id"     // Parent document of a chunk, or the document itself
+	retrieveSourceURI  = "source_uri" // Where the document came from
+	retrieveTitle      = "title"
+	retrieveSource     = "source"
+	retrieveCollection = "collection"
+	retrieveCreatedAt  = "created_at"
+)
+
+// defaultTopK is the number of documents /retrieve returns by default, as
+// LangChain retrievers do
+const defaultTopK = 4
+
+// HandleRetrieve runs a search and returns its results in the shape the
+// retriever plugins of RAG frameworks like LangChain and LlamaIndex expect:
+// text, a relevance score, and flat metadata with the source URI
+func (h *Handler) HandleRetrieve(w http.ResponseWriter, r *http.Request) {
+	var req RetrieveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON", "INVALID_JSON")
+		return
+	}
+	if req.TopK < 0 || req.TopK > 100 {
+		writeError(w, http.StatusBadRequest, "top_k must be between 1 and 100", "INVALID_PARAM")
+		return
+	}
+	if req.TopK == 0 {
+		req.TopK = defaultTopK
+	}
+
+	res, ok := h.search(w, r, SearchRequest{
+		Query:      req.Query,
+		Limit:      req.TopK,
+		Mode:       req.Mode,
+		Collection: req.Collection,
+		MinScore:   req.MinScore,
+	})
+	if !ok {
+		return
+	}
+
+	resp := RetrieveResponse{Query: res.Query, Documents: make([]RetrievedDocument, len(res.Results)), FailedShards: res.FailedShards}
+	for i, result := range res.Results {
+		resp.Documents[i] = RetrievedDocument{
+			ID:          result.DocID,
+			PageContent: result.Text,
+			Score:       result.Score,
+			Metadata:    h.retrievedMetadata(result),
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// retrievedMetadata flattens a result into retriever metadata: its stored
+// metadata plus the fields frameworks cite
+func (h *Handler) retrievedMetadata(result SearchResult) map[string]string {
+	meta := make(map[string]string, len(result.Metadata)+6)
+	for k, v := range result.Metadata {
+		meta[k] = v
+	}
+	docID := result.DocID
+	if parent := result.Metadata[metaChunkOf]; parent != "" {
+		docID = parent
+	}
+	meta[retrieveDocID] = docID
+	meta[retrieveTitle] = result.Title
+	meta[retrieveSource] = result.Source
+	meta[retrieveCollection] = result.Collection
+	meta[retrieveCreatedAt] = result.CreatedAt.Format(time.RFC3339)
+	if meta[retrieveSourceURI] == "" {
+		meta[retrieveSourceURI] = h.sourceURI(result.Collection, docID, result.Metadata)
+	}
+	return meta
+}
+
+// sourceURI is where a document came from: its url metadata, else its
+// first alias, else a selfstack:// URI of the document
+func (h *Handler) sourceURI(collection, docID string, metadata map[string]string) string {
+	if u := metadata["url"]; u != "" {
+		return u
+	}
+	if h.aliases != nil {
+		if aliases := h.aliases.AliasesOf(docID); len(aliases) > 0 {
+			return aliases[0]
+		}
+	}
+	return "selfstack://" + url.PathEscape(collection) + "/" + url.PathEscape(docID)
+}
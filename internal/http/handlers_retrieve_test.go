@@ -0,0 +1,61 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestHandleRetrieve(t *testing.T) {
+	store, _ := setupWALTestHandler(t)
+	aliases, err := db.NewAliasTable(filepath.Join(t.TempDir(), "aliases.json"))
+	if err != nil {
+		t.Fatalf("failed to open alias table: %v", err)
+	}
+	h := NewHandler(store, obs.Logger("test"), WithAliases(aliases))
+	r := chi.NewRouter()
+	r.Post("/ingest", h.HandleIngest)
+	r.Post("/retrieve", h.HandleRetrieve)
+
+	ingestDoc(t, r, IngestRequest{ID: "a", Source: "wiki", Title: "Deploys", Text: "deploy runbook", Metadata: map[string]string{"url": "https://wiki/deploys"}})
+	ingestDoc(t, r, IngestRequest{ID: "b", Source: "drive", Title: "Planning", Text: "quarterly planning", Aliases: []string{"drive://planning.doc"}})
+	ingestDoc(t, r, IngestRequest{ID: "c", Source: "notes", Title: "Notes", Text: "misc notes"})
+
+	w := doJSON(r, http.MethodPost, "/retrieve", RetrieveRequest{Query: "deploy runbook", TopK: 3})
+	var resp RetrieveResponse
+	_ = json.NewDecoder(w.Body).Decode(&resp)
+	if w.Code != http.StatusOK || len(resp.Documents) != 3 {
+		t.Fatalf("retrieve = %d %+v", w.Code, resp)
+	}
+	uris := make(map[string]string)
+	for _, d := range resp.Documents {
+		if d.Metadata["doc_id"] != d.ID || d.Metadata["collection"] != "default" || d.PageContent == "" {
+			t.Errorf("document %s: %+v", d.ID, d)
+		}
+		uris[d.ID] = d.Metadata["source_uri"]
+	}
+	if resp.Documents[0].ID != "a" || resp.Documents[0].Score < resp.Documents[1].Score {
+		t.Errorf("expected the exact match first by score, got %+v", resp.Documents)
+	}
+	if uris["a"] != "https://wiki/deploys" || uris["b"] != "drive://planning.doc" || uris["c"] != "selfstack://default/c" {
+		t.Errorf("source URIs = %v", uris)
+	}
+
+	w = doJSON(r, http.MethodPost, "/retrieve", RetrieveRequest{Query: "deploy"})
+	resp = RetrieveResponse{}
+	_ = json.NewDecoder(w.Body).Decode(&resp)
+	if len(resp.Documents) != 3 {
+		t.Errorf("default top_k returned %d documents", len(resp.Documents))
+	}
+	if w := doJSON(r, http.MethodPost, "/retrieve", RetrieveRequest{Query: "deploy", TopK: 101}); w.Code != http.StatusBadRequest {
+		t.Errorf("top_k 101 = %d", w.Code)
+	}
+	if w := doJSON(r, http.MethodPost, "/retrieve", RetrieveRequest{}); w.Code != http.StatusBadRequest {
+		t.Errorf("empty query = %d", w.Code)
+	}
+}
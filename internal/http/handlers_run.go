@@ -4,8 +4,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/dsjohal14/selfstack/internal/libs/flags"
 	"github.com/dsjohal14/selfstack/internal/relay"
+	"github.com/dsjohal14/selfstack/internal/scope/db"
 )
 
 // HandleRun executes an AI agent query with citations
@@ -19,61 +23,188 @@ func (h *Handler) HandleRun(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate query
+	req.Query = strings.TrimSpace(req.Query)
 	if req.Query == "" {
 		writeError(w, http.StatusBadRequest, "query is required", "MISSING_QUERY")
 		return
 	}
 
-	// Search for relevant documents (top 3 for MVP)
-	queryEmb := relay.DeterministicEmbed(req.Query)
-	storeResults := h.store.Search(queryEmb, 3)
+	if !validCitationStyle(req.CitationStyle) {
+		writeError(w, http.StatusBadRequest, "citation_style must be list, inline, or footnote", "INVALID_CITATION_STYLE")
+		return
+	}
 
-	// Convert to citations with source attribution
-	citations := make([]Citation, len(storeResults))
-	for i, r := range storeResults {
-		citations[i] = Citation{
-			DocID:  r.DocID,
-			Score:  r.Score,
-			Title:  r.Title,
-			Text:   r.Text,
-			Source: r.Source,
+	switch req.Strategy {
+	case "", StrategySingle:
+	case StrategyMultiQuery:
+	default:
+		writeError(w, http.StatusBadRequest, "strategy must be single or multi_query", "INVALID_STRATEGY")
+		return
+	}
+
+	if req.Limit < 0 || req.Limit > maxRunLimit {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxRunLimit), "INVALID_PARAM")
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = defaultRunLimit
+	}
+
+	lambda, err := mmrLambda(req.Diversify, req.MMRLambda)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error(), "INVALID_MMR_LAMBDA")
+		return
+	}
+	if !h.flags.Enabled(flags.MMR) {
+		lambda = 0 // Diversification is switched off
+	}
+
+	timings := newOpTimings()
+
+	coll, ok := h.resolveCollection(w, r, req.Collection)
+	if !ok {
+		return
+	}
+	timings.Candidates = h.store.CountCollection(coll.Name)
+
+	// Multi-query retrieval searches reformulations of terse questions too,
+	// unless it is switched off
+	multiQuery := req.Strategy == StrategyMultiQuery && h.flags.Enabled(flags.MultiQuery)
+	queries := []string{req.Query}
+	mode := "semantic"
+	if multiQuery {
+		queries = relay.ExpandQuery(req.Query)
+		mode = StrategyMultiQuery
+	}
+
+	// Irrelevant hits make a worse answer than admitting there are none
+	minScore := coll.minScore(req.MinScore, true)
+	compose := func() (runAnswer, error) {
+		storeResults, shared, err := h.runSearch(r, coll, req.Query, queries, mode, req.Limit, lambda, timings)
+		if err != nil {
+			return runAnswer{}, err
 		}
+		if shared {
+			timings.lap(&timings.Scan)
+			timings.Shared = true
+			h.coalesced.WithLabel("run").Inc()
+		}
+		citations := dedupeCitations(citationsOf(aboveScore(storeResults, minScore)), req.Limit)
+		timings.lap(&timings.Rerank)
+
+		// Compose answer from citations (AI layer logic)
+		answer, markers := composeAnswer(req.Query, citations, req.CitationStyle)
+		timings.lap(&timings.Generate)
+		return runAnswer{answer: answer, citations: citations, markers: markers, queries: queries}, nil
 	}
 
-	// Compose answer from citations (AI layer logic)
-	answer := composeAnswer(req.Query, citations)
+	// A question asked again against an unchanged index gets the answer
+	// composed the first time
+	var ans runAnswer
+	cached := false
+	switch {
+	case h.answerCache == nil:
+		ans, err = compose()
+	case req.NoCache:
+		h.answers.WithLabel(answerBypass).Inc()
+		ans, err = compose()
+	default:
+		key := answerKey(coll.Name, diversityMode(mode, lambda), req.Limit, minScore, req.CitationStyle, req.Query)
+		ans, cached, err = h.answerCache.do(key, h.resultGen(), compose)
+		if err == nil && cached {
+			h.answers.WithLabel(answerHit).Inc()
+			timings.Shared = true
+		} else if err == nil {
+			h.answers.WithLabel(answerMiss).Inc()
+		}
+	}
+	if err != nil {
+		h.writeEmbedError(w, coll, err)
+		return
+	}
+	if cached && len(ans.citations) == 0 {
+		// The answer quotes the question as asked
+		ans.answer, ans.markers = composeAnswer(req.Query, nil, req.CitationStyle)
+	}
+
+	timings.Results = len(ans.citations)
+	h.recordQuery(r, coll.Name, req.Query, len(ans.citations))
+	usage := db.Usage{Runs: 1}
+	if !cached {
+		usage.Tokens = estimateTokens(queries...) + estimateTokens(ans.answer)
+	}
+	h.meter(r, usage)
+	h.observeSlowOp("run", req.Query, "semantic", req.Limit, timings)
+	h.observeLatency(r, "run", timings)
 
 	h.logger.Info().
 		Str("query", req.Query).
-		Int("citations", len(citations)).
+		Int("citations", len(ans.citations)).
+		Bool("shared", timings.Shared).
+		Bool("cached", cached).
 		Msg("agent run completed")
 
-	writeJSON(w, http.StatusOK, RunResponse{
-		Answer:    answer,
-		Citations: citations,
+	resp := RunResponse{
+		Answer:    ans.answer,
+		Citations: ans.citations,
+		Markers:   ans.markers,
 		Query:     req.Query,
-	})
-}
-
-// composeAnswer creates a simple answer from citations
-// TODO: Replace with real LLM-based answer generation in V1
-func composeAnswer(query string, citations []Citation) string {
-	if len(citations) == 0 {
-		return fmt.Sprintf("No relevant documents found for query: %s", query)
+		Cached:    cached,
 	}
+	if req.Debug {
+		resp.Timings = timings.response()
+		if multiQuery {
+			resp.SubQueries = ans.queries
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
 
-	answer := fmt.Sprintf("Based on %d document(s):\n\n", len(citations))
-
-	for i, cit := range citations {
-		// Truncate text to first 100 chars for summary
-		text := cit.Text
-		if len(text) > 100 {
-			text = text[:100] + "..."
+// runSearch finds the documents a run answers from: each of queries is
+// searched, their results fused, reranked against query, and diversified,
+// keeping enough candidates for limit citations once duplicates are folded
+// away. Identical concurrent runs share one embedding and scan; shared
+// reports whether this one did.
+func (h *Handler) runSearch(r *http.Request, coll *collection, query string, queries []string, mode string, limit int, lambda float32, timings *opTimings) (results []db.SearchResult, shared bool, err error) {
+	key := coalesceKey("run", coll.Name, diversityMode(mode, lambda), limit, query)
+	return h.runCache.do(key, h.resultGen(), func() ([]db.SearchResult, error) {
+		filter := coll.searchFilter(time.Now())
+		pool := limit * citationPoolFactor
+		depth := mmrPool(pool, lambda)
+		if len(queries) > 1 {
+			depth = max(multiQueryDepth, depth)
+		}
+		lists := make([][]db.SearchResult, len(queries))
+		for i, q := range queries {
+			queryEmb, _, err := coll.embedQuery(r.Context(), q)
+			if err != nil {
+				return nil, err
+			}
+			timings.lap(&timings.Embed)
+			lists[i] = h.store.SearchFiltered(queryEmb, depth, filter)
+			timings.lap(&timings.Scan)
+		}
+		results := lists[0]
+		if len(lists) > 1 {
+			results = fuseRRF(lists, mmrPool(pool, lambda))
 		}
+		results = rerank(h.rerankerOf(coll), query, results)
+		return h.diversify(coll, results, pool, lambda), nil
+	})
+}
 
-		answer += fmt.Sprintf("%d. [%s] %s (score: %.3f)\n   %s\n\n",
-			i+1, cit.Source, cit.Title, cit.Score, text)
+// citationsOf converts search results to citations with source attribution
+func citationsOf(results []db.SearchResult) []Citation {
+	citations := make([]Citation, len(results))
+	for i, r := range results {
+		citations[i] = Citation{
+			DocID:   r.DocID,
+			Score:   r.Score,
+			Title:   r.Title,
+			Text:    r.Text,
+			Source:  r.Source,
+			ChunkOf: r.Metadata[metaChunkOf],
+		}
 	}
-
-	return answer
+	return citations
 }
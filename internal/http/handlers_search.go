@@ -1,12 +1,23 @@
 package httpapi
 
 import (
+	"encoding/binary"
 	"encoding/json"
+	"math"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/dsjohal14/selfstack/internal/libs/flags"
 	"github.com/dsjohal14/selfstack/internal/relay"
+	"github.com/dsjohal14/selfstack/internal/scope/db"
 )
 
+// keywordSearcher is implemented by stores that maintain a keyword index
+type keywordSearcher interface {
+	KeywordSearch(query string, limit int, filter db.SearchFilter) ([]db.SearchResult, bool)
+}
+
 // HandleSearch performs semantic search over stored documents
 // Uses embeddings to find documents similar to the query
 func (h *Handler) HandleSearch(w http.ResponseWriter, r *http.Request) {
@@ -16,11 +27,27 @@ func (h *Handler) HandleSearch(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "invalid JSON", "INVALID_JSON")
 		return
 	}
+	if resp, ok := h.search(w, r, req); ok {
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
 
+// search validates and runs a search request, writing an error and
+// returning false if it fails
+func (h *Handler) search(w http.ResponseWriter, r *http.Request, req SearchRequest) (SearchResponse, bool) {
 	// Validate query
-	if req.Query == "" {
+	req.Query = strings.TrimSpace(req.Query)
+	var vector *relay.Embedding
+	if req.Vector != nil {
+		emb, err := relay.EmbeddingFrom(req.Vector)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error(), "INVALID_VECTOR")
+			return SearchResponse{}, false
+		}
+		vector = &emb
+	} else if req.Query == "" {
 		writeError(w, http.StatusBadRequest, "query is required", "MISSING_QUERY")
-		return
+		return SearchResponse{}, false
 	}
 
 	// Set default and max limits
@@ -31,13 +58,146 @@ func (h *Handler) HandleSearch(w http.ResponseWriter, r *http.Request) {
 		req.Limit = 100 // Max limit for performance
 	}
 
-	// Generate query embedding (AI layer - relay)
-	queryEmb := relay.DeterministicEmbed(req.Query)
+	if req.Mode == "" {
+		req.Mode = "semantic"
+	}
+	var ks keywordSearcher
+	switch req.Mode {
+	case "semantic":
+	case "keyword":
+		if vector != nil {
+			writeError(w, http.StatusBadRequest, "vector searches must be semantic", "INVALID_MODE")
+			return SearchResponse{}, false
+		}
+		var ok bool
+		ks, ok = h.store.(keywordSearcher)
+		if !ok || !h.caps.KeywordSearch {
+			writeError(w, http.StatusNotImplemented, "keyword index is not enabled (set WAL_KEYWORD_INDEX=true)", "NOT_SUPPORTED")
+			return SearchResponse{}, false
+		}
+	default:
+		writeError(w, http.StatusBadRequest, "mode must be semantic or keyword", "INVALID_MODE")
+		return SearchResponse{}, false
+	}
+
+	lambda, err := mmrLambda(req.Diversify, req.MMRLambda)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error(), "INVALID_MMR_LAMBDA")
+		return SearchResponse{}, false
+	}
+	if !h.flags.Enabled(flags.MMR) {
+		lambda = 0 // Diversification is switched off
+	}
+	if req.IncludeEmbedding && !h.mayExportEmbeddings(w, r) {
+		return SearchResponse{}, false
+	}
+
+	timings := newOpTimings()
 
-	// Search via storage layer
-	storeResults := h.store.Search(queryEmb, req.Limit)
+	coll, ok := h.resolveCollection(w, r, req.Collection)
+	if !ok {
+		return SearchResponse{}, false
+	}
+	filter := coll.searchFilter(time.Now())
+	timings.Candidates = h.store.CountCollection(coll.Name)
+
+	// Identical concurrent searches share one embedding and scan
+	key := coalesceKey("search", coll.Name, diversityMode(req.Mode, lambda), req.Limit, req.Query+vectorKey(vector))
+	storeResults, shared, err := h.searchCache.do(key, h.resultGen(), func() ([]db.SearchResult, error) {
+		var results []db.SearchResult
+		if ks != nil {
+			results, _ = ks.KeywordSearch(req.Query, mmrPool(req.Limit, lambda), filter)
+			timings.lap(&timings.Scan)
+		} else {
+			// Generate query embedding with the collection's embedder (AI
+			// layer - relay), unless the client sent its own
+			var queryEmb relay.Embedding
+			if vector != nil {
+				queryEmb = *vector
+			} else {
+				var err error
+				if queryEmb, _, err = coll.embedQuery(r.Context(), req.Query); err != nil {
+					return nil, err
+				}
+			}
+			timings.lap(&timings.Embed)
+
+			// Search via storage layer
+			results = h.store.SearchFiltered(queryEmb, mmrPool(req.Limit, lambda), filter)
+			timings.lap(&timings.Scan)
+		}
+		if req.Query != "" {
+			results = rerank(h.rerankerOf(coll), req.Query, results)
+		}
+		return h.diversify(coll, results, req.Limit, lambda), nil
+	})
+	if err != nil {
+		h.writeEmbedError(w, coll, err)
+		return SearchResponse{}, false
+	}
+	if shared {
+		timings.lap(&timings.Scan)
+		timings.Shared = true
+		h.coalesced.WithLabel("search").Inc()
+	}
+	storeResults = aboveScore(storeResults, coll.minScore(req.MinScore, ks == nil))
 
-	// Convert to API response format with all Doc contract fields
+	results := searchResults(storeResults)
+	if req.IncludeEmbedding {
+		for i := range results {
+			results[i].Embedding = h.embeddingOf(results[i].DocID)
+		}
+	}
+	timings.lap(&timings.Rerank)
+
+	// Fan out to the other shards unless this is one of their fan-outs
+	var failedShards []string
+	shards := 1
+	if h.shards != nil && !h.isHop(r) {
+		results, failedShards = h.gatherSearch(r, req, results)
+		shards = len(h.shards.Table().Shards) - len(failedShards)
+		timings.lap(&timings.Scan)
+	}
+
+	timings.Results = len(results)
+	if req.Query != "" {
+		h.recordQuery(r, coll.Name, req.Query, len(results))
+	}
+	usage := db.Usage{Searches: 1}
+	if ks == nil && vector == nil {
+		usage.Tokens = estimateTokens(req.Query) // Keyword and vector searches embed nothing
+	}
+	h.meter(r, usage)
+	h.observeSlowOp("search", req.Query, req.Mode, req.Limit, timings)
+	h.observeLatency(r, "search", timings)
+
+	h.logger.Info().
+		Str("query", req.Query).
+		Int("results", len(results)).
+		Int("limit", req.Limit).
+		Str("mode", req.Mode).
+		Str("collection", coll.Name).
+		Bool("vector", vector != nil).
+		Bool("shared", shared).
+		Msg("search completed")
+
+	resp := SearchResponse{
+		Results: results,
+		Count:   len(results),
+		Query:   req.Query,
+
+		FailedShards: failedShards,
+	}
+	if req.Debug {
+		resp.Timings = timings.response()
+		resp.Timings.Shards = shards
+	}
+	return resp, true
+}
+
+// searchResults converts store results to the API format with all Doc
+// contract fields
+func searchResults(storeResults []db.SearchResult) []SearchResult {
 	results := make([]SearchResult, len(storeResults))
 	for i, r := range storeResults {
 		results[i] = SearchResult{
@@ -48,18 +208,23 @@ func (h *Handler) HandleSearch(w http.ResponseWriter, r *http.Request) {
 			Source:    r.Source,
 			Metadata:  r.Metadata,
 			CreatedAt: r.CreatedAt,
+
+			Collection: r.Collection,
 		}
 	}
+	return results
+}
 
-	h.logger.Info().
-		Str("query", req.Query).
-		Int("results", len(results)).
-		Int("limit", req.Limit).
-		Msg("search completed")
-
-	writeJSON(w, http.StatusOK, SearchResponse{
-		Results: results,
-		Count:   len(results),
-		Query:   req.Query,
-	})
+// vectorKey distinguishes the coalescing keys of searches by vector: a
+// zero byte, to set it apart from the query, then the vector's bits. It's
+// empty for searches by text.
+func vectorKey(v *relay.Embedding) string {
+	if v == nil {
+		return ""
+	}
+	b := make([]byte, 1, 1+4*relay.EmbeddingDim)
+	for _, x := range v {
+		b = binary.LittleEndian.AppendUint32(b, math.Float32bits(x))
+	}
+	return string(b)
 }
@@ -0,0 +1,43 @@
+package httpapi
+
+import (
+	"net/http"
+
+	"github.com/dsjohal14/selfstack/internal/libs/slo"
+)
+
+// WithSLOs measures search and run latencies against the objectives t tracks
+func WithSLOs(t *slo.Tracker) HandlerOption {
+	return func(h *Handler) {
+		h.slos = t
+	}
+}
+
+// observeLatency records a search or run for the latency objectives.
+// Searches fanned out from another shard are measured by that shard.
+func (h *Handler) observeLatency(r *http.Request, op string, t *opTimings) {
+	if h.slos == nil || h.isHop(r) {
+		return
+	}
+	h.slos.Observe(op, t.total())
+}
+
+// HandleSLO returns the attainment, remaining error budget, and burn rates
+// of the latency objectives
+func (h *Handler) HandleSLO(w http.ResponseWriter, _ *http.Request) {
+	if h.slos == nil {
+		writeError(w, http.StatusNotImplemented, "no latency objectives are set (see SLO_OBJECTIVES)", "NOT_SUPPORTED")
+		return
+	}
+	objectives := h.slos.Status()
+	writeJSON(w, http.StatusOK, SLOResponse{Objectives: objectives, Met: allMet(objectives)})
+}
+
+func allMet(objectives []slo.Status) bool {
+	for _, o := range objectives {
+		if !o.Met {
+			return false
+		}
+	}
+	return true
+}
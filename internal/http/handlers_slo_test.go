@@ -0,0 +1,45 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+	"github.com/dsjohal14/selfstack/internal/libs/slo"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestHandleSLO(t *testing.T) {
+	store, _ := setupWALTestHandler(t)
+	objectives, _ := slo.Parse("search:1m:99,run:1ns:99")
+	handler := NewHandler(store, obs.Logger("test"), WithSLOs(slo.NewTracker(objectives, time.Hour)))
+	r := chi.NewRouter()
+	r.Post("/search", handler.HandleSearch)
+	r.Post("/run", handler.HandleRun)
+	r.Get("/admin/slo", handler.HandleSLO)
+
+	doJSON(r, http.MethodPost, "/search", SearchRequest{Query: "planning"})
+	doJSON(r, http.MethodPost, "/run", RunRequest{Query: "what is planned?"})
+
+	w := doJSON(r, http.MethodGet, "/admin/slo", nil)
+	var resp SLOResponse
+	_ = json.NewDecoder(w.Body).Decode(&resp)
+	if w.Code != http.StatusOK || len(resp.Objectives) != 2 || resp.Met {
+		t.Fatalf("unexpected SLO status: %d %s", w.Code, w.Body.String())
+	}
+	run, search := resp.Objectives[0], resp.Objectives[1]
+	if search.Total != 1 || !search.Met || search.BurnRates["5m0s"] != 0 {
+		t.Errorf("search = %+v", search)
+	}
+	// No run finishes within a nanosecond: the budget burns 100 times too fast
+	if run.Total != 1 || run.Met || run.BurnRates["5m0s"] < 99 {
+		t.Errorf("run = %+v", run)
+	}
+
+	r.Get("/off", NewHandler(store, obs.Logger("test")).HandleSLO)
+	if w := doJSON(r, http.MethodGet, "/off", nil); w.Code != http.StatusNotImplemented {
+		t.Errorf("expected 501 without objectives, got %d", w.Code)
+	}
+}
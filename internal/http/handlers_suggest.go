@@ -0,0 +1,56 @@
+package httpapi
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+)
+
+// WithQueryLog records search and run queries in log and serves /suggest
+// from it
+func WithQueryLog(log *db.QueryLog) HandlerOption {
+	return func(h *Handler) {
+		h.queries = log
+	}
+}
+
+// recordQuery counts a query that found results; other shards' fan-outs
+// are counted by the node the client asked
+func (h *Handler) recordQuery(r *http.Request, collection, query string, results int) {
+	if h.queries == nil || results == 0 || h.isHop(r) {
+		return
+	}
+	h.queries.Record(collection, query, time.Now())
+}
+
+// HandleSuggest returns recent and popular queries starting with q, for
+// type-ahead
+func (h *Handler) HandleSuggest(w http.ResponseWriter, r *http.Request) {
+	if h.queries == nil {
+		writeError(w, http.StatusNotImplemented, "query suggestions are disabled (set QUERY_LOG=true)", "NOT_SUPPORTED")
+		return
+	}
+
+	limit := 10
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 100 {
+			writeError(w, http.StatusBadRequest, "limit must be between 1 and 100", "INVALID_PARAM")
+			return
+		}
+		limit = n
+	}
+	coll, ok := h.resolveCollection(w, r, r.URL.Query().Get("collection"))
+	if !ok {
+		return
+	}
+
+	stats := h.queries.Suggest(coll.Name, r.URL.Query().Get("q"), limit, time.Now())
+	suggestions := make([]Suggestion, len(stats))
+	for i, s := range stats {
+		suggestions[i] = Suggestion{Query: s.Query, Count: s.Count, LastUsed: s.LastUsed}
+	}
+	writeJSON(w, http.StatusOK, SuggestResponse{Suggestions: suggestions, Count: len(suggestions)})
+}
@@ -0,0 +1,45 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestHandleSuggest(t *testing.T) {
+	store, _ := setupWALTestHandler(t)
+	queries, _ := db.NewQueryLog("", 0)
+	handler := NewHandler(store, obs.Logger("test"), WithQueryLog(queries))
+	r := chi.NewRouter()
+	r.Post("/ingest", handler.HandleIngest)
+	r.Post("/search", handler.HandleSearch)
+	r.Get("/suggest", handler.HandleSuggest)
+
+	doc := IngestRequest{ID: "550e8400-e29b-41d4-a716-446655440000", Source: "test", Title: "Plan", Text: "quarterly planning"}
+	if w := doJSON(r, http.MethodPost, "/ingest", doc); w.Code != http.StatusOK {
+		t.Fatalf("ingest failed: %d %s", w.Code, w.Body.String())
+	}
+	doJSON(r, http.MethodPost, "/search", SearchRequest{Query: "quarterly planning"})
+	doJSON(r, http.MethodPost, "/search", SearchRequest{Query: "quarterly planning", MinScore: 2}) // No results: not counted
+
+	w := doJSON(r, http.MethodGet, "/suggest?q=quar", nil)
+	var resp SuggestResponse
+	_ = json.NewDecoder(w.Body).Decode(&resp)
+	if w.Code != http.StatusOK || resp.Count != 1 || resp.Suggestions[0].Query != "quarterly planning" || resp.Suggestions[0].Count != 1 {
+		t.Fatalf("unexpected suggestions: %d %s", w.Code, w.Body.String())
+	}
+
+	if w := doJSON(r, http.MethodGet, "/suggest?limit=0", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for limit 0, got %d", w.Code)
+	}
+
+	// Without a query log the endpoint is off
+	r.Get("/off", NewHandler(store, obs.Logger("test")).HandleSuggest)
+	if w := doJSON(r, http.MethodGet, "/off", nil); w.Code != http.StatusNotImplemented {
+		t.Errorf("expected 501 without a query log, got %d", w.Code)
+	}
+}
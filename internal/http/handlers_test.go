@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/dsjohal14/selfstack/internal/libs/obs"
+	"github.com/dsjohal14/selfstack/internal/relay"
 	"github.com/dsjohal14/selfstack/internal/scope/db"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -339,3 +340,77 @@ func TestFullPipeline(t *testing.T) {
 	t.Logf("   Answer length: %d chars", len(runResp.Answer))
 	t.Logf("   Citations: %d", len(runResp.Citations))
 }
+
+func TestHandleSearchByVector(t *testing.T) {
+	_, router := setupWALTestHandler(t)
+	ingestDoc(t, router, IngestRequest{ID: "doc-1", Source: "test", Title: "Alpha", Text: "alpha"})
+	ingestDoc(t, router, IngestRequest{ID: "doc-2", Source: "test", Title: "Beta", Text: "beta"})
+
+	search := func(req SearchRequest) (*httptest.ResponseRecorder, SearchResponse) {
+		body, _ := json.Marshal(req)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/search", bytes.NewReader(body)))
+		var resp SearchResponse
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return w, resp
+	}
+
+	// An unnormalized vector is scaled to unit length
+	emb := relay.DeterministicEmbed("beta")
+	vector := make([]float32, len(emb))
+	for i, x := range emb {
+		vector[i] = 3 * x
+	}
+	w, resp := search(SearchRequest{Vector: vector, Limit: 1})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if resp.Count != 1 || resp.Results[0].DocID != "doc-2" || resp.Results[0].Score < 0.999 {
+		t.Errorf("expected doc-2 with a score of 1, got %+v", resp.Results)
+	}
+
+	for name, req := range map[string]SearchRequest{
+		"wrong dimension": {Vector: vector[:10]},
+		"keyword mode":    {Vector: vector, Mode: "keyword"},
+		"no query":        {},
+	} {
+		if w, _ := search(req); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", name, w.Code)
+		}
+	}
+}
+
+func TestHandleSearchKeywordMode(t *testing.T) {
+	_, router := setupWALTestHandler(t, func(c *db.WALStoreConfig) {
+		c.KeywordIndex = true
+	})
+
+	ingestDoc(t, router, IngestRequest{ID: "doc-1", Source: "test", Title: "Compaction", Text: "merges sealed segments"})
+	ingestDoc(t, router, IngestRequest{ID: "doc-2", Source: "test", Title: "Recovery", Text: "replays the active WAL"})
+
+	body, _ := json.Marshal(SearchRequest{Query: "sealed segments", Mode: "keyword"})
+	req := httptest.NewRequest(http.MethodPost, "/search", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp SearchResponse
+	_ = json.NewDecoder(w.Body).Decode(&resp)
+	if resp.Count != 1 || resp.Results[0].DocID != "doc-1" {
+		t.Errorf("expected only doc-1, got %+v", resp.Results)
+	}
+
+	// Legacy store has no keyword index; unknown modes are rejected
+	_, legacy := setupTestHandler(t)
+	for mode, want := range map[string]int{"keyword": http.StatusNotImplemented, "fuzzy": http.StatusBadRequest} {
+		body, _ := json.Marshal(SearchRequest{Query: "x", Mode: mode})
+		req := httptest.NewRequest(http.MethodPost, "/search", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		legacy.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("mode %s: expected status %d, got %d", mode, want, w.Code)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package httpapi
+
+import (
+	"net/http"
+
+	"github.com/dsjohal14/selfstack/internal/libs/buildinfo"
+	"github.com/dsjohal14/selfstack/internal/scope/shard"
+)
+
+// WithBuildInfo reports info at /version and stamps its instance ID on
+// responses, instead of the binary's build info without an instance ID
+func WithBuildInfo(info buildinfo.Info) HandlerOption {
+	return func(h *Handler) {
+		h.build = info
+	}
+}
+
+// HandleVersion returns the build and instance this server is running
+func (h *Handler) HandleVersion(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, VersionResponse(h.build))
+}
+
+// StampInstance is middleware that sets the instance ID header on every
+// response, so clients and peer shards can tell which instance answered
+func (h *Handler) StampInstance(next http.Handler) http.Handler {
+	if h.build.InstanceID == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(shard.InstanceHeader, h.build.InstanceID)
+		next.ServeHTTP(w, r)
+	})
+}
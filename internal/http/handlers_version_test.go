@@ -0,0 +1,44 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dsjohal14/selfstack/internal/libs/buildinfo"
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+	"github.com/dsjohal14/selfstack/internal/scope/shard"
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+)
+
+func TestHandleVersion(t *testing.T) {
+	store, err := db.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = store.Close() }()
+
+	info := buildinfo.Info{Version: "v1.4.0", Commit: "abc123", BuildTime: "2024-03-01T14:05:00Z", GoVersion: "go1.22.0", InstanceID: "instance-1"}
+	handler := NewHandler(store, zerolog.Nop(), WithBuildInfo(info))
+	r := chi.NewRouter()
+	r.Use(handler.StampInstance)
+	r.Get("/version", handler.HandleVersion)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/version", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp VersionResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp != VersionResponse(info) {
+		t.Errorf("expected %+v, got %+v", info, resp)
+	}
+	if got := w.Header().Get(shard.InstanceHeader); got != "instance-1" {
+		t.Errorf("expected the instance header on responses, got %q", got)
+	}
+}
@@ -0,0 +1,68 @@
+package httpapi
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+)
+
+// KeyHashPrefix starts a key list entry naming an API key by the full hex
+// SHA-256 of its secret, e.g. sha256:9f86d0...
+const KeyHashPrefix = "sha256:"
+
+// keySet is a list of the clients allowed to do something, like reset the
+// store: AnyKey for any live managed key or verified client certificate,
+// managed key IDs (ak_...), client certificate principals (cert_...), or
+// API keys by KeyHashPrefix and their full SHA-256. The key_... usage keys
+// at /admin/usage are labels, too short to authorize with, so they match
+// nothing.
+type keySet struct {
+	any    bool
+	ids    map[string]bool // Managed key IDs and cert_ usage keys
+	hashes [][sha256.Size]byte
+}
+
+// newKeySet parses a key list, skipping entries it can't use
+func newKeySet(entries []string) keySet {
+	s := keySet{ids: make(map[string]bool, len(entries))}
+	for _, e := range entries {
+		switch {
+		case e == AnyKey:
+			s.any = true
+		case strings.HasPrefix(e, KeyHashPrefix):
+			var sum [sha256.Size]byte
+			if b, err := hex.DecodeString(strings.TrimPrefix(e, KeyHashPrefix)); err == nil && len(b) == sha256.Size {
+				copy(sum[:], b)
+				s.hashes = append(s.hashes, sum)
+			}
+		default:
+			s.ids[e] = true
+		}
+	}
+	return s
+}
+
+// allows reports whether r was sent by a listed client. Hashes are
+// compared in constant time, all of them, so timing doesn't tell how close
+// a guess came.
+func (s keySet) allows(r *http.Request) bool {
+	key, managed := r.Context().Value(apiKeyContext{}).(db.APIKey)
+	principal := certPrincipal(r)
+	if managed && (s.any || s.ids[key.ID]) {
+		return true
+	}
+	secret := requestKey(r)
+	if secret == "" {
+		return principal != "" && (s.any || s.ids[CertKeyPrefix+principal])
+	}
+	sum := sha256.Sum256([]byte(secret))
+	match := 0
+	for _, h := range s.hashes {
+		match |= subtle.ConstantTimeCompare(sum[:], h[:])
+	}
+	return match == 1
+}
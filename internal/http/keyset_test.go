@@ -0,0 +1,52 @@
+package httpapi
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+)
+
+func TestKeySet(t *testing.T) {
+	sum := sha256.Sum256([]byte("sk-admin"))
+	request := func(secret string, managed string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if secret != "" {
+			r.Header.Set("X-API-Key", secret)
+		}
+		if managed != "" {
+			r = r.WithContext(context.WithValue(r.Context(), apiKeyContext{}, db.APIKey{ID: managed}))
+		}
+		return r
+	}
+
+	set := newKeySet([]string{KeyHashPrefix + hex.EncodeToString(sum[:]), "ak_0123456789ab", "sha256:not-hex"})
+	if !set.allows(request("sk-admin", "")) {
+		t.Error("expected the key with the listed hash allowed")
+	}
+	if !set.allows(request("sk-managed", "ak_0123456789ab")) {
+		t.Error("expected the listed managed key allowed")
+	}
+	if set.allows(request("sk-other", "")) || set.allows(request("", "")) {
+		t.Error("expected unlisted and missing keys refused")
+	}
+
+	// The truncated usage key published at /admin/usage authorizes nothing
+	label := newKeySet([]string{usageKey(request("sk-admin", ""))})
+	if label.allows(request("sk-admin", "")) {
+		t.Error("expected a usage key label not to authorize")
+	}
+
+	// * vouches for managed keys, not for whatever secret is sent
+	anyKey := newKeySet([]string{AnyKey})
+	if !anyKey.allows(request("sk-managed", "ak_0123456789ab")) {
+		t.Error("expected * to allow a managed key")
+	}
+	if anyKey.allows(request("made-up", "")) || anyKey.allows(request("", "")) {
+		t.Error("expected * to refuse unknown and missing keys")
+	}
+}
@@ -0,0 +1,54 @@
+package httpapi
+
+import (
+	"sort"
+
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+)
+
+// Retrieval strategies for /run
+const (
+	StrategySingle     = "single"      // Search the query as given (default)
+	StrategyMultiQuery = "multi_query" // Search reformulations of the query and fuse the results
+)
+
+// Multi-query retrieval settings
+const (
+	multiQueryDepth = 10 // Results fetched per sub-query before fusion
+	rrfK            = 60 // Reciprocal rank fusion damping; 60 is the usual choice
+)
+
+// fuseRRF merges ranked result lists with reciprocal rank fusion: a
+// document scores the sum of 1/(rrfK+rank) over the lists it appears in,
+// so documents several sub-queries agree on rise to the top. Each result
+// keeps its best original score, which is what callers display.
+func fuseRRF(lists [][]db.SearchResult, limit int) []db.SearchResult {
+	fused := make(map[string]float64)
+	best := make(map[string]db.SearchResult)
+	for _, list := range lists {
+		for rank, r := range list {
+			fused[r.DocID] += 1 / float64(rrfK+rank+1)
+			if prev, ok := best[r.DocID]; !ok || r.Score > prev.Score {
+				best[r.DocID] = r
+			}
+		}
+	}
+
+	out := make([]db.SearchResult, 0, len(best))
+	for _, r := range best {
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if fused[out[i].DocID] != fused[out[j].DocID] {
+			return fused[out[i].DocID] > fused[out[j].DocID]
+		}
+		if out[i].Score != out[j].Score {
+			return out[i].Score > out[j].Score
+		}
+		return out[i].DocID < out[j].DocID
+	})
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
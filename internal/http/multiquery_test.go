@@ -0,0 +1,48 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+)
+
+func TestFuseRRF(t *testing.T) {
+	lists := [][]db.SearchResult{
+		{{DocID: "a", Score: 0.9}, {DocID: "b", Score: 0.5}, {DocID: "c", Score: 0.4}},
+		{{DocID: "b", Score: 0.8}, {DocID: "d", Score: 0.7}},
+		{{DocID: "b", Score: 0.6}, {DocID: "a", Score: 0.3}},
+	}
+	got := fuseRRF(lists, 3)
+	if len(got) != 3 || got[0].DocID != "b" || got[1].DocID != "a" {
+		t.Fatalf("expected b (in every list) then a, got %+v", got)
+	}
+	if got[0].Score != 0.8 || got[1].Score != 0.9 {
+		t.Errorf("expected each result's best score, got %v and %v", got[0].Score, got[1].Score)
+	}
+}
+
+func TestHandleRunMultiQuery(t *testing.T) {
+	_, router := setupTestHandler(t)
+	doc := IngestRequest{ID: "mq-1", Source: "test", Title: "Retention", Text: "retention policies deleted documents"}
+	if w := doJSON(router, http.MethodPost, "/ingest", doc); w.Code != http.StatusOK {
+		t.Fatalf("ingest failed: %d %s", w.Code, w.Body.String())
+	}
+
+	w := doJSON(router, http.MethodPost, "/run", RunRequest{Query: "What are the retention policies for deleted documents?", Strategy: StrategyMultiQuery, Debug: true})
+	var resp RunResponse
+	_ = json.NewDecoder(w.Body).Decode(&resp)
+	if w.Code != http.StatusOK || len(resp.Citations) != 1 || resp.Citations[0].DocID != "mq-1" {
+		t.Fatalf("expected mq-1 cited, got %d %+v", w.Code, resp.Citations)
+	}
+	// The deterministic embedder only matches exact text, so the keyword
+	// reformulation is what finds the document
+	if len(resp.SubQueries) < 2 || resp.SubQueries[1] != doc.Text {
+		t.Errorf("expected the sub-queries in debug output, got %q", resp.SubQueries)
+	}
+
+	if w := doJSON(router, http.MethodPost, "/run", RunRequest{Query: "x", Strategy: "hyde"}); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown strategy, got %d", w.Code)
+	}
+}
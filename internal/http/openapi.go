@@ -0,0 +1,230 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OpenAPIVersion is the version of the API the spec describes
+const OpenAPIVersion = "1.0.0"
+
+// pathParam matches a chi URL parameter, which OpenAPI writes the same way
+var pathParam = regexp.MustCompile(`\{(\w+)\}`)
+
+// OpenAPI writes an OpenAPI 3 spec of the API as JSON, generated from the
+// route table and the DTOs' JSON tags. docs/openapi.json is its output and
+// the Python client is generated from that (make openapi).
+func OpenAPI(w io.Writer) error {
+	schemas := newSchemaSet()
+	errorRef := schemas.ref(reflect.TypeOf(ErrorResponse{}))
+	openAIErrorRef := schemas.ref(reflect.TypeOf(OpenAIErrorResponse{}))
+
+	paths := make(map[string]map[string]any)
+	for _, e := range (&Handler{}).endpoints() {
+		op := map[string]any{
+			"operationId": e.op,
+			"summary":     e.summary,
+		}
+
+		var params []any
+		for _, m := range pathParam.FindAllStringSubmatch(e.path, -1) {
+			params = append(params, map[string]any{
+				"name": m[1], "in": "path", "required": true,
+				"schema": map[string]any{"type": "string"},
+			})
+		}
+		for _, p := range e.query {
+			schema := map[string]any{"type": p.typ}
+			if p.format != "" {
+				schema["format"] = p.format
+			}
+			param := map[string]any{"name": p.name, "in": "query", "schema": schema}
+			if p.doc != "" {
+				param["description"] = p.doc
+			}
+			params = append(params, param)
+		}
+		if params != nil {
+			op["parameters"] = params
+		}
+
+		if e.request != nil {
+			contentType := "application/json"
+			if e.ndjson {
+				contentType = "application/x-ndjson"
+			}
+			op["requestBody"] = map[string]any{
+				"required": true,
+				"content":  map[string]any{contentType: map[string]any{"schema": schemas.ref(reflect.TypeOf(e.request))}},
+			}
+		}
+
+		responseType := "application/json"
+		if e.lines {
+			responseType = "application/x-ndjson"
+		}
+		content := map[string]any{responseType: map[string]any{"schema": schemas.ref(reflect.TypeOf(e.response))}}
+		if e.stream {
+			content["text/event-stream"] = map[string]any{"schema": map[string]any{"type": "string"}}
+		}
+		errRef := errorRef
+		if e.openAI {
+			errRef = openAIErrorRef
+		}
+		responses := map[string]any{
+			"200": map[string]any{"description": "OK", "content": content},
+			"default": map[string]any{
+				"description": "Error",
+				"content":     map[string]any{"application/json": map[string]any{"schema": errRef}},
+			},
+		}
+		for _, status := range e.status {
+			responses[strconv.Itoa(status)] = map[string]any{"description": http.StatusText(status), "content": content}
+		}
+		op["responses"] = responses
+
+		if paths[e.path] == nil {
+			paths[e.path] = make(map[string]any)
+		}
+		paths[e.path][strings.ToLower(e.method)] = op
+	}
+
+	spec := map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "Selfstack API",
+			"version":     OpenAPIVersion,
+			"description": "Generated by `selfstack openapi` from the route table and DTOs; do not edit.",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": schemas.schemas,
+			"securitySchemes": map[string]any{
+				"apiKey": map[string]any{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+			},
+		},
+		"security": []any{map[string]any{"apiKey": []any{}}},
+	}
+	data, err := json.MarshalIndent(spec, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	rawJSONType = reflect.TypeOf(json.RawMessage{})
+)
+
+// schemaSet collects the named types a spec refers to as components
+type schemaSet struct {
+	names   map[reflect.Type]string
+	taken   map[string]bool
+	schemas map[string]any
+}
+
+func newSchemaSet() *schemaSet {
+	return &schemaSet{
+		names:   make(map[reflect.Type]string),
+		taken:   make(map[string]bool),
+		schemas: make(map[string]any),
+	}
+}
+
+// ref returns the schema of t, adding named structs to the components and
+// referring to them there
+func (s *schemaSet) ref(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t == rawJSONType:
+		return map[string]any{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": s.ref(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": s.ref(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		name, ok := s.names[t]
+		if !ok {
+			// Types of the same name in different packages, like slo.Status
+			// and supervise.Status, are told apart by their package
+			name = t.Name()
+			if s.taken[name] {
+				pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]
+				name = strings.ToUpper(pkg[:1]) + pkg[1:] + name
+			}
+			s.names[t] = name
+			s.taken[name] = true
+			s.schemas[name] = s.object(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	}
+	// Interfaces hold anything
+	return map[string]any{}
+}
+
+// object returns the schema of a struct's JSON form
+func (s *schemaSet) object(t reflect.Type) map[string]any {
+	props := make(map[string]any)
+	s.fields(t, props)
+	return map[string]any{"type": "object", "properties": props}
+}
+
+// fields adds t's fields to props as encoding/json sees them, flattening
+// embedded structs
+func (s *schemaSet) fields(t reflect.Type, props map[string]any) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				s.fields(ft, props)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = s.ref(f.Type)
+	}
+}
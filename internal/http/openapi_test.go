@@ -0,0 +1,42 @@
+package httpapi
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestOpenAPIUpToDate fails when docs/openapi.json wasn't regenerated
+func TestOpenAPIUpToDate(t *testing.T) {
+	var buf bytes.Buffer
+	if err := OpenAPI(&buf); err != nil {
+		t.Fatal(err)
+	}
+	docs, err := os.ReadFile(filepath.Join("..", "..", "docs", "openapi.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(docs, buf.Bytes()) {
+		t.Error("docs/openapi.json is out of date; run make openapi")
+	}
+}
+
+func TestEndpoints(t *testing.T) {
+	ops := make(map[string]bool)
+	routes := make(map[string]bool)
+	for _, e := range (&Handler{}).endpoints() {
+		if e.op == "" || e.summary == "" || e.response == nil {
+			t.Errorf("%s %s needs an operation ID, summary, and response", e.method, e.path)
+		}
+		if ops[e.op] {
+			t.Errorf("operation ID %s is used twice", e.op)
+		}
+		ops[e.op] = true
+		if route := e.method + " " + e.path; routes[route] {
+			t.Errorf("%s is listed twice", route)
+		} else {
+			routes[route] = true
+		}
+	}
+}
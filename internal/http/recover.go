@@ -0,0 +1,40 @@
+package httpapi
+
+import (
+	"net/http"
+	"runtime/debug"
+
+	"github.com/dsjohal14/selfstack/internal/libs/diag"
+)
+
+// WithDiagnostics captures panics into c and reports its bundles at
+// /health, instead of diag.Default
+func WithDiagnostics(c *diag.Collector) HandlerOption {
+	return func(h *Handler) {
+		h.diag = c
+	}
+}
+
+// Recoverer is middleware that recovers from a panicking handler, captures
+// a diagnostic bundle, and answers 500. Like chi's Recoverer, it lets
+// http.ErrAbortHandler through.
+func (h *Handler) Recoverer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rvr := recover()
+			if rvr == nil {
+				return
+			}
+			if rvr == http.ErrAbortHandler {
+				panic(rvr)
+			}
+
+			b := h.diag.Report("http", rvr, debug.Stack())
+			h.logger.Error().Str("method", r.Method).Str("path", r.URL.Path).Str("bundle", b.Path).Msg("handler panicked")
+			if r.Header.Get("Connection") != "Upgrade" {
+				writeError(w, http.StatusInternalServerError, "internal server error", "INTERNAL_ERROR")
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
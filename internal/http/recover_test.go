@@ -0,0 +1,66 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dsjohal14/selfstack/internal/libs/diag"
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+)
+
+func TestRecovererCapturesBundle(t *testing.T) {
+	store, err := db.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = store.Close() }()
+
+	bundles := diag.New(t.TempDir())
+	handler := NewHandler(store, zerolog.Nop(), WithDiagnostics(bundles))
+	r := chi.NewRouter()
+	r.Use(handler.Recoverer)
+	r.Get("/health", handler.HandleHealth)
+	r.Get("/boom", func(http.ResponseWriter, *http.Request) { panic("boom") })
+
+	var health HealthResponse
+	if w := doJSON(r, http.MethodGet, "/health", nil); json.Unmarshal(w.Body.Bytes(), &health) != nil || health.Status != "healthy" || health.LastPanic != nil {
+		t.Fatalf("health before a panic = %s", w.Body.String())
+	}
+
+	w := doJSON(r, http.MethodGet, "/boom", nil)
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = doJSON(r, http.MethodGet, "/health", nil)
+	if err := json.Unmarshal(w.Body.Bytes(), &health); err != nil {
+		t.Fatal(err)
+	}
+	if health.Status != "degraded" || health.Panics != 1 || health.LastPanic == nil {
+		t.Fatalf("health after a panic = %s", w.Body.String())
+	}
+	if health.LastPanic.Source != "http" || health.LastPanic.Panic != "boom" {
+		t.Errorf("last panic = %+v", health.LastPanic)
+	}
+	if _, err := os.Stat(filepath.Join(health.LastPanic.Path, "goroutines.txt")); err != nil {
+		t.Errorf("bundle not written: %v", err)
+	}
+}
+
+func TestRecovererAbortHandler(t *testing.T) {
+	handler := NewHandler(nil, zerolog.Nop(), WithDiagnostics(diag.New("")))
+	h := handler.Recoverer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { panic(http.ErrAbortHandler) }))
+
+	defer func() {
+		if r := recover(); r != http.ErrAbortHandler {
+			t.Errorf("expected http.ErrAbortHandler to pass through, got %v", r)
+		}
+	}()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
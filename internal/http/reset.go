@@ -0,0 +1,49 @@
+package httpapi
+
+import (
+	"net/http"
+)
+
+// WithReset lets requests sent with one of keys (see keySet) wipe the
+// store at /admin/reset. Without it the endpoint refuses every request.
+func WithReset(keys []string) HandlerOption {
+	return func(h *Handler) {
+		h.resetKeys = newKeySet(keys)
+	}
+}
+
+// HandleReset wipes every document and alias and the WAL segments holding
+// them, for CI and staging environments. The request must set confirm=true.
+func (h *Handler) HandleReset(w http.ResponseWriter, r *http.Request) {
+	if !h.resetKeys.allows(r) {
+		writeError(w, http.StatusForbidden, "this API key may not reset the store; list it in RESET_KEYS", "RESET_FORBIDDEN")
+		return
+	}
+	if r.URL.Query().Get("confirm") != "true" {
+		writeError(w, http.StatusBadRequest, "reset deletes every document; set confirm=true", "CONFIRMATION_REQUIRED")
+		return
+	}
+	ws, ok := h.walStore(w)
+	if !ok {
+		return
+	}
+
+	report, err := ws.Reset(r.Context())
+	if report == nil {
+		h.logger.Error().Err(err).Msg("store reset failed")
+		writeError(w, http.StatusInternalServerError, "reset failed", "RESET_ERROR")
+		return
+	}
+	h.invalidateResults()
+	if h.aliases != nil {
+		h.aliases.Reload()
+	}
+	// The store is already empty; segments left behind are skipped by
+	// recovery and deleted by the next reset
+	if err != nil {
+		h.logger.Warn().Err(err).Msg("store reset left old segments behind")
+	}
+	h.logger.Warn().Str("key", usageKey(r)).Int("docs_removed", report.DocsRemoved).
+		Int("segments_removed", report.SegmentsRemoved).Msg("store reset")
+	writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,194 @@
+package httpapi
+
+import (
+	"net/http"
+
+	"github.com/dsjohal14/selfstack/internal/libs/flags"
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+	"github.com/dsjohal14/selfstack/internal/scope/db/wal"
+	"github.com/go-chi/chi/v5"
+)
+
+// endpoint is a route of the API and what the OpenAPI spec says about it
+type endpoint struct {
+	method   string
+	path     string
+	handler  http.HandlerFunc
+	op       string // operationId, which generated clients name their methods after
+	summary  string
+	query    []param
+	request  any   // Body, nil for none
+	response any   // Body of a 200 response
+	status   []int // Other statuses answered with response, e.g. 201 on create
+	ndjson   bool  // The body is a stream of request, one per line
+	lines    bool  // The response is a stream of response, one per line
+	stream   bool  // With "stream": true the response is server-sent events
+	openAI   bool  // Errors are in OpenAI's shape
+}
+
+// param is a query parameter
+type param struct {
+	name   string
+	typ    string // string, integer, or boolean
+	format string // e.g. date-time
+	doc    string
+}
+
+// endpoints returns the API's route table. Routes mounts it and OpenAPI
+// describes it, so the spec can't drift from the server.
+func (h *Handler) endpoints() []endpoint {
+	return []endpoint{
+		{method: http.MethodGet, path: "/health", handler: h.HandleHealth, op: "health",
+			summary: "Health, document count, and storage capabilities", response: HealthResponse{}},
+		{method: http.MethodGet, path: "/readyz", handler: h.HandleReady, op: "ready",
+			summary: "Readiness; 503 until the startup warmup finishes", response: ReadyResponse{}, status: []int{http.StatusServiceUnavailable}},
+		{method: http.MethodGet, path: "/version", handler: h.HandleVersion, op: "version",
+			summary: "Version, git SHA, build time, Go version, and instance ID", response: VersionResponse{}},
+		{method: http.MethodPost, path: "/ingest", handler: h.HandleIngest, op: "ingest",
+			summary: "Ingest a document; bulk-priority ingests are queued (202)", request: IngestRequest{}, response: IngestResponse{}, status: []int{http.StatusAccepted}},
+		{method: http.MethodPost, path: "/search", handler: h.HandleSearch, op: "search",
+			summary: "Semantic or keyword search", request: SearchRequest{}, response: SearchResponse{}},
+		{method: http.MethodPost, path: "/run", handler: h.HandleRun, op: "run",
+			summary: "Answer a query from the documents, with citations", request: RunRequest{}, response: RunResponse{}},
+		{method: http.MethodPost, path: "/retrieve", handler: h.HandleRetrieve, op: "retrieve",
+			summary: "Scored chunks for retriever plugins", request: RetrieveRequest{}, response: RetrieveResponse{}},
+		{method: http.MethodGet, path: "/suggest", handler: h.HandleSuggest, op: "suggest",
+			summary: "Past queries starting with a prefix", response: SuggestResponse{}, query: []param{
+				{name: "q", typ: "string", doc: "Prefix"},
+				{name: "collection", typ: "string"},
+				{name: "limit", typ: "integer"},
+			}},
+		{method: http.MethodGet, path: "/resolve", handler: h.HandleResolve, op: "resolve",
+			summary: "Look up a document by an alias set at ingest", response: ResolveResponse{}, query: []param{
+				{name: "alias", typ: "string", doc: "URL, file path, or other alias"},
+			}},
+		{method: http.MethodGet, path: "/documents/deleted", handler: h.HandleListDeleted, op: "listDeleted",
+			summary: "Recently deleted documents", response: DeletedListResponse{}, query: []param{
+				{name: "since", typ: "string", format: "date-time"},
+				{name: "limit", typ: "integer", doc: "1 to 1000, default 100"},
+			}},
+		{method: http.MethodGet, path: "/documents/{id}", handler: h.HandleGetDocument, op: "getDocument",
+			summary: "Fetch a document", response: DocumentResponse{}, query: []param{
+				{name: "include_embedding", typ: "boolean", doc: "Include the stored embedding; needs a key in EMBEDDING_EXPORT_KEYS"},
+			}},
+		{method: http.MethodGet, path: "/documents/{id}/similar", handler: h.HandleSimilarDocuments, op: "similarDocuments",
+			summary: "Documents most like a stored one, by its stored embedding", response: SimilarResponse{}, query: []param{
+				{name: "limit", typ: "integer", doc: "1 to 100, default 10"},
+			}},
+		{method: http.MethodDelete, path: "/documents/{id}", handler: h.HandleDeleteDocument, op: "deleteDocument",
+			summary: "Delete a document", response: DeleteResponse{}},
+		{method: http.MethodPost, path: "/documents/{id}/restore", handler: h.HandleRestoreDocument, op: "restoreDocument",
+			summary: "Restore a deleted document", response: DocumentResponse{}},
+		{method: http.MethodPost, path: "/documents/{id}/move", handler: h.HandleMoveDocument, op: "moveDocument",
+			summary: "Change a document's ID or collection atomically", request: MoveRequest{}, response: DocumentResponse{}},
+
+		// OpenAI-compatible facade
+		{method: http.MethodGet, path: "/v1/models", handler: h.HandleOpenAIModels, op: "listModels",
+			summary: "Collections as OpenAI models", response: OpenAIModelList{}, openAI: true},
+		{method: http.MethodPost, path: "/v1/embeddings", handler: h.HandleOpenAIEmbeddings, op: "createEmbeddings",
+			summary: "OpenAI-compatible embeddings", request: OpenAIEmbeddingRequest{}, response: OpenAIEmbeddingResponse{}, openAI: true},
+		{method: http.MethodPost, path: "/v1/chat/completions", handler: h.HandleOpenAIChat, op: "createChatCompletion",
+			summary: "OpenAI-compatible chat completion answered from the documents", request: OpenAIChatRequest{}, response: OpenAIChatResponse{}, stream: true, openAI: true},
+
+		// Collections
+		{method: http.MethodPost, path: "/collections", handler: h.HandlePutCollection, op: "putCollection",
+			summary: "Create (201) or replace a collection", request: db.CollectionConfig{}, response: CollectionResponse{}, status: []int{http.StatusCreated}},
+		{method: http.MethodGet, path: "/collections", handler: h.HandleListCollections, op: "listCollections",
+			summary: "List the collections", response: CollectionListResponse{}},
+		{method: http.MethodGet, path: "/collections/{name}", handler: h.HandleGetCollection, op: "getCollection",
+			summary: "A collection's config and document count", response: CollectionResponse{}},
+		{method: http.MethodDelete, path: "/collections/{name}", handler: h.HandleDeleteCollection, op: "deleteCollection",
+			summary: "Delete an empty collection", response: DeleteResponse{}},
+
+		// Admin routes
+		{method: http.MethodGet, path: "/admin/segments/events", handler: h.HandleSegmentEvents, op: "segmentEvents",
+			summary: "WAL segment lifecycle audit trail", response: SegmentEventsResponse{}, query: []param{
+				{name: "segment_id", typ: "integer"},
+				{name: "segment_type", typ: "string", doc: "wal or cmp"},
+				{name: "since", typ: "string", format: "date-time"},
+				{name: "limit", typ: "integer"},
+			}},
+		{method: http.MethodGet, path: "/admin/changelog", handler: h.HandleChangelog, op: "changelog",
+			summary: "Document and collection changes in LSN order, one per line, ending with where to continue", response: ChangelogEntry{}, lines: true, query: []param{
+				{name: "from_lsn", typ: "integer", doc: "First LSN to return (default 0, everything)"},
+				{name: "format", typ: "string", doc: "ndjson, the only format"},
+				{name: "include_embeddings", typ: "boolean", doc: "Include each document's embedding; needs an EMBEDDING_EXPORT_KEYS key"},
+			}},
+		{method: http.MethodPost, path: "/admin/changelog", handler: h.HandleImportChangelog, op: "importChangelog",
+			summary: "Replay an exported changelog, one change per line, through the WAL", request: ChangelogEntry{}, response: ChangelogImportResponse{}, ndjson: true, query: []param{
+				{name: "dry_run", typ: "boolean", doc: "Validate every line without writing anything"},
+			}},
+		{method: http.MethodGet, path: "/admin/compaction/plan", handler: h.HandleCompactionPlan, op: "compactionPlan",
+			summary: "What compaction would do", response: wal.CompactionPlan{}, query: []param{
+				{name: "force", typ: "boolean", doc: "Plan as if compaction were forced"},
+			}},
+		{method: http.MethodPost, path: "/admin/compaction", handler: h.HandleCompact, op: "compact",
+			summary: "Force compaction of sealed WAL segments", response: map[string]bool{}},
+		{method: http.MethodPost, path: "/admin/gc", handler: h.HandleGC, op: "collectGarbage",
+			summary: "Quarantine orphaned WAL files and delete expired ones", response: wal.GCReport{}, query: []param{
+				{name: "dry_run", typ: "boolean", doc: "Report what would be done without doing it"},
+			}},
+		{method: http.MethodPost, path: "/admin/reset", handler: h.HandleReset, op: "resetStore",
+			summary: "Wipe every document, alias, and WAL segment; for test environments", response: db.ResetReport{}, query: []param{
+				{name: "confirm", typ: "boolean", doc: "Must be true"},
+			}},
+		{method: http.MethodPost, path: "/admin/keys", handler: h.HandleCreateKey, op: "createKey",
+			summary: "Create an API key; its secret is returned only this once", request: CreateKeyRequest{}, response: KeySecretResponse{}, status: []int{http.StatusCreated}},
+		{method: http.MethodGet, path: "/admin/keys", handler: h.HandleListKeys, op: "listKeys",
+			summary: "The API keys, with expiry and last use", response: KeyListResponse{}},
+		{method: http.MethodGet, path: "/admin/keys/{id}", handler: h.HandleGetKey, op: "getKey",
+			summary: "An API key", response: db.APIKey{}},
+		{method: http.MethodPatch, path: "/admin/keys/{id}", handler: h.HandleUpdateKey, op: "updateKey",
+			summary: "Rename an API key or change its namespaces or expiry", request: UpdateKeyRequest{}, response: db.APIKey{}},
+		{method: http.MethodPost, path: "/admin/keys/{id}/rotate", handler: h.HandleRotateKey, op: "rotateKey",
+			summary: "Replace an API key; the old one keeps working for the overlap", response: KeySecretResponse{}, query: []param{
+				{name: "overlap", typ: "string", doc: "How long the old key keeps working, e.g. 1h (default 24h)"},
+			}},
+		{method: http.MethodDelete, path: "/admin/keys/{id}", handler: h.HandleDeleteKey, op: "deleteKey",
+			summary: "Revoke an API key at once", response: DeleteResponse{}},
+		{method: http.MethodGet, path: "/admin/flags", handler: h.HandleListFlags, op: "listFlags",
+			summary: "Feature flags", response: FlagsResponse{}},
+		{method: http.MethodPut, path: "/admin/flags/{name}", handler: h.HandleSetFlag, op: "setFlag",
+			summary: "Override a feature flag", request: SetFlagRequest{}, response: flags.State{}},
+		{method: http.MethodDelete, path: "/admin/flags/{name}", handler: h.HandleClearFlag, op: "clearFlag",
+			summary: "Drop a feature flag's override", response: flags.State{}},
+		{method: http.MethodGet, path: "/admin/usage", handler: h.HandleUsage, op: "usage",
+			summary: "Metered usage per key and period", response: UsageResponse{}, query: []param{
+				{name: "key", typ: "string"},
+				{name: "period", typ: "string", doc: "month (default) or day"},
+				{name: "from", typ: "string", format: "date"},
+				{name: "to", typ: "string", format: "date"},
+			}},
+		{method: http.MethodGet, path: "/admin/ingest/bulk", handler: h.HandleBulkStatus, op: "bulkStatus",
+			summary: "Bulk ingest queue", response: BulkStatusResponse{}},
+		{method: http.MethodPost, path: "/admin/backfill", handler: h.HandleBackfill, op: "backfill",
+			summary: "Load documents, one ingest request per line, through the bulk load path", request: IngestRequest{}, response: BackfillResponse{}, ndjson: true},
+		{method: http.MethodGet, path: "/admin/slo", handler: h.HandleSLO, op: "slo",
+			summary: "Latency objectives and whether they're met", response: SLOResponse{}},
+		{method: http.MethodGet, path: "/admin/capacity", handler: h.HandleCapacity, op: "capacity",
+			summary: "Index and WAL size with growth projections", response: CapacityResponse{}, query: []param{
+				{name: "days", typ: "integer", doc: "How far ahead to project"},
+			}},
+		{method: http.MethodGet, path: "/analytics/duplicates", handler: h.HandleDuplicates, op: "duplicates",
+			summary: "Groups of near-duplicate documents with merge/delete suggestions", response: DuplicatesResponse{}, query: []param{
+				{name: "collection", typ: "string"},
+				{name: "limit", typ: "integer", doc: "Groups to return (default 100)"},
+			}},
+		{method: http.MethodGet, path: "/admin/log-levels", handler: h.HandleGetLogLevels, op: "logLevels",
+			summary: "Default log level and per-module overrides", response: obs.LevelState{}},
+		{method: http.MethodPut, path: "/admin/log-levels/{module}", handler: h.HandleSetLogLevel, op: "setLogLevel",
+			summary: "Override a module's log level until restart", request: SetLogLevelRequest{}, response: obs.LevelState{}},
+		{method: http.MethodDelete, path: "/admin/log-levels/{module}", handler: h.HandleClearLogLevel, op: "clearLogLevel",
+			summary: "Drop a module's log level override", response: obs.LevelState{}},
+	}
+}
+
+// Routes mounts the API's endpoints on r. Middleware and /metrics are left
+// to the caller; the route table lives here so the server, the client SDK's
+// tests, and the OpenAPI spec share it.
+func (h *Handler) Routes(r chi.Router) {
+	for _, e := range h.endpoints() {
+		r.Method(e.method, e.path, e.handler)
+	}
+}
@@ -0,0 +1,98 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/dsjohal14/selfstack/internal/scope/shard"
+)
+
+// WithSharding makes the handler one node of a sharded deployment: ingests
+// are routed to the shard owning the doc ID and searches fan out to every
+// shard
+func WithSharding(router *shard.Router) HandlerOption {
+	return func(h *Handler) {
+		h.shards = router
+	}
+}
+
+// isHop reports whether r was forwarded by another shard of this
+// deployment, proven by the shard secret. Without sharding no request is.
+func (h *Handler) isHop(r *http.Request) bool {
+	return h.shards.IsHop(r)
+}
+
+// routeIngest forwards req to the shard owning its ID and relays the reply.
+// It returns false when this node owns the document and should store it.
+func (h *Handler) routeIngest(w http.ResponseWriter, r *http.Request, req IngestRequest) bool {
+	if h.shards == nil {
+		return false
+	}
+	owner, local := h.shards.Owner(req.ID)
+	if local {
+		return false
+	}
+	if h.isHop(r) {
+		// The sender's routing table disagrees with ours; don't bounce it around
+		writeError(w, http.StatusMisdirectedRequest, "document belongs to shard "+owner.ID, "WRONG_SHARD")
+		return true
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to encode request", "INTERNAL_ERROR")
+		return true
+	}
+	resp := h.shards.Forward(r.Context(), owner, "/ingest", body)
+	if resp.Err != nil {
+		h.logger.Error().Err(resp.Err).Str("doc_id", req.ID).Str("shard", owner.ID).Msg("failed to forward ingest")
+		writeError(w, http.StatusBadGateway, "owning shard "+owner.ID+" is unavailable", "SHARD_UNAVAILABLE")
+		return true
+	}
+
+	h.logger.Debug().Str("doc_id", req.ID).Str("shard", owner.ID).Str("peer_instance", resp.Instance).Int("status", resp.Status).Msg("ingest forwarded")
+	if resp.Status == http.StatusOK {
+		h.meterForwardedIngest(r, req, resp.Body)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(resp.Status)
+	_, _ = w.Write(resp.Body)
+	return true
+}
+
+// gatherSearch sends req to every other shard and merges their results into
+// results by score, keeping the top req.Limit. It returns the IDs of shards
+// that failed to answer.
+func (h *Handler) gatherSearch(r *http.Request, req SearchRequest, results []SearchResult) ([]SearchResult, []string) {
+	req.Debug = false
+	body, err := json.Marshal(req)
+	if err != nil {
+		return results, nil
+	}
+
+	var failed []string
+	for _, resp := range h.shards.Gather(r.Context(), "/search", body) {
+		var peer SearchResponse
+		switch {
+		case resp.Err != nil:
+			h.logger.Warn().Err(resp.Err).Str("shard", resp.Shard.ID).Msg("shard search failed")
+		case resp.Status != http.StatusOK:
+			h.logger.Warn().Int("status", resp.Status).Str("shard", resp.Shard.ID).Msg("shard search failed")
+		default:
+			if err := json.Unmarshal(resp.Body, &peer); err != nil {
+				h.logger.Warn().Err(err).Str("shard", resp.Shard.ID).Msg("invalid shard search response")
+				break
+			}
+			results = append(results, peer.Results...)
+			continue
+		}
+		failed = append(failed, resp.Shard.ID)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if len(results) > req.Limit {
+		results = results[:req.Limit]
+	}
+	return results, failed
+}
@@ -0,0 +1,241 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+	"github.com/dsjohal14/selfstack/internal/libs/slo"
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+	"github.com/dsjohal14/selfstack/internal/scope/shard"
+	"github.com/go-chi/chi/v5"
+)
+
+type staticRoutes struct{ t *shard.Table }
+
+func (s staticRoutes) Load(context.Context) (*shard.Table, error) { return s.t, nil }
+
+// testShardSecret is the shard secret of the nodes setupShardedNodes starts
+const testShardSecret = "shard-secret"
+
+// setupShardedNodes starts one node per shard ID, each with its own store
+// and opts, all routing with an even table
+func setupShardedNodes(t *testing.T, ids []string, opts ...HandlerOption) (map[string]*httptest.Server, map[string]*db.WALStore) {
+	t.Helper()
+	servers := make(map[string]*httptest.Server, len(ids))
+	muxes := make(map[string]*chi.Mux, len(ids))
+	shards := make([]shard.Shard, len(ids))
+	for i, id := range ids {
+		id := id
+		servers[id] = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			muxes[id].ServeHTTP(w, r)
+		}))
+		t.Cleanup(servers[id].Close)
+		shards[i] = shard.Shard{ID: id, URL: servers[id].URL}
+	}
+	table, err := shard.EvenTable(shards)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stores := make(map[string]*db.WALStore, len(ids))
+	for _, id := range ids {
+		store, _ := setupWALTestHandler(t)
+		router, err := shard.NewRouter(context.Background(), id, testShardSecret, staticRoutes{table}, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		handler := NewHandler(store, obs.Logger("test"), append([]HandlerOption{WithSharding(router)}, opts...)...)
+		r := chi.NewRouter()
+		r.Use(handler.Authenticate)
+		r.Post("/ingest", handler.HandleIngest)
+		r.Post("/search", handler.HandleSearch)
+		muxes[id], stores[id] = r, store
+	}
+	return servers, stores
+}
+
+func TestShardedIngestAndSearch(t *testing.T) {
+	servers, stores := setupShardedNodes(t, []string{"a", "b", "c"})
+	entry := servers["a"].Config.Handler
+
+	for i := 0; i < 12; i++ {
+		doc := IngestRequest{ID: fmt.Sprintf("doc-%d", i), Source: "test", Title: "Doc", Text: fmt.Sprintf("sharded text %d", i)}
+		if w := doJSON(entry, http.MethodPost, "/ingest", doc); w.Code != http.StatusOK {
+			t.Fatalf("ingest of %s failed: %d %s", doc.ID, w.Code, w.Body.String())
+		}
+	}
+
+	// Every document lives only on its owner
+	table, _ := shard.EvenTable([]shard.Shard{{ID: "a", URL: "x"}, {ID: "b", URL: "x"}, {ID: "c", URL: "x"}})
+	total := 0
+	for id, store := range stores {
+		total += store.Count()
+		store.Range(func(docID string, _ db.Document) bool {
+			if owner := table.Owner(docID).ID; owner != id {
+				t.Errorf("%s stored on %s, owned by %s", docID, id, owner)
+			}
+			return true
+		})
+	}
+	if total != 12 {
+		t.Errorf("expected 12 stored documents, got %d", total)
+	}
+
+	w := doJSON(entry, http.MethodPost, "/search", SearchRequest{Query: "sharded text 3", Limit: 12, Debug: true})
+	var resp SearchResponse
+	_ = json.NewDecoder(w.Body).Decode(&resp)
+	if resp.Count != 12 || len(resp.FailedShards) != 0 {
+		t.Fatalf("expected all 12 documents from every shard, got %d (failed %v)", resp.Count, resp.FailedShards)
+	}
+	if resp.Results[0].DocID != "doc-3" {
+		t.Errorf("expected the exact match first, got %s", resp.Results[0].DocID)
+	}
+	for i := 1; i < len(resp.Results); i++ {
+		if resp.Results[i].Score > resp.Results[i-1].Score {
+			t.Fatalf("merged results aren't sorted by score")
+		}
+	}
+	if resp.Timings.Shards != 3 {
+		t.Errorf("expected 3 shards queried, got %d", resp.Timings.Shards)
+	}
+
+	// Limits apply to the merged results
+	w = doJSON(entry, http.MethodPost, "/search", SearchRequest{Query: "sharded text 3", Limit: 2})
+	_ = json.NewDecoder(w.Body).Decode(&resp)
+	if resp.Count != 2 {
+		t.Errorf("expected 2 results, got %d", resp.Count)
+	}
+
+	// A down shard leaves partial results
+	servers["c"].Close()
+	w = doJSON(entry, http.MethodPost, "/search", SearchRequest{Query: "sharded text 3", Limit: 12})
+	resp = SearchResponse{}
+	_ = json.NewDecoder(w.Body).Decode(&resp)
+	if w.Code != http.StatusOK || len(resp.FailedShards) != 1 || resp.FailedShards[0] != "c" {
+		t.Errorf("expected partial results without c, got %d %v", w.Code, resp.FailedShards)
+	}
+	if want := 12 - stores["c"].Count(); resp.Count != want {
+		t.Errorf("expected %d results, got %d", want, resp.Count)
+	}
+}
+
+func TestShardedIngestHopToWrongShard(t *testing.T) {
+	servers, _ := setupShardedNodes(t, []string{"a", "b"})
+	table, _ := shard.EvenTable([]shard.Shard{{ID: "a", URL: "x"}, {ID: "b", URL: "x"}})
+
+	// Find a document b owns and hand it to a as if forwarded by another node
+	id := "doc-0"
+	for i := 0; table.Owner(id).ID != "b"; i++ {
+		id = fmt.Sprintf("doc-%d", i)
+	}
+	doc := IngestRequest{ID: id, Source: "test", Title: "Doc"}
+	body, _ := json.Marshal(doc)
+	req := httptest.NewRequest(http.MethodPost, "/ingest", bytes.NewReader(body))
+	req.Header.Set(shard.HopHeader, "b")
+	req.Header.Set(shard.SecretHeader, testShardSecret)
+	w := httptest.NewRecorder()
+	servers["a"].Config.Handler.ServeHTTP(w, req)
+	if w.Code != http.StatusMisdirectedRequest {
+		t.Errorf("expected 421 for a hop to the wrong shard, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestShardedAPIKeysRequired(t *testing.T) {
+	sum := sha256.Sum256([]byte("admin-secret"))
+	admin := KeyHashPrefix + hex.EncodeToString(sum[:])
+	keys, _ := db.NewAPIKeyStore("")
+	servers, stores := setupShardedNodes(t, []string{"a", "b"}, WithAPIKeys(keys, []string{admin}, true))
+	table, _ := shard.EvenTable([]shard.Shard{{ID: "a", URL: "x"}, {ID: "b", URL: "x"}})
+	id := "doc-0"
+	for i := 0; table.Owner(id).ID != "b"; i++ {
+		id = fmt.Sprintf("doc-%d", i)
+	}
+
+	ingest := func(node string, header http.Header) int {
+		body, _ := json.Marshal(IngestRequest{ID: id, Source: "test", Title: "Doc", Text: "forwarded with a key"})
+		req, _ := http.NewRequest(http.MethodPost, servers[node].URL+"/ingest", bytes.NewReader(body))
+		req.Header = header
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// The key gets the client past a; the shard secret gets a past b
+	if code := ingest("a", http.Header{"X-Api-Key": {"admin-secret"}}); code != http.StatusOK {
+		t.Fatalf("expected the forwarded ingest stored, got %d", code)
+	}
+	if stores["b"].Count() == 0 {
+		t.Error("expected the document on its owner")
+	}
+
+	// A client claiming to be a shard still needs a key
+	if code := ingest("b", http.Header{shard.HopHeader: {"a"}}); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a hop without the shard secret, got %d", code)
+	}
+	if code := ingest("b", http.Header{shard.HopHeader: {"a"}, shard.SecretHeader: {"guess"}}); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a hop with the wrong secret, got %d", code)
+	}
+}
+
+func TestUnauthenticatedHop(t *testing.T) {
+	store, _ := setupWALTestHandler(t)
+	usage, _ := db.NewUsageLog("", 0)
+	queries, _ := db.NewQueryLog("", 0)
+	objectives, _ := slo.Parse("search:1m:99")
+	h := NewHandler(store, obs.Logger("test"), WithUsage(usage), WithQueryLog(queries), WithSLOs(slo.NewTracker(objectives, time.Hour)),
+		WithBulkIngest(BulkConfig{QueueSize: 10, MaxWait: time.Minute}))
+	r := chi.NewRouter()
+	r.Post("/ingest", h.HandleIngest)
+	r.Post("/search", h.HandleSearch)
+	r.Get("/admin/usage", h.HandleUsage)
+	r.Get("/admin/slo", h.HandleSLO)
+	r.Get("/suggest", h.HandleSuggest)
+
+	// A client sending the hop header without the shard secret is a client:
+	// its bulk ingest is queued, and its search metered, logged, and timed
+	hop := func(path string, body any) int {
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(data))
+		req.Header.Set(shard.HopHeader, "b")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := hop("/ingest", IngestRequest{ID: "doc-1", Source: "test", Title: "Plan", Text: "quarterly planning", Priority: IngestBulk}); code != http.StatusAccepted {
+		t.Errorf("expected the bulk ingest queued, got %d", code)
+	}
+	if w := doJSON(r, http.MethodPost, "/ingest", IngestRequest{ID: "doc-2", Source: "test", Title: "Plan", Text: "quarterly planning"}); w.Code != http.StatusOK {
+		t.Fatalf("ingest failed: %d %s", w.Code, w.Body.String())
+	}
+	if code := hop("/search", SearchRequest{Query: "quarterly planning"}); code != http.StatusOK {
+		t.Fatalf("search failed: %d", code)
+	}
+
+	var used UsageResponse
+	_ = json.NewDecoder(doJSON(r, http.MethodGet, "/admin/usage", nil).Body).Decode(&used)
+	if used.Total.Searches != 1 {
+		t.Errorf("expected the search metered, got %+v", used.Total)
+	}
+	var suggested SuggestResponse
+	_ = json.NewDecoder(doJSON(r, http.MethodGet, "/suggest?q=quar", nil).Body).Decode(&suggested)
+	if suggested.Count != 1 {
+		t.Errorf("expected the query logged, got %+v", suggested)
+	}
+	var slos SLOResponse
+	_ = json.NewDecoder(doJSON(r, http.MethodGet, "/admin/slo", nil).Body).Decode(&slos)
+	if len(slos.Objectives) != 1 || slos.Objectives[0].Total != 1 {
+		t.Errorf("expected the search timed, got %+v", slos.Objectives)
+	}
+}
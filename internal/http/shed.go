@@ -0,0 +1,133 @@
+package httpapi
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+)
+
+// PriorityHeader lets a client lower or raise its request's priority:
+// low, normal, or high. Health, metrics, and admin requests are never shed.
+const PriorityHeader = "X-Selfstack-Priority"
+
+// Priority orders requests for load shedding; lower ones are shed first
+type Priority int
+
+// Request priorities
+const (
+	PriorityLow      Priority = iota // Searches, runs, and other reads
+	PriorityNormal                   // Ingests and other writes
+	PriorityHigh                     // Only by PriorityHeader
+	PriorityCritical                 // Health, readiness, metrics, and admin
+)
+
+var priorityNames = [...]string{"low", "normal", "high", "critical"}
+
+func (p Priority) String() string {
+	return priorityNames[p]
+}
+
+// ShedConfig sets when requests are shed. Once either limit is exceeded low
+// priority requests are shed; past 1.25 times a limit normal ones are too,
+// and past 1.5 times high ones.
+type ShedConfig struct {
+	MaxInFlight   int           // Requests being served; 0 means no limit
+	MaxQueueDepth int           // Writes waiting on the WAL writer; 0 means no limit
+	RetryAfter    time.Duration // Suggested to shed clients at the limits, growing with the load
+}
+
+// shedLevels is the load, relative to the limits, from which each
+// priority is shed
+var shedLevels = [...]float64{PriorityLow: 1, PriorityNormal: 1.25, PriorityHigh: 1.5, PriorityCritical: math.Inf(1)}
+
+// shedder counts requests in flight and sheds them under load
+type shedder struct {
+	config   ShedConfig
+	inFlight atomic.Int64
+	shed     *obs.CounterVec // Shed requests by priority
+}
+
+// queueDepther is a store that reports its write queue, like the WAL store
+type queueDepther interface {
+	QueueDepth() int
+}
+
+// WithLoadShedding rejects requests with 503 and Retry-After when the
+// server is overloaded, lowest priorities first
+func WithLoadShedding(config ShedConfig) HandlerOption {
+	return func(h *Handler) {
+		if config.RetryAfter <= 0 {
+			config.RetryAfter = time.Second
+		}
+		h.shed = &shedder{config: config, shed: newShedCounter(obs.DefaultRegistry)}
+	}
+}
+
+// newShedCounter registers the shed request metric in reg
+func newShedCounter(reg *obs.Registry) *obs.CounterVec {
+	return reg.CounterVec("selfstack_shed_requests_total", "Requests rejected by load shedding", "priority")
+}
+
+// requestPriority classifies r by its route, overridden by PriorityHeader
+// for everything but critical routes
+func requestPriority(r *http.Request) Priority {
+	path := r.URL.Path
+	if path == "/health" || path == "/readyz" || path == "/version" || path == "/metrics" || strings.HasPrefix(path, "/admin/") {
+		return PriorityCritical
+	}
+	switch strings.ToLower(r.Header.Get(PriorityHeader)) {
+	case "low":
+		return PriorityLow
+	case "normal":
+		return PriorityNormal
+	case "high":
+		return PriorityHigh
+	}
+	if r.Method == http.MethodGet || path == "/search" || path == "/run" || path == "/retrieve" || strings.HasPrefix(path, "/v1/") {
+		return PriorityLow
+	}
+	return PriorityNormal
+}
+
+// load is the server's load relative to the limits: the higher of in-flight
+// requests and write queue depth, each over its limit
+func (h *Handler) load() float64 {
+	var load float64
+	if limit := h.shed.config.MaxInFlight; limit > 0 {
+		load = float64(h.shed.inFlight.Load()) / float64(limit)
+	}
+	if limit := h.shed.config.MaxQueueDepth; limit > 0 {
+		if q, ok := h.store.(queueDepther); ok {
+			load = max(load, float64(q.QueueDepth())/float64(limit))
+		}
+	}
+	return load
+}
+
+// ShedLoad is middleware that sheds requests when the server is overloaded.
+// Requests in flight include the one being decided on.
+func (h *Handler) ShedLoad(next http.Handler) http.Handler {
+	if h.shed == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.shed.inFlight.Add(1)
+		defer h.shed.inFlight.Add(-1)
+
+		priority := requestPriority(r)
+		if load := h.load(); load > shedLevels[priority] {
+			h.shed.shed.WithLabel(priority.String()).Inc()
+			// Busier servers ask clients to stay away longer
+			retry := time.Duration(float64(h.shed.config.RetryAfter) * load)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+			writeError(w, http.StatusServiceUnavailable, "server is overloaded; retry later", "OVERLOADED")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
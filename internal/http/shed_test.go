@@ -0,0 +1,98 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+	"github.com/go-chi/chi/v5"
+)
+
+// deepQueueStore reports a fixed WAL write queue depth
+type deepQueueStore struct {
+	*db.WALStore
+	depth int
+}
+
+func (s deepQueueStore) QueueDepth() int { return s.depth }
+
+func TestShedLoadInFlight(t *testing.T) {
+	store, _ := setupWALTestHandler(t)
+	h := NewHandler(store, obs.Logger("test"), WithLoadShedding(ShedConfig{MaxInFlight: 4}))
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	r := chi.NewRouter()
+	r.Use(h.ShedLoad)
+	r.Post("/slow", func(w http.ResponseWriter, _ *http.Request) {
+		started <- struct{}{}
+		<-release
+	})
+	ok := func(w http.ResponseWriter, _ *http.Request) {}
+	r.Post("/search", ok)
+	r.Post("/ingest", ok)
+	r.Get("/health", ok)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/slow", nil))
+		}()
+		<-started
+	}
+	defer func() {
+		close(release)
+		wg.Wait()
+	}()
+
+	// With 4 requests in flight the fifth is at 1.25 times the limit
+	tests := []struct {
+		method, path, priority string
+		want                   int
+	}{
+		{http.MethodPost, "/search", "", http.StatusServiceUnavailable},
+		{http.MethodPost, "/ingest", "", http.StatusOK},
+		{http.MethodPost, "/ingest", "low", http.StatusServiceUnavailable},
+		{http.MethodPost, "/search", "high", http.StatusOK},
+		{http.MethodGet, "/health", "low", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.priority != "" {
+			req.Header.Set(PriorityHeader, tt.priority)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s %s (priority %q) = %d, want %d", tt.method, tt.path, tt.priority, w.Code, tt.want)
+		}
+		if w.Code == http.StatusServiceUnavailable && w.Header().Get("Retry-After") != "2" {
+			t.Errorf("Retry-After = %q, want 2 (1s at 1.25 times the limit)", w.Header().Get("Retry-After"))
+		}
+	}
+}
+
+func TestShedLoadQueueDepth(t *testing.T) {
+	store, _ := setupWALTestHandler(t)
+	h := NewHandler(deepQueueStore{store, 16}, obs.Logger("test"), WithLoadShedding(ShedConfig{MaxQueueDepth: 10}))
+	r := chi.NewRouter()
+	r.Use(h.ShedLoad)
+	r.Post("/search", func(http.ResponseWriter, *http.Request) {})
+	r.Post("/ingest", func(http.ResponseWriter, *http.Request) {})
+
+	// 1.6 times the limit sheds everything but critical requests
+	for _, path := range []string{"/search", "/ingest"} {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.Header.Set(PriorityHeader, "high")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("%s = %d with a deep write queue, want 503", path, w.Code)
+		}
+	}
+}
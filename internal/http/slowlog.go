@@ -0,0 +1,88 @@
+package httpapi
+
+import (
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+)
+
+// opTimings is the latency breakdown of a search or run request
+type opTimings struct {
+	start time.Time
+	last  time.Time
+
+	Embed    time.Duration // Query embedding
+	Scan     time.Duration // Index scan (semantic or keyword)
+	Rerank   time.Duration // Ordering and shaping of scan results
+	Generate time.Duration // Answer composition (run only)
+
+	Candidates int  // Documents in the index that was scanned
+	Results    int  // Results returned to the client
+	Shared     bool // Results came from a coalesced or cached scan
+}
+
+func newOpTimings() *opTimings {
+	now := time.Now()
+	return &opTimings{start: now, last: now}
+}
+
+// lap adds the time since the previous lap to phase
+func (t *opTimings) lap(phase *time.Duration) {
+	now := time.Now()
+	*phase += now.Sub(t.last)
+	t.last = now
+}
+
+// total is the time since the request started
+func (t *opTimings) total() time.Duration {
+	return time.Since(t.start)
+}
+
+// response converts the breakdown to its API form. The in-memory index is
+// a single shard.
+func (t *opTimings) response() *Timings {
+	return &Timings{
+		EmbedMS:    ms(t.Embed),
+		ScanMS:     ms(t.Scan),
+		RerankMS:   ms(t.Rerank),
+		GenerateMS: ms(t.Generate),
+		TotalMS:    ms(t.total()),
+		Candidates: t.Candidates,
+		Shards:     1,
+		Shared:     t.Shared,
+	}
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// newSlowOpsCounter registers the slow op metric in reg
+func newSlowOpsCounter(reg *obs.Registry) *obs.CounterVec {
+	return reg.CounterVec("selfstack_slow_ops_total", "Searches and runs slower than SLOW_OP_THRESHOLD", "op")
+}
+
+// observeSlowOp logs and counts op if it exceeded the slow op threshold
+func (h *Handler) observeSlowOp(op, query, mode string, limit int, t *opTimings) {
+	total := t.total()
+	if h.slowOpThreshold <= 0 || total < h.slowOpThreshold {
+		return
+	}
+	h.slowOps.WithLabel(op).Inc()
+
+	h.logger.Warn().
+		Str("op", op).
+		Str("query", query).
+		Str("mode", mode).
+		Int("limit", limit).
+		Dur("total_ms", total).
+		Dur("embed_ms", t.Embed).
+		Dur("scan_ms", t.Scan).
+		Dur("rerank_ms", t.Rerank).
+		Dur("generate_ms", t.Generate).
+		Int("candidates", t.Candidates).
+		Int("results", t.Results).
+		Bool("shared", t.Shared).
+		Dur("threshold_ms", h.slowOpThreshold).
+		Msg("slow " + op)
+}
@@ -0,0 +1,106 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+	"github.com/rs/zerolog"
+)
+
+func TestSlowOpLog(t *testing.T) {
+	store, err := db.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	prevLevel := zerolog.GlobalLevel()
+	zerolog.SetGlobalLevel(zerolog.WarnLevel)
+	t.Cleanup(func() { zerolog.SetGlobalLevel(prevLevel) })
+
+	var logs bytes.Buffer
+	reg := obs.NewRegistry()
+	handler := NewHandler(store, zerolog.New(&logs),
+		WithSlowOpThreshold(time.Nanosecond), // Everything is slow
+		WithMetrics(reg),
+	)
+
+	body, _ := json.Marshal(SearchRequest{Query: "quarterly planning"})
+	w := httptest.NewRecorder()
+	handler.HandleSearch(w, httptest.NewRequest(http.MethodPost, "/search", bytes.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("search failed: %d %s", w.Code, w.Body.String())
+	}
+
+	var entry map[string]any
+	if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+		t.Fatalf("expected one slow op log line, got %q", logs.String())
+	}
+	if entry["message"] != "slow search" || entry["query"] != "quarterly planning" {
+		t.Errorf("unexpected log entry: %v", entry)
+	}
+	for _, key := range []string{"total_ms", "embed_ms", "scan_ms", "rerank_ms", "candidates", "results"} {
+		if _, ok := entry[key]; !ok {
+			t.Errorf("slow op log missing %s: %v", key, entry)
+		}
+	}
+
+	var metrics strings.Builder
+	_ = reg.WriteText(&metrics)
+	if !strings.Contains(metrics.String(), `selfstack_slow_ops_total{op="search"} 1`) {
+		t.Errorf("slow search not counted:\n%s", metrics.String())
+	}
+
+	// Disabled threshold logs nothing
+	logs.Reset()
+	handler.slowOpThreshold = 0
+	handler.HandleSearch(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/search", bytes.NewReader(body)))
+	if logs.Len() != 0 {
+		t.Errorf("expected no slow op log with threshold 0, got %q", logs.String())
+	}
+}
+
+func TestDebugTimings(t *testing.T) {
+	_, router := setupTestHandler(t)
+
+	ingest, _ := json.Marshal(IngestRequest{ID: "doc-1", Source: "test", Title: "Notes", Text: "quarterly planning"})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/ingest", bytes.NewReader(ingest)))
+
+	post := func(path string, body any, out any) {
+		t.Helper()
+		data, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(data)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s failed: %d %s", path, w.Code, w.Body.String())
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), out)
+	}
+
+	var search SearchResponse
+	post("/search", SearchRequest{Query: "planning"}, &search)
+	if search.Timings != nil {
+		t.Error("timings should be omitted without debug")
+	}
+
+	post("/search", SearchRequest{Query: "planning", Debug: true}, &search)
+	if search.Timings == nil || search.Timings.Candidates != 1 || search.Timings.Shards != 1 {
+		t.Fatalf("unexpected search timings: %+v", search.Timings)
+	}
+	if search.Timings.TotalMS < search.Timings.ScanMS {
+		t.Errorf("total should cover the scan: %+v", search.Timings)
+	}
+
+	var run RunResponse
+	post("/run", RunRequest{Query: "planning", Debug: true}, &run)
+	if run.Timings == nil || run.Timings.Candidates != 1 {
+		t.Fatalf("unexpected run timings: %+v", run.Timings)
+	}
+}
@@ -0,0 +1,122 @@
+package httpapi
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+)
+
+// AnonymousKey is the usage key of requests without an API key
+const AnonymousKey = "anonymous"
+
+// WithUsage meters ingests, searches, and runs per API key in l
+func WithUsage(l *db.UsageLog) HandlerOption {
+	return func(h *Handler) {
+		h.usage = l
+	}
+}
+
+// requestKey returns the API key a request was sent with, from its
+// X-API-Key header or a bearer token; empty for none
+func requestKey(r *http.Request) string {
+	key := r.Header.Get("X-API-Key")
+	if auth := r.Header.Get("Authorization"); key == "" && len(auth) > len("Bearer ") && strings.EqualFold(auth[:len("Bearer ")], "Bearer ") {
+		key = strings.TrimSpace(auth[len("Bearer "):])
+	}
+	return key
+}
+
+// usageKey labels the API key a request was sent with: "key_" and the
+// first 12 hex digits of its SHA-256, so the key itself is never stored.
+// It's for display and metering only; authorization uses a keySet.
+// Requests without a key but with a client certificate are "cert_" and its
+// principal.
+func usageKey(r *http.Request) string {
+	key := requestKey(r)
+	if key == "" {
+		if principal := certPrincipal(r); principal != "" {
+			return CertKeyPrefix + principal
+		}
+		return AnonymousKey
+	}
+	sum := sha256.Sum256([]byte(key))
+	return "key_" + hex.EncodeToString(sum[:6])
+}
+
+// estimateTokens estimates the tokens an embedder or LLM bills for text, at
+// the usual four bytes per token
+func estimateTokens(texts ...string) int64 {
+	var n int64
+	for _, t := range texts {
+		n += int64(len(t)+3) / 4
+	}
+	return n
+}
+
+// meter records u against the request's API key. Requests from other
+// shards are metered by the node the client called.
+func (h *Handler) meter(r *http.Request, u db.Usage) {
+	if h.usage == nil || h.isHop(r) {
+		return
+	}
+	h.usage.Record(usageKey(r), time.Now(), u)
+}
+
+// meterForwardedIngest meters an ingest another shard stored, from its reply
+func (h *Handler) meterForwardedIngest(r *http.Request, req IngestRequest, body []byte) {
+	var resp IngestResponse
+	if err := json.Unmarshal(body, &resp); err != nil || resp.Unchanged {
+		return
+	}
+	text := req.Text
+	if text == "" {
+		text = req.Title
+	}
+	h.meter(r, db.Usage{IngestedDocs: int64(resp.Chunks), IngestedBytes: int64(len(text)), Tokens: estimateTokens(text)})
+}
+
+// HandleUsage returns metered usage per API key and in total
+// Query params: key, from and to (YYYY-MM-DD, inclusive), period (month|day)
+func (h *Handler) HandleUsage(w http.ResponseWriter, r *http.Request) {
+	if h.usage == nil {
+		writeError(w, http.StatusNotImplemented, "usage metering is disabled (set USAGE_METERING=true)", "NOT_SUPPORTED")
+		return
+	}
+
+	q := r.URL.Query()
+	query := db.UsageQuery{Key: q.Get("key")}
+	period := q.Get("period")
+	switch period {
+	case "", "month":
+		period, query.Monthly = "month", true
+	case "day":
+	default:
+		writeError(w, http.StatusBadRequest, "period must be month or day", "INVALID_PARAM")
+		return
+	}
+	for name, dst := range map[string]*time.Time{"from": &query.From, "to": &query.To} {
+		if v := q.Get(name); v != "" {
+			t, err := time.Parse("2006-01-02", v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, name+" must be a date like 2026-01-31", "INVALID_PARAM")
+				return
+			}
+			*dst = t
+		}
+	}
+
+	resp := UsageResponse{Period: period, Keys: h.usage.Usage(query), Global: []UsagePeriod{}}
+	for _, rec := range resp.Keys {
+		resp.Total.Add(rec.Usage)
+		if n := len(resp.Global); n == 0 || resp.Global[n-1].Period != rec.Period {
+			resp.Global = append(resp.Global, UsagePeriod{Period: rec.Period})
+		}
+		resp.Global[len(resp.Global)-1].Add(rec.Usage)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,81 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestHandleUsage(t *testing.T) {
+	store, _ := setupWALTestHandler(t)
+	usage, _ := db.NewUsageLog("", 0)
+	handler := NewHandler(store, obs.Logger("test"), WithUsage(usage))
+	r := chi.NewRouter()
+	r.Post("/ingest", handler.HandleIngest)
+	r.Post("/search", handler.HandleSearch)
+	r.Post("/run", handler.HandleRun)
+	r.Get("/admin/usage", handler.HandleUsage)
+
+	send := func(path string, body any, header, value string) {
+		t.Helper()
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(data))
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s failed: %d %s", path, w.Code, w.Body.String())
+		}
+	}
+	doc := IngestRequest{ID: "550e8400-e29b-41d4-a716-446655440000", Source: "test", Title: "Plan", Text: "quarterly planning notes"}
+	send("/ingest", doc, "Authorization", "Bearer sk-alpha")
+	send("/search", SearchRequest{Query: "planning"}, "X-API-Key", "sk-alpha")
+	send("/run", RunRequest{Query: "what is planned?"}, "", "")
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-API-Key", "sk-alpha")
+	alpha := usageKey(req)
+
+	w := doJSON(r, http.MethodGet, "/admin/usage?period=day", nil)
+	var resp UsageResponse
+	_ = json.NewDecoder(w.Body).Decode(&resp)
+	if w.Code != http.StatusOK || len(resp.Keys) != 2 || len(resp.Global) != 1 {
+		t.Fatalf("unexpected usage: %d %s", w.Code, w.Body.String())
+	}
+	byKey := map[string]db.Usage{}
+	for _, rec := range resp.Keys {
+		byKey[rec.Key] = rec.Usage
+	}
+	if u := byKey[alpha]; u.IngestedDocs != 1 || u.IngestedBytes != int64(len(doc.Text)) || u.Searches != 1 || u.Tokens != 6+2 {
+		t.Errorf("usage of %s = %+v", alpha, u)
+	}
+	if u := byKey[AnonymousKey]; u.Runs != 1 || u.Tokens == 0 {
+		t.Errorf("anonymous usage = %+v", u)
+	}
+	if resp.Total.Searches != 1 || resp.Total.Runs != 1 || resp.Global[0].Usage != resp.Total {
+		t.Errorf("total = %+v, global = %+v", resp.Total, resp.Global)
+	}
+
+	w = doJSON(r, http.MethodGet, "/admin/usage?key="+alpha, nil)
+	resp = UsageResponse{}
+	_ = json.NewDecoder(w.Body).Decode(&resp)
+	if resp.Period != "month" || len(resp.Keys) != 1 || len(resp.Keys[0].Period) != len("2006-01") {
+		t.Errorf("unexpected monthly usage of %s: %s", alpha, w.Body.String())
+	}
+
+	if w := doJSON(r, http.MethodGet, "/admin/usage?from=yesterday", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid from, got %d", w.Code)
+	}
+	r.Get("/off", NewHandler(store, obs.Logger("test")).HandleUsage)
+	if w := doJSON(r, http.MethodGet, "/off", nil); w.Code != http.StatusNotImplemented {
+		t.Errorf("expected 501 without metering, got %d", w.Code)
+	}
+}
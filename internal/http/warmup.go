@@ -0,0 +1,171 @@
+package httpapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+)
+
+// Warmup states reported by /readyz
+const (
+	WarmupPending = "pending" // Not started; /readyz reports ready
+	WarmupRunning = "warming"
+	WarmupDone    = "ready"
+)
+
+// warmupQuery is embedded to prime each collection's embedder
+const warmupQuery = "warmup"
+
+// warmupState tracks the startup warmup for /readyz
+type warmupState struct {
+	mu     sync.Mutex
+	report WarmupReport
+}
+
+func (s *warmupState) get() WarmupReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.report
+}
+
+func (s *warmupState) set(report WarmupReport) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.report = report
+}
+
+// StartWarmup marks the handler as warming, so /readyz fails until it's
+// done, and runs Warmup in the background. The returned channel is closed
+// when warmup finishes.
+func (h *Handler) StartWarmup(ctx context.Context, canaries []string) <-chan struct{} {
+	h.warmup.set(WarmupReport{Status: WarmupRunning, StartedAt: time.Now()})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer h.diag.Recover("warmup")
+		h.Warmup(ctx, canaries)
+	}()
+	return done
+}
+
+// Warmup pays the cold-start costs before user requests do: it scans every
+// vector in the index, embeds a query with each collection's embedder so
+// providers set up their clients, and runs the canary queries against the
+// default collection. Failures are recorded in the report; they don't keep
+// the server from becoming ready.
+func (h *Handler) Warmup(ctx context.Context, canaries []string) WarmupReport {
+	start := time.Now()
+	report := WarmupReport{Status: WarmupRunning, StartedAt: start}
+	h.warmup.set(report)
+
+	colls, errs := h.warmupCollections(ctx)
+	for _, err := range errs {
+		report.Errors = append(report.Errors, err.Error())
+	}
+
+	// Embedders first, so the index scan below doesn't pay for them
+	lap := time.Now()
+	for _, coll := range colls {
+		coll.embedder.Embed(warmupQuery)
+		report.Embedders++
+	}
+	report.EmbedMS = ms(time.Since(lap))
+
+	// A filterless scan touches every stored vector
+	lap = time.Now()
+	if len(colls) > 0 {
+		h.store.SearchFiltered(colls[0].embedder.Embed(warmupQuery), 1, db.SearchFilter{})
+	}
+	report.Documents = h.store.Count()
+	report.ScanMS = ms(time.Since(lap))
+
+	var def *collection
+	for _, coll := range colls {
+		if coll.Name == db.DefaultCollection {
+			def = coll
+		}
+	}
+	for _, query := range canaries {
+		if ctx.Err() != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("canary queries cancelled: %v", ctx.Err()))
+			break
+		}
+		if def == nil {
+			report.Errors = append(report.Errors, "canary queries skipped: default collection unavailable")
+			break
+		}
+		lap = time.Now()
+		results := h.store.SearchFiltered(def.embedder.Embed(query), 10, def.searchFilter(time.Now()))
+		results = rerank(h.rerankerOf(def), query, results)
+		report.Canaries = append(report.Canaries, CanaryResult{Query: query, Results: len(results), TookMS: ms(time.Since(lap))})
+	}
+
+	report.Status = WarmupDone
+	report.TotalMS = ms(time.Since(start))
+	h.warmup.set(report)
+
+	h.logger.Info().
+		Int("documents", report.Documents).
+		Int("embedders", report.Embedders).
+		Int("canaries", len(report.Canaries)).
+		Strs("errors", report.Errors).
+		Float64("total_ms", report.TotalMS).
+		Msg("warmup complete")
+	return report
+}
+
+// warmupCollections loads the default collection and every registered one.
+// Collections that fail to load are skipped and returned as errors.
+func (h *Handler) warmupCollections(ctx context.Context) ([]*collection, []error) {
+	var errs []error
+	names := []string{db.DefaultCollection}
+	if h.collections != nil {
+		cfgs, err := h.collections.List(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to list collections: %w", err))
+		}
+		for _, cfg := range cfgs {
+			if cfg.Name != db.DefaultCollection {
+				names = append(names, cfg.Name)
+			}
+		}
+	}
+
+	colls := make([]*collection, 0, len(names))
+	for _, name := range names {
+		coll, found, err := h.loadCollection(ctx, name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to load collection %s: %w", name, err))
+			continue
+		}
+		if found {
+			colls = append(colls, coll)
+		}
+	}
+	return colls, errs
+}
+
+// HandleReady reports whether the server should receive traffic: 503 while
+// the startup warmup runs, 200 once it's done (or when there is none)
+func (h *Handler) HandleReady(w http.ResponseWriter, _ *http.Request) {
+	report := h.warmup.get()
+	resp := ReadyResponse{Ready: report.Status != WarmupRunning}
+	if report.Status != WarmupPending {
+		resp.Warmup = &report
+	}
+	if h.supervisor != nil {
+		resp.Background = h.supervisor.Status()
+		resp.Ready = resp.Ready && h.supervisor.Healthy()
+	}
+
+	status := http.StatusOK
+	if !resp.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, resp)
+}
@@ -0,0 +1,102 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/diag"
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+	"github.com/dsjohal14/selfstack/internal/libs/supervise"
+	"github.com/dsjohal14/selfstack/internal/relay"
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+)
+
+func TestWarmupReadiness(t *testing.T) {
+	store, _ := setupWALTestHandler(t)
+	reg, err := db.NewFileCollectionRegistry(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to open registry: %v", err)
+	}
+	if err := reg.Put(context.Background(), db.CollectionConfig{Name: "notes", Embedder: relay.ProviderHashing}); err != nil {
+		t.Fatalf("failed to add collection: %v", err)
+	}
+	if err := store.Add(db.Document{ID: "550e8400-e29b-41d4-a716-446655440000", Title: "Plan", Text: "quarterly planning", Embedding: relay.DeterministicEmbed("quarterly planning")}); err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+
+	handler := NewHandler(store, obs.Logger("test"), WithCollections(reg))
+	r := chi.NewRouter()
+	r.Get("/readyz", handler.HandleReady)
+
+	ready := func() (int, ReadyResponse) {
+		t.Helper()
+		w := doJSON(r, http.MethodGet, "/readyz", nil)
+		var resp ReadyResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		return w.Code, resp
+	}
+
+	// Without a warmup the server is ready straight away
+	if code, resp := ready(); code != http.StatusOK || !resp.Ready || resp.Warmup != nil {
+		t.Errorf("expected ready without a warmup report, got %d %+v", code, resp)
+	}
+
+	handler.warmup.set(WarmupReport{Status: WarmupRunning})
+	if code, resp := ready(); code != http.StatusServiceUnavailable || resp.Ready {
+		t.Errorf("expected 503 while warming, got %d %+v", code, resp)
+	}
+
+	<-handler.StartWarmup(context.Background(), []string{"quarterly planning", "nothing"})
+	code, resp := ready()
+	if code != http.StatusOK || !resp.Ready || resp.Warmup == nil {
+		t.Fatalf("expected ready with a report, got %d %+v", code, resp)
+	}
+	report := resp.Warmup
+	if report.Status != WarmupDone || report.Documents != 1 || report.Embedders != 2 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	if len(report.Canaries) != 2 || report.Canaries[0].Results != 1 {
+		t.Errorf("expected 2 canaries with the first finding the document, got %+v", report.Canaries)
+	}
+	if len(report.Errors) != 0 {
+		t.Errorf("unexpected warmup errors: %v", report.Errors)
+	}
+}
+
+func TestReadinessBackgroundLoops(t *testing.T) {
+	store, _ := setupWALTestHandler(t)
+	sup := supervise.New(zerolog.Nop(), supervise.WithBackoff(time.Millisecond, time.Millisecond), supervise.WithMaxRestarts(1, time.Hour), supervise.WithDiagnostics(diag.New("")))
+	handler := NewHandler(store, zerolog.Nop(), WithSupervisor(sup))
+	r := chi.NewRouter()
+	r.Get("/readyz", handler.HandleReady)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sup.Go(ctx, "healthy", func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	})
+	if w := doJSON(r, http.MethodGet, "/readyz", nil); w.Code != http.StatusOK {
+		t.Fatalf("expected ready with a running loop, got %d: %s", w.Code, w.Body.String())
+	}
+
+	<-sup.Go(ctx, "broken", func(context.Context) error { panic("boom") })
+	w := doJSON(r, http.MethodGet, "/readyz", nil)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 once a loop is given up on, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp ReadyResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Background) != 2 || resp.Background[0].Name != "broken" || resp.Background[0].State != supervise.StateFailed || resp.Background[1].State != supervise.StateRunning {
+		t.Errorf("background = %+v", resp.Background)
+	}
+}
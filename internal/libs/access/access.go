@@ -0,0 +1,135 @@
+// Package access restricts who can reach the API below the API key layer,
+// for deployments inside a VPC: per-route IP allowlists (IP_ALLOWLIST) and
+// mutual TLS, where a verified client certificate's CN is mapped to a
+// principal (TLS_CLIENT_CA_FILE, TLS_CLIENT_PRINCIPALS).
+package access
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// Rule allows requests to Route only from addresses in Ranges
+type Rule struct {
+	Route  string // Exact path, a prefix ending in *, or * for every path
+	Ranges []netip.Prefix
+}
+
+// String writes r the way ParseRules reads it, e.g. /admin/*=10.0.0.0/8|192.168.1.5/32
+func (r Rule) String() string {
+	ranges := make([]string, len(r.Ranges))
+	for i, p := range r.Ranges {
+		ranges[i] = p.String()
+	}
+	return r.Route + "=" + strings.Join(ranges, "|")
+}
+
+// Matches reports whether r applies to requests for path
+func (r Rule) Matches(path string) bool {
+	if prefix, ok := strings.CutSuffix(r.Route, "*"); ok {
+		return strings.HasPrefix(path, prefix)
+	}
+	return path == r.Route
+}
+
+// specificity ranks the rules matching a path: an exact route over a
+// prefix as long, and longer prefixes over shorter ones
+func (r Rule) specificity() int {
+	if prefix, ok := strings.CutSuffix(r.Route, "*"); ok {
+		return 2 * len(prefix)
+	}
+	return 2*len(r.Route) + 1
+}
+
+// ParseRules reads comma-separated rules written as ROUTE=RANGE[|RANGE...],
+// each range a CIDR or a single IP, e.g. /admin/*=10.0.0.0/8|192.168.1.5,*=10.0.0.0/8.
+// Rules of the same route are merged.
+func ParseRules(s string) ([]Rule, error) {
+	var out []Rule
+	index := make(map[string]int)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		route, ranges, ok := strings.Cut(entry, "=")
+		route = strings.TrimSpace(route)
+		if !ok || strings.TrimSpace(ranges) == "" {
+			return nil, fmt.Errorf("invalid IP allowlist rule %q: want ROUTE=RANGE[|RANGE...], e.g. /admin/*=10.0.0.0/8", entry)
+		}
+		if route != "*" && !strings.HasPrefix(route, "/") {
+			return nil, fmt.Errorf("invalid IP allowlist rule %q: route must be a path or *", entry)
+		}
+		var prefixes []netip.Prefix
+		for _, rng := range strings.Split(ranges, "|") {
+			p, err := parsePrefix(strings.TrimSpace(rng))
+			if err != nil {
+				return nil, fmt.Errorf("invalid IP allowlist rule %q: %w", entry, err)
+			}
+			prefixes = append(prefixes, p)
+		}
+		if i, seen := index[route]; seen {
+			out[i].Ranges = append(out[i].Ranges, prefixes...)
+			continue
+		}
+		index[route] = len(out)
+		out = append(out, Rule{Route: route, Ranges: prefixes})
+	}
+	return out, nil
+}
+
+// parsePrefix reads a CIDR, or a single IP as a prefix of its full length
+func parsePrefix(s string) (netip.Prefix, error) {
+	if !strings.Contains(s, "/") {
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		addr = addr.Unmap()
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	p, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return p.Masked(), nil
+}
+
+// Allowlist decides which addresses may reach each route. Only the most
+// specific rule matching a path applies, so /admin/* can be narrower than
+// *; paths no rule matches are open to every address.
+type Allowlist struct {
+	rules []Rule
+}
+
+// NewAllowlist returns an Allowlist of rules
+func NewAllowlist(rules []Rule) *Allowlist {
+	return &Allowlist{rules: rules}
+}
+
+// Rules returns the allowlist's rules
+func (a *Allowlist) Rules() []Rule {
+	return a.rules
+}
+
+// Allows reports whether addr may send requests for path
+func (a *Allowlist) Allows(path string, addr netip.Addr) bool {
+	var match *Rule
+	for i := range a.rules {
+		r := &a.rules[i]
+		if r.Matches(path) && (match == nil || r.specificity() > match.specificity()) {
+			match = r
+		}
+	}
+	if match == nil {
+		return true
+	}
+	addr = addr.Unmap()
+	for _, p := range match.Ranges {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
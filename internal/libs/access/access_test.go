@@ -0,0 +1,104 @@
+package access
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/netip"
+	"testing"
+)
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules("/admin/*=10.0.0.0/8|192.168.1.5, *=10.0.0.0/8,/admin/*=fd00::/8,/metrics=127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/admin/*=10.0.0.0/8|192.168.1.5/32|fd00::/8", "*=10.0.0.0/8", "/metrics=127.0.0.1/32"}
+	if len(rules) != len(want) {
+		t.Fatalf("got %d rules, want %d", len(rules), len(want))
+	}
+	for i := range want {
+		if got := rules[i].String(); got != want[i] {
+			t.Errorf("rule %d = %s, want %s", i, got, want[i])
+		}
+		// String writes what ParseRules reads
+		again, err := ParseRules(rules[i].String())
+		if err != nil || len(again) != 1 || again[0].String() != want[i] {
+			t.Errorf("%s doesn't parse back: %+v, %v", rules[i], again, err)
+		}
+	}
+
+	for _, bad := range []string{
+		"admin=10.0.0.0/8",
+		"/admin",
+		"/admin=",
+		"/admin=10.0.0.0/33",
+		"/admin=not-an-ip",
+		"/admin=10.0.0.0/8|",
+	} {
+		if _, err := ParseRules(bad); err == nil {
+			t.Errorf("expected %q to be refused", bad)
+		}
+	}
+}
+
+func TestAllowlist(t *testing.T) {
+	rules, err := ParseRules("*=10.0.0.0/8,/admin/*=10.1.0.0/16,/admin/usage=10.2.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := NewAllowlist(rules)
+
+	tests := []struct {
+		path, addr string
+		want       bool
+	}{
+		{"/search", "10.9.9.9", true},
+		{"/search", "192.168.1.1", false},
+		{"/search", "::ffff:10.9.9.9", true}, // IPv4-mapped
+		{"/admin/keys", "10.1.2.3", true},
+		{"/admin/keys", "10.9.9.9", false}, // /admin/* is narrower than *
+		{"/admin/usage", "10.2.0.1", true}, // The exact route wins over /admin/*
+		{"/admin/usage", "10.1.2.3", false},
+	}
+	for _, tt := range tests {
+		if got := a.Allows(tt.path, netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("Allows(%s, %s) = %v, want %v", tt.path, tt.addr, got, tt.want)
+		}
+	}
+
+	if !NewAllowlist(nil).Allows("/admin/keys", netip.MustParseAddr("203.0.113.7")) {
+		t.Error("expected an empty allowlist to allow every address")
+	}
+}
+
+func TestPrincipal(t *testing.T) {
+	principals, err := ParsePrincipals("ingest-worker.internal=ingest, ci runner=ci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := func(cn string) *x509.Certificate {
+		return &x509.Certificate{Subject: pkix.Name{CommonName: cn}}
+	}
+
+	if p, ok := Principal(cert("ingest-worker.internal"), principals); !ok || p != "ingest" {
+		t.Errorf("Principal = %q, %v; want ingest", p, ok)
+	}
+	if p, ok := Principal(cert("ci runner"), principals); !ok || p != "ci" {
+		t.Errorf("Principal = %q, %v; want ci", p, ok)
+	}
+	if _, ok := Principal(cert("laptop"), principals); ok {
+		t.Error("expected an unmapped CN to be refused")
+	}
+	if p, ok := Principal(cert("laptop"), nil); !ok || p != "laptop" {
+		t.Errorf("expected the CN without principals, got %q, %v", p, ok)
+	}
+	if _, ok := Principal(cert("ci runner"), nil); ok {
+		t.Error("expected a CN that isn't a principal name to be refused")
+	}
+
+	for _, bad := range []string{"ingest", "=ingest", "cn=", "cn=has space"} {
+		if _, err := ParsePrincipals(bad); err == nil {
+			t.Errorf("expected %q to be refused", bad)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package access
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Client certificate modes of TLS_CLIENT_AUTH
+const (
+	ClientAuthRequire  = "require"  // Refuse connections without a verified client certificate
+	ClientAuthOptional = "optional" // Verify client certificates when presented
+)
+
+// ServerTLS returns the TLS config of a server presenting certFile and
+// keyFile. With clientCAFile, client certificates are verified against its
+// CAs, and required unless clientAuth is optional.
+func ServerTLS(certFile, keyFile, clientCAFile, clientAuth string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if clientCAFile == "" {
+		return cfg, nil
+	}
+
+	pool, err := LoadCertPool(clientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	cfg.ClientCAs = pool
+	switch clientAuth {
+	case ClientAuthRequire, "":
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	case ClientAuthOptional:
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	default:
+		return nil, fmt.Errorf("invalid client auth %q: must be require or optional", clientAuth)
+	}
+	return cfg, nil
+}
+
+// LoadCertPool reads the PEM certificates in path into a pool
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no PEM certificates in %s", path)
+	}
+	return pool, nil
+}
+
+// principalName is what a principal may be called, so it reads the same in
+// usage keys and logs
+var principalName = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// ParsePrincipals reads comma-separated CN=PRINCIPAL pairs mapping client
+// certificate common names to principals, e.g. ingest-worker.internal=ingest
+func ParsePrincipals(s string) (map[string]string, error) {
+	out := make(map[string]string)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		cn, principal, ok := strings.Cut(entry, "=")
+		cn, principal = strings.TrimSpace(cn), strings.TrimSpace(principal)
+		if !ok || cn == "" {
+			return nil, fmt.Errorf("invalid principal %q: want CN=PRINCIPAL", entry)
+		}
+		if !principalName.MatchString(principal) {
+			return nil, fmt.Errorf("invalid principal %q: must be 1-64 letters, digits, '.', '_', or '-'", entry)
+		}
+		out[cn] = principal
+	}
+	return out, nil
+}
+
+// Principal returns the principal of a verified client certificate: its
+// CN mapped by principals, or the CN itself when principals is empty. It
+// reports false for CNs principals doesn't map, and for CNs that aren't a
+// valid principal name.
+func Principal(cert *x509.Certificate, principals map[string]string) (string, bool) {
+	cn := cert.Subject.CommonName
+	if len(principals) > 0 {
+		p, ok := principals[cn]
+		return p, ok
+	}
+	return cn, principalName.MatchString(cn)
+}
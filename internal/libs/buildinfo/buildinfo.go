@@ -0,0 +1,106 @@
+// Package buildinfo describes the running binary and identifies the
+// deployment it serves. Release builds stamp the version with -ldflags:
+//
+//	go build -ldflags "-X github.com/dsjohal14/selfstack/internal/libs/buildinfo.Version=v1.4.0 \
+//		-X github.com/dsjohal14/selfstack/internal/libs/buildinfo.Commit=$(git rev-parse HEAD) \
+//		-X github.com/dsjohal14/selfstack/internal/libs/buildinfo.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./cmd/api
+//
+// `make build` does this. Unstamped builds report version "dev" and take the
+// commit and time from the VCS info Go embeds, when there is any.
+package buildinfo
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// Set at build time with -ldflags -X
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildTime = ""
+)
+
+// InstanceFile is the file in the data directory holding the instance ID
+const InstanceFile = "instance_id"
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// Info describes a running instance
+type Info struct {
+	Version    string `json:"version"`
+	Commit     string `json:"commit"`
+	BuildTime  string `json:"build_time"`
+	GoVersion  string `json:"go_version"`
+	InstanceID string `json:"instance_id,omitempty"`
+}
+
+// Get returns the build info of this binary, without an instance ID
+func Get() Info {
+	info := Info{Version: Version, Commit: Commit, BuildTime: BuildTime, GoVersion: runtime.Version()}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			switch {
+			case s.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = s.Value
+			case s.Key == "vcs.time" && info.BuildTime == "":
+				info.BuildTime = s.Value
+			}
+		}
+	}
+	return info
+}
+
+// LoadInstanceID returns the instance ID stored in dataDir, generating and
+// saving a random UUID the first time. The ID survives restarts and
+// upgrades, and changes only when the data directory is replaced.
+func LoadInstanceID(dataDir string) (string, error) {
+	path := filepath.Join(dataDir, InstanceFile)
+	data, err := os.ReadFile(path)
+	if err == nil {
+		id := strings.TrimSpace(string(data))
+		if !uuidPattern.MatchString(id) {
+			return "", fmt.Errorf("invalid instance ID in %s: %q", path, id)
+		}
+		return id, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("failed to read instance ID: %w", err)
+	}
+
+	id, err := newUUID()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate instance ID: %w", err)
+	}
+	if err := os.MkdirAll(dataDir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create data directory: %w", err)
+	}
+	// Write to a temp file and rename, so a crash never leaves a partial ID
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(id+"\n"), 0o644); err != nil {
+		return "", fmt.Errorf("failed to write instance ID: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return "", fmt.Errorf("failed to save instance ID: %w", err)
+	}
+	return id, nil
+}
+
+// newUUID returns a random (version 4) UUID
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
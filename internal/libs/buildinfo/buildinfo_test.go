@@ -0,0 +1,56 @@
+package buildinfo
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	info := Get()
+	if info.Version != Version {
+		t.Errorf("expected version %q, got %q", Version, info.Version)
+	}
+	if info.GoVersion != runtime.Version() {
+		t.Errorf("expected Go version %q, got %q", runtime.Version(), info.GoVersion)
+	}
+	if info.InstanceID != "" {
+		t.Errorf("expected no instance ID, got %q", info.InstanceID)
+	}
+}
+
+func TestLoadInstanceID(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "data")
+
+	id, err := LoadInstanceID(dir)
+	if err != nil {
+		t.Fatalf("LoadInstanceID failed: %v", err)
+	}
+	if !uuidPattern.MatchString(id) || id[14] != '4' {
+		t.Errorf("expected a version 4 UUID, got %q", id)
+	}
+
+	again, err := LoadInstanceID(dir)
+	if err != nil {
+		t.Fatalf("second LoadInstanceID failed: %v", err)
+	}
+	if again != id {
+		t.Errorf("expected the stored ID %q, got %q", id, again)
+	}
+
+	other, err := LoadInstanceID(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == id {
+		t.Error("expected a different ID for another data directory")
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, InstanceFile), []byte("not-a-uuid\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadInstanceID(dir); err == nil {
+		t.Error("expected an error for a corrupt instance ID")
+	}
+}
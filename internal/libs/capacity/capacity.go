@@ -0,0 +1,110 @@
+// Package capacity samples the size of the index and the WAL over a rolling
+// window and projects their growth, so operators can scale before hitting
+// memory or disk limits.
+package capacity
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultWindow is the window growth is measured over
+const DefaultWindow = 24 * time.Hour
+
+// SampleInterval is how often sizes should be recorded
+const SampleInterval = 5 * time.Minute
+
+// day is the unit growth rates are reported in
+const day = 24 * time.Hour
+
+// Sample is the size of the store at a point in time
+type Sample struct {
+	At         time.Time
+	Documents  int
+	IndexBytes int64 // Estimated memory of the index
+	WALBytes   int64 // WAL segments on disk
+}
+
+// Growth is how fast the store grew over a window, per day
+type Growth struct {
+	Window           string  `json:"window"` // Span of the samples the rates come from
+	DocumentsPerDay  float64 `json:"documents_per_day"`
+	IndexBytesPerDay float64 `json:"index_bytes_per_day"`
+	WALBytesPerDay   float64 `json:"wal_bytes_per_day"`
+	Samples          int     `json:"samples"`
+}
+
+// Tracker keeps the samples recorded within a rolling window
+type Tracker struct {
+	window time.Duration
+
+	mu      sync.Mutex
+	samples []Sample // Oldest first
+}
+
+// NewTracker keeps samples for window (DefaultWindow if <= 0)
+func NewTracker(window time.Duration) *Tracker {
+	if window <= 0 {
+		window = DefaultWindow
+	}
+	return &Tracker{window: window}
+}
+
+// Window returns the window growth is measured over
+func (t *Tracker) Window() time.Duration {
+	return t.window
+}
+
+// Record adds s, dropping samples that have left the window. Samples must
+// be recorded in time order.
+func (t *Tracker) Record(s Sample) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.samples = append(t.samples, s)
+	cutoff := s.At.Add(-t.window)
+	drop := 0
+	for drop < len(t.samples)-1 && t.samples[drop].At.Before(cutoff) {
+		drop++
+	}
+	t.samples = t.samples[drop:]
+}
+
+// Growth returns the growth between the oldest and newest samples. It's
+// false until two samples a moment apart have been recorded.
+func (t *Tracker) Growth() (Growth, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.samples) < 2 {
+		return Growth{}, false
+	}
+	first, last := t.samples[0], t.samples[len(t.samples)-1]
+	span := last.At.Sub(first.At)
+	if span <= 0 {
+		return Growth{}, false
+	}
+	days := float64(span) / float64(day)
+	return Growth{
+		Window:           span.Round(time.Second).String(),
+		DocumentsPerDay:  float64(last.Documents-first.Documents) / days,
+		IndexBytesPerDay: float64(last.IndexBytes-first.IndexBytes) / days,
+		WALBytesPerDay:   float64(last.WALBytes-first.WALBytes) / days,
+		Samples:          len(t.samples),
+	}, true
+}
+
+// Project returns what current grows to after d at perDay
+func Project(current int64, perDay float64, d time.Duration) int64 {
+	return current + int64(perDay*float64(d)/float64(day))
+}
+
+// Until returns how long current takes to reach limit at perDay. It's
+// false when there's no limit or the size isn't growing.
+func Until(current, limit int64, perDay float64) (time.Duration, bool) {
+	if limit <= 0 || perDay <= 0 {
+		return 0, false
+	}
+	if current >= limit {
+		return 0, true
+	}
+	return time.Duration(float64(limit-current) / perDay * float64(day)), true
+}
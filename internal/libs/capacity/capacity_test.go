@@ -0,0 +1,54 @@
+package capacity
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTrackerGrowth(t *testing.T) {
+	tr := NewTracker(2 * time.Hour)
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tr.Record(Sample{At: start, Documents: 100, IndexBytes: 1000, WALBytes: 5000})
+	if _, ok := tr.Growth(); ok {
+		t.Fatal("expected no growth from a single sample")
+	}
+
+	// An hour is 1/24 of a day
+	tr.Record(Sample{At: start.Add(time.Hour), Documents: 110, IndexBytes: 1100, WALBytes: 5200})
+	g, ok := tr.Growth()
+	if !ok {
+		t.Fatal("expected growth from two samples")
+	}
+	if g.DocumentsPerDay != 240 || g.IndexBytesPerDay != 2400 || g.WALBytesPerDay != 4800 {
+		t.Errorf("growth = %+v", g)
+	}
+	if g.Window != "1h0m0s" || g.Samples != 2 {
+		t.Errorf("window = %s over %d samples", g.Window, g.Samples)
+	}
+
+	// Samples older than the window are dropped
+	tr.Record(Sample{At: start.Add(3 * time.Hour), Documents: 110, IndexBytes: 1100, WALBytes: 5200})
+	g, _ = tr.Growth()
+	if g.Samples != 2 || g.DocumentsPerDay != 0 {
+		t.Errorf("growth after the first sample left the window = %+v", g)
+	}
+}
+
+func TestProjectAndUntil(t *testing.T) {
+	if got := Project(1000, 100, 10*day); got != 2000 {
+		t.Errorf("Project = %d, want 2000", got)
+	}
+	if d, ok := Until(1000, 2000, 100); !ok || d != 10*day {
+		t.Errorf("Until = %v %v, want 240h", d, ok)
+	}
+	if d, ok := Until(3000, 2000, 100); !ok || d != 0 {
+		t.Errorf("Until over the limit = %v %v, want 0", d, ok)
+	}
+	if _, ok := Until(1000, 0, 100); ok {
+		t.Error("expected no projection without a limit")
+	}
+	if _, ok := Until(1000, 2000, -5); ok {
+		t.Error("expected no projection when shrinking")
+	}
+}
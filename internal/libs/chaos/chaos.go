@@ -0,0 +1,161 @@
+// Package chaos injects faults into API requests, like added latency, 5xx
+// errors, and dropped connections, so client teams can test their retries
+// against realistic failures in staging. It's configured by CHAOS_RULES,
+// which config refuses in production.
+package chaos
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Fault is a kind of failure a rule injects
+type Fault string
+
+// Faults
+const (
+	FaultLatency Fault = "latency" // Delay the request
+	FaultError   Fault = "error"   // Answer with a 5xx error instead of serving it
+	FaultDrop    Fault = "drop"    // Close the connection without answering
+)
+
+// Rule injects Fault into a share of the requests to Route
+type Rule struct {
+	Route string // Exact path, a prefix ending in *, or * for every path
+	Fault Fault
+	Rate  float64 // Share of matching requests, e.g. 0.05
+
+	MinDelay, MaxDelay time.Duration // Latency: the delay is uniform between them
+	Status             int           // Error: the 5xx status answered
+}
+
+// String writes r the way Parse reads it, e.g. /search:latency:20:100ms-2s
+func (r Rule) String() string {
+	s := fmt.Sprintf("%s:%s:%s", r.Route, r.Fault, strconv.FormatFloat(r.Rate*100, 'f', -1, 64))
+	switch r.Fault {
+	case FaultLatency:
+		s += ":" + r.MinDelay.String()
+		if r.MaxDelay != r.MinDelay {
+			s += "-" + r.MaxDelay.String()
+		}
+	case FaultError:
+		s += ":" + strconv.Itoa(r.Status)
+	}
+	return s
+}
+
+// Matches reports whether r applies to requests for path
+func (r Rule) Matches(path string) bool {
+	if prefix, ok := strings.CutSuffix(r.Route, "*"); ok {
+		return strings.HasPrefix(path, prefix)
+	}
+	return path == r.Route
+}
+
+// Parse reads comma-separated rules written as ROUTE:FAULT:PERCENT[:ARG].
+// Latency takes a delay or a range of them, e.g. 100ms-2s; error takes a
+// 5xx status, 503 if left out; drop takes nothing. For example,
+// /search:latency:20:100ms-2s,/ingest:error:5:500,*:drop:1.
+func Parse(s string) ([]Rule, error) {
+	var out []Rule
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.Split(entry, ":")
+		if len(parts) < 3 || len(parts) > 4 {
+			return nil, fmt.Errorf("invalid chaos rule %q: want ROUTE:FAULT:PERCENT[:ARG], e.g. /search:latency:20:100ms-2s", entry)
+		}
+		r := Rule{Route: parts[0], Fault: Fault(parts[1])}
+		if r.Route != "*" && !strings.HasPrefix(r.Route, "/") {
+			return nil, fmt.Errorf("invalid chaos rule %q: route must be a path or *", entry)
+		}
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(parts[2], "%"), 64)
+		if err != nil || percent <= 0 || percent > 100 {
+			return nil, fmt.Errorf("invalid chaos rule %q: percent must be above 0 and at most 100", entry)
+		}
+		r.Rate = percent / 100
+		arg := ""
+		if len(parts) == 4 {
+			arg = parts[3]
+		}
+
+		switch r.Fault {
+		case FaultLatency:
+			lo, hi, isRange := strings.Cut(arg, "-")
+			if !isRange {
+				hi = lo
+			}
+			r.MinDelay, err = time.ParseDuration(lo)
+			if err == nil {
+				r.MaxDelay, err = time.ParseDuration(hi)
+			}
+			if err != nil || r.MinDelay <= 0 || r.MaxDelay < r.MinDelay {
+				return nil, fmt.Errorf("invalid chaos rule %q: latency needs a positive delay or range, e.g. 100ms-2s", entry)
+			}
+		case FaultError:
+			r.Status = 503
+			if arg != "" {
+				if r.Status, err = strconv.Atoi(arg); err != nil || r.Status < 500 || r.Status > 599 {
+					return nil, fmt.Errorf("invalid chaos rule %q: error status must be 5xx", entry)
+				}
+			}
+		case FaultDrop:
+			if arg != "" {
+				return nil, fmt.Errorf("invalid chaos rule %q: drop takes no argument", entry)
+			}
+		default:
+			return nil, fmt.Errorf("invalid chaos rule %q: fault must be latency, error, or drop", entry)
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+// Decision is the faults picked for one request
+type Decision struct {
+	Delay  time.Duration // Added before the request is served or failed
+	Status int           // Fail with this status; 0 to serve the request
+	Drop   bool          // Close the connection; wins over Status
+}
+
+// Injector picks the faults of requests by its rules. Each matching rule
+// rolls on its own, so delays of several rules add up.
+type Injector struct {
+	rules []Rule
+}
+
+// NewInjector returns an Injector of rules
+func NewInjector(rules []Rule) *Injector {
+	return &Injector{rules: rules}
+}
+
+// Rules returns the injector's rules
+func (in *Injector) Rules() []Rule {
+	return in.rules
+}
+
+// Decide picks the faults of a request for path
+func (in *Injector) Decide(path string) Decision {
+	var d Decision
+	for _, r := range in.rules {
+		if !r.Matches(path) || rand.Float64() >= r.Rate {
+			continue
+		}
+		switch r.Fault {
+		case FaultLatency:
+			d.Delay += r.MinDelay + time.Duration(rand.Int63n(int64(r.MaxDelay-r.MinDelay)+1))
+		case FaultError:
+			if d.Status == 0 {
+				d.Status = r.Status
+			}
+		case FaultDrop:
+			d.Drop = true
+		}
+	}
+	return d
+}
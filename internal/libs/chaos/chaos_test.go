@@ -0,0 +1,65 @@
+package chaos
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	rules, err := Parse("/search:latency:20:100ms-2s, /ingest:error:5%:500,/documents/*:error:50,*:drop:100,/run:latency:1:50ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Rule{
+		{Route: "/search", Fault: FaultLatency, Rate: 0.2, MinDelay: 100 * time.Millisecond, MaxDelay: 2 * time.Second},
+		{Route: "/ingest", Fault: FaultError, Rate: 0.05, Status: 500},
+		{Route: "/documents/*", Fault: FaultError, Rate: 0.5, Status: 503},
+		{Route: "*", Fault: FaultDrop, Rate: 1},
+		{Route: "/run", Fault: FaultLatency, Rate: 0.01, MinDelay: 50 * time.Millisecond, MaxDelay: 50 * time.Millisecond},
+	}
+	if len(rules) != len(want) {
+		t.Fatalf("got %d rules, want %d", len(rules), len(want))
+	}
+	for i := range want {
+		if rules[i] != want[i] {
+			t.Errorf("rule %d = %+v, want %+v", i, rules[i], want[i])
+		}
+		// String writes what Parse reads
+		again, err := Parse(rules[i].String())
+		if err != nil || len(again) != 1 || again[0] != rules[i] {
+			t.Errorf("%s doesn't parse back: %+v, %v", rules[i], again, err)
+		}
+	}
+
+	for _, bad := range []string{
+		"search:error:5",
+		"/search:error",
+		"/search:error:0",
+		"/search:error:101",
+		"/search:error:5:404",
+		"/search:latency:5",
+		"/search:latency:5:2s-1s",
+		"/search:drop:5:1s",
+		"/search:panic:5",
+	} {
+		if _, err := Parse(bad); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestDecide(t *testing.T) {
+	rules, _ := Parse("/search:latency:100:10ms-20ms,/search:latency:100:5ms,/search:error:100:502,/documents/*:drop:100")
+	in := NewInjector(rules)
+
+	d := in.Decide("/search")
+	if d.Delay < 15*time.Millisecond || d.Delay > 25*time.Millisecond || d.Status != 502 || d.Drop {
+		t.Errorf("/search: %+v", d)
+	}
+	if d := in.Decide("/documents/a"); !d.Drop || d.Delay != 0 {
+		t.Errorf("/documents/a: %+v", d)
+	}
+	if d := in.Decide("/ingest"); d != (Decision{}) {
+		t.Errorf("/ingest: %+v", d)
+	}
+}
@@ -0,0 +1,76 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeTicker(t *testing.T) {
+	start := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	fake := NewFake(start)
+	ticker := fake.NewTicker(time.Minute)
+
+	select {
+	case <-ticker.C():
+		t.Fatal("expected no tick before the clock moves")
+	default:
+	}
+
+	// Ticks a receiver misses are dropped, keeping one buffered
+	fake.Advance(3 * time.Minute)
+	if at := <-ticker.C(); !at.Equal(start.Add(time.Minute)) {
+		t.Errorf("expected the first tick at +1m, got %s", at)
+	}
+	select {
+	case at := <-ticker.C():
+		t.Errorf("expected later ticks dropped, got %s", at)
+	default:
+	}
+	if !fake.Now().Equal(start.Add(3 * time.Minute)) {
+		t.Errorf("expected the clock at +3m, got %s", fake.Now())
+	}
+
+	// Stopped tickers don't fire, and time doesn't go backwards
+	ticker.Stop()
+	fake.Advance(time.Minute)
+	select {
+	case <-ticker.C():
+		t.Error("expected no tick after Stop")
+	default:
+	}
+	fake.Set(start)
+	if !fake.Now().Equal(start.Add(4 * time.Minute)) {
+		t.Errorf("expected Set to ignore an earlier time, got %s", fake.Now())
+	}
+}
+
+func TestFakeWaitForTickers(t *testing.T) {
+	fake := NewFake(time.Now())
+	ticked := make(chan time.Time)
+	go func() {
+		ticker := fake.NewTicker(time.Second)
+		defer ticker.Stop()
+		ticked <- <-ticker.C()
+	}()
+
+	fake.WaitForTickers(1)
+	fake.Advance(time.Second)
+	<-ticked
+	if Since(fake, fake.Now().Add(-time.Second)) != time.Second {
+		t.Error("expected Since to read the fake clock")
+	}
+}
+
+func TestIDs(t *testing.T) {
+	seq := Sequence("job-")
+	if a, b := seq.NewID(), seq.NewID(); a != "job-1" || b != "job-2" {
+		t.Errorf("expected job-1 and job-2, got %s and %s", a, b)
+	}
+	random := OrRandom(nil, 8)
+	if a, b := random.NewID(), random.NewID(); len(a) != 16 || a == b {
+		t.Errorf("expected distinct 16 character IDs, got %s and %s", a, b)
+	}
+	if Or(nil) == nil {
+		t.Error("expected the system clock for nil")
+	}
+}
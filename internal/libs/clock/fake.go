@@ -0,0 +1,129 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Fake is a Clock for tests that only moves when told to. Its tickers fire
+// as Advance passes their ticks, so a test can step a background loop
+// deterministically: wait for the loop's ticker with WaitForTickers, then
+// Advance past the interval.
+type Fake struct {
+	mu      sync.Mutex
+	now     time.Time
+	tickers []*fakeTicker
+	changed chan struct{} // Closed and replaced when a ticker is made or stopped
+}
+
+// NewFake returns a fake clock reading start
+func NewFake(start time.Time) *Fake {
+	return &Fake{now: start, changed: make(chan struct{})}
+}
+
+// Now returns the fake time
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// NewTicker returns a ticker that fires every d of fake time
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t := &fakeTicker{clock: f, period: d, next: f.now.Add(d), c: make(chan time.Time, 1)}
+	f.tickers = append(f.tickers, t)
+	f.notifyLocked()
+	return t
+}
+
+// Advance moves the clock forward by d, firing the tickers whose ticks it
+// passes in time order
+func (f *Fake) Advance(d time.Duration) {
+	f.Set(f.Now().Add(d))
+}
+
+// Set moves the clock to t, firing the tickers whose ticks it passes. Time
+// never goes backwards: an earlier t is ignored.
+func (f *Fake) Set(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for {
+		var due *fakeTicker
+		for _, tk := range f.tickers {
+			if !tk.next.After(t) && (due == nil || tk.next.Before(due.next)) {
+				due = tk
+			}
+		}
+		if due == nil {
+			break
+		}
+		if due.next.After(f.now) {
+			f.now = due.next
+		}
+		select {
+		case due.c <- due.next:
+		default: // Dropped, like a real ticker's for a slow receiver
+		}
+		due.next = due.next.Add(due.period)
+	}
+	if t.After(f.now) {
+		f.now = t
+	}
+}
+
+// Tickers returns the number of running tickers
+func (f *Fake) Tickers() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.tickers)
+}
+
+// WaitForTickers blocks until at least n tickers are running, so a test
+// knows the loops it started are waiting on the clock before advancing it
+func (f *Fake) WaitForTickers(n int) {
+	for {
+		f.mu.Lock()
+		running, changed := len(f.tickers), f.changed
+		f.mu.Unlock()
+		if running >= n {
+			return
+		}
+		<-changed
+	}
+}
+
+func (f *Fake) notifyLocked() {
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+type fakeTicker struct {
+	clock  *Fake
+	period time.Duration
+	next   time.Time
+	c      chan time.Time
+}
+
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTicker) Stop() {
+	f := t.clock
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, tk := range f.tickers {
+		if tk == t {
+			f.tickers = append(f.tickers[:i], f.tickers[i+1:]...)
+			f.notifyLocked()
+			return
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package clock
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync/atomic"
+)
+
+// IDs generates unique IDs
+type IDs interface {
+	NewID() string
+}
+
+// RandomIDs returns a generator of n random bytes in hex
+func RandomIDs(n int) IDs {
+	return randomIDs(n)
+}
+
+// OrRandom returns ids, or a generator of n random bytes if ids is nil
+func OrRandom(ids IDs, n int) IDs {
+	if ids == nil {
+		return randomIDs(n)
+	}
+	return ids
+}
+
+type randomIDs int
+
+func (n randomIDs) NewID() string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("clock: failed to read random bytes: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
+
+// Sequence returns a generator of prefix1, prefix2, and so on, for tests
+// that check the IDs they get
+func Sequence(prefix string) IDs {
+	return &sequence{prefix: prefix}
+}
+
+type sequence struct {
+	prefix string
+	n      atomic.Uint64
+}
+
+func (s *sequence) NewID() string {
+	return fmt.Sprintf("%s%d", s.prefix, s.n.Add(1))
+}
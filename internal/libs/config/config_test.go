@@ -2,7 +2,9 @@ package config
 
 import (
 	"os"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestLoad(t *testing.T) {
@@ -43,3 +45,377 @@ func TestLoadWithEnv(t *testing.T) {
 		t.Errorf("expected LogLevel=debug, got %s", cfg.LogLevel)
 	}
 }
+
+func TestLoadStorage(t *testing.T) {
+	t.Setenv("WAL_DISABLED", "true")
+	t.Setenv("WAL_SYNC_IMMEDIATE", "false")
+	t.Setenv("WAL_COMPACTION_GARBAGE_RATIO", "0.4")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+
+	if cfg.Storage.Backend != "file" {
+		t.Errorf("expected WAL_DISABLED to select the file backend, got %s", cfg.Storage.Backend)
+	}
+	if cfg.Storage.WALSyncImmediate || !cfg.Storage.WALCompaction {
+		t.Errorf("unexpected WAL flags: %+v", cfg.Storage)
+	}
+	if cfg.Storage.WALGarbageRatio != 0.4 {
+		t.Errorf("expected garbage ratio 0.4, got %v", cfg.Storage.WALGarbageRatio)
+	}
+
+	t.Setenv("WAL_COMPACTION_GARBAGE_RATIO", "2")
+	if _, err := Load(); err == nil {
+		t.Error("expected error for out-of-range garbage ratio")
+	}
+
+	t.Setenv("WAL_COMPACTION_GARBAGE_RATIO", "")
+	t.Setenv("WAL_NODE_ID", "12")
+	if cfg, err := Load(); err != nil || cfg.Storage.WALNodeID != 12 {
+		t.Errorf("expected node ID 12, got %v", err)
+	}
+	for _, v := range []string{"0", "65536", "x"} {
+		t.Setenv("WAL_NODE_ID", v)
+		if _, err := Load(); err == nil {
+			t.Errorf("expected error for WAL_NODE_ID %q", v)
+		}
+	}
+
+	t.Setenv("WAL_NODE_ID", "")
+	t.Setenv("WAL_STAGING_WINDOW", "200ms")
+	if cfg, err := Load(); err != nil || cfg.Storage.WALStagingWindow != 200*time.Millisecond {
+		t.Errorf("expected a 200ms staging window, got %v", err)
+	}
+	t.Setenv("WAL_STAGING_WINDOW", "-1s")
+	if _, err := Load(); err == nil {
+		t.Error("expected error for a negative WAL_STAGING_WINDOW")
+	}
+
+	t.Setenv("WAL_STAGING_WINDOW", "")
+	if cfg, err := Load(); err != nil || cfg.Storage.WALAsyncApply {
+		t.Errorf("expected writes applied inline by default, got %v", err)
+	}
+	t.Setenv("WAL_ASYNC_APPLY", "true")
+	if cfg, err := Load(); err != nil || !cfg.Storage.WALAsyncApply {
+		t.Errorf("expected WAL_ASYNC_APPLY to apply writes in the background, got %v", err)
+	}
+
+	t.Setenv("WAL_ASYNC_APPLY", "")
+	if cfg, err := Load(); err != nil || cfg.Storage.WALDedupWindow != 10*time.Minute {
+		t.Errorf("expected a 10m dedup window by default, got %v", err)
+	}
+	t.Setenv("WAL_DEDUP_WINDOW", "-1m")
+	if _, err := Load(); err == nil {
+		t.Error("expected error for a negative WAL_DEDUP_WINDOW")
+	}
+
+	t.Setenv("WAL_DEDUP_WINDOW", "")
+	if cfg, err := Load(); err != nil || cfg.Storage.WALMaxSegmentAge != 24*time.Hour {
+		t.Errorf("expected a 24h max segment age by default, got %v", err)
+	}
+	t.Setenv("WAL_MAX_SEGMENT_AGE", "-1h")
+	if _, err := Load(); err == nil {
+		t.Error("expected error for a negative WAL_MAX_SEGMENT_AGE")
+	}
+
+	t.Setenv("WAL_MAX_SEGMENT_AGE", "")
+	t.Setenv("WAL_GC_INTERVAL", "0")
+	if cfg, err := Load(); err != nil || cfg.Storage.WALGCInterval != 0 || cfg.Storage.WALGCGrace != 24*time.Hour {
+		t.Errorf("expected WAL GC off with the default grace, got %v", err)
+	}
+	t.Setenv("WAL_GC_GRACE", "0")
+	if _, err := Load(); err == nil {
+		t.Error("expected error for a zero WAL_GC_GRACE")
+	}
+
+	t.Setenv("WAL_GC_GRACE", "")
+	t.Setenv("WAL_SYNC_METHOD", "FDATASYNC")
+	if cfg, err := Load(); err != nil || cfg.Storage.WALSyncMethod != "fdatasync" {
+		t.Errorf("expected WAL_SYNC_METHOD fdatasync, got %v", err)
+	}
+	t.Setenv("WAL_SYNC_METHOD", "fullfsync")
+	if _, err := Load(); err == nil {
+		t.Error("expected error for an unknown WAL_SYNC_METHOD")
+	}
+}
+
+func TestLoadSlowOpThreshold(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if cfg.SlowOpThreshold != 500*time.Millisecond {
+		t.Errorf("expected default threshold 500ms, got %v", cfg.SlowOpThreshold)
+	}
+
+	t.Setenv("SLOW_OP_THRESHOLD", "2s")
+	if cfg, _ = Load(); cfg.SlowOpThreshold != 2*time.Second {
+		t.Errorf("expected threshold 2s, got %v", cfg.SlowOpThreshold)
+	}
+
+	t.Setenv("SLOW_OP_THRESHOLD", "fast")
+	if _, err := Load(); err == nil {
+		t.Error("expected error for invalid SLOW_OP_THRESHOLD")
+	}
+}
+
+func TestLoadDuplicates(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if cfg.DuplicatesInterval != 24*time.Hour || cfg.DuplicatesThreshold != 0.95 {
+		t.Errorf("unexpected defaults %v, %v", cfg.DuplicatesInterval, cfg.DuplicatesThreshold)
+	}
+
+	t.Setenv("DUPLICATES_INTERVAL", "0")
+	t.Setenv("DUPLICATES_THRESHOLD", "0.9")
+	if cfg, _ = Load(); cfg.DuplicatesInterval != 0 || cfg.DuplicatesThreshold != 0.9 {
+		t.Errorf("expected the report disabled at 0.9, got %v, %v", cfg.DuplicatesInterval, cfg.DuplicatesThreshold)
+	}
+
+	t.Setenv("DUPLICATES_THRESHOLD", "1.5")
+	if _, err := Load(); err == nil {
+		t.Error("expected error for out-of-range DUPLICATES_THRESHOLD")
+	}
+}
+
+func TestLoadResultCacheTTL(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if cfg.SearchCacheTTL != 0 || cfg.RunCacheTTL != 0 {
+		t.Errorf("expected caches off by default, got %v/%v", cfg.SearchCacheTTL, cfg.RunCacheTTL)
+	}
+
+	t.Setenv("SEARCH_CACHE_TTL", "2s")
+	if cfg, _ = Load(); cfg.SearchCacheTTL != 2*time.Second {
+		t.Errorf("expected search TTL 2s, got %v", cfg.SearchCacheTTL)
+	}
+
+	if cfg.SearchCacheSize != 1024 {
+		t.Errorf("expected default cache size 1024, got %d", cfg.SearchCacheSize)
+	}
+	t.Setenv("SEARCH_CACHE_SIZE", "0")
+	if _, err := Load(); err == nil {
+		t.Error("expected error for zero SEARCH_CACHE_SIZE")
+	}
+	t.Setenv("SEARCH_CACHE_SIZE", "64")
+
+	t.Setenv("RUN_CACHE_TTL", "-1s")
+	if _, err := Load(); err == nil {
+		t.Error("expected error for negative RUN_CACHE_TTL")
+	}
+}
+
+func TestLoadWarmup(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if !cfg.Warmup || len(cfg.WarmupQueries) != 0 {
+		t.Errorf("expected warmup on without canaries by default, got %v %v", cfg.Warmup, cfg.WarmupQueries)
+	}
+
+	t.Setenv("WARMUP_QUERIES", `["quarterly planning", "on-call, runbook"]`)
+	if cfg, _ = Load(); len(cfg.WarmupQueries) != 2 || cfg.WarmupQueries[1] != "on-call, runbook" {
+		t.Errorf("expected 2 canary queries, got %q", cfg.WarmupQueries)
+	}
+
+	t.Setenv("WARMUP_QUERIES", "quarterly planning")
+	if _, err := Load(); err == nil {
+		t.Error("expected error for WARMUP_QUERIES that isn't a JSON array")
+	}
+}
+
+func TestLoadOutbound(t *testing.T) {
+	t.Setenv("OUTBOUND_ALLOW", "10.1.0.0/16, 192.168.5.4,")
+	t.Setenv("OUTBOUND_DENY", "203.0.113.0/24")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if len(cfg.Outbound.Allow) != 2 || cfg.Outbound.Allow[1] != "192.168.5.4" || len(cfg.Outbound.Deny) != 1 {
+		t.Errorf("unexpected outbound config: %+v", cfg.Outbound)
+	}
+}
+
+func TestLoadFeatureFlags(t *testing.T) {
+	t.Setenv("FEATURE_FLAGS", "reranker=false")
+	cfg, err := Load()
+	if err != nil || len(cfg.FeatureFlags) != 1 || cfg.FeatureFlags["reranker"] {
+		t.Errorf("expected reranker=false, got %v %v", cfg.FeatureFlags, err)
+	}
+	t.Setenv("FEATURE_FLAGS", "reranker")
+	if _, err := Load(); err == nil {
+		t.Error("expected error for a flag without a value")
+	}
+}
+
+func TestLoadChaos(t *testing.T) {
+	t.Setenv("CHAOS_RULES", "/search:error:5:503")
+	if _, err := Load(); err == nil {
+		t.Error("expected CHAOS_RULES to be refused in production")
+	}
+
+	t.Setenv("ENVIRONMENT", "staging")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Chaos) != 1 || cfg.Chaos[0].Status != 503 {
+		t.Errorf("unexpected chaos rules %v", cfg.Chaos)
+	}
+	t.Setenv("CHAOS_RULES", "/search:error:5:404")
+	if _, err := Load(); err == nil {
+		t.Error("expected error for a non-5xx status")
+	}
+}
+
+func TestLoadResetKeys(t *testing.T) {
+	t.Setenv("RESET_KEYS", "ak_0123456789ab")
+	if _, err := Load(); err == nil {
+		t.Error("expected RESET_KEYS to be refused in production")
+	}
+
+	t.Setenv("ENVIRONMENT", "ci")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.ResetKeys) != 1 || cfg.ResetKeys[0] != "ak_0123456789ab" {
+		t.Errorf("unexpected reset keys %v", cfg.ResetKeys)
+	}
+
+	// Usage keys are truncated hashes, too short to authorize with
+	for _, v := range []string{"key_0123456789ab", "sha256:0123456789ab"} {
+		t.Setenv("RESET_KEYS", v)
+		if _, err := Load(); err == nil {
+			t.Errorf("expected RESET_KEYS %q to be refused", v)
+		}
+	}
+	t.Setenv("RESET_KEYS", "sha256:"+strings.Repeat("ab", 32)+",cert_ci,*")
+	if _, err := Load(); err != nil {
+		t.Errorf("expected a full hash, a principal, and * accepted, got %v", err)
+	}
+}
+
+func TestLoadAPIKeys(t *testing.T) {
+	t.Setenv("API_KEYS_REQUIRED", "true")
+	if _, err := Load(); err == nil {
+		t.Error("expected API_KEYS_REQUIRED without KEY_ADMIN_KEYS to be refused")
+	}
+
+	t.Setenv("KEY_ADMIN_KEYS", "ak_0123456789ab")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.APIKeysRequired || len(cfg.KeyAdminKeys) != 1 || cfg.KeyAdminKeys[0] != "ak_0123456789ab" {
+		t.Errorf("unexpected API key config %v %v", cfg.APIKeysRequired, cfg.KeyAdminKeys)
+	}
+
+	// Shards authenticate each other with their secret instead of a key
+	t.Setenv("SHARD_ID", "a")
+	if _, err := Load(); err == nil {
+		t.Error("expected SHARD_ID without SHARD_SECRET to be refused")
+	}
+	t.Setenv("SHARD_SECRET", "s3cret")
+	if _, err := Load(); err != nil {
+		t.Errorf("expected API_KEYS_REQUIRED with SHARD_ID and SHARD_SECRET, got %v", err)
+	}
+}
+
+func TestLoadAccess(t *testing.T) {
+	t.Setenv("IP_ALLOWLIST", "/admin/*=10.0.0.0/8|192.168.1.5,*=10.0.0.0/8")
+	t.Setenv("TLS_CERT_FILE", "/etc/selfstack/tls.crt")
+	t.Setenv("TLS_KEY_FILE", "/etc/selfstack/tls.key")
+	t.Setenv("TLS_CLIENT_CA_FILE", "/etc/selfstack/clients.pem")
+	t.Setenv("TLS_CLIENT_PRINCIPALS", "ingest-worker.internal=ingest")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.IPAllowlist) != 2 || cfg.IPAllowlist[0].String() != "/admin/*=10.0.0.0/8|192.168.1.5/32" {
+		t.Errorf("unexpected IP allowlist %v", cfg.IPAllowlist)
+	}
+	if cfg.TLS.ClientAuth != "require" || cfg.TLS.Principals["ingest-worker.internal"] != "ingest" {
+		t.Errorf("unexpected TLS config %+v", cfg.TLS)
+	}
+
+	t.Setenv("SHARD_ID", "a")
+	t.Setenv("SHARD_SECRET", "s3cret")
+	if _, err := Load(); err == nil {
+		t.Error("expected TLS_CLIENT_AUTH=require to be refused with SHARD_ID")
+	}
+	t.Setenv("TLS_CLIENT_AUTH", "optional")
+	if _, err := Load(); err != nil {
+		t.Errorf("expected optional client certificates with SHARD_ID, got %v", err)
+	}
+
+	for key, value := range map[string]string{
+		"IP_ALLOWLIST":       "/admin/*=10.0.0.0/33",
+		"TLS_KEY_FILE":       "",
+		"TLS_CLIENT_AUTH":    "sometimes",
+		"TLS_CLIENT_CA_FILE": "",
+	} {
+		t.Run(key, func(t *testing.T) {
+			t.Setenv(key, value)
+			if _, err := Load(); err == nil {
+				t.Errorf("expected %s=%q to be refused", key, value)
+			}
+		})
+	}
+}
+
+func TestLoadLog(t *testing.T) {
+	t.Setenv("LOG_LEVELS", "wal=debug,http=warn")
+	t.Setenv("LOG_FILE", "/var/log/selfstack/api.log")
+	t.Setenv("LOG_FILE_MAX_AGE", "24h")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Log.Modules) != 2 || cfg.Log.Modules["wal"] != "debug" || cfg.Log.Modules["http"] != "warn" {
+		t.Errorf("unexpected module levels %v", cfg.Log.Modules)
+	}
+	if !cfg.Log.Stderr || cfg.Log.FileMaxSizeMB != 100 || cfg.Log.FileMaxAge != 24*time.Hour || cfg.Log.FileMaxBackups != 10 {
+		t.Errorf("unexpected log config %+v", cfg.Log)
+	}
+
+	t.Setenv("LOG_LEVELS", "wal=loud")
+	if _, err := Load(); err == nil {
+		t.Error("expected error for an unknown level")
+	}
+	t.Setenv("LOG_LEVELS", "")
+	t.Setenv("LOG_FILE", "")
+	t.Setenv("LOG_STDERR", "false")
+	if _, err := Load(); err == nil {
+		t.Error("expected error when no sink is enabled")
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := &Config{
+		DatabaseURL: "postgres://selfstack:secret@db:5432/selfstack?sslmode=disable",
+		Storage:     StorageConfig{ManifestURL: "host=db user=selfstack password=secret dbname=selfstack"},
+		Hooks:       HooksConfig{PreIngestWebhook: "https://hooks.example.com/pre"},
+	}
+
+	r := cfg.Redacted()
+	if r.DatabaseURL != "postgres://selfstack:xxxxx@db:5432/selfstack?sslmode=disable" {
+		t.Errorf("DatabaseURL = %s", r.DatabaseURL)
+	}
+	if r.Storage.ManifestURL != "host=db user=selfstack password=xxxxx dbname=selfstack" {
+		t.Errorf("ManifestURL = %s", r.Storage.ManifestURL)
+	}
+	if r.Hooks.PreIngestWebhook != cfg.Hooks.PreIngestWebhook {
+		t.Errorf("URL without a password changed: %s", r.Hooks.PreIngestWebhook)
+	}
+	if cfg.DatabaseURL == r.DatabaseURL || cfg.Storage.ManifestURL == r.Storage.ManifestURL {
+		t.Error("Redacted modified the original")
+	}
+}
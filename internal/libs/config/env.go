@@ -0,0 +1,143 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/dsjohal14/selfstack/internal/libs/secrets"
+)
+
+// FileVar names the file of KEY=VALUE lines read for variables the
+// environment leaves unset
+const FileVar = "CONFIG_FILE"
+
+// FileSuffix turns a secret setting's variable into the one naming a file
+// to read it from instead, e.g. DATABASE_URL_FILE=/run/secrets/db
+const FileSuffix = "_FILE"
+
+// env looks up variables in the environment, then in the config file
+type env struct {
+	file    map[string]string
+	secrets map[string]secret // Secret settings read from a file or resolved
+}
+
+// secret is the value of a secret setting that isn't its variable's
+type secret struct {
+	value  string
+	source string
+}
+
+// readEnv reads the config file named by CONFIG_FILE, if set, and the
+// files named by the _FILE variants of secret settings
+func readEnv() (env, error) {
+	e := env{secrets: make(map[string]secret)}
+	if path := os.Getenv(FileVar); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return env{}, fmt.Errorf("failed to read %s: %w", FileVar, err)
+		}
+		if e.file, err = parseEnvFile(data); err != nil {
+			return env{}, fmt.Errorf("invalid %s %s: %w", FileVar, path, err)
+		}
+	}
+
+	for _, opt := range Options() {
+		if opt.Secret == "" {
+			continue
+		}
+		fileVar := opt.Env + FileSuffix
+		path := e.get(fileVar)
+		if path == "" {
+			continue
+		}
+		if e.get(opt.Env) != "" {
+			return env{}, fmt.Errorf("both %s and %s are set", opt.Env, fileVar)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return env{}, fmt.Errorf("failed to read %s: %w", fileVar, err)
+		}
+		// Files written by editors and secret stores tend to end in a newline
+		e.secrets[opt.Env] = secret{value: strings.TrimRight(string(data), "\r\n"), source: fileVar}
+	}
+	return e, nil
+}
+
+// resolveSecrets replaces secret settings that reference a secret manager,
+// like vault:secret/data/selfstack#db_url, with the secret
+func (e env) resolveSecrets(ctx context.Context) error {
+	for _, opt := range Options() {
+		if opt.Secret == "" {
+			continue
+		}
+		value, source := e.lookup(opt.Env)
+		if !secrets.IsReference(value) {
+			continue
+		}
+		resolved, err := secrets.Resolve(ctx, value)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", opt.Env, err)
+		}
+		e.secrets[opt.Env] = secret{value: resolved, source: source}
+	}
+	return nil
+}
+
+// parseEnvFile reads KEY=VALUE lines. Blank lines and lines starting with #
+// are skipped, "export " prefixes are allowed, and values may be quoted.
+func parseEnvFile(data []byte) (map[string]string, error) {
+	vars := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("line %d: want KEY=VALUE", n)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			if value[0] == '"' {
+				unquoted, err := strconv.Unquote(value)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %w", n, err)
+				}
+				value = unquoted
+			} else {
+				value = value[1 : len(value)-1]
+			}
+		}
+		vars[key] = value
+	}
+	return vars, scanner.Err()
+}
+
+// get returns the variable's value; an empty environment variable counts
+// as unset
+func (e env) get(key string) string {
+	v, _ := e.lookup(key)
+	return v
+}
+
+// lookup returns the variable's value and where it's from: "env", "file",
+// the _FILE variable it was read through, or "" when unset
+func (e env) lookup(key string) (string, string) {
+	if s, ok := e.secrets[key]; ok {
+		return s.value, s.source
+	}
+	if v := os.Getenv(key); v != "" {
+		return v, "env"
+	}
+	if v, ok := e.file[key]; ok && v != "" {
+		return v, "file"
+	}
+	return "", ""
+}
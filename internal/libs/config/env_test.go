@@ -0,0 +1,85 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dsjohal14/selfstack/internal/libs/secrets"
+)
+
+func TestSecretFile(t *testing.T) {
+	unsetOptions(t)
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "database_url")
+	if err := os.WriteFile(dbFile, []byte("postgres://selfstack:secret@db/selfstack\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// A _FILE variant can be set in the config file too
+	configFile := filepath.Join(dir, "selfstack.env")
+	if err := os.WriteFile(configFile, []byte("DATABASE_URL_FILE="+dbFile+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(FileVar, configFile)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DatabaseURL != "postgres://selfstack:secret@db/selfstack" || cfg.Storage.ManifestURL != cfg.DatabaseURL {
+		t.Errorf("DatabaseURL = %q, ManifestURL = %q", cfg.DatabaseURL, cfg.Storage.ManifestURL)
+	}
+
+	settings, err := Settings(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range settings {
+		if s.Env == "DATABASE_URL" {
+			if s.Source != "DATABASE_URL_FILE" || s.Value != "postgres://selfstack:xxxxx@db/selfstack" {
+				t.Errorf("setting = %+v", s)
+			}
+		}
+	}
+
+	t.Setenv("DATABASE_URL", "postgres://other@db/selfstack")
+	if _, err := Load(); err == nil {
+		t.Error("expected error when both DATABASE_URL and DATABASE_URL_FILE are set")
+	}
+	t.Setenv("DATABASE_URL", "")
+	t.Setenv("DATABASE_URL_FILE", filepath.Join(dir, "missing"))
+	if _, err := Load(); err == nil {
+		t.Error("expected error for a missing secret file")
+	}
+}
+
+func TestSecretReference(t *testing.T) {
+	unsetOptions(t)
+	secrets.Register("test", secrets.ResolverFunc(func(_ context.Context, path, key string) (string, error) {
+		return "https://hooks.example.com/" + path + "?token=" + key, nil
+	}))
+	defer secrets.Register("test", nil)
+	t.Setenv("INGEST_POST_WEBHOOK_URL", "test:notify#t0ken")
+	t.Setenv("INGEST_PRE_WEBHOOK_URL", "https://hooks.example.com/enrich") // Not a reference
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Hooks.PostIngestWebhook != "https://hooks.example.com/notify?token=t0ken" {
+		t.Errorf("PostIngestWebhook = %q", cfg.Hooks.PostIngestWebhook)
+	}
+	if cfg.Hooks.PreIngestWebhook != "https://hooks.example.com/enrich" {
+		t.Errorf("PreIngestWebhook = %q", cfg.Hooks.PreIngestWebhook)
+	}
+
+	// Only secret settings are resolved
+	t.Setenv("LOG_SYSLOG_TAG", "test:tag")
+	if cfg, err = Load(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Log.SyslogTag != "test:tag" {
+		t.Errorf("SyslogTag = %q", cfg.Log.SyslogTag)
+	}
+}
@@ -0,0 +1,219 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Option describes a setting read from a variable
+type Option struct {
+	Env     string `json:"env"`
+	Field   string `json:"field,omitempty"` // Path of its Config field, e.g. Storage.DataDir; empty if it has none
+	Type    string `json:"type"`
+	Default string `json:"default,omitempty"`
+	Doc     string `json:"doc"`
+	Secret  string `json:"secret,omitempty"` // "url" or "true"; see Config
+}
+
+// fileOption is the variable naming the config file, which has no field
+var fileOption = Option{Env: FileVar, Type: "string", Doc: "File of KEY=VALUE lines read for variables the environment leaves unset"}
+
+// aliasOptions are variables that set another setting's field
+var aliasOptions = []Option{
+	{Env: "WAL_DISABLED", Type: "bool", Default: "false", Doc: "true is the same as STORAGE_BACKEND=file"},
+}
+
+// Options returns every setting: the config file, then the Config fields
+// in order, then aliases
+func Options() []Option {
+	opts := []Option{fileOption}
+	walkFields(reflect.TypeOf(Config{}), "", func(path string, f reflect.StructField) {
+		if env := f.Tag.Get("env"); env != "" {
+			opts = append(opts, Option{
+				Env:     env,
+				Field:   path,
+				Type:    typeName(f),
+				Default: f.Tag.Get("default"),
+				Doc:     f.Tag.Get("doc"),
+				Secret:  f.Tag.Get("secret"),
+			})
+		}
+	})
+	return append(opts, aliasOptions...)
+}
+
+// Reference writes a Markdown reference of every setting
+func Reference(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("# Configuration Reference\n\n")
+	b.WriteString("<!-- Generated by `selfstack config reference` from the Config struct tags; do not edit. -->\n\n")
+	b.WriteString("Settings are read from environment variables. Variables the environment leaves unset (or empty) are read from the file `CONFIG_FILE` names, which holds `KEY=VALUE` lines. `selfstack config show` prints the values in effect.\n\n")
+	fmt.Fprintf(&b, "Settings marked (secret) can instead be read from a file named by the variable with a `%s` suffix, e.g. `DATABASE_URL_FILE=/run/secrets/database_url`, or set to a reference to a secret manager: `vault:PATH#KEY` reads Vault's KV engine (`VAULT_ADDR`, `VAULT_TOKEN`), e.g. `vault:secret/data/selfstack#database_url`, and `awssm:NAME#KEY` reads AWS Secrets Manager (`AWS_REGION` and `AWS_ACCESS_KEY_ID`/`AWS_SECRET_ACCESS_KEY`). `#KEY` picks a field of a secret with several.\n\n", FileSuffix)
+	b.WriteString("| Variable | Type | Default | Description |\n")
+	b.WriteString("|----------|------|---------|-------------|\n")
+	for _, opt := range Options() {
+		def := "-"
+		if opt.Default != "" {
+			def = "`" + opt.Default + "`"
+		}
+		doc := strings.ReplaceAll(opt.Doc, "|", `\|`)
+		if opt.Secret != "" {
+			doc += " (secret)"
+		}
+		fmt.Fprintf(&b, "| `%s` | %s | %s | %s |\n", opt.Env, opt.Type, def, doc)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Setting is the value of a setting and where it comes from
+type Setting struct {
+	Env    string `json:"env"`
+	Value  string `json:"value"`
+	Source string `json:"source"` // env, file, default, or the _FILE variable read, e.g. DATABASE_URL_FILE
+}
+
+// Settings returns the value of every setting with secrets redacted. Without
+// a config, values are shown as set; with one (see Load), as resolved:
+// defaults applied and values parsed and normalized.
+func Settings(cfg *Config) ([]Setting, error) {
+	e, err := readEnv()
+	if err != nil {
+		return nil, err
+	}
+	var settings []Setting
+	for _, opt := range Options() {
+		value, source := e.lookup(opt.Env)
+		if source == "" {
+			value, source = opt.Default, "default"
+		}
+		if cfg != nil && opt.Field != "" {
+			value = formatValue(fieldByPath(reflect.ValueOf(cfg).Elem(), opt.Field), opt.Type)
+		}
+		settings = append(settings, Setting{Env: opt.Env, Value: redact(opt.Secret, value), Source: source})
+	}
+	return settings, nil
+}
+
+// Redacted returns a copy of c with its secret settings masked, for config
+// snapshots like the one in diagnostic bundles
+func (c *Config) Redacted() *Config {
+	r := *c
+	v := reflect.ValueOf(&r).Elem()
+	walkFields(v.Type(), "", func(path string, f reflect.StructField) {
+		if secret := f.Tag.Get("secret"); secret != "" {
+			field := fieldByPath(v, path)
+			field.SetString(redact(secret, field.String()))
+		}
+	})
+	return &r
+}
+
+// walkFields calls fn with the path and field of every setting in t,
+// descending into nested config structs
+func walkFields(t reflect.Type, prefix string, fn func(path string, f reflect.StructField)) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		path := prefix + f.Name
+		if f.Type.Kind() == reflect.Struct && f.Type != reflect.TypeOf(time.Duration(0)) {
+			walkFields(f.Type, path+".", fn)
+			continue
+		}
+		fn(path, f)
+	}
+}
+
+func fieldByPath(v reflect.Value, path string) reflect.Value {
+	for _, name := range strings.Split(path, ".") {
+		v = v.FieldByName(name)
+	}
+	return v
+}
+
+// typeName describes a field's type in the reference; a format tag
+// overrides it
+func typeName(f reflect.StructField) string {
+	if format := f.Tag.Get("format"); format != "" {
+		return format
+	}
+	t := f.Type
+	switch {
+	case t == reflect.TypeOf(time.Duration(0)):
+		return "duration"
+	case t.Kind() == reflect.Slice:
+		return "list"
+	case t.Kind() == reflect.Map:
+		return "map"
+	case t.Kind() == reflect.Float64:
+		return "float"
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return "int"
+	}
+	return t.Kind().String()
+}
+
+// formatValue writes a field's value the way its variable is written
+func formatValue(v reflect.Value, typ string) string {
+	switch x := v.Interface().(type) {
+	case time.Duration:
+		return x.String()
+	case []string:
+		if len(x) == 0 {
+			return ""
+		}
+		if typ == "json" {
+			data, _ := json.Marshal(x)
+			return string(data)
+		}
+		return strings.Join(x, ",")
+	case map[string]bool, map[string]string:
+		var pairs []string
+		iter := v.MapRange()
+		for iter.Next() {
+			pairs = append(pairs, fmt.Sprintf("%s=%v", iter.Key(), iter.Value()))
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, ",")
+	case float64:
+		return strconv.FormatFloat(x, 'g', -1, 64)
+	}
+	if v.Kind() == reflect.Slice {
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = fmt.Sprint(v.Index(i).Interface())
+		}
+		return strings.Join(items, ",")
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// dsnPassword matches the password of a key=value Postgres connection string
+var dsnPassword = regexp.MustCompile(`(password\s*=\s*)('[^']*'|\S+)`)
+
+// redact masks a secret value: the password of a URL or key=value
+// connection string for "url", all of it for "true"
+func redact(secret, s string) string {
+	switch {
+	case secret == "" || s == "":
+		return s
+	case secret == "url":
+		return redactURL(s)
+	}
+	return "xxxxx"
+}
+
+// redactURL masks the password of a URL or key=value connection string
+func redactURL(s string) string {
+	if u, err := url.Parse(s); err == nil && u.Scheme != "" {
+		return u.Redacted()
+	}
+	return dsnPassword.ReplaceAllString(s, "${1}xxxxx")
+}
@@ -0,0 +1,172 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// unsetOptions clears every setting's variable for the test
+func unsetOptions(t *testing.T) {
+	t.Helper()
+	for _, opt := range Options() {
+		t.Setenv(opt.Env, "")
+		if opt.Secret != "" {
+			t.Setenv(opt.Env+FileSuffix, "")
+		}
+	}
+}
+
+// TestOptionDefaults keeps the default tags in line with what Load does
+func TestOptionDefaults(t *testing.T) {
+	unsetOptions(t)
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, opt := range Options() {
+		if opt.Field == "" {
+			continue
+		}
+		field := fieldByPath(reflect.ValueOf(cfg).Elem(), opt.Field)
+		want := opt.Default
+		switch {
+		case want == "":
+			want = formatValue(reflect.Zero(field.Type()), opt.Type)
+		case opt.Type == "duration":
+			d, err := time.ParseDuration(want)
+			if err != nil {
+				t.Errorf("%s: invalid default %q", opt.Env, want)
+			}
+			want = d.String()
+		case opt.Type == "float":
+			f, err := strconv.ParseFloat(want, 64)
+			if err != nil {
+				t.Errorf("%s: invalid default %q", opt.Env, want)
+			}
+			want = strconv.FormatFloat(f, 'g', -1, 64)
+		}
+		if got := formatValue(field, opt.Type); got != want {
+			t.Errorf("%s: Load defaults to %q, but its tag says %q", opt.Env, got, opt.Default)
+		}
+		if opt.Doc == "" {
+			t.Errorf("%s has no doc tag", opt.Env)
+		}
+	}
+}
+
+// TestOptionsCoverLoad fails when Load reads a variable without a tagged field
+func TestOptionsCoverLoad(t *testing.T) {
+	known := make(map[string]bool)
+	for _, opt := range Options() {
+		if known[opt.Env] {
+			t.Errorf("%s is listed twice", opt.Env)
+		}
+		known[opt.Env] = true
+	}
+
+	src, err := os.ReadFile("config.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := regexp.MustCompile(`e\.get\w*\("([A-Z0-9_]+)"`).FindAllSubmatch(src, -1)
+	if len(read) < 40 {
+		t.Fatalf("found only %d variables read in config.go; has Load changed?", len(read))
+	}
+	for _, m := range read {
+		if !known[string(m[1])] {
+			t.Errorf("Load reads %s, which has no env tag", m[1])
+		}
+	}
+}
+
+// TestReferenceUpToDate fails when docs/config.md wasn't regenerated
+func TestReferenceUpToDate(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Reference(&buf); err != nil {
+		t.Fatal(err)
+	}
+	docs, err := os.ReadFile(filepath.Join("..", "..", "..", "docs", "config.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(docs, buf.Bytes()) {
+		t.Error("docs/config.md is out of date; run make config-docs")
+	}
+}
+
+func TestSettings(t *testing.T) {
+	unsetOptions(t)
+	file := filepath.Join(t.TempDir(), "selfstack.env")
+	data := "# Staging\nexport API_PORT=9000\nDATA_DIR=\"/srv/selfstack\"\nSTORAGE_BACKEND='WAL'\n"
+	if err := os.WriteFile(file, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(FileVar, file)
+	t.Setenv("API_PORT", "9100") // The environment wins over the file
+	t.Setenv("DATABASE_URL", "postgres://selfstack:secret@db/selfstack")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.APIPort != "9100" || cfg.Storage.DataDir != "/srv/selfstack" {
+		t.Errorf("APIPort = %s, DataDir = %s", cfg.APIPort, cfg.Storage.DataDir)
+	}
+
+	index := func(settings []Setting) map[string]Setting {
+		m := make(map[string]Setting)
+		for _, s := range settings {
+			m[s.Env] = s
+		}
+		return m
+	}
+	raw, err := Settings(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolved, err := Settings(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		settings map[string]Setting
+		want     Setting
+	}{
+		{index(raw), Setting{Env: "API_PORT", Value: "9100", Source: "env"}},
+		{index(raw), Setting{Env: "DATA_DIR", Value: "/srv/selfstack", Source: "file"}},
+		{index(raw), Setting{Env: "STORAGE_BACKEND", Value: "WAL", Source: "file"}},
+		{index(raw), Setting{Env: "DATABASE_URL", Value: "postgres://selfstack:xxxxx@db/selfstack", Source: "env"}},
+		{index(raw), Setting{Env: "REFRESH_INTERVAL", Value: "1h", Source: "default"}},
+		{index(resolved), Setting{Env: "STORAGE_BACKEND", Value: "wal", Source: "file"}},
+		{index(resolved), Setting{Env: "REFRESH_INTERVAL", Value: "1h0m0s", Source: "default"}},
+		{index(resolved), Setting{Env: "DATABASE_URL", Value: "postgres://selfstack:xxxxx@db/selfstack", Source: "env"}},
+	}
+	for _, tt := range tests {
+		if got := tt.settings[tt.want.Env]; got != tt.want {
+			t.Errorf("got %+v, want %+v", got, tt.want)
+		}
+	}
+}
+
+func TestParseEnvFile(t *testing.T) {
+	vars, err := parseEnvFile([]byte("A=1\n\n# comment\nexport B = two words \nC=\"quoted\\n\"\nD='single'\nE=\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"A": "1", "B": "two words", "C": "quoted\n", "D": "single", "E": ""}
+	if !reflect.DeepEqual(vars, want) {
+		t.Errorf("vars = %q, want %q", vars, want)
+	}
+
+	if _, err := parseEnvFile([]byte("A=1\nnot a setting\n")); err == nil {
+		t.Error("expected error for a line without =")
+	}
+}
@@ -0,0 +1,219 @@
+// Package diag captures a diagnostic bundle when a panic is recovered: the
+// stacks of every goroutine, the latest log lines, registered state such
+// as the WAL's, and a config snapshot. Bundles are written to the data
+// directory and counted, so /health can flag an instance that panicked.
+package diag
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+)
+
+// BundleDir is the directory under DATA_DIR bundles are written to
+const BundleDir = "diagnostics"
+
+// stateTimeout bounds each state func, which may wait on a lock the
+// panicking goroutine left held
+var stateTimeout = 2 * time.Second
+
+// Bundle describes a captured diagnostic bundle
+type Bundle struct {
+	Path   string    `json:"path,omitempty"` // Empty when it couldn't be written
+	Source string    `json:"source"`         // What panicked, e.g. "http" or "compactor"
+	Panic  string    `json:"panic"`
+	Time   time.Time `json:"time"`
+}
+
+// Default is the collector the API server configures and recovers with
+var Default = New("")
+
+// Collector captures bundles into a directory and remembers the ones
+// captured by this process
+type Collector struct {
+	mu      sync.Mutex
+	dir     string // Empty only counts and logs panics
+	config  any
+	state   map[string]func() any
+	bundles []Bundle
+}
+
+// New creates a collector writing bundles to dir
+func New(dir string) *Collector {
+	return &Collector{dir: dir, state: make(map[string]func() any)}
+}
+
+// SetDir writes bundles to dir
+func (c *Collector) SetDir(dir string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dir = dir
+}
+
+// SetConfig includes snapshot in bundles; secrets must already be redacted
+func (c *Collector) SetConfig(snapshot any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.config = snapshot
+}
+
+// AddState includes what fn returns under name in bundles. fn is called
+// while capturing, so it sees the state at the time of the panic.
+func (c *Collector) AddState(name string, fn func() any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.state[name] = fn
+}
+
+// Bundles returns the bundles captured since the process started, oldest first
+func (c *Collector) Bundles() []Bundle {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Bundle{}, c.bundles...)
+}
+
+// Recover captures a bundle if the calling goroutine is panicking and
+// stops the panic. Defer it directly: defer diag.Default.Recover("worker").
+func (c *Collector) Recover(source string) {
+	if r := recover(); r != nil {
+		c.Report(source, r, debug.Stack())
+	}
+}
+
+// Report captures a bundle for a panic recovered by the caller and logs it
+func (c *Collector) Report(source string, recovered any, stack []byte) Bundle {
+	logger := obs.Logger("diag")
+	b, err := c.Capture(source, recovered, stack)
+	if err != nil {
+		logger.Error().Err(err).Str("source", source).Msg("failed to write diagnostic bundle")
+	}
+	logger.Error().
+		Str("source", source).
+		Str("panic", b.Panic).
+		Str("bundle", b.Path).
+		Bytes("stack", stack).
+		Msg("recovered from panic")
+	return b
+}
+
+// Capture writes a bundle for a recovered panic. The panic is counted even
+// when the bundle can't be written, in which case it has no path.
+func (c *Collector) Capture(source string, recovered any, stack []byte) (Bundle, error) {
+	b := Bundle{Source: source, Panic: fmt.Sprint(recovered), Time: time.Now().UTC()}
+
+	c.mu.Lock()
+	dir, config := c.dir, c.config
+	state := make(map[string]func() any, len(c.state))
+	for name, fn := range c.state {
+		state[name] = fn
+	}
+	c.mu.Unlock()
+
+	var err error
+	if dir != "" {
+		path := filepath.Join(dir, fmt.Sprintf("panic-%s-%s", b.Time.Format("20060102-150405.000"), sanitize(source)))
+		if err = writeBundle(path, b, stack, config, state); err == nil {
+			b.Path = path
+		}
+	}
+
+	c.mu.Lock()
+	c.bundles = append(c.bundles, b)
+	c.mu.Unlock()
+	return b, err
+}
+
+// writeBundle writes the files of a bundle into a new directory at path
+func writeBundle(path string, b Bundle, stack []byte, config any, state map[string]func() any) error {
+	if err := os.MkdirAll(path, 0o700); err != nil {
+		return fmt.Errorf("failed to create bundle directory: %w", err)
+	}
+
+	panicText := fmt.Sprintf("panic: %s\nsource: %s\ntime: %s\n\n%s", b.Panic, b.Source, b.Time.Format(time.RFC3339Nano), stack)
+	files := map[string][]byte{
+		"panic.txt":      []byte(panicText),
+		"goroutines.txt": allStacks(),
+		"logs.jsonl":     []byte(strings.Join(obs.RecentLogs(), "")),
+	}
+
+	snapshot := make(map[string]any, len(state))
+	for name, fn := range state {
+		snapshot[name] = callState(fn)
+	}
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+	files["state.json"] = data
+
+	if config != nil {
+		data, err := json.MarshalIndent(config, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode config: %w", err)
+		}
+		files["config.json"] = data
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(path, name), files[name], 0o600); err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// callState returns what fn returns, or an error string if it panics or
+// doesn't return within stateTimeout
+func callState(fn func() any) any {
+	result := make(chan any, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				result <- fmt.Sprintf("error: state panicked: %v", r)
+			}
+		}()
+		result <- fn()
+	}()
+	select {
+	case v := <-result:
+		return v
+	case <-time.After(stateTimeout):
+		return fmt.Sprintf("error: state not returned within %s", stateTimeout)
+	}
+}
+
+// allStacks returns the stacks of every goroutine
+func allStacks() []byte {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) || len(buf) >= 64<<20 {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// sanitize makes source usable in a directory name
+func sanitize(source string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '-'
+	}, source)
+}
@@ -0,0 +1,110 @@
+package diag
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRecoverCapturesBundle(t *testing.T) {
+	dir := t.TempDir()
+	c := New(dir)
+	c.SetConfig(map[string]string{"data_dir": "/data"})
+	c.AddState("wal", func() any { return map[string]int{"segment_id": 7} })
+
+	func() {
+		defer c.Recover("job:refresh")
+		panic("boom")
+	}()
+
+	bundles := c.Bundles()
+	if len(bundles) != 1 {
+		t.Fatalf("got %d bundles, want 1", len(bundles))
+	}
+	b := bundles[0]
+	if b.Source != "job:refresh" || b.Panic != "boom" {
+		t.Fatalf("bundle = %+v", b)
+	}
+	if filepath.Dir(b.Path) != dir || !strings.HasSuffix(b.Path, "-job-refresh") {
+		t.Fatalf("bundle path = %s", b.Path)
+	}
+
+	panicText, err := os.ReadFile(filepath.Join(b.Path, "panic.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(panicText), "panic: boom") || !strings.Contains(string(panicText), "TestRecoverCapturesBundle") {
+		t.Fatalf("panic.txt lacks the panic or its stack:\n%s", panicText)
+	}
+	goroutines, err := os.ReadFile(filepath.Join(b.Path, "goroutines.txt"))
+	if err != nil || !strings.Contains(string(goroutines), "goroutine ") {
+		t.Fatalf("goroutines.txt = %q, %v", goroutines, err)
+	}
+
+	var state map[string]map[string]int
+	readJSON(t, filepath.Join(b.Path, "state.json"), &state)
+	if state["wal"]["segment_id"] != 7 {
+		t.Fatalf("state = %v", state)
+	}
+	var config map[string]string
+	readJSON(t, filepath.Join(b.Path, "config.json"), &config)
+	if config["data_dir"] != "/data" {
+		t.Fatalf("config = %v", config)
+	}
+	if _, err := os.Stat(filepath.Join(b.Path, "logs.jsonl")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCaptureWithoutDir(t *testing.T) {
+	c := New("")
+	b, err := c.Capture("http", "boom", nil)
+	if err != nil || b.Path != "" {
+		t.Fatalf("Capture = %+v, %v; want a bundle without a path", b, err)
+	}
+	if len(c.Bundles()) != 1 {
+		t.Fatal("panic without a bundle dir was not counted")
+	}
+}
+
+func TestCaptureStateHeldLock(t *testing.T) {
+	defer func(d time.Duration) { stateTimeout = d }(stateTimeout)
+	stateTimeout = 50 * time.Millisecond
+
+	var mu sync.Mutex
+	mu.Lock() // Left held by the panicking goroutine
+	defer mu.Unlock()
+
+	c := New(t.TempDir())
+	c.AddState("stuck", func() any {
+		mu.Lock()
+		defer mu.Unlock()
+		return "unreachable"
+	})
+	c.AddState("broken", func() any { panic("nope") })
+
+	b, err := c.Capture("compactor", "boom", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var state map[string]string
+	readJSON(t, filepath.Join(b.Path, "state.json"), &state)
+	if !strings.Contains(state["stuck"], "not returned") || !strings.Contains(state["broken"], "panicked") {
+		t.Fatalf("state = %v", state)
+	}
+}
+
+func readJSON(t *testing.T, path string, v any) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatal(err)
+	}
+}
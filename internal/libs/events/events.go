@@ -0,0 +1,291 @@
+// Package events is an in-process publish/subscribe bus, so a component can
+// announce what it did, like the WAL applying a record or a compaction run
+// finishing, without knowing which others care: cache invalidation, alerting
+// webhooks, and later sinks subscribe to the topics instead of being called
+// directly.
+//
+// Delivery is best effort. Each subscriber has a buffer drained by a
+// goroutine of its own, so a slow subscriber never holds up the publisher
+// or the others; events that don't fit in its buffer are dropped and
+// counted. A synchronous subscriber runs in the publisher's goroutine
+// instead and sees every event, so it must be quick and must not call back
+// into the publisher.
+package events
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/clock"
+	"github.com/rs/zerolog"
+)
+
+// Topic names a kind of event
+type Topic string
+
+// Topics published in the tree
+const (
+	// TopicWALApplied is published for each document record a WALStore
+	// writes to the WAL and applies to its index (db.AppliedRecord)
+	TopicWALApplied Topic = "wal.applied"
+
+	// TopicCompactionRun is published when a compaction run that selected
+	// segments ends, whether or not it succeeded (wal.CompactionRun)
+	TopicCompactionRun Topic = "compaction.run"
+
+	// TopicRefreshRun is published when a run of the refresh policies,
+	// which re-fetch and expire connector-fed documents, ends
+	// (worker.RefreshRun)
+	TopicRefreshRun Topic = "refresh.run"
+)
+
+// DefaultBuffer is the number of events an asynchronous subscriber can fall
+// behind by before events are dropped
+const DefaultBuffer = 256
+
+// Event is a published payload
+type Event struct {
+	Topic   Topic     `json:"topic"`
+	At      time.Time `json:"at"`
+	Payload any       `json:"payload"`
+}
+
+// Handler receives the events of a subscription
+type Handler func(Event)
+
+// Bus delivers published events to the subscribers of their topic. A nil
+// *Bus publishes nothing, so publishers needn't check for one.
+type Bus struct {
+	logger zerolog.Logger
+	clock  clock.Clock
+
+	mu     sync.RWMutex
+	subs   map[Topic][]*subscription
+	closed bool
+	wg     sync.WaitGroup // Subscriber goroutines
+}
+
+// Option configures a Bus
+type Option func(*Bus)
+
+// WithClock stamps events with the time on c instead of the system clock
+func WithClock(c clock.Clock) Option {
+	return func(b *Bus) {
+		b.clock = clock.Or(c)
+	}
+}
+
+// New returns a bus; logger reports subscribers that panic
+func New(logger zerolog.Logger, opts ...Option) *Bus {
+	b := &Bus{
+		logger: logger,
+		clock:  clock.System(),
+		subs:   make(map[Topic][]*subscription),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// subscription is one subscriber of a topic
+type subscription struct {
+	topic  Topic
+	name   string
+	fn     Handler
+	sync   bool
+	buffer int
+	ch     chan Event // Nil for synchronous subscribers
+
+	delivered atomic.Uint64
+	dropped   atomic.Uint64
+	panics    atomic.Uint64
+}
+
+// SubscribeOption configures a subscription
+type SubscribeOption func(*subscription)
+
+// Sync runs the handler in the publisher's goroutine. Nothing is dropped,
+// but the publisher waits for it, sometimes holding locks, so it must be
+// quick and must not call back into the publisher.
+func Sync() SubscribeOption {
+	return func(s *subscription) {
+		s.sync = true
+	}
+}
+
+// WithBuffer sets how many events an asynchronous subscriber can fall
+// behind by before events are dropped (DefaultBuffer if n <= 0)
+func WithBuffer(n int) SubscribeOption {
+	return func(s *subscription) {
+		if n > 0 {
+			s.buffer = n
+		}
+	}
+}
+
+// Subscribe calls fn with the events published on topic from now on; name
+// identifies the subscriber in logs and Stats. It returns a function that
+// ends the subscription; events already buffered for an asynchronous
+// subscriber are still handled.
+func (b *Bus) Subscribe(topic Topic, name string, fn Handler, opts ...SubscribeOption) (unsubscribe func()) {
+	if b == nil {
+		return func() {}
+	}
+	s := &subscription{topic: topic, name: name, fn: fn, buffer: DefaultBuffer}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return func() {}
+	}
+	if !s.sync {
+		s.ch = make(chan Event, s.buffer)
+		b.wg.Add(1)
+		go b.run(s)
+	}
+	b.subs[topic] = append(b.subs[topic], s)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { b.unsubscribe(s) })
+	}
+}
+
+// Publish sends payload to the subscribers of topic. It never blocks on an
+// asynchronous subscriber; it runs the synchronous ones before returning.
+func (b *Bus) Publish(topic Topic, payload any) {
+	if b == nil {
+		return
+	}
+	ev := Event{Topic: topic, At: b.clock.Now(), Payload: payload}
+
+	var direct []*subscription
+	b.mu.RLock()
+	for _, s := range b.subs[topic] {
+		if s.sync {
+			direct = append(direct, s)
+			continue
+		}
+		select {
+		case s.ch <- ev:
+		default:
+			s.dropped.Add(1)
+		}
+	}
+	b.mu.RUnlock()
+
+	for _, s := range direct {
+		b.deliver(s, ev)
+	}
+}
+
+// Close ends every subscription, waiting for the asynchronous subscribers
+// to handle the events already buffered. Publishing after Close does
+// nothing.
+func (b *Bus) Close() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	b.closed = true
+	for _, subs := range b.subs {
+		for _, s := range subs {
+			if s.ch != nil {
+				close(s.ch)
+			}
+		}
+	}
+	b.subs = make(map[Topic][]*subscription)
+	b.mu.Unlock()
+
+	b.wg.Wait()
+}
+
+// SubscriberStats counts the events of one subscription
+type SubscriberStats struct {
+	Topic     Topic  `json:"topic"`
+	Name      string `json:"name"`
+	Delivered uint64 `json:"delivered"`
+	Dropped   uint64 `json:"dropped"` // Published while its buffer was full
+	Panics    uint64 `json:"panics"`  // Handler calls that panicked
+	Pending   int    `json:"pending"` // Buffered, not handled yet
+}
+
+// Stats returns the counts of the current subscriptions, by topic and name
+func (b *Bus) Stats() []SubscriberStats {
+	if b == nil {
+		return nil
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var stats []SubscriberStats
+	for _, subs := range b.subs {
+		for _, s := range subs {
+			stats = append(stats, SubscriberStats{
+				Topic:     s.topic,
+				Name:      s.name,
+				Delivered: s.delivered.Load(),
+				Dropped:   s.dropped.Load(),
+				Panics:    s.panics.Load(),
+				Pending:   len(s.ch),
+			})
+		}
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Topic != stats[j].Topic {
+			return stats[i].Topic < stats[j].Topic
+		}
+		return stats[i].Name < stats[j].Name
+	})
+	return stats
+}
+
+// unsubscribe removes s; an asynchronous subscriber's goroutine handles
+// what's buffered and exits
+func (b *Bus) unsubscribe(s *subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	subs := b.subs[s.topic]
+	for i, sub := range subs {
+		if sub == s {
+			b.subs[s.topic] = append(subs[:i:i], subs[i+1:]...)
+			if s.ch != nil {
+				close(s.ch)
+			}
+			return
+		}
+	}
+}
+
+// run delivers the events buffered for an asynchronous subscriber
+func (b *Bus) run(s *subscription) {
+	defer b.wg.Done()
+	for ev := range s.ch {
+		b.deliver(s, ev)
+	}
+}
+
+// deliver calls the subscriber's handler, recovering a panic so one bad
+// subscriber can't take down the publisher or the others
+func (b *Bus) deliver(s *subscription, ev Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.panics.Add(1)
+			b.logger.Error().Interface("panic", r).Str("topic", string(s.topic)).Str("subscriber", s.name).Msg("event subscriber panicked")
+		}
+	}()
+	s.fn(ev)
+	s.delivered.Add(1)
+}
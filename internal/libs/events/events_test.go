@@ -0,0 +1,139 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/clock"
+	"github.com/rs/zerolog"
+)
+
+func TestBusDelivery(t *testing.T) {
+	start := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	bus := New(zerolog.Nop(), WithClock(clock.NewFake(start)))
+
+	var direct []Event
+	bus.Subscribe(TopicWALApplied, "direct", func(ev Event) { direct = append(direct, ev) }, Sync())
+	got := make(chan Event, 10)
+	unsubscribe := bus.Subscribe(TopicWALApplied, "async", func(ev Event) { got <- ev })
+	bus.Subscribe(TopicCompactionRun, "other", func(Event) { t.Error("expected no compaction events") }, Sync())
+
+	bus.Publish(TopicWALApplied, "a")
+	if len(direct) != 1 || direct[0].Payload != "a" || !direct[0].At.Equal(start) {
+		t.Fatalf("expected the sync subscriber called before Publish returns, got %+v", direct)
+	}
+	if ev := <-got; ev.Payload != "a" || ev.Topic != TopicWALApplied {
+		t.Errorf("expected event a on %s, got %+v", TopicWALApplied, ev)
+	}
+
+	// Unsubscribed handlers hear nothing more
+	unsubscribe()
+	unsubscribe()
+	bus.Publish(TopicWALApplied, "b")
+	bus.Close()
+	select {
+	case ev := <-got:
+		t.Errorf("expected no event after unsubscribing, got %+v", ev)
+	default:
+	}
+	if len(direct) != 2 {
+		t.Errorf("expected 2 sync deliveries, got %d", len(direct))
+	}
+
+	// Publishing after Close, or on a nil bus, does nothing
+	bus.Publish(TopicWALApplied, "c")
+	var none *Bus
+	none.Publish(TopicWALApplied, "c")
+	none.Subscribe(TopicWALApplied, "nil", func(Event) {})()
+	if len(direct) != 2 || none.Stats() != nil {
+		t.Error("expected nothing delivered after Close or on a nil bus")
+	}
+}
+
+func TestBusSlowSubscriber(t *testing.T) {
+	bus := New(zerolog.Nop())
+	release := make(chan struct{})
+	handled := make(chan struct{}, 10)
+	bus.Subscribe(TopicWALApplied, "slow", func(Event) {
+		<-release
+		handled <- struct{}{}
+	}, WithBuffer(2))
+	bus.Subscribe(TopicWALApplied, "panics", func(Event) { panic("boom") }, Sync())
+
+	// The first event is taken by the handler and two are buffered; the
+	// rest are dropped without blocking the publisher
+	bus.Publish(TopicWALApplied, 1)
+	waitFor(t, func() bool { return stat(bus, "slow").Pending == 0 })
+	for i := range 4 {
+		bus.Publish(TopicWALApplied, i+2)
+	}
+	if s := stat(bus, "slow"); s.Dropped != 2 || s.Pending != 2 {
+		t.Errorf("expected 2 dropped and 2 pending, got %+v", s)
+	}
+	if s := stat(bus, "panics"); s.Panics != 5 || s.Delivered != 0 {
+		t.Errorf("expected 5 recovered panics, got %+v", s)
+	}
+
+	// Close waits for the buffered events to be handled
+	close(release)
+	bus.Close()
+	if len(handled) != 3 {
+		t.Errorf("expected 3 events handled, got %d", len(handled))
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	got := make(chan Event, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev Event
+		if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+			t.Errorf("failed to decode event: %v", err)
+		}
+		got <- ev
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	bus := New(zerolog.Nop())
+	NewWebhook(srv.URL, 5*time.Second, zerolog.Nop()).Subscribe(bus, TopicCompactionRun)
+	bus.Publish(TopicCompactionRun, map[string]int{"records": 3})
+	bus.Close()
+
+	ev := <-got
+	payload, _ := ev.Payload.(map[string]any)
+	if ev.Topic != TopicCompactionRun || payload["records"] != float64(3) {
+		t.Errorf("expected the compaction run posted, got %+v", ev)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer failing.Close()
+	if err := NewWebhook(failing.URL, 5*time.Second, zerolog.Nop()).Send(context.Background(), ev); err == nil {
+		t.Error("expected an error for a 400 response")
+	}
+}
+
+func stat(bus *Bus, name string) SubscriberStats {
+	for _, s := range bus.Stats() {
+		if s.Name == name {
+			return s
+		}
+	}
+	return SubscriberStats{}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
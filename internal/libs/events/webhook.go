@@ -0,0 +1,75 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/httpclient"
+	"github.com/rs/zerolog"
+)
+
+// Webhook POSTs events as JSON to an external endpoint, for alerting on
+// things like failed compactions without polling the admin API. Subscribe
+// its Handle asynchronously: each call waits for the endpoint.
+type Webhook struct {
+	url     string
+	client  *http.Client
+	timeout time.Duration
+	logger  zerolog.Logger
+}
+
+// NewWebhook returns a webhook calling url. timeout bounds each call,
+// including retries of 429 and 5xx responses; failures are logged.
+func NewWebhook(url string, timeout time.Duration, logger zerolog.Logger) *Webhook {
+	return &Webhook{
+		url:     url,
+		client:  httpclient.New(httpclient.WithTimeout(timeout), httpclient.WithMaxElapsed(timeout)),
+		timeout: timeout,
+		logger:  logger,
+	}
+}
+
+// Subscribe sends the events of topics to the webhook, each in the
+// background
+func (w *Webhook) Subscribe(bus *Bus, topics ...Topic) {
+	for _, topic := range topics {
+		bus.Subscribe(topic, "webhook", w.Handle)
+	}
+}
+
+// Handle is the webhook as a Handler
+func (w *Webhook) Handle(ev Event) {
+	ctx, cancel := context.WithTimeout(context.Background(), w.timeout)
+	defer cancel()
+	if err := w.Send(ctx, ev); err != nil {
+		w.logger.Warn().Err(err).Str("topic", string(ev.Topic)).Msg("event webhook failed")
+	}
+}
+
+// Send POSTs ev; any 2xx is success
+func (w *Webhook) Send(ctx context.Context, ev Event) error {
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call webhook: %w", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
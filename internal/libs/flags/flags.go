@@ -0,0 +1,207 @@
+// Package flags gates risky subsystems behind feature flags, so they can be
+// rolled out and rolled back without a redeploy. Each flag has a built-in
+// default, which config (FEATURE_FLAGS) can change at startup and the admin
+// API can override at runtime.
+package flags
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Flags consulted by subsystems
+const (
+	Reranker   = "reranker"    // Collection rerankers reorder search and run results
+	MultiQuery = "multi_query" // /run honors strategy=multi_query; otherwise it searches the query alone
+	MMR        = "mmr"         // Searches and runs honor diversify; otherwise results are not diversified
+)
+
+// Flag describes a known flag
+type Flag struct {
+	Name        string
+	Description string
+	Default     bool
+}
+
+// known lists every flag, sorted by name; others are rejected so typos
+// don't go unnoticed
+var known = []Flag{
+	{Name: MMR, Description: "Maximal Marginal Relevance diversification for diversify=true", Default: true},
+	{Name: MultiQuery, Description: "Multi-query retrieval for /run strategy=multi_query", Default: true},
+	{Name: Reranker, Description: "Collection rerankers", Default: true},
+}
+
+// Where a flag's value comes from
+const (
+	SourceDefault  = "default"
+	SourceConfig   = "config"
+	SourceOverride = "override"
+)
+
+// ErrUnknownFlag is returned for names that aren't a known flag
+var ErrUnknownFlag = errors.New("unknown feature flag")
+
+// overrideKeyPrefix prefixes the store keys of runtime overrides
+const overrideKeyPrefix = "flags/"
+
+// Store persists runtime overrides across restarts; db.KV satisfies it
+type Store interface {
+	GetKV(key string) ([]byte, bool)
+	SetKV(ctx context.Context, key string, value []byte) error
+	DeleteKV(ctx context.Context, key string) error
+}
+
+// State is a flag's current value and where it comes from
+type State struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Enabled     bool   `json:"enabled"`
+	Default     bool   `json:"default"`
+	Source      string `json:"source"` // default, config, or override
+}
+
+// Set holds the flag values of a process
+type Set struct {
+	static map[string]bool // From config
+	store  Store           // nil keeps overrides in memory only
+
+	mu        sync.RWMutex
+	overrides map[string]bool
+}
+
+// Option configures a Set
+type Option func(*Set)
+
+// WithStore persists runtime overrides in store and loads the ones saved there
+func WithStore(store Store) Option {
+	return func(s *Set) {
+		s.store = store
+	}
+}
+
+// New creates a flag set with static values from config
+func New(static map[string]bool, opts ...Option) (*Set, error) {
+	for name := range static {
+		if _, ok := lookup(name); !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownFlag, name)
+		}
+	}
+	s := &Set{static: static, overrides: make(map[string]bool)}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.store != nil {
+		for _, f := range known {
+			data, ok := s.store.GetKV(overrideKeyPrefix + f.Name)
+			if !ok {
+				continue
+			}
+			enabled, err := strconv.ParseBool(string(data))
+			if err != nil {
+				return nil, fmt.Errorf("invalid stored override for flag %s: %w", f.Name, err)
+			}
+			s.overrides[f.Name] = enabled
+		}
+	}
+	return s, nil
+}
+
+// Defaults returns a flag set with every flag at its default
+func Defaults() *Set {
+	return &Set{overrides: make(map[string]bool)}
+}
+
+// Enabled reports whether a flag is on; unknown flags are off
+func (s *Set) Enabled(name string) bool {
+	return s.Get(name).Enabled
+}
+
+// Get returns the state of a flag; unknown flags are off
+func (s *Set) Get(name string) State {
+	f, ok := lookup(name)
+	if !ok {
+		return State{Name: name}
+	}
+	st := State{Name: f.Name, Description: f.Description, Enabled: f.Default, Default: f.Default, Source: SourceDefault}
+	if v, ok := s.static[name]; ok {
+		st.Enabled, st.Source = v, SourceConfig
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if v, ok := s.overrides[name]; ok {
+		st.Enabled, st.Source = v, SourceOverride
+	}
+	return st
+}
+
+// List returns the state of every flag, sorted by name
+func (s *Set) List() []State {
+	states := make([]State, len(known))
+	for i, f := range known {
+		states[i] = s.Get(f.Name)
+	}
+	return states
+}
+
+// Override sets a flag at runtime, taking precedence over config
+func (s *Set) Override(ctx context.Context, name string, enabled bool) error {
+	if _, ok := lookup(name); !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownFlag, name)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.store != nil {
+		if err := s.store.SetKV(ctx, overrideKeyPrefix+name, []byte(strconv.FormatBool(enabled))); err != nil {
+			return fmt.Errorf("failed to save flag override: %w", err)
+		}
+	}
+	s.overrides[name] = enabled
+	return nil
+}
+
+// ClearOverride drops a runtime override, so config or the default applies again
+func (s *Set) ClearOverride(ctx context.Context, name string) error {
+	if _, ok := lookup(name); !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownFlag, name)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.store != nil {
+		if err := s.store.DeleteKV(ctx, overrideKeyPrefix+name); err != nil {
+			return fmt.Errorf("failed to delete flag override: %w", err)
+		}
+	}
+	delete(s.overrides, name)
+	return nil
+}
+
+// Parse reads comma-separated name=bool pairs, e.g. "reranker=false,mmr=true"
+func Parse(spec string) (map[string]bool, error) {
+	values := make(map[string]bool)
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, v, ok := strings.Cut(pair, "=")
+		enabled, err := strconv.ParseBool(strings.TrimSpace(v))
+		if !ok || err != nil {
+			return nil, fmt.Errorf("invalid feature flag %q: use name=true or name=false", pair)
+		}
+		values[strings.TrimSpace(name)] = enabled
+	}
+	return values, nil
+}
+
+func lookup(name string) (Flag, bool) {
+	i := sort.Search(len(known), func(i int) bool { return known[i].Name >= name })
+	if i < len(known) && known[i].Name == name {
+		return known[i], true
+	}
+	return Flag{}, false
+}
@@ -0,0 +1,80 @@
+package flags
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// memStore is a Store kept in a map
+type memStore map[string][]byte
+
+func (m memStore) GetKV(key string) ([]byte, bool) { v, ok := m[key]; return v, ok }
+func (m memStore) SetKV(_ context.Context, key string, value []byte) error {
+	m[key] = value
+	return nil
+}
+func (m memStore) DeleteKV(_ context.Context, key string) error {
+	delete(m, key)
+	return nil
+}
+
+func TestSetPrecedence(t *testing.T) {
+	ctx := context.Background()
+	store := memStore{}
+	s, err := New(map[string]bool{Reranker: false}, WithStore(store))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	if st := s.Get(MMR); !st.Enabled || st.Source != SourceDefault {
+		t.Errorf("expected mmr on by default, got %+v", st)
+	}
+	if st := s.Get(Reranker); st.Enabled || st.Source != SourceConfig {
+		t.Errorf("expected config to turn the reranker off, got %+v", st)
+	}
+
+	if err := s.Override(ctx, Reranker, true); err != nil {
+		t.Fatalf("override failed: %v", err)
+	}
+	if st := s.Get(Reranker); !st.Enabled || st.Source != SourceOverride {
+		t.Errorf("expected the override to win over config, got %+v", st)
+	}
+
+	// Overrides survive a restart through the store
+	reopened, err := New(map[string]bool{Reranker: false}, WithStore(store))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if !reopened.Enabled(Reranker) {
+		t.Error("expected the stored override to be loaded")
+	}
+	if err := reopened.ClearOverride(ctx, Reranker); err != nil {
+		t.Fatalf("clear failed: %v", err)
+	}
+	if reopened.Enabled(Reranker) || len(store) != 0 {
+		t.Errorf("expected config to apply again and the override to be deleted, store has %v", store)
+	}
+
+	if err := s.Override(ctx, "hnsw", true); !errors.Is(err, ErrUnknownFlag) {
+		t.Errorf("expected ErrUnknownFlag, got %v", err)
+	}
+	if _, err := New(map[string]bool{"rerankr": true}); !errors.Is(err, ErrUnknownFlag) {
+		t.Errorf("expected a typo in config to fail, got %v", err)
+	}
+	if s.Enabled("hnsw") {
+		t.Error("expected unknown flags to be off")
+	}
+}
+
+func TestParse(t *testing.T) {
+	got, err := Parse(" reranker=false, mmr=true ,")
+	if err != nil || len(got) != 2 || got[Reranker] || !got[MMR] {
+		t.Errorf("unexpected parse: %v %v", got, err)
+	}
+	for _, spec := range []string{"reranker", "reranker=maybe"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("expected error for %q", spec)
+		}
+	}
+}
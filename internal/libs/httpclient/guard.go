@@ -0,0 +1,144 @@
+package httpclient
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrBlocked is returned (wrapped) when a guarded client refuses to connect
+// to an address
+var ErrBlocked = errors.New("outbound address blocked")
+
+// defaultDeny holds the ranges a guarded client never connects to unless
+// they're allowed explicitly: loopback, private networks, link-local (which
+// covers the 169.254.169.254 cloud metadata endpoint), and other addresses
+// that can't be a public web server
+var defaultDeny = mustPrefixes(
+	"0.0.0.0/8",          // "This" network
+	"10.0.0.0/8",         // Private
+	"100.64.0.0/10",      // Carrier-grade NAT
+	"127.0.0.0/8",        // Loopback
+	"169.254.0.0/16",     // Link-local and cloud metadata
+	"172.16.0.0/12",      // Private
+	"192.0.0.0/24",       // IETF protocol assignments
+	"192.168.0.0/16",     // Private
+	"198.18.0.0/15",      // Benchmarking
+	"224.0.0.0/4",        // Multicast
+	"240.0.0.0/4",        // Reserved and broadcast
+	"::/128",             // Unspecified
+	"::1/128",            // Loopback
+	"64:ff9b::/96",       // NAT64, which can embed any IPv4 address
+	"fc00::/7",           // Unique local, including fd00:ec2::254 metadata
+	"fe80::/10",          // Link-local
+	"ff00::/8",           // Multicast
+	"168.63.129.16/32",   // Azure host endpoint
+	"100.100.100.200/32", // Alibaba Cloud metadata
+)
+
+// Guard decides which addresses outbound requests may connect to, to stop
+// user-supplied URLs from reaching internal services (SSRF). Deny entries
+// win over allow entries, which win over the default deny list.
+type Guard struct {
+	allow []netip.Prefix
+	deny  []netip.Prefix
+}
+
+// NewGuard creates a guard from allow and deny entries, each a CIDR or a
+// single IP
+func NewGuard(allow, deny []string) (*Guard, error) {
+	g := &Guard{}
+	var err error
+	if g.allow, err = parsePrefixes(allow); err != nil {
+		return nil, fmt.Errorf("invalid allow entry: %w", err)
+	}
+	if g.deny, err = parsePrefixes(deny); err != nil {
+		return nil, fmt.Errorf("invalid deny entry: %w", err)
+	}
+	return g, nil
+}
+
+// DefaultGuard returns a guard that only applies the default deny list
+func DefaultGuard() *Guard {
+	return &Guard{}
+}
+
+// Check returns an error wrapping ErrBlocked if addr may not be connected to
+func (g *Guard) Check(addr netip.Addr) error {
+	addr = addr.Unmap()
+	switch {
+	case containsAddr(g.deny, addr):
+		return fmt.Errorf("%w: %s is denied", ErrBlocked, addr)
+	case containsAddr(g.allow, addr):
+		return nil
+	case containsAddr(defaultDeny, addr):
+		return fmt.Errorf("%w: %s is a private or reserved address", ErrBlocked, addr)
+	}
+	return nil
+}
+
+// dialer returns a dialer that checks each address after DNS resolution,
+// right before connecting. Redirects and DNS answers that change between
+// lookups are checked at the address actually used.
+func (g *Guard) dialer() *net.Dialer {
+	return &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			addr, err := netip.ParseAddr(host)
+			if err != nil {
+				return fmt.Errorf("%w: unresolved address %s", ErrBlocked, host)
+			}
+			return g.Check(addr)
+		},
+	}
+}
+
+func parsePrefixes(entries []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, e := range entries {
+		e = strings.TrimSpace(e)
+		if e == "" {
+			continue
+		}
+		if !strings.Contains(e, "/") {
+			addr, err := netip.ParseAddr(e)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(e)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, p.Masked())
+	}
+	return prefixes, nil
+}
+
+func mustPrefixes(entries ...string) []netip.Prefix {
+	prefixes, err := parsePrefixes(entries)
+	if err != nil {
+		panic(err)
+	}
+	return prefixes
+}
+
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
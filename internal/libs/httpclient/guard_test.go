@@ -0,0 +1,78 @@
+package httpclient
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestGuardCheck(t *testing.T) {
+	g, err := NewGuard([]string{"10.1.0.0/16"}, []string{"10.1.2.3", "203.0.113.0/24"})
+	if err != nil {
+		t.Fatalf("NewGuard failed: %v", err)
+	}
+
+	tests := []struct {
+		addr    string
+		blocked bool
+	}{
+		{"93.184.216.34", false},
+		{"127.0.0.1", true},
+		{"169.254.169.254", true},
+		{"192.168.1.10", true},
+		{"::1", true},
+		{"::ffff:127.0.0.1", true}, // IPv4-mapped loopback
+		{"fd00:ec2::254", true},
+		{"10.1.5.5", false},     // Allowed over the default deny
+		{"10.1.2.3", true},      // Denied over the allow
+		{"203.0.113.9", true},   // Denied public range
+		{"2606:4700::1", false}, // Public IPv6
+	}
+	for _, tt := range tests {
+		err := g.Check(netip.MustParseAddr(tt.addr))
+		if blocked := errors.Is(err, ErrBlocked); blocked != tt.blocked {
+			t.Errorf("%s: blocked=%v, want %v (%v)", tt.addr, blocked, tt.blocked, err)
+		}
+	}
+
+	if _, err := NewGuard([]string{"not-an-ip"}, nil); err == nil {
+		t.Error("expected an invalid entry to fail")
+	}
+}
+
+func TestGuardedClient(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	// Loopback is denied by default, and a blocked dial isn't retried
+	g, _ := NewGuard(nil, nil)
+	if _, err := New(WithGuard(g)).Get(srv.URL); !errors.Is(err, ErrBlocked) {
+		t.Fatalf("expected loopback to be blocked, got %v", err)
+	}
+	if calls != 0 {
+		t.Fatalf("expected no request to reach the server, got %d", calls)
+	}
+
+	g, _ = NewGuard([]string{"127.0.0.1"}, nil)
+	client := New(WithGuard(g))
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("expected an allowed address to connect, got %v", err)
+	}
+	_ = resp.Body.Close()
+
+	// Redirects are checked at connect time too
+	if _, err := client.Get(srv.URL + "/redirect"); !errors.Is(err, ErrBlocked) {
+		t.Errorf("expected the redirect to the metadata endpoint to be blocked, got %v", err)
+	}
+}
@@ -0,0 +1,262 @@
+// Package httpclient builds the HTTP client used for outbound calls to
+// embedding providers, LLMs, connectors, webhooks, and other nodes. Unlike
+// http.DefaultClient it always times out, and it retries rate-limited and
+// failed requests with jittered exponential backoff within a time budget.
+package httpclient
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Client defaults
+const (
+	DefaultTimeout    = 30 * time.Second // Per attempt, until the response headers arrive
+	DefaultMaxElapsed = 2 * time.Minute  // All attempts, including reading the last body
+	DefaultMaxRetries = 3
+	DefaultBaseDelay  = 200 * time.Millisecond
+	DefaultMaxDelay   = 10 * time.Second
+)
+
+// maxDrain caps the body read from a failed attempt so its connection can
+// be reused
+const maxDrain = 64 << 10
+
+type options struct {
+	timeout    time.Duration
+	maxElapsed time.Duration
+	maxRetries int
+	baseDelay  time.Duration
+	maxDelay   time.Duration
+	proxy      func(*http.Request) (*url.URL, error)
+	guard      *Guard
+	tls        *tls.Config
+	transport  http.RoundTripper
+}
+
+// Option configures a client
+type Option func(*options)
+
+// WithTimeout bounds each attempt until its response headers arrive
+// (default: DefaultTimeout)
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.timeout = d
+	}
+}
+
+// WithMaxElapsed bounds a request across all attempts and backoff delays,
+// including reading the response body (default: DefaultMaxElapsed)
+func WithMaxElapsed(d time.Duration) Option {
+	return func(o *options) {
+		o.maxElapsed = d
+	}
+}
+
+// WithRetries sets how many times a failed attempt is retried
+// (default: DefaultMaxRetries, 0 to disable)
+func WithRetries(n int) Option {
+	return func(o *options) {
+		o.maxRetries = n
+	}
+}
+
+// WithBackoff sets the first retry's delay and the cap on later ones
+// (defaults: DefaultBaseDelay, DefaultMaxDelay)
+func WithBackoff(base, max time.Duration) Option {
+	return func(o *options) {
+		o.baseDelay = base
+		o.maxDelay = max
+	}
+}
+
+// WithProxy sends requests through the proxy at u instead of the one named
+// by HTTP_PROXY, HTTPS_PROXY, and NO_PROXY
+func WithProxy(u *url.URL) Option {
+	return func(o *options) {
+		o.proxy = http.ProxyURL(u)
+	}
+}
+
+// WithGuard only connects to addresses g allows. Guarded clients don't use
+// a proxy, since the proxy would connect on their behalf unchecked.
+func WithGuard(g *Guard) Option {
+	return func(o *options) {
+		o.guard = g
+	}
+}
+
+// WithTLS connects with cfg, e.g. to present a client certificate to a
+// server using mutual TLS
+func WithTLS(cfg *tls.Config) Option {
+	return func(o *options) {
+		o.tls = cfg
+	}
+}
+
+// WithTransport sends attempts with rt instead of a transport built from
+// the timeout, proxy, guard, and TLS options
+func WithTransport(rt http.RoundTripper) Option {
+	return func(o *options) {
+		o.transport = rt
+	}
+}
+
+// New returns a client with the given options. A request is retried when
+// the attempt fails to connect or gets a 429 or 5xx response, as long as its
+// body can be replayed, its context is live, and the next delay fits in the
+// budget. A Retry-After header on the response overrides the backoff.
+func New(opts ...Option) *http.Client {
+	o := options{
+		timeout:    DefaultTimeout,
+		maxElapsed: DefaultMaxElapsed,
+		maxRetries: DefaultMaxRetries,
+		baseDelay:  DefaultBaseDelay,
+		maxDelay:   DefaultMaxDelay,
+		proxy:      http.ProxyFromEnvironment,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	next := o.transport
+	if next == nil {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.Proxy = o.proxy
+		t.ResponseHeaderTimeout = o.timeout
+		t.TLSClientConfig = o.tls
+		if o.guard != nil {
+			t.Proxy = nil
+			t.DialContext = o.guard.dialer().DialContext
+		}
+		next = t
+	}
+
+	return &http.Client{
+		Timeout: o.maxElapsed,
+		Transport: &retryTransport{
+			next:       next,
+			maxRetries: o.maxRetries,
+			baseDelay:  o.baseDelay,
+			maxDelay:   o.maxDelay,
+			maxElapsed: o.maxElapsed,
+		},
+	}
+}
+
+// retryTransport retries attempts made with next
+type retryTransport struct {
+	next       http.RoundTripper
+	maxRetries int
+	baseDelay  time.Duration
+	maxDelay   time.Duration
+	maxElapsed time.Duration
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	deadline := time.Now().Add(t.maxElapsed)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := t.next.RoundTrip(req)
+		if attempt >= t.maxRetries || !retryable(req, resp, err) {
+			return resp, err
+		}
+
+		delay := t.backoff(attempt)
+		if after, ok := retryAfter(resp); ok {
+			delay = after
+		}
+		if time.Now().Add(delay).After(deadline) {
+			return resp, err // Out of budget: the caller sees the last attempt
+		}
+
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrain))
+			_ = resp.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(ctx)
+			req.Body = body
+		}
+	}
+}
+
+// backoff returns a delay drawn uniformly from [0, min(maxDelay, base*2^attempt)]
+// ("full jitter"), so clients retrying together spread out
+func (t *retryTransport) backoff(attempt int) time.Duration {
+	ceiling := t.maxDelay
+	if attempt < 30 {
+		if d := t.baseDelay << attempt; d > 0 && d < ceiling {
+			ceiling = d
+		}
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// retryable reports whether an attempt's outcome is worth retrying
+func retryable(req *http.Request, resp *http.Response, err error) bool {
+	if req.Context().Err() != nil {
+		return false
+	}
+	// A consumed body can only be sent again if it can be rebuilt
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	if err != nil {
+		return !errors.Is(err, ErrBlocked)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP date
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
@@ -0,0 +1,131 @@
+package httpclient
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyServer fails the first n requests with status, then echoes the body
+func flakyServer(t *testing.T, n int32, status int, header http.Header) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= n {
+			for k, v := range header {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(status)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestRetriesServerErrors(t *testing.T) {
+	srv, calls := flakyServer(t, 2, http.StatusServiceUnavailable, nil)
+	client := New(WithBackoff(time.Millisecond, 5*time.Millisecond))
+
+	resp, err := client.Post(srv.URL, "text/plain", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "payload" {
+		t.Errorf("expected the replayed body after retries, got %d %q", resp.StatusCode, body)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("expected 3 attempts, got %d", n)
+	}
+}
+
+func TestRetriesStopAtLimit(t *testing.T) {
+	srv, calls := flakyServer(t, 100, http.StatusBadGateway, nil)
+	client := New(WithRetries(2), WithBackoff(time.Millisecond, time.Millisecond))
+
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway || calls.Load() != 3 {
+		t.Errorf("expected the last 502 after 3 attempts, got %d after %d", resp.StatusCode, calls.Load())
+	}
+}
+
+func TestNoRetryOnClientErrors(t *testing.T) {
+	srv, calls := flakyServer(t, 100, http.StatusUnprocessableEntity, nil)
+	resp, err := New(WithBackoff(time.Millisecond, time.Millisecond)).Get(srv.URL)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	_ = resp.Body.Close()
+	if calls.Load() != 1 {
+		t.Errorf("expected a 422 not to be retried, got %d attempts", calls.Load())
+	}
+}
+
+func TestRetryAfterBeyondBudget(t *testing.T) {
+	srv, calls := flakyServer(t, 100, http.StatusTooManyRequests, http.Header{"Retry-After": {"60"}})
+	client := New(WithMaxElapsed(time.Second), WithBackoff(time.Millisecond, time.Millisecond))
+
+	start := time.Now()
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests || calls.Load() != 1 {
+		t.Errorf("expected the 429 returned without waiting, got %d after %d attempts", resp.StatusCode, calls.Load())
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Error("expected no wait past the budget")
+	}
+}
+
+func TestAttemptTimeout(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	client := New(WithTimeout(50*time.Millisecond), WithBackoff(time.Millisecond, time.Millisecond))
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("expected the hung attempt to be retried, got %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent || calls.Load() != 2 {
+		t.Errorf("expected 204 on the second attempt, got %d after %d", resp.StatusCode, calls.Load())
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	rt := &retryTransport{baseDelay: 100 * time.Millisecond, maxDelay: time.Second}
+	for attempt, ceiling := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		for i := 0; i < 50; i++ {
+			if d := rt.backoff(attempt); d < 0 || d > ceiling {
+				t.Fatalf("attempt %d: delay %v outside [0, %v]", attempt, d, ceiling)
+			}
+		}
+	}
+	if d := rt.backoff(200); d > time.Second {
+		t.Errorf("expected large attempts capped at the max delay, got %v", d)
+	}
+}
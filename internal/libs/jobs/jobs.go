@@ -1,7 +1,11 @@
 // Package jobs provides background job queue management and async task processing.
 package jobs
 
-import "time"
+import (
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/clock"
+)
 
 // Job represents a background job
 type Job struct {
@@ -12,14 +16,39 @@ type Job struct {
 
 // Queue manages background jobs
 type Queue struct {
-	jobs []*Job
+	jobs  []*Job
+	clock clock.Clock // Stamps CreatedAt
+	ids   clock.IDs   // IDs of submitted jobs
+}
+
+// QueueOption configures a Queue
+type QueueOption func(*Queue)
+
+// WithQueueClock stamps jobs with the time on c instead of the system clock
+func WithQueueClock(c clock.Clock) QueueOption {
+	return func(q *Queue) {
+		q.clock = clock.Or(c)
+	}
+}
+
+// WithIDs names submitted jobs with ids instead of random IDs
+func WithIDs(ids clock.IDs) QueueOption {
+	return func(q *Queue) {
+		q.ids = clock.OrRandom(ids, 8)
+	}
 }
 
 // NewQueue creates a new job queue
-func NewQueue() *Queue {
-	return &Queue{
-		jobs: make([]*Job, 0),
+func NewQueue(opts ...QueueOption) *Queue {
+	q := &Queue{
+		jobs:  make([]*Job, 0),
+		clock: clock.System(),
+		ids:   clock.RandomIDs(8),
+	}
+	for _, opt := range opts {
+		opt(q)
 	}
+	return q
 }
 
 // Enqueue adds a job to the queue
@@ -27,12 +56,17 @@ func (q *Queue) Enqueue(id string) *Job {
 	job := &Job{
 		ID:        id,
 		Status:    "pending",
-		CreatedAt: time.Now(),
+		CreatedAt: q.clock.Now(),
 	}
 	q.jobs = append(q.jobs, job)
 	return job
 }
 
+// Submit adds a job to the queue under a new ID
+func (q *Queue) Submit() *Job {
+	return q.Enqueue(q.ids.NewID())
+}
+
 // Count returns the number of jobs in the queue
 func (q *Queue) Count() int {
 	return len(q.jobs)
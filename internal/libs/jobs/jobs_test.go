@@ -1,6 +1,16 @@
 package jobs
 
-import "testing"
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/clock"
+	"github.com/dsjohal14/selfstack/internal/libs/diag"
+	"github.com/dsjohal14/selfstack/internal/libs/supervise"
+	"github.com/rs/zerolog"
+)
 
 func TestNewQueue(t *testing.T) {
 	q := NewQueue()
@@ -45,3 +55,92 @@ func TestMultipleJobs(t *testing.T) {
 		t.Errorf("expected 3 jobs in queue, got %d", q.Count())
 	}
 }
+
+func TestQueueSubmit(t *testing.T) {
+	fake := clock.NewFake(time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC))
+	q := NewQueue(WithQueueClock(fake), WithIDs(clock.Sequence("job-")))
+
+	first := q.Submit()
+	fake.Advance(time.Minute)
+	second := q.Submit()
+	if first.ID != "job-1" || second.ID != "job-2" {
+		t.Errorf("expected job-1 and job-2, got %s and %s", first.ID, second.ID)
+	}
+	if second.CreatedAt.Sub(first.CreatedAt) != time.Minute {
+		t.Errorf("expected jobs a minute apart, got %s and %s", first.CreatedAt, second.CreatedAt)
+	}
+}
+
+func TestSchedulerFakeClock(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	s := NewScheduler(zerolog.Nop(), WithClock(fake))
+
+	ran := make(chan struct{})
+	s.Every("tick", time.Hour, func(context.Context) error {
+		ran <- struct{}{}
+		return nil
+	})
+	s.Start(context.Background())
+	defer s.Stop()
+
+	// One run at start, then one per hour of fake time
+	<-ran
+	for range 3 {
+		fake.WaitForTickers(1)
+		fake.Advance(time.Hour)
+		<-ran
+	}
+}
+
+func TestSchedulerRunsTasks(t *testing.T) {
+	s := NewScheduler(zerolog.Nop())
+
+	var runs atomic.Int32
+	s.Every("count", 10*time.Millisecond, func(context.Context) error {
+		runs.Add(1)
+		return nil
+	})
+	s.Start(context.Background())
+
+	deadline := time.Now().Add(2 * time.Second)
+	for runs.Load() < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	s.Stop()
+
+	if runs.Load() < 3 {
+		t.Fatalf("expected at least 3 runs, got %d", runs.Load())
+	}
+	after := runs.Load()
+	time.Sleep(30 * time.Millisecond)
+	if runs.Load() != after {
+		t.Error("tasks should not run after Stop")
+	}
+}
+
+func TestSchedulerRecoversPanics(t *testing.T) {
+	sup := supervise.New(zerolog.Nop(), supervise.WithBackoff(time.Millisecond, time.Millisecond), supervise.WithDiagnostics(diag.New("")))
+	s := NewScheduler(zerolog.Nop(), WithSupervisor(sup))
+
+	var runs atomic.Int32
+	s.Every("flaky", 10*time.Millisecond, func(context.Context) error {
+		if runs.Add(1) == 1 {
+			panic("boom")
+		}
+		return nil
+	})
+	s.Start(context.Background())
+
+	deadline := time.Now().Add(2 * time.Second)
+	for runs.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	s.Stop()
+
+	if runs.Load() < 2 {
+		t.Fatalf("task did not run again after panicking, runs = %d", runs.Load())
+	}
+	if st := sup.Status(); len(st) != 1 || st[0].Name != "job:flaky" || st[0].Restarts != 1 {
+		t.Errorf("status = %+v", st)
+	}
+}
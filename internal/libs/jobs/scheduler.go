@@ -0,0 +1,137 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/clock"
+	"github.com/dsjohal14/selfstack/internal/libs/supervise"
+	"github.com/rs/zerolog"
+)
+
+// Task is a unit of periodic work
+type Task func(ctx context.Context) error
+
+type scheduledTask struct {
+	name     string
+	interval time.Duration
+	fn       Task
+}
+
+// Scheduler runs tasks on fixed intervals until stopped. A task never runs
+// concurrently with itself; a run that overlaps its next tick skips that tick.
+// Each task's loop is supervised as "job:<name>", so a task that panics is
+// restarted with a backoff.
+type Scheduler struct {
+	logger     zerolog.Logger
+	supervisor *supervise.Supervisor
+	clock      clock.Clock // Ticks the task loops
+	tasks      []scheduledTask
+
+	mu      sync.Mutex
+	running bool
+	cancel  context.CancelFunc
+	done    []<-chan struct{}
+}
+
+// SchedulerOption configures a Scheduler
+type SchedulerOption func(*Scheduler)
+
+// WithSupervisor runs the task loops under sup instead of a supervisor of
+// the scheduler's own, so their health is reported with other loops
+func WithSupervisor(sup *supervise.Supervisor) SchedulerOption {
+	return func(s *Scheduler) {
+		s.supervisor = sup
+	}
+}
+
+// WithClock ticks the task loops on c instead of the system clock, so tests
+// can run tasks by advancing a clock.Fake
+func WithClock(c clock.Clock) SchedulerOption {
+	return func(s *Scheduler) {
+		s.clock = c
+	}
+}
+
+// NewScheduler creates a scheduler with no tasks
+func NewScheduler(logger zerolog.Logger, opts ...SchedulerOption) *Scheduler {
+	s := &Scheduler{logger: logger, clock: clock.System()}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.supervisor == nil {
+		s.supervisor = supervise.New(logger)
+	}
+	s.clock = clock.Or(s.clock)
+	return s
+}
+
+// Every adds a task run every interval once the scheduler starts
+func (s *Scheduler) Every(name string, interval time.Duration, fn Task) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tasks = append(s.tasks, scheduledTask{name: name, interval: interval, fn: fn})
+}
+
+// Start runs each task immediately and then on its interval
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running {
+		return
+	}
+	s.running = true
+
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.done = s.done[:0]
+	for _, task := range s.tasks {
+		task := task
+		s.done = append(s.done, s.supervisor.Go(ctx, "job:"+task.name, func(ctx context.Context) error {
+			s.loop(ctx, task)
+			return nil
+		}))
+	}
+}
+
+// Stop cancels running tasks and waits for them to return
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	if !s.running {
+		s.mu.Unlock()
+		return
+	}
+	s.running = false
+	s.cancel()
+	done := s.done
+	s.mu.Unlock()
+
+	for _, d := range done {
+		<-d
+	}
+}
+
+func (s *Scheduler) loop(ctx context.Context, task scheduledTask) {
+	ticker := s.clock.NewTicker(task.interval)
+	defer ticker.Stop()
+
+	for {
+		s.run(ctx, task)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+	}
+}
+
+// run runs a task once
+func (s *Scheduler) run(ctx context.Context, task scheduledTask) {
+	start := s.clock.Now()
+	if err := task.fn(ctx); err != nil && ctx.Err() == nil {
+		s.logger.Error().Err(err).Str("task", task.name).Msg("scheduled task failed")
+	} else {
+		s.logger.Debug().Str("task", task.name).Dur("took", clock.Since(s.clock, start)).Msg("scheduled task done")
+	}
+}
@@ -0,0 +1,124 @@
+// Package membudget keeps memory ceilings for the modules that hold data in
+// memory, so they degrade in a way of their own choosing (evicting cached
+// entries, refusing writes) before the process is killed for running out
+// of memory. Modules estimate their own usage and report it here.
+package membudget
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+)
+
+// Modules with a budget, used as the metric label
+const (
+	ModuleIndex          = "index"
+	ModuleEmbeddingCache = "embedding_cache"
+	ModuleResultCache    = "result_cache"
+)
+
+// ErrExceeded is returned for writes refused because a budget is spent
+var ErrExceeded = errors.New("memory budget exceeded")
+
+// Budget is the memory ceiling of one module. A nil Budget, or one with a
+// limit of 0, is unlimited but still tracks usage when not nil.
+type Budget struct {
+	module string
+	limit  int64
+	used   atomic.Int64
+
+	usedGauge *obs.Gauge
+}
+
+// New creates a budget of limit bytes (0 for unlimited) for module and
+// reports it in reg as selfstack_memory_budget_bytes and
+// selfstack_memory_used_bytes{module="<module>"} (obs.DefaultRegistry when
+// nil)
+func New(module string, limit int64, reg *obs.Registry) *Budget {
+	if reg == nil {
+		reg = obs.DefaultRegistry
+	}
+	reg.GaugeVec("selfstack_memory_budget_bytes", "Memory ceiling of a module (0 = unlimited)", "module").WithLabel(module).Set(limit)
+	return &Budget{
+		module:    module,
+		limit:     limit,
+		usedGauge: reg.GaugeVec("selfstack_memory_used_bytes", "Estimated memory a module holds", "module").WithLabel(module),
+	}
+}
+
+// Module returns the module the budget is for
+func (b *Budget) Module() string {
+	if b == nil {
+		return ""
+	}
+	return b.module
+}
+
+// Limit returns the ceiling in bytes, 0 for unlimited
+func (b *Budget) Limit() int64 {
+	if b == nil {
+		return 0
+	}
+	return b.limit
+}
+
+// Used returns the bytes in use
+func (b *Budget) Used() int64 {
+	if b == nil {
+		return 0
+	}
+	return b.used.Load()
+}
+
+// Add records n more bytes in use; n is negative for freed memory
+func (b *Budget) Add(n int64) {
+	if b == nil || n == 0 {
+		return
+	}
+	b.usedGauge.Set(b.used.Add(n))
+}
+
+// Set records the bytes in use
+func (b *Budget) Set(n int64) {
+	if b == nil {
+		return
+	}
+	b.used.Store(n)
+	b.usedGauge.Set(n)
+}
+
+// Fits reports whether n more bytes stay within the limit. Freeing memory
+// (n <= 0) always fits.
+func (b *Budget) Fits(n int64) bool {
+	if b == nil || b.limit <= 0 || n <= 0 {
+		return true
+	}
+	return b.used.Load()+n <= b.limit
+}
+
+// Exceeded reports whether more bytes are in use than the limit allows
+func (b *Budget) Exceeded() bool {
+	if b == nil || b.limit <= 0 {
+		return false
+	}
+	return b.used.Load() > b.limit
+}
+
+// Utilization returns the fraction of the limit in use, 0 when unlimited
+func (b *Budget) Utilization() float64 {
+	if b == nil || b.limit <= 0 {
+		return 0
+	}
+	return float64(b.used.Load()) / float64(b.limit)
+}
+
+// Reserve checks that n more bytes fit, returning an error wrapping
+// ErrExceeded that names the module if they don't
+func (b *Budget) Reserve(n int64) error {
+	if b.Fits(n) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s uses %d of %d bytes", ErrExceeded, b.module, b.Used(), b.limit)
+}
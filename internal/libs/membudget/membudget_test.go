@@ -0,0 +1,61 @@
+package membudget
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+)
+
+func TestBudget(t *testing.T) {
+	reg := obs.NewRegistry()
+	b := New(ModuleIndex, 100, reg)
+
+	b.Add(60)
+	if !b.Fits(40) || b.Fits(41) {
+		t.Errorf("Fits at 60/100: 40 = %v, 41 = %v", b.Fits(40), b.Fits(41))
+	}
+	if err := b.Reserve(50); !errors.Is(err, ErrExceeded) {
+		t.Errorf("Reserve(50) = %v, want ErrExceeded", err)
+	}
+	if b.Exceeded() {
+		t.Error("60/100 should not be exceeded")
+	}
+
+	b.Add(60)
+	if !b.Exceeded() || !b.Fits(-10) {
+		t.Errorf("at 120/100: exceeded = %v, freeing fits = %v", b.Exceeded(), b.Fits(-10))
+	}
+	if got := b.Utilization(); got != 1.2 {
+		t.Errorf("utilization = %v, want 1.2", got)
+	}
+
+	var sb strings.Builder
+	_ = reg.WriteText(&sb)
+	for _, want := range []string{
+		`selfstack_memory_budget_bytes{module="index"} 100`,
+		`selfstack_memory_used_bytes{module="index"} 120`,
+	} {
+		if !strings.Contains(sb.String(), want) {
+			t.Errorf("metrics missing %s:\n%s", want, sb.String())
+		}
+	}
+}
+
+func TestUnlimitedBudget(t *testing.T) {
+	var nilBudget *Budget
+	nilBudget.Add(1 << 40)
+	if !nilBudget.Fits(1<<40) || nilBudget.Exceeded() || nilBudget.Reserve(1) != nil {
+		t.Error("a nil budget should be unlimited")
+	}
+
+	b := New(ModuleResultCache, 0, obs.NewRegistry())
+	b.Add(1 << 40)
+	if !b.Fits(1<<40) || b.Exceeded() || b.Utilization() != 0 {
+		t.Error("a zero limit should be unlimited")
+	}
+	if b.Used() != 1<<40 {
+		t.Errorf("usage is still tracked, got %d", b.Used())
+	}
+}
@@ -0,0 +1,142 @@
+package obs
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+// DefaultModule names the level that applies to modules without an override
+const DefaultModule = "default"
+
+// levelSet holds the process's log levels: a default and per-module
+// overrides, keyed by the component passed to Logger. zerolog's global level
+// is kept at the lowest of them so no module's events are dropped early;
+// each logger's hook then discards what its own module doesn't want.
+type levelSet struct {
+	mu      sync.RWMutex
+	def     zerolog.Level
+	modules map[string]zerolog.Level
+}
+
+var levels = &levelSet{def: zerolog.InfoLevel, modules: make(map[string]zerolog.Level)}
+
+// LevelState is the current default level and per-module overrides
+type LevelState struct {
+	Default string            `json:"default"`
+	Modules map[string]string `json:"modules"`
+}
+
+// SetLevel sets the level of modules without an override
+func SetLevel(level string) error {
+	l, err := parseLevel(level)
+	if err != nil {
+		return err
+	}
+	levels.mu.Lock()
+	defer levels.mu.Unlock()
+	levels.def = l
+	levels.applyLocked()
+	return nil
+}
+
+// SetModuleLevel overrides the level of one module, e.g. "wal"; the
+// DefaultModule name sets the default instead
+func SetModuleLevel(module, level string) error {
+	if module == DefaultModule {
+		return SetLevel(level)
+	}
+	if module == "" || strings.ContainsAny(module, " \t=,") {
+		return fmt.Errorf("invalid log module %q", module)
+	}
+	l, err := parseLevel(level)
+	if err != nil {
+		return err
+	}
+	levels.mu.Lock()
+	defer levels.mu.Unlock()
+	levels.modules[module] = l
+	levels.applyLocked()
+	return nil
+}
+
+// ClearModuleLevel drops a module's override, so the default applies again
+func ClearModuleLevel(module string) {
+	levels.mu.Lock()
+	defer levels.mu.Unlock()
+	delete(levels.modules, module)
+	levels.applyLocked()
+}
+
+// Levels returns the current levels
+func Levels() LevelState {
+	levels.mu.RLock()
+	defer levels.mu.RUnlock()
+	st := LevelState{Default: levels.def.String(), Modules: make(map[string]string, len(levels.modules))}
+	for m, l := range levels.modules {
+		st.Modules[m] = l.String()
+	}
+	return st
+}
+
+// ParseModuleLevels reads comma-separated module=level pairs, e.g.
+// "wal=debug,http=info"
+func ParseModuleLevels(spec string) (map[string]string, error) {
+	out := make(map[string]string)
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		module, level, ok := strings.Cut(pair, "=")
+		module, level = strings.TrimSpace(module), strings.TrimSpace(level)
+		if !ok || module == "" {
+			return nil, fmt.Errorf("invalid log level %q: use module=level", pair)
+		}
+		if _, err := parseLevel(level); err != nil {
+			return nil, err
+		}
+		out[module] = level
+	}
+	return out, nil
+}
+
+// of returns the level of a module
+func (s *levelSet) of(module string) zerolog.Level {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if l, ok := s.modules[module]; ok {
+		return l
+	}
+	return s.def
+}
+
+// applyLocked lowers zerolog's global level to the most verbose one in use
+func (s *levelSet) applyLocked() {
+	lowest := s.def
+	for _, l := range s.modules {
+		if l < lowest {
+			lowest = l
+		}
+	}
+	zerolog.SetGlobalLevel(lowest)
+}
+
+// moduleLevel is a hook that discards events below its module's level
+type moduleLevel string
+
+func (m moduleLevel) Run(e *zerolog.Event, level zerolog.Level, _ string) {
+	if level < levels.of(string(m)) {
+		e.Discard()
+	}
+}
+
+func parseLevel(level string) (zerolog.Level, error) {
+	l, err := zerolog.ParseLevel(strings.ToLower(strings.TrimSpace(level)))
+	if err != nil || level == "" || l == zerolog.NoLevel {
+		return 0, fmt.Errorf("invalid log level %q: use trace, debug, info, warn, error, fatal, panic, or disabled", level)
+	}
+	return l, nil
+}
@@ -0,0 +1,102 @@
+package obs
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// resetLevels restores the default levels and global logger after a test
+func resetLevels(t *testing.T) {
+	saved := log.Logger
+	t.Cleanup(func() {
+		log.Logger = saved
+		levels.mu.Lock()
+		levels.def = zerolog.InfoLevel
+		levels.modules = make(map[string]zerolog.Level)
+		levels.applyLocked()
+		levels.mu.Unlock()
+	})
+}
+
+func TestModuleLevels(t *testing.T) {
+	resetLevels(t)
+	var buf bytes.Buffer
+	log.Logger = zerolog.New(&buf)
+
+	if err := SetLevel("info"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetModuleLevel("wal", "debug"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetModuleLevel("http", "warn"); err != nil {
+		t.Fatal(err)
+	}
+	walLog, httpLog, apiLog := Logger("wal"), Logger("http"), Logger("api")
+
+	walLog.Debug().Msg("wal debug")
+	httpLog.Info().Msg("http info")
+	httpLog.Warn().Msg("http warn")
+	apiLog.Debug().Msg("api debug")
+	apiLog.Info().Msg("api info")
+
+	out := buf.String()
+	for _, want := range []string{"wal debug", "http warn", "api info"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q to be logged, got:\n%s", want, out)
+		}
+	}
+	for _, unwanted := range []string{"http info", "api debug"} {
+		if strings.Contains(out, unwanted) {
+			t.Errorf("expected %q to be filtered, got:\n%s", unwanted, out)
+		}
+	}
+
+	// Changes apply to loggers that already exist
+	buf.Reset()
+	ClearModuleLevel("wal")
+	walLog.Debug().Msg("wal debug")
+	if buf.Len() != 0 {
+		t.Errorf("expected wal debug to be filtered after clearing the override, got %s", buf.String())
+	}
+	if zerolog.GlobalLevel() != zerolog.InfoLevel {
+		t.Errorf("expected the global level to rise back to info, got %v", zerolog.GlobalLevel())
+	}
+
+	st := Levels()
+	if st.Default != "info" || len(st.Modules) != 1 || st.Modules["http"] != "warn" {
+		t.Errorf("unexpected levels %+v", st)
+	}
+
+	if err := SetModuleLevel(DefaultModule, "error"); err != nil {
+		t.Fatal(err)
+	}
+	if Levels().Default != "error" {
+		t.Errorf("expected the default module name to set the default, got %+v", Levels())
+	}
+	if err := SetModuleLevel("wal", "loud"); err == nil {
+		t.Error("expected an error for an unknown level")
+	}
+	if err := SetModuleLevel("", "debug"); err == nil {
+		t.Error("expected an error for an empty module")
+	}
+}
+
+func TestParseModuleLevels(t *testing.T) {
+	got, err := ParseModuleLevels(" wal=debug, http = info ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got["wal"] != "debug" || got["http"] != "info" {
+		t.Errorf("unexpected levels %v", got)
+	}
+	for _, bad := range []string{"wal", "=debug", "wal=loud"} {
+		if _, err := ParseModuleLevels(bad); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
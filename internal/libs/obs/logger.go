@@ -2,31 +2,117 @@
 package obs
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
+// LogConfig selects where logs go and at which levels
+type LogConfig struct {
+	Level   string            // Level of modules without an override; invalid means info
+	Modules map[string]string // Per-module overrides, e.g. {"wal": "debug"}
+
+	Stderr bool // Human-readable with ENV=dev, JSON otherwise
+
+	File           string        // Append to this file as well; empty disables
+	FileMaxSize    int64         // Rotate the file at this many bytes (0 = never)
+	FileMaxAge     time.Duration // Rotate the file after this long (0 = never)
+	FileMaxBackups int           // Rotated files to keep (0 = all)
+
+	Syslog    string // local, udp://host:port, or tcp://host:port; empty disables
+	SyslogTag string
+}
+
 // InitLogger initializes the global logger
 func InitLogger(level string) {
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
 
 	// Parse log level
-	logLevel, err := zerolog.ParseLevel(level)
-	if err != nil {
-		logLevel = zerolog.InfoLevel
+	if err := SetLevel(level); err != nil {
+		_ = SetLevel("info")
 	}
 
-	zerolog.SetGlobalLevel(logLevel)
-
 	// Pretty print in development
 	if os.Getenv("ENV") == "dev" {
 		log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
 	}
 }
 
-// Logger returns a new logger with the given component name
+// SetupLogging sends the global logger to the configured sinks and sets
+// the levels. The latest lines are also kept for RecentLogs. The returned
+// closer flushes and closes the file and syslog sinks.
+func SetupLogging(cfg LogConfig) (io.Closer, error) {
+	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
+	if err := SetLevel(cfg.Level); err != nil {
+		_ = SetLevel("info") // As in InitLogger
+	}
+	for module, level := range cfg.Modules {
+		if err := SetModuleLevel(module, level); err != nil {
+			return nil, err
+		}
+	}
+
+	var (
+		writers []io.Writer
+		closers closers
+	)
+	if cfg.Stderr {
+		if os.Getenv("ENV") == "dev" {
+			writers = append(writers, zerolog.ConsoleWriter{Out: os.Stderr})
+		} else {
+			writers = append(writers, os.Stderr)
+		}
+	}
+	if cfg.File != "" {
+		f, err := OpenRotatingFile(cfg.File, cfg.FileMaxSize, cfg.FileMaxAge, cfg.FileMaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		writers = append(writers, f)
+		closers = append(closers, f)
+	}
+	if cfg.Syslog != "" {
+		w, c, err := openSyslog(cfg.Syslog, cfg.SyslogTag)
+		if err != nil {
+			_ = closers.Close()
+			return nil, err
+		}
+		writers = append(writers, w)
+		closers = append(closers, c)
+	}
+	if len(writers) == 0 {
+		return nil, fmt.Errorf("no log sinks enabled")
+	}
+	writers = append(writers, recentLogs)
+
+	log.Logger = zerolog.New(zerolog.MultiLevelWriter(writers...)).With().Timestamp().Logger()
+	return closers, nil
+}
+
+// Logger returns a new logger with the given component name. Its events
+// are filtered by the component's level (see SetModuleLevel), which can
+// change at runtime.
 func Logger(component string) zerolog.Logger {
-	return log.With().Str("component", component).Logger()
+	return log.With().Str("component", component).Logger().Hook(moduleLevel(component))
+}
+
+// SetInstance adds the deployment's instance ID to every log line of the
+// loggers created after the call
+func SetInstance(id string) {
+	log.Logger = log.With().Str("instance", id).Logger()
+}
+
+type closers []io.Closer
+
+func (cs closers) Close() error {
+	var errs []error
+	for _, c := range cs {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
 }
@@ -1,9 +1,12 @@
 package obs
 
 import (
+	"bytes"
+	"strings"
 	"testing"
 
 	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
 )
 
 func TestInitLogger(t *testing.T) {
@@ -37,3 +40,18 @@ func TestLogger(t *testing.T) {
 		t.Error("logger should not be disabled")
 	}
 }
+
+func TestSetInstance(t *testing.T) {
+	saved := log.Logger
+	defer func() { log.Logger = saved }()
+
+	var buf bytes.Buffer
+	log.Logger = zerolog.New(&buf)
+	SetInstance("abc")
+	logger := Logger("test-component")
+	logger.Info().Msg("hello")
+
+	if !strings.Contains(buf.String(), `"instance":"abc"`) {
+		t.Errorf("expected the instance ID in the log line, got %s", buf.String())
+	}
+}
@@ -0,0 +1,333 @@
+package obs
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Counter is a monotonically increasing value
+type Counter struct {
+	v atomic.Uint64
+}
+
+// Inc adds one to the counter
+func (c *Counter) Inc() { c.v.Add(1) }
+
+// Add adds n to the counter
+func (c *Counter) Add(n uint64) { c.v.Add(n) }
+
+// Value returns the current count
+func (c *Counter) Value() uint64 { return c.v.Load() }
+
+// CounterVec is a family of counters partitioned by one label
+type CounterVec struct {
+	name  string
+	help  string
+	label string
+
+	mu       sync.Mutex
+	counters map[string]*Counter
+}
+
+// WithLabel returns the counter for the given label value, creating it if needed
+func (v *CounterVec) WithLabel(value string) *Counter {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	c, ok := v.counters[value]
+	if !ok {
+		c = &Counter{}
+		v.counters[value] = c
+	}
+	return c
+}
+
+// Gauge is a value that can go up and down, like bytes in use
+type Gauge struct {
+	v atomic.Int64
+}
+
+// Set sets the gauge to n
+func (g *Gauge) Set(n int64) { g.v.Store(n) }
+
+// Add adds n, which may be negative, to the gauge
+func (g *Gauge) Add(n int64) { g.v.Add(n) }
+
+// Value returns the current value
+func (g *Gauge) Value() int64 { return g.v.Load() }
+
+// GaugeVec is a family of gauges partitioned by one label
+type GaugeVec struct {
+	name  string
+	help  string
+	label string
+
+	mu     sync.Mutex
+	gauges map[string]*Gauge
+}
+
+// WithLabel returns the gauge for the given label value, creating it if needed
+func (v *GaugeVec) WithLabel(value string) *Gauge {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	g, ok := v.gauges[value]
+	if !ok {
+		g = &Gauge{}
+		v.gauges[value] = g
+	}
+	return g
+}
+
+// DefaultLatencyBuckets are histogram bounds, in seconds, for latencies from
+// 100µs to 10s
+var DefaultLatencyBuckets = []float64{0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Histogram counts observations into buckets by upper bound, like fsync
+// latencies
+type Histogram struct {
+	bounds  []float64       // Sorted upper bounds
+	buckets []atomic.Uint64 // Per bound, not cumulative; the last is +Inf
+	count   atomic.Uint64
+	sum     atomic.Uint64 // float64 bits
+}
+
+// Observe records v
+func (h *Histogram) Observe(v float64) {
+	h.buckets[sort.SearchFloat64s(h.bounds, v)].Add(1)
+	h.count.Add(1)
+	for {
+		old := h.sum.Load()
+		if h.sum.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+// ObserveDuration records d in seconds
+func (h *Histogram) ObserveDuration(d time.Duration) { h.Observe(d.Seconds()) }
+
+// Count returns the number of observations
+func (h *Histogram) Count() uint64 { return h.count.Load() }
+
+// Sum returns the total of the observations
+func (h *Histogram) Sum() float64 { return math.Float64frombits(h.sum.Load()) }
+
+// HistogramVec is a family of histograms partitioned by one label
+type HistogramVec struct {
+	name   string
+	help   string
+	label  string
+	bounds []float64
+
+	mu    sync.Mutex
+	hists map[string]*Histogram
+}
+
+// WithLabel returns the histogram for the given label value, creating it if
+// needed
+func (v *HistogramVec) WithLabel(value string) *Histogram {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	h, ok := v.hists[value]
+	if !ok {
+		h = &Histogram{bounds: v.bounds, buckets: make([]atomic.Uint64, len(v.bounds)+1)}
+		v.hists[value] = h
+	}
+	return h
+}
+
+// Registry holds metrics and renders them in the Prometheus text format
+type Registry struct {
+	mu          sync.Mutex
+	vecs        map[string]*CounterVec
+	gauges      map[string]*GaugeVec
+	hists       map[string]*HistogramVec
+	constLabels string // Rendered constant labels, e.g. `instance="..."`; empty for none
+}
+
+// DefaultRegistry is the process-wide registry served at /metrics
+var DefaultRegistry = NewRegistry()
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{vecs: make(map[string]*CounterVec), gauges: make(map[string]*GaugeVec), hists: make(map[string]*HistogramVec)}
+}
+
+// CounterVec registers a labeled counter family. Registering the same name
+// again returns the existing family.
+func (r *Registry) CounterVec(name, help, label string) *CounterVec {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if v, ok := r.vecs[name]; ok {
+		return v
+	}
+	v := &CounterVec{name: name, help: help, label: label, counters: make(map[string]*Counter)}
+	r.vecs[name] = v
+	return v
+}
+
+// GaugeVec registers a labeled gauge family. Registering the same name
+// again returns the existing family.
+func (r *Registry) GaugeVec(name, help, label string) *GaugeVec {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if v, ok := r.gauges[name]; ok {
+		return v
+	}
+	v := &GaugeVec{name: name, help: help, label: label, gauges: make(map[string]*Gauge)}
+	r.gauges[name] = v
+	return v
+}
+
+// HistogramVec registers a labeled histogram family with the given bucket
+// upper bounds (DefaultLatencyBuckets if none). Registering the same name
+// again returns the existing family.
+func (r *Registry) HistogramVec(name, help, label string, buckets []float64) *HistogramVec {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if v, ok := r.hists[name]; ok {
+		return v
+	}
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	bounds := append([]float64(nil), buckets...)
+	sort.Float64s(bounds)
+	v := &HistogramVec{name: name, help: help, label: label, bounds: bounds, hists: make(map[string]*Histogram)}
+	r.hists[name] = v
+	return v
+}
+
+// SetConstLabel adds a label with a fixed value to every series, e.g. the
+// instance ID, so series from several instances can be told apart
+func (r *Registry) SetConstLabel(name, value string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.constLabels != "" {
+		r.constLabels += ","
+	}
+	r.constLabels += fmt.Sprintf("%s=%q", name, value)
+}
+
+// WriteText writes all metrics in the Prometheus text exposition format
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.vecs)+len(r.gauges)+len(r.hists))
+	for name := range r.vecs {
+		names = append(names, name)
+	}
+	for name := range r.gauges {
+		names = append(names, name)
+	}
+	for name := range r.hists {
+		names = append(names, name)
+	}
+	constLabels := r.constLabels
+	r.mu.Unlock()
+	sort.Strings(names)
+	if constLabels != "" {
+		constLabels += ","
+	}
+
+	for _, name := range names {
+		r.mu.Lock()
+		counters, gauges, hists := r.vecs[name], r.gauges[name], r.hists[name]
+		r.mu.Unlock()
+
+		var err error
+		switch {
+		case hists != nil:
+			err = writeHistograms(w, hists, constLabels)
+		case counters != nil:
+			counters.mu.Lock()
+			values := make(map[string]string, len(counters.counters))
+			for value, c := range counters.counters {
+				values[value] = fmt.Sprint(c.Value())
+			}
+			counters.mu.Unlock()
+			err = writeFamily(w, counters.name, counters.help, "counter", constLabels+counters.label, values)
+		default:
+			gauges.mu.Lock()
+			values := make(map[string]string, len(gauges.gauges))
+			for value, g := range gauges.gauges {
+				values[value] = fmt.Sprint(g.Value())
+			}
+			gauges.mu.Unlock()
+			err = writeFamily(w, gauges.name, gauges.help, "gauge", constLabels+gauges.label, values)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFamily writes one metric family; label is prefixed with the rendered
+// constant labels
+func writeFamily(w io.Writer, name, help, typ, label string, values map[string]string) error {
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ); err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(values))
+	for value := range values {
+		keys = append(keys, value)
+	}
+	sort.Strings(keys)
+	for _, value := range keys {
+		if _, err := fmt.Fprintf(w, "%s{%s=%q} %s\n", name, label, value, values[value]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeHistograms writes a histogram family as cumulative _bucket series
+// plus _sum and _count
+func writeHistograms(w io.Writer, v *HistogramVec, constLabels string) error {
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", v.name, v.help, v.name); err != nil {
+		return err
+	}
+	v.mu.Lock()
+	hists := make(map[string]*Histogram, len(v.hists))
+	keys := make([]string, 0, len(v.hists))
+	for value, h := range v.hists {
+		hists[value] = h
+		keys = append(keys, value)
+	}
+	v.mu.Unlock()
+	sort.Strings(keys)
+
+	for _, value := range keys {
+		h := hists[value]
+		labels := fmt.Sprintf("%s%s=%q", constLabels, v.label, value)
+		var cumulative uint64
+		for i := range h.buckets {
+			cumulative += h.buckets[i].Load()
+			le := "+Inf"
+			if i < len(h.bounds) {
+				le = strconv.FormatFloat(h.bounds[i], 'g', -1, 64)
+			}
+			if _, err := fmt.Fprintf(w, "%s_bucket{%s,le=%q} %d\n", v.name, labels, le, cumulative); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s_sum{%s} %s\n%s_count{%s} %d\n", v.name, labels, strconv.FormatFloat(h.Sum(), 'g', -1, 64), v.name, labels, h.Count()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handler serves the registry at a /metrics endpoint
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		_ = r.WriteText(w)
+	})
+}
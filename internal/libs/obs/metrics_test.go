@@ -0,0 +1,102 @@
+package obs
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegistryWriteText(t *testing.T) {
+	reg := NewRegistry()
+	ops := reg.CounterVec("selfstack_test_total", "Test counter", "op")
+	ops.WithLabel("search").Inc()
+	ops.WithLabel("search").Add(2)
+	ops.WithLabel("run").Inc()
+
+	if again := reg.CounterVec("selfstack_test_total", "ignored", "op"); again != ops {
+		t.Error("registering the same name should return the existing family")
+	}
+
+	var sb strings.Builder
+	if err := reg.WriteText(&sb); err != nil {
+		t.Fatalf("WriteText failed: %v", err)
+	}
+
+	want := `# HELP selfstack_test_total Test counter
+# TYPE selfstack_test_total counter
+selfstack_test_total{op="run"} 1
+selfstack_test_total{op="search"} 3
+`
+	if sb.String() != want {
+		t.Errorf("unexpected output:\n%s\nwant:\n%s", sb.String(), want)
+	}
+}
+
+func TestRegistryConstLabels(t *testing.T) {
+	reg := NewRegistry()
+	reg.SetConstLabel("instance", "abc")
+	reg.CounterVec("selfstack_test_total", "Test counter", "op").WithLabel("search").Inc()
+
+	var sb strings.Builder
+	if err := reg.WriteText(&sb); err != nil {
+		t.Fatalf("WriteText failed: %v", err)
+	}
+	if !strings.Contains(sb.String(), `selfstack_test_total{instance="abc",op="search"} 1`) {
+		t.Errorf("expected the instance label on every series, got:\n%s", sb.String())
+	}
+}
+
+func TestRegistryGauges(t *testing.T) {
+	reg := NewRegistry()
+	used := reg.GaugeVec("selfstack_test_bytes", "Test gauge", "module")
+	used.WithLabel("index").Set(100)
+	used.WithLabel("index").Add(-40)
+	reg.CounterVec("selfstack_a_total", "Test counter", "op").WithLabel("search").Inc()
+
+	var sb strings.Builder
+	if err := reg.WriteText(&sb); err != nil {
+		t.Fatalf("WriteText failed: %v", err)
+	}
+	want := `# HELP selfstack_a_total Test counter
+# TYPE selfstack_a_total counter
+selfstack_a_total{op="search"} 1
+# HELP selfstack_test_bytes Test gauge
+# TYPE selfstack_test_bytes gauge
+selfstack_test_bytes{module="index"} 60
+`
+	if sb.String() != want {
+		t.Errorf("unexpected output:\n%s\nwant:\n%s", sb.String(), want)
+	}
+}
+
+func TestRegistryHistograms(t *testing.T) {
+	reg := NewRegistry()
+	sync := reg.HistogramVec("selfstack_test_seconds", "Test histogram", "reason", []float64{1, 0.1})
+	h := sync.WithLabel("interval")
+	h.Observe(0.05)
+	h.Observe(0.1)
+	h.Observe(0.5)
+	h.Observe(3)
+
+	if again := reg.HistogramVec("selfstack_test_seconds", "ignored", "reason", nil); again != sync {
+		t.Error("registering the same name should return the existing family")
+	}
+	if h.Count() != 4 || h.Sum() != 3.65 {
+		t.Errorf("expected 4 observations summing to 3.65, got %d and %v", h.Count(), h.Sum())
+	}
+
+	var sb strings.Builder
+	if err := reg.WriteText(&sb); err != nil {
+		t.Fatalf("WriteText failed: %v", err)
+	}
+	want := `# HELP selfstack_test_seconds Test histogram
+# TYPE selfstack_test_seconds histogram
+selfstack_test_seconds_bucket{reason="interval",le="0.1"} 2
+selfstack_test_seconds_bucket{reason="interval",le="1"} 3
+selfstack_test_seconds_bucket{reason="interval",le="+Inf"} 4
+selfstack_test_seconds_sum{reason="interval"} 3.65
+selfstack_test_seconds_count{reason="interval"} 4
+`
+	if sb.String() != want {
+		t.Errorf("unexpected output:\n%s\nwant:\n%s", sb.String(), want)
+	}
+}
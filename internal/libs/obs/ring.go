@@ -0,0 +1,50 @@
+package obs
+
+import "sync"
+
+// RecentLogSize is how many log lines RecentLogs keeps
+const RecentLogSize = 1000
+
+// recentLogs is a log sink that SetupLogging always adds, so diagnostic
+// bundles can include what was logged before a panic
+var recentLogs = newLogRing(RecentLogSize)
+
+// RecentLogs returns the latest log lines written through the sinks set up
+// by SetupLogging, oldest first
+func RecentLogs() []string {
+	return recentLogs.lines()
+}
+
+// logRing keeps the last lines written to it
+type logRing struct {
+	mu   sync.Mutex
+	buf  []string
+	next int // Index the next line goes to
+	full bool
+}
+
+func newLogRing(size int) *logRing {
+	return &logRing{buf: make([]string, size)}
+}
+
+// Write stores p as one line; zerolog writes one event per call and reuses
+// p, so it is copied
+func (r *logRing) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.buf[r.next] = string(p)
+	r.next = (r.next + 1) % len(r.buf)
+	if r.next == 0 {
+		r.full = true
+	}
+	return len(p), nil
+}
+
+func (r *logRing) lines() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.full {
+		return append([]string{}, r.buf[:r.next]...)
+	}
+	return append(append([]string{}, r.buf[r.next:]...), r.buf[:r.next]...)
+}
@@ -0,0 +1,28 @@
+package obs
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestLogRing(t *testing.T) {
+	r := newLogRing(3)
+	if got := r.lines(); len(got) != 0 {
+		t.Fatalf("empty ring returned %v", got)
+	}
+
+	buf := []byte("a")
+	_, _ = r.Write(buf)
+	buf[0] = 'x' // zerolog reuses its buffer
+	if got := r.lines(); !reflect.DeepEqual(got, []string{"a"}) {
+		t.Fatalf("lines = %v, want [a]", got)
+	}
+
+	for i := 0; i < 4; i++ {
+		_, _ = fmt.Fprintf(r, "%d", i)
+	}
+	if got := r.lines(); !reflect.DeepEqual(got, []string{"1", "2", "3"}) {
+		t.Fatalf("lines = %v, want the last 3 oldest first", got)
+	}
+}
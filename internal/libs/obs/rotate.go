@@ -0,0 +1,133 @@
+package obs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RotatingFile appends log lines to a file and rotates it once it reaches
+// a size or has been written to for a while. Rotated files are renamed
+// with a timestamp suffix (app.log.20240301-140500.000) and the oldest are
+// deleted beyond the backup limit.
+type RotatingFile struct {
+	path       string
+	maxSize    int64         // 0 disables size rotation
+	maxAge     time.Duration // 0 disables age rotation
+	maxBackups int           // 0 keeps every rotated file
+	now        func() time.Time
+
+	mu      sync.Mutex
+	file    *os.File
+	size    int64
+	started time.Time // First write to the current file
+}
+
+// OpenRotatingFile opens (or creates) path for appending
+func OpenRotatingFile(path string, maxSize int64, maxAge time.Duration, maxBackups int) (*RotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+	f := &RotatingFile{path: path, maxSize: maxSize, maxAge: maxAge, maxBackups: maxBackups, now: time.Now}
+	if err := f.openLocked(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Write appends p, rotating first if p would take the file past its size
+// or the file is older than its age limit
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	now := f.now()
+	if f.size > 0 && f.due(now, int64(len(p))) {
+		if err := f.rotateLocked(now); err != nil {
+			return 0, err
+		}
+	}
+	if f.size == 0 {
+		f.started = now
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Close closes the current file
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+func (f *RotatingFile) due(now time.Time, n int64) bool {
+	if f.maxSize > 0 && f.size+n > f.maxSize {
+		return true
+	}
+	return f.maxAge > 0 && now.Sub(f.started) >= f.maxAge
+}
+
+func (f *RotatingFile) openLocked() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to stat log file: %w", err)
+	}
+	f.file, f.size = file, info.Size()
+	// A file left by an earlier run counts from its last write, so a stale
+	// one is rotated on the first write
+	f.started = info.ModTime()
+	return nil
+}
+
+func (f *RotatingFile) rotateLocked(now time.Time) error {
+	if err := f.file.Close(); err != nil {
+		return fmt.Errorf("failed to close log file: %w", err)
+	}
+	f.file = nil
+	backup := f.path + "." + now.Format("20060102-150405.000")
+	if err := os.Rename(f.path, backup); err != nil {
+		return fmt.Errorf("failed to rotate log file: %w", err)
+	}
+	if err := f.openLocked(); err != nil {
+		return err
+	}
+	return f.pruneLocked()
+}
+
+// pruneLocked deletes the oldest rotated files beyond maxBackups
+func (f *RotatingFile) pruneLocked() error {
+	if f.maxBackups <= 0 {
+		return nil
+	}
+	backups, err := filepath.Glob(f.path + ".[0-9]*")
+	if err != nil {
+		return err
+	}
+	// Timestamp suffixes sort chronologically
+	sort.Strings(backups)
+	for len(backups) > f.maxBackups {
+		if err := os.Remove(backups[0]); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to delete old log file: %w", err)
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package obs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRotatingFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "api.log")
+	f, err := OpenRotatingFile(path, 10, time.Hour, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+	now := time.Date(2024, 3, 1, 14, 5, 0, 0, time.UTC)
+	f.now = func() time.Time { return now }
+
+	write := func(s string) {
+		t.Helper()
+		if _, err := f.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(time.Second)
+	}
+
+	write("12345\n")
+	write("1234\n") // Would pass 10 bytes, so the file is rotated first
+	write("abc\n")
+	backups, _ := filepath.Glob(path + ".*")
+	if len(backups) != 1 {
+		t.Fatalf("expected 1 rotated file after exceeding the size, got %v", backups)
+	}
+
+	now = now.Add(time.Hour)
+	write("d\n") // Age rotation
+	now = now.Add(time.Hour)
+	write("e\n")
+	backups, _ = filepath.Glob(path + ".*")
+	if len(backups) != 2 {
+		t.Errorf("expected rotated files to be pruned to 2, got %v", backups)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "e\n" {
+		t.Errorf("expected the current file to hold the last write, got %q", data)
+	}
+}
@@ -0,0 +1,34 @@
+//go:build !windows && !plan9
+
+package obs
+
+import (
+	"fmt"
+	"io"
+	"log/syslog"
+	"net/url"
+
+	"github.com/rs/zerolog"
+)
+
+// openSyslog connects to the local syslog daemon (addr "local", which
+// journald also reads) or a remote one (udp://host:514, tcp://host:514)
+func openSyslog(addr, tag string) (zerolog.LevelWriter, io.Closer, error) {
+	var (
+		w   *syslog.Writer
+		err error
+	)
+	if addr == "local" {
+		w, err = syslog.New(syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	} else {
+		u, perr := url.Parse(addr)
+		if perr != nil || (u.Scheme != "udp" && u.Scheme != "tcp") || u.Host == "" {
+			return nil, nil, fmt.Errorf("invalid syslog address %q: use local, udp://host:port, or tcp://host:port", addr)
+		}
+		w, err = syslog.Dial(u.Scheme, u.Host, syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+	return zerolog.SyslogLevelWriter(w), w, nil
+}
@@ -0,0 +1,14 @@
+//go:build windows || plan9
+
+package obs
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/rs/zerolog"
+)
+
+func openSyslog(string, string) (zerolog.LevelWriter, io.Closer, error) {
+	return nil, nil, fmt.Errorf("syslog is not supported on this platform")
+}
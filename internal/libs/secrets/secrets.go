@@ -0,0 +1,130 @@
+// Package secrets resolves references to secrets kept in a secret manager,
+// so secret settings like DATABASE_URL don't need to be set in plain text.
+// A reference is SCHEME:PATH#KEY, e.g. vault:secret/data/selfstack#db_url
+// or awssm:prod/selfstack#db_url; KEY picks a field of a secret holding
+// several. Vault and AWS Secrets Manager are registered by default, and
+// Register adds others.
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Resolver fetches secrets from a secret manager
+type Resolver interface {
+	// Resolve returns the secret at path, or its field key when key isn't empty
+	Resolve(ctx context.Context, path, key string) (string, error)
+}
+
+// ResolverFunc adapts a function to a Resolver
+type ResolverFunc func(ctx context.Context, path, key string) (string, error)
+
+// Resolve calls f
+func (f ResolverFunc) Resolve(ctx context.Context, path, key string) (string, error) {
+	return f(ctx, path, key)
+}
+
+var (
+	mu        sync.RWMutex
+	resolvers = map[string]Resolver{
+		"vault": &Vault{},
+		"awssm": &AWSSecretsManager{},
+	}
+)
+
+// Register resolves references with scheme using r, replacing any resolver
+// registered for it; a nil r unregisters it
+func Register(scheme string, r Resolver) {
+	mu.Lock()
+	defer mu.Unlock()
+	if r == nil {
+		delete(resolvers, scheme)
+		return
+	}
+	resolvers[scheme] = r
+}
+
+// Schemes returns the registered schemes, sorted
+func Schemes() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	out := make([]string, 0, len(resolvers))
+	for scheme := range resolvers {
+		out = append(out, scheme)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// IsReference reports whether value is a reference to a registered scheme
+func IsReference(value string) bool {
+	_, ok := lookup(value)
+	return ok
+}
+
+// Resolve returns the secret value references, or value itself when it
+// isn't a reference, like a plain postgres:// URL
+func Resolve(ctx context.Context, value string) (string, error) {
+	r, ok := lookup(value)
+	if !ok {
+		return value, nil
+	}
+	scheme, ref, _ := strings.Cut(value, ":")
+	path, key, _ := strings.Cut(ref, "#")
+	if path == "" {
+		return "", fmt.Errorf("invalid %s reference %q: want %s:PATH#KEY", scheme, value, scheme)
+	}
+	secret, err := r.Resolve(ctx, path, key)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s:%s: %w", scheme, path, err)
+	}
+	return secret, nil
+}
+
+// lookup returns the resolver of value's scheme
+func lookup(value string) (Resolver, bool) {
+	scheme, rest, ok := strings.Cut(value, ":")
+	// A key=value connection string can hold a colon, e.g. in its password
+	if !ok || scheme == "" || rest == "" || strings.ContainsAny(scheme, " =/") {
+		return nil, false
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	r, ok := resolvers[scheme]
+	return r, ok
+}
+
+// field picks key from a secret's fields. Without a key, a secret with a
+// single field is that field's value.
+func field(fields map[string]any, key string) (string, error) {
+	if key == "" {
+		if len(fields) != 1 {
+			names := make([]string, 0, len(fields))
+			for name := range fields {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return "", fmt.Errorf("secret has fields %s; pick one with #KEY", strings.Join(names, ", "))
+		}
+		for name := range fields {
+			key = name
+		}
+	}
+	v, ok := fields[key]
+	if !ok {
+		return "", fmt.Errorf("secret has no field %q", key)
+	}
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode field %q: %w", key, err)
+	}
+	return string(data), nil
+}
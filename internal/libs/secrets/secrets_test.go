@@ -0,0 +1,141 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResolvePassesThroughValues(t *testing.T) {
+	for _, v := range []string{
+		"",
+		"postgres://u:p@db:5432/app",
+		"host=db user=u password=a:b",
+		"https://hooks.example.com/ingest",
+	} {
+		got, err := Resolve(context.Background(), v)
+		if err != nil || got != v {
+			t.Errorf("Resolve(%q) = %q, %v; want it unchanged", v, got, err)
+		}
+	}
+}
+
+func TestResolveRegistered(t *testing.T) {
+	var gotPath, gotKey string
+	Register("test", ResolverFunc(func(_ context.Context, path, key string) (string, error) {
+		gotPath, gotKey = path, key
+		return "s3cret", nil
+	}))
+	defer Register("test", nil)
+
+	got, err := Resolve(context.Background(), "test:app/db#password")
+	if err != nil || got != "s3cret" {
+		t.Fatalf("Resolve = %q, %v", got, err)
+	}
+	if gotPath != "app/db" || gotKey != "password" {
+		t.Fatalf("resolver got path %q key %q", gotPath, gotKey)
+	}
+	if _, err := Resolve(context.Background(), "test:#password"); err == nil {
+		t.Fatal("reference without a path resolved")
+	}
+}
+
+func TestVault(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "tok" {
+			http.Error(w, "denied", http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/selfstack": // KV v2
+			_, _ = w.Write([]byte(`{"data":{"data":{"db_url":"postgres://u:p@db/app","port":5432},"metadata":{"version":3}}}`))
+		case "/v1/kv/single": // KV v1
+			_, _ = w.Write([]byte(`{"data":{"value":"only"}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	v := &Vault{Addr: srv.URL, Token: "tok", Client: srv.Client()}
+
+	for _, tc := range []struct {
+		path, key, want string
+	}{
+		{"secret/data/selfstack", "db_url", "postgres://u:p@db/app"},
+		{"secret/data/selfstack", "port", "5432"},
+		{"kv/single", "", "only"},
+	} {
+		got, err := v.Resolve(context.Background(), tc.path, tc.key)
+		if err != nil || got != tc.want {
+			t.Errorf("Resolve(%s#%s) = %q, %v; want %q", tc.path, tc.key, got, err, tc.want)
+		}
+	}
+	if _, err := v.Resolve(context.Background(), "secret/data/selfstack", ""); err == nil || !strings.Contains(err.Error(), "db_url, port") {
+		t.Errorf("secret with several fields and no key: err = %v", err)
+	}
+	if _, err := v.Resolve(context.Background(), "kv/missing", ""); err == nil {
+		t.Error("missing secret resolved")
+	}
+}
+
+func TestAWSSecretsManager(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") || !strings.Contains(auth, "/eu-west-1/secretsmanager/aws4_request") {
+			http.Error(w, `{"__type":"UnrecognizedClientException"}`, http.StatusBadRequest)
+			return
+		}
+		if r.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" {
+			http.Error(w, "bad target", http.StatusBadRequest)
+			return
+		}
+		var req struct{ SecretId string }
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req.SecretId != "prod/selfstack" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"__type":"ResourceNotFoundException","message":"Secrets Manager can't find the specified secret."}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"Name":"prod/selfstack","SecretString":"{\"db_url\":\"postgres://u:p@db/app\"}"}`))
+	}))
+	defer srv.Close()
+	a := &AWSSecretsManager{Region: "eu-west-1", Endpoint: srv.URL, Client: srv.Client()}
+
+	got, err := a.Resolve(context.Background(), "prod/selfstack", "db_url")
+	if err != nil || got != "postgres://u:p@db/app" {
+		t.Fatalf("Resolve = %q, %v", got, err)
+	}
+	got, err = a.Resolve(context.Background(), "prod/selfstack", "")
+	if err != nil || got != `{"db_url":"postgres://u:p@db/app"}` {
+		t.Fatalf("Resolve without a key = %q, %v", got, err)
+	}
+	if _, err := a.Resolve(context.Background(), "prod/other", ""); err == nil || !strings.Contains(err.Error(), "ResourceNotFoundException") {
+		t.Fatalf("missing secret: err = %v", err)
+	}
+}
+
+// TestSignV4 checks the signer against the example in the AWS Signature
+// Version 4 documentation
+func TestSignV4(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	creds := awsCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	signV4(req, nil, creds, "us-east-1", "iam", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, " +
+		"SignedHeaders=content-type;host;x-amz-date, " +
+		"Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Fatalf("Authorization =\n%s\nwant\n%s", got, want)
+	}
+}
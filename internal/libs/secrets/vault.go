@@ -0,0 +1,87 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/dsjohal14/selfstack/internal/libs/httpclient"
+)
+
+// Vault reads secrets from HashiCorp Vault's KV engine, version 1 or 2.
+// The path is the API path under /v1, e.g. secret/data/selfstack for KV v2.
+type Vault struct {
+	Addr      string // Default: VAULT_ADDR
+	Token     string // Default: VAULT_TOKEN
+	Namespace string // Default: VAULT_NAMESPACE (Vault Enterprise)
+	Client    *http.Client
+}
+
+// Resolve reads the secret at path
+func (v *Vault) Resolve(ctx context.Context, path, key string) (string, error) {
+	addr := firstNonEmpty(v.Addr, os.Getenv("VAULT_ADDR"))
+	token := firstNonEmpty(v.Token, os.Getenv("VAULT_TOKEN"))
+	if addr == "" || token == "" {
+		return "", fmt.Errorf("vault needs VAULT_ADDR and VAULT_TOKEN")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(addr, "/")+"/v1/"+strings.TrimLeft(path, "/"), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if ns := firstNonEmpty(v.Namespace, os.Getenv("VAULT_NAMESPACE")); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+
+	resp, err := clientOrDefault(v.Client).Do(req)
+	if err != nil {
+		return "", fmt.Errorf("vault request failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponse))
+	if err != nil {
+		return "", fmt.Errorf("failed to read vault response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault returned %s", resp.Status)
+	}
+
+	var secret struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.Unmarshal(body, &secret); err != nil {
+		return "", fmt.Errorf("invalid vault response: %w", err)
+	}
+	fields := secret.Data
+	// KV v2 nests the fields under data.data, beside data.metadata
+	if nested, ok := fields["data"].(map[string]any); ok {
+		if _, ok := fields["metadata"]; ok {
+			fields = nested
+		}
+	}
+	return field(fields, key)
+}
+
+// maxResponse caps the secret manager response read
+const maxResponse = 1 << 20
+
+func clientOrDefault(c *http.Client) *http.Client {
+	if c != nil {
+		return c
+	}
+	return httpclient.New()
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,187 @@
+// Package slo tracks latency objectives, like 99% of searches under 200ms,
+// over a rolling window, and the rate the error budget is being burned at,
+// so operators can alert on budget burn without external tooling.
+package slo
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultWindow is the window attainment is measured over
+const DefaultWindow = 24 * time.Hour
+
+// bucketWidth is the resolution of the window
+const bucketWidth = time.Minute
+
+// BurnWindows are the windows burn rates are reported over: a fast burn
+// shows in the short one first, a slow one only in the long one
+var BurnWindows = []time.Duration{5 * time.Minute, time.Hour}
+
+// Objective is a latency objective: Target of the ops named Op must finish
+// within Threshold
+type Objective struct {
+	Op        string
+	Threshold time.Duration
+	Target    float64 // e.g. 0.99
+}
+
+// String writes o the way Parse reads it, e.g. search:200ms:99
+func (o Objective) String() string {
+	return fmt.Sprintf("%s:%s:%s", o.Op, o.Threshold, strconv.FormatFloat(math.Round(o.Target*1e6)/1e4, 'f', -1, 64))
+}
+
+// Parse reads comma-separated objectives written as OP:THRESHOLD:PERCENT,
+// e.g. search:200ms:99,run:2s:95
+func Parse(s string) ([]Objective, error) {
+	var out []Objective
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.Split(entry, ":")
+		if len(parts) != 3 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid objective %q: want OP:THRESHOLD:PERCENT, e.g. search:200ms:99", entry)
+		}
+		threshold, err := time.ParseDuration(parts[1])
+		if err != nil || threshold <= 0 {
+			return nil, fmt.Errorf("invalid objective %q: threshold must be a positive duration", entry)
+		}
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(parts[2], "%"), 64)
+		if err != nil || percent <= 0 || percent >= 100 {
+			return nil, fmt.Errorf("invalid objective %q: percent must be between 0 and 100, exclusive", entry)
+		}
+		out = append(out, Objective{Op: parts[0], Threshold: threshold, Target: percent / 100})
+	}
+	return out, nil
+}
+
+// bucket counts the ops observed in a minute. good[i] counts the ones
+// meeting objective i.
+type bucket struct {
+	minute int64 // Unix minute the counts belong to
+	total  map[string]uint64
+	good   []uint64
+}
+
+// Tracker measures objectives over a rolling window
+type Tracker struct {
+	objectives []Objective
+	window     time.Duration
+	now        func() time.Time
+
+	mu      sync.Mutex
+	buckets []bucket // Ring of one bucket per minute of the window
+}
+
+// NewTracker tracks objectives over window (DefaultWindow if <= 0)
+func NewTracker(objectives []Objective, window time.Duration) *Tracker {
+	if window <= 0 {
+		window = DefaultWindow
+	}
+	n := int(window / bucketWidth)
+	for _, w := range BurnWindows {
+		n = max(n, int(w/bucketWidth))
+	}
+	return &Tracker{
+		objectives: objectives,
+		window:     window,
+		now:        time.Now,
+		buckets:    make([]bucket, n),
+	}
+}
+
+// Observe records an op that took d
+func (t *Tracker) Observe(op string, d time.Duration) {
+	minute := t.now().Unix() / int64(bucketWidth/time.Second)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b := &t.buckets[minute%int64(len(t.buckets))]
+	if b.minute != minute || b.total == nil {
+		*b = bucket{minute: minute, total: make(map[string]uint64), good: make([]uint64, len(t.objectives))}
+	}
+	b.total[op]++
+	for i, o := range t.objectives {
+		if o.Op == op && d <= o.Threshold {
+			b.good[i]++
+		}
+	}
+}
+
+// Status is how an objective is doing
+type Status struct {
+	Objective   string             `json:"objective"` // e.g. search:200ms:99
+	Op          string             `json:"op"`
+	ThresholdMS float64            `json:"threshold_ms"`
+	Target      float64            `json:"target"`
+	Window      string             `json:"window"`
+	Total       uint64             `json:"total"` // Ops in the window
+	Good        uint64             `json:"good"`  // Of those, within the threshold
+	Attainment  float64            `json:"attainment"`
+	Budget      float64            `json:"error_budget_remaining"` // Share of the window's error budget left; negative once overspent
+	BurnRates   map[string]float64 `json:"burn_rates"`             // Per burn window: the error rate over the budgeted one; 1 spends the budget exactly over the window
+	Met         bool               `json:"met"`
+}
+
+// Status returns the status of every objective
+func (t *Tracker) Status() []Status {
+	now := t.now().Unix() / int64(bucketWidth/time.Second)
+	out := make([]Status, len(t.objectives))
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, o := range t.objectives {
+		total, good := t.countLocked(i, now, t.window)
+		st := Status{
+			Objective:   o.String(),
+			Op:          o.Op,
+			ThresholdMS: float64(o.Threshold) / float64(time.Millisecond),
+			Target:      o.Target,
+			Window:      t.window.String(),
+			Total:       total,
+			Good:        good,
+			Attainment:  ratio(good, total),
+			BurnRates:   make(map[string]float64, len(BurnWindows)),
+		}
+		budget := 1 - o.Target
+		st.Budget = 1 - (1-st.Attainment)/budget
+		st.Met = st.Attainment >= o.Target
+		for _, w := range BurnWindows {
+			total, good := t.countLocked(i, now, w)
+			st.BurnRates[w.String()] = (1 - ratio(good, total)) / budget
+		}
+		out[i] = st
+	}
+	sort.SliceStable(out, func(a, b int) bool { return out[a].Op < out[b].Op })
+	return out
+}
+
+// countLocked sums objective i's ops and good ops in the window ending at
+// minute now
+func (t *Tracker) countLocked(i int, now int64, window time.Duration) (total, good uint64) {
+	since := now - int64(window/bucketWidth)
+	op := t.objectives[i].Op
+	for _, b := range t.buckets {
+		if b.total == nil || b.minute <= since || b.minute > now {
+			continue
+		}
+		total += b.total[op]
+		good += b.good[i]
+	}
+	return total, good
+}
+
+// ratio is good/total, or 1 without traffic: no ops broke the objective
+func ratio(good, total uint64) float64 {
+	if total == 0 {
+		return 1
+	}
+	return float64(good) / float64(total)
+}
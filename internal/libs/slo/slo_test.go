@@ -0,0 +1,72 @@
+package slo
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	objectives, err := Parse("search:200ms:99, run:2s:99.5%")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objectives) != 2 || objectives[0].String() != "search:200ms:99" || objectives[1].String() != "run:2s:99.5" {
+		t.Fatalf("objectives = %v", objectives)
+	}
+	for _, bad := range []string{"search:200ms", "search:fast:99", "search:200ms:100", ":1s:90"} {
+		if _, err := Parse(bad); err == nil {
+			t.Errorf("Parse(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestTracker(t *testing.T) {
+	objectives, _ := Parse("search:200ms:90,run:1s:99")
+	tr := NewTracker(objectives, 2*time.Hour)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tr.now = func() time.Time { return now }
+
+	// An hour and a half ago: all fast
+	now = now.Add(-90 * time.Minute)
+	for i := 0; i < 80; i++ {
+		tr.Observe("search", 50*time.Millisecond)
+	}
+	// In the last five minutes: half slow
+	now = now.Add(88 * time.Minute)
+	for i := 0; i < 20; i++ {
+		d := 50 * time.Millisecond
+		if i%2 == 0 {
+			d = 300 * time.Millisecond
+		}
+		tr.Observe("search", d)
+	}
+	// Outside the window
+	now = now.Add(-3 * time.Hour)
+	tr.Observe("search", time.Second)
+	now = now.Add(3 * time.Hour)
+
+	status := tr.Status()
+	if len(status) != 2 || status[0].Op != "run" || status[1].Op != "search" {
+		t.Fatalf("status = %+v", status)
+	}
+	run, search := status[0], status[1]
+	if run.Total != 0 || run.Attainment != 1 || !run.Met || run.BurnRates["5m0s"] != 0 {
+		t.Errorf("run without traffic = %+v", run)
+	}
+
+	if search.Total != 100 || search.Good != 90 || search.Attainment != 0.9 || !search.Met {
+		t.Errorf("search = %+v", search)
+	}
+	if !near(search.Budget, 0) {
+		t.Errorf("budget remaining = %v, want 0", search.Budget)
+	}
+	// Half the last five minutes' searches were slow: five times the budgeted 10%
+	if !near(search.BurnRates["5m0s"], 5) || !near(search.BurnRates["1h0m0s"], 5) {
+		t.Errorf("burn rates = %v", search.BurnRates)
+	}
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
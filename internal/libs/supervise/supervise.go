@@ -0,0 +1,211 @@
+// Package supervise runs background loops, like the compactor, WAL sync,
+// and scheduled jobs, and restarts the ones that fail or panic with an
+// exponential backoff. A loop that keeps failing is given up on and makes
+// the supervisor unhealthy, which /readyz reports.
+package supervise
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/diag"
+	"github.com/rs/zerolog"
+)
+
+// States of a supervised loop
+const (
+	StateRunning    = "running"
+	StateRestarting = "restarting" // Waiting out the backoff after a failure
+	StateFailed     = "failed"     // Gave up after too many restarts
+	StateStopped    = "stopped"    // Its context was canceled
+	StateExited     = "exited"     // Returned nil
+)
+
+// Defaults of a new Supervisor
+const (
+	DefaultMinBackoff  = time.Second
+	DefaultMaxBackoff  = time.Minute
+	DefaultMaxRestarts = 10
+	DefaultResetAfter  = time.Minute
+)
+
+// Status is the state of a supervised loop
+type Status struct {
+	Name      string     `json:"name"`
+	State     string     `json:"state"`
+	Restarts  int        `json:"restarts"` // Since it was started
+	LastError string     `json:"last_error,omitempty"`
+	FailedAt  *time.Time `json:"failed_at,omitempty"` // Of the last failure
+}
+
+// Supervisor runs loops and restarts the ones that fail
+type Supervisor struct {
+	logger      zerolog.Logger
+	diag        *diag.Collector
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+	maxRestarts int
+	resetAfter  time.Duration
+
+	mu    sync.Mutex
+	loops map[string]*Status
+}
+
+// Option configures a Supervisor
+type Option func(*Supervisor)
+
+// WithBackoff waits initial before the first restart, doubling up to limit
+func WithBackoff(initial, limit time.Duration) Option {
+	return func(s *Supervisor) {
+		s.minBackoff, s.maxBackoff = initial, limit
+	}
+}
+
+// WithMaxRestarts gives up on a loop after n restarts in a row (0 never
+// gives up). A run that lasts the reset period doesn't count as in a row.
+func WithMaxRestarts(n int, resetAfter time.Duration) Option {
+	return func(s *Supervisor) {
+		s.maxRestarts, s.resetAfter = n, resetAfter
+	}
+}
+
+// WithDiagnostics captures panics into c instead of diag.Default
+func WithDiagnostics(c *diag.Collector) Option {
+	return func(s *Supervisor) {
+		s.diag = c
+	}
+}
+
+// New creates a supervisor with no loops
+func New(logger zerolog.Logger, opts ...Option) *Supervisor {
+	s := &Supervisor{
+		logger:      logger,
+		diag:        diag.Default,
+		minBackoff:  DefaultMinBackoff,
+		maxBackoff:  DefaultMaxBackoff,
+		maxRestarts: DefaultMaxRestarts,
+		resetAfter:  DefaultResetAfter,
+		loops:       make(map[string]*Status),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Go runs loop until ctx is canceled or it returns nil, restarting it when
+// it returns an error or panics. A panic is captured in a diagnostic
+// bundle. The returned channel is closed once loop stops for good. Starting
+// a loop under a name in use replaces the reported status.
+func (s *Supervisor) Go(ctx context.Context, name string, loop func(ctx context.Context) error) <-chan struct{} {
+	st := &Status{Name: name, State: StateRunning}
+	s.mu.Lock()
+	s.loops[name] = st
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.supervise(ctx, st, loop)
+	}()
+	return done
+}
+
+func (s *Supervisor) supervise(ctx context.Context, st *Status, loop func(ctx context.Context) error) {
+	failures := 0
+	for {
+		start := time.Now()
+		err := s.run(ctx, st.Name, loop)
+		if ctx.Err() != nil {
+			s.setState(st, StateStopped)
+			return
+		}
+		if err == nil {
+			s.setState(st, StateExited)
+			return
+		}
+
+		if time.Since(start) >= s.resetAfter {
+			failures = 0
+		}
+		failures++
+		now := time.Now().UTC()
+		s.mu.Lock()
+		st.LastError, st.FailedAt = err.Error(), &now
+		s.mu.Unlock()
+
+		if s.maxRestarts > 0 && failures > s.maxRestarts {
+			s.logger.Error().Err(err).Str("loop", st.Name).Int("restarts", failures-1).Msg("background loop keeps failing, giving up")
+			s.setState(st, StateFailed)
+			return
+		}
+
+		backoff := s.backoff(failures)
+		s.logger.Warn().Err(err).Str("loop", st.Name).Dur("backoff", backoff).Msg("background loop failed, restarting")
+		s.setState(st, StateRestarting)
+		select {
+		case <-ctx.Done():
+			s.setState(st, StateStopped)
+			return
+		case <-time.After(backoff):
+		}
+		s.mu.Lock()
+		st.State = StateRunning
+		st.Restarts++
+		s.mu.Unlock()
+	}
+}
+
+// run runs loop once, turning a panic into an error
+func (s *Supervisor) run(ctx context.Context, name string, loop func(ctx context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			b := s.diag.Report(name, r, debug.Stack())
+			err = fmt.Errorf("panic: %s", b.Panic)
+		}
+	}()
+	return loop(ctx)
+}
+
+// backoff returns the wait before the restart after the nth failure in a row
+func (s *Supervisor) backoff(n int) time.Duration {
+	d := s.minBackoff
+	for i := 1; i < n && d < s.maxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, s.maxBackoff)
+}
+
+func (s *Supervisor) setState(st *Status, state string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st.State = state
+}
+
+// Status returns the status of every loop, sorted by name
+func (s *Supervisor) Status() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Status, 0, len(s.loops))
+	for _, st := range s.loops {
+		out = append(out, *st)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Healthy reports whether no loop has been given up on
+func (s *Supervisor) Healthy() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, st := range s.loops {
+		if st.State == StateFailed {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,99 @@
+package supervise
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/diag"
+	"github.com/rs/zerolog"
+)
+
+func newTestSupervisor(opts ...Option) *Supervisor {
+	opts = append([]Option{WithBackoff(time.Millisecond, 4*time.Millisecond), WithDiagnostics(diag.New(""))}, opts...)
+	return New(zerolog.Nop(), opts...)
+}
+
+func wait(t *testing.T, done <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("loop did not stop")
+	}
+}
+
+func TestSupervisorRestartsFailingLoop(t *testing.T) {
+	bundles := diag.New("")
+	s := newTestSupervisor(WithDiagnostics(bundles))
+
+	var runs atomic.Int32
+	done := s.Go(context.Background(), "flaky", func(context.Context) error {
+		switch runs.Add(1) {
+		case 1:
+			return errors.New("transient")
+		case 2:
+			panic("boom")
+		}
+		return nil
+	})
+	wait(t, done)
+
+	st := s.Status()
+	if len(st) != 1 || st[0].State != StateExited || st[0].Restarts != 2 || st[0].LastError != "panic: boom" {
+		t.Fatalf("status = %+v", st)
+	}
+	if len(bundles.Bundles()) != 1 || bundles.Bundles()[0].Source != "flaky" {
+		t.Errorf("panic not captured: %+v", bundles.Bundles())
+	}
+	if !s.Healthy() {
+		t.Error("supervisor unhealthy after the loop recovered")
+	}
+}
+
+func TestSupervisorGivesUp(t *testing.T) {
+	s := newTestSupervisor(WithMaxRestarts(3, time.Hour))
+
+	var runs atomic.Int32
+	done := s.Go(context.Background(), "broken", func(context.Context) error {
+		runs.Add(1)
+		return errors.New("always")
+	})
+	wait(t, done)
+
+	if runs.Load() != 4 {
+		t.Errorf("runs = %d, want the first run and 3 restarts", runs.Load())
+	}
+	if st := s.Status(); st[0].State != StateFailed || st[0].FailedAt == nil {
+		t.Errorf("status = %+v", st)
+	}
+	if s.Healthy() {
+		t.Error("supervisor healthy after giving up on a loop")
+	}
+}
+
+func TestSupervisorStopsOnCancel(t *testing.T) {
+	s := newTestSupervisor(WithBackoff(time.Hour, time.Hour))
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := s.Go(ctx, "backing-off", func(context.Context) error { return errors.New("fail") })
+	time.Sleep(10 * time.Millisecond) // Into the hour-long backoff
+	cancel()
+	wait(t, done)
+
+	if st := s.Status(); st[0].State != StateStopped {
+		t.Errorf("state = %s, want stopped", st[0].State)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	s := New(zerolog.Nop(), WithBackoff(time.Second, 5*time.Second))
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, w := range want {
+		if got := s.backoff(i + 1); got != w {
+			t.Errorf("backoff(%d) = %s, want %s", i+1, got, w)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package relay
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+)
+
+// Breaker defaults
+const (
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = 30 * time.Second
+)
+
+// BreakerState is the state of a circuit breaker
+type BreakerState int
+
+// Breaker states
+const (
+	BreakerClosed   BreakerState = iota // Calls go through
+	BreakerOpen                         // Calls fail fast until the cooldown ends
+	BreakerHalfOpen                     // One probe call decides whether to close
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half_open"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(s))
+	}
+}
+
+// ErrCircuitOpen matches every *CircuitOpenError with errors.Is
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitOpenError is returned instead of calling a provider whose breaker
+// is open
+type CircuitOpenError struct {
+	Name  string
+	Until time.Time // When the next probe call is allowed
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%s unavailable: circuit breaker is open until %s", e.Name, e.Until.Format(time.RFC3339))
+}
+
+// Is reports whether target is ErrCircuitOpen
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// Breaker trips open after consecutive failures of a remote provider, fails
+// calls fast while open, and lets one probe call through after a cooldown:
+// a successful probe closes it, a failed one reopens it
+type Breaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	transitions *obs.CounterVec
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// BreakerOption configures a Breaker
+type BreakerOption func(*Breaker)
+
+// WithThreshold sets the consecutive failures that trip the breaker
+// (default: DefaultBreakerThreshold)
+func WithThreshold(n int) BreakerOption {
+	return func(b *Breaker) {
+		b.threshold = n
+	}
+}
+
+// WithCooldown sets how long the breaker stays open before a probe
+// (default: DefaultBreakerCooldown)
+func WithCooldown(d time.Duration) BreakerOption {
+	return func(b *Breaker) {
+		b.cooldown = d
+	}
+}
+
+// WithBreakerMetrics counts state transitions in reg as
+// selfstack_breaker_transitions_total{transition="<name>:<state>"}
+func WithBreakerMetrics(reg *obs.Registry) BreakerOption {
+	return func(b *Breaker) {
+		b.transitions = reg.CounterVec("selfstack_breaker_transitions_total",
+			"Circuit breaker state changes by breaker and new state", "transition")
+	}
+}
+
+// NewBreaker creates a closed breaker for the named provider
+func NewBreaker(name string, opts ...BreakerOption) *Breaker {
+	b := &Breaker{
+		name:      name,
+		threshold: DefaultBreakerThreshold,
+		cooldown:  DefaultBreakerCooldown,
+		now:       time.Now,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	if b.threshold < 1 {
+		b.threshold = 1
+	}
+	return b
+}
+
+// Name returns the provider name the breaker guards
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// State returns the current state; an open breaker whose cooldown has ended
+// reports half-open
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen && !b.now().Before(b.openedAt.Add(b.cooldown)) {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+// Do runs fn unless the breaker is open and records its outcome
+func (b *Breaker) Do(fn func() error) error {
+	if err := b.allow(); err != nil {
+		return err
+	}
+	err := fn()
+	b.record(err)
+	return err
+}
+
+// allow admits a call, or returns a *CircuitOpenError
+func (b *Breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		until := b.openedAt.Add(b.cooldown)
+		if b.now().Before(until) {
+			return &CircuitOpenError{Name: b.name, Until: until}
+		}
+		b.setStateLocked(BreakerHalfOpen)
+		b.probing = true
+		return nil
+	case BreakerHalfOpen:
+		if b.probing {
+			return &CircuitOpenError{Name: b.name, Until: b.now()}
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// record updates the state with a call's outcome
+func (b *Breaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if err == nil {
+		b.failures = 0
+		if b.state != BreakerClosed {
+			b.setStateLocked(BreakerClosed)
+		}
+		return
+	}
+
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		b.openedAt = b.now()
+		b.setStateLocked(BreakerOpen)
+	}
+}
+
+func (b *Breaker) setStateLocked(s BreakerState) {
+	if b.state == s {
+		return
+	}
+	b.state = s
+	if b.transitions != nil {
+		b.transitions.WithLabel(b.name + ":" + s.String()).Inc()
+	}
+}
@@ -0,0 +1,142 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+)
+
+var errProvider = errors.New("provider returned 503")
+
+func TestBreakerTripsAndRecovers(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	reg := obs.NewRegistry()
+	b := NewBreaker("remote", WithThreshold(2), WithCooldown(time.Minute), WithBreakerMetrics(reg))
+	b.now = func() time.Time { return now }
+
+	calls := 0
+	fail := func() error { calls++; return errProvider }
+	ok := func() error { calls++; return nil }
+
+	_ = b.Do(fail)
+	if b.State() != BreakerClosed {
+		t.Fatal("one failure should not trip the breaker")
+	}
+	_ = b.Do(fail)
+	if b.State() != BreakerOpen {
+		t.Fatalf("expected open after 2 failures, got %s", b.State())
+	}
+
+	// Open: fail fast without calling the provider
+	err := b.Do(ok)
+	var open *CircuitOpenError
+	if !errors.As(err, &open) || !errors.Is(err, ErrCircuitOpen) || calls != 2 {
+		t.Fatalf("expected a CircuitOpenError without a call, got %v (%d calls)", err, calls)
+	}
+	if !open.Until.Equal(now.Add(time.Minute)) {
+		t.Errorf("expected retry at %v, got %v", now.Add(time.Minute), open.Until)
+	}
+
+	// After the cooldown a failed probe reopens it
+	now = now.Add(time.Minute)
+	if b.State() != BreakerHalfOpen {
+		t.Fatalf("expected half-open after the cooldown, got %s", b.State())
+	}
+	_ = b.Do(fail)
+	if b.State() != BreakerOpen {
+		t.Fatalf("expected a failed probe to reopen, got %s", b.State())
+	}
+
+	// A successful probe closes it
+	now = now.Add(time.Minute)
+	if err := b.Do(ok); err != nil || b.State() != BreakerClosed {
+		t.Fatalf("expected a successful probe to close, got %v %s", err, b.State())
+	}
+
+	transitions := reg.CounterVec("selfstack_breaker_transitions_total", "", "transition")
+	if n := transitions.WithLabel("remote:open").Value(); n != 2 {
+		t.Errorf("expected 2 open transitions, got %d", n)
+	}
+	if n := transitions.WithLabel("remote:closed").Value(); n != 1 {
+		t.Errorf("expected 1 closed transition, got %d", n)
+	}
+}
+
+func TestBreakerHalfOpenAllowsOneProbe(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	b := NewBreaker("remote", WithThreshold(1), WithCooldown(time.Second))
+	b.now = func() time.Time { return now }
+	_ = b.Do(func() error { return errProvider })
+	now = now.Add(time.Second)
+
+	probing := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- b.Do(func() error { close(probing); <-release; return nil })
+	}()
+	<-probing
+	if err := b.Do(func() error { return nil }); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected a second call during the probe to fail fast, got %v", err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("probe failed: %v", err)
+	}
+}
+
+// flakyEmbedder is a remote embedder that fails while down is set
+type flakyEmbedder struct {
+	down  bool
+	calls int
+}
+
+func (e *flakyEmbedder) Name() string    { return "remote" }
+func (e *flakyEmbedder) Dimensions() int { return EmbeddingDim }
+func (e *flakyEmbedder) Embed(text string) Embedding {
+	emb, _ := e.EmbedContext(context.Background(), text)
+	return emb
+}
+
+func (e *flakyEmbedder) EmbedContext(_ context.Context, text string) (Embedding, error) {
+	e.calls++
+	if e.down {
+		return Embedding{}, errProvider
+	}
+	return hashingEmbedder{dims: EmbeddingDim}.Embed(text), nil
+}
+
+func TestGuardedEmbedder(t *testing.T) {
+	remote := &flakyEmbedder{}
+	reg := obs.NewRegistry()
+	g := NewGuardedEmbedder(remote, NewBreaker("remote", WithThreshold(1)),
+		WithFallback(DefaultEmbedder()), WithFallbackMetrics(reg))
+
+	emb, fallback, err := g.EmbedGuarded(context.Background(), "hello")
+	if err != nil || fallback != "" || emb != (hashingEmbedder{dims: EmbeddingDim}).Embed("hello") {
+		t.Fatalf("expected the remote embedding, got fallback=%q err=%v", fallback, err)
+	}
+
+	remote.down = true
+	for i := 0; i < 2; i++ {
+		emb, fallback, err = g.EmbedGuarded(context.Background(), "hello")
+		if err != nil || fallback != ProviderDeterministic || emb != DeterministicEmbed("hello") {
+			t.Fatalf("expected the fallback embedding, got fallback=%q err=%v", fallback, err)
+		}
+	}
+	if remote.calls != 2 {
+		t.Errorf("expected the open breaker to skip the remote call, got %d calls", remote.calls)
+	}
+	if n := reg.CounterVec("selfstack_embed_fallbacks_total", "", "embedder").WithLabel("remote").Value(); n != 2 {
+		t.Errorf("expected 2 fallbacks, got %d", n)
+	}
+
+	// Without a fallback the typed error surfaces
+	failFast := NewGuardedEmbedder(remote, g.Breaker())
+	if _, _, err := failFast.EmbedGuarded(context.Background(), "hello"); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected ErrCircuitOpen, got %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package relay
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"unicode"
+)
+
+// Embedding providers
+const (
+	ProviderDeterministic = "deterministic" // SHA256-derived, reproducible, not semantic
+	ProviderHashing       = "hashing"       // Feature-hashed token counts; suits identifier-heavy text like code
+)
+
+// Embedder turns text into an embedding. Embedders with fewer than
+// EmbeddingDim dimensions leave the remaining components zero, so all
+// embeddings share one storage format and cosine similarity still holds.
+type Embedder interface {
+	Name() string
+	Dimensions() int
+	Embed(text string) Embedding
+}
+
+// NewEmbedder returns the embedder for a provider. dims of 0 means EmbeddingDim.
+func NewEmbedder(provider string, dims int) (Embedder, error) {
+	if dims == 0 {
+		dims = EmbeddingDim
+	}
+	if dims < 1 || dims > EmbeddingDim {
+		return nil, fmt.Errorf("embedding dimensions must be between 1 and %d, got %d", EmbeddingDim, dims)
+	}
+
+	switch provider {
+	case "", ProviderDeterministic:
+		return deterministicEmbedder{dims: dims}, nil
+	case ProviderHashing:
+		return hashingEmbedder{dims: dims}, nil
+	default:
+		return nil, fmt.Errorf("unknown embedding provider %q (want %s or %s)", provider, ProviderDeterministic, ProviderHashing)
+	}
+}
+
+// DefaultEmbedder is the embedder used when no collection config applies
+func DefaultEmbedder() Embedder {
+	return deterministicEmbedder{dims: EmbeddingDim}
+}
+
+type deterministicEmbedder struct {
+	dims int
+}
+
+func (e deterministicEmbedder) Name() string    { return ProviderDeterministic }
+func (e deterministicEmbedder) Dimensions() int { return e.dims }
+
+func (e deterministicEmbedder) Embed(text string) Embedding {
+	emb := DeterministicEmbed(text)
+	if e.dims == EmbeddingDim {
+		return emb
+	}
+	for i := e.dims; i < EmbeddingDim; i++ {
+		emb[i] = 0
+	}
+	return normalize(emb)
+}
+
+type hashingEmbedder struct {
+	dims int
+}
+
+func (e hashingEmbedder) Name() string    { return ProviderHashing }
+func (e hashingEmbedder) Dimensions() int { return e.dims }
+
+// Embed hashes each token into a signed bucket. Texts sharing tokens score
+// higher, which a SHA256 of the whole text can't offer.
+func (e hashingEmbedder) Embed(text string) Embedding {
+	var emb Embedding
+	for _, tok := range tokenize(text) {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(tok))
+		sum := h.Sum32()
+
+		sign := float32(1)
+		if sum&(1<<31) != 0 {
+			sign = -1
+		}
+		emb[int(sum%uint32(e.dims))] += sign
+	}
+	return normalize(emb)
+}
+
+// tokenize lowercases text and splits it on anything that isn't a letter or digit
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
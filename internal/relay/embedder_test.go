@@ -0,0 +1,70 @@
+package relay
+
+import (
+	"testing"
+)
+
+func TestNewEmbedder(t *testing.T) {
+	if _, err := NewEmbedder("openai", 0); err == nil {
+		t.Error("expected error for unknown provider")
+	}
+	if _, err := NewEmbedder(ProviderHashing, EmbeddingDim+1); err == nil {
+		t.Error("expected error for too many dimensions")
+	}
+
+	e, err := NewEmbedder(ProviderDeterministic, 0)
+	if err != nil {
+		t.Fatalf("NewEmbedder failed: %v", err)
+	}
+	if e.Dimensions() != EmbeddingDim || e.Embed("hello") != DeterministicEmbed("hello") {
+		t.Error("full-width deterministic embedder should match DeterministicEmbed")
+	}
+}
+
+func TestEmbedderDimensions(t *testing.T) {
+	for _, provider := range []string{ProviderDeterministic, ProviderHashing} {
+		e, err := NewEmbedder(provider, 32)
+		if err != nil {
+			t.Fatalf("NewEmbedder(%s) failed: %v", provider, err)
+		}
+		emb := e.Embed("func parseConfig(path string) error")
+		for i := 32; i < EmbeddingDim; i++ {
+			if emb[i] != 0 {
+				t.Fatalf("%s: component %d beyond dimensions should be zero", provider, i)
+			}
+		}
+		if sim := CosineSimilarity(emb, emb); sim < 0.999 || sim > 1.001 {
+			t.Errorf("%s: embedding not normalized (self similarity %f)", provider, sim)
+		}
+	}
+}
+
+func TestHashingEmbedderSharesTokens(t *testing.T) {
+	e, _ := NewEmbedder(ProviderHashing, 0)
+	query := e.Embed("parseConfig")
+	related := e.Embed("func parseConfig(path string) error")
+	unrelated := e.Embed("quarterly revenue report")
+
+	if CosineSimilarity(query, related) <= CosineSimilarity(query, unrelated) {
+		t.Error("text sharing a token should score higher than unrelated text")
+	}
+}
+
+func TestLexicalReranker(t *testing.T) {
+	r, err := NewReranker(RerankerLexical)
+	if err != nil {
+		t.Fatalf("NewReranker failed: %v", err)
+	}
+	candidates := []Candidate{
+		{ID: "a", Text: "unrelated text", Score: 0.6},
+		{ID: "b", Text: "quarterly planning notes", Score: 0.5},
+	}
+	r.Rerank("quarterly planning", candidates)
+	if candidates[0].ID != "b" {
+		t.Errorf("expected term overlap to promote b, got %+v", candidates)
+	}
+
+	if r, err := NewReranker(""); r != nil || err != nil {
+		t.Errorf("empty reranker should be none, got %v, %v", r, err)
+	}
+}
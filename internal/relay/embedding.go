@@ -3,6 +3,7 @@ package relay
 import (
 	"crypto/sha256"
 	"encoding/binary"
+	"fmt"
 	"math"
 )
 
@@ -58,6 +59,40 @@ func CosineSimilarity(a, b Embedding) float32 {
 	return dot // Already normalized, so dot product = cosine
 }
 
+// EmbeddingFrom converts a raw vector from another embedding pipeline,
+// normalizing it to unit length. It must have EmbeddingDim finite values,
+// not all zero.
+func EmbeddingFrom(v []float32) (Embedding, error) {
+	var emb Embedding
+	if len(v) != EmbeddingDim {
+		return emb, fmt.Errorf("vector has %d dimensions, want %d", len(v), EmbeddingDim)
+	}
+	var sum float64
+	for i, x := range v {
+		if math.IsNaN(float64(x)) || math.IsInf(float64(x), 0) {
+			return emb, fmt.Errorf("vector value %d is not finite", i)
+		}
+		emb[i] = x
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return emb, fmt.Errorf("vector is all zeros")
+	}
+	return normalize(emb), nil
+}
+
+// Centroid returns the normalized mean of embs, a single vector standing
+// for all of them, as for a document split into chunks
+func Centroid(embs ...Embedding) Embedding {
+	var sum Embedding
+	for _, e := range embs {
+		for i := 0; i < EmbeddingDim; i++ {
+			sum[i] += e[i]
+		}
+	}
+	return normalize(sum)
+}
+
 func normalize(v Embedding) Embedding {
 	var sum float32
 	for i := 0; i < EmbeddingDim; i++ {
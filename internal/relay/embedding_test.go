@@ -73,3 +73,40 @@ func TestDifferentTextsProduceDifferentEmbeddings(t *testing.T) {
 		t.Error("different texts produced identical embeddings")
 	}
 }
+
+func TestCentroid(t *testing.T) {
+	a, b := DeterministicEmbed("text A"), DeterministicEmbed("text B")
+	c := Centroid(a, b)
+
+	if sim := CosineSimilarity(Centroid(a), a); math.Abs(float64(sim-1.0)) > 0.001 {
+		t.Errorf("expected the centroid of one embedding to be itself, got similarity %f", sim)
+	}
+	if CosineSimilarity(c, a) <= CosineSimilarity(a, b) || CosineSimilarity(c, b) <= CosineSimilarity(a, b) {
+		t.Error("expected the centroid to be closer to each embedding than they are to each other")
+	}
+	if math.Abs(float64(CosineSimilarity(c, c)-1.0)) > 0.001 {
+		t.Error("centroid not normalized")
+	}
+}
+
+func TestEmbeddingFrom(t *testing.T) {
+	v := make([]float32, EmbeddingDim)
+	v[0], v[1] = 3, 4
+	emb, err := EmbeddingFrom(v)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if emb[0] != 0.6 || emb[1] != 0.8 {
+		t.Errorf("expected a normalized vector, got %v", emb[:2])
+	}
+
+	for name, bad := range map[string][]float32{
+		"short": {1, 2, 3},
+		"zero":  make([]float32, EmbeddingDim),
+		"nan":   append([]float32{float32(math.NaN())}, v[1:]...),
+	} {
+		if _, err := EmbeddingFrom(bad); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
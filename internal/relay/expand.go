@@ -0,0 +1,80 @@
+package relay
+
+import (
+	"sort"
+	"strings"
+)
+
+// MaxSubQueries caps the queries ExpandQuery returns, the original included
+const MaxSubQueries = 4
+
+// stopwords are dropped from expanded queries: articles, pronouns,
+// auxiliaries, prepositions, and question words carry no topic
+var stopwords = map[string]bool{
+	"a": true, "an": true, "the": true, "and": true, "or": true, "but": true,
+	"i": true, "me": true, "my": true, "we": true, "our": true, "you": true, "your": true,
+	"it": true, "its": true, "they": true, "them": true, "their": true, "this": true, "that": true,
+	"these": true, "those": true, "is": true, "are": true, "was": true, "were": true, "be": true,
+	"been": true, "do": true, "does": true, "did": true, "can": true, "could": true, "should": true,
+	"would": true, "will": true, "has": true, "have": true, "had": true, "of": true, "in": true,
+	"on": true, "at": true, "to": true, "for": true, "from": true, "by": true, "with": true,
+	"about": true, "into": true, "as": true, "what": true, "which": true, "who": true, "whom": true,
+	"when": true, "where": true, "why": true, "how": true, "there": true, "any": true, "some": true,
+	"tell": true, "explain": true, "describe": true, "please": true,
+}
+
+// ExpandQuery returns up to MaxSubQueries rule-based reformulations of
+// query for multi-query retrieval, starting with query itself:
+//   - its content words, without stopwords and question words
+//   - the content words in singular form, so plurals match
+//   - the longest content word alone, usually the most specific one
+//
+// Duplicates are dropped, so a terse query may return fewer.
+func ExpandQuery(query string) []string {
+	queries := []string{query}
+	seen := map[string]bool{strings.ToLower(strings.TrimSpace(query)): true}
+	add := func(q string) {
+		if q == "" || seen[q] || len(queries) >= MaxSubQueries {
+			return
+		}
+		seen[q] = true
+		queries = append(queries, q)
+	}
+
+	var words []string
+	for _, tok := range tokenize(query) {
+		if !stopwords[tok] {
+			words = append(words, tok)
+		}
+	}
+	add(strings.Join(words, " "))
+
+	singulars := make([]string, len(words))
+	for i, w := range words {
+		singulars[i] = singular(w)
+	}
+	add(strings.Join(singulars, " "))
+
+	if len(words) > 1 {
+		longest := append([]string(nil), words...)
+		sort.SliceStable(longest, func(i, j int) bool { return len(longest[i]) > len(longest[j]) })
+		add(longest[0])
+	}
+	return queries
+}
+
+// singular strips plural endings so "policies" also matches "policy" and
+// "documents" "document"; words ending in -es are left alone, since
+// "kubernetes" and "services" have no safe rule
+func singular(word string) string {
+	switch {
+	case len(word) <= 3:
+		return word
+	case strings.HasSuffix(word, "ies"):
+		return strings.TrimSuffix(word, "ies") + "y"
+	case strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss") &&
+		!strings.HasSuffix(word, "us") && !strings.HasSuffix(word, "is") && !strings.HasSuffix(word, "es"):
+		return strings.TrimSuffix(word, "s")
+	}
+	return word
+}
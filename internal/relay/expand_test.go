@@ -0,0 +1,24 @@
+package relay
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpandQuery(t *testing.T) {
+	got := ExpandQuery("What are the retention policies for deleted documents?")
+	want := []string{
+		"What are the retention policies for deleted documents?",
+		"retention policies deleted documents",
+		"retention policy deleted document",
+		"retention",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	// Nothing to reformulate in a single keyword
+	if got := ExpandQuery("Kubernetes"); len(got) != 1 {
+		t.Errorf("expected only the original query, got %q", got)
+	}
+}
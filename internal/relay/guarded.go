@@ -0,0 +1,99 @@
+package relay
+
+import (
+	"context"
+	"errors"
+
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+)
+
+// FallibleEmbedder is an Embedder backed by a remote provider whose calls
+// can fail. Embed is only used when nothing can report the failure.
+type FallibleEmbedder interface {
+	Embedder
+	EmbedContext(ctx context.Context, text string) (Embedding, error)
+}
+
+// GuardedEmbedder calls a remote embedder through a circuit breaker. When
+// the call fails or the breaker is open it falls back to another embedder
+// if one is set, and otherwise returns the error so callers fail fast.
+type GuardedEmbedder struct {
+	remote   FallibleEmbedder
+	breaker  *Breaker
+	fallback Embedder
+
+	fallbacks *obs.CounterVec
+}
+
+// GuardedOption configures a GuardedEmbedder
+type GuardedOption func(*GuardedEmbedder)
+
+// WithFallback embeds with e when the remote embedder is unavailable
+// (default: none, fail fast)
+func WithFallback(e Embedder) GuardedOption {
+	return func(g *GuardedEmbedder) {
+		g.fallback = e
+	}
+}
+
+// WithFallbackMetrics counts fallback embeddings in reg as
+// selfstack_embed_fallbacks_total{embedder="<remote name>"}
+func WithFallbackMetrics(reg *obs.Registry) GuardedOption {
+	return func(g *GuardedEmbedder) {
+		g.fallbacks = reg.CounterVec("selfstack_embed_fallbacks_total",
+			"Embeddings computed by the fallback embedder because the remote one was unavailable", "embedder")
+	}
+}
+
+// NewGuardedEmbedder guards remote with breaker
+func NewGuardedEmbedder(remote FallibleEmbedder, breaker *Breaker, opts ...GuardedOption) *GuardedEmbedder {
+	g := &GuardedEmbedder{remote: remote, breaker: breaker}
+	for _, opt := range opts {
+		opt(g)
+	}
+	return g
+}
+
+// Name returns the remote embedder's name
+func (g *GuardedEmbedder) Name() string { return g.remote.Name() }
+
+// Dimensions returns the remote embedder's dimensions
+func (g *GuardedEmbedder) Dimensions() int { return g.remote.Dimensions() }
+
+// Breaker returns the breaker guarding the remote embedder
+func (g *GuardedEmbedder) Breaker() *Breaker { return g.breaker }
+
+// EmbedGuarded embeds text with the remote embedder. If it's unavailable
+// and a fallback is set, it returns the fallback's embedding and the
+// fallback's name, so callers can flag the result for re-embedding.
+func (g *GuardedEmbedder) EmbedGuarded(ctx context.Context, text string) (emb Embedding, fallback string, err error) {
+	var callErr error
+	err = g.breaker.Do(func() error {
+		emb, callErr = g.remote.EmbedContext(ctx, text)
+		// A cancelled request says nothing about the provider's health
+		if errors.Is(callErr, context.Canceled) {
+			return nil
+		}
+		return callErr
+	})
+	if err == nil {
+		err = callErr
+	}
+	if err == nil {
+		return emb, "", nil
+	}
+	if g.fallback == nil || errors.Is(err, context.Canceled) {
+		return Embedding{}, "", err
+	}
+	if g.fallbacks != nil {
+		g.fallbacks.WithLabel(g.remote.Name()).Inc()
+	}
+	return g.fallback.Embed(text), g.fallback.Name(), nil
+}
+
+// Embed satisfies Embedder. Without a fallback a failed call returns the
+// zero embedding, so callers that can report errors use EmbedGuarded.
+func (g *GuardedEmbedder) Embed(text string) Embedding {
+	emb, _, _ := g.EmbedGuarded(context.Background(), text)
+	return emb
+}
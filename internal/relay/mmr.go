@@ -0,0 +1,41 @@
+package relay
+
+// MMR selects up to k candidates by Maximal Marginal Relevance. Each step
+// picks the candidate maximizing
+//
+//	lambda*relevance[i] - (1-lambda)*max(similarity(i, j) for selected j)
+//
+// so lambda 1 ranks by relevance alone and lower values trade relevance for
+// results unlike the ones already picked. It returns candidate indexes in
+// selection order.
+func MMR(relevance []float32, similarity func(i, j int) float32, k int, lambda float32) []int {
+	if k > len(relevance) {
+		k = len(relevance)
+	}
+	selected := make([]int, 0, k)
+	picked := make([]bool, len(relevance))
+	maxSim := make([]float32, len(relevance)) // To the selected set so far
+
+	for len(selected) < k {
+		best, bestScore := -1, float32(0)
+		for i := range relevance {
+			if picked[i] {
+				continue
+			}
+			score := lambda*relevance[i] - (1-lambda)*maxSim[i]
+			if best < 0 || score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		picked[best] = true
+		selected = append(selected, best)
+		for i := range relevance {
+			if !picked[i] {
+				if s := similarity(i, best); s > maxSim[i] {
+					maxSim[i] = s
+				}
+			}
+		}
+	}
+	return selected
+}
@@ -0,0 +1,27 @@
+package relay
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMMR(t *testing.T) {
+	// 0 and 1 are near-duplicates; 2 is less relevant but different
+	relevance := []float32{0.9, 0.88, 0.7}
+	sim := func(i, j int) float32 {
+		if (i == 0 && j == 1) || (i == 1 && j == 0) {
+			return 0.95
+		}
+		return 0.1
+	}
+
+	if got := MMR(relevance, sim, 2, 1); !reflect.DeepEqual(got, []int{0, 1}) {
+		t.Errorf("lambda 1 should rank by relevance, got %v", got)
+	}
+	if got := MMR(relevance, sim, 2, 0.5); !reflect.DeepEqual(got, []int{0, 2}) {
+		t.Errorf("expected the near-duplicate skipped, got %v", got)
+	}
+	if got := MMR(relevance, sim, 10, 0.5); len(got) != 3 {
+		t.Errorf("expected k capped at the candidates, got %v", got)
+	}
+}
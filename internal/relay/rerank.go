@@ -0,0 +1,68 @@
+package relay
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Rerankers
+const (
+	RerankerNone    = "none"
+	RerankerLexical = "lexical" // Blend vector score with query term overlap
+)
+
+// Candidate is a search hit being reranked
+type Candidate struct {
+	ID    string
+	Text  string
+	Score float32
+}
+
+// Reranker reorders search candidates after the index scan
+type Reranker interface {
+	Name() string
+	// Rerank rescores candidates in place and sorts them by score descending
+	Rerank(query string, candidates []Candidate)
+}
+
+// NewReranker returns the named reranker, or nil for none
+func NewReranker(name string) (Reranker, error) {
+	switch name {
+	case "", RerankerNone:
+		return nil, nil
+	case RerankerLexical:
+		return lexicalReranker{}, nil
+	default:
+		return nil, fmt.Errorf("unknown reranker %q (want %s or %s)", name, RerankerNone, RerankerLexical)
+	}
+}
+
+type lexicalReranker struct{}
+
+func (lexicalReranker) Name() string { return RerankerLexical }
+
+func (lexicalReranker) Rerank(query string, candidates []Candidate) {
+	terms := tokenize(query)
+	if len(terms) == 0 {
+		return
+	}
+
+	for i := range candidates {
+		present := make(map[string]bool)
+		for _, tok := range tokenize(candidates[i].Text) {
+			present[tok] = true
+		}
+		matched := 0
+		for _, term := range terms {
+			if present[term] {
+				matched++
+			}
+		}
+		overlap := float32(matched) / float32(len(terms))
+		candidates[i].Score = 0.5*candidates[i].Score + 0.5*overlap
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+}
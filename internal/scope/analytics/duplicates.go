@@ -0,0 +1,293 @@
+// Package analytics computes reports over the stored documents in
+// background jobs, like groups of near-duplicates left by connectors that
+// ingested the same content under several IDs.
+package analytics
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/events"
+	"github.com/dsjohal14/selfstack/internal/relay"
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+)
+
+const (
+	// DefaultThreshold is the similarity at or above which two documents
+	// are reported as near-duplicates
+	DefaultThreshold = 0.95
+
+	// IdenticalScore is the similarity to the kept document at or above
+	// which a duplicate is suggested for deletion rather than merging
+	IdenticalScore = 0.99
+
+	// neighbors is how many nearest documents are checked for each one
+	neighbors = 10
+
+	// metaChunkOf names the document a chunk was split from
+	metaChunkOf = "chunk_of"
+)
+
+// Corpus is the documents a report covers
+type Corpus interface {
+	Range(fn func(docID string, doc db.Document) bool)
+	SearchFiltered(query relay.Embedding, limit int, filter db.SearchFilter) []db.SearchResult
+}
+
+// Suggestion is what to do with a document in a duplicate group
+type Suggestion string
+
+// Suggestions
+const (
+	SuggestKeep   Suggestion = "keep"   // The newest copy
+	SuggestDelete Suggestion = "delete" // Identical to the kept copy
+	SuggestMerge  Suggestion = "merge"  // Close but not identical; review it and fold what's missing into the kept copy
+)
+
+// DuplicateDoc is a document in a duplicate group. A chunked document is
+// reported once, by its own ID.
+type DuplicateDoc struct {
+	ID         string     `json:"id"`
+	Title      string     `json:"title"`
+	Source     string     `json:"source"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Score      float32    `json:"score"` // Similarity to the kept document; 1 for it
+	Suggestion Suggestion `json:"suggestion"`
+}
+
+// DuplicateGroup is a set of documents in one collection linked by
+// similarities at or above the threshold, the kept one first
+type DuplicateGroup struct {
+	Collection string         `json:"collection"`
+	Documents  []DuplicateDoc `json:"documents"`
+}
+
+// DuplicateReport lists the near-duplicate groups found in a corpus,
+// largest first
+type DuplicateReport struct {
+	GeneratedAt time.Time        `json:"generated_at"`
+	Threshold   float32          `json:"threshold"`
+	Scanned     int              `json:"scanned"` // Documents compared, counting a chunked one once
+	Groups      []DuplicateGroup `json:"groups"`
+	TookMS      float64          `json:"took_ms"`
+}
+
+// node is a document, with the centroid of its chunks' embeddings if it
+// was chunked
+type node struct {
+	id         string
+	doc        db.Document // The first part seen, for the title and source
+	collection string
+	embs       []relay.Embedding
+	centroid   relay.Embedding
+}
+
+// FindDuplicates groups the documents in corpus whose similarity is at
+// least threshold. Each document's nearest neighbors in its collection are
+// candidates, and a pair is linked when the centroids of the two
+// documents' embeddings are that similar; groups are the linked
+// components. Chunks of one document are never compared with each other.
+func FindDuplicates(ctx context.Context, corpus Corpus, threshold float32) (*DuplicateReport, error) {
+	start := time.Now()
+	if threshold <= 0 {
+		threshold = DefaultThreshold
+	}
+
+	nodes := make(map[string]*node)
+	partOf := make(map[string]string) // Stored ID -> node ID
+	corpus.Range(func(id string, doc db.Document) bool {
+		nodeID := id
+		if parent := doc.Metadata[metaChunkOf]; parent != "" {
+			nodeID = parent
+		}
+		n, ok := nodes[nodeID]
+		if !ok {
+			n = &node{id: nodeID, doc: doc, collection: db.CollectionOf(doc)}
+			nodes[nodeID] = n
+		}
+		n.embs = append(n.embs, doc.Embedding)
+		partOf[id] = nodeID
+		return true
+	})
+	ids := make([]string, 0, len(nodes))
+	for id, n := range nodes {
+		n.centroid = relay.Centroid(n.embs...)
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	groups := newUnionFind()
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		n := nodes[id]
+		hits := corpus.SearchFiltered(n.centroid, neighbors+len(n.embs), db.SearchFilter{Collection: n.collection})
+		for _, hit := range hits {
+			if hit.Score < threshold {
+				break // Results are sorted by score
+			}
+			other, ok := nodes[partOf[hit.DocID]]
+			if !ok || other.id == id {
+				continue
+			}
+			if relay.CosineSimilarity(n.centroid, other.centroid) >= threshold {
+				groups.union(id, other.id)
+			}
+		}
+	}
+
+	report := &DuplicateReport{GeneratedAt: start, Threshold: threshold, Scanned: len(nodes)}
+	for _, members := range groups.sets() {
+		report.Groups = append(report.Groups, newGroup(nodes, members))
+	}
+	sort.Slice(report.Groups, func(i, j int) bool {
+		a, b := report.Groups[i], report.Groups[j]
+		if len(a.Documents) != len(b.Documents) {
+			return len(a.Documents) > len(b.Documents)
+		}
+		return a.Documents[0].ID < b.Documents[0].ID
+	})
+	report.TookMS = float64(time.Since(start).Microseconds()) / 1000
+	return report, nil
+}
+
+// newGroup keeps the newest of members and suggests what to do with the rest
+func newGroup(nodes map[string]*node, members []string) DuplicateGroup {
+	sort.Slice(members, func(i, j int) bool {
+		a, b := nodes[members[i]].doc.CreatedAt, nodes[members[j]].doc.CreatedAt
+		if !a.Equal(b) {
+			return a.After(b)
+		}
+		return members[i] < members[j]
+	})
+	keep := nodes[members[0]]
+	group := DuplicateGroup{Collection: keep.collection}
+	for i, id := range members {
+		n := nodes[id]
+		d := DuplicateDoc{ID: id, Title: n.doc.Title, Source: n.doc.Source, CreatedAt: n.doc.CreatedAt, Score: 1, Suggestion: SuggestKeep}
+		if i > 0 {
+			d.Score = relay.CosineSimilarity(keep.centroid, n.centroid)
+			d.Suggestion = SuggestMerge
+			if d.Score >= IdenticalScore {
+				d.Suggestion = SuggestDelete
+			}
+		}
+		group.Documents = append(group.Documents, d)
+	}
+	return group
+}
+
+// Duplicates keeps the latest duplicate report of a corpus; Run, as a
+// scheduled job, replaces it
+type Duplicates struct {
+	corpus    Corpus
+	threshold float32
+
+	mu     sync.RWMutex
+	report *DuplicateReport
+
+	tracked bool        // Writes are announced on a bus, so an unchanged corpus isn't scanned again
+	changed atomic.Bool // A write was announced since the last run started
+}
+
+// NewDuplicates reports near-duplicates in corpus at threshold
+// (DefaultThreshold if <= 0)
+func NewDuplicates(corpus Corpus, threshold float32) *Duplicates {
+	if threshold <= 0 {
+		threshold = DefaultThreshold
+	}
+	return &Duplicates{corpus: corpus, threshold: threshold}
+}
+
+// Subscribe keeps the report until bus announces a write to the corpus:
+// Run skips the scan while nothing has changed. Call it before the first
+// run.
+func (d *Duplicates) Subscribe(bus *events.Bus) (unsubscribe func()) {
+	if bus == nil {
+		return func() {}
+	}
+	d.mu.Lock()
+	d.tracked = true
+	d.mu.Unlock()
+	return bus.Subscribe(events.TopicWALApplied, "duplicates", func(events.Event) {
+		d.changed.Store(true)
+	}, events.Sync())
+}
+
+// Run computes a new report, unless the corpus hasn't changed since the
+// last one (see Subscribe)
+func (d *Duplicates) Run(ctx context.Context) error {
+	d.mu.RLock()
+	unchanged := d.tracked && d.report != nil
+	d.mu.RUnlock()
+	// Cleared before the scan, so writes during it are picked up next run
+	if !d.changed.Swap(false) && unchanged {
+		return nil
+	}
+
+	report, err := FindDuplicates(ctx, d.corpus, d.threshold)
+	if err != nil {
+		d.changed.Store(true)
+		return err
+	}
+	d.mu.Lock()
+	d.report = report
+	d.mu.Unlock()
+	return nil
+}
+
+// Report returns the latest report, or false before the first run finishes
+func (d *Duplicates) Report() (*DuplicateReport, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.report, d.report != nil
+}
+
+// unionFind links document IDs into groups
+type unionFind struct {
+	parent map[string]string
+}
+
+func newUnionFind() *unionFind {
+	return &unionFind{parent: make(map[string]string)}
+}
+
+func (u *unionFind) find(id string) string {
+	p, ok := u.parent[id]
+	if !ok {
+		u.parent[id] = id
+		return id
+	}
+	if p != id {
+		p = u.find(p)
+		u.parent[id] = p
+	}
+	return p
+}
+
+func (u *unionFind) union(a, b string) {
+	ra, rb := u.find(a), u.find(b)
+	if ra != rb {
+		u.parent[rb] = ra
+	}
+}
+
+// sets returns the groups of more than one ID
+func (u *unionFind) sets() [][]string {
+	byRoot := make(map[string][]string)
+	for id := range u.parent {
+		root := u.find(id)
+		byRoot[root] = append(byRoot[root], id)
+	}
+	var out [][]string
+	for _, ids := range byRoot {
+		if len(ids) > 1 {
+			out = append(out, ids)
+		}
+	}
+	return out
+}
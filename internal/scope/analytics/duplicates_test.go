@@ -0,0 +1,151 @@
+package analytics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/events"
+	"github.com/dsjohal14/selfstack/internal/relay"
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+	"github.com/rs/zerolog"
+)
+
+// near returns an embedding about 0.97 similar to e
+func near(t *testing.T, e relay.Embedding) relay.Embedding {
+	t.Helper()
+	other := relay.DeterministicEmbed("something else entirely")
+	v := make([]float32, relay.EmbeddingDim)
+	for i := range v {
+		v[i] = e[i] + 0.25*other[i]
+	}
+	out, err := relay.EmbeddingFrom(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sim := relay.CosineSimilarity(e, out); sim < DefaultThreshold || sim >= IdenticalScore {
+		t.Fatalf("expected a near but not identical embedding, got similarity %f", sim)
+	}
+	return out
+}
+
+func TestFindDuplicates(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	report1 := relay.DeterministicEmbed("quarterly report")
+	notes := relay.DeterministicEmbed("meeting notes")
+	part0, part1 := relay.DeterministicEmbed("chapter one"), relay.DeterministicEmbed("chapter two")
+
+	index := db.NewMemIndex()
+	add := func(id string, emb relay.Embedding, created time.Time, mutate ...func(*db.Document)) {
+		doc := db.Document{ID: id, Title: id, Source: "drive", CreatedAt: created, Embedding: emb}
+		for _, fn := range mutate {
+			fn(&doc)
+		}
+		index.Set(id, doc)
+	}
+	chunk := func(n string) func(*db.Document) {
+		return func(d *db.Document) { d.Metadata = map[string]string{"chunk_of": "book", "chunk": n} }
+	}
+	add("report-a", report1, t0)
+	add("report-b", report1, t0.Add(time.Hour)) // The same file synced twice
+	add("notes", notes, t0)
+	add("notes-edited", near(t, notes), t0.Add(time.Hour))
+	add("book:chunk:0", part0, t0, chunk("0"))
+	add("book:chunk:1", part1, t0, chunk("1"))
+	add("book-copy", relay.Centroid(part0, part1), t0.Add(-time.Hour))
+	add("report-other", report1, t0, func(d *db.Document) { d.Collection = "other" })
+	add("unrelated", relay.DeterministicEmbed("gardening tips"), t0)
+
+	report, err := FindDuplicates(context.Background(), index, 0)
+	if err != nil {
+		t.Fatalf("FindDuplicates: %v", err)
+	}
+	if report.Threshold != DefaultThreshold || report.Scanned != 8 {
+		t.Errorf("threshold = %v, scanned = %d, want %v and 8 (the book counted once)", report.Threshold, report.Scanned, DefaultThreshold)
+	}
+	if len(report.Groups) != 3 {
+		t.Fatalf("expected 3 groups, got %+v", report.Groups)
+	}
+
+	byKeep := make(map[string]DuplicateGroup)
+	for _, g := range report.Groups {
+		if len(g.Documents) != 2 {
+			t.Errorf("expected pairs, got %+v", g)
+		}
+		if g.Documents[0].Suggestion != SuggestKeep || g.Documents[0].Score != 1 {
+			t.Errorf("expected the first document to be kept, got %+v", g.Documents[0])
+		}
+		byKeep[g.Documents[0].ID] = g
+	}
+	if g, ok := byKeep["report-b"]; !ok || g.Documents[1].ID != "report-a" || g.Documents[1].Suggestion != SuggestDelete || g.Collection != db.DefaultCollection {
+		t.Errorf("expected the newer report kept and the older deleted, got %+v", report.Groups)
+	}
+	if g, ok := byKeep["notes-edited"]; !ok || g.Documents[1].ID != "notes" || g.Documents[1].Suggestion != SuggestMerge {
+		t.Errorf("expected the edited notes kept and the original merged, got %+v", report.Groups)
+	}
+	if g, ok := byKeep["book"]; !ok || g.Documents[1].ID != "book-copy" {
+		t.Errorf("expected the chunked book matched by its centroid, got %+v", report.Groups)
+	}
+}
+
+func TestFindDuplicatesCanceled(t *testing.T) {
+	index := db.NewMemIndex()
+	index.Set("a", db.Document{ID: "a", Embedding: relay.DeterministicEmbed("a")})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := FindDuplicates(ctx, index, 0); err == nil {
+		t.Error("expected an error for a canceled context")
+	}
+}
+
+func TestDuplicatesRun(t *testing.T) {
+	index := db.NewMemIndex()
+	emb := relay.DeterministicEmbed("same")
+	index.Set("a", db.Document{ID: "a", Embedding: emb})
+	index.Set("b", db.Document{ID: "b", Embedding: emb})
+
+	d := NewDuplicates(index, 0.9)
+	if _, ok := d.Report(); ok {
+		t.Error("expected no report before the first run")
+	}
+	if err := d.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	report, ok := d.Report()
+	if !ok || report.Threshold != 0.9 || len(report.Groups) != 1 {
+		t.Errorf("unexpected report %+v", report)
+	}
+}
+
+func TestDuplicatesSubscribe(t *testing.T) {
+	index := db.NewMemIndex()
+	emb := relay.DeterministicEmbed("same")
+	index.Set("a", db.Document{ID: "a", Embedding: emb})
+	bus := events.New(zerolog.Nop())
+	defer bus.Close()
+
+	d := NewDuplicates(index, 0.9)
+	d.Subscribe(bus)
+	ctx := context.Background()
+	if err := d.Run(ctx); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	first, _ := d.Report()
+
+	// Without an announced write the report is kept
+	index.Set("b", db.Document{ID: "b", Embedding: emb})
+	if err := d.Run(ctx); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if report, _ := d.Report(); report != first {
+		t.Error("expected the report kept while no write was announced")
+	}
+
+	bus.Publish(events.TopicWALApplied, db.AppliedRecord{DocID: "b"})
+	if err := d.Run(ctx); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if report, _ := d.Report(); report == first || len(report.Groups) != 1 {
+		t.Errorf("expected a new report with the duplicate, got %+v", report)
+	}
+}
@@ -0,0 +1,232 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MaxAliasLen limits the length of an alias, which is often a URL
+const MaxAliasLen = 2048
+
+// aliasKeyPrefix starts the KV entries of a KV-backed alias table; the rest
+// of the key is the alias and the value the document ID
+const aliasKeyPrefix = "alias/"
+
+// AliasTable maps stable external keys, like URLs or file paths, to the
+// document IDs they stand for, so connectors don't have to keep the mapping
+// themselves. An alias points at one document; a document can have many.
+// Every change is written through: to one KV entry per alias, or by
+// rewriting a JSON file for backends without KV entries.
+type AliasTable struct {
+	path string // Empty (and no kv) keeps the table in memory only
+	kv   KV
+
+	mu      sync.RWMutex
+	aliases map[string]string          // Alias -> doc ID
+	byDoc   map[string]map[string]bool // Doc ID -> its aliases
+}
+
+func newAliasTable() *AliasTable {
+	return &AliasTable{aliases: make(map[string]string), byDoc: make(map[string]map[string]bool)}
+}
+
+// NewAliasTable opens the alias table stored at path, or an empty one if
+// the file doesn't exist yet
+func NewAliasTable(path string) (*AliasTable, error) {
+	a := newAliasTable()
+	a.path = path
+	if path == "" {
+		return a, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return a, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read aliases: %w", err)
+	}
+	var aliases map[string]string
+	if err := json.Unmarshal(data, &aliases); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	for alias, docID := range aliases {
+		a.setLocked(alias, docID)
+	}
+	return a, nil
+}
+
+// NewKVAliasTable opens the alias table stored in kv, so it is recovered
+// and compacted with the documents
+func NewKVAliasTable(kv KV) *AliasTable {
+	a := newAliasTable()
+	a.kv = kv
+	a.Reload()
+	return a
+}
+
+// Reload rereads a KV-backed table from its store, as after WALStore.Reset
+// removed the aliases; other tables are left as they are
+func (a *AliasTable) Reload() {
+	if a.kv == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.aliases = make(map[string]string)
+	a.byDoc = make(map[string]map[string]bool)
+	for _, key := range a.kv.ListKV(aliasKeyPrefix) {
+		if docID, ok := a.kv.GetKV(key); ok {
+			a.setLocked(strings.TrimPrefix(key, aliasKeyPrefix), string(docID))
+		}
+	}
+}
+
+// ValidateAlias checks that alias can be stored
+func ValidateAlias(alias string) error {
+	if alias == "" || len(alias) > MaxAliasLen {
+		return fmt.Errorf("alias must be 1 to %d bytes", MaxAliasLen)
+	}
+	return nil
+}
+
+// Resolve returns the document ID alias points at
+func (a *AliasTable) Resolve(alias string) (string, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	docID, ok := a.aliases[alias]
+	return docID, ok
+}
+
+// AliasesOf returns the aliases pointing at docID, sorted
+func (a *AliasTable) AliasesOf(docID string) []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	list := make([]string, 0, len(a.byDoc[docID]))
+	for alias := range a.byDoc[docID] {
+		list = append(list, alias)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// Set points each alias at docID, taking it from whatever document it
+// pointed at before
+func (a *AliasTable) Set(ctx context.Context, docID string, aliases ...string) error {
+	for _, alias := range aliases {
+		if err := ValidateAlias(alias); err != nil {
+			return err
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	changed := false
+	for _, alias := range aliases {
+		if a.aliases[alias] == docID {
+			continue
+		}
+		if a.kv != nil {
+			if err := a.kv.SetKV(ctx, aliasKeyPrefix+alias, []byte(docID)); err != nil {
+				return fmt.Errorf("failed to store alias: %w", err)
+			}
+		}
+		a.setLocked(alias, docID)
+		changed = true
+	}
+	if changed {
+		return a.saveLocked()
+	}
+	return nil
+}
+
+// Move points every alias of from at to, as when a document is renamed
+func (a *AliasTable) Move(ctx context.Context, from, to string) error {
+	if from == to {
+		return nil
+	}
+	return a.Set(ctx, to, a.AliasesOf(from)...)
+}
+
+// Remove deletes aliases; removing a missing one is not an error
+func (a *AliasTable) Remove(ctx context.Context, aliases ...string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	changed := false
+	for _, alias := range aliases {
+		if _, ok := a.aliases[alias]; !ok {
+			continue
+		}
+		if a.kv != nil {
+			if err := a.kv.DeleteKV(ctx, aliasKeyPrefix+alias); err != nil {
+				return fmt.Errorf("failed to delete alias: %w", err)
+			}
+		}
+		a.removeLocked(alias)
+		changed = true
+	}
+	if changed {
+		return a.saveLocked()
+	}
+	return nil
+}
+
+// RemoveDoc deletes every alias pointing at docID, as when it is deleted
+func (a *AliasTable) RemoveDoc(ctx context.Context, docID string) error {
+	return a.Remove(ctx, a.AliasesOf(docID)...)
+}
+
+// Len returns the number of aliases
+func (a *AliasTable) Len() int {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return len(a.aliases)
+}
+
+func (a *AliasTable) setLocked(alias, docID string) {
+	a.removeLocked(alias)
+	a.aliases[alias] = docID
+	if a.byDoc[docID] == nil {
+		a.byDoc[docID] = make(map[string]bool)
+	}
+	a.byDoc[docID][alias] = true
+}
+
+func (a *AliasTable) removeLocked(alias string) {
+	prev, ok := a.aliases[alias]
+	if !ok {
+		return
+	}
+	delete(a.aliases, alias)
+	delete(a.byDoc[prev], alias)
+	if len(a.byDoc[prev]) == 0 {
+		delete(a.byDoc, prev)
+	}
+}
+
+// saveLocked rewrites the file of a file-backed table through a temp file
+func (a *AliasTable) saveLocked() error {
+	if a.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(a.aliases)
+	if err != nil {
+		return fmt.Errorf("failed to encode aliases: %w", err)
+	}
+	tmpPath := a.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to write aliases: %w", err)
+	}
+	if err := os.Rename(tmpPath, a.path); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to move aliases file: %w", err)
+	}
+	return nil
+}
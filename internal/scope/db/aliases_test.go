@@ -0,0 +1,92 @@
+package db
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAliasTable(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "aliases.json")
+	a, err := NewAliasTable(path)
+	if err != nil {
+		t.Fatalf("NewAliasTable failed: %v", err)
+	}
+
+	if err := a.Set(ctx, "doc-1", "https://wiki/a", "notes/a.md"); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	if err := a.Set(ctx, "doc-2", "https://wiki/b"); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	if id, ok := a.Resolve("notes/a.md"); !ok || id != "doc-1" {
+		t.Errorf("resolve = %q %v, want doc-1", id, ok)
+	}
+
+	// An alias set on another document moves to it
+	if err := a.Set(ctx, "doc-2", "notes/a.md"); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	if got := a.AliasesOf("doc-1"); len(got) != 1 || got[0] != "https://wiki/a" {
+		t.Errorf("aliases of doc-1 = %v", got)
+	}
+
+	if err := a.Move(ctx, "doc-2", "doc-3"); err != nil {
+		t.Fatalf("move failed: %v", err)
+	}
+	if got := a.AliasesOf("doc-3"); len(got) != 2 || len(a.AliasesOf("doc-2")) != 0 {
+		t.Errorf("aliases after move = %v, doc-2 kept %v", got, a.AliasesOf("doc-2"))
+	}
+	if err := a.RemoveDoc(ctx, "doc-1"); err != nil {
+		t.Fatalf("remove failed: %v", err)
+	}
+	if _, ok := a.Resolve("https://wiki/a"); ok {
+		t.Error("alias of a removed document still resolves")
+	}
+
+	if err := a.Set(ctx, "doc-1", ""); err == nil {
+		t.Error("expected an empty alias to be rejected")
+	}
+	if err := a.Set(ctx, "doc-1", strings.Repeat("x", MaxAliasLen+1)); err == nil {
+		t.Error("expected an oversized alias to be rejected")
+	}
+
+	reopened, err := NewAliasTable(path)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	if id, ok := reopened.Resolve("https://wiki/b"); !ok || id != "doc-3" || reopened.Len() != 2 {
+		t.Errorf("reopened table: resolve = %q %v, len %d", id, ok, reopened.Len())
+	}
+}
+
+func TestKVAliasTable(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := NewWALStore(ctx, DefaultWALStoreConfig(dir))
+	if err != nil {
+		t.Fatalf("failed to create WAL store: %v", err)
+	}
+	a := NewKVAliasTable(store)
+	if err := a.Set(ctx, "doc-1", "s3://bucket/report.pdf", "report"); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	if err := a.Remove(ctx, "report"); err != nil {
+		t.Fatalf("remove failed: %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+
+	store, err = NewWALStore(ctx, DefaultWALStoreConfig(dir))
+	if err != nil {
+		t.Fatalf("failed to reopen WAL store: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+	a = NewKVAliasTable(store)
+	if id, ok := a.Resolve("s3://bucket/report.pdf"); !ok || id != "doc-1" || a.Len() != 1 {
+		t.Errorf("recovered table: resolve = %q %v, len %d", id, ok, a.Len())
+	}
+}
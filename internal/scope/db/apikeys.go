@@ -0,0 +1,412 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// apiKeyPrefix starts the KV entries of a KV-backed key store; the rest of
+// the key is the API key's ID and the value its JSON
+const apiKeyPrefix = "apikey/"
+
+// DefaultRotationOverlap is how long a rotated key keeps working next to
+// the key that replaced it, so clients can switch over
+const DefaultRotationOverlap = 24 * time.Hour
+
+// lastUsedPrecision is how far a key's last use has to move before it is
+// written through, so a busy key doesn't write an entry per request
+const lastUsedPrecision = time.Minute
+
+// Key store errors
+var (
+	ErrKeyNotFound = errors.New("API key not found")
+	ErrKeyExpired  = errors.New("API key has expired")
+	ErrKeyRotated  = errors.New("API key was already rotated")
+	ErrInvalidKey  = errors.New("invalid API key")
+)
+
+// APIKey is a managed API key. Its secret is returned once, when the key
+// is created or rotated; only the secret's SHA-256 is stored.
+type APIKey struct {
+	ID         string     `json:"id"` // "ak_" and 12 random hex digits
+	Name       string     `json:"name,omitempty"`
+	Namespaces []string   `json:"namespaces,omitempty"` // Collections the key may use; empty for all
+	UsageKey   string     `json:"usage_key"`            // What /admin/usage and the *_KEYS settings call it
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`   // Nil for a key that doesn't expire
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"` // To the minute
+	RotatedTo  string     `json:"rotated_to,omitempty"`   // ID of the key that replaced it
+}
+
+// Expired reports whether k has expired at now
+func (k APIKey) Expired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+// Allows reports whether k may use the named collection
+func (k APIKey) Allows(collection string) bool {
+	if len(k.Namespaces) == 0 {
+		return true
+	}
+	for _, ns := range k.Namespaces {
+		if ns == collection {
+			return true
+		}
+	}
+	return false
+}
+
+// KeySpec is what an API key is created with
+type KeySpec struct {
+	Name       string
+	Namespaces []string   // Empty for every collection
+	ExpiresAt  *time.Time // Nil for no expiry
+}
+
+// KeyUpdate changes an API key; nil fields are left as they are
+type KeyUpdate struct {
+	Name       *string
+	Namespaces []string // Empty but not nil allows every collection
+	ExpiresAt  *time.Time
+}
+
+// keyRecord is an API key as stored
+type keyRecord struct {
+	APIKey
+	Hash string `json:"hash"` // Hex SHA-256 of the secret
+
+	savedUse time.Time // Last use as of the last write
+}
+
+// APIKeyStore holds the managed API keys. Every change is written
+// through: to one KV entry per key, or by rewriting a JSON file for
+// backends without KV entries.
+type APIKeyStore struct {
+	path string // Empty (and no kv) keeps the keys in memory only
+	kv   KV
+
+	mu     sync.RWMutex
+	keys   map[string]*keyRecord // ID -> key
+	byHash map[string]string     // Secret's SHA-256 -> ID
+}
+
+func newAPIKeyStore() *APIKeyStore {
+	return &APIKeyStore{keys: make(map[string]*keyRecord), byHash: make(map[string]string)}
+}
+
+// NewAPIKeyStore opens the key store at path, or an empty one if the file
+// doesn't exist yet
+func NewAPIKeyStore(path string) (*APIKeyStore, error) {
+	s := newAPIKeyStore()
+	s.path = path
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API keys: %w", err)
+	}
+	var records []*keyRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	for _, rec := range records {
+		s.addLocked(rec)
+	}
+	return s, nil
+}
+
+// NewKVAPIKeyStore opens the key store in kv, so it is recovered and
+// compacted with the documents
+func NewKVAPIKeyStore(kv KV) (*APIKeyStore, error) {
+	s := newAPIKeyStore()
+	s.kv = kv
+	for _, key := range kv.ListKV(apiKeyPrefix) {
+		data, _ := kv.GetKV(key)
+		var rec keyRecord
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return nil, fmt.Errorf("failed to parse API key %s: %w", key, err)
+		}
+		s.addLocked(&rec)
+	}
+	return s, nil
+}
+
+func (s *APIKeyStore) addLocked(rec *keyRecord) {
+	if rec.LastUsedAt != nil {
+		rec.savedUse = *rec.LastUsedAt
+	}
+	s.keys[rec.ID] = rec
+	s.byHash[rec.Hash] = rec.ID
+}
+
+// hashSecret returns the hex SHA-256 of a secret
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomHex returns n random bytes in hex
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// validateNamespaces checks that namespaces are collection names
+func validateNamespaces(namespaces []string) error {
+	for _, ns := range namespaces {
+		if !collectionNameRE.MatchString(ns) {
+			return fmt.Errorf("%w: namespace %q is not a collection name", ErrInvalidKey, ns)
+		}
+	}
+	return nil
+}
+
+// Create adds a key and returns it with its secret
+func (s *APIKeyStore) Create(ctx context.Context, spec KeySpec) (APIKey, string, error) {
+	now := time.Now().UTC()
+	if err := validateNamespaces(spec.Namespaces); err != nil {
+		return APIKey{}, "", err
+	}
+	if spec.ExpiresAt != nil && !spec.ExpiresAt.After(now) {
+		return APIKey{}, "", fmt.Errorf("%w: expires_at must be in the future", ErrInvalidKey)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.createLocked(ctx, spec, now)
+}
+
+func (s *APIKeyStore) createLocked(ctx context.Context, spec KeySpec, now time.Time) (APIKey, string, error) {
+	id, err := randomHex(6)
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	secret, err := randomHex(24)
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	secret = "sk_" + secret
+	hash := hashSecret(secret)
+	rec := &keyRecord{
+		APIKey: APIKey{
+			ID:         "ak_" + id,
+			Name:       spec.Name,
+			Namespaces: spec.Namespaces,
+			UsageKey:   "key_" + hash[:12],
+			CreatedAt:  now,
+			ExpiresAt:  spec.ExpiresAt,
+		},
+		Hash: hash,
+	}
+	if err := s.saveLocked(ctx, rec); err != nil {
+		return APIKey{}, "", err
+	}
+	return rec.APIKey, secret, nil
+}
+
+// Get returns the key with ID id
+func (s *APIKeyStore) Get(id string) (APIKey, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rec, ok := s.keys[id]
+	if !ok {
+		return APIKey{}, false
+	}
+	return rec.APIKey, true
+}
+
+// List returns every key, oldest first
+func (s *APIKeyStore) List() []APIKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]APIKey, 0, len(s.keys))
+	for _, rec := range s.keys {
+		list = append(list, rec.APIKey)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].CreatedAt.Equal(list[j].CreatedAt) {
+			return list[i].CreatedAt.Before(list[j].CreatedAt)
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// Authenticate returns the key whose secret is secret and records its use
+// at now. An expired key is returned with ErrKeyExpired.
+func (s *APIKeyStore) Authenticate(ctx context.Context, secret string, now time.Time) (APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.keys[s.byHash[hashSecret(secret)]]
+	if !ok {
+		return APIKey{}, ErrKeyNotFound
+	}
+	if rec.Expired(now) {
+		return rec.APIKey, ErrKeyExpired
+	}
+
+	used := now.UTC().Truncate(lastUsedPrecision)
+	rec.LastUsedAt = &used
+	if used.Sub(rec.savedUse) >= lastUsedPrecision {
+		// Losing a last-used time costs nothing, so a failed write doesn't
+		// fail the request
+		_ = s.saveLocked(ctx, rec)
+	}
+	return rec.APIKey, nil
+}
+
+// Update changes the key with ID id
+func (s *APIKeyStore) Update(ctx context.Context, id string, u KeyUpdate) (APIKey, error) {
+	if err := validateNamespaces(u.Namespaces); err != nil {
+		return APIKey{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.keys[id]
+	if !ok {
+		return APIKey{}, ErrKeyNotFound
+	}
+	next := *rec
+	if u.Name != nil {
+		next.Name = *u.Name
+	}
+	if u.Namespaces != nil {
+		next.Namespaces = u.Namespaces
+	}
+	if u.ExpiresAt != nil {
+		next.ExpiresAt = u.ExpiresAt
+	}
+	if err := s.saveLocked(ctx, &next); err != nil {
+		return APIKey{}, err
+	}
+	return next.APIKey, nil
+}
+
+// Rotate replaces the key with ID id with a new one with the same name and
+// namespaces, and returns the new key with its secret. The old key keeps
+// working for overlap (or until it would have expired, if sooner) so
+// clients can switch over. A key that expires gets a replacement with the
+// same lifetime.
+func (s *APIKeyStore) Rotate(ctx context.Context, id string, overlap time.Duration) (APIKey, string, error) {
+	now := time.Now().UTC()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.keys[id]
+	switch {
+	case !ok:
+		return APIKey{}, "", ErrKeyNotFound
+	case rec.RotatedTo != "":
+		return APIKey{}, "", fmt.Errorf("%w to %s", ErrKeyRotated, rec.RotatedTo)
+	case rec.Expired(now):
+		return APIKey{}, "", ErrKeyExpired
+	}
+
+	spec := KeySpec{Name: rec.Name, Namespaces: rec.Namespaces}
+	if rec.ExpiresAt != nil {
+		expires := now.Add(rec.ExpiresAt.Sub(rec.CreatedAt))
+		spec.ExpiresAt = &expires
+	}
+	// The new key is stored first, so a failure leaves the old one as it was
+	key, secret, err := s.createLocked(ctx, spec, now)
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	old := *rec
+	old.RotatedTo = key.ID
+	if end := now.Add(overlap); old.ExpiresAt == nil || end.Before(*old.ExpiresAt) {
+		old.ExpiresAt = &end
+	}
+	if err := s.saveLocked(ctx, &old); err != nil {
+		return APIKey{}, "", err
+	}
+	return key, secret, nil
+}
+
+// Delete removes the key with ID id, revoking it at once
+func (s *APIKeyStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.keys[id]
+	if !ok {
+		return ErrKeyNotFound
+	}
+	if s.kv != nil {
+		if err := s.kv.DeleteKV(ctx, apiKeyPrefix+id); err != nil {
+			return fmt.Errorf("failed to delete API key: %w", err)
+		}
+	}
+	delete(s.keys, id)
+	delete(s.byHash, rec.Hash)
+	return s.writeFileLocked()
+}
+
+// saveLocked writes rec through and makes it the stored version of its key
+func (s *APIKeyStore) saveLocked(ctx context.Context, rec *keyRecord) error {
+	if s.kv != nil {
+		data, err := json.Marshal(rec)
+		if err != nil {
+			return fmt.Errorf("failed to encode API key: %w", err)
+		}
+		if err := s.kv.SetKV(ctx, apiKeyPrefix+rec.ID, data); err != nil {
+			return fmt.Errorf("failed to store API key: %w", err)
+		}
+	}
+	prev := s.keys[rec.ID]
+	s.addLocked(rec)
+	if err := s.writeFileLocked(); err != nil {
+		if prev != nil {
+			s.addLocked(prev)
+		} else {
+			delete(s.keys, rec.ID)
+			delete(s.byHash, rec.Hash)
+		}
+		return err
+	}
+	return nil
+}
+
+// writeFileLocked rewrites the file of a file-backed store through a temp
+// file. The file holds the keys' hashes, so only its owner can read it.
+func (s *APIKeyStore) writeFileLocked() error {
+	if s.path == "" {
+		return nil
+	}
+	records := make([]*keyRecord, 0, len(s.keys))
+	for _, rec := range s.keys {
+		records = append(records, rec)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+	data, err := json.Marshal(records)
+	if err != nil {
+		return fmt.Errorf("failed to encode API keys: %w", err)
+	}
+	tmpPath := s.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to write API keys: %w", err)
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to move API keys file: %w", err)
+	}
+	return nil
+}
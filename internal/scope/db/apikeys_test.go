@@ -0,0 +1,130 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAPIKeyStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "api_keys.json")
+	s, err := NewAPIKeyStore(path)
+	if err != nil {
+		t.Fatalf("NewAPIKeyStore failed: %v", err)
+	}
+
+	if _, _, err := s.Create(ctx, KeySpec{Namespaces: []string{"Not A Collection"}}); err == nil {
+		t.Error("expected an invalid namespace to be refused")
+	}
+	expires := time.Now().Add(30 * 24 * time.Hour)
+	key, secret, err := s.Create(ctx, KeySpec{Name: "ci", Namespaces: []string{"docs"}, ExpiresAt: &expires})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if !key.Allows("docs") || key.Allows("default") {
+		t.Errorf("expected the key to allow only docs, got %v", key.Namespaces)
+	}
+
+	now := time.Now()
+	got, err := s.Authenticate(ctx, secret, now)
+	if err != nil || got.ID != key.ID || got.LastUsedAt == nil {
+		t.Fatalf("Authenticate = %+v, %v; want %s with its last use", got, err, key.ID)
+	}
+	if _, err := s.Authenticate(ctx, secret+"x", now); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("expected a wrong secret to be unknown, got %v", err)
+	}
+	if _, err := s.Authenticate(ctx, secret, expires.Add(time.Second)); !errors.Is(err, ErrKeyExpired) {
+		t.Errorf("expected the key to expire, got %v", err)
+	}
+
+	// The old key works until the overlap ends, and the new one after it
+	next, nextSecret, err := s.Rotate(ctx, key.ID, time.Hour)
+	if err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	if next.Name != "ci" || next.Namespaces[0] != "docs" || next.ExpiresAt == nil {
+		t.Errorf("expected the new key to keep the name, namespaces, and lifetime, got %+v", next)
+	}
+	if old, _ := s.Get(key.ID); old.RotatedTo != next.ID {
+		t.Errorf("expected the old key to point at %s, got %+v", next.ID, old)
+	}
+	if _, err := s.Authenticate(ctx, secret, now.Add(30*time.Minute)); err != nil {
+		t.Errorf("expected the old key to work during the overlap, got %v", err)
+	}
+	if _, err := s.Authenticate(ctx, secret, now.Add(2*time.Hour)); !errors.Is(err, ErrKeyExpired) {
+		t.Errorf("expected the old key to expire after the overlap, got %v", err)
+	}
+	if _, err := s.Authenticate(ctx, nextSecret, now.Add(2*time.Hour)); err != nil {
+		t.Errorf("expected the new key to work, got %v", err)
+	}
+	if _, _, err := s.Rotate(ctx, key.ID, time.Hour); !errors.Is(err, ErrKeyRotated) {
+		t.Errorf("expected a second rotation to be refused, got %v", err)
+	}
+
+	name := "deploys"
+	if updated, err := s.Update(ctx, next.ID, KeyUpdate{Name: &name, Namespaces: []string{}}); err != nil || updated.Name != name || !updated.Allows("default") {
+		t.Errorf("Update = %+v, %v; want renamed and unscoped", updated, err)
+	}
+
+	// Reopening reads back the keys, including the rotation
+	reopened, err := NewAPIKeyStore(path)
+	if err != nil {
+		t.Fatalf("failed to reopen: %v", err)
+	}
+	if keys := reopened.List(); len(keys) != 2 || keys[0].ID != key.ID || keys[1].Name != name {
+		t.Fatalf("expected both keys after reopening, got %+v", keys)
+	}
+	if _, err := reopened.Authenticate(ctx, nextSecret, now); err != nil {
+		t.Errorf("expected the new key to work after reopening, got %v", err)
+	}
+
+	if err := reopened.Delete(ctx, next.ID); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := reopened.Authenticate(ctx, nextSecret, now); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("expected a deleted key to be unknown, got %v", err)
+	}
+}
+
+func TestKVAPIKeyStore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := NewWALStore(ctx, DefaultWALStoreConfig(dir))
+	if err != nil {
+		t.Fatalf("failed to create WAL store: %v", err)
+	}
+	s, err := NewKVAPIKeyStore(store)
+	if err != nil {
+		t.Fatalf("NewKVAPIKeyStore failed: %v", err)
+	}
+	key, secret, err := s.Create(ctx, KeySpec{Name: "ci"})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if _, err := s.Authenticate(ctx, secret, time.Now()); err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+
+	store, err = NewWALStore(ctx, DefaultWALStoreConfig(dir))
+	if err != nil {
+		t.Fatalf("failed to reopen WAL store: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+	s, err = NewKVAPIKeyStore(store)
+	if err != nil {
+		t.Fatalf("failed to reopen: %v", err)
+	}
+	got, ok := s.Get(key.ID)
+	if !ok || got.LastUsedAt == nil || got.UsageKey != key.UsageKey {
+		t.Errorf("expected the key with its last use, got %+v", got)
+	}
+	if _, err := s.Authenticate(ctx, secret, time.Now()); err != nil {
+		t.Errorf("expected the key to work after reopening, got %v", err)
+	}
+}
@@ -0,0 +1,217 @@
+package db
+
+import (
+	"context"
+	"sync"
+
+	"github.com/dsjohal14/selfstack/internal/scope/db/wal"
+)
+
+// applyBuffer is how many writes the applier can fall behind by before
+// writers wait for it
+const applyBuffer = 4096
+
+// indexChange is what one write does to the index
+type indexChange struct {
+	id         string
+	doc        Document // Zero for deletes
+	deleted    bool
+	indexed    bool // Already in the index, like a staged write reaching the WAL; only announced
+	lsn        uint64
+	recType    wal.RecordType
+	collection string // Of the document, announced with the record
+}
+
+// applyBatch is the changes of one write and the watermark after them
+type applyBatch struct {
+	changes []indexChange
+	next    uint64 // appliedLSN once applied; 0 leaves it
+	seq     uint64
+}
+
+// pendingDoc is the latest queued version of a document
+type pendingDoc struct {
+	doc     Document
+	deleted bool
+	seq     uint64 // Of the batch writing it
+}
+
+// applier updates the index behind the WAL on a goroutine of its own, so a
+// write returns once it's durable instead of after indexing it. Writers
+// still decide inserts against updates, and the index budget, from what
+// they've written: pending holds what's queued but not applied.
+type applier struct {
+	ch   chan applyBatch
+	done <-chan struct{} // Closed when the goroutine exits
+
+	mu       sync.Mutex
+	pending  map[string]pendingDoc
+	queued   uint64        // seq of the latest batch queued
+	applied  uint64        // seq of the latest batch applied
+	progress chan struct{} // Closed and replaced whenever a batch is applied
+}
+
+// startApplier starts applying queued writes to s's index on sup
+func (s *WALStore) startApplier(sup wal.Supervisor) {
+	a := &applier{
+		ch:       make(chan applyBatch, applyBuffer),
+		pending:  make(map[string]pendingDoc),
+		progress: make(chan struct{}),
+	}
+	a.done = sup.Go(context.Background(), "wal-apply", func(context.Context) error {
+		for b := range a.ch {
+			// Finished even if it panics, so waiters aren't stranded
+			// while the loop restarts
+			func() {
+				defer a.finish(b)
+				s.applyChanges(b.changes, b.next)
+			}()
+		}
+		return nil
+	})
+	s.applier = a
+}
+
+// enqueue queues a batch, waiting while the applier is applyBuffer
+// batches behind
+func (a *applier) enqueue(changes []indexChange, next uint64) {
+	a.mu.Lock()
+	a.queued++
+	seq := a.queued
+	for _, c := range changes {
+		if !c.indexed {
+			a.pending[c.id] = pendingDoc{doc: c.doc, deleted: c.deleted, seq: seq}
+		}
+	}
+	a.mu.Unlock()
+	a.ch <- applyBatch{changes: changes, next: next, seq: seq}
+}
+
+// finish marks b applied and wakes the waiters. Documents written again
+// since b stay pending.
+func (a *applier) finish(b applyBatch) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, c := range b.changes {
+		if p, ok := a.pending[c.id]; ok && p.seq == b.seq {
+			delete(a.pending, c.id)
+		}
+	}
+	a.applied = b.seq
+	close(a.progress)
+	a.progress = make(chan struct{})
+}
+
+// lookup returns the queued version of id; known is false if none is
+// queued and the index is up to date for it
+func (a *applier) lookup(id string) (doc Document, ok, known bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	p, known := a.pending[id]
+	return p.doc, known && !p.deleted, known
+}
+
+// wait returns once every batch queued before it was called is applied
+func (a *applier) wait(ctx context.Context) error {
+	a.mu.Lock()
+	target := a.queued
+	for a.applied < target {
+		progress := a.progress
+		a.mu.Unlock()
+		select {
+		case <-progress:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		a.mu.Lock()
+	}
+	a.mu.Unlock()
+	return nil
+}
+
+// lag is the number of batches queued but not applied yet
+func (a *applier) lag() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return int(a.queued - a.applied)
+}
+
+// stop applies what's queued and ends the goroutine
+func (a *applier) stop() {
+	close(a.ch)
+	<-a.done
+}
+
+// applyLocked applies changes to the index and moves the watermark to
+// next, unless it's 0. With asynchronous apply they're queued instead.
+func (s *WALStore) applyLocked(changes []indexChange, next uint64) {
+	if s.applier != nil {
+		s.applier.enqueue(changes, next)
+		return
+	}
+	s.applyChanges(changes, next)
+}
+
+// applyChanges updates the index and announces each record
+func (s *WALStore) applyChanges(changes []indexChange, next uint64) {
+	for _, c := range changes {
+		switch {
+		case c.indexed:
+		case c.deleted:
+			s.index.Delete(c.id)
+		default:
+			s.index.Set(c.id, c.doc)
+		}
+		if c.lsn != 0 {
+			s.publishApplied(c.lsn, c.recType, c.id, c.collection)
+		}
+	}
+	if next != 0 {
+		s.appliedLSN.Store(next)
+	}
+}
+
+// lookupLocked returns a document as the write path sees it, including
+// writes not applied to the index yet
+func (s *WALStore) lookupLocked(id string) (Document, bool) {
+	if s.applier != nil {
+		if doc, ok, known := s.applier.lookup(id); known {
+			return doc, ok
+		}
+	}
+	return s.index.Get(id)
+}
+
+// GetLatest returns a document as the next write will see it, including
+// writes acknowledged but not applied to the index yet. Requests that read
+// a document before replacing it use it rather than wait for every queued
+// write with Barrier.
+func (s *WALStore) GetLatest(docID string) (Document, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.lookupLocked(docID)
+}
+
+// hasLocked reports whether a document exists as the write path sees it
+func (s *WALStore) hasLocked(id string) bool {
+	_, ok := s.lookupLocked(id)
+	return ok
+}
+
+// drainLocked waits until every write is applied to the index, for work
+// that reads the whole index, like checkpoints, under s.mu
+func (s *WALStore) drainLocked() {
+	if s.applier != nil {
+		_ = s.applier.wait(context.Background())
+	}
+}
+
+// Barrier returns once every write acknowledged before it was called is
+// visible to reads, for read-your-writes with asynchronous apply. Without
+// it writes are applied before they return, so it returns at once.
+func (s *WALStore) Barrier(ctx context.Context) error {
+	if s.applier == nil {
+		return nil
+	}
+	return s.applier.wait(ctx)
+}
@@ -0,0 +1,167 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/scope/db/wal"
+)
+
+// backfillSyncEvery is how many records a backfill appends between fsyncs
+const backfillSyncEvery = 4096
+
+// Backfill loads a large corpus through a path made for it rather than one
+// Add at a time: records are appended to the WAL without waiting on fsync,
+// synced every few thousand records, and indexed all at once by Finish.
+// Documents aren't visible to Get or searches until then. A crash loses at
+// most the records since the last sync; recovery indexes the rest.
+type Backfill struct {
+	store *WALStore
+	start time.Time
+
+	// Guarded by store.mu
+	pending  map[string]Document       // Written but not yet indexed; later writes of an ID by others drop it
+	reserved int64                     // Index memory pending documents will take
+	records  map[string]wal.RecordType // Type of each pending document's last record
+	lsns     map[string]uint64         // LSN of each pending document's last record
+	lastLSN  uint64
+	unsynced int
+	stats    BackfillStats
+	done     bool
+}
+
+// BackfillStats reports a backfill's throughput
+type BackfillStats struct {
+	Documents int           // Records written, counting every chunk
+	Bytes     int64         // WAL payload bytes written
+	Syncs     int           // Fsyncs, including the final one
+	Indexed   int           // Documents indexed by Finish; rewrites of an ID count once
+	WriteTime time.Duration // From BeginBackfill to Finish
+	IndexTime time.Duration // Building the index in Finish
+}
+
+// BeginBackfill starts a backfill. Call Finish when done, even after an
+// error, so what was written is indexed.
+func (s *WALStore) BeginBackfill() *Backfill {
+	b := &Backfill{
+		store:   s,
+		start:   time.Now(),
+		pending: make(map[string]Document),
+		records: make(map[string]wal.RecordType),
+		lsns:    make(map[string]uint64),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.backfills == nil {
+		s.backfills = make(map[*Backfill]struct{})
+	}
+	s.backfills[b] = struct{}{}
+	return b
+}
+
+// supersedeBackfillsLocked drops docID from running backfills: a write that
+// reaches the WAL after theirs must win once they are indexed
+func (s *WALStore) supersedeBackfillsLocked(docID string) {
+	for b := range s.backfills {
+		delete(b.pending, docID)
+		delete(b.records, docID)
+		delete(b.lsns, docID)
+	}
+}
+
+// Add writes doc to the WAL. It is indexed by Finish.
+func (b *Backfill) Add(ctx context.Context, doc Document) error {
+	s := b.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return fmt.Errorf("store is closed")
+	}
+	if b.done {
+		return fmt.Errorf("backfill is finished")
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := s.reserveIndexLocked(doc, b.reserved); err != nil {
+		return err
+	}
+	if err := s.unstageLocked(doc.ID); err != nil {
+		return err
+	}
+
+	recType := wal.RecordTypeInsert
+	if _, ok := b.pending[doc.ID]; ok || s.hasLocked(doc.ID) {
+		recType = wal.RecordTypeUpdate
+	}
+	payload, err := encodeDoc(doc)
+	if err != nil {
+		return err
+	}
+	lsn, err := s.writer.Append(recType, payload)
+	if err != nil {
+		return fmt.Errorf("failed to write to WAL: %w", err)
+	}
+
+	b.pending[doc.ID] = doc
+	b.records[doc.ID] = recType
+	b.lsns[doc.ID] = lsn
+	b.reserved += docBytes(doc)
+	b.lastLSN = lsn
+	b.stats.Documents++
+	b.stats.Bytes += int64(len(payload))
+
+	if b.unsynced++; b.unsynced >= backfillSyncEvery {
+		return b.syncLocked()
+	}
+	return nil
+}
+
+// syncLocked fsyncs the records appended since the last sync
+func (b *Backfill) syncLocked() error {
+	if err := b.store.writer.Sync(); err != nil {
+		return fmt.Errorf("failed to sync WAL: %w", err)
+	}
+	b.unsynced = 0
+	b.stats.Syncs++
+	return nil
+}
+
+// Finish syncs the WAL and indexes every document written, in one pass.
+// Writes wait while the index is built. Calling it again returns the same
+// stats.
+func (b *Backfill) Finish() (BackfillStats, error) {
+	s := b.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if b.done {
+		return b.stats, nil
+	}
+	b.done = true
+	delete(s.backfills, b)
+	b.stats.WriteTime = time.Since(b.start)
+
+	var err error
+	if b.unsynced > 0 && !s.closed {
+		err = b.syncLocked()
+	}
+
+	// Indexed even if the sync failed: recovery would index them too.
+	// Queued writes go first, so the watermark only moves forward.
+	s.drainLocked()
+	start := time.Now()
+	s.index.SetMany(b.pending)
+	b.stats.Indexed = len(b.pending)
+	b.stats.IndexTime = time.Since(start)
+	for id, doc := range b.pending {
+		s.publishApplied(b.lsns[id], b.records[id], id, doc.Collection)
+	}
+	if b.stats.Documents > 0 && b.lastLSN+1 > s.appliedLSN.Load() {
+		s.appliedLSN.Store(b.lastLSN + 1)
+	}
+	b.pending, b.records, b.lsns = nil, nil, nil
+	return b.stats, err
+}
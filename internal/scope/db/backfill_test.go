@@ -0,0 +1,83 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/relay"
+	"github.com/dsjohal14/selfstack/internal/scope/db/wal"
+)
+
+func TestWALStoreBackfill(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	config := DefaultWALStoreConfig(dir)
+	config.SyncPolicy = wal.ImmediateSyncPolicy()
+	config.KeywordIndex = true
+
+	store, err := NewWALStore(ctx, config)
+	if err != nil {
+		t.Fatalf("failed to create WAL store: %v", err)
+	}
+
+	doc := func(id, text string) Document {
+		return Document{ID: id, Source: "test", Title: id, Text: text, CreatedAt: time.Now(), Embedding: relay.DeterministicEmbed(text)}
+	}
+	b := store.BeginBackfill()
+	n := backfillSyncEvery + 10
+	for i := 0; i < n; i++ {
+		if err := b.Add(ctx, doc(fmt.Sprintf("doc-%d", i), "backfilled archive")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, found := store.Get("doc-0"); found {
+		t.Fatal("backfilled document indexed before Finish")
+	}
+
+	// Writes made during the backfill win over its older versions
+	_ = store.Add(doc("doc-1", "edited live"))
+	_ = store.Delete("doc-2")
+
+	stats, err := b.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Documents != n || stats.Indexed != n-2 || stats.Syncs != 2 || stats.Bytes == 0 {
+		t.Errorf("stats = %+v", stats)
+	}
+	if err := b.Add(ctx, doc("late", "late")); err == nil {
+		t.Error("Add after Finish succeeded")
+	}
+	if store.Count() != n-1 {
+		t.Errorf("count = %d, want %d", store.Count(), n-1)
+	}
+	if d, _ := store.Get("doc-1"); d.Text != "edited live" {
+		t.Errorf("doc-1 = %q, want the live edit", d.Text)
+	}
+	if _, found := store.Get("doc-2"); found {
+		t.Error("doc-2 was deleted during the backfill")
+	}
+	if results, _ := store.KeywordSearch("archive", n, SearchFilter{}); len(results) != n-2 {
+		t.Errorf("keyword matches = %d, want %d", len(results), n-2)
+	}
+	if store.IndexLSN() <= uint64(n) {
+		t.Errorf("index LSN = %d, want past the backfill", store.IndexLSN())
+	}
+	_ = store.Close()
+
+	// Recovery replays the same history
+	store, err = NewWALStore(ctx, config)
+	if err != nil {
+		t.Fatalf("failed to reopen WAL store: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+	if store.Count() != n-1 {
+		t.Errorf("count after recovery = %d, want %d", store.Count(), n-1)
+	}
+	if d, _ := store.Get("doc-1"); d.Text != "edited live" {
+		t.Errorf("doc-1 after recovery = %q", d.Text)
+	}
+}
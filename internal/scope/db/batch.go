@@ -0,0 +1,152 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dsjohal14/selfstack/internal/scope/db/wal"
+)
+
+// BatchOp is one write of a batch: Doc is stored, or, when Delete is set,
+// the document with that ID is deleted
+type BatchOp struct {
+	Doc    Document
+	Delete string
+}
+
+// AddBatch stores docs as one atomic WAL batch; see WriteBatch
+func (s *WALStore) AddBatch(ctx context.Context, docs []Document) error {
+	ops := make([]BatchOp, len(docs))
+	for i, doc := range docs {
+		ops[i] = BatchOp{Doc: doc}
+	}
+	return s.WriteBatch(ctx, ops)
+}
+
+// WriteBatch applies ops in order as one atomic WAL batch: recovery replays
+// all of them or none, so a crash can't leave part of the group behind.
+// The index is updated only once the whole batch is written, and a batch
+// that would take the index past its memory budget is refused whole.
+// Under WithConsistency the batch isn't synced on its own, like a single
+// write; Commit makes it durable. Under WithOperationID a batch whose
+// documents the operation already wrote is skipped.
+func (s *WALStore) WriteBatch(ctx context.Context, ops []BatchOp) error {
+	if len(ops) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return fmt.Errorf("store is closed")
+	}
+	return s.writeBatchLocked(ctx, ops)
+}
+
+// writeBatchLocked is WriteBatch with s.mu held
+func (s *WALStore) writeBatchLocked(ctx context.Context, ops []BatchOp) error {
+	// Whether each document exists as of the op being encoded, so a
+	// document added earlier in the batch is updated, not inserted again
+	exists := make(map[string]bool)
+	has := func(id string) bool {
+		if e, ok := exists[id]; ok {
+			return e
+		}
+		return s.hasLocked(id)
+	}
+
+	// A retried batch whose documents the operation already wrote is
+	// skipped whole, like a single write
+	opID := OperationIDFromContext(ctx)
+	if opID != "" && s.ops != nil && s.batchAppliedLocked(opID, ops) {
+		return nil
+	}
+
+	var grow int64 // Bytes the batch adds to the index
+	info := wal.DeleteInfo{DeletedAt: s.clock.Now(), DeletedBy: wal.DeletedByFromContext(ctx)}
+	entries := make([]wal.RecordRequest, 0, len(ops))
+	for _, op := range ops {
+		if op.Delete != "" {
+			payload, err := wal.EncodeDeletePayloadWithInfo(op.Delete, info)
+			if err != nil {
+				return fmt.Errorf("failed to encode delete payload: %w", err)
+			}
+			entries = append(entries, wal.RecordRequest{Type: wal.RecordTypeDelete, Payload: payload})
+			exists[op.Delete] = false
+			continue
+		}
+
+		grow += docBytes(op.Doc)
+		if old, ok := s.lookupLocked(op.Doc.ID); ok {
+			grow -= docBytes(old)
+		}
+		payload, err := encodeDocOp(op.Doc, opID)
+		if err != nil {
+			return err
+		}
+		recType := wal.RecordTypeInsert
+		if has(op.Doc.ID) {
+			recType = wal.RecordTypeUpdate
+		}
+		entries = append(entries, wal.RecordRequest{Type: recType, Payload: payload})
+		exists[op.Doc.ID] = true
+	}
+
+	if grow > 0 {
+		if err := s.indexBudget.Reserve(grow); err != nil {
+			return err
+		}
+	}
+
+	// Staged versions are written first so the batch supersedes them
+	for id := range exists {
+		s.supersedeBackfillsLocked(id)
+		if err := s.unstageLocked(id); err != nil {
+			return err
+		}
+	}
+
+	syncNow := s.syncPolicy.Immediate && ConsistencyFromContext(ctx) == ConsistencyDefault
+	lsns, err := s.writer.AppendAtomic(entries, syncNow)
+	if err != nil {
+		return fmt.Errorf("failed to write batch to WAL: %w", err)
+	}
+
+	// Collections of deleted documents are looked up as of each op, so a
+	// document written earlier in the batch is announced in its new one
+	changes := make([]indexChange, len(ops))
+	collections := make(map[string]string)
+	for i, op := range ops {
+		if op.Delete != "" {
+			collection, ok := collections[op.Delete]
+			if !ok {
+				deleted, _ := s.lookupLocked(op.Delete)
+				collection = deleted.Collection
+			}
+			changes[i] = indexChange{id: op.Delete, deleted: true, lsn: lsns[i], recType: entries[i].Type, collection: collection}
+		} else {
+			s.recordOperation(opID, op.Doc.ID, lsns[i])
+			collections[op.Doc.ID] = op.Doc.Collection
+			changes[i] = indexChange{id: op.Doc.ID, doc: op.Doc, lsn: lsns[i], recType: entries[i].Type, collection: op.Doc.Collection}
+		}
+	}
+	s.applyLocked(changes, lsns[len(lsns)-1]+1)
+	return nil
+}
+
+// batchAppliedLocked reports whether opID already wrote every document of
+// ops; a batch of only deletes never counts as applied
+func (s *WALStore) batchAppliedLocked(opID string, ops []BatchOp) bool {
+	docs := 0
+	for _, op := range ops {
+		if op.Delete != "" {
+			continue
+		}
+		if _, ok := s.ops.applied(opID, op.Doc.ID); !ok {
+			return false
+		}
+		docs++
+	}
+	return docs > 0
+}
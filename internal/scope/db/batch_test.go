@@ -0,0 +1,86 @@
+package db
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/relay"
+	"github.com/dsjohal14/selfstack/internal/scope/db/wal"
+)
+
+func TestWALStoreWriteBatch(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	config := DefaultWALStoreConfig(dir)
+
+	store, err := NewWALStore(ctx, config)
+	if err != nil {
+		t.Fatalf("failed to create WAL store: %v", err)
+	}
+	doc := func(id, text string) Document {
+		return Document{ID: id, Source: "test", Title: id, Text: text, CreatedAt: time.Now(), Embedding: relay.DeterministicEmbed(text)}
+	}
+	_ = store.Add(doc("a", "first"))
+	_ = store.Add(doc("b", "first"))
+
+	// Add c and update it in the same batch, update a, and delete b
+	ops := []BatchOp{
+		{Doc: doc("c", "first")},
+		{Doc: doc("c", "second")},
+		{Doc: doc("a", "second")},
+		{Delete: "b"},
+	}
+	if err := store.WriteBatch(ctx, ops); err != nil {
+		t.Fatalf("batch failed: %v", err)
+	}
+	if err := store.AddBatch(ctx, []Document{doc("d", "first"), doc("e", "first")}); err != nil {
+		t.Fatalf("AddBatch failed: %v", err)
+	}
+	check := func(label string, s *WALStore, want map[string]string) {
+		t.Helper()
+		if s.Count() != len(want) {
+			t.Errorf("%s: count = %d, want %d", label, s.Count(), len(want))
+		}
+		for id, text := range want {
+			if d, found := s.Get(id); !found || d.Text != text {
+				t.Errorf("%s: %s = %+v, want text %q", label, id, d, text)
+			}
+		}
+	}
+	after := map[string]string{"a": "second", "c": "second", "d": "first", "e": "first"}
+	check("after batch", store, after)
+
+	// A crash that cuts the last batch short loses all of it
+	crashed := filepath.Join(t.TempDir(), "wal")
+	if err := os.MkdirAll(crashed, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	segment, err := os.ReadFile(filepath.Join(config.WALDir, wal.SegmentFilename(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(crashed, wal.SegmentFilename(1)), segment[:len(segment)-5], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	crashedConfig := DefaultWALStoreConfig(filepath.Dir(crashed))
+	recovered, err := NewWALStore(ctx, crashedConfig)
+	if err != nil {
+		t.Fatalf("failed to open crashed WAL: %v", err)
+	}
+	check("after crash", recovered, map[string]string{"a": "second", "c": "second"})
+	_ = recovered.Close()
+
+	_ = store.Close()
+	store, err = NewWALStore(ctx, config)
+	if err != nil {
+		t.Fatalf("failed to reopen WAL store: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+	check("after recovery", store, after)
+	if deleted, _ := store.ListDeleted(time.Time{}); len(deleted) != 1 || deleted[0].ID != "b" {
+		t.Errorf("expected b to be deleted, got %+v", deleted)
+	}
+}
@@ -0,0 +1,32 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/dsjohal14/selfstack/internal/scope/db/wal"
+)
+
+// OpenChangelog opens the document and collection records from fromLSN up
+// to the index watermark, in LSN order, for a mirror to bootstrap from and
+// then follow with later LSNs. The segments are opened under the lock and
+// read outside it, so a slow reader holds up neither writes nor
+// compaction. Staged writes aren't in the WAL yet; they get LSNs after the
+// reader's Through. Close the reader when done.
+func (s *WALStore) OpenChangelog(fromLSN uint64) (*wal.ChangeReader, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return nil, fmt.Errorf("store is closed")
+	}
+	// Buffered records must be on disk to be read
+	if err := s.writer.Sync(); err != nil {
+		return nil, fmt.Errorf("failed to sync WAL: %w", err)
+	}
+
+	r, err := wal.OpenChanges(s.walDir, fromLSN, s.IndexLSN()-1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open changelog: %w", err)
+	}
+	return r, nil
+}
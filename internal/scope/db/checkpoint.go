@@ -0,0 +1,186 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/scope/db/wal"
+)
+
+// checkpointState is the state as of a checkpoint record, copied under
+// s.mu so the snapshot can be written without holding it
+type checkpointState struct {
+	lsn         uint64
+	docs        map[string]Document
+	kv          map[string][]byte
+	collections []CollectionSchema
+	deleted     map[string]uint64 // Collection -> LSN of its latest delete
+}
+
+// WriteCheckpoint writes a checkpoint record to the WAL and a snapshot of
+// the state as of it, so recovery can load the snapshot and replay only
+// the records after the checkpoint
+func (s *WALStore) WriteCheckpoint() error {
+	s.checkpointMu.Lock()
+	defer s.checkpointMu.Unlock()
+
+	state, err := s.checkpointLocked()
+	if err != nil {
+		return err
+	}
+	if err := s.writeSnapshot(state); err != nil {
+		return fmt.Errorf("failed to write snapshot at LSN %d: %w", state.lsn, err)
+	}
+	s.checkpointLSN.Store(state.lsn)
+	return nil
+}
+
+// checkpointLocked flushes staged writes, appends a synced checkpoint
+// record with the index digest, and copies the state as of it
+func (s *WALStore) checkpointLocked() (*checkpointState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil, fmt.Errorf("store is closed")
+	}
+	if err := s.flushStagedLocked(); err != nil {
+		return nil, err
+	}
+	s.drainLocked()
+
+	state := &checkpointState{docs: make(map[string]Document, s.index.Count())}
+	s.index.Range(func(id string, doc Document) bool {
+		state.docs[id] = doc
+		return true
+	})
+	// Backfilled documents are in the WAL but not yet in the index, so
+	// they count toward the digest recovery will find
+	digest := s.index.Digest()
+	for b := range s.backfills {
+		for id, doc := range b.pending {
+			if old, ok := state.docs[id]; ok {
+				digest.Sum -= docDigest(old)
+			} else {
+				digest.Docs++
+			}
+			digest.Sum += docDigest(doc)
+			state.docs[id] = doc
+		}
+	}
+
+	lsn, err := s.writer.AppendWithSync(wal.RecordTypeCheckpoint, wal.EncodeCheckpointDigest(s.writer.CurrentLSN(), digest))
+	if err != nil {
+		return nil, err
+	}
+	state.lsn = lsn
+
+	s.kv.mu.RLock()
+	state.kv = make(map[string][]byte, len(s.kv.entries))
+	for k, v := range s.kv.entries {
+		state.kv[k] = v
+	}
+	s.kv.mu.RUnlock()
+
+	state.collections = s.schema.list()
+	s.schema.mu.RLock()
+	state.deleted = make(map[string]uint64, len(s.schema.deleted))
+	for name, lsn := range s.schema.deleted {
+		state.deleted[name] = lsn
+	}
+	s.schema.mu.RUnlock()
+	return state, nil
+}
+
+// writeSnapshot writes state as records recovery applies like the ones
+// they replace. Documents and KV entries are recorded at the checkpoint's
+// LSN; collections keep the LSNs that order them against their deletes.
+func (s *WALStore) writeSnapshot(state *checkpointState) error {
+	sw, err := wal.NewSnapshotWriter(s.walDir, state.lsn, s.compression)
+	if err != nil {
+		return err
+	}
+	write := func(recType wal.RecordType, lsn uint64, payload []byte, err error) error {
+		if err != nil {
+			return err
+		}
+		return sw.Write(recType, lsn, payload)
+	}
+
+	for name, lsn := range state.deleted {
+		payload, err := wal.EncodeSchemaPayload(name, nil)
+		if err := write(wal.RecordTypeCollectionDelete, lsn, payload, err); err != nil {
+			sw.Abort()
+			return err
+		}
+	}
+	for _, c := range state.collections {
+		config, err := json.Marshal(c.Config)
+		if err != nil {
+			sw.Abort()
+			return fmt.Errorf("failed to encode collection: %w", err)
+		}
+		payload, err := wal.EncodeSchemaPayload(c.Config.Name, config)
+		if c.ModelLSN > 0 {
+			if err := write(wal.RecordTypeEmbedderChange, c.ModelLSN, payload, err); err != nil {
+				sw.Abort()
+				return err
+			}
+		}
+		if c.ModelLSN != c.LSN {
+			if err := write(wal.RecordTypeCollection, c.LSN, payload, err); err != nil {
+				sw.Abort()
+				return err
+			}
+		}
+	}
+	for key, value := range state.kv {
+		payload, err := wal.EncodeKVPayload(key, value, false)
+		if err := write(wal.RecordTypeKV, 0, payload, err); err != nil {
+			sw.Abort()
+			return err
+		}
+	}
+	for _, doc := range state.docs {
+		payload, err := encodeDoc(doc)
+		if err := write(wal.RecordTypeInsert, 0, payload, err); err != nil {
+			sw.Abort()
+			return err
+		}
+	}
+
+	_, err = sw.Commit()
+	return err
+}
+
+// writtenSinceCheckpoint reports whether anything was written after the
+// last checkpoint. The next LSN is just past it when nothing was.
+func (s *WALStore) writtenSinceCheckpoint() bool {
+	return s.writer.CurrentLSN() > s.checkpointLSN.Load()+1
+}
+
+// startCheckpoints writes a checkpoint every interval while there have
+// been writes since the last one; Close writes a last one
+func (s *WALStore) startCheckpoints(interval time.Duration, sup wal.Supervisor) {
+	ctx, stop := context.WithCancel(context.Background())
+	s.stopCheckpoints = stop
+	s.checkpointsDone = sup.Go(ctx, "wal-checkpoint", func(ctx context.Context) error {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+				if !s.writtenSinceCheckpoint() {
+					continue
+				}
+				if err := s.WriteCheckpoint(); err != nil {
+					fmt.Printf("checkpoint error: %v\n", err)
+				}
+			}
+		}
+	})
+}
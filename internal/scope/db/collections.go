@@ -0,0 +1,428 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/relay"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// DefaultCollection is used when a request doesn't name a collection
+const DefaultCollection = "default"
+
+// collectionsFile is the registry file in the data directory when Postgres isn't configured
+const collectionsFile = "collections.json"
+
+var collectionNameRE = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// CollectionConfig holds the per-collection settings
+type CollectionConfig struct {
+	Name       string `json:"name"`
+	Embedder   string `json:"embedder"`           // relay provider (deterministic, hashing)
+	Dimensions int    `json:"dimensions"`         // 1..relay.EmbeddingDim
+	Reranker   string `json:"reranker,omitempty"` // relay reranker (none, lexical)
+
+	Chunking      ChunkingConfig `json:"chunking"`
+	RetentionDays int            `json:"retention_days,omitempty"` // Documents older than this are not ingested or returned (0 = keep forever)
+	MinScore      float32        `json:"min_score,omitempty"`      // Semantic hits scoring below this are dropped from search and run (0 = keep all)
+	Quotas        QuotaConfig    `json:"quotas"`
+	ACL           ACLConfig      `json:"acl"`
+
+	CreatedAt time.Time `json:"created_at,omitempty"` // Set by the registry
+	UpdatedAt time.Time `json:"updated_at,omitempty"` // Set by the registry
+}
+
+// ChunkingConfig splits long documents into overlapping chunks at ingest
+type ChunkingConfig struct {
+	Size    int `json:"size,omitempty"`    // Words per chunk (0 = store whole documents)
+	Overlap int `json:"overlap,omitempty"` // Words repeated from the end of the previous chunk
+}
+
+// QuotaConfig limits what a collection may hold (0 = unlimited)
+type QuotaConfig struct {
+	MaxDocuments     int `json:"max_documents,omitempty"`      // Chunks count as documents
+	MaxDocumentBytes int `json:"max_document_bytes,omitempty"` // Size of the ingested text
+}
+
+// ACLConfig lists the principals stamped on new documents that don't set their own
+type ACLConfig struct {
+	Read  []string `json:"read,omitempty"`
+	Write []string `json:"write,omitempty"`
+}
+
+// DefaultCollectionConfig is the implicit config of the default collection
+func DefaultCollectionConfig() CollectionConfig {
+	return CollectionConfig{
+		Name:       DefaultCollection,
+		Embedder:   relay.ProviderDeterministic,
+		Dimensions: relay.EmbeddingDim,
+	}
+}
+
+// Validate fills in defaults and checks the name, embedder, and reranker
+func (c *CollectionConfig) Validate() error {
+	if !collectionNameRE.MatchString(c.Name) {
+		return fmt.Errorf("invalid collection name %q: use lowercase letters, digits, '-' and '_' (max 63)", c.Name)
+	}
+	if c.Embedder == "" {
+		c.Embedder = relay.ProviderDeterministic
+	}
+	if c.Dimensions == 0 {
+		c.Dimensions = relay.EmbeddingDim
+	}
+	if _, err := relay.NewEmbedder(c.Embedder, c.Dimensions); err != nil {
+		return err
+	}
+	if _, err := relay.NewReranker(c.Reranker); err != nil {
+		return err
+	}
+	if c.Chunking.Size < 0 || c.Chunking.Overlap < 0 || (c.Chunking.Overlap > 0 && c.Chunking.Overlap >= c.Chunking.Size) {
+		return fmt.Errorf("chunking overlap must be smaller than a positive chunk size")
+	}
+	if c.RetentionDays < 0 {
+		return fmt.Errorf("retention_days must not be negative")
+	}
+	if c.MinScore < -1 || c.MinScore > 1 {
+		return fmt.Errorf("min_score must be between -1 and 1")
+	}
+	if c.Quotas.MaxDocuments < 0 || c.Quotas.MaxDocumentBytes < 0 {
+		return fmt.Errorf("quotas must not be negative")
+	}
+	return nil
+}
+
+// RetentionCutoff returns the creation time documents must be after, or
+// the zero time when the collection keeps documents forever
+func (c CollectionConfig) RetentionCutoff(now time.Time) time.Time {
+	if c.RetentionDays <= 0 {
+		return time.Time{}
+	}
+	return now.AddDate(0, 0, -c.RetentionDays)
+}
+
+// Models builds the embedder and reranker (nil for none) of a validated config
+func (c CollectionConfig) Models() (relay.Embedder, relay.Reranker, error) {
+	embedder, err := relay.NewEmbedder(c.Embedder, c.Dimensions)
+	if err != nil {
+		return nil, nil, err
+	}
+	reranker, err := relay.NewReranker(c.Reranker)
+	if err != nil {
+		return nil, nil, err
+	}
+	return embedder, reranker, nil
+}
+
+// CollectionRegistry persists collection configs
+type CollectionRegistry interface {
+	// Get returns the named collection. The default collection always exists.
+	Get(ctx context.Context, name string) (CollectionConfig, bool, error)
+	List(ctx context.Context) ([]CollectionConfig, error)
+	// Put validates and creates or replaces a collection
+	Put(ctx context.Context, cfg CollectionConfig) error
+	Delete(ctx context.Context, name string) error
+	Close() error
+}
+
+// OpenCollectionRegistry returns a Postgres-backed registry when cfg has a
+// database (and the backend uses it), otherwise one stored in the data dir.
+// Open must have run first so the collections table exists.
+func OpenCollectionRegistry(ctx context.Context, cfg OpenConfig) (CollectionRegistry, error) {
+	if cfg.DatabaseURL != "" && cfg.Backend != BackendFile {
+		pool, err := connect(ctx, cfg.DatabaseURL)
+		if err != nil {
+			return nil, err
+		}
+		return &PostgresCollectionRegistry{db: pool, ownsPool: true}, nil
+	}
+	return NewFileCollectionRegistry(cfg.DataDir)
+}
+
+// withDefault returns the built-in default collection config when name is
+// the default and nothing is stored for it
+func withDefault(name string, cfg CollectionConfig, found bool) (CollectionConfig, bool) {
+	if !found && name == DefaultCollection {
+		return DefaultCollectionConfig(), true
+	}
+	return cfg, found
+}
+
+// FileCollectionRegistry stores collections in a JSON file
+type FileCollectionRegistry struct {
+	mu          sync.Mutex
+	path        string
+	collections map[string]CollectionConfig
+}
+
+// NewFileCollectionRegistry loads (or creates) the registry in dataDir
+func NewFileCollectionRegistry(dataDir string) (*FileCollectionRegistry, error) {
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+
+	r := &FileCollectionRegistry{
+		path:        filepath.Join(dataDir, collectionsFile),
+		collections: make(map[string]CollectionConfig),
+	}
+
+	data, err := os.ReadFile(r.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read collections: %w", err)
+	}
+
+	var list []CollectionConfig
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", r.path, err)
+	}
+	for _, c := range list {
+		r.collections[c.Name] = c
+	}
+	return r, nil
+}
+
+// Get returns the named collection
+func (r *FileCollectionRegistry) Get(_ context.Context, name string) (CollectionConfig, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cfg, found := r.collections[name]
+	cfg, found = withDefault(name, cfg, found)
+	return cfg, found, nil
+}
+
+// List returns all stored collections sorted by name
+func (r *FileCollectionRegistry) List(_ context.Context) ([]CollectionConfig, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.sortedLocked(), nil
+}
+
+// Put creates or replaces a collection and rewrites the file
+func (r *FileCollectionRegistry) Put(_ context.Context, cfg CollectionConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	prev, existed := r.collections[cfg.Name]
+	now := time.Now().UTC()
+	cfg.CreatedAt, cfg.UpdatedAt = now, now
+	if existed {
+		cfg.CreatedAt = prev.CreatedAt
+	}
+
+	r.collections[cfg.Name] = cfg
+	if err := r.saveLocked(); err != nil {
+		if existed {
+			r.collections[cfg.Name] = prev
+		} else {
+			delete(r.collections, cfg.Name)
+		}
+		return err
+	}
+	return nil
+}
+
+// Delete removes a collection; deleting a missing one is not an error
+func (r *FileCollectionRegistry) Delete(_ context.Context, name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	prev, ok := r.collections[name]
+	if !ok {
+		return nil
+	}
+	delete(r.collections, name)
+	if err := r.saveLocked(); err != nil {
+		r.collections[name] = prev
+		return err
+	}
+	return nil
+}
+
+// Close is a no-op; every change is already on disk
+func (r *FileCollectionRegistry) Close() error {
+	return nil
+}
+
+func (r *FileCollectionRegistry) sortedLocked() []CollectionConfig {
+	list := make([]CollectionConfig, 0, len(r.collections))
+	for _, c := range r.collections {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// saveLocked writes the registry to a temp file and renames it into place
+func (r *FileCollectionRegistry) saveLocked() error {
+	data, err := json.MarshalIndent(r.sortedLocked(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode collections: %w", err)
+	}
+
+	tmpPath := r.path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create collections file: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to write collections file: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to sync collections file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to close collections file: %w", err)
+	}
+	if err := os.Rename(tmpPath, r.path); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to move collections file: %w", err)
+	}
+	return nil
+}
+
+// PostgresCollectionRegistry stores collections in the collections table
+type PostgresCollectionRegistry struct {
+	db       *pgxpool.Pool
+	ownsPool bool
+}
+
+// NewPostgresCollectionRegistry creates a registry on an existing pool
+func NewPostgresCollectionRegistry(db *pgxpool.Pool) *PostgresCollectionRegistry {
+	return &PostgresCollectionRegistry{db: db}
+}
+
+// Get returns the named collection
+func (r *PostgresCollectionRegistry) Get(ctx context.Context, name string) (CollectionConfig, bool, error) {
+	var (
+		cfg  CollectionConfig
+		data []byte
+	)
+	err := r.db.QueryRow(ctx, `
+		SELECT config, created_at, updated_at FROM collections WHERE name = $1
+	`, name).Scan(&data, &cfg.CreatedAt, &cfg.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		cfg, found := withDefault(name, CollectionConfig{}, false)
+		return cfg, found, nil
+	}
+	if err != nil {
+		return CollectionConfig{}, false, fmt.Errorf("failed to get collection: %w", err)
+	}
+	if err := decodeCollection(name, data, &cfg); err != nil {
+		return CollectionConfig{}, false, err
+	}
+	return cfg, true, nil
+}
+
+// List returns all stored collections sorted by name
+func (r *PostgresCollectionRegistry) List(ctx context.Context) ([]CollectionConfig, error) {
+	rows, err := r.db.Query(ctx, `SELECT name, config, created_at, updated_at FROM collections ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list collections: %w", err)
+	}
+	defer rows.Close()
+
+	var list []CollectionConfig
+	for rows.Next() {
+		var (
+			cfg  CollectionConfig
+			name string
+			data []byte
+		)
+		if err := rows.Scan(&name, &data, &cfg.CreatedAt, &cfg.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan collection: %w", err)
+		}
+		if err := decodeCollection(name, data, &cfg); err != nil {
+			return nil, err
+		}
+		list = append(list, cfg)
+	}
+	return list, rows.Err()
+}
+
+// Put creates or replaces a collection
+func (r *PostgresCollectionRegistry) Put(ctx context.Context, cfg CollectionConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	cfg.CreatedAt, cfg.UpdatedAt = time.Time{}, time.Time{}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to encode collection: %w", err)
+	}
+
+	_, err = r.db.Exec(ctx, `
+		INSERT INTO collections (name, config, created_at, updated_at)
+		VALUES ($1, $2, NOW(), NOW())
+		ON CONFLICT (name) DO UPDATE SET config = EXCLUDED.config, updated_at = NOW()
+	`, cfg.Name, data)
+	if err != nil {
+		return fmt.Errorf("failed to put collection: %w", err)
+	}
+	return nil
+}
+
+// Delete removes a collection; deleting a missing one is not an error
+func (r *PostgresCollectionRegistry) Delete(ctx context.Context, name string) error {
+	if _, err := r.db.Exec(ctx, `DELETE FROM collections WHERE name = $1`, name); err != nil {
+		return fmt.Errorf("failed to delete collection: %w", err)
+	}
+	return nil
+}
+
+// Close closes the pool if the registry opened it
+func (r *PostgresCollectionRegistry) Close() error {
+	if r.ownsPool {
+		r.db.Close()
+	}
+	return nil
+}
+
+// decodeCollection unmarshals the stored config, keeping the row's name
+func decodeCollection(name string, data []byte, cfg *CollectionConfig) error {
+	createdAt, updatedAt := cfg.CreatedAt, cfg.UpdatedAt
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return fmt.Errorf("failed to decode collection %s: %w", name, err)
+	}
+	cfg.Name, cfg.CreatedAt, cfg.UpdatedAt = name, createdAt, updatedAt
+	return nil
+}
+
+// LoadCollectionsFile reads a JSON array of collection configs, as used to
+// seed the registry from COLLECTIONS_CONFIG
+func LoadCollectionsFile(path string) ([]CollectionConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read collections config: %w", err)
+	}
+	var list []CollectionConfig
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse collections config %s: %w", path, err)
+	}
+	for i := range list {
+		if err := list[i].Validate(); err != nil {
+			return nil, fmt.Errorf("collections config %s: %w", path, err)
+		}
+	}
+	return list, nil
+}
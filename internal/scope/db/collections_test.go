@@ -0,0 +1,79 @@
+package db
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dsjohal14/selfstack/internal/relay"
+)
+
+func TestFileCollectionRegistry(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	reg, err := NewFileCollectionRegistry(dir)
+	if err != nil {
+		t.Fatalf("failed to open registry: %v", err)
+	}
+
+	// The default collection exists without being stored
+	def, found, _ := reg.Get(ctx, DefaultCollection)
+	if !found || def.Embedder != relay.ProviderDeterministic {
+		t.Errorf("expected implicit default collection, got %+v (found=%v)", def, found)
+	}
+
+	if err := reg.Put(ctx, CollectionConfig{Name: "code", Embedder: relay.ProviderHashing, Dimensions: 64, Reranker: relay.RerankerLexical}); err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	if err := reg.Put(ctx, CollectionConfig{Name: "Bad Name"}); err == nil {
+		t.Error("expected error for invalid name")
+	}
+	if err := reg.Put(ctx, CollectionConfig{Name: "docs", Embedder: "gpt"}); err == nil {
+		t.Error("expected error for unknown embedder")
+	}
+	if err := reg.Put(ctx, CollectionConfig{Name: "docs", MinScore: 1.5}); err == nil {
+		t.Error("expected error for min_score above 1")
+	}
+
+	// Survives reopening
+	reg, err = NewFileCollectionRegistry(dir)
+	if err != nil {
+		t.Fatalf("failed to reopen registry: %v", err)
+	}
+	code, found, _ := reg.Get(ctx, "code")
+	if !found || code.Embedder != relay.ProviderHashing || code.Dimensions != 64 || code.CreatedAt.IsZero() {
+		t.Fatalf("unexpected collection after reopen: %+v (found=%v)", code, found)
+	}
+
+	embedder, reranker, err := code.Models()
+	if err != nil || embedder.Name() != relay.ProviderHashing || reranker == nil {
+		t.Errorf("unexpected models: %v, %v, %v", embedder, reranker, err)
+	}
+
+	if err := reg.Delete(ctx, "code"); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if list, _ := reg.List(ctx); len(list) != 0 {
+		t.Errorf("expected no stored collections, got %+v", list)
+	}
+}
+
+func TestLoadCollectionsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "collections.json")
+	_ = os.WriteFile(path, []byte(`[{"name": "code", "embedder": "hashing"}, {"name": "docs"}]`), 0644)
+
+	list, err := LoadCollectionsFile(path)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if len(list) != 2 || list[1].Embedder != relay.ProviderDeterministic || list[1].Dimensions != relay.EmbeddingDim {
+		t.Errorf("expected defaults to be filled in, got %+v", list)
+	}
+
+	_ = os.WriteFile(path, []byte(`[{"name": "code", "dimensions": 4096}]`), 0644)
+	if _, err := LoadCollectionsFile(path); err == nil {
+		t.Error("expected error for unsupported dimensions")
+	}
+}
@@ -0,0 +1,42 @@
+package db
+
+import (
+	"context"
+	"fmt"
+)
+
+// Consistency is how durable a write must be before it's acknowledged
+type Consistency string
+
+// Consistency levels; the default follows the store's sync policy
+const (
+	ConsistencyDefault Consistency = ""
+	ConsistencyFsync   Consistency = "fsync"   // Synced to disk before returning
+	ConsistencyBatched Consistency = "batched" // Synced by the next group commit
+	ConsistencyAsync   Consistency = "async"   // Applied in memory; synced later
+)
+
+// ParseConsistency validates a consistency level from a request
+func ParseConsistency(s string) (Consistency, error) {
+	switch c := Consistency(s); c {
+	case ConsistencyDefault, ConsistencyFsync, ConsistencyBatched, ConsistencyAsync:
+		return c, nil
+	default:
+		return "", fmt.Errorf("invalid consistency %q: must be fsync, batched, or async", s)
+	}
+}
+
+type consistencyKey struct{}
+
+// WithConsistency marks writes made with ctx as part of a request committed
+// at level c: they aren't synced one by one, and the caller calls Commit
+// once after the last write
+func WithConsistency(ctx context.Context, c Consistency) context.Context {
+	return context.WithValue(ctx, consistencyKey{}, c)
+}
+
+// ConsistencyFromContext returns the level WithConsistency attached to ctx
+func ConsistencyFromContext(ctx context.Context) Consistency {
+	c, _ := ctx.Value(consistencyKey{}).(Consistency)
+	return c
+}
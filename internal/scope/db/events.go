@@ -0,0 +1,32 @@
+package db
+
+import (
+	"strings"
+
+	"github.com/dsjohal14/selfstack/internal/libs/events"
+	"github.com/dsjohal14/selfstack/internal/scope/db/wal"
+)
+
+// AppliedRecord is the payload of events.TopicWALApplied: a document record
+// a WALStore wrote to the WAL and applied to its index. Staged writes are
+// published when the staging window flushes them, and backfills when Finish
+// indexes them.
+type AppliedRecord struct {
+	LSN        uint64 `json:"lsn"`
+	Type       string `json:"type"` // insert, update, or delete
+	DocID      string `json:"doc_id"`
+	Collection string `json:"collection,omitempty"` // Empty for deletes of documents not in the index
+}
+
+// publishApplied announces a document record on the store's bus
+func (s *WALStore) publishApplied(lsn uint64, recType wal.RecordType, docID, collection string) {
+	if s.events == nil {
+		return
+	}
+	s.events.Publish(events.TopicWALApplied, AppliedRecord{
+		LSN:        lsn,
+		Type:       strings.ToLower(recType.String()),
+		DocID:      docID,
+		Collection: collection,
+	})
+}
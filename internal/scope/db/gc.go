@@ -0,0 +1,37 @@
+package db
+
+import (
+	"context"
+
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+	"github.com/dsjohal14/selfstack/internal/scope/db/wal"
+)
+
+var (
+	gcFiles = obs.DefaultRegistry.CounterVec("selfstack_wal_gc_files_total", "Orphaned WAL files quarantined, and quarantined files deleted", "action")
+	gcBytes = obs.DefaultRegistry.CounterVec("selfstack_wal_gc_bytes_total", "Bytes of orphaned WAL files quarantined, and of quarantined files deleted (reclaimed)", "action")
+)
+
+// CollectGarbage quarantines the orphaned files in the WAL directory and
+// deletes the ones quarantined longer than the configured GCGrace (see
+// wal.CollectGarbage). Segments are only judged with a Postgres manifest;
+// the in-memory one doesn't know the segments from before startup.
+func (s *WALStore) CollectGarbage(ctx context.Context, dryRun bool) (*wal.GCReport, error) {
+	cfg := wal.GCConfig{Dir: s.walDir, TmpDir: s.compactCfg.TmpDir, Grace: s.gcGrace, DryRun: dryRun}
+	if s.db != nil {
+		cfg.Manifest = s.manifest
+	}
+
+	// A checkpoint replaces the snapshot the pass may be judging
+	s.checkpointMu.Lock()
+	report, err := wal.CollectGarbage(ctx, cfg)
+	s.checkpointMu.Unlock()
+
+	if report != nil && !dryRun {
+		gcFiles.WithLabel("quarantined").Add(uint64(len(report.Quarantined)))
+		gcBytes.WithLabel("quarantined").Add(uint64(report.QuarantinedBytes))
+		gcFiles.WithLabel("deleted").Add(uint64(len(report.Deleted)))
+		gcBytes.WithLabel("deleted").Add(uint64(report.ReclaimedBytes))
+	}
+	return report, err
+}
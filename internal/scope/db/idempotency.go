@@ -0,0 +1,105 @@
+package db
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultDedupWindow is how long a WALStore remembers operation IDs by
+// default: long enough to cover a client's retries after a timeout
+const DefaultDedupWindow = 10 * time.Minute
+
+// maxDedupOps caps the operations a window remembers, so a flood of unique
+// IDs can't grow it without bound; the oldest are forgotten first
+const maxDedupOps = 100_000
+
+type operationIDKey struct{}
+
+// WithOperationID marks writes made with ctx as part of the client
+// operation id, e.g. an HTTP request's Idempotency-Key. The ID is stored in
+// the WAL records, and a WALStore skips writes of a document it already
+// made under the same ID within its dedup window, so a retried request
+// doesn't write the document again.
+func WithOperationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, operationIDKey{}, id)
+}
+
+// OperationIDFromContext returns the ID WithOperationID attached to ctx
+func OperationIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(operationIDKey{}).(string)
+	return id
+}
+
+// appliedOp is what an operation wrote
+type appliedOp struct {
+	at   time.Time
+	docs map[string]uint64 // Document ID -> LSN of its record
+}
+
+// opWindow remembers the documents written under each operation ID for a
+// window after the operation's first write; it satisfies
+// wal.OperationIndex so recovery can fill it
+type opWindow struct {
+	mu     sync.Mutex
+	window time.Duration
+	now    func() time.Time
+	ops    map[string]*appliedOp
+	order  []string // Operation IDs, oldest first
+}
+
+func newOpWindow(window time.Duration) *opWindow {
+	return &opWindow{window: window, now: time.Now, ops: make(map[string]*appliedOp)}
+}
+
+// RecordOperation remembers that opID wrote docID at lsn; operations older
+// than the window are ignored
+func (w *opWindow) RecordOperation(opID, docID string, lsn uint64, at time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := w.now()
+	if now.Sub(at) > w.window {
+		return
+	}
+	w.expireLocked(now)
+	op, ok := w.ops[opID]
+	if !ok {
+		op = &appliedOp{at: at, docs: make(map[string]uint64, 1)}
+		w.ops[opID] = op
+		w.order = append(w.order, opID)
+	}
+	op.docs[docID] = lsn
+
+	for len(w.order) > maxDedupOps {
+		delete(w.ops, w.order[0])
+		w.order = w.order[1:]
+	}
+}
+
+// applied returns the LSN docID was written at under opID, if that was
+// within the window
+func (w *opWindow) applied(opID, docID string) (uint64, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.expireLocked(w.now())
+	op, ok := w.ops[opID]
+	if !ok {
+		return 0, false
+	}
+	lsn, ok := op.docs[docID]
+	return lsn, ok
+}
+
+// expireLocked forgets the operations that started before the window
+func (w *opWindow) expireLocked(now time.Time) {
+	for len(w.order) > 0 {
+		op, ok := w.ops[w.order[0]]
+		if ok && now.Sub(op.at) <= w.window {
+			return
+		}
+		delete(w.ops, w.order[0])
+		w.order = w.order[1:]
+	}
+}
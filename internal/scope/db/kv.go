@@ -0,0 +1,117 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dsjohal14/selfstack/internal/scope/db/wal"
+)
+
+// KV is a small durable key-value store for internal state such as
+// connector checkpoints, feature flags, and schema versions. Entries live
+// in the same log as the documents, so they are recovered, compacted, and
+// archived with them. Use a prefix per module, e.g. "querylog/".
+type KV interface {
+	GetKV(key string) ([]byte, bool)
+	SetKV(ctx context.Context, key string, value []byte) error
+	DeleteKV(ctx context.Context, key string) error
+	// ListKV returns the keys starting with prefix, sorted
+	ListKV(prefix string) []string
+}
+
+// kvMap holds the current KV entries in memory; it satisfies wal.KVIndex
+// so recovery can fill it
+type kvMap struct {
+	mu      sync.RWMutex
+	entries map[string][]byte
+}
+
+func newKVMap() *kvMap {
+	return &kvMap{entries: make(map[string][]byte)}
+}
+
+func (m *kvMap) SetKV(key string, value []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries[key] = value
+}
+
+func (m *kvMap) DeleteKV(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, key)
+}
+
+func (m *kvMap) get(key string) ([]byte, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	value, ok := m.entries[key]
+	if !ok {
+		return nil, false
+	}
+	return append([]byte{}, value...), true
+}
+
+func (m *kvMap) list(prefix string) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var keys []string
+	for k := range m.entries {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// GetKV returns a copy of the value stored under key
+func (s *WALStore) GetKV(key string) ([]byte, bool) {
+	return s.kv.get(key)
+}
+
+// SetKV durably stores value under key, following the sync policy (or the
+// consistency level on ctx, committed with Commit)
+func (s *WALStore) SetKV(ctx context.Context, key string, value []byte) error {
+	return s.writeKV(ctx, key, value, false)
+}
+
+// DeleteKV removes key; deleting a missing key is not an error
+func (s *WALStore) DeleteKV(ctx context.Context, key string) error {
+	if _, ok := s.kv.get(key); !ok {
+		return nil
+	}
+	return s.writeKV(ctx, key, nil, true)
+}
+
+// ListKV returns the keys starting with prefix, sorted
+func (s *WALStore) ListKV(prefix string) []string {
+	return s.kv.list(prefix)
+}
+
+func (s *WALStore) writeKV(ctx context.Context, key string, value []byte, deleted bool) error {
+	payload, err := wal.EncodeKVPayload(key, value, deleted)
+	if err != nil {
+		return fmt.Errorf("failed to encode KV payload: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return fmt.Errorf("store is closed")
+	}
+	if _, err := s.append(ctx, wal.RecordTypeKV, payload); err != nil {
+		return fmt.Errorf("failed to write KV entry to WAL: %w", err)
+	}
+
+	if deleted {
+		s.kv.DeleteKV(key)
+	} else {
+		s.kv.SetKV(key, append([]byte{}, value...))
+	}
+	return nil
+}
@@ -1,17 +1,27 @@
 package db
 
 import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
 	"sort"
 	"sync"
+	"unsafe"
 
+	"github.com/dsjohal14/selfstack/internal/libs/membudget"
 	"github.com/dsjohal14/selfstack/internal/relay"
 	"github.com/dsjohal14/selfstack/internal/scope/db/wal"
+	"github.com/dsjohal14/selfstack/internal/scope/search"
 )
 
 // MemIndex is a thread-safe in-memory index of documents
 type MemIndex struct {
-	mu   sync.RWMutex
-	docs map[string]Document
+	mu       sync.RWMutex
+	docs     map[string]Document
+	keywords *search.InvertedIndex // Optional keyword postings, kept in step with docs
+	bytes    int64                 // Estimated size of docs
+	digest   uint64                // Sum of the docDigest of docs
+	budget   *membudget.Budget     // Reports bytes; nil for none
 }
 
 // NewMemIndex creates a new empty in-memory index
@@ -21,19 +31,166 @@ func NewMemIndex() *MemIndex {
 	}
 }
 
+// docOverhead is the fixed memory of an indexed document: the struct with
+// its embedding, plus its map entry
+const docOverhead = int64(unsafe.Sizeof(Document{})) + 48
+
+// docBytes estimates the memory an indexed document holds. Keyword
+// postings aren't counted.
+func docBytes(doc Document) int64 {
+	n := docOverhead + int64(len(doc.ID)+len(doc.Source)+len(doc.Title)+len(doc.Text)+len(doc.Collection))
+	for k, v := range doc.Metadata {
+		n += int64(len(k)+len(v)) + 48
+	}
+	return n
+}
+
+// SetBudget reports the index's estimated size to b from now on
+func (m *MemIndex) SetBudget(b *membudget.Budget) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.budget = b
+	b.Set(m.bytes)
+}
+
+// Bytes returns the estimated memory the indexed documents hold
+func (m *MemIndex) Bytes() int64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.bytes
+}
+
+// IndexSize breaks down the estimated memory of an index
+type IndexSize struct {
+	Documents   int   `json:"documents"`
+	TextBytes   int64 `json:"text_bytes"`   // IDs, titles, text, and metadata
+	VectorBytes int64 `json:"vector_bytes"` // Embeddings
+	TotalBytes  int64 `json:"total_bytes"`  // Including per-document overhead
+}
+
+// Size returns the estimated memory of the index, broken down
+func (m *MemIndex) Size() IndexSize {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	size := IndexSize{
+		Documents:   len(m.docs),
+		VectorBytes: int64(len(m.docs)) * int64(unsafe.Sizeof(relay.Embedding{})),
+		TotalBytes:  m.bytes,
+	}
+	for _, doc := range m.docs {
+		size.TextBytes += docBytes(doc) - docOverhead
+	}
+	return size
+}
+
+// docDigest hashes what recovery restores of a document, so a document
+// hashes the same before a restart and after
+func docDigest(doc Document) uint64 {
+	h := fnv.New64a()
+	var buf [8]byte
+	for _, s := range []string{doc.ID, doc.Collection, doc.Source, doc.Title, doc.Text} {
+		_, _ = h.Write([]byte(s))
+		_, _ = h.Write([]byte{0})
+	}
+	binary.LittleEndian.PutUint64(buf[:], uint64(doc.CreatedAt.UnixNano()))
+	_, _ = h.Write(buf[:])
+	keys := make([]string, 0, len(doc.Metadata))
+	for k := range doc.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		_, _ = h.Write([]byte(k))
+		_, _ = h.Write([]byte{0})
+		_, _ = h.Write([]byte(doc.Metadata[k]))
+		_, _ = h.Write([]byte{0})
+	}
+	for _, f := range doc.Embedding {
+		binary.LittleEndian.PutUint32(buf[:4], math.Float32bits(f))
+		_, _ = h.Write(buf[:4])
+	}
+	return h.Sum64()
+}
+
+// putLocked stores doc, keeping the size estimate and digest current
+func (m *MemIndex) putLocked(docID string, doc Document) {
+	delta := docBytes(doc)
+	if old, ok := m.docs[docID]; ok {
+		delta -= docBytes(old)
+		m.digest -= docDigest(old)
+	}
+	m.docs[docID] = doc
+	m.digest += docDigest(doc)
+	m.bytes += delta
+	m.budget.Add(delta)
+}
+
+// Digest returns the count and digest of the indexed documents; recovery
+// checks them against the ones recorded by the latest checkpoint
+func (m *MemIndex) Digest() wal.IndexDigest {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return wal.IndexDigest{Docs: uint64(len(m.docs)), Sum: m.digest}
+}
+
+// EnableKeywordIndex maintains keyword postings alongside the documents.
+// Call before recovery so postings are built in the same pass.
+func (m *MemIndex) EnableKeywordIndex() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.keywords != nil {
+		return
+	}
+	m.keywords = search.NewInvertedIndex()
+	for id, doc := range m.docs {
+		_ = m.keywords.Index(id, keywordContent(doc))
+	}
+}
+
+// KeywordIndexEnabled reports whether keyword postings are maintained
+func (m *MemIndex) KeywordIndexEnabled() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.keywords != nil
+}
+
 // Set adds or updates a document in the index
 func (m *MemIndex) Set(docID string, doc Document) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.docs[docID] = doc
+	m.putLocked(docID, doc)
+	if m.keywords != nil {
+		_ = m.keywords.Index(docID, keywordContent(doc))
+	}
+}
+
+// SetMany adds or updates documents under one lock, for bulk loads
+func (m *MemIndex) SetMany(docs map[string]Document) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, doc := range docs {
+		m.putLocked(id, doc)
+		if m.keywords != nil {
+			_ = m.keywords.Index(id, keywordContent(doc))
+		}
+	}
 }
 
 // SetRecovered adds a document from WAL recovery
-// Implements wal.DocumentIndex interface
-func (m *MemIndex) SetRecovered(doc wal.RecoveredDoc) {
+// Implements wal.DocumentIndex interface; doc is copied, not retained
+func (m *MemIndex) SetRecovered(doc *wal.RecoveredDoc) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.docs[doc.DocID] = Document{
+	d := recoveredToDocument(doc)
+	m.putLocked(doc.DocID, d)
+	if m.keywords != nil {
+		_ = m.keywords.Index(d.ID, keywordContent(d))
+	}
+}
+
+// recoveredToDocument converts a recovered WAL document
+func recoveredToDocument(doc *wal.RecoveredDoc) Document {
+	return Document{
 		ID:        doc.DocID,
 		Source:    doc.Source,
 		Title:     doc.Title,
@@ -41,6 +198,8 @@ func (m *MemIndex) SetRecovered(doc wal.RecoveredDoc) {
 		Metadata:  doc.Metadata,
 		CreatedAt: doc.CreatedAt,
 		Embedding: doc.Embedding,
+
+		Collection: doc.Collection,
 	}
 }
 
@@ -48,7 +207,15 @@ func (m *MemIndex) SetRecovered(doc wal.RecoveredDoc) {
 func (m *MemIndex) Delete(docID string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	if old, ok := m.docs[docID]; ok {
+		m.bytes -= docBytes(old)
+		m.digest -= docDigest(old)
+		m.budget.Add(-docBytes(old))
+	}
 	delete(m.docs, docID)
+	if m.keywords != nil {
+		m.keywords.Remove(docID)
+	}
 }
 
 // Get retrieves a document by ID
@@ -90,8 +257,28 @@ func (m *MemIndex) AllIDs() []string {
 	return result
 }
 
+// CountCollection returns the number of documents in a collection
+func (m *MemIndex) CountCollection(collection string) int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	filter := SearchFilter{Collection: collection}
+	n := 0
+	for _, doc := range m.docs {
+		if filter.Matches(doc) {
+			n++
+		}
+	}
+	return n
+}
+
 // Search finds documents similar to the query embedding
 func (m *MemIndex) Search(query relay.Embedding, limit int) []SearchResult {
+	return m.SearchFiltered(query, limit, SearchFilter{})
+}
+
+// SearchFiltered finds documents similar to the query embedding among those matching filter
+func (m *MemIndex) SearchFiltered(query relay.Embedding, limit int, filter SearchFilter) []SearchResult {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
@@ -101,16 +288,11 @@ func (m *MemIndex) Search(query relay.Embedding, limit int) []SearchResult {
 
 	results := make([]SearchResult, 0, len(m.docs))
 	for _, doc := range m.docs {
+		if !filter.Matches(doc) {
+			continue
+		}
 		score := relay.CosineSimilarity(query, doc.Embedding)
-		results = append(results, SearchResult{
-			DocID:     doc.ID,
-			Score:     score,
-			Title:     doc.Title,
-			Text:      doc.Text,
-			Source:    doc.Source,
-			Metadata:  doc.Metadata,
-			CreatedAt: doc.CreatedAt,
-		})
+		results = append(results, searchResult(doc, score))
 	}
 
 	// Sort by score descending
@@ -125,11 +307,67 @@ func (m *MemIndex) Search(query relay.Embedding, limit int) []SearchResult {
 	return results
 }
 
+// KeywordSearch ranks documents matching filter by BM25 over title and text.
+// Returns nil if the keyword index is not enabled.
+func (m *MemIndex) KeywordSearch(query string, limit int, filter SearchFilter) []SearchResult {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.keywords == nil {
+		return nil
+	}
+
+	// With a filter, rank everything and cut after filtering
+	scoreLimit := limit
+	if filter != (SearchFilter{}) {
+		scoreLimit = 0
+	}
+
+	hits := m.keywords.SearchScored(query, scoreLimit)
+	results := make([]SearchResult, 0, len(hits))
+	for _, hit := range hits {
+		doc := m.docs[hit.DocID]
+		if !filter.Matches(doc) {
+			continue
+		}
+		results = append(results, searchResult(doc, float32(hit.Score)))
+		if limit > 0 && len(results) == limit {
+			break
+		}
+	}
+	return results
+}
+
+// searchResult builds the result for a scored document
+func searchResult(doc Document, score float32) SearchResult {
+	return SearchResult{
+		DocID:      doc.ID,
+		Score:      score,
+		Title:      doc.Title,
+		Text:       doc.Text,
+		Source:     doc.Source,
+		Metadata:   doc.Metadata,
+		CreatedAt:  doc.CreatedAt,
+		Collection: CollectionOf(doc),
+	}
+}
+
+// keywordContent is the text indexed for keyword search
+func keywordContent(doc Document) string {
+	return doc.Title + "\n" + doc.Text
+}
+
 // Clear removes all documents from the index
 func (m *MemIndex) Clear() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.docs = make(map[string]Document)
+	m.bytes = 0
+	m.digest = 0
+	m.budget.Set(0)
+	if m.keywords != nil {
+		m.keywords = search.NewInvertedIndex()
+	}
 }
 
 // Has checks if a document exists in the index
@@ -162,5 +400,13 @@ func (m *MemIndex) Clone() *MemIndex {
 	for id, doc := range m.docs {
 		clone.docs[id] = doc
 	}
+	clone.bytes = m.bytes
+	clone.digest = m.digest
+	if m.keywords != nil {
+		clone.keywords = search.NewInvertedIndex()
+		for id, doc := range clone.docs {
+			_ = clone.keywords.Index(id, keywordContent(doc))
+		}
+	}
 	return clone
 }
@@ -0,0 +1,52 @@
+package db
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/dsjohal14/selfstack/internal/relay"
+)
+
+// benchIndexes caches populated indexes across benchmark runs; building a
+// 1M-doc index dominates otherwise
+var benchIndexes = map[int]*MemIndex{}
+
+func benchMemIndex(n int) *MemIndex {
+	if idx, ok := benchIndexes[n]; ok {
+		return idx
+	}
+	rng := rand.New(rand.NewSource(1))
+	idx := NewMemIndex()
+	for i := 0; i < n; i++ {
+		var emb relay.Embedding
+		for j := range emb {
+			emb[j] = rng.Float32()*2 - 1
+		}
+		id := fmt.Sprintf("doc-%08d", i)
+		idx.Set(id, Document{ID: id, Title: id, Text: "benchmark document", Embedding: emb})
+	}
+	benchIndexes[n] = idx
+	return idx
+}
+
+func BenchmarkMemIndexSearch(b *testing.B) {
+	query := relay.DeterministicEmbed("quarterly planning notes")
+
+	for _, n := range []int{10_000, 100_000, 1_000_000} {
+		b.Run(fmt.Sprintf("docs=%d", n), func(b *testing.B) {
+			if n > 100_000 && testing.Short() {
+				b.Skip("skipping 1M-doc index in short mode")
+			}
+			idx := benchMemIndex(n)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if got := idx.Search(query, 10); len(got) != 10 {
+					b.Fatalf("expected 10 results, got %d", len(got))
+				}
+			}
+		})
+	}
+}
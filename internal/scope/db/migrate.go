@@ -0,0 +1,201 @@
+package db
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/relay"
+)
+
+// LegacyReader streams documents out of a legacy Store's data directory
+// (metadata.jsonl + vectors.bin) without loading them all or ever writing
+// back, unlike Store whose Close rewrites both files
+type LegacyReader struct {
+	meta    *os.File
+	vecs    *bufio.Reader
+	vecFile *os.File
+	scanner *bufio.Scanner
+	count   int // From the vectors.bin header, -1 if vectors are missing
+	read    int
+}
+
+// NewLegacyReader opens the legacy files in dataDir. If vectors.bin is
+// missing, embeddings are regenerated from text, as Store does on load.
+func NewLegacyReader(dataDir string) (*LegacyReader, error) {
+	meta, err := os.Open(filepath.Join(dataDir, "metadata.jsonl"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open legacy metadata: %w", err)
+	}
+
+	r := &LegacyReader{meta: meta, scanner: bufio.NewScanner(meta), count: -1}
+	r.scanner.Buffer(make([]byte, 64*1024), 64*1024*1024) // Documents can be large
+
+	vecFile, err := os.Open(filepath.Join(dataDir, "vectors.bin"))
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		_ = meta.Close()
+		return nil, fmt.Errorf("failed to open legacy vectors: %w", err)
+	}
+	r.vecFile = vecFile
+	r.vecs = bufio.NewReader(vecFile)
+
+	// Header: [num_docs:uint32][dim:uint32]
+	var header [8]byte
+	if _, err := io.ReadFull(r.vecs, header[:]); err != nil {
+		_ = r.Close()
+		return nil, fmt.Errorf("failed to read vectors header: %w", err)
+	}
+	if dim := binary.LittleEndian.Uint32(header[4:8]); dim != relay.EmbeddingDim {
+		_ = r.Close()
+		return nil, fmt.Errorf("dimension mismatch: expected %d, got %d", relay.EmbeddingDim, dim)
+	}
+	r.count = int(binary.LittleEndian.Uint32(header[0:4]))
+	return r, nil
+}
+
+// Count returns the document count from the vectors header, or -1 if unknown
+func (r *LegacyReader) Count() int {
+	return r.count
+}
+
+// Next returns the next document, or io.EOF when done
+func (r *LegacyReader) Next() (Document, error) {
+	var doc Document
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return doc, fmt.Errorf("failed to read legacy metadata: %w", err)
+		}
+		if r.count >= 0 && r.read != r.count {
+			return doc, fmt.Errorf("vector count mismatch: header says %d, metadata has %d", r.count, r.read)
+		}
+		return doc, io.EOF
+	}
+
+	if err := json.Unmarshal(r.scanner.Bytes(), &doc); err != nil {
+		return doc, fmt.Errorf("failed to decode document %d: %w", r.read, err)
+	}
+
+	if r.vecs == nil {
+		doc.Embedding = relay.DeterministicEmbed(doc.Text)
+	} else {
+		if r.read >= r.count {
+			return doc, fmt.Errorf("vector count mismatch: header says %d, metadata has more", r.count)
+		}
+		if err := binary.Read(r.vecs, binary.LittleEndian, &doc.Embedding); err != nil {
+			return doc, fmt.Errorf("failed to read vector %d: %w", r.read, err)
+		}
+	}
+
+	r.read++
+	return doc, nil
+}
+
+// Close closes the legacy files
+func (r *LegacyReader) Close() error {
+	err := r.meta.Close()
+	if r.vecFile != nil {
+		if vErr := r.vecFile.Close(); err == nil {
+			err = vErr
+		}
+	}
+	return err
+}
+
+// MigrationReport summarizes a legacy Store -> WALStore migration
+type MigrationReport struct {
+	DocsRead    int           `json:"docs_read"`
+	DocsWritten int           `json:"docs_written"` // Distinct document IDs in the WAL
+	Sampled     int           `json:"sampled"`
+	Duration    time.Duration `json:"duration"`
+}
+
+// MigrateLegacyStore replays every document of the legacy Store in legacyDir
+// into dst as INSERT records, then verifies the document count and compares a
+// sample of up to sampleSize documents (text and embedding) against the WAL.
+// dst must be empty so a partial earlier run is never silently merged.
+func MigrateLegacyStore(ctx context.Context, legacyDir string, dst *WALStore, sampleSize int) (*MigrationReport, error) {
+	start := time.Now()
+	if n := dst.Count(); n != 0 {
+		return nil, fmt.Errorf("destination WAL store is not empty (%d documents)", n)
+	}
+
+	r, err := NewLegacyReader(legacyDir)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = r.Close() }()
+
+	stride := 1
+	if r.Count() > sampleSize && sampleSize > 0 {
+		stride = r.Count() / sampleSize
+	}
+
+	report := &MigrationReport{}
+	seen := make(map[string]struct{})
+	var samples []Document
+	sampleIdx := make(map[string]int) // DocID -> index in samples
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		doc, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		report.DocsRead++
+
+		if err := dst.AddWithContext(ctx, doc); err != nil {
+			return nil, fmt.Errorf("failed to write document %s: %w", doc.ID, err)
+		}
+		seen[doc.ID] = struct{}{}
+
+		// Later duplicates in metadata.jsonl replace earlier ones, as in Store
+		if i, ok := sampleIdx[doc.ID]; ok {
+			samples[i] = doc
+		} else if len(samples) < sampleSize && (report.DocsRead-1)%stride == 0 {
+			sampleIdx[doc.ID] = len(samples)
+			samples = append(samples, doc)
+		}
+	}
+
+	if err := dst.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to flush WAL: %w", err)
+	}
+
+	report.DocsWritten = dst.Count()
+	if report.DocsWritten != len(seen) {
+		return report, fmt.Errorf("count mismatch: %d distinct legacy documents, %d in WAL", len(seen), report.DocsWritten)
+	}
+
+	for _, want := range samples {
+		got, ok := dst.Get(want.ID)
+		if !ok {
+			return report, fmt.Errorf("sampled document %s missing from WAL", want.ID)
+		}
+		if got.Embedding != want.Embedding {
+			return report, fmt.Errorf("sampled document %s: embedding mismatch", want.ID)
+		}
+		if got.Text != want.Text {
+			return report, fmt.Errorf("sampled document %s: text mismatch", want.ID)
+		}
+		report.Sampled++
+	}
+
+	report.Duration = time.Since(start)
+	return report, nil
+}
@@ -0,0 +1,101 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Postgres error codes for objects that already exist
+var alreadyExistsCodes = map[string]bool{
+	"42P07": true, // duplicate_table
+	"42710": true, // duplicate_object
+	"42701": true, // duplicate_column
+}
+
+// ApplyMigrations runs the *.sql files in fsys that haven't been applied yet,
+// in filename order, each in its own transaction, and returns the names of
+// those it applied. Applied files are tracked in schema_migrations.
+//
+// Databases migrated by hand before tracking existed are adopted: a file that
+// fails only because its objects already exist is recorded as applied.
+func ApplyMigrations(ctx context.Context, pool *pgxpool.Pool, fsys fs.FS) ([]string, error) {
+	_, err := pool.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version TEXT PRIMARY KEY,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migrations: %w", err)
+	}
+	sort.Strings(files)
+
+	var applied []string
+	for _, name := range files {
+		version := strings.TrimSuffix(name, ".sql")
+
+		var exists bool
+		err := pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`, version).Scan(&exists)
+		if err != nil {
+			return applied, fmt.Errorf("failed to check migration %s: %w", version, err)
+		}
+		if exists {
+			continue
+		}
+
+		sql, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return applied, fmt.Errorf("failed to read migration %s: %w", name, err)
+		}
+
+		if err := applyMigration(ctx, pool, version, string(sql)); err != nil {
+			return applied, err
+		}
+		applied = append(applied, version)
+	}
+
+	return applied, nil
+}
+
+// applyMigration runs one migration file and records it
+func applyMigration(ctx context.Context, pool *pgxpool.Pool, version, sql string) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin migration %s: %w", version, err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if _, err := tx.Exec(ctx, sql); err != nil {
+		var pgErr *pgconn.PgError
+		if !errors.As(err, &pgErr) || !alreadyExistsCodes[pgErr.Code] {
+			return fmt.Errorf("failed to apply migration %s: %w", version, err)
+		}
+
+		// Applied before tracking existed; record it on a fresh transaction
+		_ = tx.Rollback(ctx)
+		if _, err := pool.Exec(ctx, `INSERT INTO schema_migrations (version) VALUES ($1) ON CONFLICT DO NOTHING`, version); err != nil {
+			return fmt.Errorf("failed to record migration %s: %w", version, err)
+		}
+		return nil
+	}
+
+	if _, err := tx.Exec(ctx, `INSERT INTO schema_migrations (version) VALUES ($1)`, version); err != nil {
+		return fmt.Errorf("failed to record migration %s: %w", version, err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit migration %s: %w", version, err)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/scope/db/wal"
+)
+
+// Move renames a stored document: From is deleted and Doc written in its
+// place. Doc.ID may equal From to only change the document's collection.
+type Move struct {
+	From string
+	Doc  Document
+}
+
+// ErrMoveSourceMissing is returned when a moved document doesn't exist
+var ErrMoveSourceMissing = errors.New("document to move not found")
+
+// ErrMoveTargetExists is returned when a move's new ID is already taken
+var ErrMoveTargetExists = errors.New("target document already exists")
+
+// MoveDocuments applies moves as one atomic WAL batch: the tombstones of
+// the old IDs and the records of the new ones are recovered together or
+// not at all, so there is no point where neither or both versions exist.
+// A target may reuse an ID that the same call moves away.
+func (s *WALStore) MoveDocuments(ctx context.Context, moves []Move) error {
+	if len(moves) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return fmt.Errorf("store is closed")
+	}
+
+	freed := make(map[string]bool, len(moves))
+	for _, m := range moves {
+		if !s.hasLocked(m.From) {
+			return fmt.Errorf("%w: %s", ErrMoveSourceMissing, m.From)
+		}
+		freed[m.From] = true
+	}
+	for _, m := range moves {
+		if s.hasLocked(m.Doc.ID) && !freed[m.Doc.ID] {
+			return fmt.Errorf("%w: %s", ErrMoveTargetExists, m.Doc.ID)
+		}
+	}
+
+	// Staged versions are written first so the batch supersedes them
+	for _, m := range moves {
+		s.supersedeBackfillsLocked(m.From)
+		s.supersedeBackfillsLocked(m.Doc.ID)
+		if err := s.unstageLocked(m.From); err != nil {
+			return err
+		}
+		if err := s.unstageLocked(m.Doc.ID); err != nil {
+			return err
+		}
+	}
+
+	// Tombstones go first so a target can take an ID moved away in the
+	// same batch
+	info := wal.DeleteInfo{DeletedAt: time.Now(), DeletedBy: wal.DeletedByFromContext(ctx)}
+	entries := make([]wal.RecordRequest, 0, 2*len(moves))
+	written := make(map[string]bool, len(moves))
+	for _, m := range moves {
+		written[m.Doc.ID] = true
+	}
+	for _, m := range moves {
+		if written[m.From] {
+			continue // Overwritten in place below
+		}
+		payload, err := wal.EncodeDeletePayloadWithInfo(m.From, info)
+		if err != nil {
+			return fmt.Errorf("failed to encode delete payload: %w", err)
+		}
+		entries = append(entries, wal.RecordRequest{Type: wal.RecordTypeDelete, Payload: payload})
+	}
+	for _, m := range moves {
+		payload, err := encodeDoc(m.Doc)
+		if err != nil {
+			return err
+		}
+		recType := wal.RecordTypeInsert
+		if freed[m.Doc.ID] {
+			recType = wal.RecordTypeUpdate
+		}
+		entries = append(entries, wal.RecordRequest{Type: recType, Payload: payload})
+	}
+
+	syncNow := s.syncPolicy.Immediate && ConsistencyFromContext(ctx) == ConsistencyDefault
+	lsns, err := s.writer.AppendAtomic(entries, syncNow)
+	if err != nil {
+		return fmt.Errorf("failed to write move to WAL: %w", err)
+	}
+
+	changes := make([]indexChange, 0, len(lsns))
+	for _, m := range moves {
+		if !written[m.From] {
+			moved, _ := s.lookupLocked(m.From)
+			i := len(changes)
+			changes = append(changes, indexChange{id: m.From, deleted: true, lsn: lsns[i], recType: wal.RecordTypeDelete, collection: moved.Collection})
+		}
+	}
+	for _, m := range moves {
+		i := len(changes)
+		changes = append(changes, indexChange{id: m.Doc.ID, doc: m.Doc, lsn: lsns[i], recType: entries[i].Type, collection: m.Doc.Collection})
+	}
+	s.applyLocked(changes, lsns[len(lsns)-1]+1)
+	return nil
+}
@@ -0,0 +1,73 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/relay"
+)
+
+func TestWALStoreMoveDocuments(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultWALStoreConfig(t.TempDir())
+
+	store, err := NewWALStore(ctx, config)
+	if err != nil {
+		t.Fatalf("failed to create WAL store: %v", err)
+	}
+	doc := func(id, collection string) Document {
+		return Document{ID: id, Source: "test", Title: id, Text: "moved text", Collection: collection, CreatedAt: time.Now(), Embedding: relay.DeterministicEmbed("moved text")}
+	}
+	for _, id := range []string{"a", "b", "c"} {
+		_ = store.Add(doc(id, ""))
+	}
+
+	if err := store.MoveDocuments(ctx, []Move{{From: "a", Doc: doc("b", "")}}); !errors.Is(err, ErrMoveTargetExists) {
+		t.Errorf("move onto b = %v, want ErrMoveTargetExists", err)
+	}
+	if err := store.MoveDocuments(ctx, []Move{{From: "x", Doc: doc("y", "")}}); !errors.Is(err, ErrMoveSourceMissing) {
+		t.Errorf("move of x = %v, want ErrMoveSourceMissing", err)
+	}
+
+	// Rename a, swap b and c, and move c to another collection in place
+	moves := []Move{
+		{From: "a", Doc: doc("a2", "")},
+		{From: "b", Doc: doc("c", "")},
+		{From: "c", Doc: doc("b", "")},
+	}
+	if err := store.MoveDocuments(ctx, moves); err != nil {
+		t.Fatalf("move failed: %v", err)
+	}
+	if err := store.MoveDocuments(ctx, []Move{{From: "c", Doc: doc("c", "notes")}}); err != nil {
+		t.Fatalf("collection move failed: %v", err)
+	}
+	check := func(label string) {
+		t.Helper()
+		if _, found := store.Get("a"); found {
+			t.Errorf("%s: a still exists", label)
+		}
+		if _, found := store.Get("a2"); !found {
+			t.Errorf("%s: a2 missing", label)
+		}
+		if d, found := store.Get("c"); !found || d.Collection != "notes" {
+			t.Errorf("%s: c = %+v", label, d)
+		}
+		if store.Count() != 3 {
+			t.Errorf("%s: count = %d, want 3", label, store.Count())
+		}
+	}
+	check("after move")
+	_ = store.Close()
+
+	store, err = NewWALStore(ctx, config)
+	if err != nil {
+		t.Fatalf("failed to reopen WAL store: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+	check("after recovery")
+	if deleted, _ := store.ListDeleted(time.Time{}); len(deleted) != 1 || deleted[0].ID != "a" {
+		t.Errorf("expected only a's old ID to be deleted, got %+v", deleted)
+	}
+}
@@ -0,0 +1,316 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/events"
+	"github.com/dsjohal14/selfstack/internal/libs/membudget"
+	"github.com/dsjohal14/selfstack/internal/scope/db/wal"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog"
+)
+
+// Backend identifies a storage implementation
+type Backend string
+
+// Storage backends
+const (
+	BackendWAL      Backend = "wal"      // WAL + in-memory index (default)
+	BackendFile     Backend = "file"     // Legacy metadata.jsonl + vectors.bin
+	BackendPGVector Backend = "pgvector" // Postgres with the pgvector extension
+)
+
+// Capabilities describes what the opened backend supports, so callers can
+// feature-detect instead of type-asserting on the concrete store
+type Capabilities struct {
+	Backend       Backend `json:"backend"`
+	Delete        bool    `json:"delete"`
+	History       bool    `json:"history"`
+	Snapshots     bool    `json:"snapshots"`
+	Compaction    bool    `json:"compaction"`
+	KeywordSearch bool    `json:"keyword_search"`
+	SegmentAdmin  bool    `json:"segment_admin"` // Segment audit trail, compaction plans
+	KV            bool    `json:"kv"`            // Durable internal key-value entries (see KV)
+}
+
+// CapabilitiesOf detects the capabilities of an already opened store
+func CapabilitiesOf(store Storage) Capabilities {
+	switch s := store.(type) {
+	case *WALStore:
+		return Capabilities{
+			Backend:       BackendWAL,
+			Delete:        true,
+			Compaction:    s.CompactionEnabled(),
+			KeywordSearch: s.index.KeywordIndexEnabled(),
+			SegmentAdmin:  true,
+			KV:            true,
+		}
+	case *Store:
+		return Capabilities{Backend: BackendFile}
+	default:
+		return Capabilities{}
+	}
+}
+
+// OpenConfig selects and configures a storage backend
+type OpenConfig struct {
+	Backend Backend // Empty means BackendWAL
+	DataDir string
+
+	// DatabaseURL enables the Postgres manifest (and compaction) for the WAL
+	// backend and is required for pgvector
+	DatabaseURL string
+
+	// Migrations, when set, are applied to DatabaseURL before opening
+	Migrations fs.FS
+
+	// WAL backend options
+	WAL WALOpenOptions
+
+	Logger zerolog.Logger
+}
+
+// WALOpenOptions are the WAL backend settings normally read from env
+type WALOpenOptions struct {
+	Compaction      bool    // Requires DatabaseURL
+	MinGarbageRatio float64 // < 0 keeps the compactor default
+	SyncImmediate   bool
+	SyncMethod      string // fsync (empty), fdatasync, or odsync
+	ArchiveDir      string
+	KeywordIndex    bool
+	NodeID          uint16 // Origin of WAL records, 0 = unattributed
+
+	// StagingWindow collapses updates to a document within it into one
+	// WAL record (0 disables); see WALStoreConfig.StagingWindow
+	StagingWindow time.Duration
+
+	// AsyncApply indexes writes in the background after they're in the
+	// WAL; see WALStoreConfig.AsyncApply
+	AsyncApply bool
+
+	// DedupWindow is how long operation IDs are remembered (0 disables);
+	// see WALStoreConfig.DedupWindow
+	DedupWindow time.Duration
+
+	// Supervisor runs the background sync and compaction loops; nil runs
+	// them on plain goroutines
+	Supervisor wal.Supervisor
+
+	// Events receives applied records and compaction runs (nil publishes
+	// none); see WALStoreConfig.Events
+	Events *events.Bus
+
+	// Network volumes; see WALStoreConfig
+	SyncDir       bool
+	Lock          string // auto (empty), flock, exclusive, or none
+	AllowUnsafeFS bool
+
+	// IndexBudget caps the memory of the in-memory index (nil for no cap)
+	IndexBudget *membudget.Budget
+
+	// Compression of record payloads: none (empty) or zstd
+	Compression string
+
+	// MaxSegmentAge seals segments whose first record is this old (0 =
+	// size only); see WALStoreConfig.MaxSegmentAge
+	MaxSegmentAge time.Duration
+
+	// CheckpointInterval snapshots the index at a checkpoint this often
+	// (0 disables); see WALStoreConfig.CheckpointInterval
+	CheckpointInterval time.Duration
+
+	// GCGrace is how long orphaned files stay quarantined; see
+	// WALStoreConfig.GCGrace
+	GCGrace time.Duration
+
+	// Throttle WAL appends to WriteBytesPerSec (0 for no limit) with
+	// bursts of WriteBurst; see WALStoreConfig.WriteRateLimit
+	WriteBytesPerSec int64
+	WriteBurst       int64
+}
+
+// Open validates the configuration, connects to Postgres if needed, applies
+// migrations, and returns the selected store with its capabilities
+func Open(ctx context.Context, cfg OpenConfig) (Storage, Capabilities, error) {
+	if cfg.Backend == "" {
+		cfg.Backend = BackendWAL
+	}
+	logger := cfg.Logger
+
+	var pool *pgxpool.Pool
+	switch cfg.Backend {
+	case BackendFile:
+		// No external dependencies
+	case BackendWAL:
+		// Postgres is optional; without it the manifest is in-memory and compaction is off
+	case BackendPGVector:
+		if cfg.DatabaseURL == "" {
+			return nil, Capabilities{}, fmt.Errorf("%s backend requires DATABASE_URL", cfg.Backend)
+		}
+	default:
+		return nil, Capabilities{}, fmt.Errorf("unknown storage backend %q (want wal, file, or pgvector)", cfg.Backend)
+	}
+
+	if cfg.DatabaseURL != "" && cfg.Backend != BackendFile {
+		var err error
+		pool, err = connect(ctx, cfg.DatabaseURL)
+		if err != nil {
+			return nil, Capabilities{}, err
+		}
+
+		if cfg.Migrations != nil {
+			applied, err := ApplyMigrations(ctx, pool, cfg.Migrations)
+			if err != nil {
+				pool.Close()
+				return nil, Capabilities{}, err
+			}
+			if len(applied) > 0 {
+				logger.Info().Strs("migrations", applied).Msg("applied schema migrations")
+			}
+		}
+	}
+
+	var (
+		store Storage
+		err   error
+	)
+	switch cfg.Backend {
+	case BackendFile:
+		logger.Info().Msg("WAL disabled, using legacy store")
+		store, err = NewStore(cfg.DataDir)
+	case BackendWAL:
+		store, err = openWAL(ctx, cfg, pool)
+	case BackendPGVector:
+		err = checkPGVector(ctx, pool)
+		if err == nil {
+			err = fmt.Errorf("pgvector backend is not available in this build")
+		}
+	}
+	if err != nil {
+		if pool != nil {
+			pool.Close()
+		}
+		return nil, Capabilities{}, err
+	}
+
+	return store, CapabilitiesOf(store), nil
+}
+
+// connect opens and pings a Postgres pool
+func connect(ctx context.Context, url string) (*pgxpool.Pool, error) {
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	// Test connection
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+	return pool, nil
+}
+
+// checkPGVector verifies the vector extension can be used
+func checkPGVector(ctx context.Context, pool *pgxpool.Pool) error {
+	var available bool
+	err := pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM pg_available_extensions WHERE name = 'vector')`).Scan(&available)
+	if err != nil {
+		return fmt.Errorf("failed to check for pgvector: %w", err)
+	}
+	if !available {
+		return fmt.Errorf("pgvector backend requires the vector extension, which this server does not provide")
+	}
+	return nil
+}
+
+// openWAL creates a WAL-backed store with optional Postgres manifest
+func openWAL(ctx context.Context, cfg OpenConfig, pool *pgxpool.Pool) (*WALStore, error) {
+	logger := cfg.Logger
+	config := DefaultWALStoreConfig(cfg.DataDir)
+
+	if pool != nil {
+		config.DB = pool
+		config.EnableCompaction = cfg.WAL.Compaction
+		if cfg.WAL.MinGarbageRatio >= 0 {
+			config.CompactionConfig.MinGarbageRatio = cfg.WAL.MinGarbageRatio
+		}
+
+		logger.Info().
+			Bool("compaction", config.EnableCompaction).
+			Float64("garbage_ratio", config.CompactionConfig.MinGarbageRatio).
+			Msg("using Postgres-backed WAL manifest")
+	} else {
+		logger.Info().Msg("using in-memory WAL manifest (no Postgres)")
+	}
+
+	// Configure sync policy
+	if cfg.WAL.SyncImmediate {
+		config.SyncPolicy = wal.ImmediateSyncPolicy()
+		logger.Info().Msg("using immediate WAL sync policy")
+	} else {
+		config.SyncPolicy = wal.DefaultSyncPolicy()
+		logger.Info().Msg("using batched WAL sync policy")
+	}
+
+	// Archive sealed segments so corrupt ones can be repaired on startup
+	if cfg.WAL.ArchiveDir != "" {
+		archive, err := wal.NewLocalArchive(cfg.WAL.ArchiveDir)
+		if err != nil {
+			return nil, err
+		}
+		config.Archive = archive
+		logger.Info().Str("archive_dir", cfg.WAL.ArchiveDir).Msg("archiving sealed WAL segments")
+	}
+
+	// Directory syncs and locking for DATA_DIRs on network volumes
+	lock, err := wal.ParseLockStrategy(cfg.WAL.Lock)
+	if err != nil {
+		return nil, fmt.Errorf("invalid WAL_LOCK: %w", err)
+	}
+	config.Lock = lock
+	config.SyncDir = cfg.WAL.SyncDir
+	config.AllowUnsafeFS = cfg.WAL.AllowUnsafeFS
+	config.IndexBudget = cfg.WAL.IndexBudget
+
+	if config.Compression, err = wal.ParseCompression(cfg.WAL.Compression); err != nil {
+		return nil, fmt.Errorf("invalid WAL_COMPRESSION: %w", err)
+	}
+	if config.SyncPolicy.Method, err = wal.ParseSyncMethod(cfg.WAL.SyncMethod); err != nil {
+		return nil, fmt.Errorf("invalid WAL_SYNC_METHOD: %w", err)
+	}
+
+	// Rebuild keyword postings during recovery for keyword search
+	config.KeywordIndex = cfg.WAL.KeywordIndex
+	config.NodeID = cfg.WAL.NodeID
+	config.Supervisor = cfg.WAL.Supervisor
+	config.CheckpointInterval = cfg.WAL.CheckpointInterval
+	config.MaxSegmentAge = cfg.WAL.MaxSegmentAge
+	config.GCGrace = cfg.WAL.GCGrace
+	config.DedupWindow = cfg.WAL.DedupWindow
+	config.Events = cfg.WAL.Events
+	config.WriteRateLimit = wal.RateLimit{BytesPerSec: cfg.WAL.WriteBytesPerSec, Burst: cfg.WAL.WriteBurst}
+	if config.WriteRateLimit.Enabled() {
+		logger.Info().Int64("bytes_per_sec", config.WriteRateLimit.BytesPerSec).Int64("burst", config.WriteRateLimit.Burst).Msg("throttling WAL writes")
+	}
+
+	// Staged writes are lost in a crash, so say so when they're on
+	config.StagingWindow = cfg.WAL.StagingWindow
+	if config.StagingWindow > 0 {
+		logger.Warn().Dur("window", config.StagingWindow).Msg("staging WAL writes; writes within the window are lost in a crash")
+	}
+	config.AsyncApply = cfg.WAL.AsyncApply
+
+	logger.Info().Str("wal_dir", config.WALDir).Bool("keyword_index", config.KeywordIndex).Uint16("node_id", config.NodeID).Str("compression", string(config.Compression)).Msg("initializing WAL store")
+
+	store, err := NewWALStore(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info().Int("doc_count", store.Count()).Msg("WAL store initialized")
+	return store, nil
+}
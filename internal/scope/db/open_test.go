@@ -0,0 +1,46 @@
+package db
+
+import (
+	"context"
+	"testing"
+)
+
+func TestOpenSelectsBackend(t *testing.T) {
+	ctx := context.Background()
+
+	store, caps, err := Open(ctx, OpenConfig{DataDir: t.TempDir(), WAL: WALOpenOptions{Compaction: true, MinGarbageRatio: -1}})
+	if err != nil {
+		t.Fatalf("failed to open WAL backend: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	if _, ok := store.(*WALStore); !ok {
+		t.Errorf("expected default backend to be WAL, got %T", store)
+	}
+	if caps.Backend != BackendWAL || !caps.Delete || !caps.SegmentAdmin {
+		t.Errorf("unexpected WAL capabilities: %+v", caps)
+	}
+	if caps.Compaction {
+		t.Error("compaction needs Postgres and should be off without DATABASE_URL")
+	}
+
+	file, caps, err := Open(ctx, OpenConfig{Backend: BackendFile, DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("failed to open file backend: %v", err)
+	}
+	defer func() { _ = file.Close() }()
+	if caps != (Capabilities{Backend: BackendFile}) {
+		t.Errorf("unexpected file capabilities: %+v", caps)
+	}
+}
+
+func TestOpenValidatesConfig(t *testing.T) {
+	ctx := context.Background()
+
+	if _, _, err := Open(ctx, OpenConfig{Backend: "bogus", DataDir: t.TempDir()}); err == nil {
+		t.Error("expected error for unknown backend")
+	}
+	if _, _, err := Open(ctx, OpenConfig{Backend: BackendPGVector, DataDir: t.TempDir()}); err == nil {
+		t.Error("expected error for pgvector without DATABASE_URL")
+	}
+}
@@ -0,0 +1,224 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultQueryLogSize is the number of distinct queries a QueryLog keeps
+const DefaultQueryLogSize = 10000
+
+// queryLogKey is the KV entry holding a KV-backed query log
+const queryLogKey = "querylog/queries"
+
+// QueryStat is how often and how recently a query was run in a collection
+type QueryStat struct {
+	Collection string    `json:"collection"`
+	Query      string    `json:"query"` // As most recently typed
+	Count      int       `json:"count"`
+	LastUsed   time.Time `json:"last_used"`
+}
+
+// QueryLog tracks recent and popular search and run queries for type-ahead
+// suggestions. It keeps up to size distinct queries, evicting the least
+// recently used, and persists them as JSON to a file or KV entry on Flush.
+type QueryLog struct {
+	path string // Empty (and no kv) keeps the log in memory only
+	kv   KV
+	size int
+
+	mu    sync.Mutex
+	stats map[string]*QueryStat // Keyed by collection and normalized query
+	dirty bool
+}
+
+// NewQueryLog opens the query log stored at path, or an empty one if the
+// file doesn't exist yet. size <= 0 means DefaultQueryLogSize.
+func NewQueryLog(path string, size int) (*QueryLog, error) {
+	if size <= 0 {
+		size = DefaultQueryLogSize
+	}
+	l := &QueryLog{path: path, size: size, stats: make(map[string]*QueryStat)}
+	if path == "" {
+		return l, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read query log: %w", err)
+	}
+	if err := l.load(data); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// NewKVQueryLog opens the query log stored in kv, so it is recovered and
+// compacted with the documents instead of living in a file of its own.
+// size <= 0 means DefaultQueryLogSize.
+func NewKVQueryLog(kv KV, size int) (*QueryLog, error) {
+	if size <= 0 {
+		size = DefaultQueryLogSize
+	}
+	l := &QueryLog{kv: kv, size: size, stats: make(map[string]*QueryStat)}
+	if data, ok := kv.GetKV(queryLogKey); ok {
+		if err := l.load(data); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// load adds the stats encoded in data
+func (l *QueryLog) load(data []byte) error {
+	var stats []QueryStat
+	if err := json.Unmarshal(data, &stats); err != nil {
+		return fmt.Errorf("failed to decode query log: %w", err)
+	}
+	for i := range stats {
+		l.stats[queryKey(stats[i].Collection, stats[i].Query)] = &stats[i]
+	}
+	l.evictLocked()
+	return nil
+}
+
+// normalizeQuery lowercases a query and collapses its whitespace, so
+// queries differing only in those count as one
+func normalizeQuery(q string) string {
+	return strings.ToLower(strings.Join(strings.Fields(q), " "))
+}
+
+func queryKey(collection, query string) string {
+	return collection + "\x00" + normalizeQuery(query)
+}
+
+// Record counts a run of query in collection at time at
+func (l *QueryLog) Record(collection, query string, at time.Time) {
+	query = strings.Join(strings.Fields(query), " ")
+	if query == "" {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key := queryKey(collection, query)
+	s, ok := l.stats[key]
+	if !ok {
+		s = &QueryStat{Collection: collection}
+		l.stats[key] = s
+	}
+	s.Query = query
+	s.Count++
+	if at.After(s.LastUsed) {
+		s.LastUsed = at
+	}
+	l.dirty = true
+	if !ok {
+		l.evictLocked()
+	}
+}
+
+// Suggest returns up to limit queries of collection starting with prefix
+// (ignoring case), ranked by popularity decayed by age: count divided by one
+// plus the days since last use. An empty prefix returns the most recent.
+func (l *QueryLog) Suggest(collection, prefix string, limit int, now time.Time) []QueryStat {
+	prefix = normalizeQuery(prefix)
+
+	l.mu.Lock()
+	var matches []QueryStat
+	for _, s := range l.stats {
+		if s.Collection == collection && strings.HasPrefix(normalizeQuery(s.Query), prefix) {
+			matches = append(matches, *s)
+		}
+	}
+	l.mu.Unlock()
+
+	rank := func(s QueryStat) float64 {
+		return float64(s.Count) / (1 + now.Sub(s.LastUsed).Hours()/24)
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if prefix == "" {
+			return matches[i].LastUsed.After(matches[j].LastUsed)
+		}
+		if ri, rj := rank(matches[i]), rank(matches[j]); ri != rj {
+			return ri > rj
+		}
+		return matches[i].Query < matches[j].Query
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches
+}
+
+// evictLocked drops the least recently used queries beyond the size
+func (l *QueryLog) evictLocked() {
+	if len(l.stats) <= l.size {
+		return
+	}
+	keys := make([]string, 0, len(l.stats))
+	for k := range l.stats {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return l.stats[keys[i]].LastUsed.Before(l.stats[keys[j]].LastUsed) })
+	for _, k := range keys[:len(keys)-l.size] {
+		delete(l.stats, k)
+	}
+	l.dirty = true
+}
+
+// Flush writes the log to its file or KV entry if it changed since the
+// last flush
+func (l *QueryLog) Flush() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if (l.path == "" && l.kv == nil) || !l.dirty {
+		return nil
+	}
+
+	stats := make([]QueryStat, 0, len(l.stats))
+	for _, s := range l.stats {
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].LastUsed.After(stats[j].LastUsed) })
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return fmt.Errorf("failed to encode query log: %w", err)
+	}
+
+	if l.kv != nil {
+		if err := l.kv.SetKV(context.Background(), queryLogKey, data); err != nil {
+			return fmt.Errorf("failed to store query log: %w", err)
+		}
+		l.dirty = false
+		return nil
+	}
+
+	tmpPath := l.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o644); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to write query log: %w", err)
+	}
+	if err := os.Rename(tmpPath, l.path); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to move query log: %w", err)
+	}
+	l.dirty = false
+	return nil
+}
+
+// Close flushes the log
+func (l *QueryLog) Close() error {
+	return l.Flush()
+}
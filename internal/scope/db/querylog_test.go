@@ -0,0 +1,84 @@
+package db
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestQueryLogSuggest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queries.json")
+	l, err := NewQueryLog(path, 3)
+	if err != nil {
+		t.Fatalf("NewQueryLog failed: %v", err)
+	}
+
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	l.Record("default", "quarterly planning", now.Add(-10*24*time.Hour))
+	l.Record("default", "quarterly planning", now.Add(-10*24*time.Hour))
+	l.Record("default", "quarterly planning", now.Add(-10*24*time.Hour))
+	l.Record("default", "Quarterly  Review", now.Add(-time.Hour))
+	l.Record("default", "quarterly review", now)
+	l.Record("code", "quarterly report", now)
+
+	got := l.Suggest("default", "QUART", 10, now)
+	if len(got) != 2 || got[0].Query != "quarterly review" || got[0].Count != 2 {
+		t.Fatalf("expected the recent review ahead of the older, more frequent planning, got %+v", got)
+	}
+	if got := l.Suggest("default", "", 1, now); len(got) != 1 || got[0].Query != "quarterly review" {
+		t.Errorf("expected the most recent query for an empty prefix, got %+v", got)
+	}
+
+	// A fourth distinct query evicts the least recently used
+	l.Record("default", "on-call rotation", now)
+	if got := l.Suggest("default", "quarterly p", 10, now); len(got) != 0 {
+		t.Errorf("expected quarterly planning evicted, got %+v", got)
+	}
+
+	if err := l.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	l, err = NewQueryLog(path, 3)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	if got := l.Suggest("code", "q", 10, now); len(got) != 1 || got[0].Query != "quarterly report" {
+		t.Errorf("expected the log to survive reopening, got %+v", got)
+	}
+}
+
+func TestKVQueryLog(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultWALStoreConfig(t.TempDir())
+	store, err := NewWALStore(ctx, config)
+	if err != nil {
+		t.Fatalf("failed to create WAL store: %v", err)
+	}
+
+	l, err := NewKVQueryLog(store, 0)
+	if err != nil {
+		t.Fatalf("NewKVQueryLog failed: %v", err)
+	}
+	now := time.Now()
+	l.Record("default", "release checklist", now)
+	if err := l.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("store close failed: %v", err)
+	}
+
+	store, err = NewWALStore(ctx, config)
+	if err != nil {
+		t.Fatalf("failed to reopen WAL store: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+	l, err = NewKVQueryLog(store, 0)
+	if err != nil {
+		t.Fatalf("NewKVQueryLog failed: %v", err)
+	}
+	if got := l.Suggest("default", "rel", 10, now); len(got) != 1 || got[0].Query != "release checklist" {
+		t.Errorf("expected the log to be recovered from the WAL, got %+v", got)
+	}
+}
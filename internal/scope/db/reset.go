@@ -0,0 +1,137 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/scope/db/wal"
+)
+
+// ResetReport summarizes a Reset
+type ResetReport struct {
+	LSN             uint64        `json:"lsn"` // Of the checkpoint the empty store starts from
+	DocsRemoved     int           `json:"docs_removed"`
+	AliasesRemoved  int           `json:"aliases_removed"`
+	SegmentsRemoved int           `json:"segments_removed"` // Segment files deleted, WAL and compacted
+	BytesRemoved    int64         `json:"bytes_removed"`    // Of those segments and their bloom filters
+	Duration        time.Duration `json:"duration"`
+}
+
+// Reset wipes the store's documents and aliases, as between test runs,
+// and deletes the WAL segments and manifest entries that held them.
+// Collections, feature flag overrides, and usage records are kept.
+//
+// The reset commits in one step: the checkpoint starts a new segment and
+// an empty snapshot is written at it, so from then on recovery skips every
+// earlier record. The old segments are removed after that, from the
+// manifest first; segments a crash leaves behind are skipped by recovery
+// and deleted by the next reset. LSNs keep counting up from before the
+// reset.
+func (s *WALStore) Reset(ctx context.Context) (*ResetReport, error) {
+	start := time.Now()
+
+	// A checkpoint would snapshot the documents being removed
+	s.checkpointMu.Lock()
+	defer s.checkpointMu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil, fmt.Errorf("store is closed")
+	}
+	if len(s.backfills) > 0 {
+		return nil, fmt.Errorf("cannot reset while a backfill is running")
+	}
+
+	// Compaction reads and replaces segments, so it waits for the reset
+	if s.compactor != nil {
+		s.compactor.Stop()
+		defer func() {
+			if err := s.compactor.Start(context.Background()); err != nil {
+				fmt.Printf("warning: failed to restart compactor after reset: %v\n", err)
+			}
+		}()
+	}
+
+	// Staged and queued writes are wiped with the rest
+	s.drainLocked()
+	if s.stageTimer != nil {
+		s.stageTimer.Stop()
+		s.stageTimer = nil
+	}
+	s.staged = make(map[string]stagedDoc)
+
+	if err := s.writer.Rotate(); err != nil {
+		return nil, fmt.Errorf("failed to start a new segment: %w", err)
+	}
+	lsn, err := s.writer.AppendWithSync(wal.RecordTypeCheckpoint, wal.EncodeCheckpointDigest(s.writer.CurrentLSN(), wal.IndexDigest{}))
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ResetReport{LSN: lsn, DocsRemoved: s.index.Count()}
+	state := &checkpointState{lsn: lsn, kv: make(map[string][]byte), collections: s.schema.list()}
+	s.kv.mu.RLock()
+	for k, v := range s.kv.entries {
+		if strings.HasPrefix(k, aliasKeyPrefix) {
+			report.AliasesRemoved++
+			continue
+		}
+		state.kv[k] = v
+	}
+	s.kv.mu.RUnlock()
+	if err := s.writeSnapshot(state); err != nil {
+		return nil, fmt.Errorf("failed to write snapshot at LSN %d: %w", lsn, err)
+	}
+	s.checkpointLSN.Store(lsn)
+
+	s.index.Clear()
+	s.kv.mu.Lock()
+	for k := range s.kv.entries {
+		if strings.HasPrefix(k, aliasKeyPrefix) {
+			delete(s.kv.entries, k)
+		}
+	}
+	s.kv.mu.Unlock()
+	s.appliedLSN.Store(s.writer.CurrentLSN())
+
+	// The store is reset; what's left is cleanup. Manifest entries go
+	// before their files, so the repairer never restores a deleted
+	// segment from the archive.
+	keep := s.writer.CurrentSegmentID()
+	if _, err := s.manifest.ClearSegments(wal.WithSegmentActor(ctx, wal.ActorAdmin, "reset"), keep); err != nil {
+		return report, err
+	}
+	if err := s.manifest.UpdateWALState(ctx, keep, s.writer.CurrentLSN()); err != nil {
+		return report, fmt.Errorf("failed to update WAL state: %w", err)
+	}
+
+	segments, err := wal.ListSegmentFiles(s.walDir)
+	if err != nil {
+		return report, err
+	}
+	current := filepath.Join(s.walDir, fmt.Sprintf("wal_%012d.seg", keep))
+	for _, path := range segments {
+		if path == current {
+			continue
+		}
+		for _, p := range []string{path, path + wal.BloomSuffix} {
+			info, err := os.Stat(p)
+			if err != nil {
+				continue
+			}
+			if err := os.Remove(p); err != nil {
+				return report, fmt.Errorf("failed to remove %s: %w", filepath.Base(p), err)
+			}
+			report.BytesRemoved += info.Size()
+		}
+		report.SegmentsRemoved++
+	}
+
+	report.Duration = time.Since(start)
+	return report, nil
+}
@@ -0,0 +1,79 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/dsjohal14/selfstack/internal/relay"
+	"github.com/dsjohal14/selfstack/internal/scope/db/wal"
+)
+
+func TestWALStoreReset(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultWALStoreConfig(t.TempDir())
+	config.MaxSegmentSize = 4096
+
+	store, err := NewWALStore(ctx, config)
+	if err != nil {
+		t.Fatalf("failed to create WAL store: %v", err)
+	}
+	add := func(id string) {
+		if err := store.Add(Document{ID: id, Source: "test", Text: id, Embedding: relay.DeterministicEmbed(id)}); err != nil {
+			t.Fatalf("failed to add %s: %v", id, err)
+		}
+	}
+	for i := 0; i < 20; i++ {
+		add(fmt.Sprintf("doc-%d", i))
+	}
+	if err := NewKVAliasTable(store).Set(ctx, "doc-1", "https://example.com/1"); err != nil {
+		t.Fatal(err)
+	}
+	_ = store.SetKV(ctx, "flag/reranker", []byte("false"))
+	_ = store.LogCollection(ctx, CollectionConfig{Name: "notes"}, false)
+	if store.writer.CurrentSegmentID() == 1 {
+		t.Fatal("expected the documents to span several segments")
+	}
+
+	report, err := store.Reset(ctx)
+	if err != nil {
+		t.Fatalf("reset failed: %v", err)
+	}
+	if report.DocsRemoved != 20 || report.AliasesRemoved != 1 || report.SegmentsRemoved == 0 || report.BytesRemoved == 0 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	if store.Count() != 0 || len(store.ListKV(aliasKeyPrefix)) != 0 {
+		t.Errorf("expected no documents or aliases, got %d and %v", store.Count(), store.ListKV(aliasKeyPrefix))
+	}
+	segments, _ := wal.ListSegmentFiles(config.WALDir)
+	if len(segments) != 1 {
+		t.Errorf("expected only the new segment, got %v", segments)
+	}
+	if sealed, _ := store.manifest.GetSealedSegments(ctx); len(sealed) != 0 {
+		t.Errorf("expected the manifest cleared, got %d sealed segments", len(sealed))
+	}
+
+	add("after")
+	_ = store.Close()
+
+	store, err = NewWALStore(ctx, config)
+	if err != nil {
+		t.Fatalf("failed to reopen WAL store: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+	if _, found := store.Get("after"); !found || store.Count() != 1 {
+		t.Errorf("expected only the document written after the reset, got %d", store.Count())
+	}
+	if v, ok := store.GetKV("flag/reranker"); !ok || string(v) != "false" {
+		t.Error("expected KV entries other than aliases to be kept")
+	}
+	if len(store.ListKV(aliasKeyPrefix)) != 0 {
+		t.Error("expected aliases to stay removed")
+	}
+	if c := store.Collections(); len(c) != 1 || c[0].Config.Name != "notes" {
+		t.Errorf("expected the collection to be kept, got %+v", c)
+	}
+	if store.writer.CurrentLSN() <= report.LSN {
+		t.Errorf("expected LSNs to continue past the reset at %d, got %d", report.LSN, store.writer.CurrentLSN())
+	}
+}
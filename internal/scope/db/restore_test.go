@@ -0,0 +1,69 @@
+package db
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/relay"
+)
+
+func TestRestoreToTime(t *testing.T) {
+	ctx := context.Background()
+	srcDir := t.TempDir()
+
+	src, err := NewWALStore(ctx, DefaultWALStoreConfig(srcDir))
+	if err != nil {
+		t.Fatalf("failed to create WAL store: %v", err)
+	}
+	add := func(id, text string) {
+		if err := src.Add(Document{ID: id, Source: "test", Text: text, Embedding: relay.DeterministicEmbed(text)}); err != nil {
+			t.Fatalf("failed to add %s: %v", id, err)
+		}
+	}
+	add("keep", "original")
+	add("gone", "deleted later")
+	_ = src.LogCollection(ctx, CollectionConfig{Name: "notes", Embedder: relay.ProviderDeterministic}, false)
+	time.Sleep(5 * time.Millisecond)
+	at := time.Now()
+	time.Sleep(5 * time.Millisecond)
+	add("keep", "edited after the restore point")
+	add("new", "added after the restore point")
+	_ = src.LogCollectionDelete(ctx, "notes")
+	if err := src.Delete("gone"); err != nil {
+		t.Fatalf("failed to delete: %v", err)
+	}
+	_ = src.Close()
+
+	dst, err := NewWALStore(ctx, DefaultWALStoreConfig(t.TempDir()))
+	if err != nil {
+		t.Fatalf("failed to create destination store: %v", err)
+	}
+	defer func() { _ = dst.Close() }()
+
+	report, err := RestoreToTime(ctx, filepath.Join(srcDir, "wal"), at, dst)
+	if err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	if report.DocsRestored != 2 || report.Collections != 1 || report.RecordsSkipped != 4 {
+		t.Errorf("expected 2 documents and 1 collection restored and 4 records skipped, got %+v", report)
+	}
+	if c := dst.Collections(); len(c) != 1 || c[0].Config.Name != "notes" {
+		t.Errorf("expected the collection as of the restore point, got %+v", c)
+	}
+	if doc, ok := dst.Get("keep"); !ok || doc.Text != "original" {
+		t.Errorf("expected the original text, got %q (found %v)", doc.Text, ok)
+	}
+	if _, ok := dst.Get("gone"); !ok {
+		t.Error("expected the document deleted after the restore point")
+	}
+	if _, ok := dst.Get("new"); ok {
+		t.Error("expected no document added after the restore point")
+	}
+
+	// The destination must be empty
+	if _, err := RestoreToTime(ctx, filepath.Join(srcDir, "wal"), at, dst); err == nil {
+		t.Error("expected an error restoring into a non-empty store")
+	}
+}
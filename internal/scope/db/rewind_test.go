@@ -0,0 +1,78 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dsjohal14/selfstack/internal/relay"
+	"github.com/dsjohal14/selfstack/internal/scope/db/wal"
+)
+
+func TestWALStoreRewindTo(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultWALStoreConfig(t.TempDir())
+
+	store, err := NewWALStore(ctx, config)
+	if err != nil {
+		t.Fatalf("failed to create WAL store: %v", err)
+	}
+	add := func(id, text string) {
+		if err := store.Add(Document{ID: id, Source: "test", Text: text, Embedding: relay.DeterministicEmbed(text)}); err != nil {
+			t.Fatalf("failed to add %s: %v", id, err)
+		}
+	}
+	check := func(label string, s *WALStore, want map[string]string) {
+		t.Helper()
+		if s.Count() != len(want) {
+			t.Errorf("%s: count = %d, want %d", label, s.Count(), len(want))
+		}
+		for id, text := range want {
+			if d, found := s.Get(id); !found || d.Text != text {
+				t.Errorf("%s: %s = %q (found %v), want %q", label, id, d.Text, found, text)
+			}
+		}
+	}
+	add("a", "first")
+	add("b", "first")
+	add("c", "first")
+	before := store.writer.CurrentLSN() - 1
+
+	// An accidental bulk delete, an edit, and a new document
+	for _, id := range []string{"a", "b"} {
+		_ = store.Delete(id)
+	}
+	add("c", "edited")
+	add("d", "new")
+	after := store.writer.CurrentLSN() - 1
+
+	report, err := store.RewindTo(ctx, wal.RecoveryTarget{LSN: before})
+	if err != nil {
+		t.Fatalf("rewind failed: %v", err)
+	}
+	if report.Restored != 3 || report.Deleted != 1 || report.RecordsSkipped != 4 {
+		t.Errorf("expected 3 restored, 1 deleted, and 4 records skipped, got %+v", report)
+	}
+	original := map[string]string{"a": "first", "b": "first", "c": "first"}
+	check("after rewind", store, original)
+	_ = store.Close()
+
+	// The rewind is in the WAL, and can itself be rewound
+	config.RecoverTo = wal.RecoveryTarget{LSN: after}
+	store, err = NewWALStore(ctx, config)
+	if err != nil {
+		t.Fatalf("failed to reopen WAL store: %v", err)
+	}
+	check("after undoing the rewind", store, map[string]string{"c": "edited", "d": "new"})
+	_ = store.Close()
+
+	config.RecoverTo = wal.RecoveryTarget{}
+	store, err = NewWALStore(ctx, config)
+	if err != nil {
+		t.Fatalf("failed to reopen WAL store: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+	check("after recovery", store, map[string]string{"c": "edited", "d": "new"})
+	if _, err := store.RewindTo(ctx, wal.RecoveryTarget{}); err == nil {
+		t.Error("expected an error for the zero target")
+	}
+}
@@ -0,0 +1,231 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/scope/db/wal"
+)
+
+// CollectionSchema is a collection as the WAL last recorded it
+type CollectionSchema struct {
+	Config CollectionConfig
+	LSN    uint64 // Of the record that last changed it
+
+	// ModelLSN is the LSN of the last embedding model change: documents
+	// written before it were embedded with an earlier model. 0 if the
+	// model never changed.
+	ModelLSN uint64
+}
+
+// SchemaLog records collection changes in the same log as the documents,
+// like the WAL store does
+type SchemaLog interface {
+	// LogCollection records a created or changed collection; embedderChanged
+	// marks a new embedding model
+	LogCollection(ctx context.Context, cfg CollectionConfig, embedderChanged bool) error
+	LogCollectionDelete(ctx context.Context, name string) error
+	// Collections returns the logged collections sorted by name
+	Collections() []CollectionSchema
+}
+
+// schemaMap holds the collections recovered from the WAL; it satisfies
+// wal.SchemaIndex so recovery can fill it
+type schemaMap struct {
+	mu          sync.RWMutex
+	collections map[string]CollectionSchema
+	deleted     map[string]uint64 // Name -> LSN of its latest delete
+}
+
+func newSchemaMap() *schemaMap {
+	return &schemaMap{collections: make(map[string]CollectionSchema), deleted: make(map[string]uint64)}
+}
+
+// ApplySchema applies a collection record. Records older than the
+// collection's latest change or delete are ignored.
+func (m *schemaMap) ApplySchema(ev wal.SchemaEvent) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cur, exists := m.collections[ev.Collection]
+	if ev.Type == wal.RecordTypeCollectionDelete {
+		if exists && cur.LSN > ev.LSN {
+			return
+		}
+		delete(m.collections, ev.Collection)
+		m.deleted[ev.Collection] = max(m.deleted[ev.Collection], ev.LSN)
+		return
+	}
+
+	if ev.LSN < m.deleted[ev.Collection] {
+		return
+	}
+	var cfg CollectionConfig
+	if err := json.Unmarshal(ev.Config, &cfg); err != nil {
+		fmt.Printf("warning: skipping collection record at LSN %d: %v\n", ev.LSN, err)
+		return
+	}
+	if ev.Type == wal.RecordTypeEmbedderChange && ev.LSN > cur.ModelLSN {
+		cur.ModelLSN = ev.LSN
+	}
+	if !exists || ev.LSN > cur.LSN {
+		cur.Config, cur.LSN = cfg, ev.LSN
+	}
+	m.collections[ev.Collection] = cur
+}
+
+func (m *schemaMap) list() []CollectionSchema {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	list := make([]CollectionSchema, 0, len(m.collections))
+	for _, c := range m.collections {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Config.Name < list[j].Config.Name })
+	return list
+}
+
+// LogCollection records a created or changed collection in the WAL,
+// following the sync policy
+func (s *WALStore) LogCollection(ctx context.Context, cfg CollectionConfig, embedderChanged bool) error {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to encode collection: %w", err)
+	}
+	recType := wal.RecordTypeCollection
+	if embedderChanged {
+		recType = wal.RecordTypeEmbedderChange
+	}
+	return s.writeSchema(ctx, recType, cfg.Name, data)
+}
+
+// LogCollectionDelete records a deleted collection in the WAL
+func (s *WALStore) LogCollectionDelete(ctx context.Context, name string) error {
+	return s.writeSchema(ctx, wal.RecordTypeCollectionDelete, name, nil)
+}
+
+// Collections returns the collections logged in the WAL sorted by name
+func (s *WALStore) Collections() []CollectionSchema {
+	return s.schema.list()
+}
+
+func (s *WALStore) writeSchema(ctx context.Context, recType wal.RecordType, name string, config []byte) error {
+	payload, err := wal.EncodeSchemaPayload(name, config)
+	if err != nil {
+		return fmt.Errorf("failed to encode collection payload: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return fmt.Errorf("store is closed")
+	}
+	lsn, err := s.append(ctx, recType, payload)
+	if err != nil {
+		return fmt.Errorf("failed to write collection %s to WAL: %w", name, err)
+	}
+	s.schema.ApplySchema(wal.SchemaEvent{Type: recType, LSN: lsn, Collection: name, Config: config})
+	return nil
+}
+
+// LoggedCollectionRegistry records every change made through a registry in
+// a SchemaLog, so the collections are recovered along with the documents
+type LoggedCollectionRegistry struct {
+	CollectionRegistry
+	log SchemaLog
+}
+
+// SchemaSync summarizes how NewLoggedCollectionRegistry reconciled the
+// registry with the log
+type SchemaSync struct {
+	Logged          []string // Registry collections missing from or outdated in the log
+	EmbedderChanged []string // Logged collections whose embedding model changed
+	Restored        []string // Logged collections put back into an empty registry
+}
+
+// NewLoggedCollectionRegistry wraps reg and reconciles it with log. The
+// registry is the source of truth: collections it holds that the log lacks
+// or records differently are logged. Only when the registry is empty, as
+// after starting on a new database or without collections.json, are the
+// logged collections restored into it.
+func NewLoggedCollectionRegistry(ctx context.Context, reg CollectionRegistry, log SchemaLog) (*LoggedCollectionRegistry, SchemaSync, error) {
+	var report SchemaSync
+	stored, err := reg.List(ctx)
+	if err != nil {
+		return nil, report, err
+	}
+	logged := make(map[string]CollectionConfig)
+	for _, c := range log.Collections() {
+		logged[c.Config.Name] = c.Config
+	}
+
+	if len(stored) == 0 {
+		for _, c := range log.Collections() {
+			if err := reg.Put(ctx, c.Config); err != nil {
+				return nil, report, fmt.Errorf("failed to restore collection %s: %w", c.Config.Name, err)
+			}
+			report.Restored = append(report.Restored, c.Config.Name)
+		}
+		return &LoggedCollectionRegistry{CollectionRegistry: reg, log: log}, report, nil
+	}
+
+	for _, c := range stored {
+		prev, found := logged[c.Name]
+		if found && sameCollection(prev, c) {
+			continue
+		}
+		changed := found && embedderChanged(prev, c)
+		if err := log.LogCollection(ctx, c, changed); err != nil {
+			return nil, report, err
+		}
+		report.Logged = append(report.Logged, c.Name)
+		if changed {
+			report.EmbedderChanged = append(report.EmbedderChanged, c.Name)
+		}
+	}
+	return &LoggedCollectionRegistry{CollectionRegistry: reg, log: log}, report, nil
+}
+
+// Put creates or replaces a collection, then logs it
+func (r *LoggedCollectionRegistry) Put(ctx context.Context, cfg CollectionConfig) error {
+	prev, found, err := r.CollectionRegistry.Get(ctx, cfg.Name)
+	if err != nil {
+		return err
+	}
+	if err := r.CollectionRegistry.Put(ctx, cfg); err != nil {
+		return err
+	}
+	stored, _, err := r.CollectionRegistry.Get(ctx, cfg.Name)
+	if err != nil {
+		return err
+	}
+	return r.log.LogCollection(ctx, stored, found && embedderChanged(prev, stored))
+}
+
+// Delete removes a collection, then logs the delete
+func (r *LoggedCollectionRegistry) Delete(ctx context.Context, name string) error {
+	if err := r.CollectionRegistry.Delete(ctx, name); err != nil {
+		return err
+	}
+	return r.log.LogCollectionDelete(ctx, name)
+}
+
+// sameCollection compares two configs, ignoring when they were stored
+func sameCollection(a, b CollectionConfig) bool {
+	a.CreatedAt, a.UpdatedAt = time.Time{}, time.Time{}
+	b.CreatedAt, b.UpdatedAt = time.Time{}, time.Time{}
+	ja, errA := json.Marshal(a)
+	jb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(ja) == string(jb)
+}
+
+// embedderChanged reports whether documents embedded under a can't be
+// compared with those embedded under b
+func embedderChanged(a, b CollectionConfig) bool {
+	return a.Embedder != b.Embedder || a.Dimensions != b.Dimensions
+}
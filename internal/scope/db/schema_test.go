@@ -0,0 +1,73 @@
+package db
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dsjohal14/selfstack/internal/relay"
+)
+
+func TestLoggedCollectionRegistry(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	config := DefaultWALStoreConfig(dir)
+
+	store, err := NewWALStore(ctx, config)
+	if err != nil {
+		t.Fatalf("failed to create WAL store: %v", err)
+	}
+	files, _ := NewFileCollectionRegistry(dir)
+	reg, _, err := NewLoggedCollectionRegistry(ctx, files, store)
+	if err != nil {
+		t.Fatalf("failed to wrap registry: %v", err)
+	}
+
+	_ = reg.Put(ctx, CollectionConfig{Name: "notes"})
+	_ = reg.Put(ctx, CollectionConfig{Name: "notes", Embedder: relay.ProviderHashing, Dimensions: 64})
+	_ = reg.Put(ctx, CollectionConfig{Name: "notes", Embedder: relay.ProviderHashing, Dimensions: 64, RetentionDays: 30})
+	_ = reg.Put(ctx, CollectionConfig{Name: "scratch"})
+	if err := reg.Delete(ctx, "scratch"); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	_ = store.Close()
+
+	// A cold start recovers the collections, including the model change
+	store, err = NewWALStore(ctx, config)
+	if err != nil {
+		t.Fatalf("failed to reopen WAL store: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+	logged := store.Collections()
+	if len(logged) != 1 {
+		t.Fatalf("expected only notes to be recovered, got %+v", logged)
+	}
+	notes := logged[0]
+	if notes.Config.Embedder != relay.ProviderHashing || notes.Config.RetentionDays != 30 || notes.ModelLSN == 0 || notes.ModelLSN >= notes.LSN {
+		t.Errorf("unexpected recovered collection: %+v", notes)
+	}
+
+	// An empty registry is restored from the WAL
+	_ = os.Remove(filepath.Join(dir, collectionsFile))
+	files, _ = NewFileCollectionRegistry(dir)
+	if _, report, err := NewLoggedCollectionRegistry(ctx, files, store); err != nil || len(report.Restored) != 1 {
+		t.Fatalf("expected notes to be restored, got %+v, %v", report, err)
+	}
+	if cfg, found, _ := files.Get(ctx, "notes"); !found || cfg.Dimensions != 64 {
+		t.Errorf("restored collection = %+v (found=%v)", cfg, found)
+	}
+
+	// Otherwise the registry wins, and a changed model is logged as such
+	_ = files.Put(ctx, CollectionConfig{Name: "notes", Embedder: relay.ProviderDeterministic})
+	_, report, err := NewLoggedCollectionRegistry(ctx, files, store)
+	if err != nil || len(report.Logged) != 1 || len(report.EmbedderChanged) != 1 {
+		t.Fatalf("expected the offline change to be logged, got %+v, %v", report, err)
+	}
+	if _, report, _ := NewLoggedCollectionRegistry(ctx, files, store); len(report.Logged) != 0 {
+		t.Errorf("expected nothing left to log, got %+v", report)
+	}
+	if c := store.Collections()[0]; c.Config.Embedder != relay.ProviderDeterministic || c.ModelLSN != c.LSN {
+		t.Errorf("unexpected collection after reconcile: %+v", c)
+	}
+}
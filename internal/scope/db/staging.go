@@ -0,0 +1,99 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/scope/db/wal"
+)
+
+// stagedDoc is a write held back from the WAL for the staging window
+type stagedDoc struct {
+	doc     Document
+	recType wal.RecordType // Of the first staged write: INSERT unless the WAL has the document
+}
+
+// stageLocked holds doc in memory until the staging window started by the
+// first staged write ends, replacing an earlier staged version of it. The
+// index is updated at once, so the write is searchable immediately.
+func (s *WALStore) stageLocked(doc Document) {
+	if st, ok := s.staged[doc.ID]; ok {
+		st.doc = doc
+		s.staged[doc.ID] = st
+	} else {
+		recType := wal.RecordTypeInsert
+		if s.hasLocked(doc.ID) {
+			recType = wal.RecordTypeUpdate
+		}
+		s.staged[doc.ID] = stagedDoc{doc: doc, recType: recType}
+	}
+	s.applyLocked([]indexChange{{id: doc.ID, doc: doc}}, 0)
+
+	if s.stageTimer == nil {
+		s.stageTimer = time.AfterFunc(s.stagingWindow, s.flushStaged)
+	}
+}
+
+// flushStaged writes the staged documents when the staging window ends.
+// On failure they stay staged and are retried after another window.
+func (s *WALStore) flushStaged() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stageTimer = nil
+	if s.closed {
+		return
+	}
+	if err := s.flushStagedLocked(); err != nil {
+		fmt.Printf("failed to flush staged writes, retrying: %v\n", err)
+		s.stageTimer = time.AfterFunc(s.stagingWindow, s.flushStaged)
+	}
+}
+
+// flushStagedLocked writes every staged document as one WAL record, then
+// syncs them together if the sync policy is immediate
+func (s *WALStore) flushStagedLocked() error {
+	if len(s.staged) == 0 {
+		return nil
+	}
+	for id, st := range s.staged {
+		if err := s.appendDocLocked(st.doc, st.recType); err != nil {
+			return err
+		}
+		delete(s.staged, id)
+	}
+	if s.syncPolicy.Immediate {
+		if err := s.writer.Sync(); err != nil {
+			return fmt.Errorf("failed to sync WAL: %w", err)
+		}
+	}
+	return nil
+}
+
+// unstageLocked writes the staged version of docID, if any, so a write
+// that bypasses staging lands after it in the WAL
+func (s *WALStore) unstageLocked(docID string) error {
+	st, ok := s.staged[docID]
+	if !ok {
+		return nil
+	}
+	if err := s.appendDocLocked(st.doc, st.recType); err != nil {
+		return err
+	}
+	delete(s.staged, docID)
+	return nil
+}
+
+// appendDocLocked writes a staged document to the WAL without syncing
+func (s *WALStore) appendDocLocked(doc Document, recType wal.RecordType) error {
+	payload, err := encodeDoc(doc)
+	if err != nil {
+		return err
+	}
+	lsn, err := s.writer.Append(recType, payload)
+	if err != nil {
+		return fmt.Errorf("failed to write staged %s to WAL: %w", doc.ID, err)
+	}
+	s.applyLocked([]indexChange{{id: doc.ID, indexed: true, lsn: lsn, recType: recType, collection: doc.Collection}}, lsn+1)
+	return nil
+}
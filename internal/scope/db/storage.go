@@ -1,6 +1,8 @@
 package db
 
 import (
+	"time"
+
 	"github.com/dsjohal14/selfstack/internal/relay"
 )
 
@@ -13,6 +15,12 @@ type Storage interface {
 	// Search finds documents similar to the query embedding
 	Search(query relay.Embedding, limit int) []SearchResult
 
+	// SearchFiltered is Search restricted to documents matching filter
+	SearchFiltered(query relay.Embedding, limit int, filter SearchFilter) []SearchResult
+
+	// CountCollection returns the number of documents in a collection
+	CountCollection(collection string) int
+
 	// Count returns the number of documents
 	Count() int
 
@@ -26,3 +34,29 @@ type Storage interface {
 // Ensure both Store and WALStore implement Storage
 var _ Storage = (*Store)(nil)
 var _ Storage = (*WALStore)(nil)
+
+// SearchFilter restricts which documents a search considers
+type SearchFilter struct {
+	Collection   string    // Only documents in this collection (empty = all)
+	CreatedAfter time.Time // Only documents created after this time (zero = all)
+}
+
+// Matches reports whether doc passes the filter
+func (f SearchFilter) Matches(doc Document) bool {
+	if f.Collection != "" && CollectionOf(doc) != f.Collection {
+		return false
+	}
+	if !f.CreatedAfter.IsZero() && !doc.CreatedAt.After(f.CreatedAfter) {
+		return false
+	}
+	return true
+}
+
+// CollectionOf returns the document's collection; documents stored before
+// collections existed belong to DefaultCollection
+func CollectionOf(doc Document) string {
+	if doc.Collection == "" {
+		return DefaultCollection
+	}
+	return doc.Collection
+}
@@ -24,6 +24,8 @@ type Document struct {
 	Metadata  map[string]string `json:"metadata,omitempty"`
 	CreatedAt time.Time         `json:"created_at"`
 	Embedding relay.Embedding   `json:"-"` // Not stored in JSONL, stored in binary
+
+	Collection string `json:"collection,omitempty"` // Empty means DefaultCollection
 }
 
 // Store manages on-disk storage of documents and their embeddings
@@ -74,21 +76,30 @@ func (s *Store) Add(doc Document) error {
 
 // Search finds documents similar to the query embedding
 func (s *Store) Search(query relay.Embedding, limit int) []SearchResult {
+	return s.SearchFiltered(query, limit, SearchFilter{})
+}
+
+// SearchFiltered finds documents similar to the query embedding among those matching filter
+func (s *Store) SearchFiltered(query relay.Embedding, limit int, filter SearchFilter) []SearchResult {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	results := make([]SearchResult, 0, len(s.docs))
 
 	for i := range s.docs {
+		if !filter.Matches(s.docs[i]) {
+			continue
+		}
 		score := relay.CosineSimilarity(query, s.docs[i].Embedding)
 		results = append(results, SearchResult{
-			DocID:     s.docs[i].ID,
-			Score:     score,
-			Title:     s.docs[i].Title,
-			Text:      s.docs[i].Text,
-			Source:    s.docs[i].Source,
-			Metadata:  s.docs[i].Metadata,
-			CreatedAt: s.docs[i].CreatedAt,
+			DocID:      s.docs[i].ID,
+			Score:      score,
+			Title:      s.docs[i].Title,
+			Text:       s.docs[i].Text,
+			Source:     s.docs[i].Source,
+			Metadata:   s.docs[i].Metadata,
+			CreatedAt:  s.docs[i].CreatedAt,
+			Collection: CollectionOf(s.docs[i]),
 		})
 	}
 
@@ -117,6 +128,20 @@ type SearchResult struct {
 	Source    string            `json:"source"`
 	Metadata  map[string]string `json:"metadata,omitempty"`
 	CreatedAt time.Time         `json:"created_at"`
+
+	Collection string `json:"collection"`
+}
+
+// Get retrieves a document by ID
+func (s *Store) Get(docID string) (Document, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for i := range s.docs {
+		if s.docs[i].ID == docID {
+			return s.docs[i], true
+		}
+	}
+	return Document{}, false
 }
 
 // Count returns the number of documents in the store
@@ -126,6 +151,21 @@ func (s *Store) Count() int {
 	return len(s.docs)
 }
 
+// CountCollection returns the number of documents in a collection
+func (s *Store) CountCollection(collection string) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	filter := SearchFilter{Collection: collection}
+	n := 0
+	for i := range s.docs {
+		if filter.Matches(s.docs[i]) {
+			n++
+		}
+	}
+	return n
+}
+
 // Flush writes the store to disk
 func (s *Store) Flush() error {
 	s.mu.Lock()
@@ -0,0 +1,242 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultUsageRetention is how many days of usage a UsageLog keeps
+const DefaultUsageRetention = 400
+
+// usageLogKey is the KV entry holding a KV-backed usage log
+const usageLogKey = "usage/daily"
+
+// usageDay is the layout of the day a usage record covers
+const usageDay = "2006-01-02"
+
+// Usage counts what a caller used
+type Usage struct {
+	IngestedDocs  int64 `json:"ingested_docs"`  // Documents stored, counting chunks
+	IngestedBytes int64 `json:"ingested_bytes"` // Text stored
+	Searches      int64 `json:"searches"`
+	Runs          int64 `json:"runs"`
+	Tokens        int64 `json:"tokens"` // Estimated tokens embedded and generated
+}
+
+// Add adds o to u
+func (u *Usage) Add(o Usage) {
+	u.IngestedDocs += o.IngestedDocs
+	u.IngestedBytes += o.IngestedBytes
+	u.Searches += o.Searches
+	u.Runs += o.Runs
+	u.Tokens += o.Tokens
+}
+
+// UsageRecord is a key's usage on a day, or in a month once rolled up
+type UsageRecord struct {
+	Key    string `json:"key"`
+	Period string `json:"period"` // 2006-01-02, or 2006-01 for a month
+	Usage
+}
+
+// UsageLog meters usage per API key with daily granularity for chargeback
+// and abuse detection. It keeps the days within its retention and persists
+// them as JSON to a file or KV entry on Flush.
+type UsageLog struct {
+	path      string // Empty (and no kv) keeps the log in memory only
+	kv        KV
+	retention int // Days
+
+	mu    sync.Mutex
+	days  map[string]*UsageRecord // Keyed by day and key
+	dirty bool
+}
+
+// NewUsageLog opens the usage log stored at path, or an empty one if the
+// file doesn't exist yet. retention <= 0 means DefaultUsageRetention days.
+func NewUsageLog(path string, retention int) (*UsageLog, error) {
+	l := newUsageLog(retention)
+	l.path = path
+	if path == "" {
+		return l, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read usage log: %w", err)
+	}
+	if err := l.load(data); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// NewKVUsageLog opens the usage log stored in kv, so it is recovered and
+// compacted with the documents. retention <= 0 means DefaultUsageRetention
+// days.
+func NewKVUsageLog(kv KV, retention int) (*UsageLog, error) {
+	l := newUsageLog(retention)
+	l.kv = kv
+	if data, ok := kv.GetKV(usageLogKey); ok {
+		if err := l.load(data); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+func newUsageLog(retention int) *UsageLog {
+	if retention <= 0 {
+		retention = DefaultUsageRetention
+	}
+	return &UsageLog{retention: retention, days: make(map[string]*UsageRecord)}
+}
+
+// load adds the records encoded in data
+func (l *UsageLog) load(data []byte) error {
+	var records []UsageRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return fmt.Errorf("failed to decode usage log: %w", err)
+	}
+	for i := range records {
+		l.days[records[i].Period+"\x00"+records[i].Key] = &records[i]
+	}
+	return nil
+}
+
+// Record adds u to key's usage on the day of at
+func (l *UsageLog) Record(key string, at time.Time, u Usage) {
+	day := at.UTC().Format(usageDay)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	id := day + "\x00" + key
+	rec, ok := l.days[id]
+	if !ok {
+		rec = &UsageRecord{Key: key, Period: day}
+		l.days[id] = rec
+		l.pruneLocked(at)
+	}
+	rec.Add(u)
+	l.dirty = true
+}
+
+// pruneLocked drops the days past the retention
+func (l *UsageLog) pruneLocked(now time.Time) {
+	cutoff := now.UTC().AddDate(0, 0, -l.retention).Format(usageDay)
+	for id, rec := range l.days {
+		if rec.Period < cutoff {
+			delete(l.days, id)
+		}
+	}
+}
+
+// UsageQuery selects usage records
+type UsageQuery struct {
+	Key     string    // Empty means every key
+	From    time.Time // First day included; zero means the oldest kept
+	To      time.Time // Last day included; zero means today
+	Monthly bool      // Roll days up into months
+}
+
+// Usage returns the records q selects, sorted by period and then key
+func (l *UsageLog) Usage(q UsageQuery) []UsageRecord {
+	from, to := "", "9999-12-31"
+	if !q.From.IsZero() {
+		from = q.From.UTC().Format(usageDay)
+	}
+	if !q.To.IsZero() {
+		to = q.To.UTC().Format(usageDay)
+	}
+
+	l.mu.Lock()
+	rollup := make(map[string]*UsageRecord)
+	for _, rec := range l.days {
+		if rec.Period < from || rec.Period > to || (q.Key != "" && rec.Key != q.Key) {
+			continue
+		}
+		period := rec.Period
+		if q.Monthly {
+			period = period[:len("2006-01")]
+		}
+		id := period + "\x00" + rec.Key
+		r, ok := rollup[id]
+		if !ok {
+			r = &UsageRecord{Key: rec.Key, Period: period}
+			rollup[id] = r
+		}
+		r.Add(rec.Usage)
+	}
+	l.mu.Unlock()
+
+	records := make([]UsageRecord, 0, len(rollup))
+	for _, r := range rollup {
+		records = append(records, *r)
+	}
+	sortUsage(records)
+	return records
+}
+
+// sortUsage sorts records by period and then key
+func sortUsage(records []UsageRecord) {
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Period != records[j].Period {
+			return records[i].Period < records[j].Period
+		}
+		return records[i].Key < records[j].Key
+	})
+}
+
+// Flush writes the log to its file or KV entry if it changed since the
+// last flush
+func (l *UsageLog) Flush() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if (l.path == "" && l.kv == nil) || !l.dirty {
+		return nil
+	}
+
+	records := make([]UsageRecord, 0, len(l.days))
+	for _, rec := range l.days {
+		records = append(records, *rec)
+	}
+	sortUsage(records)
+	data, err := json.Marshal(records)
+	if err != nil {
+		return fmt.Errorf("failed to encode usage log: %w", err)
+	}
+
+	if l.kv != nil {
+		if err := l.kv.SetKV(context.Background(), usageLogKey, data); err != nil {
+			return fmt.Errorf("failed to store usage log: %w", err)
+		}
+		l.dirty = false
+		return nil
+	}
+
+	tmpPath := l.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o644); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to write usage log: %w", err)
+	}
+	if err := os.Rename(tmpPath, l.path); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to move usage log: %w", err)
+	}
+	l.dirty = false
+	return nil
+}
+
+// Close flushes the log
+func (l *UsageLog) Close() error {
+	return l.Flush()
+}
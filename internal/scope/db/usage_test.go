@@ -0,0 +1,53 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUsageLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.json")
+	l, err := NewUsageLog(path, 60)
+	if err != nil {
+		t.Fatalf("NewUsageLog failed: %v", err)
+	}
+
+	jan := time.Date(2026, 1, 30, 23, 0, 0, 0, time.UTC)
+	feb := time.Date(2026, 2, 2, 9, 0, 0, 0, time.UTC)
+	l.Record("key_a", jan, Usage{IngestedDocs: 2, IngestedBytes: 100, Tokens: 25})
+	l.Record("key_a", jan.Add(30*time.Minute), Usage{Searches: 1, Tokens: 3})
+	l.Record("key_a", feb, Usage{Runs: 1, Tokens: 40})
+	l.Record("anonymous", feb, Usage{Searches: 2})
+
+	daily := l.Usage(UsageQuery{Key: "key_a"})
+	want := []UsageRecord{
+		{Key: "key_a", Period: "2026-01-30", Usage: Usage{IngestedDocs: 2, IngestedBytes: 100, Searches: 1, Tokens: 28}},
+		{Key: "key_a", Period: "2026-02-02", Usage: Usage{Runs: 1, Tokens: 40}},
+	}
+	if len(daily) != len(want) || daily[0] != want[0] || daily[1] != want[1] {
+		t.Fatalf("daily usage = %+v, want %+v", daily, want)
+	}
+
+	monthly := l.Usage(UsageQuery{From: feb, Monthly: true})
+	if len(monthly) != 2 || monthly[0].Key != "anonymous" || monthly[0].Period != "2026-02" || monthly[1].Runs != 1 {
+		t.Fatalf("monthly usage = %+v", monthly)
+	}
+
+	if err := l.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	l, err = NewUsageLog(path, 60)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	if got := l.Usage(UsageQuery{To: jan}); len(got) != 1 || got[0] != want[0] {
+		t.Fatalf("expected the log to survive reopening, got %+v", got)
+	}
+
+	// Days past the retention are dropped
+	l.Record("key_b", jan.AddDate(0, 0, 61), Usage{Searches: 1})
+	if got := l.Usage(UsageQuery{To: jan}); len(got) != 0 {
+		t.Errorf("expected January pruned, got %+v", got)
+	}
+}
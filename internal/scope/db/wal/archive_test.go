@@ -0,0 +1,193 @@
+package wal
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dsjohal14/selfstack/internal/relay"
+)
+
+// writeSealedSegment writes a single-record segment and registers it as sealed
+func writeSealedSegment(t *testing.T, manifest ManifestStore, dir string, segID uint64, docID string) string {
+	t.Helper()
+	ctx := context.Background()
+
+	path := filepath.Join(dir, SegmentFilename(segID))
+	writer, err := NewSegmentWriter(path)
+	if err != nil {
+		t.Fatalf("failed to create segment writer: %v", err)
+	}
+	rec, _ := NewRecord(RecordTypeInsert, segID, mustEncodeDocPayload(t, docID, DocMetadata{}, relay.Embedding{}))
+	_ = writer.Write(rec)
+	checksum, _ := writer.Finalize()
+	_ = writer.Close()
+
+	_ = manifest.CreateSegment(ctx, segID, path)
+	_ = manifest.SealSegment(ctx, segID, checksum)
+	return path
+}
+
+func TestSegmentRepairerRestoresFromArchive(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	manifest := NewInMemoryManifest()
+
+	archive, err := NewLocalArchive(filepath.Join(dir, "archive"))
+	if err != nil {
+		t.Fatalf("failed to create archive: %v", err)
+	}
+
+	segPath := writeSealedSegment(t, manifest, dir, 1, "doc-1")
+	if err := archiveSegment(ctx, archive, segPath); err != nil {
+		t.Fatalf("failed to archive segment: %v", err)
+	}
+
+	// Corrupt the live copy
+	data, _ := os.ReadFile(segPath)
+	data[HeaderSize+2] ^= 0xFF
+	_ = os.WriteFile(segPath, data, 0644)
+
+	repairer := NewSegmentRepairer(manifest, archive)
+	repaired, err := repairer.RepairCorrupt(ctx)
+	if err != nil {
+		t.Fatalf("repair failed: %v", err)
+	}
+	if len(repaired) != 1 || repaired[0].SegmentID != 1 {
+		t.Fatalf("expected segment 1 to be repaired, got %+v", repaired)
+	}
+
+	sealed, _ := manifest.GetSealedSegments(ctx)
+	valid, err := VerifySegmentChecksum(segPath, *sealed[0].Checksum)
+	if err != nil || !valid {
+		t.Errorf("repaired segment should match manifest checksum (valid=%v, err=%v)", valid, err)
+	}
+}
+
+func TestSegmentRepairerRejectsBadCopy(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	manifest := NewInMemoryManifest()
+
+	archive, _ := NewLocalArchive(filepath.Join(dir, "archive"))
+	segPath := writeSealedSegment(t, manifest, dir, 1, "doc-1")
+
+	// Archive holds a copy that doesn't match the manifest checksum
+	_ = os.WriteFile(filepath.Join(dir, "archive", filepath.Base(segPath)), []byte("garbage"), 0644)
+	_ = os.WriteFile(segPath, []byte("also garbage"), 0644)
+
+	repairer := NewSegmentRepairer(manifest, archive)
+	if _, err := repairer.RepairCorrupt(ctx); err == nil {
+		t.Fatal("expected repair to fail with mismatched archive copy")
+	}
+
+	// Original file must be left untouched
+	data, _ := os.ReadFile(segPath)
+	if string(data) != "also garbage" {
+		t.Error("failed repair should not replace the segment")
+	}
+}
+
+func TestRecoveryRepairsCorruptSegment(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	manifest := NewInMemoryManifest()
+	memIndex := newTestMemIndex()
+
+	archive, _ := NewLocalArchive(filepath.Join(dir, "archive"))
+	segPath := writeSealedSegment(t, manifest, dir, 1, "doc-1")
+	_ = archiveSegment(ctx, archive, segPath)
+	_ = os.Remove(segPath)
+
+	// Without a repairer recovery fails
+	if _, err := NewRecoveryManager(manifest, dir, newTestMemIndex()).Recover(ctx); err == nil {
+		t.Fatal("expected recovery to fail on missing sealed segment")
+	}
+
+	rm := NewRecoveryManager(manifest, dir, memIndex, WithRepairer(NewSegmentRepairer(manifest, archive)))
+	stats, err := rm.Recover(ctx)
+	if err != nil {
+		t.Fatalf("recovery with repairer failed: %v", err)
+	}
+	if stats.SegmentsRepaired != 1 {
+		t.Errorf("expected 1 repaired segment, got %d", stats.SegmentsRepaired)
+	}
+	if !memIndex.Has("doc-1") {
+		t.Error("doc-1 should be recovered from repaired segment")
+	}
+}
+
+func TestWALWriterArchivesSealedSegments(t *testing.T) {
+	dir := t.TempDir()
+	archive, _ := NewLocalArchive(filepath.Join(dir, "archive"))
+
+	writer, err := NewWALWriter(filepath.Join(dir, "wal"),
+		WithSyncPolicy(ImmediateSyncPolicy()),
+		WithMaxSegmentSize(100),
+		WithArchive(archive),
+	)
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+	if _, err := writer.Append(RecordTypeInsert, make([]byte, 200)); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	// Close waits for the segments queued for archival
+	if err := writer.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "archive", SegmentFilename(1))); err != nil {
+		t.Errorf("sealed segment should be archived: %v", err)
+	}
+}
+
+// blockingArchive is an ArchiveBackend whose Put waits for release
+type blockingArchive struct {
+	*LocalArchive
+	started chan string
+	release chan struct{}
+}
+
+func (a *blockingArchive) Put(ctx context.Context, name string, r io.Reader) error {
+	a.started <- name
+	<-a.release
+	return a.LocalArchive.Put(ctx, name, r)
+}
+
+func TestWALWriterArchivesOffWritePath(t *testing.T) {
+	dir := t.TempDir()
+	local, _ := NewLocalArchive(filepath.Join(dir, "archive"))
+	archive := &blockingArchive{LocalArchive: local, started: make(chan string, 4), release: make(chan struct{})}
+
+	writer, err := NewWALWriter(filepath.Join(dir, "wal"),
+		WithSyncPolicy(ImmediateSyncPolicy()),
+		WithMaxSegmentSize(100),
+		WithArchive(archive),
+	)
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+
+	// Each append seals a segment; none waits on the stalled archive
+	for i := 0; i < 3; i++ {
+		if _, err := writer.Append(RecordTypeInsert, make([]byte, 200)); err != nil {
+			t.Fatalf("append failed: %v", err)
+		}
+	}
+	if name := <-archive.started; name != SegmentFilename(1) {
+		t.Errorf("expected %s archived first, got %s", SegmentFilename(1), name)
+	}
+
+	close(archive.release)
+	if err := writer.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	for id := uint64(1); id <= 3; id++ {
+		if _, err := os.Stat(filepath.Join(dir, "archive", SegmentFilename(id))); err != nil {
+			t.Errorf("sealed segment %d should be archived: %v", id, err)
+		}
+	}
+}
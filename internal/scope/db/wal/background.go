@@ -0,0 +1,28 @@
+package wal
+
+import "context"
+
+// Supervisor runs the background loops of the writer and compactor, and
+// can restart the ones that fail; supervise.Supervisor satisfies it. Go
+// returns a channel that is closed once the loop has stopped for good.
+type Supervisor interface {
+	Go(ctx context.Context, name string, loop func(ctx context.Context) error) <-chan struct{}
+}
+
+// unsupervised runs loops on plain goroutines; a panic crashes the process
+type unsupervised struct{}
+
+func (unsupervised) Go(ctx context.Context, _ string, loop func(ctx context.Context) error) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = loop(ctx)
+	}()
+	return done
+}
+
+// Unsupervised returns a Supervisor that runs loops on plain goroutines,
+// for callers given no supervisor
+func Unsupervised() Supervisor {
+	return unsupervised{}
+}
@@ -0,0 +1,142 @@
+package wal
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dsjohal14/selfstack/internal/relay"
+)
+
+// batchIndex is a DocumentIndex recording which documents exist
+type batchIndex map[string]bool
+
+func (b batchIndex) SetRecovered(doc *RecoveredDoc) { b[doc.DocID] = true }
+func (b batchIndex) Delete(docID string)            { delete(b, docID) }
+func (b batchIndex) Has(docID string) bool          { return b[docID] }
+func (b batchIndex) Count() int                     { return len(b) }
+
+func TestAppendAtomicRecovery(t *testing.T) {
+	dir := t.TempDir()
+	writer, err := NewWALWriter(dir, WithSyncPolicy(ImmediateSyncPolicy()))
+	if err != nil {
+		t.Fatalf("failed to create WAL writer: %v", err)
+	}
+	if _, err := writer.Append(RecordTypeInsert, mustEncodeDocPayload(t, "old", DocMetadata{Title: "Old"}, relay.Embedding{})); err != nil {
+		t.Fatal(err)
+	}
+	del, _ := EncodeDeletePayload("old")
+	lsns, err := writer.AppendAtomic([]RecordRequest{
+		{Type: RecordTypeDelete, Payload: del},
+		{Type: RecordTypeInsert, Payload: mustEncodeDocPayload(t, "new", DocMetadata{Title: "Old"}, relay.Embedding{})},
+	}, true)
+	if err != nil || len(lsns) != 2 || lsns[1] != lsns[0]+1 {
+		t.Fatalf("AppendAtomic = %v, %v", lsns, err)
+	}
+	if next := writer.CurrentLSN(); next != lsns[1]+1 {
+		t.Errorf("next LSN = %d, want %d", next, lsns[1]+1)
+	}
+	_ = writer.Close()
+
+	recoverIndex := func() (batchIndex, *RecoveryStats) {
+		index := batchIndex{}
+		stats, err := NewRecoveryManager(NewInMemoryManifest(), dir, index).RecoverWithoutManifest(context.Background())
+		if err != nil {
+			t.Fatalf("recovery failed: %v", err)
+		}
+		return index, stats
+	}
+	if index, _ := recoverIndex(); index["old"] || !index["new"] {
+		t.Fatalf("expected the completed batch to be applied, got %v", index)
+	}
+
+	// A crash before the batch's last record reached disk loses all of it
+	path := filepath.Join(dir, SegmentFilename(1))
+	info, _ := os.Stat(path)
+	if err := os.Truncate(path, info.Size()-10); err != nil {
+		t.Fatal(err)
+	}
+	index, stats := recoverIndex()
+	if !index["old"] || index["new"] || stats.IncompleteBatches != 1 {
+		t.Fatalf("expected the torn batch to be dropped, got %v %+v", index, stats)
+	}
+
+	// Reopening truncates the torn batch, so the next record doesn't complete it
+	writer, err = NewWALWriter(dir, WithSyncPolicy(ImmediateSyncPolicy()), WithInitialLSN(lsns[0]))
+	if err != nil {
+		t.Fatalf("failed to reopen WAL writer: %v", err)
+	}
+	if _, err := writer.Append(RecordTypeInsert, mustEncodeDocPayload(t, "other", DocMetadata{}, relay.Embedding{})); err != nil {
+		t.Fatal(err)
+	}
+	_ = writer.Close()
+	if index, _ := recoverIndex(); !index["old"] || index["new"] || !index["other"] {
+		t.Errorf("expected only old and other, got %v", index)
+	}
+}
+
+func TestRecoverResyncsPastCutBatches(t *testing.T) {
+	dir := t.TempDir()
+	writer, err := NewWALWriter(dir, WithSyncPolicy(ImmediateSyncPolicy()))
+	if err != nil {
+		t.Fatalf("failed to create WAL writer: %v", err)
+	}
+	insert := func(id string) RecordRequest {
+		return RecordRequest{Type: RecordTypeInsert, Payload: mustEncodeDocPayload(t, id, DocMetadata{Title: id}, relay.Embedding{})}
+	}
+	del, _ := EncodeDeletePayload("a")
+	for _, batch := range [][]RecordRequest{
+		{insert("a")},
+		{{Type: RecordTypeDelete, Payload: del}, insert("b")},
+		{insert("c")},
+		{insert("d"), insert("e")},
+		{insert("f")},
+	} {
+		if _, err := writer.AppendAtomic(batch, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = writer.Close()
+
+	// Corrupt the payloads of the first record of one batch and the last
+	// record of another
+	path := filepath.Join(dir, SegmentFilename(1))
+	offsets, _ := recordOffsets(t, path)
+	data, _ := os.ReadFile(path)
+	for _, i := range []int{1, 5} {
+		data[offsets[i]+HeaderSize+TimestampSize+4] ^= 0xFF
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	recoverIndex := func() (batchIndex, *RecoveryStats) {
+		index := batchIndex{}
+		stats, err := NewRecoveryManager(NewInMemoryManifest(), dir, index).RecoverWithoutManifest(context.Background())
+		if err != nil {
+			t.Fatalf("recovery failed: %v", err)
+		}
+		return index, stats
+	}
+	index, stats := recoverIndex()
+	if len(index) != 3 || !index["a"] || !index["c"] || !index["f"] {
+		t.Errorf("expected a, c, and f with both cut batches dropped, got %v", index)
+	}
+	if stats.IncompleteBatches != 2 || stats.CorruptRecords != 2 || stats.BytesSkipped != offsets[2]-offsets[1]+offsets[6]-offsets[5] {
+		t.Errorf("expected 2 corrupt records and 2 incomplete batches, got %+v", stats)
+	}
+
+	// Reopening the segment keeps the records after the corruption
+	writer, err = NewWALWriter(dir, WithSyncPolicy(ImmediateSyncPolicy()), WithInitialLSN(stats.MaxLSN+1))
+	if err != nil {
+		t.Fatalf("failed to reopen WAL writer: %v", err)
+	}
+	if _, err := writer.Append(RecordTypeInsert, insert("g").Payload); err != nil {
+		t.Fatal(err)
+	}
+	_ = writer.Close()
+	if index, _ := recoverIndex(); len(index) != 4 || !index["f"] || !index["g"] {
+		t.Errorf("expected a, c, f, and g, got %v", index)
+	}
+}
@@ -0,0 +1,196 @@
+package wal
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// BloomSuffix is appended to a segment's path to name its bloom filter
+const BloomSuffix = ".bloom"
+
+// bloomFalsePositiveRate is the false positive rate segment filters are sized for
+const bloomFalsePositiveRate = 0.01
+
+// bloomMagic starts an encoded bloom filter
+var bloomMagic = [4]byte{'W', 'B', 'L', 'M'}
+
+// bloomVersion is the encoding version
+const bloomVersion = 1
+
+// BloomFilter answers whether a set of doc IDs may contain an ID: false
+// means definitely not, true means probably
+type BloomFilter struct {
+	k    uint32   // Hashes per ID
+	bits []uint64 // len(bits)*64 bits
+}
+
+// NewBloomFilter sizes a filter for n IDs at false positive rate p
+func NewBloomFilter(n int, p float64) *BloomFilter {
+	n = max(n, 1)
+	m := math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2))
+	words := max(int(math.Ceil(m/64)), 1)
+	k := max(int(math.Round(float64(words*64)/float64(n)*math.Ln2)), 1)
+	return &BloomFilter{k: uint32(min(k, 30)), bits: make([]uint64, words)}
+}
+
+// positions calls fn with the bit of each of the k hashes of id, derived
+// from one 64-bit hash by double hashing
+func (b *BloomFilter) positions(id []byte, fn func(bit uint64) bool) bool {
+	h := fnv.New64a()
+	_, _ = h.Write(id)
+	sum := h.Sum64()
+	h1, h2 := sum&0xffffffff, sum>>32|1
+	m := uint64(len(b.bits)) * 64
+	for i := uint64(0); i < uint64(b.k); i++ {
+		if !fn((h1 + i*h2) % m) {
+			return false
+		}
+	}
+	return true
+}
+
+// Add adds id to the filter
+func (b *BloomFilter) Add(id []byte) {
+	b.positions(id, func(bit uint64) bool {
+		b.bits[bit/64] |= 1 << (bit % 64)
+		return true
+	})
+}
+
+// MayContain reports whether id may have been added
+func (b *BloomFilter) MayContain(id []byte) bool {
+	return b.positions(id, func(bit uint64) bool {
+		return b.bits[bit/64]&(1<<(bit%64)) != 0
+	})
+}
+
+// MarshalBinary encodes the filter: magic, version, k, word count, and the
+// words, little-endian
+func (b *BloomFilter) MarshalBinary() ([]byte, error) {
+	out := make([]byte, 16+8*len(b.bits))
+	copy(out, bloomMagic[:])
+	binary.LittleEndian.PutUint16(out[4:], bloomVersion)
+	binary.LittleEndian.PutUint16(out[6:], uint16(b.k))
+	binary.LittleEndian.PutUint64(out[8:], uint64(len(b.bits)))
+	for i, w := range b.bits {
+		binary.LittleEndian.PutUint64(out[16+8*i:], w)
+	}
+	return out, nil
+}
+
+// UnmarshalBloomFilter decodes a filter written by MarshalBinary
+func UnmarshalBloomFilter(data []byte) (*BloomFilter, error) {
+	if len(data) < 16 || [4]byte(data[:4]) != bloomMagic {
+		return nil, fmt.Errorf("not a bloom filter")
+	}
+	if v := binary.LittleEndian.Uint16(data[4:]); v != bloomVersion {
+		return nil, fmt.Errorf("unsupported bloom filter version %d", v)
+	}
+	k := binary.LittleEndian.Uint16(data[6:])
+	words := binary.LittleEndian.Uint64(data[8:])
+	if k == 0 || words == 0 || uint64(len(data)-16) != 8*words {
+		return nil, fmt.Errorf("corrupt bloom filter")
+	}
+	b := &BloomFilter{k: uint32(k), bits: make([]uint64, words)}
+	for i := range b.bits {
+		b.bits[i] = binary.LittleEndian.Uint64(data[16+8*i:])
+	}
+	return b, nil
+}
+
+// BloomFromIDs builds a filter of ids
+func BloomFromIDs(ids map[string]uint64) *BloomFilter {
+	b := NewBloomFilter(len(ids), bloomFalsePositiveRate)
+	for id := range ids {
+		b.Add([]byte(id))
+	}
+	return b
+}
+
+// BuildSegmentBloom reads a segment and builds a filter of the doc IDs its
+// inserts, updates, and tombstones are for
+func BuildSegmentBloom(path string) (*BloomFilter, error) {
+	ids := make(map[string]uint64)
+	err := scanSegments([]string{path}, func(rec *Record) error {
+		if !isDocRecord(rec.Type) {
+			return nil
+		}
+		id, err := payloadDocID(rec.Payload)
+		if err != nil {
+			return err
+		}
+		ids[string(id)] = rec.LSN
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return BloomFromIDs(ids), nil
+}
+
+// WriteSegmentBloom stores a segment's filter next to it, replacing any
+// earlier one atomically
+func WriteSegmentBloom(segmentPath string, b *BloomFilter) error {
+	data, err := b.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	path := segmentPath + BloomSuffix
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o644); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to write bloom filter: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to move bloom filter: %w", err)
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// LoadSegmentBloom reads the filter stored next to a segment, or returns
+// nil if it has none, like the active segment
+func LoadSegmentBloom(segmentPath string) (*BloomFilter, error) {
+	data, err := os.ReadFile(segmentPath + BloomSuffix)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bloom filter: %w", err)
+	}
+	return UnmarshalBloomFilter(data)
+}
+
+// SegmentsMayContain returns the segments that may hold records of docID:
+// those whose filter may contain it, and those without a readable filter
+func SegmentsMayContain(segments []string, docID string) []string {
+	var out []string
+	for _, path := range segments {
+		b, err := LoadSegmentBloom(path)
+		if err != nil || b == nil || b.MayContain([]byte(docID)) {
+			out = append(out, path)
+		}
+	}
+	return out
+}
+
+// removeSegmentFiles deletes segments and their bloom filters, then syncs
+// their directories so the removals can't be undone by a crash
+func removeSegmentFiles(segments []SegmentInfo) {
+	dirs := make(map[string]bool)
+	for _, seg := range segments {
+		_ = os.Remove(seg.Filename)
+		_ = os.Remove(seg.Filename + BloomSuffix)
+		dirs[filepath.Dir(seg.Filename)] = true
+	}
+	for dir := range dirs {
+		if err := syncDir(dir); err != nil {
+			fmt.Printf("warning: %v after removing segments\n", err)
+		}
+	}
+}
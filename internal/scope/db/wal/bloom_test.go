@@ -0,0 +1,119 @@
+package wal
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dsjohal14/selfstack/internal/relay"
+)
+
+func TestBloomFilter(t *testing.T) {
+	ids := make(map[string]uint64)
+	for i := 0; i < 1000; i++ {
+		ids[fmt.Sprintf("doc-%d", i)] = uint64(i)
+	}
+	b := BloomFromIDs(ids)
+	for id := range ids {
+		if !b.MayContain([]byte(id)) {
+			t.Fatalf("false negative for %s", id)
+		}
+	}
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if b.MayContain([]byte(fmt.Sprintf("other-%d", i))) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 300 {
+		t.Errorf("false positives = %d in 10000, want about 100", falsePositives)
+	}
+
+	data, _ := b.MarshalBinary()
+	decoded, err := UnmarshalBloomFilter(data)
+	if err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	if decoded.k != b.k || len(decoded.bits) != len(b.bits) || !decoded.MayContain([]byte("doc-7")) {
+		t.Error("decoded filter differs")
+	}
+	if _, err := UnmarshalBloomFilter(data[:len(data)-1]); err == nil {
+		t.Error("truncated filter decoded")
+	}
+	if _, err := UnmarshalBloomFilter([]byte("not a filter at all")); err == nil {
+		t.Error("garbage decoded")
+	}
+}
+
+func TestSegmentBloom(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	manifest := NewInMemoryManifest()
+	if err := manifest.CreateSegment(ctx, 1, filepath.Join(dir, SegmentFilename(1))); err != nil {
+		t.Fatal(err)
+	}
+
+	writer, err := NewWALWriter(dir,
+		WithSyncPolicy(ImmediateSyncPolicy()),
+		WithManifest(manifest),
+		WithMaxSegmentSize(1024),
+	)
+	if err != nil {
+		t.Fatalf("failed to create WAL writer: %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		payload := mustEncodeDocPayload(t, fmt.Sprintf("doc-%d", i), DocMetadata{Title: "T"}, relay.Embedding{})
+		if _, err := writer.Append(RecordTypeInsert, payload); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+	}
+	del, _ := EncodeDeletePayload("doc-0")
+	if _, err := writer.AppendWithSync(RecordTypeDelete, del); err != nil {
+		t.Fatal(err)
+	}
+	_ = writer.Close()
+
+	segments, _ := ListSegmentFiles(dir)
+	if len(segments) < 3 {
+		t.Fatalf("expected rotation, got %d segments", len(segments))
+	}
+
+	// Sealed segments get a filter next to them and in the manifest
+	first := segments[0]
+	b, err := LoadSegmentBloom(first)
+	if err != nil || b == nil {
+		t.Fatalf("no bloom filter for %s: %v", first, err)
+	}
+	if !b.MayContain([]byte("doc-0")) {
+		t.Error("first segment's filter misses doc-0")
+	}
+	if data, _ := manifest.GetSegmentBloom(ctx, SegmentTypeWAL, 1); data == nil {
+		t.Error("manifest has no bloom filter for segment 1")
+	}
+	active := segments[len(segments)-1]
+	if b, _ := LoadSegmentBloom(active); b != nil {
+		t.Error("active segment has a bloom filter")
+	}
+
+	// Only the first segment and the unfiltered active one are read for doc-0
+	candidates := SegmentsMayContain(segments, "doc-0")
+	if len(candidates) >= len(segments) || candidates[0] != first || candidates[len(candidates)-1] != active {
+		t.Errorf("candidates = %v of %v", candidates, segments)
+	}
+
+	d, err := FindDeleted(dir, "doc-0")
+	if err != nil || d == nil || d.Previous == nil || d.Previous.DocID != "doc-0" {
+		t.Fatalf("FindDeleted(doc-0) = %+v, %v", d, err)
+	}
+	if d, _ := FindDeleted(dir, "doc-5"); d != nil {
+		t.Errorf("doc-5 is not deleted, got %+v", d)
+	}
+
+	// A lost filter only means the segment is always read
+	_ = os.Remove(first + BloomSuffix)
+	if got := SegmentsMayContain(segments, "nope"); len(got) == 0 || got[0] != first {
+		t.Errorf("segment without a filter skipped: %v", got)
+	}
+}
@@ -0,0 +1,169 @@
+package wal
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+)
+
+// ChangeReader reads the document and collection records of a WAL
+// directory in LSN order, merging its segments, so a changelog can be
+// exported without the segment format. Checkpoints and internal key-value
+// entries are skipped.
+type ChangeReader struct {
+	heads   changeHeap
+	from    uint64
+	through uint64
+	active  string // The writer's segment, whose tail may be mid-write
+	last    uint64 // LSN of the last record read, to skip copies
+	op      Op
+	err     error
+}
+
+// changeHead is the next record of one segment
+type changeHead struct {
+	iter    *SegmentIterator
+	segment string
+	rec     *Record
+}
+
+// changeHeap orders segments by their next record's LSN
+type changeHeap []*changeHead
+
+func (h changeHeap) Len() int           { return len(h) }
+func (h changeHeap) Less(i, j int) bool { return h[i].rec.LSN < h[j].rec.LSN }
+func (h changeHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *changeHeap) Push(x any)        { *h = append(*h, x.(*changeHead)) }
+func (h *changeHeap) Pop() any {
+	old := *h
+	head := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return head
+}
+
+// OpenChanges opens the segments in dir holding records from fromLSN
+// through through. Every segment is opened before anything is read, so a
+// compaction that removes segments afterwards doesn't take records from
+// under the reader; one that removes a segment between listing and opening
+// it is retried. Sealed segments whose footer shows they end before
+// fromLSN aren't read at all.
+func OpenChanges(dir string, fromLSN, through uint64) (*ChangeReader, error) {
+	for attempt := 0; ; attempt++ {
+		r, err := openChanges(dir, fromLSN, through)
+		if err == nil || !errors.Is(err, fs.ErrNotExist) || attempt == 2 {
+			return r, err
+		}
+	}
+}
+
+func openChanges(dir string, fromLSN, through uint64) (*ChangeReader, error) {
+	paths, err := ListSegmentFiles(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list segment files: %w", err)
+	}
+	r := &ChangeReader{from: fromLSN, through: through}
+	for _, path := range paths {
+		if !IsCompactedSegment(path) {
+			r.active = path
+		}
+	}
+
+	for _, path := range paths {
+		iter, err := NewSegmentIteratorFromLSN(path, fromLSN)
+		if err != nil {
+			_ = r.Close()
+			return nil, err
+		}
+		if f := iter.Footer(); f != nil && (f.MaxLSN < fromLSN || f.MinLSN > through) {
+			_ = iter.Close()
+			continue
+		}
+		iter.EnableResync()
+		head := &changeHead{iter: iter, segment: filepath.Base(path)}
+		if r.advance(head) {
+			r.heads = append(r.heads, head)
+		}
+		if r.err != nil {
+			_ = r.Close()
+			return nil, r.err
+		}
+	}
+	heap.Init(&r.heads)
+	return r, nil
+}
+
+// advance moves head to its segment's next record up to through, closing
+// the segment and reporting false when there is none
+func (r *ChangeReader) advance(head *changeHead) bool {
+	if head.iter.Next() {
+		if head.rec = head.iter.Record(); head.rec.LSN <= r.through {
+			return true
+		}
+	} else if err := head.iter.Err(); err != nil && filepath.Base(r.active) != head.segment {
+		r.err = fmt.Errorf("failed to read segment %s: %w", head.segment, err)
+	}
+	_ = head.iter.Close()
+	return false
+}
+
+// Next advances to the next record, reporting false at the end or on an
+// error
+func (r *ChangeReader) Next() bool {
+	for r.err == nil && len(r.heads) > 0 {
+		head := r.heads[0]
+		rec := head.rec
+		if r.advance(head) {
+			heap.Fix(&r.heads, 0)
+		} else {
+			heap.Pop(&r.heads)
+		}
+		if rec.LSN == r.last {
+			continue // A copy, as in a compacted segment beside its sources
+		}
+		r.last = rec.LSN
+		if !isChangeRecord(rec.Type) {
+			continue
+		}
+		op, err := decodeOp(rec, head.segment)
+		if err != nil {
+			r.err = fmt.Errorf("record %d in %s: %w", rec.LSN, head.segment, err)
+			return false
+		}
+		r.op = op
+		return true
+	}
+	return false
+}
+
+// Op returns the current record
+func (r *ChangeReader) Op() Op {
+	return r.op
+}
+
+// Err returns the error that ended the iteration, if any
+func (r *ChangeReader) Err() error {
+	return r.err
+}
+
+// Through returns the last LSN the reader reads up to; a mirror continues
+// from the one after it
+func (r *ChangeReader) Through() uint64 {
+	return r.through
+}
+
+// Close closes the segments still open
+func (r *ChangeReader) Close() error {
+	for _, head := range r.heads {
+		_ = head.iter.Close()
+	}
+	r.heads = nil
+	return nil
+}
+
+// isChangeRecord reports whether records of type t change documents or
+// collections, as opposed to checkpoints and internal entries
+func isChangeRecord(t RecordType) bool {
+	return t == RecordTypeInsert || t == RecordTypeUpdate || t == RecordTypeDelete || isSchemaRecord(t)
+}
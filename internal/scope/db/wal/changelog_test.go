@@ -0,0 +1,85 @@
+package wal
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/dsjohal14/selfstack/internal/relay"
+)
+
+func TestChangeReader(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, lsns []uint64, types []RecordType, payloads [][]byte) {
+		t.Helper()
+		writer, err := NewSegmentWriter(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("failed to create segment writer: %v", err)
+		}
+		for i, lsn := range lsns {
+			rec, _ := NewRecord(types[i], lsn, payloads[i])
+			_ = writer.Write(rec)
+		}
+		_, _ = writer.Finalize()
+		_ = writer.Close()
+	}
+	doc := func(id string) []byte { return mustEncodeDocPayload(t, id, DocMetadata{Title: id}, relay.Embedding{}) }
+	del, _ := EncodeDeletePayload("a")
+	kv, _ := EncodeKVPayload("flags/beta", []byte("on"), false)
+	schema, _ := EncodeSchemaPayload("notes", []byte(`{"name":"notes"}`))
+	checkpoint, _ := EncodeCheckpointPayload(3)
+
+	// A compacted segment holding copies of 1 and 3 sits beside the
+	// segments it replaced; the later segment interleaves with it
+	write(CompactedSegmentFilename(3), []uint64{1, 3}, []RecordType{RecordTypeInsert, RecordTypeInsert}, [][]byte{doc("a"), doc("c")})
+	write(SegmentFilename(1), []uint64{1, 2, 3}, []RecordType{RecordTypeInsert, RecordTypeInsert, RecordTypeInsert}, [][]byte{doc("a"), doc("b"), doc("c")})
+	write(SegmentFilename(2), []uint64{4, 5, 6, 7, 8},
+		[]RecordType{RecordTypeKV, RecordTypeCheckpoint, RecordTypeCollection, RecordTypeDelete, RecordTypeUpdate},
+		[][]byte{kv, checkpoint, schema, del, doc("b")})
+
+	read := func(from, through uint64) []Op {
+		t.Helper()
+		r, err := OpenChanges(dir, from, through)
+		if err != nil {
+			t.Fatalf("OpenChanges failed: %v", err)
+		}
+		defer func() { _ = r.Close() }()
+		var ops []Op
+		for r.Next() {
+			ops = append(ops, r.Op())
+		}
+		if err := r.Err(); err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+		return ops
+	}
+	lsns := func(ops []Op) []uint64 {
+		out := make([]uint64, len(ops))
+		for i, op := range ops {
+			out[i] = op.LSN
+		}
+		return out
+	}
+
+	// Each LSN once, in order, without the KV entry or the checkpoint
+	ops := read(0, 100)
+	if got := lsns(ops); len(got) != 6 || got[0] != 1 || got[2] != 3 || got[3] != 6 || got[5] != 8 {
+		t.Fatalf("expected LSNs 1 2 3 6 7 8, got %v", got)
+	}
+	if op := ops[3]; op.Type != RecordTypeCollection || op.Key != "notes" || string(op.Value) != `{"name":"notes"}` {
+		t.Errorf("unexpected collection op %+v", op)
+	}
+	if op := ops[4]; op.Type != RecordTypeDelete || op.Key != "a" || op.Delete == nil {
+		t.Errorf("unexpected delete op %+v", op)
+	}
+	if op := ops[5]; op.Doc == nil || op.Doc.DocID != "b" {
+		t.Errorf("unexpected update op %+v", op)
+	}
+
+	// Bounded on both ends
+	if got := lsns(read(3, 7)); len(got) != 3 || got[0] != 3 || got[2] != 7 {
+		t.Errorf("expected LSNs 3 6 7, got %v", got)
+	}
+	if got := read(9, 100); len(got) != 0 {
+		t.Errorf("expected nothing past the end, got %v", lsns(got))
+	}
+}
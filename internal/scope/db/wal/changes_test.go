@@ -0,0 +1,69 @@
+package wal
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/relay"
+)
+
+func TestScanChanges(t *testing.T) {
+	dir := t.TempDir()
+	at := func(hour int) time.Time { return time.Date(2026, 3, 1, hour, 0, 0, 0, time.UTC) }
+
+	del, _ := EncodeDeletePayload("a")
+	kv, _ := EncodeKVPayload("flags/beta", []byte("on"), false)
+	schema, _ := EncodeSchemaPayload("notes", []byte("{}"))
+	checkpoint, _ := EncodeCheckpointPayload(4)
+	records := []struct {
+		typ     RecordType
+		payload []byte
+		hour    int // 0 for no timestamp
+	}{
+		{RecordTypeInsert, mustEncodeDocPayload(t, "old", DocMetadata{}, relay.Embedding{}), 0},
+		{RecordTypeInsert, mustEncodeDocPayload(t, "a", DocMetadata{}, relay.Embedding{}), 13},
+		{RecordTypeUpdate, mustEncodeDocPayload(t, "a", DocMetadata{}, relay.Embedding{}), 14},
+		{RecordTypeKV, kv, 14},
+		{RecordTypeCheckpoint, checkpoint, 14},
+		{RecordTypeCollection, schema, 14},
+		{RecordTypeDelete, del, 15},
+	}
+
+	writer, err := NewSegmentWriter(filepath.Join(dir, SegmentFilename(1)))
+	if err != nil {
+		t.Fatalf("failed to create segment writer: %v", err)
+	}
+	for i, r := range records {
+		rec, _ := NewRecord(r.typ, uint64(i+1), r.payload)
+		if r.hour > 0 {
+			rec.SetTimestamp(NewHLC(at(r.hour), 0))
+		}
+		_ = writer.Write(rec)
+	}
+	_, _ = writer.Finalize()
+	_ = writer.Close()
+
+	changes, err := ScanChanges(dir, at(14), at(15))
+	if err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+	want := []Change{
+		{LSN: 3, Type: RecordTypeUpdate, Key: "a"},
+		{LSN: 4, Type: RecordTypeKV, Key: "flags/beta"},
+		{LSN: 6, Type: RecordTypeCollection, Key: "notes"},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("expected %d changes, got %+v", len(want), changes)
+	}
+	for i, c := range changes {
+		if c.LSN != want[i].LSN || c.Type != want[i].Type || c.Key != want[i].Key || !c.At.Wall().Equal(at(14)) {
+			t.Errorf("change %d: got %+v, want %+v", i, c, want[i])
+		}
+	}
+
+	all, _ := ScanChanges(dir, time.Time{}, time.Time{})
+	if len(all) != 5 || all[0].LSN != 2 || all[4].Type != RecordTypeDelete {
+		t.Errorf("expected every timestamped write, got %+v", all)
+	}
+}
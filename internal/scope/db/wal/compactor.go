@@ -5,10 +5,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"sort"
 	"sync"
 	"time"
 
+	"github.com/dsjohal14/selfstack/internal/libs/events"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -23,8 +23,35 @@ type CompactorConfig struct {
 	// CompactionInterval is how often to check for compaction opportunities
 	CompactionInterval time.Duration
 
+	// MinGarbageRatio, when > 0, makes the estimated share of dead records
+	// (superseded, dropped tombstones, checkpoints) the compaction trigger.
+	// Clean segments are left alone regardless of how many there are.
+	MinGarbageRatio float64
+
 	// TmpDir is the directory for temporary files during compaction
 	TmpDir string
+
+	// Compression compresses the payloads of compacted segments, like
+	// WithCompression does for the writer
+	Compression Compression
+
+	// Supervisor runs the background loop and restarts it if a run panics;
+	// nil runs it on a plain goroutine
+	Supervisor Supervisor
+
+	// Events receives a CompactionRun on events.TopicCompactionRun after
+	// every run that selected segments (nil publishes none)
+	Events *events.Bus
+}
+
+// CompactionRun describes a compaction run that selected segments
+type CompactionRun struct {
+	Forced    bool          `json:"forced"`
+	Segments  []uint64      `json:"segments"`             // Merged segment IDs
+	SegmentID uint64        `json:"segment_id,omitempty"` // Compacted segment written; 0 if every record was dropped
+	Records   int           `json:"records"`              // Records kept in the compacted segment
+	Duration  time.Duration `json:"duration_ns"`
+	Error     string        `json:"error,omitempty"` // Why the run failed; the segments were left sealed
 }
 
 // DefaultCompactorConfig returns a reasonable default configuration
@@ -33,6 +60,7 @@ func DefaultCompactorConfig() CompactorConfig {
 		MinSegmentsToCompact:     2,
 		MaxSegmentsPerCompaction: 10,
 		CompactionInterval:       5 * time.Minute,
+		MinGarbageRatio:          0.25,
 		TmpDir:                   "",
 	}
 }
@@ -46,8 +74,12 @@ type Compactor struct {
 
 	mu      sync.Mutex
 	running bool
-	stopCh  chan struct{}
-	doneCh  chan struct{}
+	stop    context.CancelFunc
+	doneCh  <-chan struct{}
+
+	// Last garbage scan, keyed by candidate segment IDs (guarded by mu)
+	lastScan    *CompactionPlan
+	lastScanKey string
 }
 
 // NewCompactor creates a new compactor
@@ -72,16 +104,25 @@ func (c *Compactor) Start(ctx context.Context) error {
 		return fmt.Errorf("compactor already running")
 	}
 	c.running = true
-	c.stopCh = make(chan struct{})
-	c.doneCh = make(chan struct{})
 	c.mu.Unlock()
 
 	// Create tmp directory
 	if err := os.MkdirAll(c.config.TmpDir, 0755); err != nil {
+		c.mu.Lock()
+		c.running = false
+		c.mu.Unlock()
 		return fmt.Errorf("failed to create tmp directory: %w", err)
 	}
 
-	go c.runLoop(ctx)
+	sup := c.config.Supervisor
+	if sup == nil {
+		sup = unsupervised{}
+	}
+	ctx, stop := context.WithCancel(ctx)
+	c.mu.Lock()
+	c.stop = stop
+	c.doneCh = sup.Go(ctx, "compactor", c.runLoop)
+	c.mu.Unlock()
 	return nil
 }
 
@@ -92,29 +133,26 @@ func (c *Compactor) Stop() {
 		c.mu.Unlock()
 		return
 	}
+	stop, done := c.stop, c.doneCh
 	c.mu.Unlock()
 
-	close(c.stopCh)
-	<-c.doneCh
+	stop()
+	<-done
 
 	c.mu.Lock()
 	c.running = false
 	c.mu.Unlock()
 }
 
-// runLoop is the main compaction loop
-func (c *Compactor) runLoop(ctx context.Context) {
-	defer close(c.doneCh)
-
+// runLoop is the main compaction loop; it runs until ctx is canceled
+func (c *Compactor) runLoop(ctx context.Context) error {
 	ticker := time.NewTicker(c.config.CompactionInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
-			return
-		case <-c.stopCh:
-			return
+			return nil
 		case <-ticker.C:
 			if err := c.Compact(ctx); err != nil {
 				// Log error but continue
@@ -129,31 +167,40 @@ func (c *Compactor) Compact(ctx context.Context) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	// Get sealed WAL segments only (not compacted segments)
-	segments, err := c.manifest.GetSealedWALSegments(ctx)
+	ctx = WithSegmentActor(ctx, ActorCompactor, "scheduled compaction")
+
+	// Select sealed WAL segments and check the count/garbage thresholds
+	plan, segments, err := c.planLocked(ctx, false)
 	if err != nil {
-		return fmt.Errorf("failed to get sealed WAL segments: %w", err)
+		return err
 	}
-
-	if len(segments) < c.config.MinSegmentsToCompact {
-		return nil // Nothing to compact
+	if !plan.WouldCompact {
+		return nil // Nothing worth compacting
 	}
 
-	// Sort by segment ID
-	sort.Slice(segments, func(i, j int) bool {
-		return segments[i].SegmentID < segments[j].SegmentID
-	})
+	return c.runLocked(ctx, segments, false)
+}
 
-	// Limit number of segments to compact
-	if len(segments) > c.config.MaxSegmentsPerCompaction {
-		segments = segments[:c.config.MaxSegmentsPerCompaction]
+// runLocked compacts segments and publishes the run
+func (c *Compactor) runLocked(ctx context.Context, segments []SegmentInfo, forced bool) error {
+	start := time.Now()
+	run := CompactionRun{Forced: forced, Segments: make([]uint64, len(segments))}
+	for i, seg := range segments {
+		run.Segments[i] = seg.SegmentID
 	}
 
-	return c.compactSegments(ctx, segments)
+	err := c.compactSegments(ctx, segments, &run)
+	run.Duration = time.Since(start)
+	if err != nil {
+		run.Error = err.Error()
+	}
+	c.config.Events.Publish(events.TopicCompactionRun, run)
+	return err
 }
 
-// compactSegments merges the given segments into a new compacted segment
-func (c *Compactor) compactSegments(ctx context.Context, segments []SegmentInfo) error {
+// compactSegments merges the given segments into a new compacted segment,
+// filling in what it wrote in run
+func (c *Compactor) compactSegments(ctx context.Context, segments []SegmentInfo, run *CompactionRun) error {
 	if len(segments) == 0 {
 		return nil
 	}
@@ -164,6 +211,7 @@ func (c *Compactor) compactSegments(ctx context.Context, segments []SegmentInfo)
 	rollbackToSealed := func() {
 		rollbackCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
+		rollbackCtx = WithSegmentActor(rollbackCtx, ActorCompactor, "compaction failed, rolled back")
 		for _, seg := range segments {
 			_ = c.manifest.UpdateSegmentStatus(rollbackCtx, seg.SegmentID, SegmentStatusSealed)
 		}
@@ -178,28 +226,14 @@ func (c *Compactor) compactSegments(ctx context.Context, segments []SegmentInfo)
 		}
 	}
 
-	// Merge records - returns live records and tombstone records separately
-	records, tombstoneRecords, err := c.mergeRecords(segments)
+	// Pass 1: find the newest LSN for each document (IDs only, no payloads)
+	latest, err := latestLSNs(segments)
 	if err != nil {
 		rollbackToSealed()
 		return fmt.Errorf("failed to merge records: %w", err)
 	}
 
-	// IMPORTANT: We must preserve tombstones in the compacted output!
-	// If we drop them, deleted documents can reappear when they exist in
-	// older compacted segments (the tombstone is the only thing masking
-	// the old INSERT during recovery).
-	//
-	// Merge live records and tombstones into a single map for writing
-	allRecords := make(map[string]*Record)
-	for docID, rec := range records {
-		allRecords[docID] = rec
-	}
-	for docID, rec := range tombstoneRecords {
-		allRecords[docID] = rec
-	}
-
-	if len(allRecords) == 0 {
+	if len(latest) == 0 {
 		// No records at all, just archive the segments
 		segmentIDs := make([]uint64, len(segments))
 		for i, seg := range segments {
@@ -210,9 +244,7 @@ func (c *Compactor) compactSegments(ctx context.Context, segments []SegmentInfo)
 			return fmt.Errorf("failed to archive segments: %w", err)
 		}
 		// Delete segment files
-		for _, seg := range segments {
-			_ = os.Remove(seg.Filename)
-		}
+		removeSegmentFiles(segments)
 		return nil
 	}
 
@@ -223,30 +255,23 @@ func (c *Compactor) compactSegments(ctx context.Context, segments []SegmentInfo)
 		rollbackToSealed()
 		return fmt.Errorf("failed to create temp segment: %w", err)
 	}
+	writer.SetCompression(c.config.Compression)
 
-	// Sort records by LSN for consistent ordering
-	sortedRecords := make([]*Record, 0, len(allRecords))
-	for _, rec := range allRecords {
-		sortedRecords = append(sortedRecords, rec)
+	// Pass 2: stream the newest record per document (tombstones included) in LSN order
+	merged, err := writeMerged(segments, latest, writer)
+	if err != nil {
+		_ = writer.Close()
+		_ = os.Remove(tmpPath)
+		rollbackToSealed()
+		return fmt.Errorf("failed to write merged segment: %w", err)
 	}
-	sort.Slice(sortedRecords, func(i, j int) bool {
-		return sortedRecords[i].LSN < sortedRecords[j].LSN
-	})
 
-	var minLSN, maxLSN uint64
-	for i, rec := range sortedRecords {
-		if err := writer.Write(rec); err != nil {
-			_ = writer.Close()
-			_ = os.Remove(tmpPath)
-			rollbackToSealed()
-			return fmt.Errorf("failed to write record: %w", err)
-		}
-		if i == 0 {
-			minLSN = rec.LSN
-		}
-		maxLSN = rec.LSN
+	if err := writer.WriteFooter(); err != nil {
+		_ = writer.Close()
+		_ = os.Remove(tmpPath)
+		rollbackToSealed()
+		return fmt.Errorf("failed to seal merged segment: %w", err)
 	}
-
 	checksum, err := writer.Finalize()
 	if err != nil {
 		_ = writer.Close()
@@ -258,6 +283,15 @@ func (c *Compactor) compactSegments(ctx context.Context, segments []SegmentInfo)
 	sizeBytes := writer.Offset()
 	_ = writer.Close()
 
+	// The filter covers every document with a record in the output
+	filter := BloomFromIDs(latest)
+	bloom, err := filter.MarshalBinary()
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		rollbackToSealed()
+		return fmt.Errorf("failed to encode bloom filter: %w", err)
+	}
+
 	// Determine new segment ID for the compacted segment
 	// Compacted segments use a separate filename namespace (cmp_) to avoid
 	// ID collisions with the live WAL writer during rotation
@@ -285,12 +319,13 @@ func (c *Compactor) compactSegments(ctx context.Context, segments []SegmentInfo)
 	}
 
 	// Archive old WAL segments in transaction (will be committed atomically)
-	for _, seg := range segments {
-		_, err := tx.Exec(ctx, "UPDATE wal_segments SET status = 'archived' WHERE segment_id = $1 AND segment_type = 'wal'", seg.SegmentID)
-		if err != nil {
-			cleanupTxError(tmpPath)
-			return fmt.Errorf("failed to archive WAL segment %d: %w", seg.SegmentID, err)
-		}
+	segmentIDs := make([]uint64, len(segments))
+	for i, seg := range segments {
+		segmentIDs[i] = seg.SegmentID
+	}
+	if err := archiveWALSegments(ctx, tx, segmentIDs); err != nil {
+		cleanupTxError(tmpPath)
+		return fmt.Errorf("failed to archive WAL segments: %w", err)
 	}
 
 	// Move temp file to final location (use compacted segment namespace)
@@ -299,16 +334,26 @@ func (c *Compactor) compactSegments(ctx context.Context, segments []SegmentInfo)
 		cleanupTxError(tmpPath)
 		return fmt.Errorf("failed to move compacted segment: %w", err)
 	}
+	// The manifest is about to point at finalPath, so the rename must be
+	// durable before the transaction commits
+	if err := syncDir(c.segmentDir); err != nil {
+		cleanupTxError(finalPath)
+		return err
+	}
 
 	// Register new compacted segment (segment_type='cmp')
 	_, err = tx.Exec(ctx, `
-		INSERT INTO wal_segments (segment_id, segment_type, filename, size_bytes, record_count, min_lsn, max_lsn, status, checksum, sealed_at, created_at)
-		VALUES ($1, 'cmp', $2, $3, $4, $5, $6, 'sealed', $7, NOW(), NOW())
-	`, newSegmentID, finalPath, sizeBytes, len(sortedRecords), minLSN, maxLSN, checksum)
+		INSERT INTO wal_segments (segment_id, segment_type, filename, size_bytes, record_count, min_lsn, max_lsn, status, checksum, bloom, sealed_at, created_at)
+		VALUES ($1, 'cmp', $2, $3, $4, $5, $6, 'sealed', $7, $8, NOW(), NOW())
+	`, newSegmentID, finalPath, sizeBytes, merged.Records, merged.MinLSN, merged.MaxLSN, checksum, bloom)
 	if err != nil {
 		cleanupTxError(finalPath)
 		return fmt.Errorf("failed to register compacted segment: %w", err)
 	}
+	if err := insertSegmentEvent(ctx, tx, newSegmentEvent(ctx, SegmentTypeCompacted, newSegmentID, "", SegmentStatusSealed)); err != nil {
+		cleanupTxError(finalPath)
+		return err
+	}
 
 	if err := tx.Commit(ctx); err != nil {
 		// Commit failed - tx already rolled back by driver, just cleanup
@@ -317,95 +362,18 @@ func (c *Compactor) compactSegments(ctx context.Context, segments []SegmentInfo)
 		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
-	// Delete old segment files
-	for _, seg := range segments {
-		_ = os.Remove(seg.Filename)
+	// Without its filter a segment is scanned for every lookup, so a
+	// failure here only costs speed
+	if err := WriteSegmentBloom(finalPath, filter); err != nil {
+		fmt.Printf("warning: %v for segment %s\n", err, finalPath)
 	}
 
-	return nil
-}
-
-// mergeRecords reads all records from segments, returning:
-// - records: latest INSERT/UPDATE for each live document (not deleted)
-// - tombstones: latest DELETE record for each deleted document
-// Both must be preserved in compacted output to prevent deleted docs from reappearing.
-func (c *Compactor) mergeRecords(segments []SegmentInfo) (map[string]*Record, map[string]*Record, error) {
-	records := make(map[string]*Record)    // DocID -> latest INSERT/UPDATE record
-	tombstones := make(map[string]*Record) // DocID -> latest DELETE record
-	recordLSN := make(map[string]uint64)   // DocID -> LSN of latest record
-
-	for _, seg := range segments {
-		// Verify checksum if available
-		if seg.Checksum != nil {
-			valid, err := VerifySegmentChecksum(seg.Filename, *seg.Checksum)
-			if err != nil {
-				return nil, nil, fmt.Errorf("failed to verify segment %s: %w", seg.Filename, err)
-			}
-			if !valid {
-				return nil, nil, fmt.Errorf("segment %s checksum mismatch", seg.Filename)
-			}
-		}
-
-		iter, err := NewSegmentIterator(seg.Filename)
-		if err != nil {
-			return nil, nil, fmt.Errorf("failed to open segment %s: %w", seg.Filename, err)
-		}
-
-		for iter.Next() {
-			rec := iter.Record()
-
-			var docID string
-			switch rec.Type {
-			case RecordTypeInsert, RecordTypeUpdate:
-				var err error
-				docID, _, _, err = DecodeDocPayload(rec.Payload)
-				if err != nil {
-					_ = iter.Close()
-					return nil, nil, fmt.Errorf("failed to decode payload: %w", err)
-				}
-			case RecordTypeDelete:
-				var err error
-				docID, err = DecodeDeletePayload(rec.Payload)
-				if err != nil {
-					_ = iter.Close()
-					return nil, nil, fmt.Errorf("failed to decode delete payload: %w", err)
-				}
-			case RecordTypeCheckpoint:
-				// Skip checkpoint records
-				continue
-			default:
-				continue
-			}
-
-			// Only keep the record with the highest LSN for each document
-			existingLSN, exists := recordLSN[docID]
-			if !exists || rec.LSN > existingLSN {
-				recordLSN[docID] = rec.LSN
-				// Make a copy of the record
-				recCopy := *rec
-				recCopy.Payload = make([]byte, len(rec.Payload))
-				copy(recCopy.Payload, rec.Payload)
-
-				if rec.Type == RecordTypeDelete {
-					// Latest operation is DELETE - track as tombstone
-					tombstones[docID] = &recCopy
-					delete(records, docID)
-				} else {
-					// Latest operation is INSERT/UPDATE - track as live record
-					records[docID] = &recCopy
-					delete(tombstones, docID)
-				}
-			}
-		}
-
-		if err := iter.Err(); err != nil {
-			_ = iter.Close()
-			return nil, nil, fmt.Errorf("error reading segment %s: %w", seg.Filename, err)
-		}
-		_ = iter.Close()
-	}
+	// Delete old segment files
+	removeSegmentFiles(segments)
 
-	return records, tombstones, nil
+	run.SegmentID = newSegmentID
+	run.Records = merged.Records
+	return nil
 }
 
 // CompactOnce performs a single compaction without starting the background loop
@@ -418,6 +386,8 @@ func (c *Compactor) ForceCompact(ctx context.Context) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	ctx = WithSegmentActor(ctx, ActorCompactor, "forced compaction")
+
 	segments, err := c.manifest.GetSealedWALSegments(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get sealed WAL segments: %w", err)
@@ -427,5 +397,5 @@ func (c *Compactor) ForceCompact(ctx context.Context) error {
 		return nil // Need at least 2 WAL segments
 	}
 
-	return c.compactSegments(ctx, segments)
+	return c.runLocked(ctx, segments, true)
 }
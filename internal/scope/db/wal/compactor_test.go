@@ -2,8 +2,8 @@ package wal
 
 import (
 	"context"
-	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
@@ -61,41 +61,52 @@ func TestCompactorMergesSegments(t *testing.T) {
 		t.Fatalf("expected 2 sealed segments, got %d", len(sealed))
 	}
 
-	// Run compaction (without DB, using manifest-only path)
-	compactor := NewCompactor(manifest, nil, dir, CompactorConfig{
-		MinSegmentsToCompact:     2,
-		MaxSegmentsPerCompaction: 10,
-		TmpDir:                   filepath.Join(dir, ".tmp"),
-	})
-
-	// Create tmp directory
-	_ = os.MkdirAll(filepath.Join(dir, ".tmp"), 0755)
-
 	// Merge records manually (simulating compaction without DB)
-	records, tombstones, err := compactor.mergeRecords(sealed)
+	latest, err := latestLSNs(sealed)
+	if err != nil {
+		t.Fatalf("failed to scan segments: %v", err)
+	}
+
+	outPath := filepath.Join(dir, CompactedSegmentFilename(3))
+	out, err := NewSegmentWriter(outPath)
+	if err != nil {
+		t.Fatalf("failed to create output segment: %v", err)
+	}
+	stats, err := writeMerged(sealed, latest, out)
 	if err != nil {
 		t.Fatalf("failed to merge records: %v", err)
 	}
+	_, _ = out.Finalize()
+	_ = out.Close()
 
 	// Verify merge results:
 	// - doc-1 should have updated metadata (v=2)
 	// - doc-2 should be tombstoned
-	if len(records) != 1 {
-		t.Errorf("expected 1 record after merge, got %d", len(records))
+	// - output is in LSN order
+	if stats.Records != 2 || stats.MinLSN != 3 || stats.MaxLSN != 4 {
+		t.Errorf("expected 2 records over LSN 3-4, got %+v", stats)
 	}
 
-	if _, ok := tombstones["doc-2"]; !ok {
-		t.Error("doc-2 should be tombstoned")
+	iter, err := NewSegmentIterator(outPath)
+	if err != nil {
+		t.Fatalf("failed to open output segment: %v", err)
 	}
+	defer func() { _ = iter.Close() }()
 
-	doc1Rec, ok := records["doc-1"]
-	if !ok {
-		t.Fatal("doc-1 should exist in merged records")
+	var merged []*Record
+	for iter.Next() {
+		merged = append(merged, iter.Record())
+	}
+	if len(merged) != 2 {
+		t.Fatalf("expected 2 merged records, got %d", len(merged))
 	}
 
-	// Verify doc-1 has the updated version (LSN 3)
-	if doc1Rec.LSN != 3 {
-		t.Errorf("expected doc-1 to have LSN 3, got %d", doc1Rec.LSN)
+	doc1Rec, tombstone := merged[0], merged[1]
+	if doc1Rec.LSN != 3 || doc1Rec.Type != RecordTypeUpdate {
+		t.Errorf("expected doc-1 update at LSN 3, got %s at %d", doc1Rec.Type, doc1Rec.LSN)
+	}
+	if tombstone.Type != RecordTypeDelete {
+		t.Error("doc-2 should be tombstoned")
 	}
 
 	// Decode and verify metadata
@@ -278,11 +289,12 @@ func newTestMemIndex() *testMemIndex {
 	}
 }
 
-func (m *testMemIndex) SetRecovered(doc RecoveredDoc) {
+func (m *testMemIndex) SetRecovered(doc *RecoveredDoc) {
 	if _, exists := m.docs[doc.DocID]; !exists {
 		m.count++
 	}
-	m.docs[doc.DocID] = &doc
+	d := *doc
+	m.docs[doc.DocID] = &d
 }
 
 func (m *testMemIndex) Delete(id string) {
@@ -323,3 +335,71 @@ func mustEncodeDeletePayload(t *testing.T, docID string) []byte {
 	}
 	return payload
 }
+
+// brokenManifest panics on every call
+type brokenManifest struct{ ManifestStore }
+
+// recordingSupervisor runs loops once, recording their names and panics
+type recordingSupervisor struct {
+	mu        sync.Mutex
+	names     []string
+	recovered []any
+}
+
+func (s *recordingSupervisor) Go(ctx context.Context, name string, loop func(ctx context.Context) error) <-chan struct{} {
+	s.mu.Lock()
+	s.names = append(s.names, name)
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer func() {
+			if r := recover(); r != nil {
+				s.mu.Lock()
+				s.recovered = append(s.recovered, r)
+				s.mu.Unlock()
+			}
+		}()
+		_ = loop(ctx)
+	}()
+	return done
+}
+
+func TestCompactorSupervised(t *testing.T) {
+	sup := &recordingSupervisor{}
+	config := DefaultCompactorConfig()
+	config.CompactionInterval = time.Millisecond
+	config.Supervisor = sup
+	c := NewCompactor(brokenManifest{}, nil, t.TempDir(), config)
+
+	if err := c.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		sup.mu.Lock()
+		n := len(sup.recovered)
+		sup.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	c.Stop() // Returns although the loop died
+
+	sup.mu.Lock()
+	defer sup.mu.Unlock()
+	if len(sup.names) != 1 || sup.names[0] != "compactor" {
+		t.Errorf("supervised loops = %v, want [compactor]", sup.names)
+	}
+	if len(sup.recovered) != 1 {
+		t.Fatal("the run's panic did not reach the supervisor")
+	}
+
+	// The panicking run released the compactor's lock
+	if !c.mu.TryLock() {
+		t.Fatal("compactor still locked after a panicking run")
+	}
+	c.mu.Unlock()
+}
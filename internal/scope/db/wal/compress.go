@@ -0,0 +1,83 @@
+package wal
+
+import (
+	"fmt"
+	"hash/crc32"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is how record payloads are compressed on disk
+type Compression string
+
+// Compression values
+const (
+	CompressionNone Compression = "none"
+	CompressionZstd Compression = "zstd"
+)
+
+// MinCompressSize is the smallest payload worth compressing; smaller ones,
+// like tombstones, are written as-is
+const MinCompressSize = 256
+
+// codecZstd is the first byte of a zstd-compressed payload, so records
+// written with other codecs can be told apart
+const codecZstd byte = 0x01
+
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault), zstd.WithEncoderConcurrency(1))
+	zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(MaxPayloadSize), zstd.WithDecoderConcurrency(0))
+)
+
+// ParseCompression reads a compression name; empty means none
+func ParseCompression(s string) (Compression, error) {
+	switch Compression(s) {
+	case "":
+		return CompressionNone, nil
+	case CompressionNone, CompressionZstd:
+		return Compression(s), nil
+	}
+	return "", fmt.Errorf("unknown compression %q (want none or zstd)", s)
+}
+
+// compress replaces the payload with its compressed form and sets
+// FlagCompressed, updating the length and both CRCs. Payloads below
+// MinCompressSize, and ones compression doesn't shrink, are left alone.
+func (r *Record) compress(c Compression) {
+	if c != CompressionZstd || len(r.Payload) < MinCompressSize || r.Flags&FlagCompressed != 0 {
+		return
+	}
+	out := make([]byte, 1, len(r.Payload))
+	out[0] = codecZstd
+	out = zstdEncoder.EncodeAll(r.Payload, out)
+	if len(out) >= len(r.Payload) {
+		return
+	}
+	r.setPayload(out, r.Flags|FlagCompressed)
+}
+
+// decompress restores a compressed payload and clears FlagCompressed, so
+// the record reads as if it had been written uncompressed
+func (r *Record) decompress() error {
+	if r.Flags&FlagCompressed == 0 {
+		return nil
+	}
+	if len(r.Payload) == 0 || r.Payload[0] != codecZstd {
+		return fmt.Errorf("unknown payload codec at LSN %d", r.LSN)
+	}
+	out, err := zstdDecoder.DecodeAll(r.Payload[1:], nil)
+	if err != nil {
+		return fmt.Errorf("failed to decompress payload at LSN %d: %w", r.LSN, err)
+	}
+	r.setPayload(out, r.Flags&^FlagCompressed)
+	return nil
+}
+
+// setPayload swaps in payload and flags, updating the length and CRCs
+func (r *Record) setPayload(payload []byte, flags RecordFlags) {
+	r.Payload = payload
+	r.PayloadLen = uint32(len(payload))
+	r.PayloadCRC = crc32.ChecksumIEEE(payload)
+	r.Flags = flags
+	r.HeaderCRC = r.calculateHeaderCRC()
+}
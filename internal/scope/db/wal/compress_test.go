@@ -0,0 +1,124 @@
+package wal
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dsjohal14/selfstack/internal/relay"
+)
+
+func TestParseCompression(t *testing.T) {
+	for in, want := range map[string]Compression{"": CompressionNone, "none": CompressionNone, "zstd": CompressionZstd} {
+		if got, err := ParseCompression(in); err != nil || got != want {
+			t.Errorf("ParseCompression(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseCompression("lz4"); err == nil {
+		t.Error("expected an unknown compression to fail")
+	}
+}
+
+func TestRecordCompressRoundTrip(t *testing.T) {
+	payload := []byte(strings.Repeat("quarterly planning notes ", 200))
+	rec, err := NewRecord(RecordTypeInsert, 7, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.SetTimestamp(42)
+	rec.compress(CompressionZstd)
+	if rec.Flags&FlagCompressed == 0 || len(rec.Payload) >= len(payload) {
+		t.Fatalf("expected the payload to shrink, got %d of %d bytes", len(rec.Payload), len(payload))
+	}
+
+	decoded, err := DecodeRecord(rec.Encode())
+	if err != nil {
+		t.Fatalf("DecodeRecord failed: %v", err)
+	}
+	if decoded.Flags&FlagCompressed != 0 || !bytes.Equal(decoded.Payload, payload) {
+		t.Error("expected the decoded record to hold the original payload")
+	}
+	if err := decoded.VerifyChecksums(); err != nil {
+		t.Errorf("decompressed record has stale checksums: %v", err)
+	}
+	if ts, ok := decoded.TimestampHLC(); !ok || ts != 42 {
+		t.Errorf("timestamp = %v, %v; want 42", ts, ok)
+	}
+
+	// Small payloads aren't worth it
+	small, _ := NewRecord(RecordTypeDelete, 8, []byte("doc-1"))
+	small.compress(CompressionZstd)
+	if small.Flags&FlagCompressed != 0 {
+		t.Error("expected a small payload to be left alone")
+	}
+}
+
+func TestWriterCompressesPayloads(t *testing.T) {
+	text := strings.Repeat("the same paragraph, over and over. ", 300)
+	payload := mustEncodeDocPayload(t, "doc-1", DocMetadata{Title: "Big", Text: text}, relay.DeterministicEmbed(text))
+
+	sizes := map[Compression]int64{}
+	for _, c := range []Compression{CompressionNone, CompressionZstd} {
+		dir := t.TempDir()
+		w, err := NewWALWriter(dir, WithCompression(c))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Append(RecordTypeInsert, payload); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.AppendAtomic([]RecordRequest{{Type: RecordTypeInsert, Payload: payload}, {Type: RecordTypeDelete, Payload: []byte("doc-1")}}, true); err != nil {
+			t.Fatal(err)
+		}
+		_ = w.Close()
+
+		path := filepath.Join(dir, SegmentFilename(1))
+		records, err := ReadAllRecords(path)
+		if err != nil {
+			t.Fatalf("%s: failed to read records: %v", c, err)
+		}
+		if len(records) != 3 || !bytes.Equal(records[0].Payload, payload) || !bytes.Equal(records[1].Payload, payload) || string(records[2].Payload) != "doc-1" {
+			t.Fatalf("%s: records don't round trip", c)
+		}
+		if !records[1].InBatch() || records[2].InBatch() {
+			t.Errorf("%s: batch flags lost", c)
+		}
+		info, _ := os.Stat(path)
+		sizes[c] = info.Size()
+	}
+	if sizes[CompressionZstd]*2 > sizes[CompressionNone] {
+		t.Errorf("compressed segment is %d bytes, uncompressed %d", sizes[CompressionZstd], sizes[CompressionNone])
+	}
+}
+
+func TestSegmentWriterCompresses(t *testing.T) {
+	payload := []byte(strings.Repeat("compacted ", 500))
+	rec, _ := NewRecord(RecordTypeInsert, 1, payload)
+
+	path := filepath.Join(t.TempDir(), CompactedSegmentFilename(1))
+	sw, err := NewSegmentWriter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sw.SetCompression(CompressionZstd)
+	if err := sw.Write(rec); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sw.Finalize(); err != nil {
+		t.Fatal(err)
+	}
+	_ = sw.Close()
+
+	if rec.Flags&FlagCompressed != 0 || !bytes.Equal(rec.Payload, payload) {
+		t.Error("Write changed the caller's record")
+	}
+	if sw.Offset() >= int64(len(payload)) {
+		t.Errorf("segment is %d bytes for a %d byte payload", sw.Offset(), len(payload))
+	}
+	records, err := ReadAllRecords(path)
+	if err != nil || len(records) != 1 || !bytes.Equal(records[0].Payload, payload) {
+		t.Fatalf("compacted record doesn't round trip: %v", err)
+	}
+}
@@ -0,0 +1,198 @@
+package wal
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// DeleteInfo records when and by whom a document was deleted
+type DeleteInfo struct {
+	DeletedAt time.Time // Zero for tombstones written before it was recorded
+	DeletedBy string    // Empty when the delete wasn't attributed
+}
+
+type deletedByKey struct{}
+
+// WithDeletedBy attributes deletes made with the returned context to who
+func WithDeletedBy(ctx context.Context, who string) context.Context {
+	return context.WithValue(ctx, deletedByKey{}, who)
+}
+
+// DeletedByFromContext returns who WithDeletedBy attached to ctx
+func DeletedByFromContext(ctx context.Context) string {
+	who, _ := ctx.Value(deletedByKey{}).(string)
+	return who
+}
+
+// DeletedDoc is a document whose latest record in the WAL is a tombstone
+type DeletedDoc struct {
+	DocID string
+	LSN   uint64 // Of the tombstone
+	Info  DeleteInfo
+
+	// Previous is the last version before the delete, or nil once
+	// compaction has dropped it
+	Previous *RecoveredDoc
+}
+
+// ScanDeleted lists the documents in dir's segments whose latest record is
+// a tombstone deleted at or after since (tombstones without a time are only
+// listed when since is zero), newest first. Deletes stay listed until
+// compaction drops their tombstone or the document is written again.
+func ScanDeleted(dir string, since time.Time) ([]DeletedDoc, error) {
+	segments, err := ListSegmentFiles(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list segment files: %w", err)
+	}
+
+	// Pass 1: the latest record of every document
+	type latestRecord struct {
+		lsn     uint64
+		deleted bool
+		info    DeleteInfo
+	}
+	latest := make(map[string]latestRecord)
+	err = scanSegments(segments, func(rec *Record) error {
+		if !isDocRecord(rec.Type) {
+			return nil
+		}
+		id, err := payloadDocID(rec.Payload)
+		if err != nil {
+			return err
+		}
+		if prev, ok := latest[string(id)]; ok && prev.lsn >= rec.LSN {
+			return nil
+		}
+		l := latestRecord{lsn: rec.LSN, deleted: rec.Type == RecordTypeDelete}
+		if l.deleted {
+			if l.info, err = DecodeDeleteInfo(rec.Payload); err != nil {
+				return err
+			}
+		}
+		latest[string(id)] = l
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	deleted := make(map[string]*DeletedDoc)
+	for id, l := range latest {
+		if !l.deleted || (!since.IsZero() && l.info.DeletedAt.Before(since)) {
+			continue
+		}
+		deleted[id] = &DeletedDoc{DocID: id, LSN: l.lsn, Info: l.info}
+	}
+	if len(deleted) == 0 {
+		return nil, nil
+	}
+
+	// Pass 2: the last version of each deleted document
+	previousLSN := make(map[string]uint64)
+	err = scanSegments(segments, func(rec *Record) error {
+		if rec.Type != RecordTypeInsert && rec.Type != RecordTypeUpdate {
+			return nil
+		}
+		id, err := payloadDocID(rec.Payload)
+		if err != nil {
+			return err
+		}
+		d, ok := deleted[string(id)]
+		if !ok || rec.LSN > d.LSN || rec.LSN <= previousLSN[d.DocID] {
+			return nil
+		}
+		var doc RecoveredDoc
+		if err := decodeDocPayloadInto(rec.Payload, &doc); err != nil {
+			return err
+		}
+		d.Previous = &doc
+		previousLSN[d.DocID] = rec.LSN
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]DeletedDoc, 0, len(deleted))
+	for _, d := range deleted {
+		out = append(out, *d)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].LSN > out[j].LSN })
+	return out, nil
+}
+
+// FindDeleted returns docID if its latest record in dir's segments is a
+// tombstone, or nil if it isn't deleted. Only segments whose bloom filter
+// may contain docID are read.
+func FindDeleted(dir, docID string) (*DeletedDoc, error) {
+	segments, err := ListSegmentFiles(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list segment files: %w", err)
+	}
+
+	var latest, previous *Record
+	err = scanSegments(SegmentsMayContain(segments, docID), func(rec *Record) error {
+		if !isDocRecord(rec.Type) {
+			return nil
+		}
+		id, err := payloadDocID(rec.Payload)
+		if err != nil {
+			return err
+		}
+		if string(id) != docID {
+			return nil
+		}
+		if latest == nil || rec.LSN > latest.LSN {
+			latest = rec
+		}
+		if rec.Type != RecordTypeDelete && (previous == nil || rec.LSN > previous.LSN) {
+			previous = rec
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if latest == nil || latest.Type != RecordTypeDelete {
+		return nil, nil
+	}
+
+	d := &DeletedDoc{DocID: docID, LSN: latest.LSN}
+	if d.Info, err = DecodeDeleteInfo(latest.Payload); err != nil {
+		return nil, err
+	}
+	if previous != nil {
+		var doc RecoveredDoc
+		if err := decodeDocPayloadInto(previous.Payload, &doc); err != nil {
+			return nil, err
+		}
+		d.Previous = &doc
+	}
+	return d, nil
+}
+
+// scanSegments calls fn for every readable record. Segments removed by a
+// concurrent compaction are skipped, and reading a segment stops at a torn
+// tail the same way recovery does.
+func scanSegments(segments []string, fn func(rec *Record) error) error {
+	for _, path := range segments {
+		iter, err := NewSegmentIterator(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return fmt.Errorf("failed to open segment %s: %w", path, err)
+		}
+		for iter.Next() {
+			if err := fn(iter.Record()); err != nil {
+				_ = iter.Close()
+				return fmt.Errorf("failed to read record %d in %s: %w", iter.Record().LSN, path, err)
+			}
+		}
+		_ = iter.Close()
+	}
+	return nil
+}
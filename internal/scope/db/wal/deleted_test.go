@@ -0,0 +1,69 @@
+package wal
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/relay"
+)
+
+func TestScanDeleted(t *testing.T) {
+	dir := t.TempDir()
+	early := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	late := early.Add(48 * time.Hour)
+
+	deletePayload := func(id string, info DeleteInfo) []byte {
+		p, err := EncodeDeletePayloadWithInfo(id, info)
+		if err != nil {
+			t.Fatalf("failed to encode delete payload: %v", err)
+		}
+		return p
+	}
+	legacy, _ := EncodeDeletePayload("legacy")
+
+	records := []struct {
+		typ     RecordType
+		payload []byte
+	}{
+		{RecordTypeInsert, mustEncodeDocPayload(t, "a", DocMetadata{Title: "A v1"}, relay.Embedding{})},
+		{RecordTypeUpdate, mustEncodeDocPayload(t, "a", DocMetadata{Title: "A v2"}, relay.Embedding{})},
+		{RecordTypeDelete, deletePayload("a", DeleteInfo{DeletedAt: late, DeletedBy: "alice"})},
+		{RecordTypeInsert, mustEncodeDocPayload(t, "b", DocMetadata{Title: "B"}, relay.Embedding{})},
+		{RecordTypeDelete, deletePayload("b", DeleteInfo{DeletedAt: early})},
+		{RecordTypeInsert, mustEncodeDocPayload(t, "b", DocMetadata{Title: "B again"}, relay.Embedding{})}, // Re-created
+		{RecordTypeDelete, deletePayload("c", DeleteInfo{DeletedAt: early})},                               // Insert compacted away
+		{RecordTypeDelete, legacy},
+	}
+
+	writer, err := NewSegmentWriter(filepath.Join(dir, SegmentFilename(1)))
+	if err != nil {
+		t.Fatalf("failed to create segment writer: %v", err)
+	}
+	for i, r := range records {
+		rec, _ := NewRecord(r.typ, uint64(i+1), r.payload)
+		_ = writer.Write(rec)
+	}
+	_, _ = writer.Finalize()
+	_ = writer.Close()
+
+	all, err := ScanDeleted(dir, time.Time{})
+	if err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+	if len(all) != 3 || all[0].DocID != "legacy" || all[1].DocID != "c" || all[2].DocID != "a" {
+		t.Fatalf("expected legacy, c, a newest first, got %+v", all)
+	}
+	a := all[2]
+	if a.Info.DeletedBy != "alice" || a.Previous == nil || a.Previous.Title != "A v2" {
+		t.Errorf("expected a's last version and deleter, got %+v", a)
+	}
+	if all[1].Previous != nil {
+		t.Error("c has no version left and should not be restorable")
+	}
+
+	recent, _ := ScanDeleted(dir, early.Add(time.Hour))
+	if len(recent) != 1 || recent[0].DocID != "a" {
+		t.Errorf("expected only a since the cutoff, got %+v", recent)
+	}
+}
@@ -0,0 +1,174 @@
+package wal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LockFileName is the lock file in a locked WAL directory
+const LockFileName = "LOCK"
+
+// LockStrategy selects how a WAL directory is locked so a second process
+// can't write to it at the same time
+type LockStrategy string
+
+const (
+	// LockAuto uses flock on local filesystems and an exclusive lock file
+	// on network ones
+	LockAuto LockStrategy = "auto"
+	// LockFlock takes an flock on the lock file, released by the kernel
+	// when the process dies. NFS clients may not enforce it across hosts.
+	LockFlock LockStrategy = "flock"
+	// LockExclusive creates the lock file with O_EXCL, which is atomic on
+	// NFSv3 and later. A lock left by a crash is taken over only by a
+	// process on the same host; otherwise the file must be removed.
+	LockExclusive LockStrategy = "exclusive"
+	// LockNone doesn't lock, for filesystems that support neither
+	LockNone LockStrategy = "none"
+)
+
+// ParseLockStrategy parses a strategy name; empty means LockAuto
+func ParseLockStrategy(s string) (LockStrategy, error) {
+	switch LockStrategy(s) {
+	case "":
+		return LockAuto, nil
+	case LockAuto, LockFlock, LockExclusive, LockNone:
+		return LockStrategy(s), nil
+	}
+	return "", fmt.Errorf("unknown lock strategy %q (want auto, flock, exclusive, or none)", s)
+}
+
+// ErrLocked is returned when another process holds a WAL directory's lock
+var ErrLocked = errors.New("WAL directory is locked by another process")
+
+// errUnsupported is returned by platform calls this OS can't make
+var errUnsupported = errors.New("not supported on this platform")
+
+// heldLocks are the lock files this process created, which a lock file
+// naming its own PID can't otherwise be told apart from
+var heldLocks sync.Map
+
+// DirLock is a held WAL directory lock
+type DirLock struct {
+	path     string
+	file     *os.File // Held open by flock
+	Strategy LockStrategy
+}
+
+// LockDir locks dir against other processes. LockAuto picks flock unless fs
+// is a network filesystem or flock isn't supported here.
+func LockDir(dir string, strategy LockStrategy, fs FSInfo) (*DirLock, error) {
+	path := filepath.Join(dir, LockFileName)
+	if strategy == LockAuto || strategy == "" {
+		strategy = LockFlock
+		if fs.Network {
+			strategy = LockExclusive
+		}
+	}
+
+	switch strategy {
+	case LockNone:
+		return &DirLock{Strategy: LockNone}, nil
+	case LockFlock:
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open lock file: %w", err)
+		}
+		switch err := flock(f); {
+		case errors.Is(err, errUnsupported):
+			_ = f.Close()
+			return LockDir(dir, LockExclusive, fs)
+		case err != nil:
+			_ = f.Close()
+			return nil, fmt.Errorf("%w: flock on %s: %v", ErrLocked, path, err)
+		}
+		return &DirLock{path: path, file: f, Strategy: LockFlock}, nil
+	case LockExclusive:
+		if err := createLockFile(path); err != nil {
+			return nil, err
+		}
+		return &DirLock{path: path, Strategy: LockExclusive}, nil
+	}
+	return nil, fmt.Errorf("unknown lock strategy %q", strategy)
+}
+
+// createLockFile creates an exclusive lock file naming this process. A lock
+// file left by a dead process on this host is replaced.
+func createLockFile(path string) error {
+	host, _ := os.Hostname()
+	owner := fmt.Sprintf("%s %d %s\n", host, os.Getpid(), time.Now().UTC().Format(time.RFC3339))
+
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			_, werr := f.WriteString(owner)
+			serr := f.Sync()
+			cerr := f.Close()
+			if err := errors.Join(werr, serr, cerr); err != nil {
+				_ = os.Remove(path)
+				return fmt.Errorf("failed to write lock file: %w", err)
+			}
+			heldLocks.Store(path, true)
+			return nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("failed to create lock file: %w", err)
+		}
+
+		data, _ := os.ReadFile(path)
+		fields := strings.Fields(string(data))
+		if len(fields) < 2 {
+			return fmt.Errorf("%w: %s exists; remove it if no process uses the directory", ErrLocked, path)
+		}
+		pid, _ := strconv.Atoi(fields[1])
+		// A container restarted on the same host name often gets the same
+		// PID as its previous run, which can't hold the lock anymore
+		_, held := heldLocks.Load(path)
+		stale := fields[0] == host && !held && (pid == os.Getpid() || !processAlive(pid))
+		if !stale {
+			return fmt.Errorf("%w: %s held by %s (pid %s); remove it if that process is gone", ErrLocked, path, fields[0], fields[1])
+		}
+		fmt.Printf("taking over stale WAL lock %s from pid %d\n", path, pid)
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove stale lock file: %w", err)
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrLocked, path)
+}
+
+// Unlock releases the lock
+func (l *DirLock) Unlock() error {
+	switch l.Strategy {
+	case LockFlock:
+		return l.file.Close()
+	case LockExclusive:
+		heldLocks.Delete(l.path)
+		if err := os.Remove(l.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove lock file: %w", err)
+		}
+	}
+	return nil
+}
+
+// FSInfo describes the filesystem a directory is on
+type FSInfo struct {
+	Type    string // e.g. ext4, nfs, fuse; "unknown" where undetectable
+	Network bool   // Shared over the network: locks and fsyncs need care
+	Unsafe  bool   // Known to break fsync, rename, or lock semantics
+}
+
+// CheckFilesystem refuses filesystems known to lose WAL writes, unless
+// allowUnsafe overrides it
+func CheckFilesystem(fs FSInfo, dir string, allowUnsafe bool) error {
+	if fs.Unsafe && !allowUnsafe {
+		return fmt.Errorf("%s is on a %s filesystem, which doesn't guarantee fsync, rename, or lock semantics the WAL relies on; "+
+			"use a local or NFS volume, or set WAL_ALLOW_UNSAFE_FS=true to accept the risk", dir, fs.Type)
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package wal
+
+import "os"
+
+func flock(*os.File) error {
+	return errUnsupported
+}
+
+// processAlive can't check other processes here, so a lock file is only
+// taken over by a process with the PID that wrote it
+func processAlive(int) bool {
+	return true
+}
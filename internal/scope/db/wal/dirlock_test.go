@@ -0,0 +1,93 @@
+package wal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestLockDirFlock(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("flock is unix only")
+	}
+	dir := t.TempDir()
+	lock, err := LockDir(dir, LockAuto, FSInfo{Type: "ext4"})
+	if err != nil {
+		t.Fatalf("LockDir failed: %v", err)
+	}
+	if lock.Strategy != LockFlock {
+		t.Errorf("auto on a local filesystem = %s, want flock", lock.Strategy)
+	}
+	if _, err := LockDir(dir, LockFlock, FSInfo{}); !errors.Is(err, ErrLocked) {
+		t.Errorf("second lock = %v, want ErrLocked", err)
+	}
+	if err := lock.Unlock(); err != nil {
+		t.Fatalf("Unlock failed: %v", err)
+	}
+	relock, err := LockDir(dir, LockFlock, FSInfo{})
+	if err != nil {
+		t.Fatalf("lock after unlock failed: %v", err)
+	}
+	_ = relock.Unlock()
+}
+
+func TestLockDirExclusive(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, LockFileName)
+
+	// Network filesystems get a lock file
+	lock, err := LockDir(dir, LockAuto, FSInfo{Type: "nfs", Network: true})
+	if err != nil {
+		t.Fatalf("LockDir failed: %v", err)
+	}
+	if lock.Strategy != LockExclusive {
+		t.Errorf("auto on NFS = %s, want exclusive", lock.Strategy)
+	}
+	if _, err := LockDir(dir, LockExclusive, FSInfo{}); !errors.Is(err, ErrLocked) {
+		t.Errorf("second lock = %v, want ErrLocked", err)
+	}
+	if err := lock.Unlock(); err != nil {
+		t.Fatalf("Unlock failed: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("lock file left after unlock: %v", err)
+	}
+
+	// Another host's lock is never taken over
+	if err := os.WriteFile(path, []byte("other-host 1 2026-01-01T00:00:00Z\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LockDir(dir, LockExclusive, FSInfo{}); !errors.Is(err, ErrLocked) {
+		t.Errorf("lock held by another host = %v, want ErrLocked", err)
+	}
+
+	// A lock left by an earlier run with this PID on this host is stale
+	host, _ := os.Hostname()
+	if err := os.WriteFile(path, []byte(fmt.Sprintf("%s %d 2026-01-01T00:00:00Z\n", host, os.Getpid())), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	lock, err = LockDir(dir, LockExclusive, FSInfo{})
+	if err != nil {
+		t.Fatalf("stale lock was not taken over: %v", err)
+	}
+	_ = lock.Unlock()
+}
+
+func TestCheckFilesystem(t *testing.T) {
+	fuse := FSInfo{Type: "fuse", Unsafe: true}
+	if err := CheckFilesystem(fuse, "/data", false); err == nil {
+		t.Error("expected FUSE to be refused")
+	}
+	if err := CheckFilesystem(fuse, "/data", true); err != nil {
+		t.Errorf("override ignored: %v", err)
+	}
+	if err := CheckFilesystem(FSInfo{Type: "nfs", Network: true}, "/data", false); err != nil {
+		t.Errorf("NFS refused: %v", err)
+	}
+	if _, err := ParseLockStrategy("fcntl"); err == nil {
+		t.Error("expected an unknown strategy to fail")
+	}
+}
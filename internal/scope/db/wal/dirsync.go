@@ -0,0 +1,17 @@
+package wal
+
+import "fmt"
+
+// syncDirFunc fsyncs a directory; tests replace it to record or fail syncs
+var syncDirFunc = fsyncDir
+
+// syncDir fsyncs a directory so that new entries, renames, and removals in
+// it survive a crash. Creating or renaming a file only changes the
+// directory, and on ext4, xfs, and NFS that change isn't durable until the
+// directory itself is synced.
+func syncDir(dir string) error {
+	if err := syncDirFunc(dir); err != nil {
+		return fmt.Errorf("failed to sync directory %s: %w", dir, err)
+	}
+	return nil
+}
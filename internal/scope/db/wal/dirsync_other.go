@@ -0,0 +1,9 @@
+//go:build !unix
+
+package wal
+
+// fsyncDir does nothing: Windows can't open a directory for syncing, and
+// NTFS journals directory changes itself
+func fsyncDir(string) error {
+	return nil
+}
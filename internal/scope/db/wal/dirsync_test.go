@@ -0,0 +1,185 @@
+package wal
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/dsjohal14/selfstack/internal/relay"
+)
+
+// faultFS replaces directory syncs for a test, recording each one and
+// failing those for which fail returns an error
+type faultFS struct {
+	mu    sync.Mutex
+	syncs []string
+	fail  func(dir string) error
+}
+
+func injectDirSyncs(t *testing.T) *faultFS {
+	t.Helper()
+	fs := &faultFS{}
+	prev := syncDirFunc
+	syncDirFunc = func(dir string) error {
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		fs.syncs = append(fs.syncs, dir)
+		if fs.fail != nil {
+			return fs.fail(dir)
+		}
+		return nil
+	}
+	t.Cleanup(func() { syncDirFunc = prev })
+	return fs
+}
+
+// count returns how many times dir was synced
+func (fs *faultFS) count(dir string) int {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	n := 0
+	for _, d := range fs.syncs {
+		if d == dir {
+			n++
+		}
+	}
+	return n
+}
+
+func TestWriterSyncsDirOnSegmentCreate(t *testing.T) {
+	fs := injectDirSyncs(t)
+	dir := t.TempDir()
+
+	w, err := NewWALWriter(dir, WithMaxSegmentSize(1))
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+	defer func() { _ = w.Close() }()
+	if got := fs.count(dir); got != 1 {
+		t.Fatalf("syncs after creating the first segment = %d, want 1", got)
+	}
+
+	// Each append fills the segment, so it rotates: one sync for the bloom
+	// filter's rename and one for the new segment
+	if _, err := w.Append(RecordTypeInsert, mustEncodeDocPayload(t, "doc-1", DocMetadata{}, relay.Embedding{})); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	if got := fs.count(dir); got != 3 {
+		t.Errorf("syncs after a rotation = %d, want 3", got)
+	}
+
+	// Reopening an existing segment changes nothing in the directory
+	_ = w.Close()
+	before := fs.count(dir)
+	w, err = NewWALWriter(dir, WithInitialSegmentID(2))
+	if err != nil {
+		t.Fatalf("failed to reopen writer: %v", err)
+	}
+	if got := fs.count(dir); got != before {
+		t.Errorf("reopening an existing segment synced the directory %d times", got-before)
+	}
+}
+
+func TestWriterFailsWhenDirSyncFails(t *testing.T) {
+	fs := injectDirSyncs(t)
+	fs.fail = func(string) error { return errors.New("injected EIO") }
+
+	if _, err := NewWALWriter(t.TempDir()); err == nil {
+		t.Fatal("expected creating a segment to fail when the directory can't be synced")
+	}
+
+	// Opting out skips the sync
+	w, err := NewWALWriter(t.TempDir(), WithDirSync(false))
+	if err != nil {
+		t.Fatalf("writer without directory syncs failed: %v", err)
+	}
+	_ = w.Close()
+}
+
+func TestWriteSegmentBloomSyncsDir(t *testing.T) {
+	fs := injectDirSyncs(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, SegmentFilename(1))
+	filter := BloomFromIDs(map[string]uint64{"doc-1": 1})
+
+	if err := WriteSegmentBloom(path, filter); err != nil {
+		t.Fatalf("WriteSegmentBloom failed: %v", err)
+	}
+	if got := fs.count(dir); got != 1 {
+		t.Errorf("syncs = %d, want 1", got)
+	}
+
+	fs.fail = func(string) error { return errors.New("injected EIO") }
+	if err := WriteSegmentBloom(path, filter); err == nil {
+		t.Error("expected a failed directory sync to be returned")
+	}
+}
+
+func TestCleanupOldSegmentsSyncsDir(t *testing.T) {
+	fs := injectDirSyncs(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	manifest := NewInMemoryManifest()
+
+	for id := uint64(1); id <= 3; id++ {
+		path := filepath.Join(dir, SegmentFilename(id))
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		_ = manifest.CreateSegment(ctx, id, path)
+		_ = manifest.SealSegment(ctx, id, "")
+	}
+	_ = manifest.ArchiveSegments(ctx, []uint64{1, 2, 3})
+
+	roller := NewSegmentRoller(dir, manifest, WithMaxSegments(1))
+	deleted, err := roller.CleanupOldSegments(ctx)
+	if err != nil {
+		t.Fatalf("cleanup failed: %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("deleted = %d, want 2", deleted)
+	}
+	if got := fs.count(dir); got != 1 {
+		t.Errorf("syncs = %d, want 1", got)
+	}
+
+	fs.fail = func(string) error { return errors.New("injected EIO") }
+	_ = manifest.CreateSegment(ctx, 4, filepath.Join(dir, SegmentFilename(4)))
+	_ = manifest.SealSegment(ctx, 4, "")
+	_ = manifest.ArchiveSegments(ctx, []uint64{4})
+	if _, err := roller.CleanupOldSegments(ctx); err == nil {
+		t.Error("expected a failed directory sync to be returned")
+	}
+}
+
+func TestRemoveSegmentFilesSyncsEachDir(t *testing.T) {
+	fs := injectDirSyncs(t)
+	dirA, dirB := t.TempDir(), t.TempDir()
+	var segments []SegmentInfo
+	for i, dir := range []string{dirA, dirA, dirB} {
+		path := filepath.Join(dir, SegmentFilename(uint64(i+1)))
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		segments = append(segments, SegmentInfo{SegmentID: uint64(i + 1), Filename: path})
+	}
+
+	removeSegmentFiles(segments)
+	for _, seg := range segments {
+		if _, err := os.Stat(seg.Filename); !os.IsNotExist(err) {
+			t.Errorf("%s not removed", seg.Filename)
+		}
+	}
+	if fs.count(dirA) != 1 || fs.count(dirB) != 1 {
+		t.Errorf("syncs = %v, want one per directory", fs.syncs)
+	}
+}
+
+func TestFsyncDir(t *testing.T) {
+	if err := syncDir(t.TempDir()); err != nil {
+		t.Errorf("syncDir failed: %v", err)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build unix
+
+package wal
+
+import "os"
+
+// fsyncDir opens dir and fsyncs it
+func fsyncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = d.Close() }()
+	return d.Sync()
+}
@@ -0,0 +1,98 @@
+package wal
+
+import (
+	"context"
+	"time"
+)
+
+// SegmentActor identifies which component caused a segment status transition
+type SegmentActor string
+
+// Segment actor values
+const (
+	ActorWriter    SegmentActor = "writer"
+	ActorCompactor SegmentActor = "compactor"
+	ActorAdmin     SegmentActor = "admin"
+	ActorRecovery  SegmentActor = "recovery"
+	ActorSystem    SegmentActor = "system" // Used when the caller didn't say
+)
+
+// SegmentEvent is one entry in the segment lifecycle audit trail
+type SegmentEvent struct {
+	ID          int64         `json:"id"`
+	SegmentID   uint64        `json:"segment_id"`
+	SegmentType SegmentType   `json:"segment_type"`
+	FromStatus  SegmentStatus `json:"from_status,omitempty"` // Empty when the segment was created
+	ToStatus    SegmentStatus `json:"to_status"`
+	Actor       SegmentActor  `json:"actor"`
+	Reason      string        `json:"reason,omitempty"`
+	CreatedAt   time.Time     `json:"created_at"`
+}
+
+// SegmentEventFilter narrows an audit trail query
+type SegmentEventFilter struct {
+	SegmentID   *uint64     // Only events for this segment
+	SegmentType SegmentType // Only events for this segment type (empty = all)
+	Since       time.Time   // Only events at or after this time
+	Limit       int         // Max events returned, newest first (0 = 100)
+}
+
+// DefaultSegmentEventLimit caps audit trail queries without an explicit limit
+const DefaultSegmentEventLimit = 100
+
+type segmentActorKey struct{}
+
+type segmentActorValue struct {
+	actor  SegmentActor
+	reason string
+}
+
+// WithSegmentActor attaches the actor and reason recorded for any segment
+// status transitions made with the returned context
+func WithSegmentActor(ctx context.Context, actor SegmentActor, reason string) context.Context {
+	return context.WithValue(ctx, segmentActorKey{}, segmentActorValue{actor: actor, reason: reason})
+}
+
+// segmentActorFromContext returns the actor and reason attached to ctx
+func segmentActorFromContext(ctx context.Context) (SegmentActor, string) {
+	if v, ok := ctx.Value(segmentActorKey{}).(segmentActorValue); ok {
+		return v.actor, v.reason
+	}
+	return ActorSystem, ""
+}
+
+// newSegmentEvent builds an event using the actor and reason attached to ctx
+func newSegmentEvent(ctx context.Context, segType SegmentType, segmentID uint64, from, to SegmentStatus) SegmentEvent {
+	actor, reason := segmentActorFromContext(ctx)
+	return SegmentEvent{
+		SegmentID:   segmentID,
+		SegmentType: segType,
+		FromStatus:  from,
+		ToStatus:    to,
+		Actor:       actor,
+		Reason:      reason,
+		CreatedAt:   time.Now(),
+	}
+}
+
+// matches reports whether the event passes the filter
+func (f SegmentEventFilter) matches(ev SegmentEvent) bool {
+	if f.SegmentID != nil && ev.SegmentID != *f.SegmentID {
+		return false
+	}
+	if f.SegmentType != "" && ev.SegmentType != f.SegmentType {
+		return false
+	}
+	if !f.Since.IsZero() && ev.CreatedAt.Before(f.Since) {
+		return false
+	}
+	return true
+}
+
+// limit returns the effective result limit
+func (f SegmentEventFilter) limit() int {
+	if f.Limit <= 0 {
+		return DefaultSegmentEventLimit
+	}
+	return f.Limit
+}
@@ -0,0 +1,184 @@
+package wal
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// Segment Footer Format (48 bytes, after the last record of a sealed segment):
+// ┌─────────────────────────────────────────────────────────────┐
+// │ Magic (4B)  │ Version (1B) │ Reserved (3B)                  │
+// ├─────────────────────────────────────────────────────────────┤
+// │ Records (8B) - number of records in the segment             │
+// ├─────────────────────────────────────────────────────────────┤
+// │ MinLSN (8B)                                                 │
+// ├─────────────────────────────────────────────────────────────┤
+// │ MaxLSN (8B)                                                 │
+// ├─────────────────────────────────────────────────────────────┤
+// │ DataBytes (8B) - size of the records before the footer      │
+// ├─────────────────────────────────────────────────────────────┤
+// │ DataCRC32 (4B) - checksum of those DataBytes                │
+// ├─────────────────────────────────────────────────────────────┤
+// │ FooterCRC32 (4B) - checksum of footer bytes [0:44]          │
+// └─────────────────────────────────────────────────────────────┘
+
+const (
+	// FooterMagic identifies a segment footer ("WALF")
+	FooterMagic uint32 = 0x57414C46
+
+	// FooterSize is the fixed size of a segment footer
+	FooterSize = 48
+
+	footerVersion = 1
+)
+
+// SegmentFooter is written at the end of a segment when it's sealed, so
+// that whether the segment is complete can be checked from the file alone
+type SegmentFooter struct {
+	Records   uint64
+	MinLSN    uint64
+	MaxLSN    uint64
+	DataBytes int64  // Where the footer starts
+	DataCRC   uint32 // Of the bytes before the footer, as CalculateSegmentChecksum
+}
+
+// Encode serializes the footer
+func (f *SegmentFooter) Encode() []byte {
+	buf := make([]byte, FooterSize)
+	binary.LittleEndian.PutUint32(buf[0:4], FooterMagic)
+	buf[4] = footerVersion
+	binary.LittleEndian.PutUint64(buf[8:16], f.Records)
+	binary.LittleEndian.PutUint64(buf[16:24], f.MinLSN)
+	binary.LittleEndian.PutUint64(buf[24:32], f.MaxLSN)
+	binary.LittleEndian.PutUint64(buf[32:40], uint64(f.DataBytes))
+	binary.LittleEndian.PutUint32(buf[40:44], f.DataCRC)
+	binary.LittleEndian.PutUint32(buf[44:48], crc32.ChecksumIEEE(buf[0:44]))
+	return buf
+}
+
+// DecodeSegmentFooter parses a footer, reporting false if buf isn't one
+func DecodeSegmentFooter(buf []byte) (*SegmentFooter, bool) {
+	if len(buf) != FooterSize || binary.LittleEndian.Uint32(buf[0:4]) != FooterMagic || buf[4] != footerVersion {
+		return nil, false
+	}
+	if crc32.ChecksumIEEE(buf[0:44]) != binary.LittleEndian.Uint32(buf[44:48]) {
+		return nil, false
+	}
+	return &SegmentFooter{
+		Records:   binary.LittleEndian.Uint64(buf[8:16]),
+		MinLSN:    binary.LittleEndian.Uint64(buf[16:24]),
+		MaxLSN:    binary.LittleEndian.Uint64(buf[24:32]),
+		DataBytes: int64(binary.LittleEndian.Uint64(buf[32:40])),
+		DataCRC:   binary.LittleEndian.Uint32(buf[40:44]),
+	}, true
+}
+
+// readFooter returns the footer at the end of f, or nil if it has none:
+// the active segment, those sealed before footers were written, and ones
+// whose footer was torn or cut off
+func readFooter(f *os.File) (*SegmentFooter, error) {
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := stat.Size()
+	if size < FooterSize {
+		return nil, nil
+	}
+	buf := make([]byte, FooterSize)
+	if _, err := f.ReadAt(buf, size-FooterSize); err != nil {
+		return nil, fmt.Errorf("failed to read footer: %w", err)
+	}
+	footer, ok := DecodeSegmentFooter(buf)
+	if !ok || footer.DataBytes != size-FooterSize {
+		return nil, nil
+	}
+	return footer, nil
+}
+
+// ReadSegmentFooter returns the footer of the segment at path, or nil if it
+// has none
+func ReadSegmentFooter(path string) (*SegmentFooter, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	return readFooter(f)
+}
+
+var (
+	// ErrNoFooter is returned by VerifySegmentFooter for segments without one
+	ErrNoFooter = errors.New("segment has no footer")
+
+	// ErrFooterMismatch is returned by VerifySegmentFooter for segments
+	// whose data doesn't match their footer
+	ErrFooterMismatch = errors.New("segment doesn't match its footer")
+)
+
+// VerifySegmentFooter checks the segment at path against its footer's
+// checksum, which covers every byte before it, so a segment that verifies
+// is complete. A mismatch means it changed after it was sealed, as by a
+// torn write or bit rot.
+func VerifySegmentFooter(path string) (*SegmentFooter, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	footer, err := readFooter(f)
+	if err != nil {
+		return nil, err
+	}
+	if footer == nil {
+		return nil, ErrNoFooter
+	}
+
+	hash := crc32.NewIEEE()
+	if _, err := io.Copy(hash, io.NewSectionReader(f, 0, footer.DataBytes)); err != nil {
+		return nil, fmt.Errorf("failed to calculate checksum: %w", err)
+	}
+	if sum := hash.Sum32(); sum != footer.DataCRC {
+		return footer, fmt.Errorf("%w: footer has %08x, data is %08x", ErrFooterMismatch, footer.DataCRC, sum)
+	}
+	return footer, nil
+}
+
+// AppendSegmentFooter seals the segment at path with a footer describing
+// its records, and syncs it. A segment that already has one is left as is.
+func AppendSegmentFooter(path string) (*SegmentFooter, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open segment %s: %w", path, err)
+	}
+	defer func() { _ = f.Close() }()
+	if footer, err := readFooter(f); err != nil || footer != nil {
+		return footer, err
+	}
+
+	minLSN, maxLSN, count, err := GetSegmentLSNRange(path)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	hash := crc32.NewIEEE()
+	if _, err := io.Copy(hash, io.NewSectionReader(f, 0, stat.Size())); err != nil {
+		return nil, fmt.Errorf("failed to calculate checksum: %w", err)
+	}
+
+	footer := &SegmentFooter{Records: uint64(count), MinLSN: minLSN, MaxLSN: maxLSN, DataBytes: stat.Size(), DataCRC: hash.Sum32()}
+	if _, err := f.WriteAt(footer.Encode(), stat.Size()); err != nil {
+		return nil, fmt.Errorf("failed to write footer: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return nil, fmt.Errorf("failed to sync footer: %w", err)
+	}
+	return footer, nil
+}
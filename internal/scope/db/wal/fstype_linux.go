@@ -0,0 +1,35 @@
+//go:build linux
+
+package wal
+
+import "syscall"
+
+// Filesystem magic numbers from statfs(2)
+var filesystems = map[uint32]FSInfo{
+	0x6969:     {Type: "nfs", Network: true},
+	0x00c36400: {Type: "ceph", Network: true},
+	0x01161970: {Type: "gfs2", Network: true},
+	0x01021997: {Type: "9p", Network: true},
+	0x517b:     {Type: "smb", Network: true, Unsafe: true},
+	0xff534d42: {Type: "cifs", Network: true, Unsafe: true},
+	0xfe534d42: {Type: "smb2", Network: true, Unsafe: true},
+	0x65735546: {Type: "fuse", Unsafe: true}, // s3fs, gcsfuse, goofys...
+	0xef53:     {Type: "ext4"},
+	0x58465342: {Type: "xfs"},
+	0x9123683e: {Type: "btrfs"},
+	0x01021994: {Type: "tmpfs"},
+	0x794c7630: {Type: "overlay"},
+	0x2fc12fc1: {Type: "zfs"},
+}
+
+// DetectFilesystem reports the filesystem dir is on
+func DetectFilesystem(dir string) (FSInfo, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return FSInfo{Type: "unknown"}, err
+	}
+	if fs, ok := filesystems[uint32(st.Type)]; ok {
+		return fs, nil
+	}
+	return FSInfo{Type: "unknown"}, nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package wal
+
+// DetectFilesystem can't tell filesystems apart on this platform, so every
+// directory is treated as local
+func DetectFilesystem(string) (FSInfo, error) {
+	return FSInfo{Type: "unknown"}, nil
+}
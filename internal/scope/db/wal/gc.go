@@ -0,0 +1,257 @@
+package wal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// A crash during compaction, snapshotting, or a repair can leave files in
+// the WAL directory that nothing refers to. The garbage collector moves
+// them into QuarantineDir, where they can still be moved back, and deletes
+// them once they've been there for the grace period.
+
+// QuarantineDir is the subdirectory of a WAL directory orphaned files are
+// moved into
+const QuarantineDir = ".quarantine"
+
+const (
+	// DefaultGCGrace is how long quarantined files are kept
+	DefaultGCGrace = 24 * time.Hour
+
+	// DefaultGCMinAge is how long a file must go unmodified before it can
+	// be judged an orphan, so files still being written are left alone
+	DefaultGCMinAge = time.Hour
+)
+
+// OrphanReason is why a file was judged an orphan
+type OrphanReason string
+
+// Orphan reasons
+const (
+	OrphanTemp         OrphanReason = "temp"         // Left by a write cut short: .tmp and .repair files, compaction output
+	OrphanBloom        OrphanReason = "bloom"        // Filter of a segment that's gone
+	OrphanSnapshot     OrphanReason = "snapshot"     // Older than the newest snapshot
+	OrphanArchived     OrphanReason = "archived"     // Segment the manifest has archived, as compaction does with its inputs
+	OrphanUnregistered OrphanReason = "unregistered" // Compacted segment the manifest doesn't know, from a compaction that was rolled back
+)
+
+// GCConfig configures a garbage collection pass
+type GCConfig struct {
+	// Dir is the WAL directory
+	Dir string
+
+	// TmpDir is the compactor's temp directory (defaults to Dir/.tmp)
+	TmpDir string
+
+	// Manifest judges segments. Nil leaves every segment alone: the
+	// in-memory manifest only knows the segments opened since startup.
+	Manifest ManifestStore
+
+	// Grace is how long quarantined files are kept before they're deleted
+	// (DefaultGCGrace if <= 0)
+	Grace time.Duration
+
+	// MinAge is how long a file must go unmodified before it's judged
+	// (DefaultGCMinAge if <= 0)
+	MinAge time.Duration
+
+	// DryRun reports what would be quarantined and deleted without
+	// touching anything
+	DryRun bool
+}
+
+// GCFile is a file the garbage collector acted on
+type GCFile struct {
+	Name   string       `json:"name"` // Relative to the WAL directory
+	Bytes  int64        `json:"bytes"`
+	Reason OrphanReason `json:"reason,omitempty"` // Empty for deleted files
+}
+
+// GCReport is what a garbage collection pass did
+type GCReport struct {
+	Quarantined      []GCFile `json:"quarantined"`
+	QuarantinedBytes int64    `json:"quarantined_bytes"`
+	Deleted          []GCFile `json:"deleted"` // Quarantined files past the grace period
+	ReclaimedBytes   int64    `json:"reclaimed_bytes"`
+	Unknown          []GCFile `json:"unknown,omitempty"` // WAL segments the manifest doesn't know, left in place
+	DryRun           bool     `json:"dry_run,omitempty"`
+}
+
+// CollectGarbage deletes the quarantined files past the grace period, then
+// quarantines the orphaned files in the WAL directory. A file that can't be
+// moved or deleted doesn't stop the pass; the first such error is returned
+// with the report.
+func CollectGarbage(ctx context.Context, cfg GCConfig) (*GCReport, error) {
+	if cfg.TmpDir == "" {
+		cfg.TmpDir = filepath.Join(cfg.Dir, ".tmp")
+	}
+	if cfg.Grace <= 0 {
+		cfg.Grace = DefaultGCGrace
+	}
+	if cfg.MinAge <= 0 {
+		cfg.MinAge = DefaultGCMinAge
+	}
+	now := time.Now()
+	report := &GCReport{Quarantined: []GCFile{}, Deleted: []GCFile{}, DryRun: cfg.DryRun}
+
+	orphans, unknown, err := findOrphans(ctx, cfg, now.Add(-cfg.MinAge))
+	if err != nil {
+		return nil, err
+	}
+	report.Unknown = unknown
+
+	var errs []error
+	quarantine := filepath.Join(cfg.Dir, QuarantineDir)
+	entries, err := os.ReadDir(quarantine)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read quarantine: %w", err)
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() || now.Sub(info.ModTime()) < cfg.Grace {
+			continue
+		}
+		if !cfg.DryRun {
+			if err := os.Remove(filepath.Join(quarantine, entry.Name())); err != nil {
+				errs = append(errs, fmt.Errorf("failed to delete quarantined %s: %w", entry.Name(), err))
+				continue
+			}
+		}
+		report.Deleted = append(report.Deleted, GCFile{Name: filepath.Join(QuarantineDir, entry.Name()), Bytes: info.Size()})
+		report.ReclaimedBytes += info.Size()
+	}
+
+	if len(orphans) > 0 && !cfg.DryRun {
+		if err := os.MkdirAll(quarantine, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create quarantine: %w", err)
+		}
+	}
+	for _, f := range orphans {
+		if !cfg.DryRun {
+			// The modification time marks when the grace period started
+			dst := filepath.Join(quarantine, filepath.Base(f.Name))
+			if err := os.Rename(filepath.Join(cfg.Dir, f.Name), dst); err != nil {
+				errs = append(errs, fmt.Errorf("failed to quarantine %s: %w", f.Name, err))
+				continue
+			}
+			_ = os.Chtimes(dst, now, now)
+		}
+		report.Quarantined = append(report.Quarantined, f)
+		report.QuarantinedBytes += f.Bytes
+	}
+
+	if !cfg.DryRun && len(report.Quarantined)+len(report.Deleted) > 0 {
+		for _, dir := range []string{cfg.Dir, cfg.TmpDir, quarantine} {
+			if _, err := os.Stat(dir); err != nil {
+				continue
+			}
+			if err := syncDir(dir); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return report, errors.Join(errs...)
+}
+
+// findOrphans returns the orphaned files last modified before cutoff, and
+// the WAL segments the manifest doesn't know
+func findOrphans(ctx context.Context, cfg GCConfig, cutoff time.Time) (orphans, unknown []GCFile, err error) {
+	var live, archived map[string]bool
+	if cfg.Manifest != nil {
+		if live, archived, err = manifestFiles(ctx, cfg.Manifest); err != nil {
+			return nil, nil, err
+		}
+	}
+	var newestSnapshot uint64
+	snaps, err := ListSnapshots(cfg.Dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(snaps) > 0 {
+		newestSnapshot = snaps[0].LSN
+	}
+
+	entries, err := os.ReadDir(cfg.Dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() || info.ModTime().After(cutoff) {
+			continue
+		}
+		name := entry.Name()
+		f := GCFile{Name: name, Bytes: info.Size()}
+		isSegment := (strings.HasPrefix(name, "wal_") || strings.HasPrefix(name, "cmp_")) && strings.HasSuffix(name, ".seg")
+		switch {
+		case strings.HasSuffix(name, ".tmp") || strings.HasSuffix(name, ".repair"):
+			f.Reason = OrphanTemp
+		case strings.HasSuffix(name, BloomSuffix):
+			if _, err := os.Stat(filepath.Join(cfg.Dir, strings.TrimSuffix(name, BloomSuffix))); os.IsNotExist(err) {
+				f.Reason = OrphanBloom
+			}
+		case isSegment && cfg.Manifest != nil && !live[name]:
+			switch {
+			case archived[name]:
+				f.Reason = OrphanArchived
+			case IsCompactedSegment(name):
+				f.Reason = OrphanUnregistered
+			default:
+				unknown = append(unknown, f)
+			}
+		default:
+			if lsn, _, ok := parseSnapshotFilename(name); ok && lsn < newestSnapshot {
+				f.Reason = OrphanSnapshot
+			}
+		}
+		if f.Reason != "" {
+			orphans = append(orphans, f)
+		}
+	}
+
+	// Everything in the compactor's temp directory is output of a
+	// compaction that didn't finish
+	entries, err = os.ReadDir(cfg.TmpDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, fmt.Errorf("failed to read temp directory: %w", err)
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() || info.ModTime().After(cutoff) {
+			continue
+		}
+		name, err := filepath.Rel(cfg.Dir, filepath.Join(cfg.TmpDir, entry.Name()))
+		if err != nil {
+			name = filepath.Join(cfg.TmpDir, entry.Name())
+		}
+		orphans = append(orphans, GCFile{Name: name, Bytes: info.Size(), Reason: OrphanTemp})
+	}
+	return orphans, unknown, nil
+}
+
+// manifestFiles returns the names of the segments the manifest holds, and
+// of those it has archived
+func manifestFiles(ctx context.Context, m ManifestStore) (live, archived map[string]bool, err error) {
+	info, err := m.GetRecoveryInfo(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	live = make(map[string]bool, len(info.Segments))
+	for _, seg := range info.Segments {
+		live[filepath.Base(seg.Filename)] = true
+	}
+	segs, err := m.GetSegmentsByStatus(ctx, SegmentStatusArchived)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read archived segments: %w", err)
+	}
+	archived = make(map[string]bool, len(segs))
+	for _, seg := range segs {
+		archived[filepath.Base(seg.Filename)] = true
+	}
+	return live, archived, nil
+}
@@ -0,0 +1,144 @@
+package wal
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// writeAged creates name under dir with size bytes, last modified age ago
+func writeAged(t *testing.T, dir, name string, size int, age time.Duration) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, make([]byte, size), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	at := time.Now().Add(-age)
+	if err := os.Chtimes(path, at, at); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func gcNames(files []GCFile) map[string]OrphanReason {
+	out := make(map[string]OrphanReason, len(files))
+	for _, f := range files {
+		out[f.Name] = f.Reason
+	}
+	return out
+}
+
+func TestCollectGarbage(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	manifest := NewInMemoryManifest()
+	for id := uint64(1); id <= 2; id++ {
+		_ = manifest.CreateSegment(ctx, id, filepath.Join(dir, SegmentFilename(id)))
+	}
+	_ = manifest.ArchiveSegments(ctx, []uint64{1})
+
+	old := 2 * time.Hour
+	writeAged(t, dir, SegmentFilename(1), 100, old)           // Archived
+	writeAged(t, dir, SegmentFilename(2), 100, old)           // Live
+	writeAged(t, dir, SegmentFilename(2)+BloomSuffix, 8, old) // Of a live segment
+	writeAged(t, dir, SegmentFilename(3), 100, old)           // Unknown to the manifest
+	writeAged(t, dir, CompactedSegmentFilename(2), 50, old)   // Rolled-back compaction
+	writeAged(t, dir, SegmentFilename(9)+BloomSuffix, 8, old)
+	writeAged(t, dir, SnapshotFilename(5, "aaaa"), 30, old)
+	writeAged(t, dir, SnapshotFilename(9, "bbbb"), 30, old)
+	writeAged(t, dir, "wal_000000000002.seg.bloom.tmp", 4, old)
+	writeAged(t, dir, "fresh.tmp", 4, time.Minute) // May still be written
+	writeAged(t, dir, LockFileName, 0, old)
+	writeAged(t, dir, ".tmp/compact_1.seg", 60, old)
+
+	cfg := GCConfig{Dir: dir, Manifest: manifest}
+	dry, err := CollectGarbage(ctx, GCConfig{Dir: dir, Manifest: manifest, DryRun: true})
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	report, err := CollectGarbage(ctx, cfg)
+	if err != nil {
+		t.Fatalf("CollectGarbage: %v", err)
+	}
+	if len(dry.Quarantined) != len(report.Quarantined) || !dry.DryRun {
+		t.Errorf("expected the dry run to report the same files, got %+v", dry.Quarantined)
+	}
+
+	want := map[string]OrphanReason{
+		SegmentFilename(1):                     OrphanArchived,
+		CompactedSegmentFilename(2):            OrphanUnregistered,
+		SegmentFilename(9) + BloomSuffix:       OrphanBloom,
+		SnapshotFilename(5, "aaaa"):            OrphanSnapshot,
+		"wal_000000000002.seg.bloom.tmp":       OrphanTemp,
+		filepath.Join(".tmp", "compact_1.seg"): OrphanTemp,
+	}
+	got := gcNames(report.Quarantined)
+	if len(got) != len(want) {
+		t.Errorf("quarantined %v, want %v", got, want)
+	}
+	for name, reason := range want {
+		if got[name] != reason {
+			t.Errorf("%s: reason %q, want %q", name, got[name], reason)
+		}
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be moved", name)
+		}
+		if _, err := os.Stat(filepath.Join(dir, QuarantineDir, filepath.Base(name))); err != nil {
+			t.Errorf("expected %s in quarantine: %v", name, err)
+		}
+	}
+	if report.QuarantinedBytes != 100+50+8+30+4+60 {
+		t.Errorf("quarantined %d bytes", report.QuarantinedBytes)
+	}
+	if u := report.Unknown; len(u) != 1 || u[0].Name != SegmentFilename(3) {
+		t.Errorf("expected the unknown WAL segment reported and kept, got %+v", u)
+	}
+	if len(report.Deleted) != 0 || report.ReclaimedBytes != 0 {
+		t.Errorf("expected nothing deleted within the grace period, got %+v", report.Deleted)
+	}
+
+	// Past the grace period quarantined files are deleted
+	cfg.Grace = time.Hour
+	entries, _ := os.ReadDir(filepath.Join(dir, QuarantineDir))
+	for _, e := range entries {
+		at := time.Now().Add(-2 * time.Hour)
+		_ = os.Chtimes(filepath.Join(dir, QuarantineDir, e.Name()), at, at)
+	}
+	report, err = CollectGarbage(ctx, cfg)
+	if err != nil {
+		t.Fatalf("CollectGarbage: %v", err)
+	}
+	if len(report.Deleted) != len(want) || report.ReclaimedBytes != 252 || len(report.Quarantined) != 0 {
+		t.Errorf("expected every quarantined file deleted, got %+v", report)
+	}
+	entries, _ = os.ReadDir(dir)
+	var left []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			left = append(left, e.Name())
+		}
+	}
+	sort.Strings(left)
+	if len(left) != 6 {
+		t.Errorf("unexpected files left: %v", left)
+	}
+}
+
+func TestCollectGarbageWithoutManifest(t *testing.T) {
+	dir := t.TempDir()
+	writeAged(t, dir, CompactedSegmentFilename(2), 50, 2*time.Hour)
+	writeAged(t, dir, SegmentFilename(3), 50, 2*time.Hour)
+
+	report, err := CollectGarbage(context.Background(), GCConfig{Dir: dir})
+	if err != nil {
+		t.Fatalf("CollectGarbage: %v", err)
+	}
+	if len(report.Quarantined) != 0 || len(report.Unknown) != 0 {
+		t.Errorf("expected segments left alone without a manifest, got %+v", report)
+	}
+}
@@ -0,0 +1,84 @@
+package wal
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/clock"
+)
+
+// HLC is a hybrid logical clock timestamp: the high 48 bits are wall-clock
+// milliseconds since the Unix epoch and the low 16 bits a logical counter
+// that orders events within the same millisecond. Comparing two HLCs as
+// integers orders them consistently across nodes, even when their wall
+// clocks drift, as long as nodes observe each other's timestamps.
+type HLC uint64
+
+const hlcLogicalBits = 16
+
+// NewHLC builds a timestamp from a wall-clock time and logical counter
+func NewHLC(wall time.Time, logical uint16) HLC {
+	return HLC(uint64(wall.UnixMilli())<<hlcLogicalBits | uint64(logical))
+}
+
+// Wall returns the wall-clock part of the timestamp
+func (h HLC) Wall() time.Time {
+	return time.UnixMilli(int64(h >> hlcLogicalBits))
+}
+
+// Logical returns the logical counter
+func (h HLC) Logical() uint16 {
+	return uint16(h)
+}
+
+func (h HLC) String() string {
+	return fmt.Sprintf("%s+%d", h.Wall().UTC().Format(time.RFC3339Nano), h.Logical())
+}
+
+// Clock issues HLC timestamps that never go backwards, even if the wall
+// clock does
+type Clock struct {
+	mu   sync.Mutex
+	last HLC
+	now  func() time.Time
+}
+
+// NewClock creates a clock backed by the system time
+func NewClock() *Clock {
+	return &Clock{now: time.Now}
+}
+
+// NewClockOn creates a clock that reads the wall time from wall, e.g. a
+// clock.Fake in tests
+func NewClockOn(wall clock.Clock) *Clock {
+	return &Clock{now: clock.Or(wall).Now}
+}
+
+// Now returns a timestamp greater than every one issued or observed before
+func (c *Clock) Now() HLC {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	wall := NewHLC(c.now(), 0)
+	if wall > c.last {
+		c.last = wall
+	} else {
+		// Same or earlier millisecond: bump the logical counter, which
+		// carries into the next millisecond on overflow
+		c.last++
+	}
+	return c.last
+}
+
+// Observe merges a timestamp seen on another node (or in a recovered WAL)
+// so later timestamps order after it, and returns the clock's new value
+func (c *Clock) Observe(remote HLC) HLC {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if remote > c.last {
+		c.last = remote
+	}
+	return c.last
+}
@@ -0,0 +1,47 @@
+package wal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHLCParts(t *testing.T) {
+	wall := time.UnixMilli(1_700_000_000_123)
+	ts := NewHLC(wall, 7)
+	if !ts.Wall().Equal(wall) || ts.Logical() != 7 {
+		t.Errorf("expected %v+7, got %v", wall, ts)
+	}
+	if NewHLC(wall, 65535) >= NewHLC(wall.Add(time.Millisecond), 0) {
+		t.Error("expected the wall clock to dominate the logical counter")
+	}
+}
+
+func TestClockMonotonic(t *testing.T) {
+	now := time.UnixMilli(1_700_000_000_000)
+	c := &Clock{now: func() time.Time { return now }}
+
+	first := c.Now()
+	second := c.Now()
+	if second <= first || second.Logical() != 1 {
+		t.Errorf("expected the logical counter to advance within a millisecond, got %v then %v", first, second)
+	}
+
+	// The wall clock going backwards doesn't move timestamps back
+	now = now.Add(-time.Second)
+	if third := c.Now(); third <= second {
+		t.Errorf("expected %v after %v", third, second)
+	}
+
+	// Observed timestamps from ahead of the wall clock are respected
+	remote := NewHLC(now.Add(time.Hour), 3)
+	c.Observe(remote)
+	if next := c.Now(); next <= remote {
+		t.Errorf("expected %v after observed %v", next, remote)
+	}
+
+	// A later wall clock resets the logical counter
+	now = now.Add(2 * time.Hour)
+	if next := c.Now(); next != NewHLC(now, 0) {
+		t.Errorf("expected %v, got %v", NewHLC(now, 0), next)
+	}
+}
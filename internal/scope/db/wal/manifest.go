@@ -3,9 +3,12 @@ package wal
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
+	"github.com/dsjohal14/selfstack/internal/libs/clock"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -75,9 +78,19 @@ type ManifestStore interface {
 	// SealSegment marks a WAL segment as sealed with its checksum
 	SealSegment(ctx context.Context, segmentID uint64, checksum string) error
 
+	// SetSegmentBloom stores the bloom filter of a sealed segment's doc IDs
+	SetSegmentBloom(ctx context.Context, segmentType SegmentType, segmentID uint64, bloom []byte) error
+
+	// GetSegmentBloom returns a segment's bloom filter, or nil if it has none
+	GetSegmentBloom(ctx context.Context, segmentType SegmentType, segmentID uint64) ([]byte, error)
+
 	// UpdateSegmentStats updates segment statistics
 	UpdateSegmentStats(ctx context.Context, segmentID uint64, sizeBytes int64, recordCount int, minLSN, maxLSN uint64) error
 
+	// UpdateSegmentContents records what a segment rewritten in place
+	// holds, WAL or compacted; an empty checksum keeps the one recorded
+	UpdateSegmentContents(ctx context.Context, segmentType SegmentType, segmentID uint64, sizeBytes int64, recordCount int, minLSN, maxLSN uint64, checksum string) error
+
 	// GetSealedSegments returns all sealed segments (both WAL and compacted)
 	GetSealedSegments(ctx context.Context) ([]SegmentInfo, error)
 
@@ -100,6 +113,11 @@ type ManifestStore interface {
 	// Only operates on WAL segments (segment_type='wal').
 	ArchiveSegments(ctx context.Context, segmentIDs []uint64) error
 
+	// ClearSegments removes every segment, WAL and compacted, except the
+	// WAL segment keep, recording an archived event for each. It returns
+	// how many were removed.
+	ClearSegments(ctx context.Context, keep uint64) (int, error)
+
 	// GetWALState returns the current WAL state
 	GetWALState(ctx context.Context) (*WALState, error)
 
@@ -111,6 +129,14 @@ type ManifestStore interface {
 
 	// GetRecoveryInfo returns all information needed for recovery
 	GetRecoveryInfo(ctx context.Context) (*RecoveryInfo, error)
+
+	// RecordSegmentEvent appends an entry to the segment audit trail.
+	// Status transitions made through this interface are recorded automatically;
+	// use this for events that don't change status (e.g. repairs).
+	RecordSegmentEvent(ctx context.Context, ev SegmentEvent) error
+
+	// GetSegmentEvents returns audit trail entries, newest first
+	GetSegmentEvents(ctx context.Context, filter SegmentEventFilter) ([]SegmentEvent, error)
 }
 
 // PostgresManifest implements ManifestStore using PostgreSQL
@@ -164,42 +190,74 @@ func (m *PostgresManifest) GetActiveSegment(ctx context.Context) (*SegmentInfo,
 
 // CreateSegment registers a new WAL segment (segment_type='wal')
 func (m *PostgresManifest) CreateSegment(ctx context.Context, segmentID uint64, filename string) error {
-	_, err := m.db.Exec(ctx, `
-		INSERT INTO wal_segments (segment_id, segment_type, filename, status, created_at)
-		VALUES ($1, 'wal', $2, 'active', NOW())
-	`, segmentID, filename)
-	if err != nil {
-		return fmt.Errorf("failed to create segment: %w", err)
-	}
-	return nil
+	return m.withTx(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO wal_segments (segment_id, segment_type, filename, status, created_at)
+			VALUES ($1, 'wal', $2, 'active', NOW())
+		`, segmentID, filename)
+		if err != nil {
+			return fmt.Errorf("failed to create segment: %w", err)
+		}
+		return insertSegmentEvent(ctx, tx, newSegmentEvent(ctx, SegmentTypeWAL, segmentID, "", SegmentStatusActive))
+	})
 }
 
 // CreateCompactedSegment registers a new compacted segment (segment_type='cmp')
 func (m *PostgresManifest) CreateCompactedSegment(ctx context.Context, segmentID uint64, filename string, sizeBytes int64, recordCount int, minLSN, maxLSN uint64, checksum string) error {
+	return m.withTx(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO wal_segments (segment_id, segment_type, filename, size_bytes, record_count, min_lsn, max_lsn, status, checksum, sealed_at, created_at)
+			VALUES ($1, 'cmp', $2, $3, $4, $5, $6, 'sealed', $7, NOW(), NOW())
+		`, segmentID, filename, sizeBytes, recordCount, minLSN, maxLSN, checksum)
+		if err != nil {
+			return fmt.Errorf("failed to create compacted segment: %w", err)
+		}
+		return insertSegmentEvent(ctx, tx, newSegmentEvent(ctx, SegmentTypeCompacted, segmentID, "", SegmentStatusSealed))
+	})
+}
+
+// SealSegment marks a WAL segment as sealed with its checksum
+func (m *PostgresManifest) SealSegment(ctx context.Context, segmentID uint64, checksum string) error {
+	return m.withTx(ctx, func(tx pgx.Tx) error {
+		result, err := tx.Exec(ctx, `
+			UPDATE wal_segments
+			SET status = 'sealed', sealed_at = NOW(), checksum = $2
+			WHERE segment_id = $1 AND segment_type = 'wal' AND status = 'active'
+		`, segmentID, checksum)
+		if err != nil {
+			return fmt.Errorf("failed to seal segment: %w", err)
+		}
+		if result.RowsAffected() == 0 {
+			return fmt.Errorf("segment %d not found or not active", segmentID)
+		}
+		return insertSegmentEvent(ctx, tx, newSegmentEvent(ctx, SegmentTypeWAL, segmentID, SegmentStatusActive, SegmentStatusSealed))
+	})
+}
+
+// SetSegmentBloom stores the bloom filter of a sealed segment's doc IDs
+func (m *PostgresManifest) SetSegmentBloom(ctx context.Context, segmentType SegmentType, segmentID uint64, bloom []byte) error {
 	_, err := m.db.Exec(ctx, `
-		INSERT INTO wal_segments (segment_id, segment_type, filename, size_bytes, record_count, min_lsn, max_lsn, status, checksum, sealed_at, created_at)
-		VALUES ($1, 'cmp', $2, $3, $4, $5, $6, 'sealed', $7, NOW(), NOW())
-	`, segmentID, filename, sizeBytes, recordCount, minLSN, maxLSN, checksum)
+		UPDATE wal_segments SET bloom = $3 WHERE segment_id = $1 AND segment_type = $2
+	`, segmentID, segmentType, bloom)
 	if err != nil {
-		return fmt.Errorf("failed to create compacted segment: %w", err)
+		return fmt.Errorf("failed to store segment bloom filter: %w", err)
 	}
 	return nil
 }
 
-// SealSegment marks a WAL segment as sealed with its checksum
-func (m *PostgresManifest) SealSegment(ctx context.Context, segmentID uint64, checksum string) error {
-	result, err := m.db.Exec(ctx, `
-		UPDATE wal_segments
-		SET status = 'sealed', sealed_at = NOW(), checksum = $2
-		WHERE segment_id = $1 AND segment_type = 'wal' AND status = 'active'
-	`, segmentID, checksum)
-	if err != nil {
-		return fmt.Errorf("failed to seal segment: %w", err)
+// GetSegmentBloom returns a segment's bloom filter, or nil if it has none
+func (m *PostgresManifest) GetSegmentBloom(ctx context.Context, segmentType SegmentType, segmentID uint64) ([]byte, error) {
+	var bloom []byte
+	err := m.db.QueryRow(ctx, `
+		SELECT bloom FROM wal_segments WHERE segment_id = $1 AND segment_type = $2
+	`, segmentID, segmentType).Scan(&bloom)
+	if err == pgx.ErrNoRows {
+		return nil, nil
 	}
-	if result.RowsAffected() == 0 {
-		return fmt.Errorf("segment %d not found or not active", segmentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get segment bloom filter: %w", err)
 	}
-	return nil
+	return bloom, nil
 }
 
 // UpdateSegmentStats updates WAL segment statistics
@@ -215,6 +273,24 @@ func (m *PostgresManifest) UpdateSegmentStats(ctx context.Context, segmentID uin
 	return nil
 }
 
+// UpdateSegmentContents records what a segment rewritten in place holds;
+// an empty checksum keeps the one recorded
+func (m *PostgresManifest) UpdateSegmentContents(ctx context.Context, segmentType SegmentType, segmentID uint64, sizeBytes int64, recordCount int, minLSN, maxLSN uint64, checksum string) error {
+	result, err := m.db.Exec(ctx, `
+		UPDATE wal_segments
+		SET size_bytes = $3, record_count = $4, min_lsn = $5, max_lsn = $6,
+			checksum = COALESCE(NULLIF($7, ''), checksum)
+		WHERE segment_id = $1 AND segment_type = $2
+	`, segmentID, segmentType, sizeBytes, recordCount, minLSN, maxLSN, checksum)
+	if err != nil {
+		return fmt.Errorf("failed to update segment contents: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("segment %s/%d not found", segmentType, segmentID)
+	}
+	return nil
+}
+
 // GetSealedSegments returns all sealed segments (both WAL and compacted) ordered by segment_id
 func (m *PostgresManifest) GetSealedSegments(ctx context.Context) ([]SegmentInfo, error) {
 	return m.GetSegmentsByStatus(ctx, SegmentStatusSealed)
@@ -295,16 +371,29 @@ func (m *PostgresManifest) UpdateSegmentStatus(ctx context.Context, segmentID ui
 
 // UpdateWALSegmentStatus updates a WAL segment's status
 func (m *PostgresManifest) UpdateWALSegmentStatus(ctx context.Context, segmentID uint64, status SegmentStatus) error {
-	result, err := m.db.Exec(ctx, `
-		UPDATE wal_segments SET status = $2 WHERE segment_id = $1 AND segment_type = 'wal'
-	`, segmentID, status)
-	if err != nil {
-		return fmt.Errorf("failed to update WAL segment status: %w", err)
-	}
-	if result.RowsAffected() == 0 {
-		return fmt.Errorf("WAL segment %d not found", segmentID)
-	}
-	return nil
+	return m.withTx(ctx, func(tx pgx.Tx) error {
+		var from SegmentStatus
+		err := tx.QueryRow(ctx, `
+			SELECT status FROM wal_segments WHERE segment_id = $1 AND segment_type = 'wal' FOR UPDATE
+		`, segmentID).Scan(&from)
+		if err == pgx.ErrNoRows {
+			return fmt.Errorf("WAL segment %d not found", segmentID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update WAL segment status: %w", err)
+		}
+		if from == status {
+			return nil
+		}
+
+		_, err = tx.Exec(ctx, `
+			UPDATE wal_segments SET status = $2 WHERE segment_id = $1 AND segment_type = 'wal'
+		`, segmentID, status)
+		if err != nil {
+			return fmt.Errorf("failed to update WAL segment status: %w", err)
+		}
+		return insertSegmentEvent(ctx, tx, newSegmentEvent(ctx, SegmentTypeWAL, segmentID, from, status))
+	})
 }
 
 // ArchiveSegments marks multiple WAL segments as archived
@@ -313,21 +402,57 @@ func (m *PostgresManifest) ArchiveSegments(ctx context.Context, segmentIDs []uin
 		return nil
 	}
 
+	return archiveWALSegments(ctx, m.db, segmentIDs)
+}
+
+// archiveWALSegments marks WAL segments archived and records one audit event per
+// segment in a single statement. Works with both a pool and an open transaction.
+func archiveWALSegments(ctx context.Context, db execer, segmentIDs []uint64) error {
 	// Convert uint64 to int64 for pgx compatibility with bigint[]
 	ids := make([]int64, len(segmentIDs))
 	for i, id := range segmentIDs {
 		ids[i] = int64(id)
 	}
 
-	_, err := m.db.Exec(ctx, `
-		UPDATE wal_segments SET status = 'archived' WHERE segment_id = ANY($1) AND segment_type = 'wal'
-	`, ids)
+	actor, reason := segmentActorFromContext(ctx)
+	_, err := db.Exec(ctx, `
+		WITH old AS (
+			SELECT id, segment_id, status FROM wal_segments
+			WHERE segment_id = ANY($1) AND segment_type = 'wal' AND status <> 'archived'
+			FOR UPDATE
+		), upd AS (
+			UPDATE wal_segments s SET status = 'archived'
+			FROM old WHERE s.id = old.id
+			RETURNING old.segment_id, old.status AS from_status
+		)
+		INSERT INTO wal_segment_events (segment_id, segment_type, from_status, to_status, actor, reason)
+		SELECT segment_id, 'wal', from_status, 'archived', $2, $3 FROM upd
+	`, ids, actor, reason)
 	if err != nil {
 		return fmt.Errorf("failed to archive segments: %w", err)
 	}
 	return nil
 }
 
+// ClearSegments removes every segment except the WAL segment keep, and
+// records their events, in a single statement
+func (m *PostgresManifest) ClearSegments(ctx context.Context, keep uint64) (int, error) {
+	actor, reason := segmentActorFromContext(ctx)
+	tag, err := m.db.Exec(ctx, `
+		WITH del AS (
+			DELETE FROM wal_segments
+			WHERE NOT (segment_id = $1 AND segment_type = 'wal')
+			RETURNING segment_id, segment_type, status
+		)
+		INSERT INTO wal_segment_events (segment_id, segment_type, from_status, to_status, actor, reason)
+		SELECT segment_id, segment_type, status, 'archived', $2, $3 FROM del
+	`, int64(keep), actor, reason)
+	if err != nil {
+		return 0, fmt.Errorf("failed to clear segments: %w", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
+
 // GetWALState returns the current WAL state
 func (m *PostgresManifest) GetWALState(ctx context.Context) (*WALState, error) {
 	var state WALState
@@ -407,6 +532,85 @@ func (m *PostgresManifest) GetRecoveryInfo(ctx context.Context) (*RecoveryInfo,
 	}, nil
 }
 
+// RecordSegmentEvent appends an entry to the segment audit trail
+func (m *PostgresManifest) RecordSegmentEvent(ctx context.Context, ev SegmentEvent) error {
+	return insertSegmentEvent(ctx, m.db, ev)
+}
+
+// GetSegmentEvents returns audit trail entries, newest first
+func (m *PostgresManifest) GetSegmentEvents(ctx context.Context, filter SegmentEventFilter) ([]SegmentEvent, error) {
+	var segmentID *int64
+	if filter.SegmentID != nil {
+		v := int64(*filter.SegmentID)
+		segmentID = &v
+	}
+	var since *time.Time
+	if !filter.Since.IsZero() {
+		since = &filter.Since
+	}
+
+	rows, err := m.db.Query(ctx, `
+		SELECT id, segment_id, segment_type, COALESCE(from_status, ''), to_status, actor, COALESCE(reason, ''), created_at
+		FROM wal_segment_events
+		WHERE ($1::BIGINT IS NULL OR segment_id = $1)
+		  AND ($2 = '' OR segment_type = $2)
+		  AND ($3::TIMESTAMPTZ IS NULL OR created_at >= $3)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $4
+	`, segmentID, string(filter.SegmentType), since, filter.limit())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get segment events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []SegmentEvent
+	for rows.Next() {
+		var ev SegmentEvent
+		if err := rows.Scan(&ev.ID, &ev.SegmentID, &ev.SegmentType, &ev.FromStatus, &ev.ToStatus,
+			&ev.Actor, &ev.Reason, &ev.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan segment event: %w", err)
+		}
+		events = append(events, ev)
+	}
+	return events, rows.Err()
+}
+
+// execer is satisfied by both *pgxpool.Pool and pgx.Tx
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// insertSegmentEvent writes an audit trail row
+func insertSegmentEvent(ctx context.Context, db execer, ev SegmentEvent) error {
+	var from *string
+	if ev.FromStatus != "" {
+		v := string(ev.FromStatus)
+		from = &v
+	}
+	_, err := db.Exec(ctx, `
+		INSERT INTO wal_segment_events (segment_id, segment_type, from_status, to_status, actor, reason, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW())
+	`, ev.SegmentID, ev.SegmentType, from, ev.ToStatus, ev.Actor, ev.Reason)
+	if err != nil {
+		return fmt.Errorf("failed to record segment event: %w", err)
+	}
+	return nil
+}
+
+// withTx runs fn in a transaction, committing on success
+func (m *PostgresManifest) withTx(ctx context.Context, fn func(tx pgx.Tx) error) error {
+	tx, err := m.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
 // segmentKey is a composite key for segment lookup by type and ID
 type segmentKey struct {
 	Type SegmentType
@@ -416,20 +620,44 @@ type segmentKey struct {
 // InMemoryManifest implements ManifestStore using in-memory storage (for testing)
 type InMemoryManifest struct {
 	segments map[segmentKey]*SegmentInfo
+	blooms   map[segmentKey][]byte
 	state    WALState
+
+	eventsMu    sync.RWMutex
+	events      []SegmentEvent
+	nextEventID int64
+
+	clock clock.Clock // Segment and state times are read from it
+}
+
+// InMemoryManifestOption configures an InMemoryManifest
+type InMemoryManifestOption func(*InMemoryManifest)
+
+// WithManifestClock reads the creation, seal, and update times it records
+// from c instead of the system clock
+func WithManifestClock(c clock.Clock) InMemoryManifestOption {
+	return func(m *InMemoryManifest) {
+		m.clock = clock.Or(c)
+	}
 }
 
 // NewInMemoryManifest creates a new in-memory manifest store
-func NewInMemoryManifest() *InMemoryManifest {
-	return &InMemoryManifest{
+func NewInMemoryManifest(opts ...InMemoryManifestOption) *InMemoryManifest {
+	m := &InMemoryManifest{
 		segments: make(map[segmentKey]*SegmentInfo),
-		state: WALState{
-			CurrentSegmentID: 1,
-			NextLSN:          1,
-			CheckpointLSN:    0,
-			UpdatedAt:        time.Now(),
-		},
+		blooms:   make(map[segmentKey][]byte),
+		clock:    clock.System(),
+	}
+	for _, opt := range opts {
+		opt(m)
 	}
+	m.state = WALState{
+		CurrentSegmentID: 1,
+		NextLSN:          1,
+		CheckpointLSN:    0,
+		UpdatedAt:        m.clock.Now(),
+	}
+	return m
 }
 
 // GetActiveSegment returns the current active WAL segment
@@ -443,7 +671,7 @@ func (m *InMemoryManifest) GetActiveSegment(_ context.Context) (*SegmentInfo, er
 }
 
 // CreateSegment registers a new WAL segment (segment_type='wal')
-func (m *InMemoryManifest) CreateSegment(_ context.Context, segmentID uint64, filename string) error {
+func (m *InMemoryManifest) CreateSegment(ctx context.Context, segmentID uint64, filename string) error {
 	key := segmentKey{Type: SegmentTypeWAL, ID: segmentID}
 	m.segments[key] = &SegmentInfo{
 		ID:          int64(segmentID),
@@ -451,16 +679,17 @@ func (m *InMemoryManifest) CreateSegment(_ context.Context, segmentID uint64, fi
 		SegmentType: SegmentTypeWAL,
 		Filename:    filename,
 		Status:      SegmentStatusActive,
-		CreatedAt:   time.Now(),
+		CreatedAt:   m.clock.Now(),
 	}
 	m.state.CurrentSegmentID = segmentID
+	m.appendEvent(newSegmentEvent(ctx, SegmentTypeWAL, segmentID, "", SegmentStatusActive))
 	return nil
 }
 
 // CreateCompactedSegment registers a new compacted segment (segment_type='cmp')
-func (m *InMemoryManifest) CreateCompactedSegment(_ context.Context, segmentID uint64, filename string, sizeBytes int64, recordCount int, minLSN, maxLSN uint64, checksum string) error {
+func (m *InMemoryManifest) CreateCompactedSegment(ctx context.Context, segmentID uint64, filename string, sizeBytes int64, recordCount int, minLSN, maxLSN uint64, checksum string) error {
 	key := segmentKey{Type: SegmentTypeCompacted, ID: segmentID}
-	now := time.Now()
+	now := m.clock.Now()
 	m.segments[key] = &SegmentInfo{
 		ID:          int64(segmentID),
 		SegmentID:   segmentID,
@@ -475,23 +704,40 @@ func (m *InMemoryManifest) CreateCompactedSegment(_ context.Context, segmentID u
 		SealedAt:    &now,
 		Checksum:    &checksum,
 	}
+	m.appendEvent(newSegmentEvent(ctx, SegmentTypeCompacted, segmentID, "", SegmentStatusSealed))
 	return nil
 }
 
 // SealSegment marks a WAL segment as sealed with its checksum
-func (m *InMemoryManifest) SealSegment(_ context.Context, segmentID uint64, checksum string) error {
+func (m *InMemoryManifest) SealSegment(ctx context.Context, segmentID uint64, checksum string) error {
 	key := segmentKey{Type: SegmentTypeWAL, ID: segmentID}
 	seg, ok := m.segments[key]
 	if !ok {
 		return fmt.Errorf("WAL segment %d not found", segmentID)
 	}
+	m.appendEvent(newSegmentEvent(ctx, SegmentTypeWAL, segmentID, seg.Status, SegmentStatusSealed))
 	seg.Status = SegmentStatusSealed
-	now := time.Now()
+	now := m.clock.Now()
 	seg.SealedAt = &now
 	seg.Checksum = &checksum
 	return nil
 }
 
+// SetSegmentBloom stores the bloom filter of a sealed segment's doc IDs
+func (m *InMemoryManifest) SetSegmentBloom(_ context.Context, segmentType SegmentType, segmentID uint64, bloom []byte) error {
+	key := segmentKey{Type: segmentType, ID: segmentID}
+	if _, ok := m.segments[key]; !ok {
+		return fmt.Errorf("segment %s/%d not found", segmentType, segmentID)
+	}
+	m.blooms[key] = bloom
+	return nil
+}
+
+// GetSegmentBloom returns a segment's bloom filter, or nil if it has none
+func (m *InMemoryManifest) GetSegmentBloom(_ context.Context, segmentType SegmentType, segmentID uint64) ([]byte, error) {
+	return m.blooms[segmentKey{Type: segmentType, ID: segmentID}], nil
+}
+
 // UpdateSegmentStats updates WAL segment statistics
 func (m *InMemoryManifest) UpdateSegmentStats(_ context.Context, segmentID uint64, sizeBytes int64, recordCount int, minLSN, maxLSN uint64) error {
 	key := segmentKey{Type: SegmentTypeWAL, ID: segmentID}
@@ -506,6 +752,23 @@ func (m *InMemoryManifest) UpdateSegmentStats(_ context.Context, segmentID uint6
 	return nil
 }
 
+// UpdateSegmentContents records what a segment rewritten in place holds;
+// an empty checksum keeps the one recorded
+func (m *InMemoryManifest) UpdateSegmentContents(_ context.Context, segmentType SegmentType, segmentID uint64, sizeBytes int64, recordCount int, minLSN, maxLSN uint64, checksum string) error {
+	seg, ok := m.segments[segmentKey{Type: segmentType, ID: segmentID}]
+	if !ok {
+		return fmt.Errorf("segment %s/%d not found", segmentType, segmentID)
+	}
+	seg.SizeBytes = sizeBytes
+	seg.RecordCount = recordCount
+	seg.MinLSN = &minLSN
+	seg.MaxLSN = &maxLSN
+	if checksum != "" {
+		seg.Checksum = &checksum
+	}
+	return nil
+}
+
 // GetSealedSegments returns all sealed segments (both WAL and compacted)
 func (m *InMemoryManifest) GetSealedSegments(ctx context.Context) ([]SegmentInfo, error) {
 	return m.GetSegmentsByStatus(ctx, SegmentStatusSealed)
@@ -539,27 +802,46 @@ func (m *InMemoryManifest) UpdateSegmentStatus(ctx context.Context, segmentID ui
 }
 
 // UpdateWALSegmentStatus updates a WAL segment's status
-func (m *InMemoryManifest) UpdateWALSegmentStatus(_ context.Context, segmentID uint64, status SegmentStatus) error {
+func (m *InMemoryManifest) UpdateWALSegmentStatus(ctx context.Context, segmentID uint64, status SegmentStatus) error {
 	key := segmentKey{Type: SegmentTypeWAL, ID: segmentID}
 	seg, ok := m.segments[key]
 	if !ok {
 		return fmt.Errorf("WAL segment %d not found", segmentID)
 	}
+	if seg.Status != status {
+		m.appendEvent(newSegmentEvent(ctx, SegmentTypeWAL, segmentID, seg.Status, status))
+	}
 	seg.Status = status
 	return nil
 }
 
 // ArchiveSegments marks multiple WAL segments as archived
-func (m *InMemoryManifest) ArchiveSegments(_ context.Context, segmentIDs []uint64) error {
+func (m *InMemoryManifest) ArchiveSegments(ctx context.Context, segmentIDs []uint64) error {
 	for _, id := range segmentIDs {
 		key := segmentKey{Type: SegmentTypeWAL, ID: id}
-		if seg, ok := m.segments[key]; ok {
+		if seg, ok := m.segments[key]; ok && seg.Status != SegmentStatusArchived {
+			m.appendEvent(newSegmentEvent(ctx, SegmentTypeWAL, id, seg.Status, SegmentStatusArchived))
 			seg.Status = SegmentStatusArchived
 		}
 	}
 	return nil
 }
 
+// ClearSegments removes every segment except the WAL segment keep
+func (m *InMemoryManifest) ClearSegments(ctx context.Context, keep uint64) (int, error) {
+	removed := 0
+	for key, seg := range m.segments {
+		if key == (segmentKey{Type: SegmentTypeWAL, ID: keep}) {
+			continue
+		}
+		m.appendEvent(newSegmentEvent(ctx, key.Type, key.ID, seg.Status, SegmentStatusArchived))
+		delete(m.segments, key)
+		delete(m.blooms, key)
+		removed++
+	}
+	return removed, nil
+}
+
 // GetWALState returns the current WAL state
 func (m *InMemoryManifest) GetWALState(_ context.Context) (*WALState, error) {
 	return &m.state, nil
@@ -569,14 +851,14 @@ func (m *InMemoryManifest) GetWALState(_ context.Context) (*WALState, error) {
 func (m *InMemoryManifest) UpdateWALState(_ context.Context, currentSegmentID, nextLSN uint64) error {
 	m.state.CurrentSegmentID = currentSegmentID
 	m.state.NextLSN = nextLSN
-	m.state.UpdatedAt = time.Now()
+	m.state.UpdatedAt = m.clock.Now()
 	return nil
 }
 
 // UpdateCheckpointLSN updates the checkpoint LSN
 func (m *InMemoryManifest) UpdateCheckpointLSN(_ context.Context, lsn uint64) error {
 	m.state.CheckpointLSN = lsn
-	m.state.UpdatedAt = time.Now()
+	m.state.UpdatedAt = m.clock.Now()
 	return nil
 }
 
@@ -593,3 +875,35 @@ func (m *InMemoryManifest) GetRecoveryInfo(_ context.Context) (*RecoveryInfo, er
 		Segments: segments,
 	}, nil
 }
+
+// RecordSegmentEvent appends an entry to the segment audit trail
+func (m *InMemoryManifest) RecordSegmentEvent(_ context.Context, ev SegmentEvent) error {
+	if ev.CreatedAt.IsZero() {
+		ev.CreatedAt = m.clock.Now()
+	}
+	m.appendEvent(ev)
+	return nil
+}
+
+// GetSegmentEvents returns audit trail entries, newest first
+func (m *InMemoryManifest) GetSegmentEvents(_ context.Context, filter SegmentEventFilter) ([]SegmentEvent, error) {
+	m.eventsMu.RLock()
+	defer m.eventsMu.RUnlock()
+
+	var result []SegmentEvent
+	for i := len(m.events) - 1; i >= 0 && len(result) < filter.limit(); i-- {
+		if filter.matches(m.events[i]) {
+			result = append(result, m.events[i])
+		}
+	}
+	return result, nil
+}
+
+// appendEvent assigns an ID and stores the event
+func (m *InMemoryManifest) appendEvent(ev SegmentEvent) {
+	m.eventsMu.Lock()
+	defer m.eventsMu.Unlock()
+	m.nextEventID++
+	ev.ID = m.nextEventID
+	m.events = append(m.events, ev)
+}
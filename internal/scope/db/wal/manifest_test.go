@@ -4,6 +4,8 @@ import (
 	"context"
 	"testing"
 	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/clock"
 )
 
 func TestInMemoryManifest(t *testing.T) {
@@ -99,6 +101,27 @@ func TestInMemoryManifestWALState(t *testing.T) {
 	}
 }
 
+func TestInMemoryManifestClock(t *testing.T) {
+	ctx := context.Background()
+	fake := clock.NewFake(time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC))
+	manifest := NewInMemoryManifest(WithManifestClock(fake))
+
+	created := fake.Now()
+	_ = manifest.CreateSegment(ctx, 1, "wal_000000000001.seg")
+	fake.Advance(time.Hour)
+	_ = manifest.SealSegment(ctx, 1, "00000000")
+	_ = manifest.UpdateWALState(ctx, 2, 10)
+
+	info, _ := manifest.GetRecoveryInfo(ctx)
+	seg := info.Segments[0]
+	if !seg.CreatedAt.Equal(created) || seg.SealedAt == nil || !seg.SealedAt.Equal(fake.Now()) {
+		t.Errorf("expected the segment created and sealed an hour apart on the fake clock, got %s and %v", seg.CreatedAt, seg.SealedAt)
+	}
+	if !info.State.UpdatedAt.Equal(fake.Now()) {
+		t.Errorf("expected the state updated at %s, got %s", fake.Now(), info.State.UpdatedAt)
+	}
+}
+
 func TestInMemoryManifestRecoveryInfo(t *testing.T) {
 	ctx := context.Background()
 	manifest := NewInMemoryManifest()
@@ -217,3 +240,54 @@ func TestSegmentInfoFields(t *testing.T) {
 		t.Errorf("status mismatch")
 	}
 }
+
+func TestInMemoryManifestSegmentEvents(t *testing.T) {
+	ctx := context.Background()
+	m := NewInMemoryManifest()
+
+	writerCtx := WithSegmentActor(ctx, ActorWriter, "segment rotation")
+	_ = m.CreateSegment(writerCtx, 1, "wal_000000000001.seg")
+	_ = m.SealSegment(writerCtx, 1, "abc123")
+
+	compactorCtx := WithSegmentActor(ctx, ActorCompactor, "forced compaction")
+	_ = m.UpdateSegmentStatus(compactorCtx, 1, SegmentStatusCompacting)
+	_ = m.ArchiveSegments(compactorCtx, []uint64{1})
+
+	// No-op transitions are not recorded
+	_ = m.ArchiveSegments(compactorCtx, []uint64{1})
+
+	events, err := m.GetSegmentEvents(ctx, SegmentEventFilter{})
+	if err != nil {
+		t.Fatalf("GetSegmentEvents failed: %v", err)
+	}
+	if len(events) != 4 {
+		t.Fatalf("expected 4 events, got %d", len(events))
+	}
+
+	// Newest first
+	latest := events[0]
+	if latest.FromStatus != SegmentStatusCompacting || latest.ToStatus != SegmentStatusArchived {
+		t.Errorf("expected compacting->archived, got %s->%s", latest.FromStatus, latest.ToStatus)
+	}
+	if latest.Actor != ActorCompactor || latest.Reason != "forced compaction" {
+		t.Errorf("expected compactor actor with reason, got %s %q", latest.Actor, latest.Reason)
+	}
+
+	created := events[3]
+	if created.FromStatus != "" || created.ToStatus != SegmentStatusActive || created.Actor != ActorWriter {
+		t.Errorf("unexpected creation event: %+v", created)
+	}
+
+	// Default actor when none is attached
+	_ = m.CreateSegment(ctx, 2, "wal_000000000002.seg")
+	id := uint64(2)
+	events, _ = m.GetSegmentEvents(ctx, SegmentEventFilter{SegmentID: &id})
+	if len(events) != 1 || events[0].Actor != ActorSystem {
+		t.Errorf("expected one system event for segment 2, got %+v", events)
+	}
+
+	events, _ = m.GetSegmentEvents(ctx, SegmentEventFilter{Limit: 2})
+	if len(events) != 2 {
+		t.Errorf("expected limit to cap results at 2, got %d", len(events))
+	}
+}
@@ -0,0 +1,233 @@
+package wal
+
+import (
+	"container/heap"
+	"fmt"
+)
+
+// Compaction streams records instead of buffering them. Pass 1 (latestLSNs)
+// keeps only DocID -> newest LSN; pass 2 (writeMerged) walks the segments
+// again in LSN order and writes each record that is still the newest for its
+// document. Memory is bounded by the number of distinct documents, not by
+// the size of their text and embeddings.
+
+// latestLSNs verifies each segment and maps every document to the LSN of its
+// newest INSERT/UPDATE/DELETE record, and every KV key to its newest KV record
+func latestLSNs(segments []SegmentInfo) (map[string]uint64, error) {
+	latest := make(map[string]uint64)
+
+	for _, seg := range segments {
+		// Verify checksum if available
+		if seg.Checksum != nil {
+			valid, err := VerifySegmentChecksum(seg.Filename, *seg.Checksum)
+			if err != nil {
+				return nil, fmt.Errorf("failed to verify segment %s: %w", seg.Filename, err)
+			}
+			if !valid {
+				return nil, fmt.Errorf("segment %s checksum mismatch", seg.Filename)
+			}
+		}
+
+		iter, err := NewSegmentIterator(seg.Filename)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open segment %s: %w", seg.Filename, err)
+		}
+
+		for iter.Next() {
+			rec := iter.Record()
+			key, ok, err := liveKey(rec)
+			if err != nil {
+				_ = iter.Close()
+				return nil, fmt.Errorf("failed to decode record at LSN %d: %w", rec.LSN, err)
+			}
+			if !ok {
+				continue // Checkpoints are dropped
+			}
+			if rec.LSN > latest[key] {
+				latest[key] = rec.LSN
+			}
+		}
+
+		if err := iter.Err(); err != nil {
+			_ = iter.Close()
+			return nil, fmt.Errorf("error reading segment %s: %w", seg.Filename, err)
+		}
+		_ = iter.Close()
+	}
+
+	return latest, nil
+}
+
+// mergeStats summarizes the records written by writeMerged
+type mergeStats struct {
+	Records int
+	MinLSN  uint64
+	MaxLSN  uint64
+}
+
+// writeMerged streams the newest record for each document and KV key into
+// w, in LSN order. Tombstones are kept: they mask INSERTs in older compacted
+// segments.
+func writeMerged(segments []SegmentInfo, latest map[string]uint64, w *SegmentWriter) (mergeStats, error) {
+	var stats mergeStats
+
+	it, err := newMergeIterator(segments)
+	if err != nil {
+		return stats, err
+	}
+	defer it.Close()
+
+	for it.Next() {
+		rec := it.Record()
+		key, ok, err := liveKey(rec)
+		if err != nil {
+			return stats, fmt.Errorf("failed to decode record at LSN %d: %w", rec.LSN, err)
+		}
+		if !ok || latest[key] != rec.LSN {
+			continue // Checkpoint or superseded
+		}
+		if rec.InBatch() {
+			rec.setBatch(false) // Compacted records are all committed; other records of the batch may be gone
+		}
+
+		if err := w.Write(rec); err != nil {
+			return stats, fmt.Errorf("failed to write record: %w", err)
+		}
+		if stats.Records == 0 {
+			stats.MinLSN = rec.LSN
+		}
+		stats.MaxLSN = rec.LSN
+		stats.Records++
+	}
+
+	return stats, it.Err()
+}
+
+// isDocRecord reports whether the record type carries a DocID
+func isDocRecord(t RecordType) bool {
+	return t == RecordTypeInsert || t == RecordTypeUpdate || t == RecordTypeDelete
+}
+
+// kvKeyPrefix keeps KV keys apart from DocIDs when both are tracked in one
+// map; DocIDs never start with a NUL byte
+const kvKeyPrefix = "\x00kv\x00"
+
+// liveKey returns what a record's newest version is tracked by during
+// compaction: its DocID, its KV key with kvKeyPrefix, or its collection with
+// schemaKeyPrefix. ok is false for records that compaction drops.
+func liveKey(rec *Record) (key string, ok bool, err error) {
+	if !isDocRecord(rec.Type) && rec.Type != RecordTypeKV && !isSchemaRecord(rec.Type) {
+		return "", false, nil
+	}
+	id, err := payloadDocID(rec.Payload)
+	if err != nil {
+		return "", false, err
+	}
+	switch {
+	case rec.Type == RecordTypeKV:
+		return kvKeyPrefix + string(id), true, nil
+	case isSchemaRecord(rec.Type):
+		return schemaKey(rec.Type, string(id)), true, nil
+	}
+	return string(id), true, nil
+}
+
+// mergeIterator is a k-way merge over segment iterators, yielding records in
+// LSN order. Each segment is LSN-ordered, so only one record per segment is
+// held at a time.
+type mergeIterator struct {
+	heads mergeHeap
+	iters []*SegmentIterator
+	cur   *Record
+	err   error
+}
+
+type mergeHead struct {
+	rec  *Record
+	iter *SegmentIterator
+}
+
+type mergeHeap []mergeHead
+
+func (h mergeHeap) Len() int           { return len(h) }
+func (h mergeHeap) Less(i, j int) bool { return lsnBefore(h[i].rec, h[j].rec) }
+func (h mergeHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *mergeHeap) Push(x any)        { *h = append(*h, x.(mergeHead)) }
+func (h *mergeHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// lsnBefore orders records by LSN, which readers rely on, with ties going to
+// the lower origin so merged output is deterministic
+func lsnBefore(a, b *Record) bool {
+	ka, kb := a.Key(), b.Key()
+	if ka.LSN != kb.LSN {
+		return ka.LSN < kb.LSN
+	}
+	return ka.Origin < kb.Origin
+}
+
+// newMergeIterator opens all segments and primes the heap
+func newMergeIterator(segments []SegmentInfo) (*mergeIterator, error) {
+	m := &mergeIterator{}
+	for _, seg := range segments {
+		iter, err := NewSegmentIterator(seg.Filename)
+		if err != nil {
+			m.Close()
+			return nil, fmt.Errorf("failed to open segment %s: %w", seg.Filename, err)
+		}
+		m.iters = append(m.iters, iter)
+		if head, ok := m.next(iter); ok {
+			m.heads = append(m.heads, head)
+		} else if m.err != nil {
+			m.Close()
+			return nil, m.err
+		}
+	}
+	heap.Init(&m.heads)
+	return m, nil
+}
+
+// next reads the iterator's next record, recording any read error
+func (m *mergeIterator) next(iter *SegmentIterator) (mergeHead, bool) {
+	if iter.Next() {
+		return mergeHead{rec: iter.Record(), iter: iter}, true
+	}
+	if err := iter.Err(); err != nil {
+		m.err = fmt.Errorf("error reading segment %s: %w", iter.filePath, err)
+	}
+	return mergeHead{}, false
+}
+
+// Next advances to the record with the lowest LSN across all segments
+func (m *mergeIterator) Next() bool {
+	if m.err != nil || m.heads.Len() == 0 {
+		return false
+	}
+	head := heap.Pop(&m.heads).(mergeHead)
+	m.cur = head.rec
+	if next, ok := m.next(head.iter); ok {
+		heap.Push(&m.heads, next)
+	}
+	return m.err == nil
+}
+
+// Record returns the current record
+func (m *mergeIterator) Record() *Record {
+	return m.cur
+}
+
+// Err returns the first read error, if any
+func (m *mergeIterator) Err() error {
+	return m.err
+}
+
+// Close closes all underlying segment iterators
+func (m *mergeIterator) Close() {
+	for _, iter := range m.iters {
+		_ = iter.Close()
+	}
+}
@@ -0,0 +1,136 @@
+package wal
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/dsjohal14/selfstack/internal/relay"
+)
+
+func TestMergeIteratorInterleavedSegments(t *testing.T) {
+	dir := t.TempDir()
+
+	// Two segments whose LSN ranges interleave
+	var segments []SegmentInfo
+	for i, lsns := range [][]uint64{{1, 4, 5}, {2, 3, 6}} {
+		path := filepath.Join(dir, SegmentFilename(uint64(i+1)))
+		writer, err := NewSegmentWriter(path)
+		if err != nil {
+			t.Fatalf("failed to create segment writer: %v", err)
+		}
+		for _, lsn := range lsns {
+			rec, _ := NewRecord(RecordTypeInsert, lsn, mustEncodeDocPayload(t, fmt.Sprintf("doc-%d", lsn%3), DocMetadata{}, relay.Embedding{}))
+			_ = writer.Write(rec)
+		}
+		_, _ = writer.Finalize()
+		_ = writer.Close()
+		segments = append(segments, SegmentInfo{SegmentID: uint64(i + 1), Filename: path})
+	}
+
+	it, err := newMergeIterator(segments)
+	if err != nil {
+		t.Fatalf("failed to create merge iterator: %v", err)
+	}
+	defer it.Close()
+
+	var got []uint64
+	for it.Next() {
+		got = append(got, it.Record().LSN)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("merge failed: %v", err)
+	}
+	if fmt.Sprint(got) != "[1 2 3 4 5 6]" {
+		t.Errorf("expected LSN order 1-6, got %v", got)
+	}
+
+	// Only the newest record per document survives
+	latest, err := latestLSNs(segments)
+	if err != nil {
+		t.Fatalf("failed to scan segments: %v", err)
+	}
+	out, _ := NewSegmentWriter(filepath.Join(dir, CompactedSegmentFilename(3)))
+	defer func() { _ = out.Close() }()
+	stats, err := writeMerged(segments, latest, out)
+	if err != nil {
+		t.Fatalf("failed to write merged segment: %v", err)
+	}
+	if stats.Records != 3 || stats.MinLSN != 4 || stats.MaxLSN != 6 {
+		t.Errorf("expected LSNs 4-6 to survive, got %+v", stats)
+	}
+}
+
+func TestWriteMergedKeepsKVEntries(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, SegmentFilename(1))
+	writer, err := NewSegmentWriter(path)
+	if err != nil {
+		t.Fatalf("failed to create segment writer: %v", err)
+	}
+	write := func(recType RecordType, lsn uint64, payload []byte) {
+		rec, _ := NewRecord(recType, lsn, payload)
+		_ = writer.Write(rec)
+	}
+	kv := func(key, value string) []byte {
+		payload, _ := EncodeKVPayload(key, []byte(value), false)
+		return payload
+	}
+	write(RecordTypeKV, 1, kv("cursor", "a"))
+	write(RecordTypeInsert, 2, mustEncodeDocPayload(t, "cursor", DocMetadata{}, relay.Embedding{})) // A document sharing the key
+	write(RecordTypeKV, 3, kv("cursor", "b"))
+	write(RecordTypeKV, 4, kv("version", "7"))
+	_, _ = writer.Finalize()
+	_ = writer.Close()
+	segments := []SegmentInfo{{SegmentID: 1, Filename: path}}
+
+	latest, err := latestLSNs(segments)
+	if err != nil {
+		t.Fatalf("failed to scan segments: %v", err)
+	}
+	out, _ := NewSegmentWriter(filepath.Join(dir, CompactedSegmentFilename(2)))
+	defer func() { _ = out.Close() }()
+	stats, err := writeMerged(segments, latest, out)
+	if err != nil {
+		t.Fatalf("failed to write merged segment: %v", err)
+	}
+	if stats.Records != 3 || stats.MinLSN != 2 || stats.MaxLSN != 4 {
+		t.Errorf("expected the document and the newest entry per key to survive, got %+v", stats)
+	}
+}
+
+func TestWriteMergedKeepsCollectionRecords(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, SegmentFilename(1))
+	writer, err := NewSegmentWriter(path)
+	if err != nil {
+		t.Fatalf("failed to create segment writer: %v", err)
+	}
+	write := func(recType RecordType, lsn uint64, name, config string) {
+		payload, _ := EncodeSchemaPayload(name, []byte(config))
+		rec, _ := NewRecord(recType, lsn, payload)
+		_ = writer.Write(rec)
+	}
+	write(RecordTypeCollection, 1, "notes", `{"v":1}`)
+	write(RecordTypeEmbedderChange, 2, "notes", `{"v":2}`)
+	write(RecordTypeCollection, 3, "notes", `{"v":3}`) // Supersedes 1, not the embedder change
+	write(RecordTypeCollection, 4, "mail", `{"v":1}`)
+	write(RecordTypeCollectionDelete, 5, "mail", "")
+	_, _ = writer.Finalize()
+	_ = writer.Close()
+	segments := []SegmentInfo{{SegmentID: 1, Filename: path}}
+
+	latest, err := latestLSNs(segments)
+	if err != nil {
+		t.Fatalf("failed to scan segments: %v", err)
+	}
+	out, _ := NewSegmentWriter(filepath.Join(dir, CompactedSegmentFilename(2)))
+	defer func() { _ = out.Close() }()
+	stats, err := writeMerged(segments, latest, out)
+	if err != nil {
+		t.Fatalf("failed to write merged segment: %v", err)
+	}
+	if stats.Records != 3 || stats.MinLSN != 2 || stats.MaxLSN != 5 {
+		t.Errorf("expected the embedder change, newest config, and delete to survive, got %+v", stats)
+	}
+}
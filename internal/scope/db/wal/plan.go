@@ -0,0 +1,209 @@
+package wal
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CompactionPlan describes what a compaction run would do without doing it
+type CompactionPlan struct {
+	Segments             []uint64         `json:"segments"`               // WAL segment IDs that would be merged
+	InputBytes           int64            `json:"input_bytes"`            // Total size of input segments
+	InputRecords         int              `json:"input_records"`          // Records read from input segments
+	LiveRecords          int              `json:"live_records"`           // Latest INSERT/UPDATE per document (kept)
+	Tombstones           int              `json:"tombstones"`             // Latest DELETE per document (kept to mask older segments)
+	SupersededRecords    int              `json:"superseded_records"`     // INSERT/UPDATE records replaced by a newer record (dropped)
+	TombstonesDropped    int              `json:"tombstones_dropped"`     // DELETE records replaced by a newer record (dropped)
+	CheckpointsDropped   int              `json:"checkpoints_dropped"`    // CHECKPOINT records (dropped)
+	EstimatedOutputBytes int64            `json:"estimated_output_bytes"` // Size of the compacted segment
+	BytesReclaimed       int64            `json:"bytes_reclaimed"`        // InputBytes - EstimatedOutputBytes
+	GarbageRatio         float64          `json:"garbage_ratio"`          // Dropped records / input records
+	SegmentGarbage       []SegmentGarbage `json:"segment_garbage"`        // Per-segment breakdown
+	WouldCompact         bool             `json:"would_compact"`          // False when below the compaction threshold
+	Reason               string           `json:"reason,omitempty"`       // Why WouldCompact is false
+}
+
+// SegmentGarbage is the live-vs-dead estimate for one input segment
+type SegmentGarbage struct {
+	SegmentID   uint64 `json:"segment_id"`
+	Records     int    `json:"records"`
+	DeadRecords int    `json:"dead_records"` // Superseded by a newer record, or a checkpoint
+}
+
+// Plan returns what the next scheduled compaction would do
+func (c *Compactor) Plan(ctx context.Context) (*CompactionPlan, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	plan, _, err := c.planLocked(ctx, false)
+	return plan, err
+}
+
+// PlanForce returns what ForceCompact would do
+func (c *Compactor) PlanForce(ctx context.Context) (*CompactionPlan, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	plan, _, err := c.planLocked(ctx, true)
+	return plan, err
+}
+
+// planLocked selects segments the same way Compact/ForceCompact do, scans
+// them, and decides whether compaction is worthwhile. Caller holds c.mu.
+func (c *Compactor) planLocked(ctx context.Context, force bool) (*CompactionPlan, []SegmentInfo, error) {
+	segments, err := c.manifest.GetSealedWALSegments(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get sealed WAL segments: %w", err)
+	}
+
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].SegmentID < segments[j].SegmentID
+	})
+
+	minSegments := c.config.MinSegmentsToCompact
+	switch {
+	case force:
+		minSegments = 2 // ForceCompact needs at least 2 WAL segments
+	case c.config.MinGarbageRatio > 0:
+		minSegments = 1 // Garbage ratio decides, even for a single segment
+	}
+	if !force && len(segments) > c.config.MaxSegmentsPerCompaction {
+		segments = segments[:c.config.MaxSegmentsPerCompaction]
+	}
+
+	if len(segments) < minSegments {
+		plan := &CompactionPlan{Segments: []uint64{}, SegmentGarbage: []SegmentGarbage{}}
+		plan.Reason = fmt.Sprintf("%d sealed WAL segment(s), need at least %d", len(segments), minSegments)
+		return plan, nil, nil
+	}
+
+	plan, err := c.scanCached(segments)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !force && c.config.MinGarbageRatio > 0 && plan.GarbageRatio < c.config.MinGarbageRatio {
+		plan.Reason = fmt.Sprintf("estimated garbage ratio %.2f below threshold %.2f", plan.GarbageRatio, c.config.MinGarbageRatio)
+		return plan, nil, nil
+	}
+
+	plan.WouldCompact = true
+	return plan, segments, nil
+}
+
+// scanCached returns a copy of the scan for the given segments. Sealed
+// segments are immutable, so the last result is reused while the set of
+// candidates is unchanged; this keeps the periodic check cheap.
+func (c *Compactor) scanCached(segments []SegmentInfo) (*CompactionPlan, error) {
+	ids := make([]string, len(segments))
+	for i, seg := range segments {
+		ids[i] = strconv.FormatUint(seg.SegmentID, 10)
+	}
+	key := strings.Join(ids, ",")
+
+	if c.lastScan == nil || c.lastScanKey != key {
+		plan := &CompactionPlan{}
+		if err := scanPlan(segments, plan); err != nil {
+			return nil, err
+		}
+		c.lastScan = plan
+		c.lastScanKey = key
+	}
+
+	plan := *c.lastScan
+	plan.Segments = append([]uint64(nil), c.lastScan.Segments...)
+	plan.SegmentGarbage = append([]SegmentGarbage(nil), c.lastScan.SegmentGarbage...)
+	return &plan, nil
+}
+
+// scanPlan reads the segments and fills in record and size estimates.
+// Only doc IDs, LSNs and record sizes are kept in memory.
+func scanPlan(segments []SegmentInfo, plan *CompactionPlan) error {
+	type latest struct {
+		lsn  uint64
+		size int64
+		seg  int // Index into plan.SegmentGarbage
+		del  bool
+	}
+	docs := make(map[string]latest)
+	plan.Segments = make([]uint64, 0, len(segments))
+	plan.SegmentGarbage = make([]SegmentGarbage, 0, len(segments))
+
+	for i, seg := range segments {
+		plan.Segments = append(plan.Segments, seg.SegmentID)
+		plan.SegmentGarbage = append(plan.SegmentGarbage, SegmentGarbage{SegmentID: seg.SegmentID})
+		segGarbage := &plan.SegmentGarbage[i]
+
+		iter, err := NewSegmentIterator(seg.Filename)
+		if err != nil {
+			return fmt.Errorf("failed to open segment %s: %w", seg.Filename, err)
+		}
+
+		for iter.Next() {
+			rec := iter.Record()
+			plan.InputRecords++
+			plan.InputBytes += int64(rec.DiskSize())
+			segGarbage.Records++
+
+			if rec.Type == RecordTypeCheckpoint {
+				plan.CheckpointsDropped++
+				segGarbage.DeadRecords++
+				continue
+			}
+			docID, ok, err := liveKey(rec)
+			if err != nil {
+				_ = iter.Close()
+				return fmt.Errorf("failed to decode record at LSN %d: %w", rec.LSN, err)
+			}
+			if !ok {
+				continue
+			}
+
+			prev, exists := docs[docID]
+			if exists && prev.lsn >= rec.LSN {
+				// Older record seen after a newer one; it is the one dropped
+				countDropped(plan, rec.Type == RecordTypeDelete)
+				segGarbage.DeadRecords++
+				continue
+			}
+			if exists {
+				countDropped(plan, prev.del)
+				plan.SegmentGarbage[prev.seg].DeadRecords++
+			}
+			docs[docID] = latest{lsn: rec.LSN, size: int64(rec.DiskSize()), seg: i, del: rec.Type == RecordTypeDelete}
+		}
+
+		if err := iter.Err(); err != nil {
+			_ = iter.Close()
+			return fmt.Errorf("error reading segment %s: %w", seg.Filename, err)
+		}
+		_ = iter.Close()
+	}
+
+	for _, d := range docs {
+		if d.del {
+			plan.Tombstones++
+		} else {
+			plan.LiveRecords++
+		}
+		plan.EstimatedOutputBytes += d.size
+	}
+	plan.BytesReclaimed = plan.InputBytes - plan.EstimatedOutputBytes
+	if plan.InputRecords > 0 {
+		dropped := plan.SupersededRecords + plan.TombstonesDropped + plan.CheckpointsDropped
+		plan.GarbageRatio = float64(dropped) / float64(plan.InputRecords)
+	}
+	return nil
+}
+
+// countDropped attributes a superseded record to the right counter
+func countDropped(plan *CompactionPlan, tombstone bool) {
+	if tombstone {
+		plan.TombstonesDropped++
+	} else {
+		plan.SupersededRecords++
+	}
+}
@@ -0,0 +1,134 @@
+package wal
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/dsjohal14/selfstack/internal/relay"
+)
+
+func TestCompactorPlan(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	manifest := NewInMemoryManifest()
+
+	writeSegment := func(segID uint64, recs ...*Record) {
+		path := filepath.Join(dir, SegmentFilename(segID))
+		writer, err := NewSegmentWriter(path)
+		if err != nil {
+			t.Fatalf("failed to create segment writer: %v", err)
+		}
+		for _, rec := range recs {
+			_ = writer.Write(rec)
+		}
+		checksum, _ := writer.Finalize()
+		_ = writer.Close()
+		_ = manifest.CreateSegment(ctx, segID, path)
+		_ = manifest.SealSegment(ctx, segID, checksum)
+	}
+
+	// Segment 1: insert doc-1, doc-2; segment 2: update doc-1, delete doc-2, checkpoint
+	rec1, _ := NewRecord(RecordTypeInsert, 1, mustEncodeDocPayload(t, "doc-1", DocMetadata{}, relay.Embedding{}))
+	rec2, _ := NewRecord(RecordTypeInsert, 2, mustEncodeDocPayload(t, "doc-2", DocMetadata{}, relay.Embedding{}))
+	rec3, _ := NewRecord(RecordTypeUpdate, 3, mustEncodeDocPayload(t, "doc-1", DocMetadata{Metadata: map[string]string{"v": "2"}}, relay.Embedding{}))
+	rec4, _ := NewRecord(RecordTypeDelete, 4, mustEncodeDeletePayload(t, "doc-2"))
+	rec5, _ := NewRecord(RecordTypeCheckpoint, 5, nil)
+
+	compactor := NewCompactor(manifest, nil, dir, DefaultCompactorConfig())
+
+	writeSegment(1, rec1, rec2)
+	plan, err := compactor.Plan(ctx)
+	if err != nil {
+		t.Fatalf("plan failed: %v", err)
+	}
+	if plan.WouldCompact || plan.Reason == "" {
+		t.Errorf("single segment should not be compacted, got %+v", plan)
+	}
+
+	writeSegment(2, rec3, rec4, rec5)
+	plan, err = compactor.Plan(ctx)
+	if err != nil {
+		t.Fatalf("plan failed: %v", err)
+	}
+
+	if !plan.WouldCompact {
+		t.Fatalf("expected compaction to be planned, reason: %s", plan.Reason)
+	}
+	if len(plan.Segments) != 2 {
+		t.Errorf("expected 2 segments, got %v", plan.Segments)
+	}
+	if plan.InputRecords != 5 {
+		t.Errorf("expected 5 input records, got %d", plan.InputRecords)
+	}
+	if plan.LiveRecords != 1 || plan.Tombstones != 1 {
+		t.Errorf("expected 1 live record and 1 tombstone, got %d and %d", plan.LiveRecords, plan.Tombstones)
+	}
+	if plan.SupersededRecords != 2 || plan.CheckpointsDropped != 1 {
+		t.Errorf("expected 2 superseded and 1 checkpoint dropped, got %d and %d", plan.SupersededRecords, plan.CheckpointsDropped)
+	}
+
+	wantOut := int64(rec3.TotalSize() + rec4.TotalSize())
+	if plan.EstimatedOutputBytes != wantOut {
+		t.Errorf("expected %d output bytes, got %d", wantOut, plan.EstimatedOutputBytes)
+	}
+	if plan.BytesReclaimed != plan.InputBytes-wantOut {
+		t.Errorf("bytes reclaimed mismatch: %d", plan.BytesReclaimed)
+	}
+
+	// Planning must not change the manifest
+	sealed, _ := manifest.GetSealedWALSegments(ctx)
+	if len(sealed) != 2 {
+		t.Errorf("plan should leave segments sealed, got %d", len(sealed))
+	}
+}
+
+func TestCompactorPlanGarbageRatio(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	manifest := NewInMemoryManifest()
+
+	// Three clean segments, one document each
+	for i := uint64(1); i <= 3; i++ {
+		writeSealedSegment(t, manifest, dir, i, fmt.Sprintf("doc-%d", i))
+	}
+
+	config := DefaultCompactorConfig()
+	config.MinGarbageRatio = 0.3
+	compactor := NewCompactor(manifest, nil, dir, config)
+
+	plan, err := compactor.Plan(ctx)
+	if err != nil {
+		t.Fatalf("plan failed: %v", err)
+	}
+	if plan.WouldCompact {
+		t.Errorf("clean segments should not be compacted, got ratio %.2f", plan.GarbageRatio)
+	}
+
+	// Forced plans ignore the ratio
+	plan, _ = compactor.PlanForce(ctx)
+	if !plan.WouldCompact {
+		t.Errorf("forced plan should compact, reason: %s", plan.Reason)
+	}
+
+	// Rewriting doc-1 and doc-2 supersedes the copies in segments 1 and 2
+	writeSealedSegment(t, manifest, dir, 4, "doc-1")
+	writeSealedSegment(t, manifest, dir, 5, "doc-2")
+
+	plan, err = compactor.Plan(ctx)
+	if err != nil {
+		t.Fatalf("plan failed: %v", err)
+	}
+	if !plan.WouldCompact || plan.GarbageRatio != 0.4 {
+		t.Errorf("expected compaction at ratio 0.4, got %v at %.2f", plan.WouldCompact, plan.GarbageRatio)
+	}
+
+	dead := map[uint64]int{}
+	for _, sg := range plan.SegmentGarbage {
+		dead[sg.SegmentID] = sg.DeadRecords
+	}
+	if dead[1] != 1 || dead[2] != 1 || dead[3] != 0 || dead[4] != 0 {
+		t.Errorf("unexpected per-segment garbage: %+v", plan.SegmentGarbage)
+	}
+}
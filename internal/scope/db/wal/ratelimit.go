@@ -0,0 +1,90 @@
+package wal
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimit caps how fast a WALWriter appends, so bulk writes like an
+// import leave disk bandwidth to the rest of the process. The zero value
+// is no limit.
+type RateLimit struct {
+	BytesPerSec int64 // Record bytes appended per second, before compression (0 = no limit)
+	Burst       int64 // Bytes that can be appended at once after a quiet spell (BytesPerSec if 0)
+}
+
+// Enabled reports whether the limit throttles appends
+func (l RateLimit) Enabled() bool {
+	return l.BytesPerSec > 0
+}
+
+// rateLimiter is a token bucket of bytes. An append takes its bytes even
+// when the bucket runs dry and waits until the debt is repaid, so a record
+// larger than the burst is still written and appends stay in order. A nil
+// rateLimiter doesn't limit.
+type rateLimiter struct {
+	mu     sync.Mutex
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+func newRateLimiter(limit RateLimit) *rateLimiter {
+	if !limit.Enabled() {
+		return nil
+	}
+	if limit.Burst <= 0 {
+		limit.Burst = limit.BytesPerSec
+	}
+	return &rateLimiter{limit: limit, tokens: float64(limit.Burst), last: time.Now(), now: time.Now}
+}
+
+// reserve takes n bytes from the bucket and returns how long the caller
+// must wait before writing them
+func (l *rateLimiter) reserve(n int) time.Duration {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	rate := float64(l.limit.BytesPerSec)
+	l.tokens = min(float64(l.limit.Burst), l.tokens+now.Sub(l.last).Seconds()*rate)
+	l.last = now
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / rate * float64(time.Second))
+}
+
+// encodedSize is the size of a record for payload as the writer stamps it,
+// before compression
+func encodedSize(payload []byte) int {
+	return HeaderSize + TimestampSize + len(payload) + 4
+}
+
+// requestsSize is the encodedSize of a batch of records
+func requestsSize(reqs []RecordRequest) int {
+	n := 0
+	for _, req := range reqs {
+		n += encodedSize(req.Payload)
+	}
+	return n
+}
+
+// throttle waits out the rate limit for n bytes. It's called before the
+// writer's lock is taken, so a throttled append holds up neither Sync nor
+// appends already admitted, and counts toward QueueDepth so load shedding
+// sees the backlog.
+func (w *WALWriter) throttle(call string, n int) {
+	wait := w.limiter.reserve(n)
+	if wait <= 0 {
+		return
+	}
+	walThrottles.WithLabel(call).Inc()
+	walThrottleSeconds.WithLabel(call).ObserveDuration(wait)
+	time.Sleep(wait)
+}
@@ -0,0 +1,64 @@
+package wal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	if newRateLimiter(RateLimit{}) != nil {
+		t.Fatal("expected no limiter for the zero limit")
+	}
+
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	l := newRateLimiter(RateLimit{BytesPerSec: 1000})
+	l.now = func() time.Time { return now }
+	l.last = now
+
+	// The burst defaults to a second's worth
+	if wait := l.reserve(1000); wait != 0 {
+		t.Errorf("expected the burst to pass, waited %v", wait)
+	}
+	// A dry bucket goes into debt rather than refusing
+	if wait := l.reserve(500); wait != 500*time.Millisecond {
+		t.Errorf("expected to wait 500ms, got %v", wait)
+	}
+	if wait := l.reserve(2000); wait != 2500*time.Millisecond {
+		t.Errorf("expected to wait behind the earlier debt, got %v", wait)
+	}
+
+	// Refilling stops at the burst
+	now = now.Add(time.Hour)
+	if wait := l.reserve(1000); wait != 0 {
+		t.Errorf("expected a full bucket after an hour, waited %v", wait)
+	}
+	if wait := l.reserve(100); wait != 100*time.Millisecond {
+		t.Errorf("expected the bucket capped at the burst, waited %v", wait)
+	}
+}
+
+func TestWALWriterRateLimit(t *testing.T) {
+	payload := make([]byte, 1000)
+	size := int64(encodedSize(payload))
+	writer, err := NewWALWriter(t.TempDir(), WithSyncPolicy(ImmediateSyncPolicy()),
+		WithRateLimit(RateLimit{BytesPerSec: 10 * size, Burst: size}))
+	if err != nil {
+		t.Fatalf("failed to create WAL writer: %v", err)
+	}
+	defer func() { _ = writer.Close() }()
+	if limit := writer.RateLimit(); limit.BytesPerSec != 10*size || limit.Burst != size {
+		t.Errorf("unexpected rate limit %+v", limit)
+	}
+
+	// The first record is the burst; the next three wait 100ms each
+	start := time.Now()
+	if _, err := writer.Append(RecordTypeInsert, payload); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	if _, err := writer.AppendBatch([]RecordRequest{{RecordTypeInsert, payload}, {RecordTypeInsert, payload}, {RecordTypeInsert, payload}}); err != nil {
+		t.Fatalf("failed to append batch: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond {
+		t.Errorf("expected the batch to be throttled for about 300ms, took %v", elapsed)
+	}
+}
@@ -1,6 +1,7 @@
 package wal
 
 import (
+	"bufio"
 	"encoding/binary"
 	"fmt"
 	"hash/crc32"
@@ -11,11 +12,34 @@ import (
 // SegmentIterator iterates over records in a WAL segment file
 type SegmentIterator struct {
 	file     *os.File
+	src      io.ReadSeeker // The records of file, before any footer
+	footer   *SegmentFooter
+	reader   *bufio.Reader
 	filePath string
 	offset   int64
 	record   *Record
 	err      error
 	fromLSN  uint64 // Skip records before this LSN (0 = read all)
+
+	header [HeaderSize]byte
+	crcBuf [4]byte
+	tsBuf  [TimestampSize]byte
+
+	// reuse makes Next overwrite the previous record and payload instead of
+	// allocating new ones; only for callers that never retain a Record
+	reuse   bool
+	scratch Record
+
+	// resync makes Next skip a corrupt record by scanning for the next
+	// header instead of stopping (see EnableResync)
+	resync  bool
+	resyncs int
+	skipped int64
+
+	// Of the last corrupt record skipped: whether its header checked out,
+	// and so whether its FlagBatch can be trusted
+	lostHeader  bool
+	lostInBatch bool
 }
 
 // NewSegmentIterator creates an iterator for the given segment file
@@ -29,21 +53,102 @@ func NewSegmentIteratorFromLSN(filePath string, fromLSN uint64) (*SegmentIterato
 	if err != nil {
 		return nil, fmt.Errorf("failed to open segment %s: %w", filePath, err)
 	}
+	footer, err := readFooter(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("failed to open segment %s: %w", filePath, err)
+	}
+	var src io.ReadSeeker = f
+	if footer != nil {
+		src = io.NewSectionReader(f, 0, footer.DataBytes)
+	}
 
 	return &SegmentIterator{
 		file:     f,
+		src:      src,
+		footer:   footer,
+		reader:   bufio.NewReaderSize(src, 64*1024),
 		filePath: filePath,
 		offset:   0,
 		fromLSN:  fromLSN,
 	}, nil
 }
 
+// EnableResync makes the iterator skip corrupt records instead of stopping
+// at the first one: after a record fails its CRC or magic check, it scans
+// forward for the next MagicBytes whose header checks out and carries on
+// from there. A record cut short by the end of the file still ends the
+// iteration with an error.
+func (it *SegmentIterator) EnableResync() {
+	it.resync = true
+}
+
+// Resyncs returns how many corrupt regions the iterator skipped
+func (it *SegmentIterator) Resyncs() int {
+	return it.resyncs
+}
+
+// SkippedBytes returns the size of the corrupt regions skipped
+func (it *SegmentIterator) SkippedBytes() int64 {
+	return it.skipped
+}
+
+// corrupt handles a corrupt record at the current offset, whose header is
+// valid if flags is non-nil. Without resync it sets err; with it, it moves
+// to the next record header and reports whether there is one.
+func (it *SegmentIterator) corrupt(err error, flags *RecordFlags) bool {
+	if !it.resync {
+		it.err = err
+		return false
+	}
+	it.resyncs++
+	it.lostHeader = flags != nil
+	it.lostInBatch = flags != nil && *flags&FlagBatch != 0
+	start := it.offset
+	if _, serr := it.src.Seek(start+1, io.SeekStart); serr != nil {
+		it.err = fmt.Errorf("failed to resync after %w: %v", err, serr)
+		return false
+	}
+	it.reader.Reset(it.src)
+
+	// A little-endian window over the last four bytes read
+	var window uint32
+	pos := start + 1
+	for {
+		b, rerr := it.reader.ReadByte()
+		if rerr != nil {
+			it.skipped += pos - start
+			it.offset = pos
+			if rerr != io.EOF {
+				it.err = fmt.Errorf("failed to resync after %w: %v", err, rerr)
+			}
+			return false
+		}
+		pos++
+		window = window>>8 | uint32(b)<<24
+		if pos-start >= 5 && window == MagicBytes {
+			break
+		}
+	}
+
+	// Headers that only look right fail their CRC and resync again
+	next := pos - 4
+	if _, serr := it.src.Seek(next, io.SeekStart); serr != nil {
+		it.err = fmt.Errorf("failed to resync after %w: %v", err, serr)
+		return false
+	}
+	it.reader.Reset(it.src)
+	it.skipped += next - start
+	it.offset = next
+	return true
+}
+
 // Next advances to the next record. Returns false when done or on error.
 func (it *SegmentIterator) Next() bool {
 	for {
 		// Read header
-		header := make([]byte, HeaderSize)
-		n, err := io.ReadFull(it.file, header)
+		header := it.header[:]
+		n, err := io.ReadFull(it.reader, header)
 		if err != nil {
 			if err == io.EOF {
 				return false // Normal end
@@ -59,34 +164,54 @@ func (it *SegmentIterator) Next() bool {
 		// Parse header fields
 		magic := binary.LittleEndian.Uint32(header[0:4])
 		if magic != MagicBytes {
-			it.err = fmt.Errorf("invalid magic at offset %d: expected 0x%X, got 0x%X", it.offset, MagicBytes, magic)
+			if it.corrupt(fmt.Errorf("invalid magic at offset %d: expected 0x%X, got 0x%X", it.offset, MagicBytes, magic), nil) {
+				continue
+			}
 			return false
 		}
 
 		recType := RecordType(header[4])
 		flags := RecordFlags(header[5])
-		reserved := binary.LittleEndian.Uint16(header[6:8])
+		origin := binary.LittleEndian.Uint16(header[6:8])
 		lsn := binary.LittleEndian.Uint64(header[8:16])
 		payloadLen := binary.LittleEndian.Uint32(header[16:20])
 		headerCRC := binary.LittleEndian.Uint32(header[20:24])
 
+		// Read the timestamp, which the header CRC covers
+		ts := it.tsBuf[:timestampLen(flags)]
+		if len(ts) > 0 {
+			if _, err := io.ReadFull(it.reader, ts); err != nil {
+				it.err = fmt.Errorf("failed to read timestamp at offset %d: %w", it.offset, err)
+				return false
+			}
+		}
+
 		// Verify header CRC
-		expectedHeaderCRC := crc32.ChecksumIEEE(header[0:20])
+		expectedHeaderCRC := headerChecksum(header[0:20], ts)
 		if headerCRC != expectedHeaderCRC {
-			it.err = fmt.Errorf("header CRC mismatch at offset %d: expected 0x%X, got 0x%X", it.offset, expectedHeaderCRC, headerCRC)
+			if it.corrupt(fmt.Errorf("header CRC mismatch at offset %d: expected 0x%X, got 0x%X", it.offset, expectedHeaderCRC, headerCRC), nil) {
+				continue
+			}
 			return false
 		}
 
 		// Sanity check payload length
 		if payloadLen > MaxPayloadSize {
-			it.err = fmt.Errorf("payload too large at offset %d: %d > %d", it.offset, payloadLen, MaxPayloadSize)
+			if it.corrupt(fmt.Errorf("payload too large at offset %d: %d > %d", it.offset, payloadLen, MaxPayloadSize), nil) {
+				continue
+			}
 			return false
 		}
 
 		// Read payload
-		payload := make([]byte, payloadLen)
+		var payload []byte
+		if it.reuse && cap(it.scratch.Payload) >= int(payloadLen) {
+			payload = it.scratch.Payload[:payloadLen]
+		} else {
+			payload = make([]byte, payloadLen)
+		}
 		if payloadLen > 0 {
-			n, err = io.ReadFull(it.file, payload)
+			n, err = io.ReadFull(it.reader, payload)
 			if err != nil {
 				it.err = fmt.Errorf("failed to read payload at offset %d: %w", it.offset, err)
 				return false
@@ -98,8 +223,8 @@ func (it *SegmentIterator) Next() bool {
 		}
 
 		// Read payload CRC
-		payloadCRCBuf := make([]byte, 4)
-		_, err = io.ReadFull(it.file, payloadCRCBuf)
+		payloadCRCBuf := it.crcBuf[:]
+		_, err = io.ReadFull(it.reader, payloadCRCBuf)
 		if err != nil {
 			it.err = fmt.Errorf("failed to read payload CRC at offset %d: %w", it.offset, err)
 			return false
@@ -109,25 +234,45 @@ func (it *SegmentIterator) Next() bool {
 		// Verify payload CRC
 		expectedPayloadCRC := crc32.ChecksumIEEE(payload)
 		if payloadCRC != expectedPayloadCRC {
-			it.err = fmt.Errorf("payload CRC mismatch at offset %d: expected 0x%X, got 0x%X", it.offset, expectedPayloadCRC, payloadCRC)
+			if it.corrupt(fmt.Errorf("payload CRC mismatch at offset %d: expected 0x%X, got 0x%X", it.offset, expectedPayloadCRC, payloadCRC), &flags) {
+				continue
+			}
 			return false
 		}
 
 		// Build record
-		it.record = &Record{
+		var timestamp HLC
+		if len(ts) > 0 {
+			timestamp = HLC(binary.LittleEndian.Uint64(ts))
+		}
+		rec := Record{
 			Magic:      magic,
 			Type:       recType,
 			Flags:      flags,
-			Reserved:   reserved,
+			Origin:     origin,
 			LSN:        lsn,
 			PayloadLen: payloadLen,
 			HeaderCRC:  headerCRC,
+			Timestamp:  timestamp,
 			Payload:    payload,
 			PayloadCRC: payloadCRC,
+			diskSize:   HeaderSize + len(ts) + int(payloadLen) + 4,
+		}
+		if err := rec.decompress(); err != nil {
+			if it.corrupt(fmt.Errorf("%w (offset %d)", err, it.offset), &flags) {
+				continue
+			}
+			return false
+		}
+		if it.reuse {
+			it.scratch = rec
+			it.record = &it.scratch
+		} else {
+			it.record = &rec
 		}
 
 		// Update offset
-		it.offset += int64(HeaderSize + payloadLen + 4)
+		it.offset += int64(HeaderSize+len(ts)) + int64(payloadLen) + 4
 
 		// Skip if before fromLSN
 		if it.fromLSN > 0 && lsn < it.fromLSN {
@@ -148,6 +293,12 @@ func (it *SegmentIterator) Err() error {
 	return it.err
 }
 
+// Footer returns the segment's footer, or nil if it has none. Iteration
+// stops where the footer starts.
+func (it *SegmentIterator) Footer() *SegmentFooter {
+	return it.footer
+}
+
 // Offset returns the current byte offset in the file
 func (it *SegmentIterator) Offset() int64 {
 	return it.offset
@@ -254,6 +405,11 @@ type SegmentWriter struct {
 	filePath string
 	offset   int64
 	checksum uint32
+	compress Compression // How payloads are compressed (see SetCompression)
+
+	records uint64 // Written so far, for the footer
+	minLSN  uint64
+	maxLSN  uint64
 }
 
 // NewSegmentWriter creates a new segment writer
@@ -271,8 +427,18 @@ func NewSegmentWriter(filePath string) (*SegmentWriter, error) {
 	}, nil
 }
 
+// SetCompression compresses the payloads of records written from now on
+func (sw *SegmentWriter) SetCompression(c Compression) {
+	sw.compress = c
+}
+
 // Write writes a record to the segment
 func (sw *SegmentWriter) Write(rec *Record) error {
+	if sw.compress != "" && sw.compress != CompressionNone {
+		c := *rec
+		c.compress(sw.compress)
+		rec = &c
+	}
 	data := rec.Encode()
 
 	n, err := sw.file.Write(data)
@@ -285,6 +451,26 @@ func (sw *SegmentWriter) Write(rec *Record) error {
 
 	sw.offset += int64(n)
 	sw.checksum = crc32.Update(sw.checksum, crc32.IEEETable, data)
+	if sw.records == 0 || rec.LSN < sw.minLSN {
+		sw.minLSN = rec.LSN
+	}
+	if rec.LSN > sw.maxLSN {
+		sw.maxLSN = rec.LSN
+	}
+	sw.records++
+	return nil
+}
+
+// WriteFooter seals the segment with a footer describing the records
+// written; nothing may be written after it
+func (sw *SegmentWriter) WriteFooter() error {
+	footer := SegmentFooter{Records: sw.records, MinLSN: sw.minLSN, MaxLSN: sw.maxLSN, DataBytes: sw.offset, DataCRC: sw.checksum}
+	data := footer.Encode()
+	if _, err := sw.file.Write(data); err != nil {
+		return fmt.Errorf("failed to write footer: %w", err)
+	}
+	sw.offset += int64(len(data))
+	sw.checksum = crc32.Update(sw.checksum, crc32.IEEETable, data)
 	return nil
 }
 
@@ -1,6 +1,7 @@
 package wal
 
 import (
+	"fmt"
 	"os"
 	"testing"
 )
@@ -290,3 +291,81 @@ func TestCorruptedSegment(t *testing.T) {
 		t.Log("Warning: corruption not detected (may depend on corruption location)")
 	}
 }
+
+// recordOffsets returns the offset each record in a segment starts at, and
+// the segment's size
+func recordOffsets(t *testing.T, path string) ([]int64, int64) {
+	t.Helper()
+	iter, err := NewSegmentIterator(path)
+	if err != nil {
+		t.Fatalf("failed to create iterator: %v", err)
+	}
+	defer func() { _ = iter.Close() }()
+	var offsets []int64
+	for start := iter.Offset(); iter.Next(); start = iter.Offset() {
+		offsets = append(offsets, start)
+	}
+	if err := iter.Err(); err != nil {
+		t.Fatalf("iterator error: %v", err)
+	}
+	return offsets, iter.Offset()
+}
+
+func TestSegmentIteratorResync(t *testing.T) {
+	dir := t.TempDir()
+	writer, err := NewWALWriter(dir, WithSyncPolicy(ImmediateSyncPolicy()))
+	if err != nil {
+		t.Fatalf("failed to create WAL writer: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		if _, err := writer.Append(RecordTypeInsert, []byte("test payload")); err != nil {
+			t.Fatalf("failed to append record %d: %v", i, err)
+		}
+	}
+	_ = writer.Close()
+	path := writer.segmentPath(1)
+	offsets, size := recordOffsets(t, path)
+
+	// Corrupt the payload of record 4 (LSN 4) and the magic of record 7
+	data, _ := os.ReadFile(path)
+	data[offsets[3]+HeaderSize+TimestampSize] ^= 0xFF
+	data[offsets[6]] ^= 0xFF
+	// A torn tail: half of a record's header
+	data = append(data, data[offsets[0]:offsets[0]+HeaderSize/2]...)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	read := func(resync bool) ([]uint64, *SegmentIterator) {
+		iter, err := NewSegmentIterator(path)
+		if err != nil {
+			t.Fatalf("failed to create iterator: %v", err)
+		}
+		t.Cleanup(func() { _ = iter.Close() })
+		if resync {
+			iter.EnableResync()
+		}
+		var lsns []uint64
+		for iter.Next() {
+			lsns = append(lsns, iter.Record().LSN)
+		}
+		return lsns, iter
+	}
+
+	if lsns, iter := read(false); len(lsns) != 3 || iter.Err() == nil {
+		t.Errorf("expected to stop with an error after 3 records, got %v, %v", lsns, iter.Err())
+	}
+
+	lsns, iter := read(true)
+	want := []uint64{1, 2, 3, 5, 6, 8, 9, 10}
+	if fmt.Sprint(lsns) != fmt.Sprint(want) {
+		t.Errorf("expected LSNs %v, got %v", want, lsns)
+	}
+	recordSize := offsets[1] - offsets[0]
+	if iter.Resyncs() != 2 || iter.SkippedBytes() != 2*recordSize {
+		t.Errorf("expected 2 regions of %d bytes skipped, got %d of %d bytes", recordSize, iter.Resyncs(), iter.SkippedBytes())
+	}
+	if iter.Err() == nil || iter.Offset() != size {
+		t.Errorf("expected the torn tail at offset %d to end with an error, got %v at %d", size, iter.Err(), iter.Offset())
+	}
+}
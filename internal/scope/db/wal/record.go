@@ -7,20 +7,23 @@ import (
 	"encoding/json"
 	"fmt"
 	"hash/crc32"
+	"math"
 	"time"
 
 	"github.com/dsjohal14/selfstack/internal/relay"
 )
 
-// WAL Record Format (24-byte header + payload):
+// WAL Record Format (24-byte header, optional timestamp, payload):
 // ┌─────────────────────────────────────────────────────────────┐
-// │ Magic (4B)  │ Type (1B) │ Flags (1B) │ Reserved (2B)        │
+// │ Magic (4B)  │ Type (1B) │ Flags (1B) │ Origin (2B)          │
 // ├─────────────────────────────────────────────────────────────┤
 // │ LSN (8B, uint64) - Log Sequence Number                      │
 // ├─────────────────────────────────────────────────────────────┤
 // │ PayloadLen (4B, uint32)                                     │
 // ├─────────────────────────────────────────────────────────────┤
-// │ HeaderCRC32 (4B) - checksum of bytes [0:20]                 │
+// │ HeaderCRC32 (4B) - checksum of bytes [0:20] and Timestamp   │
+// ├─────────────────────────────────────────────────────────────┤
+// │ Timestamp (8B, HLC) - only when FlagTimestamp is set        │
 // ├─────────────────────────────────────────────────────────────┤
 // │ Payload (variable) - Document data                          │
 // ├─────────────────────────────────────────────────────────────┤
@@ -34,6 +37,10 @@ const (
 	// HeaderSize is the fixed size of the record header
 	HeaderSize = 24
 
+	// TimestampSize is the size of the HLC timestamp that follows the header
+	// of timestamped records
+	TimestampSize = 8
+
 	// EmbeddingSize is the fixed size of a 128-dim float32 embedding
 	EmbeddingSize = relay.EmbeddingDim * 4 // 512 bytes
 
@@ -53,6 +60,11 @@ const (
 	RecordTypeUpdate     RecordType = 0x02 // Replace existing doc
 	RecordTypeDelete     RecordType = 0x03 // Tombstone marker
 	RecordTypeCheckpoint RecordType = 0x04 // Marks flushed position
+	RecordTypeKV         RecordType = 0x05 // Sets or deletes an internal key-value entry
+
+	RecordTypeCollection       RecordType = 0x06 // Creates or changes a collection
+	RecordTypeCollectionDelete RecordType = 0x07 // Deletes a collection
+	RecordTypeEmbedderChange   RecordType = 0x08 // Changes a collection's embedding model
 )
 
 func (r RecordType) String() string {
@@ -65,6 +77,14 @@ func (r RecordType) String() string {
 		return "DELETE"
 	case RecordTypeCheckpoint:
 		return "CHECKPOINT"
+	case RecordTypeKV:
+		return "KV"
+	case RecordTypeCollection:
+		return "COLLECTION"
+	case RecordTypeCollectionDelete:
+		return "COLLECTION_DELETE"
+	case RecordTypeEmbedderChange:
+		return "EMBEDDER_CHANGE"
 	default:
 		return fmt.Sprintf("UNKNOWN(%d)", r)
 	}
@@ -76,7 +96,10 @@ type RecordFlags uint8
 // Record flag values
 const (
 	FlagNone       RecordFlags = 0x00
-	FlagCompressed RecordFlags = 0x01 // Payload is compressed (future use)
+	FlagCompressed RecordFlags = 0x01 // Payload is compressed; its first byte names the codec
+	FlagOrigin     RecordFlags = 0x02 // Origin holds the ID of the node that wrote the record
+	FlagTimestamp  RecordFlags = 0x04 // An HLC timestamp follows the header
+	FlagBatch      RecordFlags = 0x08 // More records of the same atomic batch follow
 )
 
 // Record represents a WAL record with header and payload
@@ -84,12 +107,15 @@ type Record struct {
 	Magic      uint32
 	Type       RecordType
 	Flags      RecordFlags
-	Reserved   uint16
+	Origin     uint16 // Writing node's ID when FlagOrigin is set (formerly reserved, always 0)
 	LSN        uint64
 	PayloadLen uint32
 	HeaderCRC  uint32
+	Timestamp  HLC // When FlagTimestamp is set
 	Payload    []byte
 	PayloadCRC uint32
+
+	diskSize int // Bytes it took where it was read from, compressed; 0 if not read
 }
 
 // DocPayload represents the payload for INSERT/UPDATE records
@@ -106,6 +132,10 @@ type DocMetadata struct {
 	Text      string            `json:"text"`
 	Metadata  map[string]string `json:"metadata,omitempty"`
 	CreatedAt time.Time         `json:"created_at"`
+
+	Collection string `json:"collection,omitempty"` // Empty for records written before collections
+
+	OpID string `json:"op_id,omitempty"` // Client-supplied ID of the operation that wrote it, for deduplicating retries
 }
 
 // NewRecord creates a new WAL record with the given type and payload
@@ -118,7 +148,7 @@ func NewRecord(recType RecordType, lsn uint64, payload []byte) (*Record, error)
 		Magic:      MagicBytes,
 		Type:       recType,
 		Flags:      FlagNone,
-		Reserved:   0,
+		Origin:     0,
 		LSN:        lsn,
 		PayloadLen: uint32(len(payload)),
 		Payload:    payload,
@@ -133,36 +163,147 @@ func NewRecord(recType RecordType, lsn uint64, payload []byte) (*Record, error)
 	return rec, nil
 }
 
-// calculateHeaderCRC computes CRC32 of header bytes [0:20]
+// SetOrigin attributes the record to node and updates the header CRC
+func (r *Record) SetOrigin(node uint16) {
+	r.Origin = node
+	r.Flags |= FlagOrigin
+	r.HeaderCRC = r.calculateHeaderCRC()
+}
+
+// OriginNode returns the ID of the node that wrote the record, or false for
+// records written without one
+func (r *Record) OriginNode() (uint16, bool) {
+	return r.Origin, r.Flags&FlagOrigin != 0
+}
+
+// SetTimestamp records when the record was written and updates the header CRC
+func (r *Record) SetTimestamp(ts HLC) {
+	r.Timestamp = ts
+	r.Flags |= FlagTimestamp
+	r.HeaderCRC = r.calculateHeaderCRC()
+}
+
+// TimestampHLC returns when the record was written, or false for records
+// written without a timestamp
+func (r *Record) TimestampHLC() (HLC, bool) {
+	return r.Timestamp, r.Flags&FlagTimestamp != 0
+}
+
+// InBatch reports whether more records of the record's atomic batch follow
+func (r *Record) InBatch() bool {
+	return r.Flags&FlagBatch != 0
+}
+
+// clone copies the record and its payload
+func (r *Record) clone() *Record {
+	c := *r
+	c.Payload = append([]byte(nil), r.Payload...)
+	return &c
+}
+
+// setBatch marks that more records of the same batch follow, or clears the
+// mark, and updates the header CRC
+func (r *Record) setBatch(more bool) {
+	if more {
+		r.Flags |= FlagBatch
+	} else {
+		r.Flags &^= FlagBatch
+	}
+	r.HeaderCRC = r.calculateHeaderCRC()
+}
+
+// AppliedAt returns the wall-clock time the record was written to the WAL,
+// which unlike DocMetadata.CreatedAt is set by the writer, or false for
+// records written without a timestamp
+func (r *Record) AppliedAt() (time.Time, bool) {
+	ts, ok := r.TimestampHLC()
+	if !ok {
+		return time.Time{}, false
+	}
+	return ts.Wall(), true
+}
+
+// RecordKey identifies a record across the WAL streams of several nodes.
+// LSNs are only unique per node, so a merged stream can hold the same LSN
+// from different origins, and the same key twice only when a record was
+// copied (e.g. replicated and then restored).
+type RecordKey struct {
+	Origin uint16 // 0 for unattributed records
+	LSN    uint64
+}
+
+// Key returns the record's cross-node identity
+func (r *Record) Key() RecordKey {
+	origin, _ := r.OriginNode()
+	return RecordKey{Origin: origin, LSN: r.LSN}
+}
+
+// Supersedes reports whether a wins over b when both change the same
+// document in merged streams: the later timestamp wins when both records
+// have one, then the higher LSN, and remaining ties go to the higher origin.
+// This is deterministic, so every node resolving the same records picks the
+// same winner. Timestamps order writes across nodes; LSNs only within one.
+func Supersedes(a, b *Record) bool {
+	if at, ok := a.TimestampHLC(); ok {
+		if bt, ok := b.TimestampHLC(); ok && at != bt {
+			return at > bt
+		}
+	}
+	if a.LSN != b.LSN {
+		return a.LSN > b.LSN
+	}
+	return a.Key().Origin > b.Key().Origin
+}
+
+// calculateHeaderCRC computes CRC32 of header bytes [0:20] and the timestamp
 func (r *Record) calculateHeaderCRC() uint32 {
-	buf := make([]byte, 20)
+	buf := make([]byte, 20+TimestampSize)
 	binary.LittleEndian.PutUint32(buf[0:4], r.Magic)
 	buf[4] = byte(r.Type)
 	buf[5] = byte(r.Flags)
-	binary.LittleEndian.PutUint16(buf[6:8], r.Reserved)
+	binary.LittleEndian.PutUint16(buf[6:8], r.Origin)
 	binary.LittleEndian.PutUint64(buf[8:16], r.LSN)
 	binary.LittleEndian.PutUint32(buf[16:20], r.PayloadLen)
-	return crc32.ChecksumIEEE(buf)
+	binary.LittleEndian.PutUint64(buf[20:], uint64(r.Timestamp))
+	return headerChecksum(buf[0:20], buf[20:20+timestampLen(r.Flags)])
+}
+
+// headerChecksum computes the header CRC from header bytes [0:20] and the
+// timestamp that follows the header (empty for records without one)
+func headerChecksum(header, ts []byte) uint32 {
+	return crc32.Update(crc32.ChecksumIEEE(header), crc32.IEEETable, ts)
+}
+
+// timestampLen returns the size of the timestamp after the header
+func timestampLen(flags RecordFlags) int {
+	if flags&FlagTimestamp != 0 {
+		return TimestampSize
+	}
+	return 0
 }
 
 // Encode serializes the record to bytes
 func (r *Record) Encode() []byte {
-	buf := make([]byte, HeaderSize+len(r.Payload)+4) // header + payload + payload CRC
+	tsLen := timestampLen(r.Flags)
+	buf := make([]byte, HeaderSize+tsLen+len(r.Payload)+4) // header + timestamp + payload + payload CRC
 
 	// Header
 	binary.LittleEndian.PutUint32(buf[0:4], r.Magic)
 	buf[4] = byte(r.Type)
 	buf[5] = byte(r.Flags)
-	binary.LittleEndian.PutUint16(buf[6:8], r.Reserved)
+	binary.LittleEndian.PutUint16(buf[6:8], r.Origin)
 	binary.LittleEndian.PutUint64(buf[8:16], r.LSN)
 	binary.LittleEndian.PutUint32(buf[16:20], r.PayloadLen)
 	binary.LittleEndian.PutUint32(buf[20:24], r.HeaderCRC)
+	if tsLen > 0 {
+		binary.LittleEndian.PutUint64(buf[HeaderSize:], uint64(r.Timestamp))
+	}
 
 	// Payload
-	copy(buf[HeaderSize:], r.Payload)
+	copy(buf[HeaderSize+tsLen:], r.Payload)
 
 	// Payload CRC
-	binary.LittleEndian.PutUint32(buf[HeaderSize+len(r.Payload):], r.PayloadCRC)
+	binary.LittleEndian.PutUint32(buf[HeaderSize+tsLen+len(r.Payload):], r.PayloadCRC)
 
 	return buf
 }
@@ -177,7 +318,7 @@ func DecodeRecord(data []byte) (*Record, error) {
 		Magic:      binary.LittleEndian.Uint32(data[0:4]),
 		Type:       RecordType(data[4]),
 		Flags:      RecordFlags(data[5]),
-		Reserved:   binary.LittleEndian.Uint16(data[6:8]),
+		Origin:     binary.LittleEndian.Uint16(data[6:8]),
 		LSN:        binary.LittleEndian.Uint64(data[8:16]),
 		PayloadLen: binary.LittleEndian.Uint32(data[16:20]),
 		HeaderCRC:  binary.LittleEndian.Uint32(data[20:24]),
@@ -188,6 +329,15 @@ func DecodeRecord(data []byte) (*Record, error) {
 		return nil, fmt.Errorf("invalid magic: expected 0x%X, got 0x%X", MagicBytes, rec.Magic)
 	}
 
+	// Read the timestamp, which the header CRC covers
+	tsLen := timestampLen(rec.Flags)
+	if len(data) < HeaderSize+tsLen {
+		return nil, fmt.Errorf("data too short for timestamp: %d < %d", len(data), HeaderSize+tsLen)
+	}
+	if tsLen > 0 {
+		rec.Timestamp = HLC(binary.LittleEndian.Uint64(data[HeaderSize:]))
+	}
+
 	// Verify header CRC
 	expectedHeaderCRC := rec.calculateHeaderCRC()
 	if rec.HeaderCRC != expectedHeaderCRC {
@@ -195,28 +345,45 @@ func DecodeRecord(data []byte) (*Record, error) {
 	}
 
 	// Check payload length
-	totalLen := HeaderSize + int(rec.PayloadLen) + 4 // +4 for payload CRC
+	start := HeaderSize + tsLen
+	totalLen := start + int(rec.PayloadLen) + 4 // +4 for payload CRC
 	if len(data) < totalLen {
 		return nil, fmt.Errorf("data too short for payload: %d < %d", len(data), totalLen)
 	}
 
 	// Extract payload
 	rec.Payload = make([]byte, rec.PayloadLen)
-	copy(rec.Payload, data[HeaderSize:HeaderSize+rec.PayloadLen])
+	copy(rec.Payload, data[start:start+int(rec.PayloadLen)])
 
 	// Extract and verify payload CRC
-	rec.PayloadCRC = binary.LittleEndian.Uint32(data[HeaderSize+rec.PayloadLen : totalLen])
+	rec.PayloadCRC = binary.LittleEndian.Uint32(data[start+int(rec.PayloadLen) : totalLen])
 	expectedPayloadCRC := crc32.ChecksumIEEE(rec.Payload)
 	if rec.PayloadCRC != expectedPayloadCRC {
 		return nil, fmt.Errorf("payload CRC mismatch: expected 0x%X, got 0x%X", expectedPayloadCRC, rec.PayloadCRC)
 	}
 
+	// The CRCs cover the payload as stored
+	rec.diskSize = totalLen
+	if err := rec.decompress(); err != nil {
+		return nil, err
+	}
+
 	return rec, nil
 }
 
 // TotalSize returns the total size of the encoded record
 func (r *Record) TotalSize() int {
-	return HeaderSize + int(r.PayloadLen) + 4
+	return HeaderSize + timestampLen(r.Flags) + int(r.PayloadLen) + 4
+}
+
+// DiskSize returns the bytes the record took in the segment it was read
+// from, which is less than TotalSize for a record stored compressed.
+// Records not read from a segment return TotalSize.
+func (r *Record) DiskSize() int {
+	if r.diskSize > 0 {
+		return r.diskSize
+	}
+	return r.TotalSize()
 }
 
 // VerifyChecksums validates both header and payload CRCs
@@ -322,6 +489,68 @@ func DecodeDocPayload(data []byte) (string, DocMetadata, relay.Embedding, error)
 	return docID, meta, embedding, nil
 }
 
+// DecodePayloadDocID returns the DocID of an INSERT/UPDATE/DELETE payload
+// without decoding metadata or the embedding. Both payload kinds start with
+// the length-prefixed DocID.
+func DecodePayloadDocID(data []byte) (string, error) {
+	id, err := payloadDocID(data)
+	if err != nil {
+		return "", err
+	}
+	return string(id), nil
+}
+
+// payloadDocID returns the DocID bytes of a payload without copying
+func payloadDocID(data []byte) ([]byte, error) {
+	if len(data) < 2 {
+		return nil, fmt.Errorf("payload too short: %d", len(data))
+	}
+	docIDLen := int(binary.LittleEndian.Uint16(data[0:2]))
+	if len(data) < 2+docIDLen {
+		return nil, fmt.Errorf("payload too short for docID: %d < %d", len(data), 2+docIDLen)
+	}
+	return data[2 : 2+docIDLen], nil
+}
+
+// decodeDocPayloadInto decodes an INSERT/UPDATE payload straight into dst.
+// Unlike DecodeDocPayload it avoids reflection and intermediate buffers; the
+// payload may be reused by the caller afterwards.
+func decodeDocPayloadInto(data []byte, dst *RecoveredDoc) error {
+	id, err := payloadDocID(data)
+	if err != nil {
+		return err
+	}
+	rest := data[2+len(id):]
+
+	if len(rest) < 4 {
+		return fmt.Errorf("failed to read metadata length: payload too short")
+	}
+	metaLen := int(binary.LittleEndian.Uint32(rest[0:4]))
+	rest = rest[4:]
+	if len(rest) < metaLen+EmbeddingSize {
+		return fmt.Errorf("payload too short for metadata and embedding: %d < %d", len(rest), metaLen+EmbeddingSize)
+	}
+
+	var meta DocMetadata
+	if err := json.Unmarshal(rest[:metaLen], &meta); err != nil {
+		return fmt.Errorf("failed to unmarshal metadata: %w", err)
+	}
+	rest = rest[metaLen:]
+
+	dst.DocID = string(id)
+	dst.Source = meta.Source
+	dst.Title = meta.Title
+	dst.Text = meta.Text
+	dst.Metadata = meta.Metadata
+	dst.CreatedAt = meta.CreatedAt
+	dst.Collection = meta.Collection
+	dst.OpID = meta.OpID
+	for i := range dst.Embedding {
+		dst.Embedding[i] = math.Float32frombits(binary.LittleEndian.Uint32(rest[i*4:]))
+	}
+	return nil
+}
+
 // EncodeDeletePayload serializes a delete payload (just the DocID)
 func EncodeDeletePayload(docID string) ([]byte, error) {
 	if len(docID) > MaxDocIDLen {
@@ -336,6 +565,55 @@ func EncodeDeletePayload(docID string) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+// EncodeDeletePayloadWithInfo serializes a delete payload followed by when
+// and by whom the document was deleted:
+// [docIDLen:2][docID][deletedAt unix nanos:8][deletedByLen:2][deletedBy].
+// Readers that only want the DocID ignore the trailer.
+func EncodeDeletePayloadWithInfo(docID string, info DeleteInfo) ([]byte, error) {
+	if len(info.DeletedBy) > MaxDocIDLen {
+		return nil, fmt.Errorf("deletedBy too long: %d > %d", len(info.DeletedBy), MaxDocIDLen)
+	}
+	payload, err := EncodeDeletePayload(docID)
+	if err != nil {
+		return nil, err
+	}
+
+	var deletedAt int64
+	if !info.DeletedAt.IsZero() {
+		deletedAt = info.DeletedAt.UnixNano()
+	}
+	payload = binary.LittleEndian.AppendUint64(payload, uint64(deletedAt))
+	payload = binary.LittleEndian.AppendUint16(payload, uint16(len(info.DeletedBy)))
+	return append(payload, info.DeletedBy...), nil
+}
+
+// DecodeDeleteInfo returns the trailer of a delete payload, or a zero
+// DeleteInfo for tombstones written without one
+func DecodeDeleteInfo(data []byte) (DeleteInfo, error) {
+	id, err := payloadDocID(data)
+	if err != nil {
+		return DeleteInfo{}, err
+	}
+	rest := data[2+len(id):]
+	if len(rest) == 0 {
+		return DeleteInfo{}, nil
+	}
+	if len(rest) < 10 {
+		return DeleteInfo{}, fmt.Errorf("delete info too short: %d", len(rest))
+	}
+
+	var info DeleteInfo
+	if nanos := int64(binary.LittleEndian.Uint64(rest[0:8])); nanos != 0 {
+		info.DeletedAt = time.Unix(0, nanos).UTC()
+	}
+	byLen := int(binary.LittleEndian.Uint16(rest[8:10]))
+	if len(rest) < 10+byLen {
+		return DeleteInfo{}, fmt.Errorf("delete info too short for deletedBy: %d < %d", len(rest), 10+byLen)
+	}
+	info.DeletedBy = string(rest[10 : 10+byLen])
+	return info, nil
+}
+
 // DecodeDeletePayload deserializes a delete payload
 func DecodeDeletePayload(data []byte) (string, error) {
 	if len(data) < 2 {
@@ -363,6 +641,34 @@ func EncodeCheckpointPayload(checkpointLSN uint64) ([]byte, error) {
 	return buf, nil
 }
 
+// IndexDigest summarizes the documents of an index: how many there are and
+// a sum of per-document hashes, which doesn't depend on the order they
+// were indexed in, so an index rebuilt by recovery can be checked against
+// the one a checkpoint was taken of
+type IndexDigest struct {
+	Docs uint64
+	Sum  uint64
+}
+
+// EncodeCheckpointDigest serializes a checkpoint payload that records the
+// index digest as of the checkpoint after its LSN
+func EncodeCheckpointDigest(checkpointLSN uint64, d IndexDigest) []byte {
+	buf := make([]byte, 24)
+	binary.LittleEndian.PutUint64(buf, checkpointLSN)
+	binary.LittleEndian.PutUint64(buf[8:], d.Docs)
+	binary.LittleEndian.PutUint64(buf[16:], d.Sum)
+	return buf
+}
+
+// DecodeCheckpointDigest returns the index digest in a checkpoint payload,
+// or false for checkpoints written without one
+func DecodeCheckpointDigest(data []byte) (IndexDigest, bool) {
+	if len(data) < 24 {
+		return IndexDigest{}, false
+	}
+	return IndexDigest{Docs: binary.LittleEndian.Uint64(data[8:]), Sum: binary.LittleEndian.Uint64(data[16:])}, true
+}
+
 // DecodeCheckpointPayload deserializes a checkpoint payload
 func DecodeCheckpointPayload(data []byte) (uint64, error) {
 	if len(data) < 8 {
@@ -370,3 +676,42 @@ func DecodeCheckpointPayload(data []byte) (uint64, error) {
 	}
 	return binary.LittleEndian.Uint64(data), nil
 }
+
+// KV payload flags
+const (
+	kvSet    byte = 0x00
+	kvDelete byte = 0x01
+)
+
+// EncodeKVPayload serializes a KV payload: the length-prefixed key (laid out
+// like a DocID), a set/delete flag, and the value
+func EncodeKVPayload(key string, value []byte, deleted bool) ([]byte, error) {
+	if key == "" || len(key) > MaxDocIDLen {
+		return nil, fmt.Errorf("invalid key length: %d", len(key))
+	}
+	buf := make([]byte, 2+len(key)+1+len(value))
+	binary.LittleEndian.PutUint16(buf, uint16(len(key)))
+	copy(buf[2:], key)
+	buf[2+len(key)] = kvSet
+	if deleted {
+		buf[2+len(key)] = kvDelete
+	}
+	copy(buf[3+len(key):], value)
+	return buf, nil
+}
+
+// DecodeKVPayload deserializes a KV payload. The value is a copy.
+func DecodeKVPayload(data []byte) (key string, value []byte, deleted bool, err error) {
+	id, err := payloadDocID(data)
+	if err != nil {
+		return "", nil, false, err
+	}
+	rest := data[2+len(id):]
+	if len(rest) < 1 {
+		return "", nil, false, fmt.Errorf("KV payload too short for flag")
+	}
+	if rest[0] == kvDelete {
+		return string(id), nil, true, nil
+	}
+	return string(id), append([]byte{}, rest[1:]...), false, nil
+}
@@ -164,6 +164,29 @@ func TestDeletePayloadEncodeDecode(t *testing.T) {
 	}
 }
 
+func TestDeletePayloadWithInfo(t *testing.T) {
+	info := DeleteInfo{DeletedAt: time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC), DeletedBy: "alice"}
+	payload, err := EncodeDeletePayloadWithInfo("doc-1", info)
+	if err != nil {
+		t.Fatalf("failed to encode delete payload: %v", err)
+	}
+
+	// Readers that only want the DocID still work
+	if id, err := DecodeDeletePayload(payload); err != nil || id != "doc-1" {
+		t.Errorf("expected doc-1, got %q (%v)", id, err)
+	}
+	got, err := DecodeDeleteInfo(payload)
+	if err != nil || !got.DeletedAt.Equal(info.DeletedAt) || got.DeletedBy != "alice" {
+		t.Errorf("expected %+v, got %+v (%v)", info, got, err)
+	}
+
+	// Tombstones written before the trailer existed have no info
+	legacy, _ := EncodeDeletePayload("doc-1")
+	if got, err := DecodeDeleteInfo(legacy); err != nil || !got.DeletedAt.IsZero() || got.DeletedBy != "" {
+		t.Errorf("expected zero info for a legacy tombstone, got %+v (%v)", got, err)
+	}
+}
+
 func TestCheckpointPayloadEncodeDecode(t *testing.T) {
 	checkpointLSN := uint64(12345)
 
@@ -184,6 +207,64 @@ func TestCheckpointPayloadEncodeDecode(t *testing.T) {
 	}
 }
 
+func TestCheckpointDigestPayload(t *testing.T) {
+	want := IndexDigest{Docs: 3, Sum: 0xdeadbeef}
+	payload := EncodeCheckpointDigest(42, want)
+	if lsn, err := DecodeCheckpointPayload(payload); err != nil || lsn != 42 {
+		t.Errorf("expected the LSN to decode as before, got %d (%v)", lsn, err)
+	}
+	if got, ok := DecodeCheckpointDigest(payload); !ok || got != want {
+		t.Errorf("expected %+v, got %+v (%v)", want, got, ok)
+	}
+
+	// Checkpoints written before digests have none
+	legacy, _ := EncodeCheckpointPayload(42)
+	if _, ok := DecodeCheckpointDigest(legacy); ok {
+		t.Error("expected no digest in a legacy checkpoint")
+	}
+}
+
+func TestKVPayloadEncodeDecode(t *testing.T) {
+	payload, err := EncodeKVPayload("flags/beta", []byte(`{"on":true}`), false)
+	if err != nil {
+		t.Fatalf("failed to encode KV payload: %v", err)
+	}
+	key, value, deleted, err := DecodeKVPayload(payload)
+	if err != nil || key != "flags/beta" || string(value) != `{"on":true}` || deleted {
+		t.Errorf("unexpected decode: %q %q %v %v", key, value, deleted, err)
+	}
+	if id, _ := DecodePayloadDocID(payload); id != "flags/beta" {
+		t.Errorf("expected the key where a DocID would be, got %q", id)
+	}
+
+	payload, _ = EncodeKVPayload("flags/beta", nil, true)
+	if key, _, deleted, err := DecodeKVPayload(payload); err != nil || key != "flags/beta" || !deleted {
+		t.Errorf("expected a delete of flags/beta, got %q %v %v", key, deleted, err)
+	}
+	if _, err := EncodeKVPayload("", nil, false); err == nil {
+		t.Error("expected an error for an empty key")
+	}
+}
+
+func TestSchemaPayloadEncodeDecode(t *testing.T) {
+	payload, err := EncodeSchemaPayload("notes", []byte(`{"embedder":"hashing"}`))
+	if err != nil {
+		t.Fatalf("failed to encode collection payload: %v", err)
+	}
+	name, config, err := DecodeSchemaPayload(payload)
+	if err != nil || name != "notes" || string(config) != `{"embedder":"hashing"}` {
+		t.Errorf("unexpected decode: %q %q %v", name, config, err)
+	}
+
+	payload, _ = EncodeSchemaPayload("notes", nil)
+	if name, config, err := DecodeSchemaPayload(payload); err != nil || name != "notes" || len(config) != 0 {
+		t.Errorf("expected a bare name, got %q %q %v", name, config, err)
+	}
+	if _, err := EncodeSchemaPayload("", nil); err == nil {
+		t.Error("expected an error for an empty name")
+	}
+}
+
 func TestRecordTypeString(t *testing.T) {
 	tests := []struct {
 		recType RecordType
@@ -193,6 +274,8 @@ func TestRecordTypeString(t *testing.T) {
 		{RecordTypeUpdate, "UPDATE"},
 		{RecordTypeDelete, "DELETE"},
 		{RecordTypeCheckpoint, "CHECKPOINT"},
+		{RecordTypeKV, "KV"},
+		{RecordTypeEmbedderChange, "EMBEDDER_CHANGE"},
 		{RecordType(99), "UNKNOWN(99)"},
 	}
 
@@ -241,3 +324,97 @@ func TestRecordVerifyChecksums(t *testing.T) {
 		t.Error("VerifyChecksums() should fail for corrupted payload CRC")
 	}
 }
+
+func TestRecordOrigin(t *testing.T) {
+	rec, _ := NewRecord(RecordTypeInsert, 7, []byte("payload"))
+	if _, ok := rec.OriginNode(); ok {
+		t.Error("expected a new record to be unattributed")
+	}
+
+	rec.SetOrigin(3)
+	decoded, err := DecodeRecord(rec.Encode())
+	if err != nil {
+		t.Fatalf("failed to decode record: %v", err)
+	}
+	if node, ok := decoded.OriginNode(); !ok || node != 3 {
+		t.Errorf("expected origin 3, got %d (set %v)", node, ok)
+	}
+	if decoded.Key() != (RecordKey{Origin: 3, LSN: 7}) {
+		t.Errorf("unexpected key %+v", decoded.Key())
+	}
+
+	// Changing the origin after encoding breaks the header CRC
+	data := rec.Encode()
+	data[6] = 4
+	if _, err := DecodeRecord(data); err == nil {
+		t.Error("expected a CRC error for a tampered origin")
+	}
+}
+
+func TestSupersedes(t *testing.T) {
+	a, _ := NewRecord(RecordTypeUpdate, 5, []byte("a"))
+	b, _ := NewRecord(RecordTypeUpdate, 5, []byte("b"))
+	a.SetOrigin(1)
+	b.SetOrigin(2)
+	if !Supersedes(b, a) || Supersedes(a, b) {
+		t.Error("expected the higher origin to win an LSN tie")
+	}
+
+	c, _ := NewRecord(RecordTypeUpdate, 6, []byte("c"))
+	if !Supersedes(c, b) {
+		t.Error("expected the higher LSN to win regardless of origin")
+	}
+	if Supersedes(a, a) {
+		t.Error("a record doesn't supersede itself")
+	}
+}
+
+func TestRecordTimestamp(t *testing.T) {
+	rec, _ := NewRecord(RecordTypeInsert, 3, []byte("payload"))
+	legacySize := rec.TotalSize()
+
+	ts := NewHLC(time.UnixMilli(1_700_000_000_000), 2)
+	rec.SetTimestamp(ts)
+	data := rec.Encode()
+	if len(data) != legacySize+TimestampSize || rec.TotalSize() != len(data) {
+		t.Errorf("expected %d encoded bytes, got %d (TotalSize %d)", legacySize+TimestampSize, len(data), rec.TotalSize())
+	}
+
+	decoded, err := DecodeRecord(data)
+	if err != nil {
+		t.Fatalf("failed to decode record: %v", err)
+	}
+	if got, ok := decoded.TimestampHLC(); !ok || got != ts {
+		t.Errorf("expected timestamp %v, got %v (set %v)", ts, got, ok)
+	}
+	if string(decoded.Payload) != "payload" {
+		t.Errorf("payload mismatch: %q", decoded.Payload)
+	}
+	if at, ok := decoded.AppliedAt(); !ok || !at.Equal(time.UnixMilli(1_700_000_000_000)) {
+		t.Errorf("expected applied_at from the timestamp, got %v (set %v)", at, ok)
+	}
+
+	// The header CRC covers the timestamp
+	data[HeaderSize]++
+	if _, err := DecodeRecord(data); err == nil {
+		t.Error("expected a CRC error for a tampered timestamp")
+	}
+}
+
+func TestSupersedesByTimestamp(t *testing.T) {
+	early, _ := NewRecord(RecordTypeUpdate, 10, []byte("a"))
+	late, _ := NewRecord(RecordTypeUpdate, 2, []byte("b"))
+	early.SetOrigin(1)
+	late.SetOrigin(2)
+	early.SetTimestamp(NewHLC(time.UnixMilli(1000), 0))
+	late.SetTimestamp(NewHLC(time.UnixMilli(2000), 0))
+	if !Supersedes(late, early) || Supersedes(early, late) {
+		t.Error("expected the later timestamp to win over a higher LSN from another node")
+	}
+
+	// Without a timestamp on both sides, LSNs decide
+	legacy, _ := NewRecord(RecordTypeUpdate, 5, []byte("c"))
+	if !Supersedes(legacy, late) {
+		t.Error("expected the higher LSN to win when one record has no timestamp")
+	}
+}
@@ -2,8 +2,11 @@ package wal
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
 	"os"
+	"path/filepath"
 	"sort"
 	"time"
 
@@ -17,8 +20,20 @@ type RecoveryStats struct {
 	WALRecordsReplayed int
 	TombstonesApplied  int
 	CorruptRecords     int
+	SegmentsRepaired   int
 	RecoveryTime       time.Duration
 	MaxLSN             uint64
+	MaxTimestamp       HLC    // Latest record timestamp seen, 0 if none were timestamped
+	SkippedAfter       int    // Records skipped for being applied after the RecoverTo target
+	IncompleteBatches  int    // Atomic batches dropped because a crash or corruption cut them short
+	BytesSkipped       int64  // Of corrupt regions skipped to reach the records after them
+	SnapshotLSN        uint64 // Checkpoint recovery started from, 0 if it replayed the whole WAL
+	SnapshotRecords    int    // Records loaded from the snapshot
+	SegmentsSkipped    int    // Segments the snapshot made unnecessary to read
+	SegmentsVerified   int    // Segments checked against their footer without a manifest
+	TornSegments       int    // Segments that don't match their footer, or lost it
+	DigestLSN          uint64 // Checkpoint whose IndexDigest the index was checked against, 0 if none could be
+	DigestMismatch     bool   // The rebuilt index doesn't match that checkpoint
 }
 
 // RecoveryManager handles WAL recovery on cold start
@@ -26,6 +41,56 @@ type RecoveryManager struct {
 	manifest ManifestStore
 	walDir   string
 	index    DocumentIndex
+	repairer *SegmentRepairer // Optional: replaces corrupt sealed segments
+	until    HLC              // Skip records timestamped after this (RecoverTo)
+	untilLSN uint64           // Skip records with a higher LSN (RecoverTo)
+	kv       KVIndex          // Optional: receives KV records
+	schema   SchemaIndex      // Optional: receives collection records
+	ops      OperationIndex   // Optional: receives the operation IDs of document records
+
+	batch    []*Record // Records of an atomic batch held until its last one
+	resyncs  int       // Corrupt regions skipped so far in the current segment
+	cutBatch bool      // Skipping the rest of a batch a corrupt region cut short
+
+	digestLSN  uint64      // Of the latest checkpoint that recorded an IndexDigest
+	digest     IndexDigest // Recorded by that checkpoint
+	lastDocLSN uint64      // Of the latest document record seen
+
+	scratch RecoveredDoc // Reused decode target; the index copies what it keeps
+}
+
+// RecoveryOption configures a RecoveryManager
+type RecoveryOption func(*RecoveryManager)
+
+// WithRepairer enables repairing corrupt or missing sealed segments from an
+// archive or replica instead of failing recovery
+func WithRepairer(repairer *SegmentRepairer) RecoveryOption {
+	return func(r *RecoveryManager) {
+		r.repairer = repairer
+	}
+}
+
+// WithKVIndex applies KV records to kv; without it they are skipped
+func WithKVIndex(kv KVIndex) RecoveryOption {
+	return func(r *RecoveryManager) {
+		r.kv = kv
+	}
+}
+
+// WithSchemaIndex applies collection and embedder records to schema;
+// without it they are skipped
+func WithSchemaIndex(schema SchemaIndex) RecoveryOption {
+	return func(r *RecoveryManager) {
+		r.schema = schema
+	}
+}
+
+// WithOperationIndex passes the operation IDs of replayed document records
+// to ops, so a deduplication window survives a restart
+func WithOperationIndex(ops OperationIndex) RecoveryOption {
+	return func(r *RecoveryManager) {
+		r.ops = ops
+	}
 }
 
 // RecoveredDoc represents a document recovered from the WAL
@@ -37,23 +102,53 @@ type RecoveredDoc struct {
 	Metadata  map[string]string
 	CreatedAt time.Time
 	Embedding relay.Embedding
+
+	Collection string
+	OpID       string // Operation that wrote it, if the client supplied one
+
+	LSN uint64 // Of the record it was recovered from; 0 when built by ToRecoveredDoc
 }
 
-// DocumentIndex is the interface for the in-memory document index
+// DocumentIndex is the interface for the in-memory document index.
+// SetRecovered must copy what it keeps: doc is reused for the next record.
 type DocumentIndex interface {
-	SetRecovered(doc RecoveredDoc)
+	SetRecovered(doc *RecoveredDoc)
 	Delete(docID string)
 	Has(docID string) bool
 	Count() int
 }
 
+// DigestIndex is a DocumentIndex that keeps an IndexDigest of its
+// documents; recovery checks it against checkpoints that recorded one
+type DigestIndex interface {
+	Digest() IndexDigest
+}
+
+// KVIndex is the in-memory state of the internal key-value entries
+type KVIndex interface {
+	SetKV(key string, value []byte)
+	DeleteKV(key string)
+}
+
+// OperationIndex remembers which documents were written under which
+// client-supplied operation IDs, and when
+type OperationIndex interface {
+	RecordOperation(opID, docID string, lsn uint64, at time.Time)
+}
+
 // NewRecoveryManager creates a new recovery manager
-func NewRecoveryManager(manifest ManifestStore, walDir string, index DocumentIndex) *RecoveryManager {
-	return &RecoveryManager{
+func NewRecoveryManager(manifest ManifestStore, walDir string, index DocumentIndex, opts ...RecoveryOption) *RecoveryManager {
+	r := &RecoveryManager{
 		manifest: manifest,
 		walDir:   walDir,
 		index:    index,
 	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
 }
 
 // Recover rebuilds the in-memory index from WAL segments
@@ -81,14 +176,16 @@ func (r *RecoveryManager) Recover(ctx context.Context) (*RecoveryStats, error) {
 			continue
 		}
 
-		// Verify checksum for sealed segments
-		if seg.Status == SegmentStatusSealed && seg.Checksum != nil {
+		// Verify sealed segments against their footer, or the manifest's checksum
+		if seg.Status == SegmentStatusSealed {
 			valid, err := r.verifySegment(seg)
-			if err != nil {
+			if err != nil && (r.repairer == nil || !errors.Is(err, os.ErrNotExist)) {
 				return nil, fmt.Errorf("failed to verify segment %s: %w", seg.Filename, err)
 			}
 			if !valid {
-				return nil, fmt.Errorf("corrupt segment detected: %s", seg.Filename)
+				if err := r.repairSegment(ctx, seg, stats); err != nil {
+					return nil, fmt.Errorf("corrupt segment detected: %s: %w", seg.Filename, err)
+				}
 			}
 		}
 
@@ -102,7 +199,7 @@ func (r *RecoveryManager) Recover(ctx context.Context) (*RecoveryStats, error) {
 		}
 
 		// Read records from segment
-		iter, err := NewSegmentIteratorFromLSN(seg.Filename, info.State.CheckpointLSN+1)
+		iter, err := r.openSegment(seg.Filename, info.State.CheckpointLSN+1)
 		if err != nil {
 			return nil, fmt.Errorf("failed to open segment %s: %w", seg.Filename, err)
 		}
@@ -114,11 +211,14 @@ func (r *RecoveryManager) Recover(ctx context.Context) (*RecoveryStats, error) {
 			if rec.LSN > stats.MaxLSN {
 				stats.MaxLSN = rec.LSN
 			}
+			if r.skipCutBatch(iter, rec, stats) || r.skipAfterUntil(rec, stats) {
+				continue
+			}
 
-			if err := r.applyRecord(rec, docLSN); err != nil {
+			if err := r.apply(rec, docLSN); err != nil {
 				stats.CorruptRecords++
 				// Log but continue - partial recovery is better than none
-				fmt.Printf("warning: failed to apply record at LSN %d: %v\n", rec.LSN, err)
+				fmt.Fprintf(os.Stderr, "warning: failed to apply record at LSN %d: %v\n", rec.LSN, err)
 				continue
 			}
 
@@ -127,6 +227,8 @@ func (r *RecoveryManager) Recover(ctx context.Context) (*RecoveryStats, error) {
 			}
 		}
 
+		r.dropBatch(stats)
+		r.reportResyncs(iter, seg.Filename, stats)
 		if err := iter.Err(); err != nil {
 			_ = iter.Close()
 			return nil, fmt.Errorf("error reading segment %s: %w", seg.Filename, err)
@@ -153,14 +255,65 @@ func (r *RecoveryManager) Recover(ctx context.Context) (*RecoveryStats, error) {
 	return stats, nil
 }
 
-// verifySegment verifies the checksum of a sealed segment
+// verifySegment verifies a sealed segment against its footer, or for one
+// sealed before footers were written, the checksum the manifest recorded
 func (r *RecoveryManager) verifySegment(seg SegmentInfo) (bool, error) {
+	_, err := VerifySegmentFooter(seg.Filename)
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, ErrFooterMismatch):
+		return false, nil
+	case !errors.Is(err, ErrNoFooter):
+		return false, err
+	}
 	if seg.Checksum == nil {
 		return true, nil // No checksum to verify
 	}
 	return VerifySegmentChecksum(seg.Filename, *seg.Checksum)
 }
 
+// checkFooter verifies a segment against its footer when there's no
+// manifest to check it with. A WAL segment without a footer is suspect
+// only when an earlier WAL segment has one, so a writer that writes them
+// sealed it, and it isn't the last, which may be active. Torn segments are
+// still read: each record has its own checksums, so only records past the
+// tear are lost.
+func (r *RecoveryManager) checkFooter(path string, last bool, footers *bool, stats *RecoveryStats) {
+	isWAL := IsWALSegment(path)
+	_, err := VerifySegmentFooter(path)
+	switch {
+	case err == nil:
+		*footers = *footers || isWAL
+		stats.SegmentsVerified++
+	case errors.Is(err, ErrNoFooter):
+		if *footers && !last && isWAL {
+			stats.TornSegments++
+			fmt.Fprintf(os.Stderr, "warning: sealed segment %s has lost its footer, records at its end may be missing\n", path)
+		}
+	case errors.Is(err, ErrFooterMismatch):
+		*footers = *footers || isWAL
+		stats.TornSegments++
+		fmt.Fprintf(os.Stderr, "warning: segment %s may be incomplete: %v\n", path, err)
+	}
+}
+
+// repairSegment replaces a corrupt sealed segment using the configured repairer
+func (r *RecoveryManager) repairSegment(ctx context.Context, seg SegmentInfo, stats *RecoveryStats) error {
+	if r.repairer == nil {
+		return fmt.Errorf("checksum mismatch and no repair source configured")
+	}
+
+	res, err := r.repairer.Repair(WithSegmentActor(ctx, ActorRecovery, ""), seg)
+	if err != nil {
+		return err
+	}
+
+	stats.SegmentsRepaired++
+	fmt.Fprintf(os.Stderr, "repaired segment %s from %s (%d bytes)\n", res.Filename, res.Source, res.Bytes)
+	return nil
+}
+
 // findActiveSegment finds the current active WAL segment file
 func (r *RecoveryManager) findActiveSegment(info *RecoveryInfo) (string, error) {
 	// Look for active segment in manifest
@@ -183,7 +336,7 @@ func (r *RecoveryManager) findActiveSegment(info *RecoveryInfo) (string, error)
 
 // replayActiveWAL replays records from the active WAL segment
 func (r *RecoveryManager) replayActiveWAL(walPath string, checkpointLSN uint64, docLSN map[string]uint64, stats *RecoveryStats) (int, error) {
-	iter, err := NewSegmentIteratorFromLSN(walPath, checkpointLSN+1)
+	iter, err := r.openSegment(walPath, checkpointLSN+1)
 	if err != nil {
 		return 0, fmt.Errorf("failed to open active WAL: %w", err)
 	}
@@ -192,11 +345,17 @@ func (r *RecoveryManager) replayActiveWAL(walPath string, checkpointLSN uint64,
 	replayed := 0
 	for iter.Next() {
 		rec := iter.Record()
+		if r.skipCutBatch(iter, rec, stats) || r.skipAfterUntil(rec, stats) {
+			if rec.LSN > stats.MaxLSN {
+				stats.MaxLSN = rec.LSN
+			}
+			continue
+		}
 
-		if err := r.applyRecord(rec, docLSN); err != nil {
+		if err := r.apply(rec, docLSN); err != nil {
 			// On corruption in active WAL, truncate here
 			// This record and all following are lost
-			fmt.Printf("warning: corruption detected at LSN %d, truncating WAL\n", rec.LSN)
+			fmt.Fprintf(os.Stderr, "warning: corruption detected at LSN %d, truncating WAL\n", rec.LSN)
 			break
 		}
 
@@ -206,39 +365,144 @@ func (r *RecoveryManager) replayActiveWAL(walPath string, checkpointLSN uint64,
 		replayed++
 	}
 
+	r.dropBatch(stats)
+	r.reportResyncs(iter, walPath, stats)
+
 	// Don't fail on error in active WAL - just stop at corruption point
 	if err := iter.Err(); err != nil {
-		fmt.Printf("warning: error reading active WAL (truncated at corruption): %v\n", err)
+		fmt.Fprintf(os.Stderr, "warning: error reading active WAL (truncated at corruption): %v\n", err)
 	}
 
 	return replayed, nil
 }
 
+// skipAfterUntil tracks the latest timestamp and reports whether rec was
+// applied after the RecoverTo target
+func (r *RecoveryManager) skipAfterUntil(rec *Record, stats *RecoveryStats) bool {
+	ts, ok := rec.TimestampHLC()
+	if ok && ts > stats.MaxTimestamp {
+		stats.MaxTimestamp = ts
+	}
+	if (r.untilLSN != 0 && rec.LSN > r.untilLSN) || (ok && r.until != 0 && ts > r.until) {
+		stats.SkippedAfter++
+		return true
+	}
+	return false
+}
+
+// targeted reports whether recovery stops short of the end of the WAL
+func (r *RecoveryManager) targeted() bool {
+	return r.until != 0 || r.untilLSN != 0
+}
+
+// apply applies rec, holding the records of an atomic batch until its last
+// record arrives so the batch is applied whole
+func (r *RecoveryManager) apply(rec *Record, docLSN map[string]uint64) error {
+	if rec.InBatch() {
+		r.batch = append(r.batch, rec.clone())
+		return nil
+	}
+	var firstErr error
+	for _, b := range r.batch {
+		if err := r.applyRecord(b, docLSN); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	r.batch = r.batch[:0]
+	if err := r.applyRecord(rec, docLSN); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
+
+// openSegment opens an iterator over a segment's records from fromLSN that
+// skips corrupt records instead of stopping at the first one
+func (r *RecoveryManager) openSegment(path string, fromLSN uint64) (*SegmentIterator, error) {
+	iter, err := NewSegmentIteratorFromLSN(path, fromLSN)
+	if err != nil {
+		return nil, err
+	}
+	iter.reuse = true // apply copies the records it holds
+	iter.EnableResync()
+	r.resyncs, r.cutBatch = 0, false
+	return iter, nil
+}
+
+// skipCutBatch reports whether rec belongs to an atomic batch that a corrupt
+// region cut short, so the batch is applied whole or not at all. The
+// records held when iter resyncs are dropped, and so are the ones after the
+// region up to the batch's end if the batch continues there: when the last
+// corrupt record's header is intact its FlagBatch says so, otherwise it's
+// assumed to if a batch was being held.
+func (r *RecoveryManager) skipCutBatch(iter *SegmentIterator, rec *Record, stats *RecoveryStats) bool {
+	if n := iter.Resyncs(); n > r.resyncs {
+		r.resyncs = n
+		held := len(r.batch) > 0
+		r.dropBatch(stats)
+		if iter.lostHeader {
+			r.cutBatch = iter.lostInBatch
+			if r.cutBatch && !held {
+				stats.IncompleteBatches++ // Its first records were in the region
+			}
+		} else {
+			r.cutBatch = held
+		}
+	}
+	if r.cutBatch {
+		r.cutBatch = rec.InBatch()
+		return true
+	}
+	return false
+}
+
+// reportResyncs counts and logs the corrupt regions iter skipped, reporting
+// whether there were any
+func (r *RecoveryManager) reportResyncs(iter *SegmentIterator, path string, stats *RecoveryStats) bool {
+	if iter.Resyncs() == 0 {
+		return false
+	}
+	stats.CorruptRecords += iter.Resyncs()
+	stats.BytesSkipped += iter.SkippedBytes()
+	fmt.Fprintf(os.Stderr, "warning: skipped %d corrupt regions (%d bytes) in segment %s\n", iter.Resyncs(), iter.SkippedBytes(), path)
+	return true
+}
+
+// dropBatch discards a batch whose last record never reached the segment
+func (r *RecoveryManager) dropBatch(stats *RecoveryStats) {
+	if len(r.batch) == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "warning: dropping incomplete batch of %d records from LSN %d\n", len(r.batch), r.batch[0].LSN)
+	stats.IncompleteBatches++
+	r.batch = r.batch[:0]
+}
+
 // applyRecord applies a record to the in-memory index
 func (r *RecoveryManager) applyRecord(rec *Record, docLSN map[string]uint64) error {
 	switch rec.Type {
 	case RecordTypeInsert, RecordTypeUpdate:
-		docID, meta, embedding, err := DecodeDocPayload(rec.Payload)
+		id, err := payloadDocID(rec.Payload)
 		if err != nil {
 			return fmt.Errorf("failed to decode payload: %w", err)
 		}
 
-		// Only apply if this is the latest record for this document
-		if existingLSN, exists := docLSN[docID]; exists && existingLSN >= rec.LSN {
+		// Only apply if this is the latest record for this document; checked
+		// before decoding so stale records cost no allocations
+		if existingLSN, exists := docLSN[string(id)]; exists && existingLSN >= rec.LSN {
 			return nil // Stale record
 		}
-		docLSN[docID] = rec.LSN
 
-		doc := RecoveredDoc{
-			DocID:     docID,
-			Source:    meta.Source,
-			Title:     meta.Title,
-			Text:      meta.Text,
-			Metadata:  meta.Metadata,
-			CreatedAt: meta.CreatedAt,
-			Embedding: embedding,
+		if err := decodeDocPayloadInto(rec.Payload, &r.scratch); err != nil {
+			return fmt.Errorf("failed to decode payload: %w", err)
+		}
+		r.scratch.LSN = rec.LSN
+		docLSN[r.scratch.DocID] = rec.LSN
+		r.index.SetRecovered(&r.scratch)
+		if r.ops != nil && r.scratch.OpID != "" {
+			if at, ok := rec.AppliedAt(); ok {
+				r.ops.RecordOperation(r.scratch.OpID, r.scratch.DocID, rec.LSN, at)
+			}
 		}
-		r.index.SetRecovered(doc)
 
 	case RecordTypeDelete:
 		docID, err := DecodeDeletePayload(rec.Payload)
@@ -256,6 +520,43 @@ func (r *RecoveryManager) applyRecord(rec *Record, docLSN map[string]uint64) err
 	case RecordTypeCheckpoint:
 		// Checkpoint records are informational, no action needed
 
+	case RecordTypeKV:
+		if r.kv == nil {
+			return nil
+		}
+		key, value, deleted, err := DecodeKVPayload(rec.Payload)
+		if err != nil {
+			return fmt.Errorf("failed to decode KV payload: %w", err)
+		}
+
+		// Tracked apart from documents so a key can share a DocID
+		tracked := kvKeyPrefix + key
+		if existingLSN, exists := docLSN[tracked]; exists && existingLSN >= rec.LSN {
+			return nil // Stale record
+		}
+		docLSN[tracked] = rec.LSN
+		if deleted {
+			r.kv.DeleteKV(key)
+		} else {
+			r.kv.SetKV(key, value)
+		}
+
+	case RecordTypeCollection, RecordTypeCollectionDelete, RecordTypeEmbedderChange:
+		if r.schema == nil {
+			return nil
+		}
+		name, config, err := DecodeSchemaPayload(rec.Payload)
+		if err != nil {
+			return fmt.Errorf("failed to decode collection payload: %w", err)
+		}
+
+		tracked := schemaKey(rec.Type, name)
+		if existingLSN, exists := docLSN[tracked]; exists && existingLSN >= rec.LSN {
+			return nil // Stale record
+		}
+		docLSN[tracked] = rec.LSN
+		r.schema.ApplySchema(SchemaEvent{Type: rec.Type, LSN: rec.LSN, Collection: name, Config: config})
+
 	default:
 		// Unknown record type - skip
 	}
@@ -263,8 +564,63 @@ func (r *RecoveryManager) applyRecord(rec *Record, docLSN map[string]uint64) err
 	return nil
 }
 
+// RecoveryTarget is a point in the WAL's history: just after the record
+// with LSN, or wall-clock Time. With both set, whichever comes first
+// applies. The zero target is the end of the WAL.
+type RecoveryTarget struct {
+	LSN  uint64
+	Time time.Time
+}
+
+// IsZero reports whether t is the end of the WAL
+func (t RecoveryTarget) IsZero() bool {
+	return t.LSN == 0 && t.Time.IsZero()
+}
+
+func (t RecoveryTarget) String() string {
+	switch {
+	case t.IsZero():
+		return "end of WAL"
+	case t.Time.IsZero():
+		return fmt.Sprintf("LSN %d", t.LSN)
+	case t.LSN == 0:
+		return t.Time.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprintf("LSN %d or %s", t.LSN, t.Time.Format(time.RFC3339Nano))
+}
+
+// RecoverTo rebuilds the index as it was at target, skipping records
+// applied after it. Like RecoverWithoutManifest it scans every segment
+// file, since the manifest checkpoint may be later than the target, but it
+// never starts from a snapshot. An atomic batch that straddles the target
+// is left out whole. Records written before timestamps existed are always
+// applied by a time target, as they can't be placed in time, and versions
+// that compaction already dropped can't be restored.
+func (r *RecoveryManager) RecoverTo(ctx context.Context, target RecoveryTarget) (*RecoveryStats, error) {
+	r.untilLSN = target.LSN
+	if !target.Time.IsZero() {
+		r.until = NewHLC(target.Time, math.MaxUint16)
+	}
+	defer func() { r.until, r.untilLSN = 0, 0 }()
+	return r.RecoverWithoutManifest(ctx)
+}
+
+// RecoverToTime rebuilds the index as it was at wall-clock time t; see
+// RecoverTo
+func (r *RecoveryManager) RecoverToTime(ctx context.Context, t time.Time) (*RecoveryStats, error) {
+	return r.RecoverTo(ctx, RecoveryTarget{Time: t})
+}
+
+// RecoverToLSN rebuilds the index as it was just after the record with LSN
+// lsn was applied; see RecoverTo
+func (r *RecoveryManager) RecoverToLSN(ctx context.Context, lsn uint64) (*RecoveryStats, error) {
+	return r.RecoverTo(ctx, RecoveryTarget{LSN: lsn})
+}
+
 // RecoverWithoutManifest performs recovery when no manifest is available
-// Uses file system scan to find segments
+// Uses file system scan to find segments. When a snapshot was taken at a
+// checkpoint that is still in the WAL, the index starts from the snapshot
+// and only the records after the checkpoint are replayed.
 func (r *RecoveryManager) RecoverWithoutManifest(_ context.Context) (*RecoveryStats, error) {
 	startTime := time.Now()
 	stats := &RecoveryStats{}
@@ -282,12 +638,33 @@ func (r *RecoveryManager) RecoverWithoutManifest(_ context.Context) (*RecoverySt
 
 	docLSN := make(map[string]uint64)
 
+	// Start from the latest snapshot, unless recovering to an earlier point
+	var fromLSN uint64
+	if !r.targeted() {
+		lsn, rest, err := r.loadSnapshot(segments, docLSN, stats)
+		if err != nil {
+			return nil, err
+		}
+		if lsn > 0 {
+			fromLSN, segments = lsn+1, rest
+		}
+	}
+
+	lastWAL := ""
+	for _, segPath := range segments {
+		if IsWALSegment(segPath) {
+			lastWAL = segPath
+		}
+	}
+
 	// Process segments in order
+	footers := false
 	for _, segPath := range segments {
-		iter, err := NewSegmentIterator(segPath)
+		r.checkFooter(segPath, segPath == lastWAL, &footers, stats)
+		iter, err := r.openSegment(segPath, fromLSN)
 		if err != nil {
 			// Can't open segment - log and continue to next
-			fmt.Printf("warning: failed to open segment %s: %v\n", segPath, err)
+			fmt.Fprintf(os.Stderr, "warning: failed to open segment %s: %v\n", segPath, err)
 			continue
 		}
 
@@ -301,8 +678,12 @@ func (r *RecoveryManager) RecoverWithoutManifest(_ context.Context) (*RecoverySt
 			if rec.LSN > stats.MaxLSN {
 				stats.MaxLSN = rec.LSN
 			}
+			r.trackDigest(rec)
+			if r.skipCutBatch(iter, rec, stats) || r.skipAfterUntil(rec, stats) {
+				continue
+			}
 
-			if err := r.applyRecord(rec, docLSN); err != nil {
+			if err := r.apply(rec, docLSN); err != nil {
 				stats.CorruptRecords++
 				// Continue trying to read more records (corruption may be isolated)
 				continue
@@ -313,13 +694,16 @@ func (r *RecoveryManager) RecoverWithoutManifest(_ context.Context) (*RecoverySt
 			}
 		}
 
+		r.dropBatch(stats)
+		if r.reportResyncs(iter, segPath, stats) {
+			segmentCorrupt = true
+		}
 		if err := iter.Err(); err != nil {
-			// Iterator error - likely corruption at current position
-			// For tail corruption (crash scenario), this is expected
-			// For mid-segment CRC corruption, iterator stops here (no magic-byte resync)
+			// Iterator error - a record cut short, as by a crash mid-write;
+			// corrupt records before it were skipped by resyncing
 			stats.CorruptRecords++
 			segmentCorrupt = true
-			fmt.Printf("warning: error reading segment %s (recovered %d records from this segment before error): %v\n",
+			fmt.Fprintf(os.Stderr, "warning: error reading segment %s (recovered %d records from this segment before error): %v\n",
 				segPath, segmentRecords, err)
 		}
 		_ = iter.Close()
@@ -329,10 +713,130 @@ func (r *RecoveryManager) RecoverWithoutManifest(_ context.Context) (*RecoverySt
 		}
 	}
 
+	if !r.targeted() {
+		r.checkDigest(stats)
+	}
 	stats.RecoveryTime = time.Since(startTime)
 	return stats, nil
 }
 
+// loadSnapshot applies the latest snapshot that pairs with a checkpoint
+// record in segments, returning the checkpoint's LSN and the segments that
+// may hold later records. It returns 0 when there is no usable snapshot,
+// leaving the index untouched.
+func (r *RecoveryManager) loadSnapshot(segments []string, docLSN map[string]uint64, stats *RecoveryStats) (uint64, []string, error) {
+	snaps, err := ListSnapshots(r.walDir)
+	if err != nil || len(snaps) == 0 {
+		return 0, nil, nil
+	}
+	snap := snaps[0]
+	if valid, err := VerifySegmentChecksum(snap.Path, snap.Checksum); err != nil || !valid {
+		fmt.Fprintf(os.Stderr, "warning: ignoring snapshot %s: checksum mismatch\n", snap.Path)
+		return 0, nil, nil
+	}
+
+	// The WAL segment holding the checkpoint is the last one starting at or
+	// before it; earlier WAL segments only hold what the snapshot has.
+	// Compacted segments are always read, since their records span LSNs.
+	holder := -1
+	for i, seg := range segments {
+		if !IsWALSegment(seg) {
+			continue
+		}
+		if first, ok := segmentFirstLSN(seg); ok && first <= snap.LSN {
+			holder = i
+		}
+	}
+	if holder < 0 {
+		fmt.Fprintf(os.Stderr, "warning: ignoring snapshot at LSN %d: its checkpoint isn't in the WAL\n", snap.LSN)
+		return 0, nil, nil
+	}
+	checkpoint, err := findCheckpoint(segments[holder], snap.LSN)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: ignoring snapshot at LSN %d: %v\n", snap.LSN, err)
+		return 0, nil, nil
+	}
+
+	iter, err := NewSegmentIterator(snap.Path)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	defer func() { _ = iter.Close() }()
+	iter.reuse = true
+	for iter.Next() {
+		if err := r.applyRecord(iter.Record(), docLSN); err != nil {
+			return 0, nil, fmt.Errorf("failed to apply snapshot %s: %w", snap.Path, err)
+		}
+		stats.SnapshotRecords++
+	}
+	if err := iter.Err(); err != nil {
+		return 0, nil, fmt.Errorf("failed to read snapshot %s: %w", snap.Path, err)
+	}
+
+	stats.SnapshotLSN = snap.LSN
+	stats.MaxLSN = snap.LSN
+	r.skipAfterUntil(checkpoint, stats) // Carries the latest timestamp so far
+	r.trackDigest(checkpoint)
+	r.checkDigest(stats)
+
+	var rest []string
+	for i, seg := range segments {
+		if i < holder && IsWALSegment(seg) {
+			stats.SegmentsSkipped++
+			continue
+		}
+		rest = append(rest, seg)
+	}
+	return snap.LSN, rest, nil
+}
+
+// trackDigest notes the latest checkpoint that recorded an IndexDigest and
+// the latest document record, in whatever order segments hold them
+func (r *RecoveryManager) trackDigest(rec *Record) {
+	switch rec.Type {
+	case RecordTypeCheckpoint:
+		if d, ok := DecodeCheckpointDigest(rec.Payload); ok && rec.LSN > r.digestLSN {
+			r.digestLSN, r.digest = rec.LSN, d
+		}
+	case RecordTypeInsert, RecordTypeUpdate, RecordTypeDelete:
+		r.lastDocLSN = max(r.lastDocLSN, rec.LSN)
+	}
+}
+
+// checkDigest compares the index with the latest checkpoint's digest. It
+// only can when no document record came after the checkpoint, so the index
+// should hold just what it held then.
+func (r *RecoveryManager) checkDigest(stats *RecoveryStats) {
+	di, ok := r.index.(DigestIndex)
+	if !ok || r.digestLSN == 0 || r.lastDocLSN > r.digestLSN || stats.DigestLSN == r.digestLSN {
+		return
+	}
+	stats.DigestLSN = r.digestLSN
+	if got := di.Digest(); got != r.digest {
+		stats.DigestMismatch = true
+		fmt.Fprintf(os.Stderr, "warning: recovered index diverges from the checkpoint at LSN %d: %d documents (digest %016x), checkpoint recorded %d (digest %016x)\n",
+			r.digestLSN, got.Docs, got.Sum, r.digest.Docs, r.digest.Sum)
+	}
+}
+
+// findCheckpoint returns the checkpoint record with LSN lsn in a segment
+func findCheckpoint(path string, lsn uint64) (*Record, error) {
+	iter, err := NewSegmentIteratorFromLSN(path, lsn)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = iter.Close() }()
+	if iter.Next() {
+		if rec := iter.Record(); rec.LSN == lsn && rec.Type == RecordTypeCheckpoint {
+			return rec, nil
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("no checkpoint record at LSN %d in %s", lsn, filepath.Base(path))
+}
+
 // ToRecoveredDoc converts DocMetadata + embedding to RecoveredDoc
 func ToRecoveredDoc(docID string, meta DocMetadata, embedding relay.Embedding) RecoveredDoc {
 	return RecoveredDoc{
@@ -343,5 +847,7 @@ func ToRecoveredDoc(docID string, meta DocMetadata, embedding relay.Embedding) R
 		Metadata:  meta.Metadata,
 		CreatedAt: meta.CreatedAt,
 		Embedding: embedding,
+
+		Collection: meta.Collection,
 	}
 }
@@ -0,0 +1,328 @@
+package wal
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// RepairSegmentOptions configures RepairSegment
+type RepairSegmentOptions struct {
+	// Resync skips past corrupt regions and keeps the valid records after
+	// them, as recovery does; without it the segment is cut at the first
+	// corrupt record
+	Resync bool
+
+	// Manifest, when set, is updated with the rewritten segment's checksum,
+	// size, record count, and LSN range, and gets a repair event
+	Manifest ManifestStore
+
+	// DryRun reports what would be dropped without changing anything
+	DryRun bool
+
+	// Compression compresses the rewritten segment's payloads, like
+	// WithCompression does for the writer. Empty keeps the segment's own:
+	// zstd if any record kept was stored compressed.
+	Compression Compression
+}
+
+// DroppedRegion is a range of a segment that a repair dropped
+type DroppedRegion struct {
+	Offset  int64 `json:"offset"`
+	Bytes   int64 `json:"bytes"`
+	Records int   `json:"records,omitempty"` // Valid records dropped with it, of a batch the corruption cut short
+}
+
+// RepairReport is the result of RepairSegment. Nothing was rewritten when
+// Regions is empty.
+type RepairReport struct {
+	Segment        string          `json:"segment"`
+	Records        int             `json:"records"` // Kept
+	MinLSN         uint64          `json:"min_lsn"`
+	MaxLSN         uint64          `json:"max_lsn"`
+	Regions        []DroppedRegion `json:"regions"`
+	DroppedBytes   int64           `json:"dropped_bytes"`
+	DroppedRecords int             `json:"dropped_records"`      // Valid records dropped with cut batches
+	Sealed         bool            `json:"sealed"`               // Rewritten with a footer
+	Checksum       string          `json:"checksum,omitempty"`   // Of the rewritten segment
+	Quarantine     string          `json:"quarantine,omitempty"` // Copy of the dropped bytes, relative to the WAL directory
+	Manifest       bool            `json:"manifest"`             // The manifest was updated
+	DryRun         bool            `json:"dry_run,omitempty"`
+}
+
+// heldRecord is a record of an open batch and where it is in the segment
+type heldRecord struct {
+	rec        *Record
+	start, end int64
+}
+
+// RepairSegment rewrites the segment at path keeping only its valid
+// records, for when a segment is damaged and no archive or replica holds a
+// good copy (see SegmentRepairer). Like recovery, it drops an atomic batch
+// whole when a corrupt region cuts it short, so the repaired segment
+// replays to the same documents the damaged one recovers to. The dropped
+// bytes are copied into QuarantineDir first, where they stay for the GC
+// grace period, and the rewritten segment replaces the original
+// atomically. A segment that had a footer, or that the manifest lists as
+// sealed, is sealed again. The segment's bloom filter is left alone, as
+// it still covers every document the segment holds.
+//
+// Nothing else may write to the directory while it runs; the API holds the
+// directory lock, so stop it first.
+func RepairSegment(ctx context.Context, path string, opts RepairSegmentOptions) (*RepairReport, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat segment: %w", err)
+	}
+	var seg *SegmentInfo
+	if opts.Manifest != nil {
+		if seg, err = manifestSegment(ctx, opts.Manifest, path); err != nil {
+			return nil, err
+		}
+	}
+
+	iter, err := NewSegmentIterator(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = iter.Close() }()
+	if opts.Resync {
+		iter.EnableResync()
+	}
+
+	report := &RepairReport{Segment: filepath.Base(path), Regions: []DroppedRegion{}, DryRun: opts.DryRun}
+	drop := func(start, end int64, records int) {
+		if end <= start {
+			return
+		}
+		if n := len(report.Regions); n > 0 && report.Regions[n-1].Offset+report.Regions[n-1].Bytes == start {
+			report.Regions[n-1].Bytes += end - start
+			report.Regions[n-1].Records += records
+		} else {
+			report.Regions = append(report.Regions, DroppedRegion{Offset: start, Bytes: end - start, Records: records})
+		}
+		report.DroppedBytes += end - start
+		report.DroppedRecords += records
+	}
+	dropBatch := func(batch []heldRecord) {
+		for _, h := range batch {
+			drop(h.start, h.end, 1)
+		}
+	}
+
+	var kept []*Record
+	var batch []heldRecord
+	var end, skipped int64 // Where the last record read ended; bytes skipped by then
+	resyncs, cutBatch := 0, false
+	for iter.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		rec := iter.Record()
+		prev := end
+		h := heldRecord{rec: rec, start: prev + iter.SkippedBytes() - skipped, end: iter.Offset()}
+		end, skipped = h.end, iter.SkippedBytes()
+
+		// The batch handling follows RecoveryManager.skipCutBatch
+		if n := iter.Resyncs(); n > resyncs {
+			resyncs = n
+			held := len(batch) > 0
+			dropBatch(batch)
+			batch = nil
+			drop(prev, h.start, 0)
+			if iter.lostHeader {
+				cutBatch = iter.lostInBatch
+			} else {
+				cutBatch = held
+			}
+		}
+		if cutBatch {
+			cutBatch = rec.InBatch()
+			drop(h.start, h.end, 1)
+			continue
+		}
+
+		batch = append(batch, h)
+		if !rec.InBatch() {
+			for _, b := range batch {
+				kept = append(kept, b.rec)
+			}
+			batch = nil
+		}
+	}
+
+	// What follows the last record: a corrupt region resync couldn't get
+	// past, or the rest of a segment that can't be read any further
+	dataEnd := stat.Size()
+	footer := iter.Footer()
+	if footer != nil {
+		dataEnd = footer.DataBytes
+	}
+	tail := iter.SkippedBytes() > skipped || iter.Err() != nil
+	if tail {
+		dropBatch(batch)
+		drop(end, end+iter.SkippedBytes()-skipped, 0)
+		drop(iter.Offset(), dataEnd, 0)
+	} else {
+		for _, b := range batch {
+			kept = append(kept, b.rec)
+		}
+	}
+
+	for i, rec := range kept {
+		if i == 0 || rec.LSN < report.MinLSN {
+			report.MinLSN = rec.LSN
+		}
+		report.MaxLSN = max(report.MaxLSN, rec.LSN)
+	}
+	report.Records = len(kept)
+	report.Sealed = footer != nil || IsCompactedSegment(path) || (seg != nil && seg.Status != SegmentStatusActive)
+	if len(report.Regions) == 0 || opts.DryRun {
+		return report, nil
+	}
+
+	dir := filepath.Dir(path)
+	quarantine, err := quarantineRegions(path, report.Regions)
+	if err != nil {
+		return nil, err
+	}
+	if report.Quarantine, err = filepath.Rel(dir, quarantine); err != nil {
+		report.Quarantine = quarantine
+	}
+	compression := opts.Compression
+	if compression == "" {
+		compression = storedCompression(kept)
+	}
+	if report.Checksum, err = rewriteSegment(path, kept, report.Sealed, compression); err != nil {
+		return nil, err
+	}
+
+	if seg != nil {
+		rewritten, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat repaired segment: %w", err)
+		}
+		checksum := report.Checksum
+		if !report.Sealed {
+			checksum = "" // Active segments get theirs when they're sealed
+		}
+		if err := opts.Manifest.UpdateSegmentContents(ctx, seg.SegmentType, seg.SegmentID, rewritten.Size(), report.Records, report.MinLSN, report.MaxLSN, checksum); err != nil {
+			return nil, fmt.Errorf("segment repaired, but the manifest wasn't updated: %w", err)
+		}
+		report.Manifest = true
+
+		// The swap already happened, so a failure here is reported but
+		// doesn't undo the repair
+		ev := newSegmentEvent(ctx, seg.SegmentType, seg.SegmentID, seg.Status, seg.Status)
+		ev.Reason = fmt.Sprintf("repaired in place: dropped %d bytes, %d records", report.DroppedBytes, report.DroppedRecords)
+		if err := opts.Manifest.RecordSegmentEvent(ctx, ev); err != nil {
+			fmt.Printf("warning: failed to record repair of %s: %v\n", report.Segment, err)
+		}
+	}
+	return report, nil
+}
+
+// manifestSegment returns the manifest's entry for the segment at path,
+// or nil if it isn't listed
+func manifestSegment(ctx context.Context, manifest ManifestStore, path string) (*SegmentInfo, error) {
+	info, err := manifest.GetRecoveryInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	for i := range info.Segments {
+		if filepath.Base(info.Segments[i].Filename) == filepath.Base(path) {
+			return &info.Segments[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// quarantineRegions copies the regions of the segment at path, one after
+// another, into a file in the quarantine and returns its path
+func quarantineRegions(path string, regions []DroppedRegion) (string, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open segment: %w", err)
+	}
+	defer func() { _ = src.Close() }()
+
+	qdir := filepath.Join(filepath.Dir(path), QuarantineDir)
+	if err := os.MkdirAll(qdir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create quarantine: %w", err)
+	}
+	dst := filepath.Join(qdir, fmt.Sprintf("%s.%s.dropped", filepath.Base(path), time.Now().UTC().Format("20060102T150405Z")))
+	f, err := os.Create(dst)
+	if err != nil {
+		return "", fmt.Errorf("failed to create quarantine copy: %w", err)
+	}
+	for _, r := range regions {
+		if _, err := io.Copy(f, io.NewSectionReader(src, r.Offset, r.Bytes)); err != nil {
+			_ = f.Close()
+			return "", fmt.Errorf("failed to copy dropped bytes: %w", err)
+		}
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return "", fmt.Errorf("failed to sync quarantine copy: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("failed to close quarantine copy: %w", err)
+	}
+	return dst, syncDir(qdir)
+}
+
+// storedCompression returns the compression records were read with: zstd
+// if any took fewer bytes on disk than decoded
+func storedCompression(records []*Record) Compression {
+	for _, rec := range records {
+		if rec.DiskSize() < rec.TotalSize() {
+			return CompressionZstd
+		}
+	}
+	return CompressionNone
+}
+
+// rewriteSegment writes records, compressed with c, into a temp file next
+// to the segment at path, sealed with a footer if sealed, and renames it
+// over the segment. It returns the new segment's checksum.
+func rewriteSegment(path string, records []*Record, sealed bool, c Compression) (string, error) {
+	dir := filepath.Dir(path)
+	tmpPath := filepath.Join(dir, "."+filepath.Base(path)+".repair")
+	sw, err := NewSegmentWriter(tmpPath)
+	if err != nil {
+		return "", err
+	}
+	sw.SetCompression(c)
+	fail := func(err error) (string, error) {
+		_ = sw.Close()
+		_ = os.Remove(tmpPath)
+		return "", err
+	}
+	for _, rec := range records {
+		if err := sw.Write(rec); err != nil {
+			return fail(err)
+		}
+	}
+	if sealed {
+		if err := sw.WriteFooter(); err != nil {
+			return fail(err)
+		}
+	}
+	checksum, err := sw.Finalize()
+	if err != nil {
+		return fail(err)
+	}
+	if err := sw.Close(); err != nil {
+		_ = os.Remove(tmpPath)
+		return "", fmt.Errorf("failed to close repaired segment: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return "", fmt.Errorf("failed to swap in repaired segment: %w", err)
+	}
+	return checksum, syncDir(dir)
+}
@@ -0,0 +1,196 @@
+package wal
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dsjohal14/selfstack/internal/relay"
+)
+
+// writeRepairSegment writes a segment of inserts at lsns, those in batched
+// marked as followed by more of their batch, and returns where each record
+// starts followed by where the records end
+func writeRepairSegment(t *testing.T, path string, sealed bool, batched map[uint64]bool, lsns ...uint64) []int64 {
+	t.Helper()
+	writer, err := NewSegmentWriter(path)
+	if err != nil {
+		t.Fatalf("failed to create segment writer: %v", err)
+	}
+	offsets := []int64{0}
+	for _, lsn := range lsns {
+		rec, _ := NewRecord(RecordTypeInsert, lsn, mustEncodeDocPayload(t, "doc", DocMetadata{Title: "repair"}, relay.Embedding{}))
+		rec.setBatch(batched[lsn])
+		_ = writer.Write(rec)
+		offsets = append(offsets, writer.Offset())
+	}
+	if sealed {
+		_ = writer.WriteFooter()
+	}
+	_, _ = writer.Finalize()
+	_ = writer.Close()
+	return offsets
+}
+
+// corruptRecord flips a byte of the payload of the record starting at offset
+func corruptRecord(t *testing.T, path string, offset int64) {
+	t.Helper()
+	data, _ := os.ReadFile(path)
+	data[offset+HeaderSize+2] ^= 0xFF
+	_ = os.WriteFile(path, data, 0o644)
+}
+
+// segmentLSNs returns the LSNs of the segment's records
+func segmentLSNs(t *testing.T, path string) []uint64 {
+	t.Helper()
+	records, err := ReadAllRecords(path)
+	if err != nil {
+		t.Fatalf("failed to read repaired segment: %v", err)
+	}
+	lsns := make([]uint64, len(records))
+	for i, rec := range records {
+		lsns[i] = rec.LSN
+	}
+	return lsns
+}
+
+func TestRepairSegment(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := filepath.Join(dir, SegmentFilename(1))
+	offsets := writeRepairSegment(t, path, true, nil, 1, 2, 3, 4, 5)
+	corruptRecord(t, path, offsets[2])
+	damaged, _ := os.ReadFile(path)
+
+	// A dry run reports the corrupt record and leaves the file alone
+	report, err := RepairSegment(ctx, path, RepairSegmentOptions{Resync: true, DryRun: true})
+	if err != nil {
+		t.Fatalf("RepairSegment failed: %v", err)
+	}
+	if len(report.Regions) != 1 || report.Regions[0].Offset != offsets[2] || report.DroppedBytes != offsets[3]-offsets[2] || report.Records != 4 {
+		t.Fatalf("unexpected dry run %+v", report)
+	}
+	if data, _ := os.ReadFile(path); !bytes.Equal(data, damaged) {
+		t.Fatal("dry run changed the segment")
+	}
+
+	manifest := NewInMemoryManifest()
+	_ = manifest.CreateSegment(ctx, 1, path)
+	_ = manifest.SealSegment(ctx, 1, "00000000")
+	report, err = RepairSegment(ctx, path, RepairSegmentOptions{Resync: true, Manifest: manifest})
+	if err != nil {
+		t.Fatalf("RepairSegment failed: %v", err)
+	}
+	if got := segmentLSNs(t, path); len(got) != 4 || got[1] != 2 || got[2] != 4 {
+		t.Errorf("expected LSNs 1 2 4 5, got %v", got)
+	}
+	if _, err := VerifySegmentFooter(path); err != nil || !report.Sealed {
+		t.Errorf("expected the segment sealed again: %v", err)
+	}
+
+	// The quarantine holds exactly the corrupt record
+	quarantined, err := os.ReadFile(filepath.Join(dir, report.Quarantine))
+	if err != nil || !bytes.Equal(quarantined, damaged[offsets[2]:offsets[3]]) {
+		t.Errorf("expected the corrupt record in %s: %v", report.Quarantine, err)
+	}
+
+	// The manifest has the new checksum, and recovery would accept it
+	info, _ := manifest.GetRecoveryInfo(ctx)
+	checksum, _ := CalculateSegmentChecksum(path)
+	if !report.Manifest || info.Segments[0].Checksum == nil || *info.Segments[0].Checksum != checksum || report.Checksum != checksum || info.Segments[0].RecordCount != 4 {
+		t.Errorf("expected the manifest updated to %s, got %+v", checksum, info.Segments[0])
+	}
+	events, _ := manifest.GetSegmentEvents(ctx, SegmentEventFilter{})
+	if len(events) == 0 || events[0].Reason == "" {
+		t.Errorf("expected a repair event, got %+v", events)
+	}
+
+	// A healthy segment is left as it is
+	if report, err := RepairSegment(ctx, path, RepairSegmentOptions{Resync: true}); err != nil || len(report.Regions) != 0 {
+		t.Errorf("expected nothing to repair, got %+v, %v", report, err)
+	}
+}
+
+func TestRepairSegmentCut(t *testing.T) {
+	ctx := context.Background()
+
+	// Without resync everything from the first corrupt record is dropped,
+	// footer included, and the segment is sealed again
+	dir := t.TempDir()
+	path := filepath.Join(dir, SegmentFilename(1))
+	offsets := writeRepairSegment(t, path, true, nil, 1, 2, 3, 4)
+	corruptRecord(t, path, offsets[1])
+	report, err := RepairSegment(ctx, path, RepairSegmentOptions{})
+	if err != nil {
+		t.Fatalf("RepairSegment failed: %v", err)
+	}
+	if got := segmentLSNs(t, path); len(got) != 1 || got[0] != 1 || report.DroppedBytes != offsets[4]-offsets[1] || !report.Sealed {
+		t.Errorf("expected only LSN 1 kept, got %v: %+v", got, report)
+	}
+
+	// A batch cut by a corrupt record is dropped whole, its records on
+	// both sides of it included; the active segment isn't sealed
+	path = filepath.Join(dir, SegmentFilename(2))
+	offsets = writeRepairSegment(t, path, false, map[uint64]bool{2: true, 3: true}, 1, 2, 3, 4, 5)
+	corruptRecord(t, path, offsets[2])
+	report, err = RepairSegment(ctx, path, RepairSegmentOptions{Resync: true})
+	if err != nil {
+		t.Fatalf("RepairSegment failed: %v", err)
+	}
+	if got := segmentLSNs(t, path); len(got) != 2 || got[0] != 1 || got[1] != 5 {
+		t.Errorf("expected LSNs 1 5, got %v", got)
+	}
+	if len(report.Regions) != 1 || report.Regions[0].Offset != offsets[1] || report.Regions[0].Bytes != offsets[4]-offsets[1] || report.DroppedRecords != 2 || report.Sealed {
+		t.Errorf("expected one region over the batch with its 2 valid records, got %+v", report)
+	}
+	if footer, _ := ReadSegmentFooter(path); footer != nil {
+		t.Error("expected the active segment left without a footer")
+	}
+}
+
+func TestRepairSegmentCompressed(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := filepath.Join(dir, SegmentFilename(1))
+	payload := mustEncodeDocPayload(t, "doc", DocMetadata{Text: strings.Repeat("repaired, compressed. ", 200)}, relay.Embedding{})
+	writer, err := NewSegmentWriter(path)
+	if err != nil {
+		t.Fatalf("failed to create segment writer: %v", err)
+	}
+	writer.SetCompression(CompressionZstd)
+	offsets := []int64{0}
+	for lsn := uint64(1); lsn <= 3; lsn++ {
+		rec, _ := NewRecord(RecordTypeInsert, lsn, payload)
+		_ = writer.Write(rec)
+		offsets = append(offsets, writer.Offset())
+	}
+	_, _ = writer.Finalize()
+	_ = writer.Close()
+	corruptRecord(t, path, offsets[1])
+
+	// The records kept are rewritten compressed, as they were stored
+	if _, err := RepairSegment(ctx, path, RepairSegmentOptions{Resync: true}); err != nil {
+		t.Fatalf("RepairSegment failed: %v", err)
+	}
+	records, err := ReadAllRecords(path)
+	if err != nil || len(records) != 2 || records[0].LSN != 1 || records[1].LSN != 3 {
+		t.Fatalf("expected LSNs 1 3, got %d records: %v", len(records), err)
+	}
+	for _, rec := range records {
+		if !bytes.Equal(rec.Payload, payload) || rec.DiskSize()*2 > rec.TotalSize() {
+			t.Errorf("LSN %d: expected the payload back from %d compressed bytes", rec.LSN, rec.DiskSize())
+		}
+	}
+
+	// An explicit compression overrides the segment's
+	corruptRecord(t, path, int64(records[0].DiskSize()))
+	if _, err := RepairSegment(ctx, path, RepairSegmentOptions{Resync: true, Compression: CompressionNone}); err != nil {
+		t.Fatalf("RepairSegment failed: %v", err)
+	}
+	if records, err = ReadAllRecords(path); err != nil || len(records) != 1 || records[0].DiskSize() != records[0].TotalSize() {
+		t.Errorf("expected LSN 1 rewritten uncompressed: %v", err)
+	}
+}
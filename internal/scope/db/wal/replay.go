@@ -0,0 +1,171 @@
+package wal
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Op is a WAL record decoded for offline analysis
+type Op struct {
+	LSN     uint64
+	At      HLC // Zero for records written before timestamps
+	Type    RecordType
+	Segment string // Base name of the segment file holding it
+	Origin  uint16 // Writing node; 0 when unattributed
+	Batch   bool   // More records of its atomic batch follow
+	Key     string // DocID, KV key, or collection name
+
+	Doc       *RecoveredDoc // Inserts and updates
+	Delete    *DeleteInfo   // Deletes
+	Value     []byte        // KV sets, and collection configs as JSON
+	KVDeleted bool          // KV records that delete their key
+}
+
+// ScanOps calls fn with each record in dir's segments up to target, in the
+// order the segments are listed: by LSN within a segment, but compacted
+// segments hold records from across the ones they replaced. Records that
+// appear in two segments, as while a compacted segment sits beside its
+// sources, are reported once. Records compaction dropped are gone, and
+// snapshots aren't read.
+func ScanOps(dir string, target RecoveryTarget, fn func(Op) error) error {
+	segments, err := ListSegmentFiles(dir)
+	if err != nil {
+		return fmt.Errorf("failed to list segment files: %w", err)
+	}
+
+	var until HLC
+	if !target.Time.IsZero() {
+		until = NewHLC(target.Time, ^uint16(0))
+	}
+	seen := make(map[uint64]bool)
+	for _, path := range segments {
+		iter, err := NewSegmentIterator(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return fmt.Errorf("failed to open segment %s: %w", path, err)
+		}
+		iter.EnableResync()
+		segment := filepath.Base(path)
+		for iter.Next() {
+			rec := iter.Record()
+			if seen[rec.LSN] || (target.LSN > 0 && rec.LSN > target.LSN) {
+				continue
+			}
+			if ts, ok := rec.TimestampHLC(); ok && until != 0 && ts > until {
+				continue
+			}
+			seen[rec.LSN] = true
+
+			op, err := decodeOp(rec, segment)
+			if err == nil {
+				err = fn(op)
+			}
+			if err != nil {
+				_ = iter.Close()
+				return fmt.Errorf("record %d in %s: %w", rec.LSN, segment, err)
+			}
+		}
+		err = iter.Err()
+		_ = iter.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read segment %s: %w", segment, err)
+		}
+	}
+	return nil
+}
+
+// decodeOp decodes rec's payload by its type
+func decodeOp(rec *Record, segment string) (Op, error) {
+	op := Op{LSN: rec.LSN, Type: rec.Type, Segment: segment, Batch: rec.InBatch()}
+	op.At, _ = rec.TimestampHLC()
+	op.Origin, _ = rec.OriginNode()
+
+	var err error
+	switch {
+	case rec.Type == RecordTypeInsert || rec.Type == RecordTypeUpdate:
+		var doc RecoveredDoc
+		if err = decodeDocPayloadInto(rec.Payload, &doc); err == nil {
+			doc.LSN = rec.LSN
+			op.Key, op.Doc = doc.DocID, &doc
+		}
+	case rec.Type == RecordTypeDelete:
+		var info DeleteInfo
+		if op.Key, err = DecodeDeletePayload(rec.Payload); err == nil {
+			info, err = DecodeDeleteInfo(rec.Payload)
+			op.Delete = &info
+		}
+	case rec.Type == RecordTypeKV:
+		op.Key, op.Value, op.KVDeleted, err = DecodeKVPayload(rec.Payload)
+	case isSchemaRecord(rec.Type):
+		op.Key, op.Value, err = DecodeSchemaPayload(rec.Payload)
+	}
+	return op, err
+}
+
+// ReplayedDocs is the document state a replay of a WAL directory ends with
+type ReplayedDocs struct {
+	Docs    []RecoveredDoc // Live documents by ID, each with the LSN it was last written at
+	Deleted []string       // IDs of documents the replay saw deleted and not written again
+	Stats   *RecoveryStats
+}
+
+// ReplayDocs rebuilds the documents of the WAL in dir as recovery would,
+// without a manifest or a server: from the latest snapshot for the end of
+// the WAL, or from every segment up to target (see RecoverTo). Nothing in
+// dir is modified.
+func ReplayDocs(ctx context.Context, dir string, target RecoveryTarget) (*ReplayedDocs, error) {
+	index := &replayIndex{docs: make(map[string]RecoveredDoc), deleted: make(map[string]bool)}
+	rm := NewRecoveryManager(NewInMemoryManifest(), dir, index)
+	var stats *RecoveryStats
+	var err error
+	if target.IsZero() {
+		stats, err = rm.RecoverWithoutManifest(ctx)
+	} else {
+		stats, err = rm.RecoverTo(ctx, target)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	out := &ReplayedDocs{Stats: stats}
+	for _, doc := range index.docs {
+		out.Docs = append(out.Docs, doc)
+	}
+	sort.Slice(out.Docs, func(i, j int) bool { return out.Docs[i].DocID < out.Docs[j].DocID })
+	for id := range index.deleted {
+		out.Deleted = append(out.Deleted, id)
+	}
+	sort.Strings(out.Deleted)
+	return out, nil
+}
+
+// replayIndex is the DocumentIndex of ReplayDocs, which also remembers
+// the documents deleted along the way
+type replayIndex struct {
+	docs    map[string]RecoveredDoc
+	deleted map[string]bool
+}
+
+func (x *replayIndex) SetRecovered(doc *RecoveredDoc) {
+	x.docs[doc.DocID] = *doc // Each record decodes a fresh Metadata map
+	delete(x.deleted, doc.DocID)
+}
+
+func (x *replayIndex) Delete(docID string) {
+	delete(x.docs, docID)
+	x.deleted[docID] = true
+}
+
+func (x *replayIndex) Has(docID string) bool {
+	_, ok := x.docs[docID]
+	return ok
+}
+
+func (x *replayIndex) Count() int {
+	return len(x.docs)
+}
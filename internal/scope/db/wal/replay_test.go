@@ -0,0 +1,90 @@
+package wal
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/relay"
+)
+
+func TestReplay(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	at := func(hour int) time.Time { return time.Date(2026, 3, 1, hour, 0, 0, 0, time.UTC) }
+
+	del, _ := EncodeDeletePayloadWithInfo("b", DeleteInfo{DeletedAt: at(15), DeletedBy: "key_0123456789ab"})
+	kv, _ := EncodeKVPayload("flags/beta", []byte("on"), false)
+	records := []struct {
+		typ     RecordType
+		payload []byte
+		hour    int
+	}{
+		{RecordTypeInsert, mustEncodeDocPayload(t, "a", DocMetadata{Title: "first", Collection: "notes"}, relay.Embedding{}), 13},
+		{RecordTypeInsert, mustEncodeDocPayload(t, "b", DocMetadata{Title: "doomed"}, relay.Embedding{}), 13},
+		{RecordTypeKV, kv, 14},
+		{RecordTypeUpdate, mustEncodeDocPayload(t, "a", DocMetadata{Title: "second", Collection: "notes"}, relay.Embedding{}), 14},
+		{RecordTypeDelete, del, 15},
+	}
+	writer, err := NewSegmentWriter(filepath.Join(dir, SegmentFilename(1)))
+	if err != nil {
+		t.Fatalf("failed to create segment writer: %v", err)
+	}
+	for i, r := range records {
+		rec, _ := NewRecord(r.typ, uint64(i+1), r.payload)
+		rec.SetTimestamp(NewHLC(at(r.hour), 0))
+		_ = writer.Write(rec)
+	}
+	_, _ = writer.Finalize()
+	_ = writer.Close()
+
+	var ops []Op
+	if err := ScanOps(dir, RecoveryTarget{}, func(op Op) error {
+		ops = append(ops, op)
+		return nil
+	}); err != nil {
+		t.Fatalf("ScanOps failed: %v", err)
+	}
+	if len(ops) != len(records) {
+		t.Fatalf("expected %d ops, got %+v", len(records), ops)
+	}
+	if op := ops[3]; op.Key != "a" || op.Doc == nil || op.Doc.Title != "second" || op.Doc.LSN != 4 || op.Segment != SegmentFilename(1) {
+		t.Errorf("unexpected update op %+v", op)
+	}
+	if op := ops[2]; op.Key != "flags/beta" || string(op.Value) != "on" {
+		t.Errorf("unexpected KV op %+v", op)
+	}
+	if op := ops[4]; op.Key != "b" || op.Delete == nil || op.Delete.DeletedBy != "key_0123456789ab" || !op.At.Wall().Equal(at(15)) {
+		t.Errorf("unexpected delete op %+v", op)
+	}
+
+	ops = ops[:0]
+	_ = ScanOps(dir, RecoveryTarget{Time: at(13)}, func(op Op) error {
+		ops = append(ops, op)
+		return nil
+	})
+	if len(ops) != 2 {
+		t.Errorf("expected the two ops up to 13:00, got %d", len(ops))
+	}
+
+	replayed, err := ReplayDocs(ctx, dir, RecoveryTarget{})
+	if err != nil {
+		t.Fatalf("ReplayDocs failed: %v", err)
+	}
+	if len(replayed.Docs) != 1 || replayed.Docs[0].Title != "second" || replayed.Docs[0].LSN != 4 || replayed.Docs[0].Collection != "notes" {
+		t.Errorf("expected a at its update, got %+v", replayed.Docs)
+	}
+	if len(replayed.Deleted) != 1 || replayed.Deleted[0] != "b" {
+		t.Errorf("expected b deleted, got %v", replayed.Deleted)
+	}
+
+	// Up to LSN 2, both documents are live at their inserts
+	replayed, err = ReplayDocs(ctx, dir, RecoveryTarget{LSN: 2})
+	if err != nil {
+		t.Fatalf("ReplayDocs failed: %v", err)
+	}
+	if len(replayed.Docs) != 2 || replayed.Docs[0].Title != "first" || len(replayed.Deleted) != 0 || replayed.Stats.SkippedAfter != 3 {
+		t.Errorf("unexpected replay to LSN 2: %+v, %+v", replayed.Docs, replayed.Stats)
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"sort"
 	"strings"
 	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/clock"
 )
 
 // SegmentRoller handles segment lifecycle operations
@@ -17,6 +19,7 @@ type SegmentRoller struct {
 	maxSize     int64
 	maxAge      time.Duration // Max age before forcing rotation (0 = disabled)
 	maxSegments int           // Max number of sealed segments before cleanup (0 = disabled)
+	clock       clock.Clock   // Segment ages are measured on it
 }
 
 // SegmentRollerOption configures a SegmentRoller
@@ -36,12 +39,20 @@ func WithMaxSegments(n int) SegmentRollerOption {
 	}
 }
 
+// WithRollerClock measures segment ages on c instead of the system clock
+func WithRollerClock(c clock.Clock) SegmentRollerOption {
+	return func(r *SegmentRoller) {
+		r.clock = c
+	}
+}
+
 // NewSegmentRoller creates a new segment roller
 func NewSegmentRoller(dir string, manifest ManifestStore, opts ...SegmentRollerOption) *SegmentRoller {
 	r := &SegmentRoller{
 		dir:      dir,
 		manifest: manifest,
 		maxSize:  DefaultMaxSegmentSize,
+		clock:    clock.System(),
 	}
 
 	for _, opt := range opts {
@@ -64,7 +75,7 @@ func (r *SegmentRoller) ShouldRotate(segmentPath string, createdAt time.Time) (b
 	}
 
 	// Check age
-	if r.maxAge > 0 && time.Since(createdAt) >= r.maxAge {
+	if r.maxAge > 0 && clock.Since(r.clock, createdAt) >= r.maxAge {
 		return true, "age limit exceeded", nil
 	}
 
@@ -185,9 +196,15 @@ func (r *SegmentRoller) CleanupOldSegments(ctx context.Context) (int, error) {
 		if err := os.Remove(seg.Filename); err != nil && !os.IsNotExist(err) {
 			return deleted, fmt.Errorf("failed to delete segment file %s: %w", seg.Filename, err)
 		}
+		_ = os.Remove(seg.Filename + BloomSuffix)
 		deleted++
 	}
 
+	if deleted > 0 {
+		if err := syncDir(r.dir); err != nil {
+			return deleted, err
+		}
+	}
 	return deleted, nil
 }
 
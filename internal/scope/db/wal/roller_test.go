@@ -4,6 +4,9 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/clock"
 )
 
 func TestSegmentFilename(t *testing.T) {
@@ -279,3 +282,22 @@ func TestIsCompactedSegment(t *testing.T) {
 		}
 	}
 }
+
+func TestSegmentRollerMaxAge(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, SegmentFilename(1))
+	if err := os.WriteFile(path, []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fake := clock.NewFake(time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC))
+	created := fake.Now()
+	roller := NewSegmentRoller(dir, nil, WithMaxAge(time.Hour), WithRollerClock(fake))
+
+	if rotate, _, err := roller.ShouldRotate(path, created); err != nil || rotate {
+		t.Fatalf("expected a new segment kept, got %v, %v", rotate, err)
+	}
+	fake.Advance(time.Hour)
+	if rotate, reason, _ := roller.ShouldRotate(path, created); !rotate || reason != "age limit exceeded" {
+		t.Errorf("expected rotation after the max age, got %v %q", rotate, reason)
+	}
+}
@@ -0,0 +1,74 @@
+package wal
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Collection records log configuration changes in the same stream as the
+// documents they govern, so a cold start recovers which collections exist
+// and which embedding model their documents were written with. The payload
+// is the length-prefixed collection name (laid out like a DocID) followed by
+// the collection's config as the registry stores it; deletes carry only the
+// name.
+
+// schemaKeyPrefix and modelKeyPrefix keep collection names apart from
+// DocIDs and KV keys when all are tracked in one map. Embedder changes are
+// tracked on their own so compaction keeps the newest one even after later
+// changes to other settings.
+const (
+	schemaKeyPrefix = "\x00collection\x00"
+	modelKeyPrefix  = "\x00embedder\x00"
+)
+
+// SchemaEvent is a collection record as recovery applies it
+type SchemaEvent struct {
+	Type       RecordType // RecordTypeCollection, RecordTypeCollectionDelete, or RecordTypeEmbedderChange
+	LSN        uint64
+	Collection string
+	Config     []byte // Empty for deletes
+}
+
+// SchemaIndex is the in-memory state of the collections logged in the WAL
+type SchemaIndex interface {
+	ApplySchema(ev SchemaEvent)
+}
+
+// isSchemaRecord reports whether the record type is a collection event
+func isSchemaRecord(t RecordType) bool {
+	return t == RecordTypeCollection || t == RecordTypeCollectionDelete || t == RecordTypeEmbedderChange
+}
+
+// schemaKey returns what a collection record is tracked by in recovery and
+// compaction
+func schemaKey(t RecordType, name string) string {
+	if t == RecordTypeEmbedderChange {
+		return modelKeyPrefix + name
+	}
+	return schemaKeyPrefix + name
+}
+
+// EncodeSchemaPayload serializes a collection record payload
+func EncodeSchemaPayload(name string, config []byte) ([]byte, error) {
+	if name == "" || len(name) > MaxDocIDLen {
+		return nil, fmt.Errorf("invalid collection name length: %d", len(name))
+	}
+	buf := make([]byte, 2+len(name)+len(config))
+	binary.LittleEndian.PutUint16(buf, uint16(len(name)))
+	copy(buf[2:], name)
+	copy(buf[2+len(name):], config)
+	return buf, nil
+}
+
+// DecodeSchemaPayload deserializes a collection record payload. The config
+// is a copy.
+func DecodeSchemaPayload(data []byte) (name string, config []byte, err error) {
+	id, err := payloadDocID(data)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(id) == 0 {
+		return "", nil, fmt.Errorf("collection payload has no name")
+	}
+	return string(id), append([]byte{}, data[2+len(id):]...), nil
+}
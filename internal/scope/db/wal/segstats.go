@@ -0,0 +1,333 @@
+package wal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SizeBuckets are the upper bounds of the record size histogram; larger
+// records fall in a final, unbounded bucket
+var SizeBuckets = []int64{256, 1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20}
+
+// AgeBuckets are the upper bounds of the record age histogram; older
+// records fall in a final, unbounded bucket
+var AgeBuckets = []time.Duration{time.Hour, 24 * time.Hour, 7 * 24 * time.Hour, 30 * 24 * time.Hour, 90 * 24 * time.Hour}
+
+// Bucket is one bar of a histogram
+type Bucket struct {
+	Label string `json:"label"` // e.g. "<=4KiB", ">1MiB", "<=7d"
+	Count int    `json:"count"`
+	Bytes int64  `json:"bytes"`
+}
+
+// RecordCounts breaks down a set of records by type
+type RecordCounts struct {
+	Records     int            `json:"records"`
+	Bytes       int64          `json:"bytes"` // Record sizes as stored, compressed or not
+	Types       map[string]int `json:"types"` // Records per type, e.g. "INSERT"
+	DeadRecords int            `json:"dead_records"`
+	DeadBytes   int64          `json:"dead_bytes"`
+	DeadRatio   float64        `json:"dead_ratio"` // DeadBytes / Bytes
+}
+
+// SegmentStats describes one segment file
+type SegmentStats struct {
+	RecordCounts
+	Segment      string     `json:"segment"`    // Base name of the file
+	FileBytes    int64      `json:"file_bytes"` // On disk
+	Compacted    bool       `json:"compacted"`
+	Footer       bool       `json:"footer"` // Sealed with a footer
+	MinLSN       uint64     `json:"min_lsn"`
+	MaxLSN       uint64     `json:"max_lsn"`
+	Oldest       *time.Time `json:"oldest,omitempty"` // Of the timestamped records
+	Newest       *time.Time `json:"newest,omitempty"`
+	Undecoded    int        `json:"undecoded,omitempty"`     // Records whose payload didn't decode, so not attributed to a key
+	Corrupt      int        `json:"corrupt,omitempty"`       // Corrupt regions skipped
+	SkippedBytes int64      `json:"skipped_bytes,omitempty"` // Size of the corrupt regions
+	Error        string     `json:"error,omitempty"`         // Why reading stopped early
+}
+
+// HotKey is a key with many records in the WAL
+type HotKey struct {
+	Key     string `json:"key"`
+	Kind    string `json:"kind"`   // doc, kv, collection, or embedder
+	Writes  int    `json:"writes"` // Records for the key, including deletes
+	Bytes   int64  `json:"bytes"`
+	LastLSN uint64 `json:"last_lsn"`
+	Deleted bool   `json:"deleted,omitempty"` // Its latest record is a delete
+}
+
+// WALStats describes the segments of a WAL directory, for compaction
+// tuning and capacity planning
+type WALStats struct {
+	RecordCounts
+	FileBytes     int64          `json:"file_bytes"`
+	Segments      []SegmentStats `json:"segments"`
+	SizeHistogram []Bucket       `json:"size_histogram"` // Records by encoded size
+	AgeHistogram  []Bucket       `json:"age_histogram"`  // Records by timestamp age; untimestamped ones are in "unknown"
+	DistinctKeys  int            `json:"distinct_keys"`  // Documents, KV entries, and collections written
+	LiveKeys      int            `json:"live_keys"`      // Whose latest record isn't a delete
+	Tombstones    int            `json:"tombstones"`     // Whose latest record is a delete
+	HotKeys       []HotKey       `json:"hot_keys"`       // Most-written keys, most first
+	Snapshots     int            `json:"snapshots"`
+	SnapshotBytes int64          `json:"snapshot_bytes"`
+}
+
+// ScanStats reads every segment in dir and summarizes its records, with
+// ages relative to now and the hotKeys most-written keys. A record is dead,
+// as for a compaction plan, when it's a checkpoint or a newer record for
+// its key exists; a segment that is mostly dead is worth compacting.
+// Corrupt regions are skipped and counted, so a damaged directory can be
+// inspected. Only keys, LSNs and sizes are kept in memory.
+func ScanStats(dir string, now time.Time, hotKeys int) (*WALStats, error) {
+	paths, err := ListSegmentFiles(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list segment files: %w", err)
+	}
+
+	type latest struct {
+		lsn    uint64
+		size   int64
+		seg    int // Index into stats.Segments
+		del    bool
+		writes int
+		bytes  int64
+		kind   string
+	}
+	keys := make(map[string]*latest)
+	stats := &WALStats{
+		RecordCounts:  RecordCounts{Types: make(map[string]int)},
+		Segments:      make([]SegmentStats, 0, len(paths)),
+		SizeHistogram: sizeHistogram(),
+		AgeHistogram:  ageHistogram(),
+	}
+	dead := func(seg *SegmentStats, size int64) {
+		seg.DeadRecords++
+		seg.DeadBytes += size
+		stats.DeadRecords++
+		stats.DeadBytes += size
+	}
+
+	for i, path := range paths {
+		stats.Segments = append(stats.Segments, SegmentStats{
+			RecordCounts: RecordCounts{Types: make(map[string]int)},
+			Segment:      filepath.Base(path),
+			Compacted:    IsCompactedSegment(path),
+		})
+		seg := &stats.Segments[i]
+		if info, err := os.Stat(path); err == nil {
+			seg.FileBytes = info.Size()
+			stats.FileBytes += info.Size()
+		}
+
+		iter, err := NewSegmentIterator(path)
+		if err != nil {
+			seg.Error = err.Error()
+			continue
+		}
+		iter.EnableResync()
+		seg.Footer = iter.Footer() != nil
+		for iter.Next() {
+			rec := iter.Record()
+			size := int64(rec.DiskSize())
+			seg.count(rec, size)
+			stats.count(rec, size)
+			countSize(stats.SizeHistogram, size)
+			if ts, ok := rec.TimestampHLC(); ok {
+				wall := ts.Wall().UTC()
+				if seg.Oldest == nil || wall.Before(*seg.Oldest) {
+					seg.Oldest = &wall
+				}
+				if seg.Newest == nil || wall.After(*seg.Newest) {
+					seg.Newest = &wall
+				}
+				countAge(stats.AgeHistogram, now.Sub(wall), size)
+			} else {
+				last := &stats.AgeHistogram[len(stats.AgeHistogram)-1]
+				last.Count++
+				last.Bytes += size
+			}
+
+			if rec.Type == RecordTypeCheckpoint {
+				dead(seg, size)
+				continue
+			}
+			key, ok, err := liveKey(rec)
+			if err != nil {
+				seg.Undecoded++
+				continue
+			}
+			if !ok {
+				continue
+			}
+			prev := keys[key]
+			if prev == nil {
+				prev = &latest{seg: -1, kind: keyKind(rec.Type)}
+				keys[key] = prev
+			}
+			if prev.seg < 0 || prev.lsn != rec.LSN {
+				// Not a copy, as in a compacted segment beside its sources
+				prev.writes++
+				prev.bytes += size
+			}
+			if prev.seg >= 0 && prev.lsn >= rec.LSN {
+				// Older record seen after a newer one; it is the dead one
+				dead(seg, size)
+				continue
+			}
+			if prev.seg >= 0 {
+				dead(&stats.Segments[prev.seg], prev.size)
+			}
+			prev.lsn, prev.size, prev.seg = rec.LSN, size, i
+			prev.del = rec.Type == RecordTypeDelete || rec.Type == RecordTypeCollectionDelete || (rec.Type == RecordTypeKV && kvDeleted(rec))
+		}
+		seg.Corrupt, seg.SkippedBytes = iter.Resyncs(), iter.SkippedBytes()
+		if err := iter.Err(); err != nil {
+			seg.Error = err.Error()
+		}
+		_ = iter.Close()
+	}
+
+	stats.DistinctKeys = len(keys)
+	hot := make([]HotKey, 0, len(keys))
+	for key, k := range keys {
+		if k.del {
+			stats.Tombstones++
+		} else {
+			stats.LiveKeys++
+		}
+		hot = append(hot, HotKey{Key: displayKey(key), Kind: k.kind, Writes: k.writes, Bytes: k.bytes, LastLSN: k.lsn, Deleted: k.del})
+	}
+	sort.Slice(hot, func(i, j int) bool {
+		if hot[i].Writes != hot[j].Writes {
+			return hot[i].Writes > hot[j].Writes
+		}
+		return hot[i].Key < hot[j].Key
+	})
+	if len(hot) > hotKeys {
+		hot = hot[:hotKeys]
+	}
+	stats.HotKeys = hot
+
+	stats.ratio()
+	for i := range stats.Segments {
+		stats.Segments[i].ratio()
+	}
+
+	snaps, err := ListSnapshots(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, snap := range snaps {
+		if info, err := os.Stat(snap.Path); err == nil {
+			stats.Snapshots++
+			stats.SnapshotBytes += info.Size()
+		}
+	}
+	return stats, nil
+}
+
+func (c *RecordCounts) count(rec *Record, size int64) {
+	c.Records++
+	c.Bytes += size
+	c.Types[rec.Type.String()]++
+}
+
+func (c *RecordCounts) ratio() {
+	if c.Bytes > 0 {
+		c.DeadRatio = float64(c.DeadBytes) / float64(c.Bytes)
+	}
+}
+
+// count also tracks the segment's LSN range
+func (s *SegmentStats) count(rec *Record, size int64) {
+	if s.Records == 0 || rec.LSN < s.MinLSN {
+		s.MinLSN = rec.LSN
+	}
+	if rec.LSN > s.MaxLSN {
+		s.MaxLSN = rec.LSN
+	}
+	s.RecordCounts.count(rec, size)
+}
+
+func sizeHistogram() []Bucket {
+	buckets := make([]Bucket, 0, len(SizeBuckets)+1)
+	for _, upTo := range SizeBuckets {
+		buckets = append(buckets, Bucket{Label: "<=" + formatSize(upTo)})
+	}
+	return append(buckets, Bucket{Label: ">" + formatSize(SizeBuckets[len(SizeBuckets)-1])})
+}
+
+func ageHistogram() []Bucket {
+	buckets := make([]Bucket, 0, len(AgeBuckets)+2)
+	for _, upTo := range AgeBuckets {
+		buckets = append(buckets, Bucket{Label: "<=" + formatAge(upTo)})
+	}
+	return append(buckets, Bucket{Label: ">" + formatAge(AgeBuckets[len(AgeBuckets)-1])}, Bucket{Label: "unknown"})
+}
+
+func countSize(buckets []Bucket, size int64) {
+	i := sort.Search(len(SizeBuckets), func(i int) bool { return size <= SizeBuckets[i] })
+	buckets[i].Count++
+	buckets[i].Bytes += size
+}
+
+// countAge puts records from the future, as from a skewed clock, in the
+// first bucket
+func countAge(buckets []Bucket, age time.Duration, size int64) {
+	i := sort.Search(len(AgeBuckets), func(i int) bool { return age <= AgeBuckets[i] })
+	buckets[i].Count++
+	buckets[i].Bytes += size
+}
+
+// formatSize prints a power-of-two size, e.g. 4KiB
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<20 && n%(1<<20) == 0:
+		return fmt.Sprintf("%dMiB", n>>20)
+	case n >= 1<<10 && n%(1<<10) == 0:
+		return fmt.Sprintf("%dKiB", n>>10)
+	}
+	return fmt.Sprintf("%dB", n)
+}
+
+// formatAge prints a whole number of days or hours, e.g. 7d
+func formatAge(d time.Duration) string {
+	if d >= 24*time.Hour && d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	}
+	return fmt.Sprintf("%dh", d/time.Hour)
+}
+
+// keyKind names the namespace of a record's live key
+func keyKind(t RecordType) string {
+	switch {
+	case t == RecordTypeKV:
+		return "kv"
+	case t == RecordTypeEmbedderChange:
+		return "embedder"
+	case isSchemaRecord(t):
+		return "collection"
+	}
+	return "doc"
+}
+
+// displayKey strips the namespace prefix liveKey adds
+func displayKey(key string) string {
+	for _, prefix := range []string{kvKeyPrefix, schemaKeyPrefix, modelKeyPrefix} {
+		if rest, ok := strings.CutPrefix(key, prefix); ok {
+			return rest
+		}
+	}
+	return key
+}
+
+// kvDeleted reports whether a KV record deletes its key
+func kvDeleted(rec *Record) bool {
+	_, _, deleted, err := DecodeKVPayload(rec.Payload)
+	return err == nil && deleted
+}
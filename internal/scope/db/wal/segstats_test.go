@@ -0,0 +1,146 @@
+package wal
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/relay"
+)
+
+func TestScanStats(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	del, _ := EncodeDeletePayload("b")
+	kv, _ := EncodeKVPayload("flags/beta", []byte("on"), false)
+	big := mustEncodeDocPayload(t, "c", DocMetadata{Text: strings.Repeat("x", 5000)}, relay.Embedding{})
+	segments := [][]struct {
+		typ     RecordType
+		payload []byte
+		age     time.Duration
+	}{
+		{
+			{RecordTypeInsert, mustEncodeDocPayload(t, "a", DocMetadata{Title: "v1"}, relay.Embedding{}), 10 * 24 * time.Hour},
+			{RecordTypeInsert, mustEncodeDocPayload(t, "b", DocMetadata{}, relay.Embedding{}), 10 * 24 * time.Hour},
+			{RecordTypeUpdate, mustEncodeDocPayload(t, "a", DocMetadata{Title: "v2"}, relay.Embedding{}), 2 * 24 * time.Hour},
+			{RecordTypeCheckpoint, nil, 0},
+		},
+		{
+			{RecordTypeUpdate, mustEncodeDocPayload(t, "a", DocMetadata{Title: "v3"}, relay.Embedding{}), 30 * time.Minute},
+			{RecordTypeDelete, del, 30 * time.Minute},
+			{RecordTypeKV, kv, 30 * time.Minute},
+			{RecordTypeInsert, big, 30 * time.Minute},
+		},
+	}
+	lsn := uint64(0)
+	for i, records := range segments {
+		writer, err := NewSegmentWriter(filepath.Join(dir, SegmentFilename(uint64(i+1))))
+		if err != nil {
+			t.Fatalf("failed to create segment writer: %v", err)
+		}
+		for _, r := range records {
+			lsn++
+			rec, _ := NewRecord(r.typ, lsn, r.payload)
+			if r.age > 0 {
+				rec.SetTimestamp(NewHLC(now.Add(-r.age), 0))
+			}
+			_ = writer.Write(rec)
+		}
+		_, _ = writer.Finalize()
+		_ = writer.Close()
+	}
+
+	stats, err := ScanStats(dir, now, 2)
+	if err != nil {
+		t.Fatalf("ScanStats failed: %v", err)
+	}
+	if stats.Records != 8 || stats.Types["INSERT"] != 3 || stats.Types["UPDATE"] != 2 || stats.Types["CHECKPOINT"] != 1 {
+		t.Errorf("unexpected totals %+v", stats.RecordCounts)
+	}
+	// a's first two records, b's insert, and the checkpoint are dead
+	if stats.DeadRecords != 4 || stats.Segments[0].DeadRecords != 4 || stats.Segments[1].DeadRecords != 0 {
+		t.Errorf("expected the 4 dead records in the first segment, got %d: %+v", stats.DeadRecords, stats.Segments)
+	}
+	if stats.Segments[0].DeadRatio != 1 {
+		t.Errorf("expected the first segment fully dead, got %v", stats.Segments[0].DeadRatio)
+	}
+	if seg := stats.Segments[1]; seg.MinLSN != 5 || seg.MaxLSN != 8 || !seg.Oldest.Equal(now.Add(-30*time.Minute)) {
+		t.Errorf("unexpected second segment %+v", seg)
+	}
+	if stats.DistinctKeys != 4 || stats.LiveKeys != 3 || stats.Tombstones != 1 {
+		t.Errorf("expected 3 live keys and a tombstone, got %+v", stats)
+	}
+	if len(stats.HotKeys) != 2 || stats.HotKeys[0].Key != "a" || stats.HotKeys[0].Writes != 3 || stats.HotKeys[1].Key != "b" {
+		t.Errorf("expected a then b as hot keys, got %+v", stats.HotKeys)
+	}
+
+	// <=1h: the second segment; <=7d: a's update; <=30d: the inserts
+	age := map[string]int{}
+	for _, b := range stats.AgeHistogram {
+		age[b.Label] = b.Count
+	}
+	if age["<=1h"] != 4 || age["<=7d"] != 1 || age["<=30d"] != 2 || age["unknown"] != 1 {
+		t.Errorf("unexpected age histogram %+v", stats.AgeHistogram)
+	}
+	size := map[string]int{}
+	for _, b := range stats.SizeHistogram {
+		size[b.Label] = b.Count
+	}
+	if size["<=16KiB"] != 1 {
+		t.Errorf("expected the 5KB document in <=16KiB, got %+v", stats.SizeHistogram)
+	}
+}
+
+func TestScanStatsCompressed(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	manifest := NewInMemoryManifest()
+
+	// Two segments rewriting the same document, stored compressed
+	text := strings.Repeat("the same paragraph, over and over. ", 300)
+	for segID := uint64(1); segID <= 2; segID++ {
+		path := filepath.Join(dir, SegmentFilename(segID))
+		writer, err := NewSegmentWriter(path)
+		if err != nil {
+			t.Fatalf("failed to create segment writer: %v", err)
+		}
+		writer.SetCompression(CompressionZstd)
+		rec, _ := NewRecord(RecordTypeUpdate, segID, mustEncodeDocPayload(t, "a", DocMetadata{Text: text}, relay.Embedding{}))
+		_ = writer.Write(rec)
+		checksum, _ := writer.Finalize()
+		_ = writer.Close()
+		_ = manifest.CreateSegment(ctx, segID, path)
+		_ = manifest.SealSegment(ctx, segID, checksum)
+	}
+
+	records, err := ReadAllRecords(filepath.Join(dir, SegmentFilename(1)))
+	if err != nil || len(records) != 1 {
+		t.Fatalf("failed to read records: %v", err)
+	}
+	if rec := records[0]; rec.DiskSize()*2 > rec.TotalSize() {
+		t.Errorf("record takes %d bytes on disk, %d decompressed", rec.DiskSize(), rec.TotalSize())
+	}
+
+	// Record sizes count what's on disk, so they fit in the files
+	stats, err := ScanStats(dir, time.Now(), 0)
+	if err != nil {
+		t.Fatalf("ScanStats failed: %v", err)
+	}
+	if stats.Bytes == 0 || stats.Bytes > stats.FileBytes {
+		t.Errorf("records are %d bytes in %d bytes of segments", stats.Bytes, stats.FileBytes)
+	}
+	if stats.DeadBytes != int64(records[0].DiskSize()) {
+		t.Errorf("expected the first version's %d bytes dead, got %d", records[0].DiskSize(), stats.DeadBytes)
+	}
+
+	plan, err := NewCompactor(manifest, nil, dir, DefaultCompactorConfig()).Plan(ctx)
+	if err != nil {
+		t.Fatalf("plan failed: %v", err)
+	}
+	if plan.InputBytes != stats.Bytes {
+		t.Errorf("plan reads %d input bytes, stats %d", plan.InputBytes, stats.Bytes)
+	}
+}
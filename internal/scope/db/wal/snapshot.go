@@ -0,0 +1,167 @@
+package wal
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A snapshot holds the state recovery rebuilds from every record up to a
+// checkpoint: one record per live document, KV entry, and collection,
+// written in the segment format and ended by a copy of the checkpoint
+// record. Recovery loads the latest snapshot whose checkpoint is still in
+// the WAL and replays only the records after it.
+
+const (
+	snapshotPrefix = "snapshot_"
+	snapshotSuffix = ".snap"
+)
+
+// SnapshotFilename returns the name of the snapshot taken at the checkpoint
+// with LSN lsn; checksum covers the whole file
+func SnapshotFilename(lsn uint64, checksum string) string {
+	return fmt.Sprintf("%s%012d_%s%s", snapshotPrefix, lsn, checksum, snapshotSuffix)
+}
+
+// parseSnapshotFilename returns the checkpoint LSN and checksum in a
+// snapshot's name
+func parseSnapshotFilename(name string) (uint64, string, bool) {
+	if !strings.HasPrefix(name, snapshotPrefix) || !strings.HasSuffix(name, snapshotSuffix) {
+		return 0, "", false
+	}
+	rest := strings.TrimSuffix(strings.TrimPrefix(name, snapshotPrefix), snapshotSuffix)
+	lsnPart, checksum, ok := strings.Cut(rest, "_")
+	if !ok || checksum == "" {
+		return 0, "", false
+	}
+	lsn, err := strconv.ParseUint(lsnPart, 10, 64)
+	if err != nil {
+		return 0, "", false
+	}
+	return lsn, checksum, true
+}
+
+// SnapshotInfo is a snapshot file
+type SnapshotInfo struct {
+	Path     string
+	LSN      uint64 // Of the checkpoint it was taken at
+	Checksum string
+}
+
+// ListSnapshots returns the snapshots in dir, newest first
+func ListSnapshots(dir string) ([]SnapshotInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+	var snaps []SnapshotInfo
+	for _, entry := range entries {
+		if lsn, checksum, ok := parseSnapshotFilename(entry.Name()); ok && !entry.IsDir() {
+			snaps = append(snaps, SnapshotInfo{Path: filepath.Join(dir, entry.Name()), LSN: lsn, Checksum: checksum})
+		}
+	}
+	sort.Slice(snaps, func(i, j int) bool { return snaps[i].LSN > snaps[j].LSN })
+	return snaps, nil
+}
+
+// SnapshotWriter writes a snapshot to a temporary file that Commit renames
+// into place, so a snapshot cut short by a crash is never loaded
+type SnapshotWriter struct {
+	dir string
+	lsn uint64
+	tmp string
+	w   *SegmentWriter
+}
+
+// NewSnapshotWriter starts a snapshot in dir of the state as of the
+// checkpoint record with LSN lsn
+func NewSnapshotWriter(dir string, lsn uint64, c Compression) (*SnapshotWriter, error) {
+	tmp := filepath.Join(dir, fmt.Sprintf("%s%012d%s.tmp", snapshotPrefix, lsn, snapshotSuffix))
+	w, err := NewSegmentWriter(tmp)
+	if err != nil {
+		return nil, err
+	}
+	w.SetCompression(c)
+	return &SnapshotWriter{dir: dir, lsn: lsn, tmp: tmp, w: w}, nil
+}
+
+// Write adds a record of the state; lsn is the LSN recovery sees it at, 0
+// for the snapshot's own
+func (sw *SnapshotWriter) Write(recType RecordType, lsn uint64, payload []byte) error {
+	if lsn == 0 || lsn > sw.lsn {
+		lsn = sw.lsn
+	}
+	rec, err := NewRecord(recType, lsn, payload)
+	if err != nil {
+		return err
+	}
+	return sw.w.Write(rec)
+}
+
+// Commit ends the snapshot with its checkpoint record, syncs it, renames it
+// into place, and removes older snapshots. It returns the snapshot's path.
+func (sw *SnapshotWriter) Commit() (string, error) {
+	payload, _ := EncodeCheckpointPayload(sw.lsn)
+	if err := sw.Write(RecordTypeCheckpoint, sw.lsn, payload); err != nil {
+		sw.Abort()
+		return "", err
+	}
+	checksum, err := sw.w.Finalize()
+	if err != nil {
+		sw.Abort()
+		return "", err
+	}
+	if err := sw.w.Close(); err != nil {
+		_ = os.Remove(sw.tmp)
+		return "", fmt.Errorf("failed to close snapshot: %w", err)
+	}
+	path := filepath.Join(sw.dir, SnapshotFilename(sw.lsn, checksum))
+	if err := os.Rename(sw.tmp, path); err != nil {
+		_ = os.Remove(sw.tmp)
+		return "", fmt.Errorf("failed to rename snapshot: %w", err)
+	}
+	if err := syncDir(sw.dir); err != nil {
+		return "", err
+	}
+
+	// Older snapshots are of no further use
+	snaps, _ := ListSnapshots(sw.dir)
+	for _, s := range snaps {
+		if s.Path != path {
+			_ = os.Remove(s.Path)
+		}
+	}
+	return path, nil
+}
+
+// Abort discards the snapshot
+func (sw *SnapshotWriter) Abort() {
+	_ = sw.w.Close()
+	_ = os.Remove(sw.tmp)
+}
+
+// segmentFirstLSN returns the LSN of a segment's first record, or false
+// for an empty or unreadable segment
+func segmentFirstLSN(path string) (uint64, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, false
+	}
+	defer func() { _ = f.Close() }()
+	var header [HeaderSize]byte
+	if _, err := io.ReadFull(f, header[:]); err != nil {
+		return 0, false
+	}
+	if binary.LittleEndian.Uint32(header[0:4]) != MagicBytes {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint64(header[8:16]), true
+}
@@ -0,0 +1,159 @@
+package wal
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/relay"
+)
+
+// writeCheckpointedWAL writes doc-0..doc-5 across several segments, a
+// checkpoint with a snapshot of them, then doc-6 and a delete of doc-0. It
+// returns the checkpoint's LSN.
+func writeCheckpointedWAL(t *testing.T, dir string) uint64 {
+	t.Helper()
+	writer, err := NewWALWriter(dir, WithSyncPolicy(ImmediateSyncPolicy()), WithMaxSegmentSize(1024))
+	if err != nil {
+		t.Fatalf("failed to create WAL writer: %v", err)
+	}
+	defer func() { _ = writer.Close() }()
+
+	var embedding relay.Embedding
+	addDoc := func(i int) []byte {
+		payload, _ := EncodeDocPayload(fmt.Sprintf("doc-%d", i), DocMetadata{Title: "t"}, embedding)
+		if _, err := writer.Append(RecordTypeInsert, payload); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+		return payload
+	}
+	var snapshot [][]byte
+	for i := 0; i < 6; i++ {
+		snapshot = append(snapshot, addDoc(i))
+	}
+
+	payload, _ := EncodeCheckpointPayload(writer.CurrentLSN())
+	lsn, err := writer.AppendWithSync(RecordTypeCheckpoint, payload)
+	if err != nil {
+		t.Fatalf("failed to append checkpoint: %v", err)
+	}
+	sw, err := NewSnapshotWriter(dir, lsn, CompressionNone)
+	if err != nil {
+		t.Fatalf("failed to create snapshot: %v", err)
+	}
+	for _, p := range snapshot {
+		if err := sw.Write(RecordTypeInsert, 0, p); err != nil {
+			t.Fatalf("failed to write snapshot: %v", err)
+		}
+	}
+	if _, err := sw.Commit(); err != nil {
+		t.Fatalf("failed to commit snapshot: %v", err)
+	}
+
+	addDoc(6)
+	del, _ := EncodeDeletePayload("doc-0")
+	if _, err := writer.Append(RecordTypeDelete, del); err != nil {
+		t.Fatalf("failed to append delete: %v", err)
+	}
+	return lsn
+}
+
+func recoverDir(t *testing.T, dir string) (*testMemIndex, *RecoveryStats) {
+	t.Helper()
+	index := newTestMemIndex()
+	stats, err := NewRecoveryManager(NewInMemoryManifest(), dir, index).RecoverWithoutManifest(context.Background())
+	if err != nil {
+		t.Fatalf("recovery failed: %v", err)
+	}
+	if index.Count() != 6 || index.Has("doc-0") || !index.Has("doc-6") {
+		t.Errorf("expected doc-1..doc-6, got %d docs", index.Count())
+	}
+	return index, stats
+}
+
+func TestRecoverFromSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	lsn := writeCheckpointedWAL(t, dir)
+
+	_, stats := recoverDir(t, dir)
+	if stats.SnapshotLSN != lsn || stats.SnapshotRecords != 7 {
+		t.Errorf("expected the snapshot at LSN %d to be loaded, got %+v", lsn, stats)
+	}
+	if stats.SegmentsSkipped == 0 {
+		t.Errorf("expected segments before the checkpoint to be skipped, got %+v", stats)
+	}
+	if stats.RecordsLoaded != 2 || stats.MaxLSN != lsn+2 {
+		t.Errorf("expected only the 2 records after the checkpoint to be replayed, got %+v", stats)
+	}
+}
+
+func TestRecoverIgnoresBadSnapshots(t *testing.T) {
+	t.Run("corrupt", func(t *testing.T) {
+		dir := t.TempDir()
+		writeCheckpointedWAL(t, dir)
+		snaps, _ := ListSnapshots(dir)
+		if len(snaps) != 1 {
+			t.Fatalf("expected 1 snapshot, got %d", len(snaps))
+		}
+		data, _ := os.ReadFile(snaps[0].Path)
+		data[len(data)/2] ^= 0xFF
+		if err := os.WriteFile(snaps[0].Path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, stats := recoverDir(t, dir); stats.SnapshotLSN != 0 || stats.SegmentsSkipped != 0 {
+			t.Errorf("expected a full replay, got %+v", stats)
+		}
+	})
+
+	t.Run("unpaired", func(t *testing.T) {
+		// A snapshot whose checkpoint isn't in the WAL, as after the
+		// checkpoint's segment was compacted
+		dir := t.TempDir()
+		lsn := writeCheckpointedWAL(t, dir)
+		snaps, _ := ListSnapshots(dir)
+		if err := os.Rename(snaps[0].Path, filepath.Join(dir, SnapshotFilename(lsn-1, snaps[0].Checksum))); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, stats := recoverDir(t, dir); stats.SnapshotLSN != 0 {
+			t.Errorf("expected a full replay, got %+v", stats)
+		}
+	})
+
+	t.Run("recover to time", func(t *testing.T) {
+		dir := t.TempDir()
+		writeCheckpointedWAL(t, dir)
+		index := newTestMemIndex()
+		stats, err := NewRecoveryManager(NewInMemoryManifest(), dir, index).RecoverToTime(context.Background(), time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatalf("recovery failed: %v", err)
+		}
+		if stats.SnapshotLSN != 0 || index.Count() != 6 {
+			t.Errorf("expected RecoverToTime to replay the whole WAL, got %d docs (%+v)", index.Count(), stats)
+		}
+	})
+}
+
+func TestSnapshotCommitRemovesOlder(t *testing.T) {
+	dir := t.TempDir()
+	for _, lsn := range []uint64{5, 9} {
+		sw, err := NewSnapshotWriter(dir, lsn, CompressionZstd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := sw.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	snaps, err := ListSnapshots(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snaps) != 1 || snaps[0].LSN != 9 {
+		t.Errorf("expected only the snapshot at LSN 9, got %+v", snaps)
+	}
+}
@@ -0,0 +1,49 @@
+package wal
+
+import (
+	"fmt"
+	"os"
+)
+
+// SyncMethod is how the writer makes appended records durable
+type SyncMethod string
+
+// SyncMethod values
+const (
+	// SyncFsync flushes the segment's data and all of its metadata
+	SyncFsync SyncMethod = "fsync"
+	// SyncFdatasync flushes the data and only the metadata needed to read
+	// it back, like the size, skipping timestamp updates. Appends still
+	// grow the file, so the size is flushed with them.
+	SyncFdatasync SyncMethod = "fdatasync"
+	// SyncODSync opens segments with O_DSYNC, so every write returns once
+	// its data is durable and there's nothing left to sync
+	SyncODSync SyncMethod = "odsync"
+)
+
+// ParseSyncMethod reads a sync method name; empty means fsync
+func ParseSyncMethod(s string) (SyncMethod, error) {
+	switch SyncMethod(s) {
+	case "":
+		return SyncFsync, nil
+	case SyncFsync, SyncFdatasync, SyncODSync:
+		return SyncMethod(s), nil
+	}
+	return "", fmt.Errorf("unknown sync method %q (want fsync, fdatasync, or odsync)", s)
+}
+
+// openFlag returns the extra flag segments are opened with
+func (m SyncMethod) openFlag() int {
+	if m == SyncODSync {
+		return dsyncFlag
+	}
+	return 0
+}
+
+// syncFile flushes f by method
+func (m SyncMethod) syncFile(f *os.File) error {
+	if m == SyncFdatasync {
+		return fdatasync(f)
+	}
+	return f.Sync()
+}
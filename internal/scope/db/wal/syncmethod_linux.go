@@ -0,0 +1,16 @@
+//go:build linux
+
+package wal
+
+import (
+	"os"
+	"syscall"
+)
+
+// dsyncFlag opens a file so each write waits for its data to reach disk
+const dsyncFlag = syscall.O_DSYNC
+
+// fdatasync flushes f's data and the metadata needed to read it back
+func fdatasync(f *os.File) error {
+	return syscall.Fdatasync(int(f.Fd()))
+}
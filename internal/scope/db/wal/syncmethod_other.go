@@ -0,0 +1,14 @@
+//go:build !linux
+
+package wal
+
+import "os"
+
+// dsyncFlag falls back to O_SYNC, which also waits for metadata, since
+// O_DSYNC isn't defined on every platform
+const dsyncFlag = os.O_SYNC
+
+// fdatasync falls back to a full fsync
+func fdatasync(f *os.File) error {
+	return f.Sync()
+}
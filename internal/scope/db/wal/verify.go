@@ -0,0 +1,283 @@
+package wal
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+)
+
+// VerifySeverity is how serious a verification issue is
+type VerifySeverity string
+
+// Verification severities; only VerifyError makes a report fail
+const (
+	VerifyError   VerifySeverity = "error"   // Records are damaged, missing, or contradict each other
+	VerifyWarning VerifySeverity = "warning" // Suspect, but recovery copes with it
+)
+
+// Checks a verification makes, the Check of a VerifyIssue
+const (
+	VerifyRecords  = "records"     // Every record passes its checksums and the segment isn't cut off mid-record
+	VerifyFooter   = "footer"      // Sealed segments match their footer
+	VerifyOrder    = "lsn_order"   // LSNs increase within a segment
+	VerifyGap      = "lsn_gap"     // No LSNs are missing from the WAL segments
+	VerifyOverlap  = "lsn_overlap" // No two WAL segments hold the same LSNs
+	VerifyManifest = "manifest"    // The manifest and the files agree
+)
+
+// VerifyIssue is a problem a verification found
+type VerifyIssue struct {
+	Segment  string         `json:"segment,omitempty"` // Base name of the file; empty for the directory
+	Check    string         `json:"check"`
+	Severity VerifySeverity `json:"severity"`
+	LSN      uint64         `json:"lsn,omitempty"` // Where in the segment, when it's about a record
+	Detail   string         `json:"detail"`
+}
+
+// SegmentVerify is what a verification read from one segment
+type SegmentVerify struct {
+	Segment      string `json:"segment"`
+	Compacted    bool   `json:"compacted"`
+	Footer       bool   `json:"footer"`
+	Records      int    `json:"records"`
+	MinLSN       uint64 `json:"min_lsn"`
+	MaxLSN       uint64 `json:"max_lsn"`
+	Corrupt      int    `json:"corrupt,omitempty"`       // Corrupt regions skipped
+	SkippedBytes int64  `json:"skipped_bytes,omitempty"` // Size of the corrupt regions
+	Issues       int    `json:"issues,omitempty"`
+}
+
+// VerifyReport is the result of VerifyAll
+type VerifyReport struct {
+	Segments []SegmentVerify `json:"segments"`
+	Records  int             `json:"records"`
+	Manifest bool            `json:"manifest"` // The files were cross-checked against a manifest
+	Issues   []VerifyIssue   `json:"issues"`
+	Errors   int             `json:"errors"`
+	Warnings int             `json:"warnings"`
+}
+
+// OK reports whether the verification found no errors
+func (r *VerifyReport) OK() bool {
+	return r.Errors == 0
+}
+
+// add records an issue with seg, or the directory when seg is nil
+func (r *VerifyReport) add(seg *SegmentVerify, check string, severity VerifySeverity, lsn uint64, format string, args ...any) {
+	issue := VerifyIssue{Check: check, Severity: severity, LSN: lsn, Detail: fmt.Sprintf(format, args...)}
+	if seg != nil {
+		issue.Segment = seg.Segment
+		seg.Issues++
+	}
+	r.Issues = append(r.Issues, issue)
+	if severity == VerifyError {
+		r.Errors++
+	} else {
+		r.Warnings++
+	}
+}
+
+// VerifyAll reads every record of every segment in dir and checks them
+// deeper than recovery does: record checksums, footers, that LSNs increase
+// within each segment, and that the WAL segments hold every LSN once, with
+// gaps only where a compacted segment took over their records. With a
+// manifest it also checks the two agree: every segment it lists exists and
+// matches its checksum and, for compacted ones, its record count and LSN
+// range, and every file is listed. Nothing in dir is modified.
+//
+// A torn tail on the newest WAL segment is what a crash mid-write leaves,
+// and recovery truncates it, so it only warns. The returned error is for
+// failing to run at all; what the verification found is in the report.
+func VerifyAll(ctx context.Context, dir string, manifest ManifestStore) (*VerifyReport, error) {
+	paths, err := ListSegmentFiles(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list segment files: %w", err)
+	}
+	var newest string
+	for _, path := range paths {
+		if IsWALSegment(path) {
+			newest = path
+		}
+	}
+
+	report := &VerifyReport{Segments: make([]SegmentVerify, 0, len(paths)), Issues: []VerifyIssue{}}
+	footers := false // Whether an earlier WAL segment was sealed with a footer
+	for _, path := range paths {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		report.Segments = append(report.Segments, SegmentVerify{Segment: filepath.Base(path), Compacted: IsCompactedSegment(path)})
+		seg := &report.Segments[len(report.Segments)-1]
+		verifySegment(report, seg, path, path == newest, &footers)
+		report.Records += seg.Records
+	}
+	verifyLSNs(report)
+
+	if manifest != nil {
+		if err := verifyManifest(ctx, report, dir, paths, newest, manifest); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+// verifySegment reads the segment at path into seg
+func verifySegment(report *VerifyReport, seg *SegmentVerify, path string, newest bool, footers *bool) {
+	iter, err := NewSegmentIterator(path)
+	if err != nil {
+		report.add(seg, VerifyRecords, VerifyError, 0, "cannot open: %v", err)
+		return
+	}
+	defer func() { _ = iter.Close() }()
+	iter.EnableResync()
+
+	var prev uint64
+	resyncs := 0
+	for iter.Next() {
+		rec := iter.Record()
+		if seg.Records > 0 {
+			switch {
+			case rec.LSN <= prev:
+				report.add(seg, VerifyOrder, VerifyError, rec.LSN, "LSN %d follows LSN %d", rec.LSN, prev)
+			case rec.LSN > prev+1 && !seg.Compacted && iter.Resyncs() == resyncs:
+				// A corrupt region explains its own gap; compaction drops
+				// superseded records, so compacted segments have gaps
+				report.add(seg, VerifyGap, VerifyWarning, rec.LSN, "LSNs %d to %d are missing", prev+1, rec.LSN-1)
+			}
+		}
+		if seg.Records == 0 || rec.LSN < seg.MinLSN {
+			seg.MinLSN = rec.LSN
+		}
+		seg.MaxLSN = max(seg.MaxLSN, rec.LSN)
+		seg.Records++
+		prev, resyncs = rec.LSN, iter.Resyncs()
+	}
+
+	seg.Corrupt, seg.SkippedBytes = iter.Resyncs(), iter.SkippedBytes()
+	if seg.Corrupt > 0 {
+		report.add(seg, VerifyRecords, VerifyError, 0, "%d corrupt regions (%d bytes) fail their checksums", seg.Corrupt, seg.SkippedBytes)
+	}
+	footer := iter.Footer()
+	seg.Footer = footer != nil
+	if err := iter.Err(); err != nil {
+		if newest && footer == nil {
+			report.add(seg, VerifyRecords, VerifyWarning, 0, "torn tail after LSN %d, which recovery drops: %v", seg.MaxLSN, err)
+		} else {
+			report.add(seg, VerifyRecords, VerifyError, 0, "unreadable after LSN %d: %v", seg.MaxLSN, err)
+		}
+	}
+
+	if footer == nil {
+		if *footers && !newest && !seg.Compacted {
+			report.add(seg, VerifyFooter, VerifyWarning, 0, "sealed segment has lost its footer; records at its end may be missing")
+		}
+		return
+	}
+	*footers = *footers || !seg.Compacted
+	if _, err := VerifySegmentFooter(path); err != nil {
+		report.add(seg, VerifyFooter, VerifyError, 0, "%v", err)
+	} else if seg.Corrupt == 0 && (footer.Records != uint64(seg.Records) || footer.MinLSN != seg.MinLSN || footer.MaxLSN != seg.MaxLSN) {
+		report.add(seg, VerifyFooter, VerifyError, 0, "footer has %d records, LSNs %d to %d; read %d, LSNs %d to %d",
+			footer.Records, footer.MinLSN, footer.MaxLSN, seg.Records, seg.MinLSN, seg.MaxLSN)
+	}
+}
+
+// verifyLSNs checks that consecutive WAL segments neither overlap nor
+// leave a gap no compacted segment covers. Gaps beside a corrupt region
+// are left out, as the region may have held the missing records.
+func verifyLSNs(report *VerifyReport) {
+	var prev *SegmentVerify
+	for i := range report.Segments {
+		seg := &report.Segments[i]
+		if seg.Compacted || seg.Records == 0 {
+			continue
+		}
+		if prev != nil {
+			switch {
+			case seg.MinLSN <= prev.MaxLSN:
+				report.add(seg, VerifyOverlap, VerifyError, seg.MinLSN, "LSNs %d to %d are also in %s", seg.MinLSN, min(seg.MaxLSN, prev.MaxLSN), prev.Segment)
+			case seg.MinLSN > prev.MaxLSN+1 && prev.Corrupt == 0 && seg.Corrupt == 0 && !compactedCovers(report.Segments, prev.MaxLSN+1, seg.MinLSN-1):
+				report.add(seg, VerifyGap, VerifyError, seg.MinLSN, "LSNs %d to %d after %s are in no segment", prev.MaxLSN+1, seg.MinLSN-1, prev.Segment)
+			}
+		}
+		prev = seg
+	}
+}
+
+// compactedCovers reports whether a compacted segment spans LSNs from to
+// through, so a gap between WAL segments is records compaction took over
+func compactedCovers(segments []SegmentVerify, from, through uint64) bool {
+	for _, seg := range segments {
+		if seg.Compacted && seg.Records > 0 && seg.MinLSN <= through && seg.MaxLSN >= from {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyManifest checks the manifest's segments against the files in dir
+func verifyManifest(ctx context.Context, report *VerifyReport, dir string, paths []string, newest string, manifest ManifestStore) error {
+	info, err := manifest.GetRecoveryInfo(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read manifest: %w", err)
+	}
+	archived, err := manifest.GetSegmentsByStatus(ctx, SegmentStatusArchived)
+	if err != nil {
+		return fmt.Errorf("failed to read manifest: %w", err)
+	}
+	report.Manifest = true
+
+	segs := make(map[string]*SegmentVerify, len(report.Segments))
+	for i := range report.Segments {
+		segs[report.Segments[i].Segment] = &report.Segments[i]
+	}
+	listed := make(map[string]bool, len(info.Segments))
+	for _, info := range info.Segments {
+		name := filepath.Base(info.Filename)
+		listed[name] = true
+		seg := segs[name]
+		if seg == nil {
+			report.add(nil, VerifyManifest, VerifyError, 0, "%s segment %s is in the manifest but not in %s", info.Status, name, dir)
+			continue
+		}
+		if info.Status == SegmentStatusActive {
+			if newest != "" && filepath.Base(newest) != name {
+				report.add(seg, VerifyManifest, VerifyWarning, 0, "the manifest's active segment isn't the newest, %s", filepath.Base(newest))
+			}
+			continue
+		}
+		if info.Checksum != nil {
+			ok, err := VerifySegmentChecksum(filepath.Join(dir, name), *info.Checksum)
+			switch {
+			case err != nil:
+				report.add(seg, VerifyManifest, VerifyError, 0, "cannot checksum: %v", err)
+			case !ok:
+				report.add(seg, VerifyManifest, VerifyError, 0, "doesn't match the manifest's checksum %s", *info.Checksum)
+			}
+		}
+		if seg.Compacted && info.MinLSN != nil && info.MaxLSN != nil &&
+			(info.RecordCount != seg.Records || *info.MinLSN != seg.MinLSN || *info.MaxLSN != seg.MaxLSN) {
+			report.add(seg, VerifyManifest, VerifyError, 0, "the manifest has %d records, LSNs %d to %d; read %d, LSNs %d to %d",
+				info.RecordCount, *info.MinLSN, *info.MaxLSN, seg.Records, seg.MinLSN, seg.MaxLSN)
+		}
+	}
+
+	wasArchived := make(map[string]bool, len(archived))
+	for _, info := range archived {
+		wasArchived[filepath.Base(info.Filename)] = true
+	}
+	for _, path := range paths {
+		name := filepath.Base(path)
+		seg := segs[name]
+		switch {
+		case listed[name]:
+		case wasArchived[name]:
+			report.add(seg, VerifyManifest, VerifyWarning, 0, "archived in the manifest but still on disk; gc quarantines it")
+		case seg.Compacted:
+			report.add(seg, VerifyManifest, VerifyWarning, 0, "not in the manifest, as after a rolled-back compaction; gc quarantines it")
+		default:
+			report.add(seg, VerifyManifest, VerifyWarning, 0, "not in the manifest; it may hold the only copy of its records")
+		}
+	}
+	return nil
+}
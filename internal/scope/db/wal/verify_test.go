@@ -0,0 +1,129 @@
+package wal
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dsjohal14/selfstack/internal/relay"
+)
+
+// writeVerifySegment writes a segment of inserts at lsns, sealed with a
+// footer if sealed, and returns its path
+func writeVerifySegment(t *testing.T, dir, name string, sealed bool, lsns ...uint64) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	writer, err := NewSegmentWriter(path)
+	if err != nil {
+		t.Fatalf("failed to create segment writer: %v", err)
+	}
+	for _, lsn := range lsns {
+		rec, _ := NewRecord(RecordTypeInsert, lsn, mustEncodeDocPayload(t, "doc", DocMetadata{Title: "verify"}, relay.Embedding{}))
+		_ = writer.Write(rec)
+	}
+	if sealed {
+		_ = writer.WriteFooter()
+	}
+	_, _ = writer.Finalize()
+	_ = writer.Close()
+	return path
+}
+
+// issues returns the checks of the report's issues with their severities
+func issues(report *VerifyReport) map[string]VerifySeverity {
+	found := make(map[string]VerifySeverity)
+	for _, issue := range report.Issues {
+		found[issue.Segment+" "+issue.Check] = issue.Severity
+	}
+	return found
+}
+
+func TestVerifyAll(t *testing.T) {
+	ctx := context.Background()
+
+	// Compaction took over 1-4 from segments since removed; the active
+	// segment has a torn tail
+	dir := t.TempDir()
+	writeVerifySegment(t, dir, CompactedSegmentFilename(2), true, 2, 4)
+	writeVerifySegment(t, dir, SegmentFilename(3), true, 5, 6, 7)
+	active := writeVerifySegment(t, dir, SegmentFilename(4), false, 8, 9)
+	f, _ := os.OpenFile(active, os.O_APPEND|os.O_WRONLY, 0)
+	_, _ = f.Write([]byte{0x53, 0x45, 0x4C, 0x46, 1}) // Half a header
+	_ = f.Close()
+
+	report, err := VerifyAll(ctx, dir, nil)
+	if err != nil {
+		t.Fatalf("VerifyAll failed: %v", err)
+	}
+	if !report.OK() || report.Records != 7 || len(report.Segments) != 3 || report.Manifest {
+		t.Fatalf("expected a passing report of 7 records, got %+v", report)
+	}
+	if got := issues(report); len(got) != 1 || got[SegmentFilename(4)+" "+VerifyRecords] != VerifyWarning {
+		t.Errorf("expected only a torn tail warning, got %+v", report.Issues)
+	}
+
+	// Overlapping, gapped, out of order, and damaged segments
+	dir = t.TempDir()
+	writeVerifySegment(t, dir, SegmentFilename(1), true, 1, 2, 3)
+	writeVerifySegment(t, dir, SegmentFilename(2), true, 3, 4, 6)
+	writeVerifySegment(t, dir, SegmentFilename(3), true, 9, 8)
+	damaged := writeVerifySegment(t, dir, SegmentFilename(4), true, 10, 11)
+	data, _ := os.ReadFile(damaged)
+	data[HeaderSize+2] ^= 0xFF // Into the first record's payload
+	_ = os.WriteFile(damaged, data, 0o644)
+	writeVerifySegment(t, dir, SegmentFilename(5), false, 12)
+
+	report, err = VerifyAll(ctx, dir, nil)
+	if err != nil {
+		t.Fatalf("VerifyAll failed: %v", err)
+	}
+	got := issues(report)
+	want := map[string]VerifySeverity{
+		SegmentFilename(2) + " " + VerifyOverlap: VerifyError,
+		SegmentFilename(2) + " " + VerifyGap:     VerifyWarning, // 5, inside the segment
+		SegmentFilename(3) + " " + VerifyOrder:   VerifyError,
+		SegmentFilename(3) + " " + VerifyGap:     VerifyError, // 7, between the segments
+		SegmentFilename(4) + " " + VerifyRecords: VerifyError,
+		SegmentFilename(4) + " " + VerifyFooter:  VerifyError,
+	}
+	for key, severity := range want {
+		if got[key] != severity {
+			t.Errorf("expected %s %s, got %+v", key, severity, report.Issues)
+		}
+	}
+	if report.OK() || report.Errors != 5 || report.Warnings != 1 {
+		t.Errorf("expected 5 errors and 1 warning, got %d and %d: %+v", report.Errors, report.Warnings, report.Issues)
+	}
+}
+
+func TestVerifyAllManifest(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	sealed := writeVerifySegment(t, dir, SegmentFilename(1), true, 1, 2)
+	writeVerifySegment(t, dir, SegmentFilename(2), false, 3)
+	writeVerifySegment(t, dir, CompactedSegmentFilename(7), true, 1)
+
+	manifest := NewInMemoryManifest()
+	_ = manifest.CreateSegment(ctx, 1, sealed)
+	checksum, _ := CalculateSegmentChecksum(sealed)
+	_ = manifest.SealSegment(ctx, 1, checksum)
+	_ = manifest.CreateSegment(ctx, 2, filepath.Join(dir, SegmentFilename(2)))
+	_ = manifest.CreateSegment(ctx, 3, filepath.Join(dir, SegmentFilename(3)))
+
+	report, err := VerifyAll(ctx, dir, manifest)
+	if err != nil {
+		t.Fatalf("VerifyAll failed: %v", err)
+	}
+	got := issues(report)
+	if !report.Manifest || len(got) != 2 || got[" "+VerifyManifest] != VerifyError || got[CompactedSegmentFilename(7)+" "+VerifyManifest] != VerifyWarning {
+		t.Errorf("expected the missing segment and the unregistered compaction, got %+v", report.Issues)
+	}
+
+	// A sealed segment that changed since it was sealed
+	_ = manifest.SealSegment(ctx, 1, "00000000")
+	report, _ = VerifyAll(ctx, dir, manifest)
+	if got := issues(report); got[SegmentFilename(1)+" "+VerifyManifest] != VerifyError {
+		t.Errorf("expected a checksum mismatch, got %+v", report.Issues)
+	}
+}
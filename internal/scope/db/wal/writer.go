@@ -2,15 +2,14 @@ package wal
 
 import (
 	"context"
-	"encoding/binary"
 	"fmt"
-	"hash/crc32"
-	"io"
 	"os"
 	"path/filepath"
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/clock"
 )
 
 // DefaultMaxSegmentSize is the default max size before rotation (64MB)
@@ -21,6 +20,7 @@ type SyncPolicy struct {
 	Immediate bool          // Sync after every write
 	Interval  time.Duration // Sync every N ms (default: 100ms)
 	BatchSize int           // Sync every N records (default: 100)
+	Method    SyncMethod    // How to sync (default: fsync)
 }
 
 // DefaultSyncPolicy returns a balanced sync policy
@@ -43,22 +43,44 @@ func ImmediateSyncPolicy() SyncPolicy {
 //
 //nolint:revive // WALWriter name is intentional for clarity
 type WALWriter struct {
-	mu         sync.Mutex    // Serialize all writes
-	dir        string        // WAL directory
-	file       *os.File      // Current segment file
-	segmentID  uint64        // Current segment number
-	lsn        uint64        // Next LSN to assign (atomic)
-	offset     int64         // Current file offset
-	syncPolicy SyncPolicy    // When to fsync
-	maxSize    int64         // Max segment size
-	manifest   ManifestStore // Postgres manifest (optional)
+	mu         sync.Mutex     // Serialize all writes
+	dir        string         // WAL directory
+	file       *os.File       // Current segment file
+	segmentID  uint64         // Current segment number
+	lsn        uint64         // Next LSN to assign (atomic)
+	offset     int64          // Current file offset
+	syncPolicy SyncPolicy     // When to fsync
+	maxSize    int64          // Max segment size
+	maxAge     time.Duration  // Max age of a segment's first record (0 = no limit)
+	manifest   ManifestStore  // Postgres manifest (optional)
+	archive    ArchiveBackend // Copy of sealed segments for repair (optional)
+	nodeID     uint16         // Origin stamped on records (0 = unattributed)
+	clock      *Clock         // Timestamps stamped on records
+	wall       clock.Clock    // Time of syncs, and ticks of the sync loop
+	dirSync    bool           // Fsync the directory after creating a segment
+	compress   Compression    // How payloads are compressed
+	limiter    *rateLimiter   // Throttles appends (nil = unlimited)
+
+	queued atomic.Int64 // Appends and WaitSynced calls not yet returned
 
 	// Sync tracking
-	pendingWrites int       // Number of writes since last sync
-	lastSync      time.Time // Time of last sync
-	syncTicker    *time.Ticker
-	stopSync      chan struct{}
-	wg            sync.WaitGroup
+	pendingWrites int                // Number of writes since last sync
+	lastSync      time.Time          // Time of last sync
+	syncedLSN     uint64             // Highest LSN known to be on disk
+	synced        chan struct{}      // Closed and replaced after every sync
+	syncTicker    clock.Ticker       // Nil without an interval sync policy
+	ageTicker     clock.Ticker       // Nil without a max segment age
+	segmentStart  time.Time          // Time of the current segment's first record; zero while it's empty
+	supervisor    Supervisor         // Runs the background loop
+	stopSync      context.CancelFunc // Stops the background loop
+	syncDone      <-chan struct{}    // Closed when the background loop has stopped
+
+	// Archival, off the write path (nil without an archive)
+	archiveMu      sync.Mutex         // Guards archivePending
+	archivePending []string           // Sealed segments waiting to be archived
+	archiveWake    chan struct{}      // Signals the archive loop; holds at most one signal
+	stopArchive    context.CancelFunc // Stops the archive loop once the queue is drained
+	archiveDone    <-chan struct{}    // Closed when the archive loop has stopped
 
 	closed bool
 }
@@ -82,6 +104,16 @@ func WithMaxSegmentSize(size int64) WALWriterOption {
 	}
 }
 
+// WithMaxSegmentAge seals a segment once its first record is d old, even
+// if it isn't full, so a quiet WAL still hands segments to compaction and
+// archival regularly (0 = no limit). Ages are checked by the background
+// loop on the wall clock (see WithWallClock).
+func WithMaxSegmentAge(d time.Duration) WALWriterOption {
+	return func(w *WALWriter) {
+		w.maxAge = d
+	}
+}
+
 // WithManifest sets the Postgres manifest store
 func WithManifest(manifest ManifestStore) WALWriterOption {
 	return func(w *WALWriter) {
@@ -89,6 +121,76 @@ func WithManifest(manifest ManifestStore) WALWriterOption {
 	}
 }
 
+// WithArchive copies each sealed segment to the given archive backend
+func WithArchive(archive ArchiveBackend) WALWriterOption {
+	return func(w *WALWriter) {
+		w.archive = archive
+	}
+}
+
+// WithNodeID stamps every record with node as its origin, so WAL streams
+// merged from several nodes can be attributed (0 leaves records unattributed)
+func WithNodeID(node uint16) WALWriterOption {
+	return func(w *WALWriter) {
+		w.nodeID = node
+	}
+}
+
+// WithClock timestamps records with clock instead of a new system clock, e.g.
+// to share one clock with replication so received timestamps are observed
+func WithClock(clock *Clock) WALWriterOption {
+	return func(w *WALWriter) {
+		w.clock = clock
+	}
+}
+
+// WithWallClock reads the time from wall, for record timestamps and the
+// background sync loop, instead of the system clock, so tests can step
+// them with a clock.Fake. It replaces a clock given to WithClock before it.
+func WithWallClock(wall clock.Clock) WALWriterOption {
+	return func(w *WALWriter) {
+		w.wall = clock.Or(wall)
+		w.clock = NewClockOn(wall)
+	}
+}
+
+// WithSupervisor runs the background sync loop under sup, which can
+// restart it if it panics, instead of on a plain goroutine
+func WithSupervisor(sup Supervisor) WALWriterOption {
+	return func(w *WALWriter) {
+		w.supervisor = sup
+	}
+}
+
+// WithDirSync sets whether the WAL directory is fsynced after creating a
+// segment, so the new segment's directory entry survives a crash (default
+// true). Without it a segment created just before a crash can vanish on
+// filesystems like NFS that don't commit directory changes with the file's
+// data.
+func WithDirSync(enabled bool) WALWriterOption {
+	return func(w *WALWriter) {
+		w.dirSync = enabled
+	}
+}
+
+// WithCompression compresses record payloads with c (default none). Small
+// payloads and ones that don't shrink are written as-is, and readers
+// decompress them transparently whatever the writer's setting.
+func WithCompression(c Compression) WALWriterOption {
+	return func(w *WALWriter) {
+		w.compress = c
+	}
+}
+
+// WithRateLimit throttles appends to limit, so bulk writes can't take all
+// of the disk's bandwidth. Throttled appends wait before taking the
+// writer's lock and count toward QueueDepth.
+func WithRateLimit(limit RateLimit) WALWriterOption {
+	return func(w *WALWriter) {
+		w.limiter = newRateLimiter(limit)
+	}
+}
+
 // WithInitialLSN sets the initial LSN (for recovery)
 func WithInitialLSN(lsn uint64) WALWriterOption {
 	return func(w *WALWriter) {
@@ -116,24 +218,33 @@ func NewWALWriter(dir string, opts ...WALWriterOption) (*WALWriter, error) {
 		offset:     0,
 		syncPolicy: DefaultSyncPolicy(),
 		maxSize:    DefaultMaxSegmentSize,
-		lastSync:   time.Now(),
-		stopSync:   make(chan struct{}),
+		wall:       clock.System(),
+		supervisor: unsupervised{},
+		synced:     make(chan struct{}),
+		clock:      NewClock(),
+		dirSync:    true,
+		compress:   CompressionNone,
 	}
 
 	// Apply options
 	for _, opt := range opts {
 		opt(w)
 	}
+	w.syncedLSN = w.lsn - 1 // Records from before a restart are already on disk
+	w.lastSync = w.wall.Now()
 
 	// Open initial segment
 	if err := w.openSegment(); err != nil {
 		return nil, err
 	}
 
-	// Start background sync if not immediate
-	if !w.syncPolicy.Immediate && w.syncPolicy.Interval > 0 {
+	// Start the background loop for interval syncs and segment ages
+	if (!w.syncPolicy.Immediate && w.syncPolicy.Interval > 0) || w.maxAge > 0 {
 		w.startBackgroundSync()
 	}
+	if w.archive != nil {
+		w.startArchiving()
+	}
 
 	return w, nil
 }
@@ -149,10 +260,17 @@ func (w *WALWriter) openSegment() error {
 			return fmt.Errorf("failed to scan segment for corruption: %w", err)
 		}
 
-		// Truncate at last valid record if file has corrupt tail
+		// Truncate at last valid record if file has corrupt tail. A footer,
+		// from a crash after sealing the segment but before the next one
+		// was created, goes too, since records are appended again.
+		footer, _ := ReadSegmentFooter(path)
 		if validOffset < stat.Size() {
-			fmt.Printf("truncating corrupt tail in segment %s: %d -> %d bytes\n",
-				path, stat.Size(), validOffset)
+			if footer != nil && validOffset == footer.DataBytes {
+				fmt.Printf("reopening sealed segment %s: removing its footer\n", path)
+			} else {
+				fmt.Printf("truncating corrupt tail in segment %s: %d -> %d bytes\n",
+					path, stat.Size(), validOffset)
+			}
 			if err := os.Truncate(path, validOffset); err != nil {
 				return fmt.Errorf("failed to truncate corrupt segment: %w", err)
 			}
@@ -160,10 +278,17 @@ func (w *WALWriter) openSegment() error {
 	}
 
 	// Open for append
-	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	_, statErr := os.Stat(path)
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY|w.syncPolicy.Method.openFlag(), 0644)
 	if err != nil {
 		return fmt.Errorf("failed to open segment %s: %w", path, err)
 	}
+	if w.dirSync && os.IsNotExist(statErr) {
+		if err := syncDir(w.dir); err != nil {
+			_ = f.Close()
+			return err
+		}
+	}
 
 	// Get current file size
 	stat, err := f.Stat()
@@ -174,69 +299,53 @@ func (w *WALWriter) openSegment() error {
 
 	w.file = f
 	w.offset = stat.Size()
+	if w.offset == 0 {
+		w.segmentStart = time.Time{}
+	}
 	return nil
 }
 
-// findLastValidOffset scans a segment and returns the offset after the last valid record
+// findLastValidOffset scans a segment and returns the offset after the last
+// valid record. Corrupt records mid-segment are skipped as recovery skips
+// them, so only a corrupt or incomplete tail is cut off. The clock observes
+// every timestamp found so new records order after them even if the wall
+// clock went backwards, and the first one starts the segment's age.
 func (w *WALWriter) findLastValidOffset(path string) (int64, error) {
-	f, err := os.Open(path)
+	iter, err := NewSegmentIterator(path)
 	if err != nil {
 		return 0, err
 	}
-	defer func() { _ = f.Close() }()
+	defer func() { _ = iter.Close() }()
+	iter.reuse = true
+	iter.EnableResync()
 
 	var lastValidOffset int64
-	var offset int64
-
-	for {
-		// Read header using io.ReadFull to handle short reads correctly
-		header := make([]byte, HeaderSize)
-		_, err := io.ReadFull(f, header)
-		if err != nil {
-			break // EOF or incomplete header
-		}
-
-		// Verify magic
-		magic := binary.LittleEndian.Uint32(header[0:4])
-		if magic != MagicBytes {
-			break // Corrupt record
-		}
-
-		// Get payload length
-		payloadLen := binary.LittleEndian.Uint32(header[16:20])
-		if payloadLen > MaxPayloadSize {
-			break // Invalid payload size
-		}
-
-		// Verify header CRC before reading payload
-		headerCRC := binary.LittleEndian.Uint32(header[20:24])
-		expectedHeaderCRC := crc32.ChecksumIEEE(header[0:20])
-		if headerCRC != expectedHeaderCRC {
-			break // Corrupt header
+	w.segmentStart = time.Time{}
+	for iter.Next() {
+		rec := iter.Record()
+		if ts, ok := rec.TimestampHLC(); ok {
+			w.clock.Observe(ts)
+			if w.segmentStart.IsZero() {
+				w.segmentStart = ts.Wall()
+			}
 		}
-
-		// Read payload + CRC using io.ReadFull
-		payloadAndCRC := make([]byte, payloadLen+4)
-		_, err = io.ReadFull(f, payloadAndCRC)
-		if err != nil {
-			break // Incomplete record
+		if !rec.InBatch() {
+			lastValidOffset = iter.Offset() // A batch is only kept once complete
 		}
-
-		// Verify payload CRC
-		payloadCRC := binary.LittleEndian.Uint32(payloadAndCRC[payloadLen:])
-		expectedPayloadCRC := crc32.ChecksumIEEE(payloadAndCRC[:payloadLen])
-		if payloadCRC != expectedPayloadCRC {
-			break // Corrupt payload
-		}
-
-		// Record is valid
-		offset += int64(HeaderSize) + int64(payloadLen) + 4
-		lastValidOffset = offset
 	}
-
+	// An error is a record cut short, which is the tail being cut off
 	return lastValidOffset, nil
 }
 
+// advanceLocked moves the offset past n bytes just written; the first
+// write to an empty segment starts its age
+func (w *WALWriter) advanceLocked(n int) {
+	if w.offset == 0 {
+		w.segmentStart = w.wall.Now()
+	}
+	w.offset += int64(n)
+}
+
 // segmentPath returns the path for a segment ID
 func (w *WALWriter) segmentPath(segmentID uint64) string {
 	return filepath.Join(w.dir, fmt.Sprintf("wal_%012d.seg", segmentID))
@@ -245,6 +354,9 @@ func (w *WALWriter) segmentPath(segmentID uint64) string {
 // Append writes a record and returns the assigned LSN
 // Thread-safe: uses mutex internally
 func (w *WALWriter) Append(recType RecordType, payload []byte) (uint64, error) {
+	w.queued.Add(1)
+	defer w.queued.Add(-1)
+	w.throttle(callAppend, encodedSize(payload))
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
@@ -260,6 +372,11 @@ func (w *WALWriter) Append(recType RecordType, payload []byte) (uint64, error) {
 	if err != nil {
 		return 0, fmt.Errorf("failed to create record: %w", err)
 	}
+	rec.compress(w.compress)
+	if w.nodeID != 0 {
+		rec.SetOrigin(w.nodeID)
+	}
+	rec.SetTimestamp(w.clock.Now())
 
 	// Encode record
 	data := rec.Encode()
@@ -273,23 +390,24 @@ func (w *WALWriter) Append(recType RecordType, payload []byte) (uint64, error) {
 		return 0, fmt.Errorf("short write: %d < %d", n, len(data))
 	}
 
-	w.offset += int64(n)
+	w.advanceLocked(n)
 	w.pendingWrites++
+	recordWrite(callAppend, 1, n)
 
 	// Sync if immediate or batch size reached
 	if w.syncPolicy.Immediate {
-		if err := w.syncLocked(); err != nil {
+		if err := w.syncLocked(syncReasonPolicy); err != nil {
 			return 0, fmt.Errorf("failed to sync: %w", err)
 		}
 	} else if w.syncPolicy.BatchSize > 0 && w.pendingWrites >= w.syncPolicy.BatchSize {
-		if err := w.syncLocked(); err != nil {
+		if err := w.syncLocked(syncReasonPolicy); err != nil {
 			return 0, fmt.Errorf("failed to sync: %w", err)
 		}
 	}
 
 	// Check if we need to rotate
 	if w.offset >= w.maxSize {
-		if err := w.rotateLocked(); err != nil {
+		if err := w.rotateLocked(rotateReasonSize); err != nil {
 			return 0, fmt.Errorf("failed to rotate segment: %w", err)
 		}
 	}
@@ -299,6 +417,9 @@ func (w *WALWriter) Append(recType RecordType, payload []byte) (uint64, error) {
 
 // AppendWithSync writes a record and syncs immediately, returning the LSN
 func (w *WALWriter) AppendWithSync(recType RecordType, payload []byte) (uint64, error) {
+	w.queued.Add(1)
+	defer w.queued.Add(-1)
+	w.throttle(callAppendSync, encodedSize(payload))
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
@@ -314,6 +435,11 @@ func (w *WALWriter) AppendWithSync(recType RecordType, payload []byte) (uint64,
 	if err != nil {
 		return 0, fmt.Errorf("failed to create record: %w", err)
 	}
+	rec.compress(w.compress)
+	if w.nodeID != 0 {
+		rec.SetOrigin(w.nodeID)
+	}
+	rec.SetTimestamp(w.clock.Now())
 
 	data := rec.Encode()
 
@@ -326,17 +452,18 @@ func (w *WALWriter) AppendWithSync(recType RecordType, payload []byte) (uint64,
 		return 0, fmt.Errorf("short write: %d < %d", n, len(data))
 	}
 
-	if err := w.file.Sync(); err != nil {
+	recordWrite(callAppendSync, 1, n)
+	if err := w.fsyncLocked(syncReasonExplicit); err != nil {
 		return 0, fmt.Errorf("failed to sync: %w", err)
 	}
 
-	w.offset += int64(n)
+	w.advanceLocked(n)
 	w.pendingWrites = 0
-	w.lastSync = time.Now()
+	w.markSyncedLocked()
 
 	// Check rotation
 	if w.offset >= w.maxSize {
-		if err := w.rotateLocked(); err != nil {
+		if err := w.rotateLocked(rotateReasonSize); err != nil {
 			return 0, fmt.Errorf("failed to rotate segment: %w", err)
 		}
 	}
@@ -344,34 +471,244 @@ func (w *WALWriter) AppendWithSync(recType RecordType, payload []byte) (uint64,
 	return lsn, nil
 }
 
+// RecordRequest is a record for AppendBatch or AppendAtomic to write
+type RecordRequest struct {
+	Type    RecordType
+	Payload []byte
+}
+
+// AppendBatch writes independent records under one lock acquisition and
+// group-commits them: with an immediate sync policy they share a single
+// fsync instead of paying one each. Returns their LSNs in order. Unlike
+// AppendAtomic, the batch may span segments and a crash can keep any
+// prefix of it, so callers acknowledge none of it until it returns.
+func (w *WALWriter) AppendBatch(reqs []RecordRequest) ([]uint64, error) {
+	if len(reqs) == 0 {
+		return nil, nil
+	}
+	w.queued.Add(1)
+	defer w.queued.Add(-1)
+	w.throttle(callBatch, requestsSize(reqs))
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return nil, fmt.Errorf("WAL writer is closed")
+	}
+
+	// LSNs are only taken once every record is valid
+	recs := make([]*Record, len(reqs))
+	next := atomic.LoadUint64(&w.lsn)
+	for i, req := range reqs {
+		rec, err := NewRecord(req.Type, next+uint64(i), req.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create record %d: %w", i, err)
+		}
+		recs[i] = rec
+	}
+	atomic.AddUint64(&w.lsn, uint64(len(reqs)))
+
+	lsns := make([]uint64, len(recs))
+	var data []byte
+	buffered := 0
+	for i, rec := range recs {
+		rec.compress(w.compress)
+		if w.nodeID != 0 {
+			rec.SetOrigin(w.nodeID)
+		}
+		rec.SetTimestamp(w.clock.Now())
+		lsns[i] = rec.LSN
+		data = append(data, rec.Encode()...)
+		buffered++
+
+		// Rotate where a single append would, so segments keep their size
+		if w.offset+int64(len(data)) >= w.maxSize || i == len(recs)-1 {
+			n, err := w.file.Write(data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to write batch: %w", err)
+			}
+			if n != len(data) {
+				return nil, fmt.Errorf("short write: %d < %d", n, len(data))
+			}
+			w.advanceLocked(n)
+			w.pendingWrites += buffered
+			recordWrite(callBatch, buffered, n)
+			data, buffered = data[:0], 0
+		}
+		if w.offset >= w.maxSize {
+			if err := w.rotateLocked(rotateReasonSize); err != nil {
+				return nil, fmt.Errorf("failed to rotate segment: %w", err)
+			}
+		}
+	}
+
+	if w.syncPolicy.Immediate || (w.syncPolicy.BatchSize > 0 && w.pendingWrites >= w.syncPolicy.BatchSize) {
+		if err := w.syncLocked(syncReasonPolicy); err != nil {
+			return nil, fmt.Errorf("failed to sync: %w", err)
+		}
+	}
+	return lsns, nil
+}
+
+// AppendAtomic writes records that recovery applies all together or not at
+// all, returning their LSNs. Every record but the last carries FlagBatch,
+// and the batch is written in one piece to one segment, so a batch cut
+// short by a crash ends without its last record and is dropped. The batch
+// is synced when syncNow is set, otherwise it follows the sync policy.
+func (w *WALWriter) AppendAtomic(entries []RecordRequest, syncNow bool) ([]uint64, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	w.queued.Add(1)
+	defer w.queued.Add(-1)
+	w.throttle(callAtomic, requestsSize(entries))
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return nil, fmt.Errorf("WAL writer is closed")
+	}
+
+	lsns := make([]uint64, len(entries))
+	var data []byte
+	next := atomic.LoadUint64(&w.lsn)
+	for i, e := range entries {
+		rec, err := NewRecord(e.Type, next+uint64(i), e.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create record: %w", err)
+		}
+		rec.compress(w.compress)
+		if w.nodeID != 0 {
+			rec.SetOrigin(w.nodeID)
+		}
+		rec.SetTimestamp(w.clock.Now())
+		rec.setBatch(i < len(entries)-1)
+		lsns[i] = rec.LSN
+		data = append(data, rec.Encode()...)
+	}
+	// LSNs are only taken once every record is valid
+	atomic.AddUint64(&w.lsn, uint64(len(entries)))
+
+	n, err := w.file.Write(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write batch: %w", err)
+	}
+	if n != len(data) {
+		return nil, fmt.Errorf("short write: %d < %d", n, len(data))
+	}
+	w.advanceLocked(n)
+	w.pendingWrites += len(entries)
+	recordWrite(callAtomic, len(entries), n)
+
+	reason := syncReasonPolicy
+	if syncNow {
+		reason = syncReasonExplicit
+	}
+	if syncNow || w.syncPolicy.Immediate || (w.syncPolicy.BatchSize > 0 && w.pendingWrites >= w.syncPolicy.BatchSize) {
+		if err := w.syncLocked(reason); err != nil {
+			return nil, fmt.Errorf("failed to sync: %w", err)
+		}
+	}
+
+	if w.offset >= w.maxSize {
+		if err := w.rotateLocked(rotateReasonSize); err != nil {
+			return nil, fmt.Errorf("failed to rotate segment: %w", err)
+		}
+	}
+
+	return lsns, nil
+}
+
+// RateLimit returns the limit appends are throttled to (zero if none)
+func (w *WALWriter) RateLimit() RateLimit {
+	if w.limiter == nil {
+		return RateLimit{}
+	}
+	return w.limiter.limit
+}
+
 // Sync forces fsync to disk
 func (w *WALWriter) Sync() error {
 	w.mu.Lock()
 	defer w.mu.Unlock()
-	return w.syncLocked()
+	return w.syncLocked(syncReasonExplicit)
 }
 
-// syncLocked syncs while holding the mutex
-func (w *WALWriter) syncLocked() error {
+// syncLocked syncs while holding the mutex; reason labels the fsync metrics
+func (w *WALWriter) syncLocked(reason string) error {
 	if w.file == nil || w.pendingWrites == 0 {
 		return nil
 	}
 
-	if err := w.file.Sync(); err != nil {
+	if err := w.fsyncLocked(reason); err != nil {
 		return err
 	}
 
 	w.pendingWrites = 0
-	w.lastSync = time.Now()
+	w.markSyncedLocked()
 	return nil
 }
 
-// rotateLocked rotates to a new segment while holding the mutex
-func (w *WALWriter) rotateLocked() error {
+// markSyncedLocked records that every written record is on disk and wakes
+// WaitSynced callers
+func (w *WALWriter) markSyncedLocked() {
+	w.lastSync = w.wall.Now()
+	w.syncedLSN = atomic.LoadUint64(&w.lsn) - 1
+	close(w.synced)
+	w.synced = make(chan struct{})
+}
+
+// WaitSynced blocks until the record at lsn is on disk. With a batched sync
+// policy it rides the next group commit (the interval or batch size sync)
+// instead of forcing one; without background syncs it syncs itself.
+func (w *WALWriter) WaitSynced(ctx context.Context, lsn uint64) error {
+	w.queued.Add(1)
+	defer w.queued.Add(-1)
+	for {
+		w.mu.Lock()
+		if w.syncedLSN >= lsn {
+			w.mu.Unlock()
+			return nil
+		}
+		if w.closed {
+			w.mu.Unlock()
+			return fmt.Errorf("WAL writer is closed")
+		}
+		if w.syncTicker == nil {
+			err := w.syncLocked(syncReasonExplicit)
+			w.mu.Unlock()
+			return err
+		}
+		synced := w.synced
+		w.mu.Unlock()
+
+		select {
+		case <-synced:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Rotate seals the current segment and starts a new one, even if the
+// current one isn't full
+func (w *WALWriter) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return fmt.Errorf("WAL writer is closed")
+	}
+	return w.rotateLocked(rotateReasonManual)
+}
+
+// rotateLocked rotates to a new segment while holding the mutex; reason
+// labels the rotation metric
+func (w *WALWriter) rotateLocked(reason string) error {
 	// Sync current segment
-	if err := w.syncLocked(); err != nil {
+	if err := w.syncLocked(syncReasonRotate); err != nil {
 		return err
 	}
+	walRotations.WithLabel(reason).Inc()
 
 	oldSegmentID := w.segmentID
 	oldPath := w.segmentPath(oldSegmentID)
@@ -381,10 +718,17 @@ func (w *WALWriter) rotateLocked() error {
 		return fmt.Errorf("failed to close segment: %w", err)
 	}
 
+	// The footer lets recovery check the segment is complete from the file
+	// alone. Without one the segment is still read, just not verifiable.
+	if _, err := AppendSegmentFooter(oldPath); err != nil {
+		fmt.Printf("warning: failed to write footer for segment %s: %v\n", oldPath, err)
+	}
+
 	// Update manifest if available
 	if w.manifest != nil {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
+		ctx = WithSegmentActor(ctx, ActorWriter, "segment rotation")
 
 		// Calculate checksum of sealed segment
 		checksum, err := CalculateSegmentChecksum(oldPath)
@@ -397,12 +741,25 @@ func (w *WALWriter) rotateLocked() error {
 		}
 	}
 
+	// Lookups by doc ID skip sealed segments whose filter rules the ID out.
+	// Without a filter a segment is always scanned, so failures only cost speed.
+	if err := w.writeBloom(oldSegmentID, oldPath); err != nil {
+		fmt.Printf("warning: %v for segment %s\n", err, oldPath)
+	}
+
+	// Keep a copy of the sealed segment so it can be repaired later. The
+	// copy is made by the archive loop, so writes don't wait on the backend.
+	if w.archive != nil {
+		w.queueArchive(oldPath)
+	}
+
 	// Create new segment
 	w.segmentID++
 
 	if w.manifest != nil {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
+		ctx = WithSegmentActor(ctx, ActorWriter, "segment rotation")
 
 		newPath := w.segmentPath(w.segmentID)
 		if err := w.manifest.CreateSegment(ctx, w.segmentID, newPath); err != nil {
@@ -418,26 +775,156 @@ func (w *WALWriter) rotateLocked() error {
 	return nil
 }
 
-// startBackgroundSync starts the background sync goroutine
+// writeBloom builds a sealed segment's bloom filter and stores it next to
+// the segment and in the manifest
+func (w *WALWriter) writeBloom(segmentID uint64, path string) error {
+	bloom, err := BuildSegmentBloom(path)
+	if err != nil {
+		return fmt.Errorf("failed to build bloom filter: %w", err)
+	}
+	if err := WriteSegmentBloom(path, bloom); err != nil {
+		return err
+	}
+	if w.manifest == nil {
+		return nil
+	}
+	data, err := bloom.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return w.manifest.SetSegmentBloom(ctx, SegmentTypeWAL, segmentID, data)
+}
+
+// startBackgroundSync starts the background loop, which syncs on the sync
+// policy's interval and seals segments past their max age
 func (w *WALWriter) startBackgroundSync() {
-	w.syncTicker = time.NewTicker(w.syncPolicy.Interval)
-	w.wg.Add(1)
-
-	go func() {
-		defer w.wg.Done()
-		for {
-			select {
-			case <-w.syncTicker.C:
-				w.mu.Lock()
-				if w.pendingWrites > 0 {
-					_ = w.syncLocked()
-				}
-				w.mu.Unlock()
-			case <-w.stopSync:
-				return
-			}
+	if !w.syncPolicy.Immediate && w.syncPolicy.Interval > 0 {
+		w.syncTicker = w.wall.NewTicker(w.syncPolicy.Interval)
+	}
+	if w.maxAge > 0 {
+		w.ageTicker = w.wall.NewTicker(ageCheckInterval(w.maxAge))
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	w.stopSync = stop
+	w.syncDone = w.supervisor.Go(ctx, "wal-sync", w.syncLoop)
+}
+
+// startArchiving starts the archive loop, which copies sealed segments to
+// the archive backend in the order they were sealed
+func (w *WALWriter) startArchiving() {
+	w.archiveWake = make(chan struct{}, 1)
+	ctx, stop := context.WithCancel(context.Background())
+	w.stopArchive = stop
+	w.archiveDone = w.supervisor.Go(ctx, "wal-archive", w.archiveLoop)
+}
+
+// queueArchive hands a sealed segment to the archive loop
+func (w *WALWriter) queueArchive(path string) {
+	w.archiveMu.Lock()
+	w.archivePending = append(w.archivePending, path)
+	w.archiveMu.Unlock()
+	select {
+	case w.archiveWake <- struct{}{}:
+	default: // A signal is already waiting
+	}
+}
+
+// archiveLoop archives queued segments until ctx is canceled, then
+// archives what is still queued and returns
+func (w *WALWriter) archiveLoop(ctx context.Context) error {
+	for {
+		select {
+		case <-w.archiveWake:
+			w.archivePendingSegments()
+		case <-ctx.Done():
+			w.archivePendingSegments()
+			return nil
+		}
+	}
+}
+
+// archivePendingSegments archives every queued segment. A failure is only
+// logged: the segment is still intact locally, it just can't be repaired
+// from the archive.
+func (w *WALWriter) archivePendingSegments() {
+	for {
+		w.archiveMu.Lock()
+		if len(w.archivePending) == 0 {
+			w.archiveMu.Unlock()
+			return
 		}
-	}()
+		path := w.archivePending[0]
+		w.archivePending = w.archivePending[1:]
+		w.archiveMu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err := archiveSegment(ctx, w.archive, path)
+		cancel()
+		if err != nil {
+			fmt.Printf("warning: failed to archive segment %s: %v\n", path, err)
+		}
+	}
+}
+
+// ageCheckInterval is how often segment ages are checked: a tenth of the
+// max age, from a second to a minute, which is how late past its max age a
+// segment can be sealed
+func ageCheckInterval(maxAge time.Duration) time.Duration {
+	return min(max(maxAge/10, time.Second), time.Minute)
+}
+
+// syncLoop syncs pending writes and seals aged segments on every tick
+// until ctx is canceled
+func (w *WALWriter) syncLoop(ctx context.Context) error {
+	var syncs, ages <-chan time.Time // Nil channels never fire
+	if w.syncTicker != nil {
+		syncs = w.syncTicker.C()
+	}
+	if w.ageTicker != nil {
+		ages = w.ageTicker.C()
+	}
+	for {
+		select {
+		case <-syncs:
+			w.syncPending()
+		case <-ages:
+			w.rotateAged()
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// rotateAged seals the current segment if its first record is older than
+// the max age. Empty segments are left open, so a WAL without writes
+// doesn't fill up with them.
+func (w *WALWriter) rotateAged() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed || w.offset == 0 {
+		return
+	}
+	now := w.wall.Now()
+	if w.segmentStart.IsZero() {
+		w.segmentStart = now // Reopened with records written without timestamps
+		return
+	}
+	if now.Sub(w.segmentStart) < w.maxAge {
+		return
+	}
+	if err := w.rotateLocked(rotateReasonAge); err != nil {
+		fmt.Printf("warning: failed to rotate aged segment %d: %v\n", w.segmentID, err)
+	}
+}
+
+func (w *WALWriter) syncPending() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.pendingWrites > 0 {
+		_ = w.syncLocked(syncReasonInterval)
+	}
 }
 
 // Close flushes and closes the current segment
@@ -450,22 +937,35 @@ func (w *WALWriter) Close() error {
 	}
 	w.closed = true
 
-	// Stop background sync
-	if w.syncTicker != nil {
-		w.syncTicker.Stop()
-		close(w.stopSync)
+	// Stop the background loop
+	if w.stopSync != nil {
+		if w.syncTicker != nil {
+			w.syncTicker.Stop()
+		}
+		if w.ageTicker != nil {
+			w.ageTicker.Stop()
+		}
+		w.stopSync()
+
+		// Wait for the background loop
+		w.mu.Unlock()
+		<-w.syncDone
+		w.mu.Lock()
 	}
 
-	// Wait for background goroutine
-	w.mu.Unlock()
-	w.wg.Wait()
-	w.mu.Lock()
+	// Nothing rotates any more: archive the segments still queued. The
+	// archive loop doesn't take w.mu.
+	if w.stopArchive != nil {
+		w.stopArchive()
+		<-w.archiveDone
+	}
 
 	// Sync and close file
 	if w.file != nil {
-		if err := w.file.Sync(); err != nil {
+		if err := w.fsyncLocked(syncReasonClose); err != nil {
 			return fmt.Errorf("failed to sync on close: %w", err)
 		}
+		w.markSyncedLocked()
 		if err := w.file.Close(); err != nil {
 			return fmt.Errorf("failed to close segment: %w", err)
 		}
@@ -479,6 +979,13 @@ func (w *WALWriter) CurrentLSN() uint64 {
 	return atomic.LoadUint64(&w.lsn)
 }
 
+// QueueDepth returns the writes waiting on the writer: appends waiting for
+// the lock or their fsync, and callers waiting for a group commit. It grows
+// when the disk can't keep up.
+func (w *WALWriter) QueueDepth() int {
+	return int(w.queued.Load())
+}
+
 // CurrentSegmentID returns the current segment ID
 func (w *WALWriter) CurrentSegmentID() uint64 {
 	w.mu.Lock()
@@ -4,7 +4,11 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/clock"
 )
 
 func TestNewWALWriter(t *testing.T) {
@@ -241,3 +245,440 @@ func TestWALWriterSync(t *testing.T) {
 		t.Errorf("sync failed: %v", err)
 	}
 }
+
+// benchPayload is roughly the size of a short document with its embedding
+var benchPayload = make([]byte, 1024)
+
+// benchRecordSize is the encoded size of a record carrying benchPayload
+func benchRecordSize() int64 {
+	rec, _ := NewRecord(RecordTypeInsert, 1, benchPayload)
+	return int64(rec.TotalSize())
+}
+
+func BenchmarkAppend(b *testing.B) {
+	policies := []struct {
+		name   string
+		policy SyncPolicy
+	}{
+		{"batched", DefaultSyncPolicy()},
+		{"immediate", ImmediateSyncPolicy()},
+	}
+
+	for _, p := range policies {
+		b.Run(p.name, func(b *testing.B) {
+			writer, err := NewWALWriter(b.TempDir(), WithSyncPolicy(p.policy))
+			if err != nil {
+				b.Fatalf("failed to create WAL writer: %v", err)
+			}
+			defer func() { _ = writer.Close() }()
+
+			b.SetBytes(benchRecordSize())
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := writer.Append(RecordTypeInsert, benchPayload); err != nil {
+					b.Fatalf("append failed: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkAppendBatch writes 64 records per group commit; compare with
+// BenchmarkAppend/immediate, which pays an fsync per record
+func BenchmarkAppendBatch(b *testing.B) {
+	writer, err := NewWALWriter(b.TempDir(), WithSyncPolicy(ImmediateSyncPolicy()))
+	if err != nil {
+		b.Fatalf("failed to create WAL writer: %v", err)
+	}
+	defer func() { _ = writer.Close() }()
+
+	reqs := make([]RecordRequest, 64)
+	for i := range reqs {
+		reqs[i] = RecordRequest{Type: RecordTypeInsert, Payload: benchPayload}
+	}
+	b.SetBytes(benchRecordSize())
+	b.ResetTimer()
+	for i := 0; i < b.N; i += len(reqs) {
+		if _, err := writer.AppendBatch(reqs); err != nil {
+			b.Fatalf("append failed: %v", err)
+		}
+	}
+}
+
+func BenchmarkAppendRotation(b *testing.B) {
+	// Rotate every 64 records so sealing dominates
+	writer, err := NewWALWriter(b.TempDir(),
+		WithSyncPolicy(DefaultSyncPolicy()),
+		WithMaxSegmentSize(64*benchRecordSize()),
+	)
+	if err != nil {
+		b.Fatalf("failed to create WAL writer: %v", err)
+	}
+	defer func() { _ = writer.Close() }()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := writer.Append(RecordTypeInsert, benchPayload); err != nil {
+			b.Fatalf("append failed: %v", err)
+		}
+	}
+	b.ReportMetric(float64(writer.CurrentSegmentID()), "segments")
+}
+
+func TestAppendBatch(t *testing.T) {
+	dir := t.TempDir()
+	writer, err := NewWALWriter(dir, WithSyncPolicy(ImmediateSyncPolicy()), WithMaxSegmentSize(256))
+	if err != nil {
+		t.Fatalf("failed to create WAL writer: %v", err)
+	}
+
+	reqs := make([]RecordRequest, 10)
+	for i := range reqs {
+		reqs[i] = RecordRequest{Type: RecordTypeInsert, Payload: make([]byte, 60)}
+	}
+	lsns, err := writer.AppendBatch(reqs)
+	if err != nil {
+		t.Fatalf("AppendBatch failed: %v", err)
+	}
+	for i, lsn := range lsns {
+		if lsn != uint64(i+1) {
+			t.Fatalf("expected LSNs 1..10, got %v", lsns)
+		}
+	}
+	if writer.pendingWrites != 0 {
+		t.Errorf("expected the batch to be synced, %d writes pending", writer.pendingWrites)
+	}
+	if writer.CurrentSegmentID() < 3 {
+		t.Errorf("expected the batch to rotate segments, still on %d", writer.CurrentSegmentID())
+	}
+
+	// An invalid record fails the whole batch before any LSN is taken
+	bad := []RecordRequest{{Type: RecordTypeInsert, Payload: []byte("a")}, {Type: RecordTypeInsert, Payload: make([]byte, MaxPayloadSize+1)}}
+	if _, err := writer.AppendBatch(bad); err == nil {
+		t.Error("expected an oversized record to fail the batch")
+	}
+	if next := writer.CurrentLSN(); next != 11 {
+		t.Errorf("next LSN = %d, want 11", next)
+	}
+	_ = writer.Close()
+
+	var got []uint64
+	segments, _ := ListSegmentFiles(dir)
+	for _, seg := range segments {
+		records, err := ReadAllRecords(seg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, rec := range records {
+			if rec.InBatch() {
+				t.Errorf("record %d carries FlagBatch", rec.LSN)
+			}
+			got = append(got, rec.LSN)
+		}
+	}
+	if len(got) != 10 {
+		t.Errorf("expected 10 records on disk, got %v", got)
+	}
+}
+
+func TestWALWriterNodeID(t *testing.T) {
+	dir := t.TempDir()
+
+	writer, err := NewWALWriter(dir, WithSyncPolicy(ImmediateSyncPolicy()), WithNodeID(9))
+	if err != nil {
+		t.Fatalf("failed to create WAL writer: %v", err)
+	}
+	if _, err := writer.Append(RecordTypeInsert, []byte("a")); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	if _, err := writer.AppendWithSync(RecordTypeInsert, []byte("b")); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	path := writer.segmentPath(writer.segmentID)
+	_ = writer.Close()
+
+	records, err := ReadAllRecords(path)
+	if err != nil {
+		t.Fatalf("failed to read records: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+	for _, rec := range records {
+		if node, ok := rec.OriginNode(); !ok || node != 9 {
+			t.Errorf("record %d: expected origin 9, got %d (set %v)", rec.LSN, node, ok)
+		}
+	}
+}
+
+func TestWALWriterWaitSynced(t *testing.T) {
+	// Batched: waiters ride the background group commit
+	writer, err := NewWALWriter(t.TempDir(), WithSyncPolicy(SyncPolicy{Interval: 10 * time.Millisecond}))
+	if err != nil {
+		t.Fatalf("failed to create WAL writer: %v", err)
+	}
+	lsn, _ := writer.Append(RecordTypeInsert, []byte("a"))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := writer.WaitSynced(ctx, lsn); err != nil {
+		t.Errorf("expected the group commit to sync LSN %d: %v", lsn, err)
+	}
+	_ = writer.Close()
+
+	// No background sync: waiters sync themselves
+	writer, err = NewWALWriter(t.TempDir(), WithSyncPolicy(SyncPolicy{}))
+	if err != nil {
+		t.Fatalf("failed to create WAL writer: %v", err)
+	}
+	defer func() { _ = writer.Close() }()
+	lsn, _ = writer.Append(RecordTypeInsert, []byte("b"))
+	if err := writer.WaitSynced(context.Background(), lsn); err != nil {
+		t.Errorf("expected WaitSynced to sync: %v", err)
+	}
+	if writer.pendingWrites != 0 {
+		t.Errorf("expected no pending writes, got %d", writer.pendingWrites)
+	}
+}
+
+func TestWALWriterWallClock(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	fake := clock.NewFake(start)
+	writer, err := NewWALWriter(dir, WithSyncPolicy(SyncPolicy{Interval: time.Hour, BatchSize: 1000}), WithWallClock(fake))
+	if err != nil {
+		t.Fatalf("failed to create WAL writer: %v", err)
+	}
+	defer func() { _ = writer.Close() }()
+
+	// The group commit waits for the fake clock to pass the interval
+	lsn, _ := writer.Append(RecordTypeInsert, []byte("a"))
+	fake.WaitForTickers(1)
+	expired, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := writer.WaitSynced(expired, lsn); err == nil {
+		t.Fatal("expected no sync before the interval")
+	}
+	fake.Advance(time.Hour)
+	if err := writer.WaitSynced(context.Background(), lsn); err != nil {
+		t.Fatalf("expected the interval sync: %v", err)
+	}
+
+	records, err := ReadAllRecords(filepath.Join(dir, SegmentFilename(1)))
+	if err != nil || len(records) != 1 {
+		t.Fatalf("expected 1 record, got %d: %v", len(records), err)
+	}
+	if at, ok := records[0].AppliedAt(); !ok || !at.Equal(start) {
+		t.Errorf("expected the record timestamped %s, got %s", start, at)
+	}
+}
+
+func TestWALWriterMaxSegmentAge(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	fake := clock.NewFake(start)
+	writer, err := NewWALWriter(dir, WithSyncPolicy(ImmediateSyncPolicy()), WithWallClock(fake), WithMaxSegmentAge(time.Hour))
+	if err != nil {
+		t.Fatalf("failed to create WAL writer: %v", err)
+	}
+	defer func() { _ = writer.Close() }()
+	fake.WaitForTickers(1)
+
+	// An empty segment never ages, however quiet the WAL is
+	fake.Advance(2 * time.Hour)
+	writer.rotateAged()
+	if id := writer.CurrentSegmentID(); id != 1 {
+		t.Fatalf("expected the empty segment kept open, got segment %d", id)
+	}
+
+	// A segment's age starts at its first record
+	if _, err := writer.Append(RecordTypeInsert, []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	fake.Advance(59 * time.Minute)
+	writer.rotateAged()
+	if id := writer.CurrentSegmentID(); id != 1 {
+		t.Fatalf("expected no rotation before the max age, got segment %d", id)
+	}
+
+	// The background loop seals it once it's an hour old
+	fake.Advance(time.Minute)
+	deadline := time.Now().Add(5 * time.Second)
+	for writer.CurrentSegmentID() != 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the background loop to seal the aged segment")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if footer, err := ReadSegmentFooter(filepath.Join(dir, SegmentFilename(1))); err != nil || footer == nil {
+		t.Errorf("expected the aged segment sealed with a footer: %v", err)
+	}
+}
+
+func TestWALWriterSupervisedSync(t *testing.T) {
+	sup := &recordingSupervisor{}
+	w, err := NewWALWriter(t.TempDir(), WithSyncPolicy(DefaultSyncPolicy()), WithSupervisor(sup))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Append(RecordTypeInsert, []byte("payload")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	sup.mu.Lock()
+	defer sup.mu.Unlock()
+	if len(sup.names) != 1 || sup.names[0] != "wal-sync" {
+		t.Errorf("supervised loops = %v, want [wal-sync]", sup.names)
+	}
+}
+
+func TestWALWriterQueueDepth(t *testing.T) {
+	w, err := NewWALWriter(t.TempDir(), WithSyncPolicy(ImmediateSyncPolicy()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = w.Close() }()
+
+	// Hold the writer as a slow fsync would
+	w.mu.Lock()
+	done := make(chan struct{})
+	for i := 0; i < 3; i++ {
+		go func() {
+			_, _ = w.Append(RecordTypeInsert, []byte("payload"))
+			done <- struct{}{}
+		}()
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for w.QueueDepth() != 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := w.QueueDepth(); got != 3 {
+		t.Fatalf("QueueDepth = %d with 3 appends waiting, want 3", got)
+	}
+	w.mu.Unlock()
+	for i := 0; i < 3; i++ {
+		<-done
+	}
+	if got := w.QueueDepth(); got != 0 {
+		t.Errorf("QueueDepth = %d after the appends returned, want 0", got)
+	}
+}
+
+func TestWALWriterMetrics(t *testing.T) {
+	dir := t.TempDir()
+	writer, err := NewWALWriter(dir, WithSyncPolicy(SyncPolicy{BatchSize: 3}), WithMaxSegmentSize(1024))
+	if err != nil {
+		t.Fatalf("failed to create WAL writer: %v", err)
+	}
+	defer func() { _ = writer.Close() }()
+
+	appends, bytes := walAppends.WithLabel(callAppend).Value(), walBytes.WithLabel(callAppend).Value()
+	batches := walAppends.WithLabel(callBatch).Value()
+	policySyncs, explicitSyncs := walFsyncs.WithLabel(syncReasonPolicy).Value(), walFsyncs.WithLabel(syncReasonExplicit).Value()
+	timed := walSyncSeconds.WithLabel(syncReasonPolicy).Count()
+	rotations := walRotations.WithLabel(rotateReasonSize).Value()
+
+	payload, _ := EncodeDeletePayload("doc")
+	offset := writer.CurrentOffset()
+	for i := 0; i < 6; i++ {
+		if _, err := writer.Append(RecordTypeDelete, payload); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+	}
+	written := writer.CurrentOffset() - offset
+	if _, err := writer.AppendBatch([]RecordRequest{{RecordTypeDelete, payload}, {RecordTypeDelete, payload}}); err != nil {
+		t.Fatalf("failed to append batch: %v", err)
+	}
+	if err := writer.Sync(); err != nil {
+		t.Fatalf("failed to sync: %v", err)
+	}
+
+	if got := walAppends.WithLabel(callAppend).Value() - appends; got != 6 {
+		t.Errorf("expected 6 appends, got %d", got)
+	}
+	if got := walBytes.WithLabel(callAppend).Value() - bytes; got != uint64(written) {
+		t.Errorf("expected the %d bytes written, got %d", written, got)
+	}
+	if got := walAppends.WithLabel(callBatch).Value() - batches; got != 2 {
+		t.Errorf("expected 2 batched records, got %d", got)
+	}
+	if got := walFsyncs.WithLabel(syncReasonPolicy).Value() - policySyncs; got != 2 {
+		t.Errorf("expected a policy fsync every 3 appends, got %d", got)
+	}
+	if got := walSyncSeconds.WithLabel(syncReasonPolicy).Count() - timed; got != 2 {
+		t.Errorf("expected both policy fsyncs timed, got %d", got)
+	}
+	if got := walFsyncs.WithLabel(syncReasonExplicit).Value() - explicitSyncs; got != 1 {
+		t.Errorf("expected Sync to count as an explicit fsync, got %d", got)
+	}
+
+	big, _ := EncodeDeletePayload(strings.Repeat("d", 256))
+	for writer.CurrentSegmentID() == 1 {
+		if _, err := writer.Append(RecordTypeDelete, big); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+	}
+	if got := walRotations.WithLabel(rotateReasonSize).Value() - rotations; got != 1 {
+		t.Errorf("expected 1 rotation, got %d", got)
+	}
+}
+
+func TestParseSyncMethod(t *testing.T) {
+	for in, want := range map[string]SyncMethod{"": SyncFsync, "fsync": SyncFsync, "fdatasync": SyncFdatasync, "odsync": SyncODSync} {
+		if got, err := ParseSyncMethod(in); err != nil || got != want {
+			t.Errorf("ParseSyncMethod(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseSyncMethod("fullfsync"); err == nil {
+		t.Error("expected an unknown sync method to fail")
+	}
+}
+
+func TestWALWriterSyncMethods(t *testing.T) {
+	for _, method := range []SyncMethod{SyncFsync, SyncFdatasync, SyncODSync} {
+		t.Run(string(method), func(t *testing.T) {
+			dir := t.TempDir()
+			policy := ImmediateSyncPolicy()
+			policy.Method = method
+			writer, err := NewWALWriter(dir, WithSyncPolicy(policy))
+			if err != nil {
+				t.Fatalf("failed to create WAL writer: %v", err)
+			}
+
+			syncs := walFsyncs.WithLabel(syncReasonPolicy).Value()
+			for i := 0; i < 5; i++ {
+				if _, err := writer.Append(RecordTypeInsert, []byte("payload")); err != nil {
+					t.Fatalf("failed to append: %v", err)
+				}
+			}
+			if _, err := writer.AppendWithSync(RecordTypeInsert, []byte("payload")); err != nil {
+				t.Fatalf("failed to append with sync: %v", err)
+			}
+			if err := writer.WaitSynced(context.Background(), writer.CurrentLSN()-1); err != nil {
+				t.Fatalf("failed to wait for sync: %v", err)
+			}
+
+			// O_DSYNC writes are durable as they're made, so nothing is synced
+			want := uint64(5)
+			if method == SyncODSync {
+				want = 0
+			}
+			if got := walFsyncs.WithLabel(syncReasonPolicy).Value() - syncs; got != want {
+				t.Errorf("expected %d policy syncs, got %d", want, got)
+			}
+			if err := writer.Close(); err != nil {
+				t.Fatalf("failed to close: %v", err)
+			}
+
+			records, err := ReadAllRecords(filepath.Join(dir, "wal_000000000001.seg"))
+			if err != nil {
+				t.Fatalf("failed to read segment: %v", err)
+			}
+			if len(records) != 6 {
+				t.Errorf("expected 6 records, got %d", len(records))
+			}
+		})
+	}
+}
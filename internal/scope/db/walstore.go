@@ -2,11 +2,18 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/dsjohal14/selfstack/internal/libs/capacity"
+	"github.com/dsjohal14/selfstack/internal/libs/clock"
+	"github.com/dsjohal14/selfstack/internal/libs/events"
+	"github.com/dsjohal14/selfstack/internal/libs/membudget"
 	"github.com/dsjohal14/selfstack/internal/relay"
 	"github.com/dsjohal14/selfstack/internal/scope/db/wal"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -21,9 +28,40 @@ type WALStore struct {
 	manifest   wal.ManifestStore
 	db         *pgxpool.Pool
 	compactor  *wal.Compactor
+	compactCfg wal.CompactorConfig
+	lock       *wal.DirLock // Held on walDir until Close
+	fs         wal.FSInfo   // Filesystem walDir is on
+
+	indexBudget *membudget.Budget // Caps index memory; nil for no cap
+	compression wal.Compression   // Of snapshot payloads, like the WAL's
+	gcGrace     time.Duration     // Orphaned files stay quarantined this long
+
+	checkpointMu    sync.Mutex         // Serializes checkpoints, so an older snapshot never replaces a newer one
+	checkpointLSN   atomic.Uint64      // Of the latest snapshot
+	stopCheckpoints context.CancelFunc // Nil without periodic checkpoints
+	checkpointsDone <-chan struct{}
+	digestMismatch  bool // Recovery rebuilt an index that doesn't match the latest checkpoint
+
 	mu         sync.RWMutex
 	closed     bool
 	syncPolicy wal.SyncPolicy // Track sync policy for Add operations
+	appliedLSN atomic.Uint64  // Every record below this LSN is in the index
+	kv         *kvMap         // Internal key-value entries (see KV)
+	schema     *schemaMap     // Collections logged in the WAL (see SchemaLog)
+
+	stagingWindow time.Duration        // 0 writes every Add to the WAL at once
+	staged        map[string]stagedDoc // Writes held back for the staging window
+	stageTimer    *time.Timer          // Ends the current staging window
+
+	backfills map[*Backfill]struct{} // Running backfills, whose writes aren't indexed yet
+
+	applier *applier // Applies writes to the index behind the WAL; nil applies them inline
+
+	ops *opWindow // Documents written under operation IDs; nil without a dedup window
+
+	clock clock.Clock // Times of deletes, operations, and record timestamps
+
+	events *events.Bus // Receives applied records; nil publishes none
 }
 
 // WALStoreConfig holds configuration for WALStore
@@ -43,11 +81,102 @@ type WALStoreConfig struct {
 	// MaxSegmentSize is the max segment size before rotation
 	MaxSegmentSize int64
 
+	// MaxSegmentAge seals a segment once its first record is this old,
+	// even if it isn't full, so a low-traffic WAL still hands segments to
+	// compaction and archival (0 = size only)
+	MaxSegmentAge time.Duration
+
 	// EnableCompaction enables background compaction
 	EnableCompaction bool
 
 	// CompactionConfig is the compaction configuration
 	CompactionConfig wal.CompactorConfig
+
+	// KeywordIndex rebuilds keyword postings during recovery, in the same
+	// pass as the vector index, and keeps them updated on writes
+	KeywordIndex bool
+
+	// Archive receives a copy of every sealed segment and is used to repair
+	// corrupt segments on startup (optional)
+	Archive wal.ArchiveBackend
+
+	// NodeID is recorded as the origin of every WAL record so streams merged
+	// from several nodes can be attributed (0 leaves records unattributed)
+	NodeID uint16
+
+	// StagingWindow holds writes in memory this long before appending them,
+	// collapsing repeated updates of a document into one WAL record (0
+	// disables). Staged writes are acknowledged before they reach the WAL
+	// and are lost in a crash; writes at an explicit consistency level
+	// bypass staging.
+	StagingWindow time.Duration
+
+	// AsyncApply acknowledges writes once they're in the WAL and applies
+	// them to the index on a goroutine of its own, in WAL order. Searches
+	// and reads lag writes until they're applied: Barrier waits for them,
+	// and IndexLSN tells how far the index has come.
+	AsyncApply bool
+
+	// Supervisor runs the background sync and compaction loops, restarting
+	// them if they panic (nil runs them on plain goroutines)
+	Supervisor wal.Supervisor
+
+	// SyncDir fsyncs the WAL directory after creating a segment, so it
+	// survives a crash on filesystems like NFS
+	SyncDir bool
+
+	// Lock selects how the WAL directory is locked against a second
+	// process (default wal.LockAuto)
+	Lock wal.LockStrategy
+
+	// AllowUnsafeFS opens WAL directories on filesystems known to break
+	// fsync or rename semantics, like FUSE mounts of object stores
+	AllowUnsafeFS bool
+
+	// IndexBudget caps the memory of the in-memory index; writes that
+	// would exceed it fail with membudget.ErrExceeded (nil for no cap)
+	IndexBudget *membudget.Budget
+
+	// Compression compresses record payloads in new and compacted segments
+	// (default none). Segments can mix compressed and plain records, so it
+	// can be changed between restarts.
+	Compression wal.Compression
+
+	// CheckpointInterval writes a checkpoint and a snapshot of the index
+	// this often while there are new writes, so recovery replays only the
+	// records after it (0 disables)
+	CheckpointInterval time.Duration
+
+	// RecoverTo rewinds the documents to an earlier LSN or time on open
+	// (see RewindTo). The rewind is written to the WAL, so set it for one
+	// open only: left set, every later open would undo the writes since.
+	RecoverTo wal.RecoveryTarget
+
+	// GCGrace is how long CollectGarbage keeps orphaned files quarantined
+	// before deleting them (wal.DefaultGCGrace if 0)
+	GCGrace time.Duration
+
+	// WriteRateLimit throttles WAL appends so bulk writes like an import
+	// leave disk bandwidth to searches (zero for no limit). Throttled
+	// writes count toward QueueDepth.
+	WriteRateLimit wal.RateLimit
+
+	// DedupWindow is how long writes made under an operation ID (see
+	// WithOperationID) are remembered: a write of the same document under
+	// the same ID within it is skipped, so a retried request doesn't
+	// append it again. The window is rebuilt from the WAL on open (0
+	// disables).
+	DedupWindow time.Duration
+
+	// Clock is read for record timestamps, deletion times, the dedup
+	// window, and the writer's sync loop (nil for the system clock); tests
+	// pass a clock.Fake to control them
+	Clock clock.Clock
+
+	// Events receives an AppliedRecord on events.TopicWALApplied for every
+	// document record written and indexed, and the compactor's runs unless
+	// CompactionConfig has a bus of its own (nil publishes none)
+	Events *events.Bus
 }
 
 // DefaultWALStoreConfig returns a default configuration
@@ -59,6 +188,8 @@ func DefaultWALStoreConfig(dataDir string) WALStoreConfig {
 		MaxSegmentSize:   wal.DefaultMaxSegmentSize,
 		EnableCompaction: false,
 		CompactionConfig: wal.DefaultCompactorConfig(),
+		SyncDir:          true,
+		DedupWindow:      DefaultDedupWindow,
 	}
 }
 
@@ -66,6 +197,10 @@ func DefaultWALStoreConfig(dataDir string) WALStoreConfig {
 func NewWALStore(ctx context.Context, config WALStoreConfig) (*WALStore, error) {
 	// Create index
 	index := NewMemIndex()
+	index.SetBudget(config.IndexBudget)
+	if config.KeywordIndex {
+		index.EnableKeywordIndex()
+	}
 
 	// Create WAL directory
 	walDir := config.WALDir
@@ -73,21 +208,78 @@ func NewWALStore(ctx context.Context, config WALStoreConfig) (*WALStore, error)
 		walDir = filepath.Join(config.DataDir, "wal")
 	}
 
+	// Refuse filesystems known to lose writes, and lock the directory so a
+	// second process can't write to it as well
+	if err := os.MkdirAll(walDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create WAL directory: %w", err)
+	}
+	fs, err := wal.DetectFilesystem(walDir)
+	if err != nil {
+		fmt.Printf("warning: cannot detect the filesystem of %s: %v\n", walDir, err)
+	}
+	if err := wal.CheckFilesystem(fs, walDir, config.AllowUnsafeFS); err != nil {
+		return nil, err
+	}
+	if fs.Network && !config.SyncDir {
+		fmt.Printf("warning: %s is on %s with directory syncs off; segments created just before a crash may be lost\n", walDir, fs.Type)
+	}
+	lock, err := wal.LockDir(walDir, config.Lock, fs)
+	if err != nil {
+		return nil, err
+	}
+	opened := false
+	defer func() {
+		if !opened {
+			_ = lock.Unlock()
+		}
+	}()
+
 	// Setup manifest
 	var manifest wal.ManifestStore
 	if config.DB != nil {
 		manifest = wal.NewPostgresManifest(config.DB)
 	} else {
-		manifest = wal.NewInMemoryManifest()
+		manifest = wal.NewInMemoryManifest(wal.WithManifestClock(config.Clock))
 	}
 
 	store := &WALStore{
 		dataDir:    config.DataDir,
 		walDir:     walDir,
 		index:      index,
+		kv:         newKVMap(),
+		schema:     newSchemaMap(),
 		manifest:   manifest,
 		db:         config.DB,
 		syncPolicy: config.SyncPolicy,
+		compactCfg: config.CompactionConfig,
+		lock:       lock,
+		fs:         fs,
+
+		indexBudget: config.IndexBudget,
+		compression: config.Compression,
+		gcGrace:     config.GCGrace,
+
+		stagingWindow: config.StagingWindow,
+		staged:        make(map[string]stagedDoc),
+
+		clock:  clock.Or(config.Clock),
+		events: config.Events,
+	}
+	if config.DedupWindow > 0 {
+		store.ops = newOpWindow(config.DedupWindow)
+		store.ops.now = store.clock.Now
+	}
+
+	// Repair corrupt sealed segments from the archive before reading them
+	if config.Archive != nil && config.DB != nil {
+		repairer := wal.NewSegmentRepairer(manifest, config.Archive)
+		repaired, err := repairer.RepairCorrupt(wal.WithSegmentActor(ctx, wal.ActorRecovery, ""))
+		if err != nil {
+			return nil, fmt.Errorf("failed to repair corrupt segments: %w", err)
+		}
+		for _, res := range repaired {
+			fmt.Printf("repaired segment %s from %s\n", res.Filename, res.Source)
+		}
 	}
 
 	// Run recovery FIRST to determine correct LSN and segment ID
@@ -126,6 +318,8 @@ func NewWALStore(ctx context.Context, config WALStoreConfig) (*WALStore, error)
 	// Create WAL writer options with corrected LSN and segment ID
 	opts := []wal.WALWriterOption{
 		wal.WithSyncPolicy(config.SyncPolicy),
+		wal.WithDirSync(config.SyncDir),
+		wal.WithCompression(config.Compression),
 		wal.WithManifest(manifest),
 		wal.WithInitialLSN(initialLSN),
 		wal.WithInitialSegmentID(initialSegmentID),
@@ -133,6 +327,30 @@ func NewWALStore(ctx context.Context, config WALStoreConfig) (*WALStore, error)
 	if config.MaxSegmentSize > 0 {
 		opts = append(opts, wal.WithMaxSegmentSize(config.MaxSegmentSize))
 	}
+	if config.MaxSegmentAge > 0 {
+		opts = append(opts, wal.WithMaxSegmentAge(config.MaxSegmentAge))
+	}
+	if config.Archive != nil {
+		opts = append(opts, wal.WithArchive(config.Archive))
+	}
+	if config.NodeID != 0 {
+		opts = append(opts, wal.WithNodeID(config.NodeID))
+	}
+	if config.Supervisor != nil {
+		opts = append(opts, wal.WithSupervisor(config.Supervisor))
+	}
+	if config.WriteRateLimit.Enabled() {
+		opts = append(opts, wal.WithRateLimit(config.WriteRateLimit))
+	}
+
+	// Keep record timestamps ahead of every recovered one, even if the wall
+	// clock went backwards across the restart
+	opts = append(opts, wal.WithWallClock(store.clock))
+	hlc := wal.NewClockOn(store.clock)
+	if recoveryStats != nil {
+		hlc.Observe(recoveryStats.MaxTimestamp)
+	}
+	opts = append(opts, wal.WithClock(hlc))
 
 	// Create WAL writer
 	writer, err := wal.NewWALWriter(walDir, opts...)
@@ -140,15 +358,25 @@ func NewWALStore(ctx context.Context, config WALStoreConfig) (*WALStore, error)
 		return nil, fmt.Errorf("failed to create WAL writer: %w", err)
 	}
 	store.writer = writer
+	store.appliedLSN.Store(writer.CurrentLSN())
 
-	// Register initial segment in manifest
-	if config.DB != nil {
-		segPath := filepath.Join(walDir, fmt.Sprintf("wal_%012d.seg", initialSegmentID))
-		// Ignore error if segment already exists
-		_ = manifest.CreateSegment(ctx, initialSegmentID, segPath)
+	// Register initial segment in manifest. The in-memory manifest needs this
+	// too, otherwise sealing the segment on rotation fails.
+	segPath := filepath.Join(walDir, fmt.Sprintf("wal_%012d.seg", initialSegmentID))
+	// Ignore error if segment already exists
+	_ = manifest.CreateSegment(wal.WithSegmentActor(ctx, wal.ActorWriter, "writer startup"), initialSegmentID, segPath)
 
-		// Update WAL state with correct LSN after recovery
-		_ = manifest.UpdateWALState(ctx, initialSegmentID, initialLSN)
+	// Update WAL state with correct LSN after recovery
+	_ = manifest.UpdateWALState(ctx, initialSegmentID, initialLSN)
+
+	if !config.RecoverTo.IsZero() {
+		report, err := store.RewindTo(ctx, config.RecoverTo)
+		if err != nil {
+			_ = writer.Close()
+			return nil, err
+		}
+		fmt.Printf("WAL store rewound to %s: %d documents restored, %d deleted\n",
+			config.RecoverTo, report.Restored, report.Deleted)
 	}
 
 	// Setup compactor if enabled
@@ -157,6 +385,15 @@ func NewWALStore(ctx context.Context, config WALStoreConfig) (*WALStore, error)
 		if compactConfig.TmpDir == "" {
 			compactConfig.TmpDir = filepath.Join(walDir, ".tmp")
 		}
+		if compactConfig.Supervisor == nil {
+			compactConfig.Supervisor = config.Supervisor
+		}
+		if compactConfig.Compression == "" {
+			compactConfig.Compression = config.Compression
+		}
+		if compactConfig.Events == nil {
+			compactConfig.Events = config.Events
+		}
 		store.compactor = wal.NewCompactor(manifest, config.DB, walDir, compactConfig)
 	}
 
@@ -168,16 +405,46 @@ func NewWALStore(ctx context.Context, config WALStoreConfig) (*WALStore, error)
 		}
 	}
 
-	fmt.Printf("WAL store initialized: %d documents, next LSN=%d, segment=%d\n",
-		store.index.Count(), initialLSN, initialSegmentID)
+	if config.AsyncApply {
+		sup := config.Supervisor
+		if sup == nil {
+			sup = wal.Unsupervised()
+		}
+		store.startApplier(sup)
+	}
+
+	if recoveryStats != nil {
+		store.checkpointLSN.Store(recoveryStats.SnapshotLSN)
+		store.digestMismatch = recoveryStats.DigestMismatch
+	}
+	if config.CheckpointInterval > 0 {
+		sup := config.Supervisor
+		if sup == nil {
+			sup = wal.Unsupervised()
+		}
+		store.startCheckpoints(config.CheckpointInterval, sup)
+	}
 
+	if store.indexBudget.Exceeded() {
+		fmt.Printf("warning: recovered index holds %d bytes, over its %d byte budget; writes that grow it are refused\n",
+			store.indexBudget.Used(), store.indexBudget.Limit())
+	}
+
+	fmt.Printf("WAL store initialized: %d documents, next LSN=%d, segment=%d, filesystem=%s, lock=%s\n",
+		store.index.Count(), initialLSN, initialSegmentID, fs.Type, lock.Strategy)
+
+	opened = true
 	return store, nil
 }
 
 // recoverAndGetStats rebuilds the in-memory index from WAL and returns stats
 // Uses single-pass file-based recovery to avoid stale manifest overwriting newer data
 func (s *WALStore) recoverAndGetStats(ctx context.Context) (*wal.RecoveryStats, error) {
-	rm := wal.NewRecoveryManager(s.manifest, s.walDir, s.index)
+	opts := []wal.RecoveryOption{wal.WithKVIndex(s.kv), wal.WithSchemaIndex(s.schema)}
+	if s.ops != nil {
+		opts = append(opts, wal.WithOperationIndex(s.ops))
+	}
+	rm := wal.NewRecoveryManager(s.manifest, s.walDir, s.index, opts...)
 
 	// Single-pass file-based recovery - scans all WAL files in order
 	// This is the authoritative source of truth for document state
@@ -198,6 +465,13 @@ func (s *WALStore) recoverAndGetStats(ctx context.Context) (*wal.RecoveryStats,
 		}
 	}
 
+	if stats.DigestLSN > 0 && !stats.DigestMismatch {
+		fmt.Printf("WAL recovery matched the index digest of the checkpoint at LSN %d\n", stats.DigestLSN)
+	}
+	if stats.SnapshotLSN > 0 {
+		fmt.Printf("WAL recovery loaded snapshot at LSN %d (%d records), skipping %d segments\n",
+			stats.SnapshotLSN, stats.SnapshotRecords, stats.SegmentsSkipped)
+	}
 	fmt.Printf("WAL recovery complete: loaded %d records from %d segments in %v\n",
 		stats.RecordsLoaded, stats.SegmentsLoaded, stats.RecoveryTime)
 
@@ -209,48 +483,120 @@ func (s *WALStore) Add(doc Document) error {
 	return s.AddWithContext(context.Background(), doc)
 }
 
-// AddWithContext adds a document with context
-func (s *WALStore) AddWithContext(_ context.Context, doc Document) error {
+// AddWithContext adds a document with context. Under WithConsistency the
+// write isn't synced on its own; Commit makes it durable. Under
+// WithOperationID it does nothing if the operation already wrote the
+// document within the dedup window.
+func (s *WALStore) AddWithContext(ctx context.Context, doc Document) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	return s.addLocked(ctx, doc)
+}
 
+// addLocked is AddWithContext under s.mu
+func (s *WALStore) addLocked(ctx context.Context, doc Document) error {
 	if s.closed {
 		return fmt.Errorf("store is closed")
 	}
+	opID := OperationIDFromContext(ctx)
+	if opID != "" && s.ops != nil {
+		if _, ok := s.ops.applied(opID, doc.ID); ok {
+			return nil
+		}
+	}
+	if err := s.reserveIndexLocked(doc, 0); err != nil {
+		return err
+	}
+
+	s.supersedeBackfillsLocked(doc.ID)
+
+	// Chatty writers are collapsed in memory unless the caller asked for
+	// a consistency level, or named the operation so its retries are
+	// recognized
+	if s.stagingWindow > 0 && ConsistencyFromContext(ctx) == ConsistencyDefault && opID == "" {
+		s.stageLocked(doc)
+		return nil
+	}
+	if err := s.unstageLocked(doc.ID); err != nil {
+		return err
+	}
 
 	// Determine record type (INSERT or UPDATE)
 	recType := wal.RecordTypeInsert
-	if s.index.Has(doc.ID) {
+	if s.hasLocked(doc.ID) {
 		recType = wal.RecordTypeUpdate
 	}
 
-	// Encode payload
+	payload, err := encodeDocOp(doc, opID)
+	if err != nil {
+		return err
+	}
+
+	lsn, err := s.append(ctx, recType, payload)
+	if err != nil {
+		return fmt.Errorf("failed to write to WAL: %w", err)
+	}
+
+	s.recordOperation(opID, doc.ID, lsn)
+	s.applyLocked([]indexChange{{id: doc.ID, doc: doc, lsn: lsn, recType: recType, collection: doc.Collection}}, lsn+1)
+
+	return nil
+}
+
+// reserveIndexLocked refuses a write of doc that would take the index past
+// its memory budget, counting pending bytes not indexed yet. Writes that
+// shrink a document, and deletes, always pass, so an index over budget can
+// still be trimmed.
+func (s *WALStore) reserveIndexLocked(doc Document, pending int64) error {
+	delta := docBytes(doc)
+	if old, ok := s.lookupLocked(doc.ID); ok {
+		delta -= docBytes(old)
+	}
+	if delta <= 0 {
+		return nil
+	}
+	return s.indexBudget.Reserve(pending + delta)
+}
+
+// OperationApplied reports whether the operation opID wrote docID within
+// the dedup window
+func (s *WALStore) OperationApplied(opID, docID string) bool {
+	if s.ops == nil {
+		return false
+	}
+	_, ok := s.ops.applied(opID, docID)
+	return ok
+}
+
+// recordOperation remembers that the operation opID, if any, wrote docID
+func (s *WALStore) recordOperation(opID, docID string, lsn uint64) {
+	if opID != "" && s.ops != nil {
+		s.ops.RecordOperation(opID, docID, lsn, s.clock.Now())
+	}
+}
+
+// encodeDoc encodes a document as a WAL payload
+func encodeDoc(doc Document) ([]byte, error) {
+	return encodeDocOp(doc, "")
+}
+
+// encodeDocOp encodes a document written under the operation opID
+func encodeDocOp(doc Document, opID string) ([]byte, error) {
 	meta := wal.DocMetadata{
 		Source:    doc.Source,
 		Title:     doc.Title,
 		Text:      doc.Text,
 		Metadata:  doc.Metadata,
 		CreatedAt: doc.CreatedAt,
-	}
-	payload, err := wal.EncodeDocPayload(doc.ID, meta, doc.Embedding)
-	if err != nil {
-		return fmt.Errorf("failed to encode payload: %w", err)
-	}
 
-	// Write to WAL - use sync policy from config
-	if s.syncPolicy.Immediate {
-		_, err = s.writer.AppendWithSync(recType, payload)
-	} else {
-		_, err = s.writer.Append(recType, payload)
+		Collection: doc.Collection,
+		OpID:       opID,
 	}
+	payload, err := wal.EncodeDocPayload(doc.ID, meta, doc.Embedding)
 	if err != nil {
-		return fmt.Errorf("failed to write to WAL: %w", err)
+		return nil, fmt.Errorf("failed to encode payload: %w", err)
 	}
-
-	// Update in-memory index
-	s.index.Set(doc.ID, doc)
-
-	return nil
+	return payload, nil
 }
 
 // Delete marks a document for deletion (tombstone)
@@ -258,8 +604,9 @@ func (s *WALStore) Delete(docID string) error {
 	return s.DeleteWithContext(context.Background(), docID)
 }
 
-// DeleteWithContext marks a document for deletion with context
-func (s *WALStore) DeleteWithContext(_ context.Context, docID string) error {
+// DeleteWithContext marks a document for deletion with context. The
+// tombstone records the time and who wal.WithDeletedBy attached to ctx.
+func (s *WALStore) DeleteWithContext(ctx context.Context, docID string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -267,28 +614,181 @@ func (s *WALStore) DeleteWithContext(_ context.Context, docID string) error {
 		return fmt.Errorf("store is closed")
 	}
 
+	s.supersedeBackfillsLocked(docID)
+
+	// Keep the deleted version in the WAL so it can be restored
+	if err := s.unstageLocked(docID); err != nil {
+		return err
+	}
+
 	// Encode delete payload
-	payload, err := wal.EncodeDeletePayload(docID)
+	info := wal.DeleteInfo{DeletedAt: s.clock.Now(), DeletedBy: wal.DeletedByFromContext(ctx)}
+	payload, err := wal.EncodeDeletePayloadWithInfo(docID, info)
 	if err != nil {
 		return fmt.Errorf("failed to encode delete payload: %w", err)
 	}
 
-	// Write tombstone to WAL - use sync policy from config
-	if s.syncPolicy.Immediate {
-		_, err = s.writer.AppendWithSync(wal.RecordTypeDelete, payload)
-	} else {
-		_, err = s.writer.Append(wal.RecordTypeDelete, payload)
-	}
+	// Write tombstone to WAL
+	lsn, err := s.append(ctx, wal.RecordTypeDelete, payload)
 	if err != nil {
 		return fmt.Errorf("failed to write tombstone to WAL: %w", err)
 	}
 
-	// Update in-memory index
-	s.index.Delete(docID)
+	deleted, _ := s.lookupLocked(docID)
+	s.applyLocked([]indexChange{{id: docID, deleted: true, lsn: lsn, recType: wal.RecordTypeDelete, collection: deleted.Collection}}, lsn+1)
 
 	return nil
 }
 
+// append writes a record, syncing it when the sync policy is immediate and
+// the write isn't part of a request committed with Commit
+func (s *WALStore) append(ctx context.Context, recType wal.RecordType, payload []byte) (uint64, error) {
+	if s.syncPolicy.Immediate && ConsistencyFromContext(ctx) == ConsistencyDefault {
+		return s.writer.AppendWithSync(recType, payload)
+	}
+	return s.writer.Append(recType, payload)
+}
+
+// Commit makes every write so far as durable as c asks: fsync syncs now,
+// batched waits for the next group commit, and async returns at once.
+// ConsistencyDefault follows the sync policy, like a plain Add.
+func (s *WALStore) Commit(ctx context.Context, c Consistency) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return fmt.Errorf("store is closed")
+	}
+	err := s.flushStagedLocked()
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if c == ConsistencyDefault {
+		c = ConsistencyAsync
+		if s.syncPolicy.Immediate {
+			c = ConsistencyFsync
+		}
+	}
+
+	switch c {
+	case ConsistencyFsync:
+		if err := s.writer.Sync(); err != nil {
+			return fmt.Errorf("failed to sync WAL: %w", err)
+		}
+	case ConsistencyBatched:
+		if err := s.writer.WaitSynced(ctx, s.writer.CurrentLSN()-1); err != nil {
+			return fmt.Errorf("failed to wait for WAL sync: %w", err)
+		}
+	}
+	return nil
+}
+
+// DeletedDocument is a deleted document still recorded in the WAL
+type DeletedDocument struct {
+	ID        string
+	DeletedAt time.Time // Zero for deletes made before it was recorded
+	DeletedBy string
+
+	// Previous is the last version before the delete, or nil once
+	// compaction has dropped it
+	Previous *Document
+}
+
+// ErrNotDeleted is returned when restoring a document that isn't deleted
+var ErrNotDeleted = errors.New("document is not deleted")
+
+// ErrNotRestorable is returned when a deleted document's last version is
+// no longer in the WAL
+var ErrNotRestorable = errors.New("deleted document can no longer be restored")
+
+// ListDeleted returns documents deleted at or after since, newest first,
+// while their tombstones are still in the WAL
+func (s *WALStore) ListDeleted(since time.Time) ([]DeletedDocument, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return nil, fmt.Errorf("store is closed")
+	}
+	// Buffered records must be on disk to be scanned
+	if err := s.writer.Sync(); err != nil {
+		return nil, fmt.Errorf("failed to sync WAL: %w", err)
+	}
+
+	scanned, err := wal.ScanDeleted(s.walDir, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan deleted documents: %w", err)
+	}
+
+	deleted := make([]DeletedDocument, len(scanned))
+	for i, d := range scanned {
+		deleted[i] = DeletedDocument{ID: d.DocID, DeletedAt: d.Info.DeletedAt, DeletedBy: d.Info.DeletedBy}
+		if d.Previous != nil {
+			doc := recoveredToDocument(d.Previous)
+			deleted[i].Previous = &doc
+		}
+	}
+	return deleted, nil
+}
+
+// Restore re-adds the last version of a deleted document
+func (s *WALStore) Restore(ctx context.Context, docID string) (Document, error) {
+	if _, found := s.GetLatest(docID); found {
+		return Document{}, ErrNotDeleted
+	}
+
+	d, err := s.findDeleted(docID)
+	if err != nil {
+		return Document{}, err
+	}
+	if d == nil {
+		return Document{}, ErrNotDeleted
+	}
+	if d.Previous == nil {
+		return Document{}, ErrNotRestorable
+	}
+	doc := recoveredToDocument(d.Previous)
+
+	// Checked again with the lock held, and against writes not indexed yet,
+	// so a re-ingest since isn't replaced with the deleted version
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.hasLocked(docID) {
+		return Document{}, ErrNotDeleted
+	}
+	if err := s.addLocked(ctx, doc); err != nil {
+		return Document{}, err
+	}
+	return doc, nil
+}
+
+// findDeleted looks up one deleted document, reading only the segments
+// whose bloom filter may contain it
+func (s *WALStore) findDeleted(docID string) (*wal.DeletedDoc, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return nil, fmt.Errorf("store is closed")
+	}
+	if err := s.writer.Sync(); err != nil {
+		return nil, fmt.Errorf("failed to sync WAL: %w", err)
+	}
+	d, err := wal.FindDeleted(s.walDir, docID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up deleted document: %w", err)
+	}
+	return d, nil
+}
+
+// IndexLSN is the index watermark: every WAL record below it is reflected
+// in search results. It advances with each write, so results computed at
+// one watermark stay valid until it moves.
+func (s *WALStore) IndexLSN() uint64 {
+	return s.appliedLSN.Load()
+}
+
 // Get retrieves a document by ID
 func (s *WALStore) Get(docID string) (Document, bool) {
 	s.mu.RLock()
@@ -296,6 +796,14 @@ func (s *WALStore) Get(docID string) (Document, bool) {
 	return s.index.Get(docID)
 }
 
+// Range iterates over all documents; fn returns false to stop. fn must
+// not write to the store.
+func (s *WALStore) Range(fn func(docID string, doc Document) bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	s.index.Range(fn)
+}
+
 // Search finds documents similar to the query embedding
 func (s *WALStore) Search(query relay.Embedding, limit int) []SearchResult {
 	s.mu.RLock()
@@ -303,6 +811,31 @@ func (s *WALStore) Search(query relay.Embedding, limit int) []SearchResult {
 	return s.index.Search(query, limit)
 }
 
+// SearchFiltered finds documents similar to the query embedding among those matching filter
+func (s *WALStore) SearchFiltered(query relay.Embedding, limit int, filter SearchFilter) []SearchResult {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.index.SearchFiltered(query, limit, filter)
+}
+
+// KeywordSearch ranks documents matching filter by keyword relevance (BM25).
+// Returns false if the store was opened without a keyword index.
+func (s *WALStore) KeywordSearch(query string, limit int, filter SearchFilter) ([]SearchResult, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if !s.index.KeywordIndexEnabled() {
+		return nil, false
+	}
+	return s.index.KeywordSearch(query, limit, filter), true
+}
+
+// CountCollection returns the number of documents in a collection
+func (s *WALStore) CountCollection(collection string) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.index.CountCollection(collection)
+}
+
 // Count returns the number of documents in the store
 func (s *WALStore) Count() int {
 	s.mu.RLock()
@@ -311,9 +844,15 @@ func (s *WALStore) Count() int {
 }
 
 // Flush syncs pending writes to disk
-// For immediate sync policy, this is a no-op since each write already syncs
+// For immediate sync policy, this only writes staged documents since each write already syncs
 // For batched sync policy, this flushes any pending writes
 func (s *WALStore) Flush() error {
+	s.mu.Lock()
+	err := s.flushStagedLocked()
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
 	if s.syncPolicy.Immediate {
 		return nil // Already synced on each write
 	}
@@ -322,6 +861,19 @@ func (s *WALStore) Flush() error {
 
 // Close flushes and closes the store
 func (s *WALStore) Close() error {
+	// Checkpoints take s.mu, so stop them before taking it. A last one
+	// covers the writes since the previous, so a clean restart loads the
+	// snapshot and replays nothing.
+	if s.stopCheckpoints != nil {
+		s.stopCheckpoints()
+		<-s.checkpointsDone
+		if s.writtenSinceCheckpoint() {
+			if err := s.WriteCheckpoint(); err != nil {
+				fmt.Printf("checkpoint error: %v\n", err)
+			}
+		}
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -329,6 +881,18 @@ func (s *WALStore) Close() error {
 		return nil
 	}
 	s.closed = true
+	defer func() { _ = s.lock.Unlock() }() // After the writer closed
+
+	// Write staged documents before the writer closes
+	if s.stageTimer != nil {
+		s.stageTimer.Stop()
+	}
+	stageErr := s.flushStagedLocked()
+
+	// Index what's queued, so the final events go out
+	if s.applier != nil {
+		s.applier.stop()
+	}
 
 	// Stop compactor
 	if s.compactor != nil {
@@ -347,21 +911,10 @@ func (s *WALStore) Close() error {
 		_ = s.manifest.UpdateWALState(ctx, s.writer.CurrentSegmentID(), s.writer.CurrentLSN())
 	}
 
-	return nil
-}
-
-// WriteCheckpoint writes a checkpoint record to the WAL
-func (s *WALStore) WriteCheckpoint() error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	payload, err := wal.EncodeCheckpointPayload(s.writer.CurrentLSN())
-	if err != nil {
-		return err
+	if stageErr != nil {
+		return fmt.Errorf("failed to write staged documents: %w", stageErr)
 	}
-
-	_, err = s.writer.AppendWithSync(wal.RecordTypeCheckpoint, payload)
-	return err
+	return nil
 }
 
 // ForceCompaction triggers a compaction run
@@ -372,6 +925,120 @@ func (s *WALStore) ForceCompaction(ctx context.Context) error {
 	return s.compactor.ForceCompact(ctx)
 }
 
+// CompactionPlan previews a compaction run without modifying any segments.
+// With force, it previews ForceCompaction instead of the scheduled run.
+// Works even when background compaction is disabled.
+func (s *WALStore) CompactionPlan(ctx context.Context, force bool) (*wal.CompactionPlan, error) {
+	c := s.compactor
+	if c == nil {
+		c = wal.NewCompactor(s.manifest, nil, s.walDir, s.compactCfg)
+	}
+	if force {
+		return c.PlanForce(ctx)
+	}
+	return c.Plan(ctx)
+}
+
+// CompactionEnabled reports whether background compaction is running
+func (s *WALStore) CompactionEnabled() bool {
+	return s.compactor != nil
+}
+
+// WALStatus is the state of a WAL store, as recorded in diagnostic bundles
+type WALStatus struct {
+	Dir        string        `json:"dir"`
+	SegmentID  uint64        `json:"segment_id"` // Active segment
+	Offset     int64         `json:"offset"`     // Bytes written to the active segment
+	NextLSN    uint64        `json:"next_lsn"`
+	AppliedLSN uint64        `json:"applied_lsn"`
+	QueueDepth int           `json:"queue_depth"` // Writes waiting on the WAL writer
+	ApplyLag   int           `json:"apply_lag"`   // Writes in the WAL waiting to be indexed
+	Documents  int           `json:"documents"`
+	Staged     int           `json:"staged"`
+	Compaction bool          `json:"compaction"`
+	Filesystem string        `json:"filesystem"` // Of the WAL directory, e.g. ext4 or nfs
+	Lock       string        `json:"lock"`       // How the WAL directory is locked
+	Closed     bool          `json:"closed"`
+	Segments   []SegmentFile `json:"segments"`
+
+	// DigestMismatch is set when the index recovery rebuilt didn't match
+	// the digest of the checkpoint it was checked against
+	DigestMismatch bool `json:"digest_mismatch,omitempty"`
+}
+
+// SegmentFile is a segment file in the WAL directory
+type SegmentFile struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// Status returns the state of the store; the segments are listed from the
+// directory, not the manifest, so it works when Postgres doesn't
+func (s *WALStore) Status() WALStatus {
+	st := WALStatus{
+		Dir:        s.walDir,
+		SegmentID:  s.writer.CurrentSegmentID(),
+		Offset:     s.writer.CurrentOffset(),
+		NextLSN:    s.writer.CurrentLSN(),
+		AppliedLSN: s.appliedLSN.Load(),
+		QueueDepth: s.writer.QueueDepth(),
+		Documents:  s.index.Count(),
+		Compaction: s.compactor != nil,
+		Filesystem: s.fs.Type,
+		Lock:       string(s.lock.Strategy),
+
+		DigestMismatch: s.digestMismatch,
+	}
+
+	s.mu.RLock()
+	st.Staged = len(s.staged)
+	if s.applier != nil {
+		st.ApplyLag = s.applier.lag()
+	}
+	st.Closed = s.closed
+	s.mu.RUnlock()
+
+	paths, _ := filepath.Glob(filepath.Join(s.walDir, "*.seg"))
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			st.Segments = append(st.Segments, SegmentFile{Name: filepath.Base(path), Size: info.Size()})
+		}
+	}
+	return st
+}
+
+// QueueDepth returns the writes waiting on the WAL writer (see
+// wal.WALWriter.QueueDepth)
+func (s *WALStore) QueueDepth() int {
+	return s.writer.QueueDepth()
+}
+
+// SegmentEvents returns the segment lifecycle audit trail, newest first
+func (s *WALStore) SegmentEvents(ctx context.Context, filter wal.SegmentEventFilter) ([]wal.SegmentEvent, error) {
+	return s.manifest.GetSegmentEvents(ctx, filter)
+}
+
+// DiskUsage returns the bytes and number of WAL segments on disk
+func (s *WALStore) DiskUsage() (int64, int) {
+	segments := s.Status().Segments
+	var n int64
+	for _, seg := range segments {
+		n += seg.Size
+	}
+	return n, len(segments)
+}
+
+// CapacitySample returns the current size of the index and WAL
+func (s *WALStore) CapacitySample() capacity.Sample {
+	walBytes, _ := s.DiskUsage()
+	return capacity.Sample{At: time.Now(), Documents: s.index.Count(), IndexBytes: s.index.Bytes(), WALBytes: walBytes}
+}
+
+// IndexBudget returns the budget capping the index's memory, nil for none
+func (s *WALStore) IndexBudget() *membudget.Budget {
+	return s.indexBudget
+}
+
 // Index returns the underlying MemIndex for direct access
 func (s *WALStore) Index() *MemIndex {
 	return s.index
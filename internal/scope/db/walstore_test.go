@@ -2,11 +2,20 @@ package db
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/dsjohal14/selfstack/internal/libs/clock"
+	"github.com/dsjohal14/selfstack/internal/libs/events"
+	"github.com/dsjohal14/selfstack/internal/libs/membudget"
 	"github.com/dsjohal14/selfstack/internal/relay"
 	"github.com/dsjohal14/selfstack/internal/scope/db/wal"
+	"github.com/rs/zerolog"
 )
 
 func TestNewWALStore(t *testing.T) {
@@ -350,3 +359,865 @@ func TestWALStoreFlush(t *testing.T) {
 		t.Errorf("flush failed: %v", err)
 	}
 }
+
+func TestWALStoreKeywordIndexRecovery(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	config := DefaultWALStoreConfig(dir)
+	config.SyncPolicy = wal.ImmediateSyncPolicy()
+	config.KeywordIndex = true
+
+	store, err := NewWALStore(ctx, config)
+	if err != nil {
+		t.Fatalf("failed to create WAL store: %v", err)
+	}
+
+	for id, text := range map[string]string{
+		"doc-1": "segment rotation in the WAL writer",
+		"doc-2": "compaction merges sealed segment files",
+		"doc-3": "embeddings for semantic search",
+	} {
+		_ = store.Add(Document{ID: id, Source: "test", Title: id, Text: text, CreatedAt: time.Now(), Embedding: relay.DeterministicEmbed(text)})
+	}
+	_ = store.Delete("doc-2")
+	_ = store.Close()
+
+	// Reopen: postings come back from the recovery pass
+	store, err = NewWALStore(ctx, config)
+	if err != nil {
+		t.Fatalf("failed to reopen WAL store: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	results, ok := store.KeywordSearch("segment", 10, SearchFilter{})
+	if !ok {
+		t.Fatal("keyword index should be enabled")
+	}
+	if len(results) != 1 || results[0].DocID != "doc-1" {
+		t.Errorf("expected only doc-1 to match after recovery, got %+v", results)
+	}
+
+	// Stores opened without the option don't answer keyword queries
+	plainConfig := DefaultWALStoreConfig(t.TempDir())
+	plain, _ := NewWALStore(ctx, plainConfig)
+	defer func() { _ = plain.Close() }()
+	if _, ok := plain.KeywordSearch("segment", 10, SearchFilter{}); ok {
+		t.Error("keyword search should be unavailable without the option")
+	}
+}
+
+func TestWALStoreCollectionFilterRecovery(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	config := DefaultWALStoreConfig(dir)
+	config.SyncPolicy = wal.ImmediateSyncPolicy()
+
+	store1, err := NewWALStore(ctx, config)
+	if err != nil {
+		t.Fatalf("failed to create WAL store: %v", err)
+	}
+
+	now := time.Now()
+	docs := []Document{
+		{ID: "d1", Title: "Default", CreatedAt: now},
+		{ID: "n1", Title: "Fresh note", CreatedAt: now, Collection: "notes"},
+		{ID: "n2", Title: "Old note", CreatedAt: now.AddDate(0, 0, -30), Collection: "notes"},
+	}
+	for _, doc := range docs {
+		doc.Embedding = relay.DeterministicEmbed(doc.Title)
+		if err := store1.Add(doc); err != nil {
+			t.Fatalf("failed to add document: %v", err)
+		}
+	}
+	_ = store1.Close()
+
+	store2, err := NewWALStore(ctx, config)
+	if err != nil {
+		t.Fatalf("failed to reopen WAL store: %v", err)
+	}
+	defer func() { _ = store2.Close() }()
+
+	if n := store2.CountCollection("notes"); n != 2 {
+		t.Errorf("expected 2 notes after recovery, got %d", n)
+	}
+	if n := store2.CountCollection(DefaultCollection); n != 1 {
+		t.Errorf("expected 1 default document after recovery, got %d", n)
+	}
+
+	filter := SearchFilter{Collection: "notes", CreatedAfter: now.AddDate(0, 0, -7)}
+	results := store2.SearchFiltered(relay.DeterministicEmbed("note"), 10, filter)
+	if len(results) != 1 || results[0].DocID != "n1" || results[0].Collection != "notes" {
+		t.Errorf("expected only n1, got %+v", results)
+	}
+}
+
+func TestWALStoreIndexLSN(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	config := DefaultWALStoreConfig(dir)
+	config.SyncPolicy = wal.ImmediateSyncPolicy()
+
+	store, err := NewWALStore(ctx, config)
+	if err != nil {
+		t.Fatalf("failed to create WAL store: %v", err)
+	}
+
+	start := store.IndexLSN()
+	if err := store.Add(Document{ID: "a", Title: "A"}); err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+	added := store.IndexLSN()
+	if added <= start {
+		t.Errorf("expected add to advance the watermark past %d, got %d", start, added)
+	}
+	if err := store.Delete("a"); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if deleted := store.IndexLSN(); deleted <= added {
+		t.Errorf("expected delete to advance the watermark past %d, got %d", added, deleted)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+
+	// A reopened store starts at the recovered watermark
+	reopened, err := NewWALStore(ctx, config)
+	if err != nil {
+		t.Fatalf("failed to reopen WAL store: %v", err)
+	}
+	defer func() { _ = reopened.Close() }()
+	if got := reopened.IndexLSN(); got < added {
+		t.Errorf("expected recovered watermark of at least %d, got %d", added, got)
+	}
+}
+
+func TestWALStoreCommitConsistency(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultWALStoreConfig(t.TempDir())
+	config.SyncPolicy = wal.SyncPolicy{Interval: time.Hour} // No group commit during the test
+
+	store, err := NewWALStore(ctx, config)
+	if err != nil {
+		t.Fatalf("failed to create WAL store: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	doc := Document{ID: "doc-1", Source: "test", Text: "text", Embedding: relay.DeterministicEmbed("text")}
+	if err := store.AddWithContext(WithConsistency(ctx, ConsistencyBatched), doc); err != nil {
+		t.Fatalf("failed to add: %v", err)
+	}
+	if _, ok := store.Get("doc-1"); !ok {
+		t.Error("expected the write to be applied before it's committed")
+	}
+
+	// Async returns at once; batched waits for a group commit that doesn't come
+	if err := store.Commit(ctx, ConsistencyAsync); err != nil {
+		t.Errorf("async commit failed: %v", err)
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := store.Commit(waitCtx, ConsistencyBatched); err == nil {
+		t.Error("expected batched commit to wait for the group commit")
+	}
+
+	// Fsync syncs now, after which batched has nothing to wait for
+	if err := store.Commit(ctx, ConsistencyFsync); err != nil {
+		t.Fatalf("fsync commit failed: %v", err)
+	}
+	if err := store.Commit(waitCtx, ConsistencyBatched); err != nil {
+		t.Errorf("expected synced writes to be committed: %v", err)
+	}
+
+	if _, err := ParseConsistency("eventual"); err == nil {
+		t.Error("expected an error for an unknown consistency")
+	}
+}
+
+func TestWALStoreStaging(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultWALStoreConfig(t.TempDir())
+	config.StagingWindow = time.Hour // Only Flush ends the window during the test
+
+	store, err := NewWALStore(ctx, config)
+	if err != nil {
+		t.Fatalf("failed to create WAL store: %v", err)
+	}
+
+	start := store.IndexLSN()
+	for _, text := range []string{"v1", "v2", "v3"} {
+		if err := store.Add(Document{ID: "chatty", Title: "Doc", Text: text}); err != nil {
+			t.Fatalf("add failed: %v", err)
+		}
+	}
+	if doc, _ := store.Get("chatty"); doc.Text != "v3" {
+		t.Errorf("expected staged writes to be visible at once, got %q", doc.Text)
+	}
+	if store.IndexLSN() != start {
+		t.Errorf("expected nothing in the WAL during the window, watermark moved to %d", store.IndexLSN())
+	}
+
+	if err := store.Flush(); err != nil {
+		t.Fatalf("flush failed: %v", err)
+	}
+	if got := store.IndexLSN(); got != start+1 {
+		t.Errorf("expected three updates collapsed into one record, watermark went from %d to %d", start, got)
+	}
+
+	// Writes at a consistency level skip staging
+	if err := store.AddWithContext(WithConsistency(ctx, ConsistencyFsync), Document{ID: "strict", Title: "Doc", Text: "now"}); err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+	if got := store.IndexLSN(); got != start+2 {
+		t.Errorf("expected a strict write to reach the WAL at once, watermark is %d", got)
+	}
+
+	// A staged write followed by a delete keeps both, in order
+	if err := store.Add(Document{ID: "gone", Title: "Doc", Text: "brief"}); err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+	if err := store.Delete("gone"); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if err := store.Add(Document{ID: "chatty", Title: "Doc", Text: "v4"}); err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+
+	reopened, err := NewWALStore(ctx, config)
+	if err != nil {
+		t.Fatalf("failed to reopen WAL store: %v", err)
+	}
+	defer func() { _ = reopened.Close() }()
+	if doc, _ := reopened.Get("chatty"); doc.Text != "v4" {
+		t.Errorf("expected Close to write staged documents, got %q", doc.Text)
+	}
+	if _, found := reopened.Get("gone"); found {
+		t.Error("expected the deleted document to stay deleted")
+	}
+	deleted, err := reopened.ListDeleted(time.Time{})
+	if err != nil || len(deleted) != 1 || deleted[0].Previous == nil || deleted[0].Previous.Text != "brief" {
+		t.Errorf("expected the staged version to be restorable, got %+v, %v", deleted, err)
+	}
+}
+
+func TestWALStoreOperationID(t *testing.T) {
+	ctx := context.Background()
+	fake := clock.NewFake(time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC))
+	config := DefaultWALStoreConfig(t.TempDir())
+	config.Clock = fake
+
+	store, err := NewWALStore(ctx, config)
+	if err != nil {
+		t.Fatalf("failed to create WAL store: %v", err)
+	}
+
+	// A retry of the operation writes nothing, even with other content
+	opCtx := WithOperationID(ctx, "op-1")
+	start := store.IndexLSN()
+	for _, text := range []string{"first", "retried"} {
+		if err := store.AddWithContext(opCtx, Document{ID: "doc-1", Title: "Doc", Text: text}); err != nil {
+			t.Fatalf("add failed: %v", err)
+		}
+	}
+	if doc, _ := store.Get("doc-1"); doc.Text != "first" || store.IndexLSN() != start+1 {
+		t.Errorf("expected one record of the first write, got %q and watermark %d", doc.Text, store.IndexLSN())
+	}
+	if !store.OperationApplied("op-1", "doc-1") || store.OperationApplied("op-2", "doc-1") || store.OperationApplied("op-1", "doc-2") {
+		t.Error("expected only op-1 to have written doc-1")
+	}
+
+	// Other documents of the operation, and other operations, are written
+	if err := store.AddWithContext(opCtx, Document{ID: "doc-2", Title: "Doc", Text: "second"}); err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+	if err := store.AddWithContext(WithOperationID(ctx, "op-2"), Document{ID: "doc-1", Title: "Doc", Text: "newer"}); err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+	batch := []BatchOp{{Doc: Document{ID: "doc-3", Title: "Doc", Text: "batched"}}, {Delete: "doc-2"}}
+	for range 2 {
+		if err := store.WriteBatch(WithOperationID(ctx, "op-3"), batch); err != nil {
+			t.Fatalf("batch failed: %v", err)
+		}
+	}
+	if store.IndexLSN() != start+5 {
+		t.Errorf("expected 5 records, watermark moved from %d to %d", start, store.IndexLSN())
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+
+	// The window is rebuilt from the WAL, so a retry after a restart is
+	// still recognized, and a stale retry doesn't undo a newer write
+	reopened, err := NewWALStore(ctx, config)
+	if err != nil {
+		t.Fatalf("failed to reopen WAL store: %v", err)
+	}
+	defer func() { _ = reopened.Close() }()
+	next := reopened.IndexLSN()
+	if err := reopened.AddWithContext(opCtx, Document{ID: "doc-1", Title: "Doc", Text: "first"}); err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+	if doc, _ := reopened.Get("doc-1"); doc.Text != "newer" || reopened.IndexLSN() != next {
+		t.Errorf("expected the retry skipped after the restart, got %q", doc.Text)
+	}
+
+	// Operations are forgotten once the window passes
+	fake.Advance(config.DedupWindow + time.Second)
+	if err := reopened.AddWithContext(opCtx, Document{ID: "doc-1", Title: "Doc", Text: "late"}); err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+	if doc, _ := reopened.Get("doc-1"); doc.Text != "late" || reopened.IndexLSN() != next+1 {
+		t.Errorf("expected a retry after the window written, got %q", doc.Text)
+	}
+}
+
+func TestWALStoreEvents(t *testing.T) {
+	ctx := context.Background()
+	bus := events.New(zerolog.Nop())
+	defer bus.Close()
+	var applied []AppliedRecord
+	bus.Subscribe(events.TopicWALApplied, "test", func(ev events.Event) {
+		applied = append(applied, ev.Payload.(AppliedRecord))
+	}, events.Sync())
+
+	config := DefaultWALStoreConfig(t.TempDir())
+	config.Events = bus
+	store, err := NewWALStore(ctx, config)
+	if err != nil {
+		t.Fatalf("failed to create WAL store: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	// Every document record is announced once it's in the index
+	if err := store.Add(Document{ID: "doc-1", Title: "Doc", Collection: "notes"}); err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+	err = store.WriteBatch(ctx, []BatchOp{{Doc: Document{ID: "doc-1", Title: "Doc", Collection: "notes"}}, {Doc: Document{ID: "doc-2", Title: "Doc"}}})
+	if err != nil {
+		t.Fatalf("batch failed: %v", err)
+	}
+	if err := store.MoveDocuments(ctx, []Move{{From: "doc-2", Doc: Document{ID: "doc-3", Title: "Doc"}}}); err != nil {
+		t.Fatalf("move failed: %v", err)
+	}
+	if err := store.Delete("doc-1"); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	backfill := store.BeginBackfill()
+	if err := backfill.Add(ctx, Document{ID: "doc-4", Title: "Doc"}); err != nil {
+		t.Fatalf("backfill add failed: %v", err)
+	}
+	if len(applied) != 6 {
+		t.Fatalf("expected backfilled documents announced by Finish, got %d events", len(applied))
+	}
+	if _, err := backfill.Finish(); err != nil {
+		t.Fatalf("finish failed: %v", err)
+	}
+
+	want := []AppliedRecord{
+		{Type: "insert", DocID: "doc-1", Collection: "notes"},
+		{Type: "update", DocID: "doc-1", Collection: "notes"},
+		{Type: "insert", DocID: "doc-2"},
+		{Type: "delete", DocID: "doc-2"},
+		{Type: "insert", DocID: "doc-3"},
+		{Type: "delete", DocID: "doc-1", Collection: "notes"},
+		{Type: "insert", DocID: "doc-4"},
+	}
+	if len(applied) != len(want) {
+		t.Fatalf("expected %d events, got %+v", len(want), applied)
+	}
+	for i, rec := range applied {
+		if i > 0 && rec.LSN <= applied[i-1].LSN {
+			t.Errorf("expected increasing LSNs, got %d after %d", rec.LSN, applied[i-1].LSN)
+		}
+		rec.LSN = 0
+		if rec != want[i] {
+			t.Errorf("event %d: expected %+v, got %+v", i, want[i], rec)
+		}
+	}
+}
+
+func TestWALStoreAsyncApply(t *testing.T) {
+	ctx := context.Background()
+
+	// The applier announces each record after indexing it, so holding up
+	// the subscriber holds up the index
+	release := make(chan struct{})
+	bus := events.New(zerolog.Nop())
+	defer bus.Close()
+	var applied []AppliedRecord
+	bus.Subscribe(events.TopicWALApplied, "test", func(ev events.Event) {
+		<-release
+		applied = append(applied, ev.Payload.(AppliedRecord))
+	}, events.Sync())
+
+	dir := t.TempDir()
+	config := DefaultWALStoreConfig(dir)
+	config.AsyncApply = true
+	config.Events = bus
+	store, err := NewWALStore(ctx, config)
+	if err != nil {
+		t.Fatalf("failed to create WAL store: %v", err)
+	}
+
+	// Writes return before they're indexed, but are decided against the
+	// ones queued before them
+	for _, doc := range []Document{{ID: "doc-1", Title: "One"}, {ID: "doc-2", Title: "Two"}, {ID: "doc-2", Title: "Two again"}} {
+		if err := store.Add(doc); err != nil {
+			t.Fatalf("add %s failed: %v", doc.ID, err)
+		}
+	}
+	if err := store.MoveDocuments(ctx, []Move{{From: "doc-2", Doc: Document{ID: "doc-3", Title: "Three"}}}); err != nil {
+		t.Fatalf("expected the move to see the queued doc-2: %v", err)
+	}
+	if _, ok := store.Get("doc-3"); ok {
+		t.Error("expected doc-3 not indexed before the applier gets to it")
+	}
+	if doc, ok := store.GetLatest("doc-3"); !ok || doc.Title != "Three" {
+		t.Errorf("expected GetLatest to see the queued doc-3, got %+v", doc)
+	}
+	if _, ok := store.GetLatest("doc-2"); ok {
+		t.Error("expected GetLatest to see doc-2 moved away")
+	}
+	if lag := store.Status().ApplyLag; lag == 0 {
+		t.Error("expected queued writes in the status")
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := store.Barrier(canceled); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the barrier to give up with its context, got %v", err)
+	}
+
+	// The barrier waits for every write before it
+	close(release)
+	if err := store.Barrier(ctx); err != nil {
+		t.Fatalf("barrier failed: %v", err)
+	}
+	if doc, ok := store.Get("doc-3"); !ok || doc.Title != "Three" {
+		t.Errorf("expected doc-3 visible after the barrier, got %+v", doc)
+	}
+	if _, ok := store.Get("doc-2"); ok {
+		t.Error("expected doc-2 moved away")
+	}
+	if store.IndexLSN() != store.writer.CurrentLSN() {
+		t.Errorf("expected the index watermark at %d, got %d", store.writer.CurrentLSN(), store.IndexLSN())
+	}
+	want := []string{"insert doc-1", "insert doc-2", "update doc-2", "delete doc-2", "insert doc-3"}
+	if len(applied) != len(want) {
+		t.Fatalf("expected %d records applied, got %+v", len(want), applied)
+	}
+	for i, rec := range applied {
+		if got := rec.Type + " " + rec.DocID; got != want[i] {
+			t.Errorf("record %d: expected %s, got %s", i, want[i], got)
+		}
+	}
+
+	// What was acknowledged is in the WAL
+	if err := store.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	store, err = NewWALStore(ctx, DefaultWALStoreConfig(dir))
+	if err != nil {
+		t.Fatalf("failed to reopen WAL store: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+	if _, ok := store.Get("doc-3"); !ok || store.Count() != 2 {
+		t.Errorf("expected doc-1 and doc-3 recovered, got %d documents", store.Count())
+	}
+}
+
+func TestWALStoreRestoreAsyncApply(t *testing.T) {
+	ctx := context.Background()
+	var hold atomic.Bool
+	release := make(chan struct{})
+	bus := events.New(zerolog.Nop())
+	defer bus.Close()
+	bus.Subscribe(events.TopicWALApplied, "test", func(events.Event) {
+		if hold.Load() {
+			<-release
+		}
+	}, events.Sync())
+
+	config := DefaultWALStoreConfig(t.TempDir())
+	config.SyncPolicy = wal.ImmediateSyncPolicy()
+	config.AsyncApply = true
+	config.Events = bus
+	store, err := NewWALStore(ctx, config)
+	if err != nil {
+		t.Fatalf("failed to create WAL store: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+	defer close(release) // Before Close, which drains the applier
+
+	if err := store.Add(Document{ID: "doc-1", Title: "Old"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete("doc-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Barrier(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// The applier stalls on another document, so the re-ingest is queued
+	// but not indexed: the index alone still has doc-1 deleted
+	hold.Store(true)
+	for _, doc := range []Document{{ID: "other"}, {ID: "doc-1", Title: "New"}} {
+		if err := store.Add(doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := store.Get("doc-1"); ok {
+		t.Fatal("expected the re-ingest not indexed yet")
+	}
+	if _, err := store.Restore(ctx, "doc-1"); !errors.Is(err, ErrNotDeleted) {
+		t.Errorf("expected ErrNotDeleted for the re-ingested document, got %v", err)
+	}
+	if doc, ok := store.GetLatest("doc-1"); !ok || doc.Title != "New" {
+		t.Errorf("expected the new version kept, got %+v", doc)
+	}
+}
+
+func TestWALStoreKV(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultWALStoreConfig(t.TempDir())
+
+	store, err := NewWALStore(ctx, config)
+	if err != nil {
+		t.Fatalf("failed to create WAL store: %v", err)
+	}
+	for key, value := range map[string]string{"flags/beta": "on", "flags/dark": "off", "schema/version": "3"} {
+		if err := store.SetKV(ctx, key, []byte(value)); err != nil {
+			t.Fatalf("set %s failed: %v", key, err)
+		}
+	}
+	if err := store.SetKV(ctx, "schema/version", []byte("4")); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	if err := store.DeleteKV(ctx, "flags/dark"); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if store.Count() != 0 {
+		t.Errorf("expected KV entries not to count as documents, got %d", store.Count())
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+
+	reopened, err := NewWALStore(ctx, config)
+	if err != nil {
+		t.Fatalf("failed to reopen WAL store: %v", err)
+	}
+	defer func() { _ = reopened.Close() }()
+	if v, ok := reopened.GetKV("schema/version"); !ok || string(v) != "4" {
+		t.Errorf("expected the latest value to be recovered, got %q %v", v, ok)
+	}
+	if keys := reopened.ListKV("flags/"); len(keys) != 1 || keys[0] != "flags/beta" {
+		t.Errorf("expected only flags/beta after the delete, got %v", keys)
+	}
+	if !CapabilitiesOf(reopened).KV {
+		t.Error("expected the WAL backend to report KV support")
+	}
+}
+
+func TestWALStoreStatus(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	store, err := NewWALStore(ctx, DefaultWALStoreConfig(dir))
+	if err != nil {
+		t.Fatalf("failed to create WAL store: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	if err := store.Add(Document{ID: "doc-1", Text: "hello", Embedding: relay.DeterministicEmbed("hello")}); err != nil {
+		t.Fatalf("failed to add document: %v", err)
+	}
+
+	st := store.Status()
+	if st.Documents != 1 || st.SegmentID != 1 || st.NextLSN != 2 || st.AppliedLSN != 2 {
+		t.Errorf("status = %+v", st)
+	}
+	if len(st.Segments) != 1 || st.Segments[0].Name != wal.SegmentFilename(1) || st.Segments[0].Size != st.Offset {
+		t.Errorf("segments = %+v, want the active segment at offset %d", st.Segments, st.Offset)
+	}
+}
+
+func TestWALStoreLocksDirectory(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultWALStoreConfig(t.TempDir())
+	config.Lock = wal.LockExclusive
+
+	store, err := NewWALStore(ctx, config)
+	if err != nil {
+		t.Fatalf("failed to create WAL store: %v", err)
+	}
+	if _, err := NewWALStore(ctx, config); !errors.Is(err, wal.ErrLocked) {
+		t.Fatalf("second store on the same directory = %v, want ErrLocked", err)
+	}
+	if st := store.Status(); st.Lock != string(wal.LockExclusive) || st.Filesystem == "" {
+		t.Errorf("status = lock %q, filesystem %q", st.Lock, st.Filesystem)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+
+	reopened, err := NewWALStore(ctx, config)
+	if err != nil {
+		t.Fatalf("reopen after close failed: %v", err)
+	}
+	_ = reopened.Close()
+}
+
+func TestWALStoreIndexBudget(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultWALStoreConfig(t.TempDir())
+	config.SyncPolicy = wal.ImmediateSyncPolicy()
+	first := Document{ID: "doc-1", Source: "test", Text: "first", CreatedAt: time.Now()}
+	config.IndexBudget = membudget.New(membudget.ModuleIndex, docBytes(first)+docBytes(first)/2, nil)
+
+	store, err := NewWALStore(ctx, config)
+	if err != nil {
+		t.Fatalf("failed to create WAL store: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	if err := store.Add(first); err != nil {
+		t.Fatalf("add within the budget failed: %v", err)
+	}
+	second := Document{ID: "doc-2", Source: "test", Text: "second", CreatedAt: time.Now()}
+	if err := store.Add(second); !errors.Is(err, membudget.ErrExceeded) {
+		t.Fatalf("expected ErrExceeded over the budget, got %v", err)
+	}
+	if _, found := store.Get("doc-2"); found {
+		t.Error("refused document was indexed")
+	}
+
+	// Replacing a document only needs room for the difference, and deleting
+	// frees room for new ones
+	if err := store.Add(first); err != nil {
+		t.Errorf("replacing a document failed: %v", err)
+	}
+	if err := store.Delete("doc-1"); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if used := config.IndexBudget.Used(); used != 0 {
+		t.Errorf("used = %d after deleting every document, want 0", used)
+	}
+	if err := store.Add(second); err != nil {
+		t.Errorf("add after a delete failed: %v", err)
+	}
+}
+
+func TestWALStoreCompressionRecovery(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	text := strings.Repeat("a long document that compresses well. ", 100)
+
+	config := DefaultWALStoreConfig(dir)
+	config.SyncPolicy = wal.ImmediateSyncPolicy()
+	config.Compression = wal.CompressionZstd
+	store, err := NewWALStore(ctx, config)
+	if err != nil {
+		t.Fatalf("failed to create WAL store: %v", err)
+	}
+	if err := store.Add(Document{ID: "doc-1", Source: "test", Text: text, CreatedAt: time.Now(), Embedding: relay.DeterministicEmbed(text)}); err != nil {
+		t.Fatal(err)
+	}
+	_ = store.Close()
+
+	// Compressed records stay readable after compression is turned off
+	config.Compression = wal.CompressionNone
+	store, err = NewWALStore(ctx, config)
+	if err != nil {
+		t.Fatalf("failed to reopen WAL store: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+	doc, found := store.Get("doc-1")
+	if !found || doc.Text != text {
+		t.Fatal("compressed document not recovered")
+	}
+}
+
+func TestWALStoreCheckpointRecovery(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultWALStoreConfig(t.TempDir())
+	config.MaxSegmentSize = 1024
+
+	store, err := NewWALStore(ctx, config)
+	if err != nil {
+		t.Fatalf("failed to create WAL store: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		text := fmt.Sprintf("doc %d", i)
+		if err := store.Add(Document{ID: fmt.Sprintf("doc-%d", i), Source: "test", Text: text, CreatedAt: time.Now(), Embedding: relay.DeterministicEmbed(text)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = store.Delete("doc-0")
+	_ = store.SetKV(ctx, "flags/beta", []byte("on"))
+	_ = store.LogCollection(ctx, CollectionConfig{Name: "gone"}, false)
+	_ = store.LogCollectionDelete(ctx, "gone")
+	_ = store.LogCollection(ctx, CollectionConfig{Name: "notes", Embedder: relay.ProviderHashing, Dimensions: 64}, true)
+	_ = store.LogCollection(ctx, CollectionConfig{Name: "notes", Embedder: relay.ProviderHashing, Dimensions: 64, RetentionDays: 30}, false)
+	if err := store.WriteCheckpoint(); err != nil {
+		t.Fatalf("checkpoint failed: %v", err)
+	}
+	_ = store.Delete("doc-1")
+	if err := store.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+
+	reopened, err := NewWALStore(ctx, config)
+	if err != nil {
+		t.Fatalf("failed to reopen WAL store: %v", err)
+	}
+	defer func() { _ = reopened.Close() }()
+	if reopened.checkpointLSN.Load() == 0 {
+		t.Error("expected recovery to start from the snapshot")
+	}
+	if reopened.Count() != 3 || reopened.index.Has("doc-0") || reopened.index.Has("doc-1") {
+		t.Errorf("expected doc-2..doc-4, got %v", reopened.index.AllIDs())
+	}
+	if v, ok := reopened.GetKV("flags/beta"); !ok || string(v) != "on" {
+		t.Errorf("expected the KV entry from the snapshot, got %q %v", v, ok)
+	}
+	collections := reopened.Collections()
+	if len(collections) != 1 || collections[0].Config.RetentionDays != 30 || collections[0].ModelLSN == 0 || collections[0].ModelLSN >= collections[0].LSN {
+		t.Errorf("expected notes with its model change, got %+v", collections)
+	}
+}
+
+func TestWALStorePeriodicCheckpoints(t *testing.T) {
+	config := DefaultWALStoreConfig(t.TempDir())
+	config.CheckpointInterval = 10 * time.Millisecond
+	store, err := NewWALStore(context.Background(), config)
+	if err != nil {
+		t.Fatalf("failed to create WAL store: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+	if err := store.Add(Document{ID: "doc-1", Source: "test", Text: "t", CreatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for store.checkpointLSN.Load() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("no checkpoint was written")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	lsn := store.checkpointLSN.Load()
+	time.Sleep(50 * time.Millisecond)
+	if got := store.checkpointLSN.Load(); got != lsn {
+		t.Errorf("expected no checkpoints without new writes, got LSN %d after %d", got, lsn)
+	}
+}
+
+func TestWALStoreShutdownCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultWALStoreConfig(t.TempDir())
+	config.CheckpointInterval = time.Hour
+	open := func() *WALStore {
+		t.Helper()
+		store, err := NewWALStore(ctx, config)
+		if err != nil {
+			t.Fatalf("failed to open WAL store: %v", err)
+		}
+		return store
+	}
+
+	store := open()
+	for i := 0; i < 3; i++ {
+		if err := store.Add(Document{ID: fmt.Sprintf("doc-%d", i), Source: "test", Text: "t", CreatedAt: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+
+	// The snapshot is of the last record, so nothing is replayed
+	store = open()
+	lsn := store.checkpointLSN.Load()
+	if lsn == 0 || lsn != store.writer.CurrentLSN()-1 || store.Count() != 3 {
+		t.Errorf("expected recovery from a snapshot at the last LSN, got %d of %d with %d docs", lsn, store.writer.CurrentLSN()-1, store.Count())
+	}
+	_ = store.Close()
+
+	// Nothing was written, so no new checkpoint
+	store = open()
+	defer func() { _ = store.Close() }()
+	if got := store.checkpointLSN.Load(); got != lsn {
+		t.Errorf("expected the checkpoint at LSN %d to be kept, got %d", lsn, got)
+	}
+}
+
+func TestWALStoreCheckpointDigest(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultWALStoreConfig(t.TempDir())
+	open := func() *WALStore {
+		t.Helper()
+		store, err := NewWALStore(ctx, config)
+		if err != nil {
+			t.Fatalf("failed to open WAL store: %v", err)
+		}
+		return store
+	}
+
+	store := open()
+	for i := 0; i < 3; i++ {
+		doc := Document{ID: fmt.Sprintf("doc-%d", i), Source: "test", Text: "t", Metadata: map[string]string{"k": "v"}, CreatedAt: time.Now(), Embedding: relay.DeterministicEmbed("t")}
+		if err := store.Add(doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = store.Delete("doc-0")
+	if err := store.WriteCheckpoint(); err != nil {
+		t.Fatalf("checkpoint failed: %v", err)
+	}
+	_ = store.Close()
+
+	// A full replay rebuilds the index the checkpoint recorded
+	snaps, _ := wal.ListSnapshots(config.WALDir)
+	for _, snap := range snaps {
+		_ = os.Remove(snap.Path)
+	}
+	stats, err := wal.NewRecoveryManager(wal.NewInMemoryManifest(), config.WALDir, NewMemIndex()).RecoverWithoutManifest(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.DigestLSN == 0 || stats.DigestMismatch {
+		t.Errorf("expected the index to match the checkpoint, got %+v", stats)
+	}
+	store = open()
+	if store.Status().DigestMismatch {
+		t.Error("expected no digest mismatch")
+	}
+
+	// A checkpoint that disagrees with the WAL is reported
+	wrong := store.index.Digest()
+	wrong.Sum++
+	if _, err := store.writer.AppendWithSync(wal.RecordTypeCheckpoint, wal.EncodeCheckpointDigest(store.writer.CurrentLSN(), wrong)); err != nil {
+		t.Fatal(err)
+	}
+	_ = store.Close()
+	store = open()
+	if !store.Status().DigestMismatch {
+		t.Error("expected a digest mismatch to be reported")
+	}
+
+	// Documents written after the checkpoint leave nothing to check against
+	_ = store.Add(Document{ID: "doc-9", Source: "test", Text: "t", CreatedAt: time.Now()})
+	_ = store.Close()
+	store = open()
+	defer func() { _ = store.Close() }()
+	if store.Status().DigestMismatch {
+		t.Error("expected no check once documents follow the checkpoint")
+	}
+}
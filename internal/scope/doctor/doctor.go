@@ -0,0 +1,526 @@
+// Package doctor checks that the environment can run the API: the data
+// directory, Postgres and its migrations, the WAL segments on disk and the
+// manifest describing them, the collections' embedders, and free disk
+// space. `selfstack doctor` prints the report before the service starts.
+package doctor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/relay"
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+	"github.com/dsjohal14/selfstack/internal/scope/db/wal"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Status is the outcome of a check
+type Status string
+
+// Check outcomes; only StatusFail makes the report fail
+const (
+	StatusPass Status = "pass"
+	StatusWarn Status = "warn"
+	StatusFail Status = "fail"
+	StatusSkip Status = "skip"
+)
+
+// DefaultMinFreeBytes is the free space below which the disk check fails
+const DefaultMinFreeBytes = 1 << 30
+
+// errUnsupported is returned by platform checks this OS can't run
+var errUnsupported = errors.New("not supported on this platform")
+
+// Result is the outcome of one check
+type Result struct {
+	Check  string `json:"check"`
+	Status Status `json:"status"`
+	Detail string `json:"detail"`
+}
+
+// Report holds the results of a run, in the order the checks ran
+type Report struct {
+	Results []Result `json:"results"`
+}
+
+// Failed returns the number of failed checks
+func (r *Report) Failed() int {
+	n := 0
+	for _, res := range r.Results {
+		if res.Status == StatusFail {
+			n++
+		}
+	}
+	return n
+}
+
+// add records a result; details are kept to one line, since driver errors
+// can span several
+func (r *Report) add(check string, status Status, format string, args ...any) {
+	detail := strings.Join(strings.Fields(fmt.Sprintf(format, args...)), " ")
+	r.Results = append(r.Results, Result{Check: check, Status: status, Detail: detail})
+}
+
+// Config is the environment to check, normally read from the API's config
+type Config struct {
+	Backend     db.Backend // Empty means db.BackendWAL
+	DataDir     string
+	DatabaseURL string
+
+	// Migrations are the ones the binary embeds; nil skips the check
+	Migrations fs.FS
+	// AutoMigrate applies pending migrations on startup, so they only warn
+	AutoMigrate bool
+
+	// MinFreeBytes is the free space the data directory needs (0 for
+	// DefaultMinFreeBytes)
+	MinFreeBytes uint64
+
+	// Timeout bounds each network check (0 for 5s)
+	Timeout time.Duration
+
+	// AllowUnsafeFS accepts filesystems the WAL refuses by default, so they
+	// only warn
+	AllowUnsafeFS bool
+}
+
+// Run runs every check and returns the report. Checks that depend on a
+// failed one (the manifest on Postgres) are skipped rather than failed.
+func Run(ctx context.Context, cfg Config) *Report {
+	if cfg.Backend == "" {
+		cfg.Backend = db.BackendWAL
+	}
+	if cfg.MinFreeBytes == 0 {
+		cfg.MinFreeBytes = DefaultMinFreeBytes
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+
+	r := &Report{}
+	checkDataDir(r, cfg.DataDir)
+	checkDiskSpace(r, cfg.DataDir, cfg.MinFreeBytes)
+	checkFilesystem(r, cfg.DataDir, cfg.AllowUnsafeFS)
+
+	pool := checkPostgres(ctx, r, cfg)
+	if pool != nil {
+		defer pool.Close()
+	}
+
+	walDir := db.DefaultWALStoreConfig(cfg.DataDir).WALDir
+	if cfg.Backend == db.BackendWAL {
+		checkSegments(r, walDir)
+		checkManifest(ctx, r, pool, cfg)
+	} else {
+		r.add("wal_segments", StatusSkip, "%s backend has no WAL", cfg.Backend)
+		r.add("manifest", StatusSkip, "%s backend has no WAL", cfg.Backend)
+	}
+
+	checkEmbedders(ctx, r, cfg, pool != nil || cfg.DatabaseURL == "" || cfg.Backend == db.BackendFile)
+	return r
+}
+
+// checkDataDir checks that the data directory exists (or can be created),
+// is writable, and supports file locks
+func checkDataDir(r *Report, dir string) {
+	const check = "data_dir"
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		r.add(check, StatusFail, "cannot create %s: %v", dir, err)
+		return
+	}
+
+	probe, err := os.CreateTemp(dir, ".doctor-*")
+	if err != nil {
+		r.add(check, StatusFail, "%s is not writable: %v", dir, err)
+		return
+	}
+	defer func() {
+		_ = probe.Close()
+		_ = os.Remove(probe.Name())
+	}()
+	if _, err := probe.WriteString("selfstack doctor\n"); err != nil {
+		r.add(check, StatusFail, "cannot write to %s: %v", dir, err)
+		return
+	}
+	if err := probe.Sync(); err != nil {
+		r.add(check, StatusFail, "cannot fsync in %s: %v", dir, err)
+		return
+	}
+
+	switch err := tryLock(probe); {
+	case errors.Is(err, errUnsupported):
+		r.add(check, StatusPass, "%s is writable (locking not checked: %v)", dir, err)
+	case err != nil:
+		r.add(check, StatusFail, "%s does not support file locks: %v", dir, err)
+	default:
+		r.add(check, StatusPass, "%s is writable and lockable", dir)
+	}
+}
+
+// checkDiskSpace checks the free space on the data directory's filesystem
+func checkDiskSpace(r *Report, dir string, minFree uint64) {
+	const check = "disk_space"
+	free, err := freeSpace(dir)
+	switch {
+	case errors.Is(err, errUnsupported):
+		r.add(check, StatusSkip, "free space %v", err)
+	case err != nil:
+		r.add(check, StatusFail, "cannot read free space of %s: %v", dir, err)
+	case free < minFree:
+		r.add(check, StatusFail, "%s free, need at least %s", formatBytes(free), formatBytes(minFree))
+	default:
+		r.add(check, StatusPass, "%s free", formatBytes(free))
+	}
+}
+
+// checkFilesystem checks that the data directory isn't on a filesystem the
+// WAL refuses, and notes network filesystems
+func checkFilesystem(r *Report, dir string, allowUnsafe bool) {
+	const check = "filesystem"
+	fs, err := wal.DetectFilesystem(dir)
+	switch {
+	case err != nil:
+		r.add(check, StatusSkip, "cannot detect the filesystem of %s: %v", dir, err)
+	case fs.Unsafe && allowUnsafe:
+		r.add(check, StatusWarn, "%s is on %s, which may lose WAL writes (allowed by WAL_ALLOW_UNSAFE_FS)", dir, fs.Type)
+	case fs.Unsafe:
+		r.add(check, StatusFail, "%s is on %s, which the WAL refuses; use a local or NFS volume, or set WAL_ALLOW_UNSAFE_FS=true", dir, fs.Type)
+	case fs.Network:
+		r.add(check, StatusPass, "%s is on %s, a network filesystem: WAL_LOCK=auto locks it with a lock file; keep WAL_SYNC_DIR=true", dir, fs.Type)
+	default:
+		r.add(check, StatusPass, "%s is on %s", dir, fs.Type)
+	}
+}
+
+// checkPostgres connects to DatabaseURL and compares the applied migrations
+// with the embedded ones. It returns the pool, or nil when there is none.
+func checkPostgres(ctx context.Context, r *Report, cfg Config) *pgxpool.Pool {
+	if cfg.DatabaseURL == "" || cfg.Backend == db.BackendFile {
+		if cfg.Backend == db.BackendPGVector {
+			r.add("postgres", StatusFail, "%s backend requires DATABASE_URL", cfg.Backend)
+		} else {
+			r.add("postgres", StatusSkip, "DATABASE_URL not set; the WAL manifest is in memory")
+		}
+		r.add("migrations", StatusSkip, "no database")
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+
+	pool, err := pgxpool.New(ctx, cfg.DatabaseURL)
+	if err != nil {
+		r.add("postgres", StatusFail, "invalid DATABASE_URL: %v", err)
+		r.add("migrations", StatusSkip, "no database")
+		return nil
+	}
+	start := time.Now()
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		r.add("postgres", StatusFail, "unreachable: %v", err)
+		r.add("migrations", StatusSkip, "no database")
+		return nil
+	}
+	r.add("postgres", StatusPass, "reachable (%v)", time.Since(start).Round(time.Millisecond))
+
+	checkMigrations(ctx, r, pool, cfg)
+	return pool
+}
+
+// checkMigrations lists embedded migrations missing from schema_migrations
+func checkMigrations(ctx context.Context, r *Report, pool *pgxpool.Pool, cfg Config) {
+	const check = "migrations"
+	if cfg.Migrations == nil {
+		r.add(check, StatusSkip, "no migrations to compare")
+		return
+	}
+	files, err := fs.Glob(cfg.Migrations, "*.sql")
+	if err != nil {
+		r.add(check, StatusFail, "cannot list migrations: %v", err)
+		return
+	}
+
+	applied := make(map[string]bool)
+	var exists bool
+	if err := pool.QueryRow(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists); err != nil {
+		r.add(check, StatusFail, "cannot check schema_migrations: %v", err)
+		return
+	}
+	if exists {
+		rows, err := pool.Query(ctx, `SELECT version FROM schema_migrations`)
+		if err != nil {
+			r.add(check, StatusFail, "cannot read schema_migrations: %v", err)
+			return
+		}
+		for rows.Next() {
+			var version string
+			if err := rows.Scan(&version); err != nil {
+				rows.Close()
+				r.add(check, StatusFail, "cannot read schema_migrations: %v", err)
+				return
+			}
+			applied[version] = true
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			r.add(check, StatusFail, "cannot read schema_migrations: %v", err)
+			return
+		}
+	}
+
+	var pending []string
+	for _, name := range files {
+		if version := strings.TrimSuffix(name, ".sql"); !applied[version] {
+			pending = append(pending, version)
+		}
+	}
+	sort.Strings(pending)
+	switch {
+	case len(pending) == 0:
+		r.add(check, StatusPass, "all %d applied", len(files))
+	case cfg.AutoMigrate:
+		r.add(check, StatusWarn, "%d pending, applied on startup: %s", len(pending), strings.Join(pending, ", "))
+	default:
+		r.add(check, StatusFail, "%d pending and DB_AUTO_MIGRATE is off: %s", len(pending), strings.Join(pending, ", "))
+	}
+}
+
+// checkSegments reads every record of every segment in walDir. A bad tail
+// on the newest WAL segment is what a crash mid-write leaves, and recovery
+// truncates it, so it only warns.
+func checkSegments(r *Report, walDir string) {
+	const check = "wal_segments"
+	segments, err := wal.ListSegmentFiles(walDir)
+	if err != nil {
+		r.add(check, StatusFail, "cannot list %s: %v", walDir, err)
+		return
+	}
+	if len(segments) == 0 {
+		r.add(check, StatusPass, "no segments yet")
+		return
+	}
+	walSegments, _ := wal.ListWALSegmentFiles(walDir)
+	var newest string
+	if len(walSegments) > 0 {
+		newest = walSegments[len(walSegments)-1]
+	}
+
+	records := 0
+	var bad, torn []string
+	for _, path := range segments {
+		n, err := scanSegment(path)
+		records += n
+		switch {
+		case err == nil:
+		case path == newest:
+			torn = append(torn, fmt.Sprintf("%s: %v", filepath.Base(path), err))
+		default:
+			bad = append(bad, fmt.Sprintf("%s: %v", filepath.Base(path), err))
+		}
+	}
+	switch {
+	case len(bad) > 0:
+		r.add(check, StatusFail, "%d of %d segments unreadable: %s", len(bad), len(segments), strings.Join(bad, "; "))
+	case len(torn) > 0:
+		r.add(check, StatusWarn, "%d segments, %d records; active segment has a torn tail that recovery will drop: %s", len(segments), records, torn[0])
+	default:
+		r.add(check, StatusPass, "%d segments, %d records", len(segments), records)
+	}
+}
+
+// scanSegment reads every record in a segment and returns how many it read.
+// A sealed segment must also match its footer.
+func scanSegment(path string) (int, error) {
+	it, err := wal.NewSegmentIterator(path)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = it.Close() }()
+	n := 0
+	for it.Next() {
+		n++
+	}
+	if err := it.Err(); err != nil {
+		return n, err
+	}
+	footer := it.Footer()
+	if footer == nil {
+		return n, nil
+	}
+	if uint64(n) != footer.Records {
+		return n, fmt.Errorf("read %d records, footer has %d", n, footer.Records)
+	}
+	_, err = wal.VerifySegmentFooter(path)
+	return n, err
+}
+
+// checkManifest compares the Postgres manifest with the segment files:
+// every segment it lists must exist, and sealed ones must match their
+// checksum. Files it doesn't list only warn.
+func checkManifest(ctx context.Context, r *Report, pool *pgxpool.Pool, cfg Config) {
+	const check = "manifest"
+	if pool == nil {
+		if cfg.DatabaseURL == "" {
+			r.add(check, StatusSkip, "no Postgres manifest; it is rebuilt from disk on startup")
+		} else {
+			r.add(check, StatusSkip, "Postgres unavailable")
+		}
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+
+	manifest := wal.NewPostgresManifest(pool)
+	var listed []wal.SegmentInfo
+	for _, status := range []wal.SegmentStatus{wal.SegmentStatusActive, wal.SegmentStatusSealed, wal.SegmentStatusCompacting} {
+		segs, err := manifest.GetSegmentsByStatus(ctx, status)
+		if err != nil {
+			r.add(check, StatusFail, "cannot read the manifest: %v", err)
+			return
+		}
+		listed = append(listed, segs...)
+	}
+
+	var problems []string
+	known := make(map[string]bool, len(listed))
+	for _, seg := range listed {
+		known[filepath.Clean(seg.Filename)] = true
+		if _, err := os.Stat(seg.Filename); err != nil {
+			problems = append(problems, fmt.Sprintf("%s (%s) missing: %v", filepath.Base(seg.Filename), seg.Status, err))
+			continue
+		}
+		if seg.Status != wal.SegmentStatusSealed || seg.Checksum == nil {
+			continue
+		}
+		ok, err := wal.VerifySegmentChecksum(seg.Filename, *seg.Checksum)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", filepath.Base(seg.Filename), err))
+		} else if !ok {
+			problems = append(problems, fmt.Sprintf("%s checksum mismatch", filepath.Base(seg.Filename)))
+		}
+	}
+
+	files, err := wal.ListSegmentFiles(db.DefaultWALStoreConfig(cfg.DataDir).WALDir)
+	if err != nil {
+		r.add(check, StatusFail, "cannot list segments: %v", err)
+		return
+	}
+	var unlisted []string
+	for _, path := range files {
+		if !known[filepath.Clean(path)] {
+			unlisted = append(unlisted, filepath.Base(path))
+		}
+	}
+
+	switch {
+	case len(problems) > 0:
+		r.add(check, StatusFail, "%s", strings.Join(problems, "; "))
+	case len(unlisted) > 0:
+		r.add(check, StatusWarn, "%d segments match; not in the manifest: %s", len(listed), strings.Join(unlisted, ", "))
+	default:
+		r.add(check, StatusPass, "%d segments match the files on disk", len(listed))
+	}
+}
+
+// checkEmbedders builds every collection's embedder and embeds a probe
+// text, through the provider's network call when it has one
+func checkEmbedders(ctx context.Context, r *Report, cfg Config, registryReachable bool) {
+	const check = "embedders"
+	if !registryReachable {
+		r.add(check, StatusSkip, "collections are stored in Postgres, which is unavailable")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+
+	reg, err := db.OpenCollectionRegistry(ctx, db.OpenConfig{Backend: cfg.Backend, DataDir: cfg.DataDir, DatabaseURL: cfg.DatabaseURL})
+	if err != nil {
+		r.add(check, StatusFail, "cannot open collections: %v", err)
+		return
+	}
+	defer func() { _ = reg.Close() }()
+	collections, err := reg.List(ctx)
+	if err != nil {
+		r.add(check, StatusFail, "cannot list collections: %v", err)
+		return
+	}
+	if !hasCollection(collections, db.DefaultCollection) {
+		// The built-in default isn't listed until it is stored
+		collections = append([]db.CollectionConfig{db.DefaultCollectionConfig()}, collections...)
+	}
+
+	var problems, providers []string
+	seen := make(map[string]bool)
+	for _, c := range collections {
+		embedder, _, err := c.Models()
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", c.Name, err))
+			continue
+		}
+		if err := probeEmbedder(ctx, embedder); err != nil {
+			problems = append(problems, fmt.Sprintf("%s (%s): %v", c.Name, embedder.Name(), err))
+			continue
+		}
+		if !seen[embedder.Name()] {
+			seen[embedder.Name()] = true
+			providers = append(providers, embedder.Name())
+		}
+	}
+	if len(problems) > 0 {
+		r.add(check, StatusFail, "%s", strings.Join(problems, "; "))
+		return
+	}
+	r.add(check, StatusPass, "%d collections ok (%s)", len(collections), strings.Join(providers, ", "))
+}
+
+func hasCollection(collections []db.CollectionConfig, name string) bool {
+	for _, c := range collections {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// probeEmbedder embeds a short text and checks the result is usable
+func probeEmbedder(ctx context.Context, e relay.Embedder) error {
+	const probe = "selfstack doctor"
+	var emb relay.Embedding
+	if remote, ok := e.(relay.FallibleEmbedder); ok {
+		var err error
+		if emb, err = remote.EmbedContext(ctx, probe); err != nil {
+			return fmt.Errorf("unreachable: %w", err)
+		}
+	} else {
+		emb = e.Embed(probe)
+	}
+	for _, v := range emb {
+		if v != 0 {
+			return nil
+		}
+	}
+	return fmt.Errorf("returned an all-zero embedding")
+}
+
+// formatBytes renders n in binary units, e.g. "1.5 GiB"
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,154 @@
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/relay"
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+	"github.com/dsjohal14/selfstack/internal/scope/db/wal"
+)
+
+// writeSegments fills a WAL store in dir with enough documents to roll
+// over into several segments
+func writeSegments(t *testing.T, dir string) []string {
+	t.Helper()
+	config := db.DefaultWALStoreConfig(dir)
+	config.MaxSegmentSize = 4 << 10
+	store, err := db.NewWALStore(context.Background(), config)
+	if err != nil {
+		t.Fatalf("failed to create WAL store: %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		text := fmt.Sprintf("document %d", i)
+		doc := db.Document{ID: fmt.Sprintf("doc-%d", i), Source: "test", Text: text, CreatedAt: time.Now(), Embedding: relay.DeterministicEmbed(text)}
+		if err := store.Add(doc); err != nil {
+			t.Fatalf("failed to add document: %v", err)
+		}
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	segments, err := wal.ListSegmentFiles(config.WALDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) < 2 {
+		t.Fatalf("expected several segments, got %d", len(segments))
+	}
+	return segments
+}
+
+func statuses(r *Report) map[string]Status {
+	m := make(map[string]Status)
+	for _, res := range r.Results {
+		m[res.Check] = res.Status
+	}
+	return m
+}
+
+func TestRunHealthy(t *testing.T) {
+	dir := t.TempDir()
+	writeSegments(t, dir)
+
+	report := Run(context.Background(), Config{DataDir: dir, MinFreeBytes: 1})
+	want := map[string]Status{
+		"data_dir":     StatusPass,
+		"disk_space":   StatusPass,
+		"filesystem":   StatusPass,
+		"postgres":     StatusSkip,
+		"migrations":   StatusSkip,
+		"wal_segments": StatusPass,
+		"manifest":     StatusSkip,
+		"embedders":    StatusPass,
+	}
+	got := statuses(report)
+	for check, status := range want {
+		if got[check] != status {
+			t.Errorf("%s: expected %s, got %s (%v)", check, status, got[check], report.Results)
+		}
+	}
+	if report.Failed() != 0 {
+		t.Errorf("expected no failures, got %d", report.Failed())
+	}
+	if entries, _ := filepath.Glob(filepath.Join(dir, ".doctor-*")); len(entries) != 0 {
+		t.Errorf("expected the probe file to be removed, found %v", entries)
+	}
+}
+
+func TestRunCorruptSegment(t *testing.T) {
+	dir := t.TempDir()
+	segments := writeSegments(t, dir)
+
+	// A bad tail on the newest segment is what a crash leaves
+	newest := segments[len(segments)-1]
+	f, err := os.OpenFile(newest, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.Write([]byte("torn"))
+	_ = f.Close()
+	if got := statuses(Run(context.Background(), Config{DataDir: dir, MinFreeBytes: 1}))["wal_segments"]; got != StatusWarn {
+		t.Errorf("expected a torn active segment to warn, got %s", got)
+	}
+
+	// Anywhere else it's corruption
+	data, err := os.ReadFile(segments[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)/2] ^= 0xFF
+	if err := os.WriteFile(segments[0], data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	report := Run(context.Background(), Config{DataDir: dir, MinFreeBytes: 1})
+	if got := statuses(report)["wal_segments"]; got != StatusFail {
+		t.Errorf("expected a corrupt sealed segment to fail, got %s", got)
+	}
+	if report.Failed() != 1 {
+		t.Errorf("expected 1 failure, got %d: %v", report.Failed(), report.Results)
+	}
+}
+
+func TestRunEnvironmentProblems(t *testing.T) {
+	dir := t.TempDir()
+
+	report := Run(context.Background(), Config{DataDir: dir, MinFreeBytes: 1 << 62})
+	if got := statuses(report)["disk_space"]; got != StatusFail {
+		t.Errorf("expected too little disk space to fail, got %s", got)
+	}
+
+	report = Run(context.Background(), Config{DataDir: dir, Backend: db.BackendPGVector, MinFreeBytes: 1})
+	got := statuses(report)
+	if got["postgres"] != StatusFail {
+		t.Errorf("expected pgvector without DATABASE_URL to fail, got %s", got["postgres"])
+	}
+	if got["wal_segments"] != StatusSkip {
+		t.Errorf("expected WAL checks to be skipped for pgvector, got %s", got["wal_segments"])
+	}
+
+	report = Run(context.Background(), Config{DataDir: dir, DatabaseURL: "postgres://127.0.0.1:1/none?connect_timeout=1", MinFreeBytes: 1, Timeout: 2 * time.Second})
+	got = statuses(report)
+	if got["postgres"] != StatusFail || got["manifest"] != StatusSkip || got["embedders"] != StatusSkip {
+		t.Errorf("expected an unreachable database to fail and skip what depends on it, got %v", report.Results)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := map[uint64]string{
+		512:                 "512 B",
+		2048:                "2.0 KiB",
+		3 << 29:             "1.5 GiB",
+		DefaultMinFreeBytes: "1.0 GiB",
+	}
+	for n, want := range tests {
+		if got := formatBytes(n); got != want {
+			t.Errorf("formatBytes(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package doctor
+
+import "os"
+
+func tryLock(*os.File) error {
+	return errUnsupported
+}
+
+func freeSpace(string) (uint64, error) {
+	return 0, errUnsupported
+}
@@ -0,0 +1,26 @@
+//go:build unix
+
+package doctor
+
+import (
+	"os"
+	"syscall"
+)
+
+// tryLock takes and releases an exclusive lock on f
+func tryLock(f *os.File) error {
+	fd := int(f.Fd())
+	if err := syscall.Flock(fd, syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		return err
+	}
+	return syscall.Flock(fd, syscall.LOCK_UN)
+}
+
+// freeSpace returns the bytes available to unprivileged users on dir's filesystem
+func freeSpace(dir string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
@@ -0,0 +1,155 @@
+// Package ingest provides the extension points of the document ingest path.
+//
+// Pre-ingest hooks run before a document is stored and may enrich it or veto
+// it; post-ingest hooks run after it is stored. Hooks compiled into the
+// binary register themselves from an init function:
+//
+//	func init() {
+//		ingest.RegisterPreIngestHook("tag-source", func(ctx context.Context, doc *db.Document) error {
+//			doc.Metadata["team"] = "search"
+//			return nil
+//		})
+//	}
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+)
+
+// PreIngestHook may modify doc or reject it. Returning a *VetoError (see
+// Veto) rejects the document; any other error fails the ingest. Hooks can't
+// change the document's ID or collection.
+type PreIngestHook func(ctx context.Context, doc *db.Document) error
+
+// PostIngestHook sees a document after it was stored. Errors are logged by
+// the caller; the document stays stored.
+type PostIngestHook func(ctx context.Context, doc db.Document) error
+
+// VetoError is a deliberate rejection of a document by a hook
+type VetoError struct {
+	Hook   string
+	Reason string
+}
+
+func (e *VetoError) Error() string {
+	return fmt.Sprintf("document rejected by %s: %s", e.Hook, e.Reason)
+}
+
+// Veto returns an error that rejects the document with reason
+func Veto(reason string) error {
+	return &VetoError{Reason: reason}
+}
+
+// IsVeto reports whether err is a hook's rejection of the document
+func IsVeto(err error) bool {
+	var veto *VetoError
+	return errors.As(err, &veto)
+}
+
+type namedPre struct {
+	name string
+	fn   PreIngestHook
+}
+
+type namedPost struct {
+	name string
+	fn   PostIngestHook
+}
+
+// Hooks is an ordered set of pre- and post-ingest hooks
+type Hooks struct {
+	mu   sync.RWMutex
+	pre  []namedPre
+	post []namedPost
+}
+
+// NewHooks returns an empty hook set
+func NewHooks() *Hooks {
+	return &Hooks{}
+}
+
+// defaultHooks holds the hooks registered with the package functions
+var defaultHooks = NewHooks()
+
+// Default returns the hooks registered with RegisterPreIngestHook and
+// RegisterPostIngestHook
+func Default() *Hooks {
+	return defaultHooks
+}
+
+// RegisterPreIngestHook adds a pre-ingest hook to the default set. Hooks run
+// in registration order.
+func RegisterPreIngestHook(name string, fn PreIngestHook) {
+	defaultHooks.AddPre(name, fn)
+}
+
+// RegisterPostIngestHook adds a post-ingest hook to the default set
+func RegisterPostIngestHook(name string, fn PostIngestHook) {
+	defaultHooks.AddPost(name, fn)
+}
+
+// AddPre appends a pre-ingest hook
+func (h *Hooks) AddPre(name string, fn PreIngestHook) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.pre = append(h.pre, namedPre{name: name, fn: fn})
+}
+
+// AddPost appends a post-ingest hook
+func (h *Hooks) AddPost(name string, fn PostIngestHook) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.post = append(h.post, namedPost{name: name, fn: fn})
+}
+
+// Len returns the number of pre- and post-ingest hooks
+func (h *Hooks) Len() (pre, post int) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.pre), len(h.post)
+}
+
+// RunPre runs the pre-ingest hooks in order, stopping at the first error
+func (h *Hooks) RunPre(ctx context.Context, doc *db.Document) error {
+	h.mu.RLock()
+	hooks := h.pre
+	h.mu.RUnlock()
+
+	id, collection := doc.ID, doc.Collection
+	for _, hook := range hooks {
+		if err := hook.fn(ctx, doc); err != nil {
+			var veto *VetoError
+			if errors.As(err, &veto) {
+				if veto.Hook == "" {
+					veto.Hook = hook.name
+				}
+				return veto
+			}
+			return fmt.Errorf("pre-ingest hook %s failed: %w", hook.name, err)
+		}
+		if doc.ID != id || doc.Collection != collection {
+			return fmt.Errorf("pre-ingest hook %s changed the document id or collection", hook.name)
+		}
+	}
+	return nil
+}
+
+// RunPost runs every post-ingest hook and returns their errors joined
+func (h *Hooks) RunPost(ctx context.Context, doc db.Document) error {
+	h.mu.RLock()
+	hooks := h.post
+	h.mu.RUnlock()
+
+	var errs []error
+	for _, hook := range hooks {
+		if err := hook.fn(ctx, doc); err != nil {
+			errs = append(errs, fmt.Errorf("post-ingest hook %s failed: %w", hook.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
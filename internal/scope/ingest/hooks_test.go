@@ -0,0 +1,104 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+)
+
+func TestHooksRunPre(t *testing.T) {
+	hooks := NewHooks()
+	hooks.AddPre("tag", func(_ context.Context, doc *db.Document) error {
+		doc.Metadata = map[string]string{"tagged": "true"}
+		return nil
+	})
+	hooks.AddPre("no-drafts", func(_ context.Context, doc *db.Document) error {
+		if strings.HasPrefix(doc.Title, "DRAFT") {
+			return Veto("drafts are not indexed")
+		}
+		return nil
+	})
+
+	doc := db.Document{ID: "d1", Title: "Final"}
+	if err := hooks.RunPre(context.Background(), &doc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if doc.Metadata["tagged"] != "true" {
+		t.Error("expected the first hook to enrich the document")
+	}
+
+	err := hooks.RunPre(context.Background(), &db.Document{ID: "d2", Title: "DRAFT plan"})
+	var veto *VetoError
+	if !errors.As(err, &veto) || veto.Hook != "no-drafts" {
+		t.Fatalf("expected a veto from no-drafts, got %v", err)
+	}
+
+	hooks.AddPre("rename", func(_ context.Context, doc *db.Document) error {
+		doc.ID = "other"
+		return nil
+	})
+	if err := hooks.RunPre(context.Background(), &db.Document{ID: "d3"}); err == nil || IsVeto(err) {
+		t.Errorf("expected an error for a hook changing the ID, got %v", err)
+	}
+}
+
+func TestHooksRunPost(t *testing.T) {
+	hooks := NewHooks()
+	calls := 0
+	hooks.AddPost("fails", func(context.Context, db.Document) error { calls++; return errors.New("boom") })
+	hooks.AddPost("counts", func(context.Context, db.Document) error { calls++; return nil })
+
+	if err := hooks.RunPost(context.Background(), db.Document{ID: "d1"}); err == nil || !strings.Contains(err.Error(), "fails") {
+		t.Errorf("expected the failing hook's error, got %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("expected every post hook to run, got %d calls", calls)
+	}
+}
+
+func TestWebhookPre(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		switch {
+		case strings.Contains(string(body), "secret"):
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			_, _ = w.Write([]byte("contains secrets"))
+		case strings.Contains(string(body), "enrich"):
+			_, _ = w.Write([]byte(`{"id":"d1","source":"hook","title":"Enriched","text":"enrich me","metadata":{"lang":"en"}}`))
+		case strings.Contains(string(body), "broken"):
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+	hook := NewWebhook(srv.URL, time.Second)
+	ctx := context.Background()
+
+	doc := db.Document{ID: "d1", Source: "api", Title: "Doc", Text: "enrich me"}
+	if err := hook.Pre(ctx, &doc); err != nil || doc.Title != "Enriched" || doc.Metadata["lang"] != "en" {
+		t.Errorf("expected an enriched document, got %+v (%v)", doc, err)
+	}
+
+	doc = db.Document{ID: "d2", Title: "Plain"}
+	if err := hook.Pre(ctx, &doc); err != nil || doc.Title != "Plain" {
+		t.Errorf("expected the document unchanged, got %+v (%v)", doc, err)
+	}
+
+	err := hook.Pre(ctx, &db.Document{ID: "d3", Text: "secret key"})
+	var veto *VetoError
+	if !errors.As(err, &veto) || veto.Reason != "contains secrets" {
+		t.Errorf("expected a veto, got %v", err)
+	}
+
+	if err := hook.Pre(ctx, &db.Document{ID: "d4", Text: "broken"}); err == nil || IsVeto(err) {
+		t.Errorf("expected a failure for a 502, got %v", err)
+	}
+}
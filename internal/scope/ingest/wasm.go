@@ -0,0 +1,253 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+)
+
+// WASM transform ABI. A module exports:
+//
+//	memory                             linear memory
+//	alloc(size i32) -> i32             returns a buffer of size bytes for the input
+//	transform(ptr i32, len i32) -> i64 transforms the document JSON at ptr
+//
+// The host writes the document as JSON (the same shape as the ingest
+// webhook) into the buffer returned by alloc and calls transform. A result
+// of 0 skips the document; otherwise the high 32 bits are the pointer and
+// the low 32 bits the length of the transformed document JSON, whose source,
+// title, text, and metadata replace the original's. A trap fails the ingest.
+const (
+	wasmExportAlloc     = "alloc"
+	wasmExportTransform = "transform"
+)
+
+// WASMLimits bound what a transform may use per document
+type WASMLimits struct {
+	MemoryPages uint32        // 64 KiB pages of linear memory
+	Timeout     time.Duration // Per document
+	MaxOutput   uint32        // Bytes of transformed JSON
+}
+
+// DefaultWASMLimits returns 16 MiB of memory, a 1s timeout, and 16 MiB of output
+func DefaultWASMLimits() WASMLimits {
+	return WASMLimits{MemoryPages: 256, Timeout: time.Second, MaxOutput: 16 << 20}
+}
+
+// wasmMetrics are the per-module transform counters
+type wasmMetrics struct {
+	calls    *obs.CounterVec
+	skips    *obs.CounterVec
+	errors   *obs.CounterVec
+	duration *obs.CounterVec
+}
+
+func newWASMMetrics(reg *obs.Registry) *wasmMetrics {
+	return &wasmMetrics{
+		calls:    reg.CounterVec("selfstack_wasm_transform_calls_total", "Documents passed to a WASM transform", "module"),
+		skips:    reg.CounterVec("selfstack_wasm_transform_skips_total", "Documents a WASM transform skipped", "module"),
+		errors:   reg.CounterVec("selfstack_wasm_transform_errors_total", "WASM transform traps, timeouts, and ABI violations", "module"),
+		duration: reg.CounterVec("selfstack_wasm_transform_duration_microseconds_total", "Time spent in a WASM transform", "module"),
+	}
+}
+
+// WASMTransform runs a user-supplied WASM module as a pre-ingest hook. Each
+// document gets a fresh instance, so modules keep no state between calls.
+type WASMTransform struct {
+	name     string
+	runtime  wazero.Runtime
+	compiled wazero.CompiledModule
+	limits   WASMLimits
+	metrics  *wasmMetrics
+}
+
+// NewWASMTransform compiles a module and checks it exports the transform
+// ABI. Metrics go to reg (obs.DefaultRegistry when nil).
+func NewWASMTransform(ctx context.Context, name string, wasm []byte, limits WASMLimits, reg *obs.Registry) (*WASMTransform, error) {
+	if reg == nil {
+		reg = obs.DefaultRegistry
+	}
+	runtime := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(limits.MemoryPages).
+		WithCloseOnContextDone(true))
+
+	compiled, err := runtime.CompileModule(ctx, wasm)
+	if err != nil {
+		_ = runtime.Close(ctx)
+		return nil, fmt.Errorf("failed to compile wasm module %s: %w", name, err)
+	}
+	if err := checkWASMExports(compiled); err != nil {
+		_ = runtime.Close(ctx)
+		return nil, fmt.Errorf("wasm module %s: %w", name, err)
+	}
+
+	return &WASMTransform{
+		name:     name,
+		runtime:  runtime,
+		compiled: compiled,
+		limits:   limits,
+		metrics:  newWASMMetrics(reg),
+	}, nil
+}
+
+// checkWASMExports verifies the module implements the transform ABI
+func checkWASMExports(m wazero.CompiledModule) error {
+	if _, ok := m.ExportedMemories()["memory"]; !ok {
+		return errors.New("must export memory")
+	}
+	fns := m.ExportedFunctions()
+	want := map[string][2][]api.ValueType{
+		wasmExportAlloc:     {{api.ValueTypeI32}, {api.ValueTypeI32}},
+		wasmExportTransform: {{api.ValueTypeI32, api.ValueTypeI32}, {api.ValueTypeI64}},
+	}
+	for name, sig := range want {
+		fn, ok := fns[name]
+		if !ok {
+			return fmt.Errorf("must export function %s", name)
+		}
+		if !sameTypes(fn.ParamTypes(), sig[0]) || !sameTypes(fn.ResultTypes(), sig[1]) {
+			return fmt.Errorf("function %s has the wrong signature", name)
+		}
+	}
+	return nil
+}
+
+func sameTypes(a, b []api.ValueType) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Name returns the module name used in hook errors and metrics
+func (t *WASMTransform) Name() string {
+	return t.name
+}
+
+// Pre is the transform as a PreIngestHook
+func (t *WASMTransform) Pre(ctx context.Context, doc *db.Document) error {
+	start := time.Now()
+	t.metrics.calls.WithLabel(t.name).Inc()
+	defer func() {
+		t.metrics.duration.WithLabel(t.name).Add(uint64(time.Since(start).Microseconds()))
+	}()
+
+	out, err := t.run(ctx, *doc)
+	if err != nil {
+		t.metrics.errors.WithLabel(t.name).Inc()
+		return err
+	}
+	if out == nil {
+		t.metrics.skips.WithLabel(t.name).Inc()
+		return Veto("skipped by wasm transform " + t.name)
+	}
+
+	doc.Source = out.Source
+	doc.Title = out.Title
+	doc.Text = out.Text
+	doc.Metadata = out.Metadata
+	return nil
+}
+
+// run transforms doc in a fresh instance, returning nil when it's skipped
+func (t *WASMTransform) run(ctx context.Context, doc db.Document) (*db.Document, error) {
+	input, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode document: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, t.limits.Timeout)
+	defer cancel()
+
+	mod, err := t.runtime.InstantiateModule(ctx, t.compiled, wazero.NewModuleConfig().WithName(""))
+	if err != nil {
+		return nil, fmt.Errorf("failed to instantiate wasm module %s: %w", t.name, err)
+	}
+	defer func() { _ = mod.Close(context.Background()) }()
+
+	res, err := mod.ExportedFunction(wasmExportAlloc).Call(ctx, uint64(len(input)))
+	if err != nil {
+		return nil, fmt.Errorf("wasm module %s: alloc failed: %w", t.name, err)
+	}
+	ptr := uint32(res[0])
+	if !mod.Memory().Write(ptr, input) {
+		return nil, fmt.Errorf("wasm module %s: alloc returned an out of range buffer", t.name)
+	}
+
+	res, err = mod.ExportedFunction(wasmExportTransform).Call(ctx, uint64(ptr), uint64(len(input)))
+	if err != nil {
+		return nil, fmt.Errorf("wasm module %s: transform failed: %w", t.name, err)
+	}
+	if res[0] == 0 {
+		return nil, nil
+	}
+
+	outPtr, outLen := uint32(res[0]>>32), uint32(res[0])
+	if outLen > t.limits.MaxOutput {
+		return nil, fmt.Errorf("wasm module %s: output of %d bytes exceeds the %d byte limit", t.name, outLen, t.limits.MaxOutput)
+	}
+	data, ok := mod.Memory().Read(outPtr, outLen)
+	if !ok {
+		return nil, fmt.Errorf("wasm module %s: output is out of range", t.name)
+	}
+
+	var out db.Document
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("wasm module %s: failed to decode output: %w", t.name, err)
+	}
+	return &out, nil
+}
+
+// Close releases the compiled module
+func (t *WASMTransform) Close(ctx context.Context) error {
+	return t.runtime.Close(ctx)
+}
+
+// LoadWASMTransforms compiles every *.wasm file in dir, in name order. The
+// module name is the file name without the extension.
+func LoadWASMTransforms(ctx context.Context, dir string, limits WASMLimits) ([]*WASMTransform, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.wasm"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list wasm modules: %w", err)
+	}
+	sort.Strings(paths)
+
+	transforms := make([]*WASMTransform, 0, len(paths))
+	for _, path := range paths {
+		wasm, err := os.ReadFile(path)
+		if err != nil {
+			closeWASMTransforms(ctx, transforms)
+			return nil, fmt.Errorf("failed to read wasm module: %w", err)
+		}
+		name := strings.TrimSuffix(filepath.Base(path), ".wasm")
+		t, err := NewWASMTransform(ctx, name, wasm, limits, nil)
+		if err != nil {
+			closeWASMTransforms(ctx, transforms)
+			return nil, err
+		}
+		transforms = append(transforms, t)
+	}
+	return transforms, nil
+}
+
+func closeWASMTransforms(ctx context.Context, transforms []*WASMTransform) {
+	for _, t := range transforms {
+		_ = t.Close(ctx)
+	}
+}
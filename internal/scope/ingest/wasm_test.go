@@ -0,0 +1,192 @@
+package ingest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+)
+
+// Bodies of the transform(ptr, len) -> i64 export used by the test modules
+var (
+	identityBody = []byte{0x00, 0x20, 0x00, 0xad, 0x42, 0x20, 0x86, 0x20, 0x01, 0xad, 0x84, 0x0b} // (ptr << 32) | len
+	skipBody     = []byte{0x00, 0x42, 0x00, 0x0b}                                                 // 0
+	trapBody     = []byte{0x00, 0x00, 0x0b}                                                       // unreachable
+	loopBody     = []byte{0x00, 0x03, 0x40, 0x0c, 0x00, 0x0b, 0x00, 0x0b}                         // loop forever
+	constantBody = []byte{0x00, 0x42, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x02, 0x0b}             // (2048 << 32), length patched in
+)
+
+// testWASMModule assembles a module with one page of memory, an alloc that
+// always returns offset 1024, the given transform body, and data at 2048
+func testWASMModule(transform []byte, data string) []byte {
+	uleb := func(n int) []byte {
+		var out []byte
+		for {
+			b := byte(n & 0x7f)
+			n >>= 7
+			if n != 0 {
+				out = append(out, b|0x80)
+				continue
+			}
+			return append(out, b)
+		}
+	}
+	vec := func(items ...[]byte) []byte {
+		out := uleb(len(items))
+		for _, it := range items {
+			out = append(out, it...)
+		}
+		return out
+	}
+	section := func(id byte, body []byte) []byte {
+		return append(append([]byte{id}, uleb(len(body))...), body...)
+	}
+	name := func(s string) []byte { return append(uleb(len(s)), s...) }
+	body := func(b []byte) []byte { return append(uleb(len(b)), b...) }
+
+	m := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	m = append(m, section(1, vec(
+		[]byte{0x60, 0x01, 0x7f, 0x01, 0x7f},       // (i32) -> i32
+		[]byte{0x60, 0x02, 0x7f, 0x7f, 0x01, 0x7e}, // (i32, i32) -> i64
+	))...)
+	m = append(m, section(3, vec([]byte{0x00}, []byte{0x01}))...)
+	m = append(m, section(5, vec([]byte{0x00, 0x01}))...)
+	m = append(m, section(7, vec(
+		append(name("memory"), 0x02, 0x00),
+		append(name("alloc"), 0x00, 0x00),
+		append(name("transform"), 0x00, 0x01),
+	))...)
+	m = append(m, section(10, vec(
+		body([]byte{0x00, 0x41, 0x80, 0x08, 0x0b}), // i32.const 1024
+		body(transform),
+	))...)
+	if data != "" {
+		segment := append([]byte{0x00, 0x41, 0x80, 0x10, 0x0b}, name(data)...) // at 2048
+		m = append(m, section(11, vec(segment))...)
+	}
+	return m
+}
+
+// constantTransform returns a module whose transform always outputs doc
+func constantTransform(doc string) []byte {
+	body := append([]byte(nil), constantBody...)
+	// Replace "i64.const 2048<<32" with "i64.const 2048<<32 | len", keeping
+	// the encoding the same width by OR-ing into the low 7-bit groups
+	n := len(doc)
+	body[2] = 0x80 | byte(n&0x7f)
+	body[3] = 0x80 | byte(n>>7&0x7f)
+	return testWASMModule(body, doc)
+}
+
+func newTestTransform(t *testing.T, wasm []byte, limits WASMLimits) (*WASMTransform, *obs.Registry) {
+	t.Helper()
+	reg := obs.NewRegistry()
+	tr, err := NewWASMTransform(context.Background(), "test", wasm, limits, reg)
+	if err != nil {
+		t.Fatalf("failed to load module: %v", err)
+	}
+	t.Cleanup(func() { _ = tr.Close(context.Background()) })
+	return tr, reg
+}
+
+func TestWASMTransform(t *testing.T) {
+	ctx := context.Background()
+	limits := DefaultWASMLimits()
+
+	tr, reg := newTestTransform(t, testWASMModule(identityBody, ""), limits)
+	doc := db.Document{ID: "d1", Source: "api", Title: "Same", Text: "unchanged", Metadata: map[string]string{"k": "v"}}
+	if err := tr.Pre(ctx, &doc); err != nil || doc.Title != "Same" || doc.Metadata["k"] != "v" {
+		t.Fatalf("identity transform changed the document: %+v (%v)", doc, err)
+	}
+	if n := tr.metrics.calls.WithLabel("test").Value(); n != 1 {
+		t.Errorf("expected 1 call counted, got %d", n)
+	}
+	var metrics strings.Builder
+	_ = reg.WriteText(&metrics)
+	if !strings.Contains(metrics.String(), `selfstack_wasm_transform_calls_total{module="test"} 1`) {
+		t.Errorf("expected per-module metrics, got:\n%s", metrics.String())
+	}
+
+	tr, _ = newTestTransform(t, constantTransform(`{"source":"wasm","title":"Rewritten","text":"new text"}`), limits)
+	doc = db.Document{ID: "d1", Title: "Old", Text: "old"}
+	if err := tr.Pre(ctx, &doc); err != nil || doc.Title != "Rewritten" || doc.Text != "new text" || doc.ID != "d1" {
+		t.Fatalf("expected the transformed document, got %+v (%v)", doc, err)
+	}
+
+	tr, _ = newTestTransform(t, testWASMModule(skipBody, ""), limits)
+	if err := tr.Pre(ctx, &db.Document{ID: "d1"}); !IsVeto(err) {
+		t.Errorf("expected a skip to veto the document, got %v", err)
+	}
+	if n := tr.metrics.skips.WithLabel("test").Value(); n != 1 {
+		t.Errorf("expected 1 skip counted, got %d", n)
+	}
+
+	tr, _ = newTestTransform(t, testWASMModule(trapBody, ""), limits)
+	if err := tr.Pre(ctx, &db.Document{ID: "d1"}); err == nil || IsVeto(err) {
+		t.Errorf("expected a trap to fail, got %v", err)
+	}
+	if n := tr.metrics.errors.WithLabel("test").Value(); n != 1 {
+		t.Errorf("expected 1 error counted, got %d", n)
+	}
+}
+
+func TestWASMTransformLimits(t *testing.T) {
+	ctx := context.Background()
+
+	limits := DefaultWASMLimits()
+	limits.Timeout = 50 * time.Millisecond
+	tr, _ := newTestTransform(t, testWASMModule(loopBody, ""), limits)
+	start := time.Now()
+	if err := tr.Pre(ctx, &db.Document{ID: "d1"}); err == nil {
+		t.Fatal("expected a runaway transform to time out")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("timeout took %v", elapsed)
+	}
+
+	limits = DefaultWASMLimits()
+	limits.MaxOutput = 8
+	tr, _ = newTestTransform(t, testWASMModule(identityBody, ""), limits)
+	if err := tr.Pre(ctx, &db.Document{ID: "d1", Text: "longer than eight bytes"}); err == nil {
+		t.Error("expected output over the limit to fail")
+	}
+
+	// The module asks for one page; a zero page limit can't satisfy it
+	limits = DefaultWASMLimits()
+	limits.MemoryPages = 0
+	if _, err := NewWASMTransform(ctx, "test", testWASMModule(identityBody, ""), limits, obs.NewRegistry()); err == nil {
+		t.Error("expected a module over the memory limit to be refused")
+	}
+}
+
+func TestLoadWASMTransforms(t *testing.T) {
+	dir := t.TempDir()
+	_ = os.WriteFile(filepath.Join(dir, "b-skip.wasm"), testWASMModule(skipBody, ""), 0644)
+	_ = os.WriteFile(filepath.Join(dir, "a-identity.wasm"), testWASMModule(identityBody, ""), 0644)
+	_ = os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("ignored"), 0644)
+
+	transforms, err := LoadWASMTransforms(context.Background(), dir, DefaultWASMLimits())
+	if err != nil {
+		t.Fatalf("failed to load: %v", err)
+	}
+	defer closeWASMTransforms(context.Background(), transforms)
+	if len(transforms) != 2 || transforms[0].Name() != "a-identity" || transforms[1].Name() != "b-skip" {
+		t.Fatalf("expected both modules in name order, got %d", len(transforms))
+	}
+
+	_ = os.WriteFile(filepath.Join(dir, "c-bad.wasm"), []byte("not wasm"), 0644)
+	if _, err := LoadWASMTransforms(context.Background(), dir, DefaultWASMLimits()); err == nil {
+		t.Error("expected an invalid module to fail loading")
+	}
+
+	// An empty module is valid WASM but doesn't implement the ABI
+	empty := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	if _, err := NewWASMTransform(context.Background(), "empty", empty, DefaultWASMLimits(), obs.NewRegistry()); err == nil || !strings.Contains(err.Error(), "must export") {
+		t.Errorf("expected a module without the ABI exports to be refused, got %v", err)
+	}
+}
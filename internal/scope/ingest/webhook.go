@@ -0,0 +1,108 @@
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/httpclient"
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+)
+
+// maxWebhookResponse caps the webhook response body read into memory
+const maxWebhookResponse = 16 << 20
+
+// Webhook calls an external HTTP endpoint from the ingest path, for
+// deployments that enrich or vet documents outside the binary. The document
+// is POSTed as JSON (without its embedding).
+//
+// As a pre-ingest hook the endpoint answers:
+//   - 200 with a document JSON body: the document's source, title, text, and
+//     metadata are replaced by the returned ones
+//   - 204: the document is stored unchanged
+//   - 403 or 422: the document is rejected; the body is the reason
+//
+// Any other status fails the ingest. As a post-ingest hook any 2xx is success.
+type Webhook struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhook returns a webhook calling url. timeout bounds each call,
+// including retries of 429 and 5xx responses.
+func NewWebhook(url string, timeout time.Duration) *Webhook {
+	return &Webhook{url: url, client: httpclient.New(httpclient.WithTimeout(timeout), httpclient.WithMaxElapsed(timeout))}
+}
+
+// Pre is the webhook as a PreIngestHook
+func (w *Webhook) Pre(ctx context.Context, doc *db.Document) error {
+	status, body, err := w.post(ctx, *doc)
+	if err != nil {
+		return err
+	}
+
+	switch status {
+	case http.StatusOK:
+		var enriched db.Document
+		if err := json.Unmarshal(body, &enriched); err != nil {
+			return fmt.Errorf("failed to decode webhook response: %w", err)
+		}
+		doc.Source = enriched.Source
+		doc.Title = enriched.Title
+		doc.Text = enriched.Text
+		doc.Metadata = enriched.Metadata
+		return nil
+	case http.StatusNoContent:
+		return nil
+	case http.StatusForbidden, http.StatusUnprocessableEntity:
+		reason := strings.TrimSpace(string(body))
+		if reason == "" {
+			reason = http.StatusText(status)
+		}
+		return Veto(reason)
+	default:
+		return fmt.Errorf("webhook returned status %d", status)
+	}
+}
+
+// Post is the webhook as a PostIngestHook
+func (w *Webhook) Post(ctx context.Context, doc db.Document) error {
+	status, _, err := w.post(ctx, doc)
+	if err != nil {
+		return err
+	}
+	if status < 200 || status > 299 {
+		return fmt.Errorf("webhook returned status %d", status)
+	}
+	return nil
+}
+
+func (w *Webhook) post(ctx context.Context, doc db.Document) (int, []byte, error) {
+	payload, err := json.Marshal(doc)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to encode document: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(payload))
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to call webhook: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxWebhookResponse))
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read webhook response: %w", err)
+	}
+	return resp.StatusCode, body, nil
+}
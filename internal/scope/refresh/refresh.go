@@ -0,0 +1,281 @@
+// Package refresh keeps connector-fed corpora fresh: per-source policies
+// re-fetch documents from their URLs and drop documents a source hasn't
+// sent in a while.
+package refresh
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/clock"
+	"github.com/dsjohal14/selfstack/internal/libs/httpclient"
+	"github.com/dsjohal14/selfstack/internal/relay"
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+	"github.com/rs/zerolog"
+)
+
+// Metadata keys maintained for documents of sources with a policy
+const (
+	MetaLastSeen  = "last_seen_at" // RFC3339; set on ingest and on each successful re-fetch
+	MetaFetchedAt = "fetched_at"   // RFC3339; set on each successful re-fetch
+)
+
+// DefaultURLField is the metadata key holding a document's URL
+const DefaultURLField = "url"
+
+// maxFetchSize caps a re-fetched body
+const maxFetchSize = 10 << 20
+
+// Policy is the refresh policy of one source
+type Policy struct {
+	Source        string `json:"source"`
+	RefetchDays   int    `json:"refetch_days,omitempty"`    // Re-fetch documents older than this (0 = never)
+	DropAfterDays int    `json:"drop_after_days,omitempty"` // Delete documents not seen for this long (0 = never)
+	URLField      string `json:"url_field,omitempty"`       // Metadata key with the URL (default: url)
+}
+
+// Validate fills in defaults and checks the policy
+func (p *Policy) Validate() error {
+	if p.Source == "" {
+		return fmt.Errorf("refresh policy needs a source")
+	}
+	if p.RefetchDays < 0 || p.DropAfterDays < 0 {
+		return fmt.Errorf("refresh policy for %s: days must not be negative", p.Source)
+	}
+	if p.URLField == "" {
+		p.URLField = DefaultURLField
+	}
+	return nil
+}
+
+// LoadPolicies reads a JSON array of policies
+func LoadPolicies(path string) ([]Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read refresh policies: %w", err)
+	}
+	var policies []Policy
+	if err := json.Unmarshal(data, &policies); err != nil {
+		return nil, fmt.Errorf("failed to decode refresh policies: %w", err)
+	}
+	seen := make(map[string]bool, len(policies))
+	for i := range policies {
+		if err := policies[i].Validate(); err != nil {
+			return nil, err
+		}
+		if seen[policies[i].Source] {
+			return nil, fmt.Errorf("duplicate refresh policy for %s", policies[i].Source)
+		}
+		seen[policies[i].Source] = true
+	}
+	return policies, nil
+}
+
+// Store is the storage a Refresher works on
+type Store interface {
+	Add(doc db.Document) error
+	Delete(docID string) error
+	Range(fn func(docID string, doc db.Document) bool)
+}
+
+// EmbedderFunc returns the embedder of a collection
+type EmbedderFunc func(ctx context.Context, collection string) (relay.Embedder, error)
+
+// Report summarizes one refresh run
+type Report struct {
+	Refetched int `json:"refetched"` // Fetched successfully
+	Changed   int `json:"changed"`   // Fetched with new text
+	Failed    int `json:"failed"`    // Fetch errors; retried next run
+	Dropped   int `json:"dropped"`
+}
+
+// Refresher applies refresh policies to a store
+type Refresher struct {
+	store    Store
+	policies map[string]Policy
+	embedder EmbedderFunc
+	client   *http.Client
+	logger   zerolog.Logger
+	now      func() time.Time
+}
+
+// Option configures a Refresher
+type Option func(*Refresher)
+
+// WithHTTPClient fetches documents with c instead of a client that refuses
+// private and reserved addresses. Document URLs come from ingested
+// metadata, so a client without a guard lets them reach internal services.
+func WithHTTPClient(c *http.Client) Option {
+	return func(r *Refresher) {
+		r.client = c
+	}
+}
+
+// WithClock reads the time from c instead of the system clock, for the
+// seen and fetched stamps and the policies' staleness checks
+func WithClock(c clock.Clock) Option {
+	return func(r *Refresher) {
+		r.now = clock.Or(c).Now
+	}
+}
+
+// NewRefresher creates a refresher for validated policies
+func NewRefresher(store Store, policies []Policy, embedder EmbedderFunc, logger zerolog.Logger, opts ...Option) *Refresher {
+	bySource := make(map[string]Policy, len(policies))
+	for _, p := range policies {
+		bySource[p.Source] = p
+	}
+	r := &Refresher{
+		store:    store,
+		policies: bySource,
+		embedder: embedder,
+		client:   httpclient.New(httpclient.WithGuard(httpclient.DefaultGuard())),
+		logger:   logger,
+		now:      time.Now,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// StampSeen is a pre-ingest hook marking documents of sources with a policy
+// as seen now
+func (r *Refresher) StampSeen(_ context.Context, doc *db.Document) error {
+	if _, ok := r.policies[doc.Source]; !ok {
+		return nil
+	}
+	metadata := make(map[string]string, len(doc.Metadata)+1)
+	for k, v := range doc.Metadata {
+		metadata[k] = v
+	}
+	metadata[MetaLastSeen] = r.now().UTC().Format(time.RFC3339)
+	doc.Metadata = metadata
+	return nil
+}
+
+// Run applies every policy once
+func (r *Refresher) Run(ctx context.Context) (Report, error) {
+	now := r.now()
+
+	// Collect the work first; the store can't be written while ranging
+	var refetch, drop []db.Document
+	r.store.Range(func(_ string, doc db.Document) bool {
+		policy, ok := r.policies[doc.Source]
+		if !ok {
+			return true
+		}
+		if policy.DropAfterDays > 0 && lastSeen(doc).Before(now.AddDate(0, 0, -policy.DropAfterDays)) {
+			drop = append(drop, doc)
+			return true
+		}
+		if policy.RefetchDays > 0 && doc.Metadata[policy.URLField] != "" && doc.Metadata["chunk_of"] == "" &&
+			lastFetched(doc).Before(now.AddDate(0, 0, -policy.RefetchDays)) {
+			refetch = append(refetch, doc)
+		}
+		return true
+	})
+
+	var report Report
+	for _, doc := range drop {
+		if err := r.store.Delete(doc.ID); err != nil {
+			return report, fmt.Errorf("failed to drop %s: %w", doc.ID, err)
+		}
+		report.Dropped++
+		r.logger.Info().Str("doc_id", doc.ID).Str("source", doc.Source).Msg("dropped stale document")
+	}
+
+	for _, doc := range refetch {
+		if ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+		changed, err := r.refetch(ctx, doc, r.policies[doc.Source], now)
+		if err != nil {
+			report.Failed++
+			r.logger.Warn().Err(err).Str("doc_id", doc.ID).Str("source", doc.Source).Msg("failed to re-fetch document")
+			continue
+		}
+		report.Refetched++
+		if changed {
+			report.Changed++
+		}
+	}
+
+	return report, nil
+}
+
+// refetch downloads a document's URL and stores it with the new text
+func (r *Refresher) refetch(ctx context.Context, doc db.Document, policy Policy, now time.Time) (bool, error) {
+	text, err := r.fetch(ctx, doc.Metadata[policy.URLField])
+	if err != nil {
+		return false, err
+	}
+
+	changed := text != doc.Text
+	if changed {
+		embedder, err := r.embedder(ctx, db.CollectionOf(doc))
+		if err != nil {
+			return false, err
+		}
+		doc.Text = text
+		doc.Embedding = embedder.Embed(text)
+	}
+
+	metadata := make(map[string]string, len(doc.Metadata)+2)
+	for k, v := range doc.Metadata {
+		metadata[k] = v
+	}
+	stamp := now.UTC().Format(time.RFC3339)
+	metadata[MetaLastSeen] = stamp
+	metadata[MetaFetchedAt] = stamp
+	doc.Metadata = metadata
+
+	if err := r.store.Add(doc); err != nil {
+		return false, fmt.Errorf("failed to store re-fetched document: %w", err)
+	}
+	return changed, nil
+}
+
+func (r *Refresher) fetch(ctx context.Context, url string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch %s: %w", url, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("fetch %s returned status %d", url, resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxFetchSize))
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", url, err)
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+// lastSeen is when the source last sent or re-fetched the document,
+// falling back to its creation time
+func lastSeen(doc db.Document) time.Time {
+	if t, err := time.Parse(time.RFC3339, doc.Metadata[MetaLastSeen]); err == nil {
+		return t
+	}
+	return doc.CreatedAt
+}
+
+// lastFetched is when the document was last re-fetched or, failing that, seen
+func lastFetched(doc db.Document) time.Time {
+	if t, err := time.Parse(time.RFC3339, doc.Metadata[MetaFetchedAt]); err == nil {
+		return t
+	}
+	return lastSeen(doc)
+}
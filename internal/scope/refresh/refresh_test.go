@@ -0,0 +1,157 @@
+package refresh
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/httpclient"
+	"github.com/dsjohal14/selfstack/internal/relay"
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+	"github.com/dsjohal14/selfstack/internal/scope/db/wal"
+	"github.com/rs/zerolog"
+)
+
+func newTestStore(t *testing.T) *db.WALStore {
+	t.Helper()
+	config := db.DefaultWALStoreConfig(t.TempDir())
+	config.SyncPolicy = wal.ImmediateSyncPolicy()
+	store, err := db.NewWALStore(context.Background(), config)
+	if err != nil {
+		t.Fatalf("failed to create WAL store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	return store
+}
+
+func deterministic(context.Context, string) (relay.Embedder, error) {
+	return relay.NewEmbedder(relay.ProviderDeterministic, 0)
+}
+
+func TestRefresherRun(t *testing.T) {
+	pages := map[string]string{"/same": "unchanged page", "/new": "updated page"}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	store := newTestStore(t)
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	old := now.AddDate(0, 0, -10).Format(time.RFC3339)
+	recent := now.AddDate(0, 0, -1).Format(time.RFC3339)
+
+	docs := []db.Document{
+		{ID: "same", Source: "web", Text: "unchanged page", Metadata: map[string]string{"url": srv.URL + "/same", MetaLastSeen: old}},
+		{ID: "new", Source: "web", Text: "old page", Metadata: map[string]string{"url": srv.URL + "/new", MetaLastSeen: old}},
+		{ID: "gone", Source: "web", Text: "404", Metadata: map[string]string{"url": srv.URL + "/gone", MetaLastSeen: old}},
+		{ID: "fresh", Source: "web", Text: "fresh", Metadata: map[string]string{"url": srv.URL + "/new", MetaFetchedAt: recent, MetaLastSeen: recent}},
+		{ID: "stale", Source: "feed", Text: "stale", CreatedAt: now.AddDate(0, 0, -40)},
+		{ID: "kept", Source: "manual", Text: "no policy", CreatedAt: now.AddDate(0, 0, -400)},
+	}
+	for _, doc := range docs {
+		if err := store.Add(doc); err != nil {
+			t.Fatalf("failed to add %s: %v", doc.ID, err)
+		}
+	}
+
+	policies := []Policy{
+		{Source: "web", RefetchDays: 7, URLField: "url"},
+		{Source: "feed", DropAfterDays: 30},
+	}
+	// The test server listens on loopback, which the default client refuses
+	r := NewRefresher(store, policies, deterministic, zerolog.Nop(), WithHTTPClient(httpclient.New()))
+	r.now = func() time.Time { return now }
+
+	report, err := r.Run(context.Background())
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	want := Report{Refetched: 2, Changed: 1, Failed: 1, Dropped: 1}
+	if report != want {
+		t.Errorf("expected %+v, got %+v", want, report)
+	}
+
+	doc, _ := store.Get("new")
+	if doc.Text != "updated page" || doc.Embedding != relay.DeterministicEmbed("updated page") {
+		t.Errorf("expected the re-fetched text and embedding, got %q", doc.Text)
+	}
+	if doc.Metadata[MetaFetchedAt] != now.Format(time.RFC3339) {
+		t.Errorf("expected fetched_at to be stamped, got %v", doc.Metadata)
+	}
+	if _, found := store.Get("stale"); found {
+		t.Error("stale feed document should be dropped")
+	}
+	if _, found := store.Get("kept"); !found {
+		t.Error("documents without a policy must be left alone")
+	}
+
+	// Everything is fresh now except the failing URL
+	report, _ = r.Run(context.Background())
+	if report.Refetched != 0 || report.Failed != 1 {
+		t.Errorf("expected only the failed fetch to be retried, got %+v", report)
+	}
+}
+
+func TestRefresherBlocksPrivateURLs(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		_, _ = w.Write([]byte("internal page"))
+	}))
+	defer srv.Close()
+
+	store := newTestStore(t)
+	old := time.Now().AddDate(0, 0, -10).Format(time.RFC3339)
+	doc := db.Document{ID: "internal", Source: "web", Text: "page", Metadata: map[string]string{"url": srv.URL, MetaLastSeen: old}}
+	if err := store.Add(doc); err != nil {
+		t.Fatalf("failed to add document: %v", err)
+	}
+
+	r := NewRefresher(store, []Policy{{Source: "web", RefetchDays: 7, URLField: "url"}}, deterministic, zerolog.Nop())
+	report, err := r.Run(context.Background())
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if report.Failed != 1 || calls != 0 {
+		t.Errorf("expected the loopback fetch to be refused, got %+v with %d requests", report, calls)
+	}
+}
+
+func TestStampSeen(t *testing.T) {
+	r := NewRefresher(newTestStore(t), []Policy{{Source: "web"}}, deterministic, zerolog.Nop())
+
+	doc := db.Document{ID: "a", Source: "web"}
+	_ = r.StampSeen(context.Background(), &doc)
+	if _, err := time.Parse(time.RFC3339, doc.Metadata[MetaLastSeen]); err != nil {
+		t.Errorf("expected last_seen_at to be stamped, got %v", doc.Metadata)
+	}
+
+	doc = db.Document{ID: "b", Source: "manual"}
+	_ = r.StampSeen(context.Background(), &doc)
+	if doc.Metadata != nil {
+		t.Errorf("sources without a policy should be untouched, got %v", doc.Metadata)
+	}
+}
+
+func TestLoadPolicies(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policies.json")
+	_ = os.WriteFile(path, []byte(`[{"source":"web","refetch_days":7}]`), 0644)
+	policies, err := LoadPolicies(path)
+	if err != nil || len(policies) != 1 || policies[0].URLField != DefaultURLField {
+		t.Fatalf("unexpected policies %+v (%v)", policies, err)
+	}
+
+	_ = os.WriteFile(path, []byte(`[{"source":"web"},{"source":"web"}]`), 0644)
+	if _, err := LoadPolicies(path); err == nil {
+		t.Error("expected duplicate sources to be rejected")
+	}
+}
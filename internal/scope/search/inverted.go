@@ -0,0 +1,152 @@
+package search
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// BM25 parameters
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// ScoredDoc is a keyword search hit
+type ScoredDoc struct {
+	DocID string
+	Score float64
+}
+
+// InvertedIndex is an in-memory BM25 keyword index.
+// It is not safe for concurrent use; callers hold their own lock.
+type InvertedIndex struct {
+	postings map[string]map[string]int // term -> docID -> term frequency
+	docTerms map[string][]string       // docID -> unique terms (for removal)
+	docLen   map[string]int            // docID -> token count
+	totalLen int
+}
+
+// NewInvertedIndex creates an empty keyword index
+func NewInvertedIndex() *InvertedIndex {
+	return &InvertedIndex{
+		postings: make(map[string]map[string]int),
+		docTerms: make(map[string][]string),
+		docLen:   make(map[string]int),
+	}
+}
+
+// Index adds or replaces a document's postings
+func (x *InvertedIndex) Index(docID string, content string) error {
+	x.Remove(docID)
+
+	tokens := Tokenize(content)
+	freqs := make(map[string]int, len(tokens))
+	for _, tok := range tokens {
+		freqs[tok]++
+	}
+
+	terms := make([]string, 0, len(freqs))
+	for term, tf := range freqs {
+		docs := x.postings[term]
+		if docs == nil {
+			docs = make(map[string]int)
+			x.postings[term] = docs
+		}
+		docs[docID] = tf
+		terms = append(terms, term)
+	}
+
+	x.docTerms[docID] = terms
+	x.docLen[docID] = len(tokens)
+	x.totalLen += len(tokens)
+	return nil
+}
+
+// Remove drops a document's postings
+func (x *InvertedIndex) Remove(docID string) {
+	terms, ok := x.docTerms[docID]
+	if !ok {
+		return
+	}
+	for _, term := range terms {
+		docs := x.postings[term]
+		delete(docs, docID)
+		if len(docs) == 0 {
+			delete(x.postings, term)
+		}
+	}
+	x.totalLen -= x.docLen[docID]
+	delete(x.docTerms, docID)
+	delete(x.docLen, docID)
+}
+
+// Len returns the number of indexed documents
+func (x *InvertedIndex) Len() int {
+	return len(x.docLen)
+}
+
+// Search returns IDs of the best matching documents
+func (x *InvertedIndex) Search(query string, limit int) ([]string, error) {
+	hits := x.SearchScored(query, limit)
+	ids := make([]string, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.DocID
+	}
+	return ids, nil
+}
+
+// SearchScored ranks documents against the query with BM25
+func (x *InvertedIndex) SearchScored(query string, limit int) []ScoredDoc {
+	n := len(x.docLen)
+	if n == 0 {
+		return nil
+	}
+	avgLen := float64(x.totalLen) / float64(n)
+
+	scores := make(map[string]float64)
+	seen := make(map[string]bool)
+	for _, term := range Tokenize(query) {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+
+		docs := x.postings[term]
+		if len(docs) == 0 {
+			continue
+		}
+		idf := math.Log(1 + (float64(n)-float64(len(docs))+0.5)/(float64(len(docs))+0.5))
+		for docID, tf := range docs {
+			norm := bm25K1 * (1 - bm25B + bm25B*float64(x.docLen[docID])/avgLen)
+			scores[docID] += idf * float64(tf) * (bm25K1 + 1) / (float64(tf) + norm)
+		}
+	}
+
+	results := make([]ScoredDoc, 0, len(scores))
+	for docID, score := range scores {
+		results = append(results, ScoredDoc{DocID: docID, Score: score})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].DocID < results[j].DocID
+	})
+
+	if limit > 0 && limit < len(results) {
+		results = results[:limit]
+	}
+	return results
+}
+
+// Tokenize lowercases text and splits it on anything that isn't a letter or digit
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Ensure InvertedIndex implements Engine
+var _ Engine = (*InvertedIndex)(nil)
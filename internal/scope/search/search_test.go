@@ -57,3 +57,41 @@ func TestSearch(t *testing.T) {
 		})
 	}
 }
+
+func TestInvertedIndexRanking(t *testing.T) {
+	idx := NewInvertedIndex()
+	_ = idx.Index("doc1", "The WAL writer rotates segments")
+	_ = idx.Index("doc2", "Compaction merges sealed segments, segments, segments")
+	_ = idx.Index("doc3", "Unrelated text about embeddings")
+
+	hits := idx.SearchScored("segments", 10)
+	if len(hits) != 2 {
+		t.Fatalf("expected 2 hits, got %d", len(hits))
+	}
+	if hits[0].DocID != "doc2" {
+		t.Errorf("expected doc2 to rank first, got %s", hits[0].DocID)
+	}
+
+	// Re-indexing replaces postings; removal drops them
+	_ = idx.Index("doc2", "nothing relevant")
+	idx.Remove("doc1")
+	if ids, _ := idx.Search("segments", 10); len(ids) != 0 {
+		t.Errorf("expected no hits after update and removal, got %v", ids)
+	}
+	if idx.Len() != 2 {
+		t.Errorf("expected 2 indexed docs, got %d", idx.Len())
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	got := Tokenize("Hello, WAL-backed world! v2")
+	want := []string{"hello", "wal", "backed", "world", "v2"}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("token %d: expected %q, got %q", i, want[i], got[i])
+		}
+	}
+}
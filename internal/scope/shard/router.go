@@ -0,0 +1,179 @@
+package shard
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/httpclient"
+)
+
+// HopHeader marks a request one node sent to another on a client's behalf.
+// Its value is the sending shard's ID; nodes never route such requests again.
+const HopHeader = "X-Selfstack-Shard-Hop"
+
+// SecretHeader carries the deployment's shard secret on forwarded requests.
+// It's what proves a request came from a peer; HopHeader alone is only a
+// claim any client can make.
+const SecretHeader = "X-Selfstack-Shard-Secret"
+
+// InstanceHeader carries the instance ID of the node sending a request or
+// reply, so peers can tell a replaced node (new data directory) from a
+// restarted one
+const InstanceHeader = "X-Selfstack-Instance"
+
+// maxResponseSize caps a peer response read into memory
+const maxResponseSize = 64 << 20
+
+// Router routes requests for one node of a sharded deployment
+type Router struct {
+	self     string
+	secret   string // Sent in SecretHeader, and expected in it from peers
+	instance string // Sent in InstanceHeader; empty sends none
+	src      Source
+	client   *http.Client
+	table    atomic.Pointer[Table]
+}
+
+// RouterOption configures a Router
+type RouterOption func(*Router)
+
+// WithInstanceID sends id in InstanceHeader on every forwarded request
+func WithInstanceID(id string) RouterOption {
+	return func(r *Router) {
+		r.instance = id
+	}
+}
+
+// NewRouter loads the routing table from src and checks that self is in it.
+// Every node of the deployment shares secret, which authenticates the
+// requests they forward to each other. Requests to peers, including
+// retries, time out after timeout.
+func NewRouter(ctx context.Context, self, secret string, src Source, timeout time.Duration, opts ...RouterOption) (*Router, error) {
+	if secret == "" {
+		return nil, fmt.Errorf("shard %s has no shard secret: peers couldn't tell its requests from a client's", self)
+	}
+	client := httpclient.New(httpclient.WithTimeout(timeout), httpclient.WithMaxElapsed(timeout))
+	r := &Router{self: self, secret: secret, src: src, client: client}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if err := r.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Refresh reloads the routing table; the old one stays in use on error
+func (r *Router) Refresh(ctx context.Context) error {
+	t, err := r.src.Load(ctx)
+	if err != nil {
+		return err
+	}
+	if _, ok := t.Get(r.self); !ok {
+		return fmt.Errorf("shard %s is not in the routing table", r.self)
+	}
+	r.table.Store(t)
+	return nil
+}
+
+// Self returns this node's shard ID
+func (r *Router) Self() string {
+	return r.self
+}
+
+// Table returns the current routing table
+func (r *Router) Table() *Table {
+	return r.table.Load()
+}
+
+// Owner returns the shard owning docID and whether it's this node
+func (r *Router) Owner(docID string) (Shard, bool) {
+	s := r.table.Load().Owner(docID)
+	return s, s.ID == r.self
+}
+
+// Peers returns every shard except this node
+func (r *Router) Peers() []Shard {
+	t := r.table.Load()
+	peers := make([]Shard, 0, len(t.Shards)-1)
+	for _, s := range t.Shards {
+		if s.ID != r.self {
+			peers = append(peers, s)
+		}
+	}
+	return peers
+}
+
+// IsHop reports whether req was forwarded by a peer: it's marked with
+// HopHeader and carries the shard secret. A nil Router trusts no request.
+func (r *Router) IsHop(req *http.Request) bool {
+	if r == nil || req.Header.Get(HopHeader) == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(req.Header.Get(SecretHeader)), []byte(r.secret)) == 1
+}
+
+// PeerResponse is a peer's reply to a forwarded request
+type PeerResponse struct {
+	Shard    Shard
+	Instance string // The peer's InstanceHeader; empty for peers that don't send one
+	Status   int
+	Body     []byte
+	Err      error // Set when the peer couldn't be reached or read
+}
+
+// Forward POSTs body to path on s, marked as a hop from this node
+func (r *Router) Forward(ctx context.Context, s Shard, path string, body []byte) PeerResponse {
+	resp := PeerResponse{Shard: s}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(s.URL, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		resp.Err = fmt.Errorf("failed to build request for shard %s: %w", s.ID, err)
+		return resp
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HopHeader, r.self)
+	req.Header.Set(SecretHeader, r.secret)
+	if r.instance != "" {
+		req.Header.Set(InstanceHeader, r.instance)
+	}
+
+	res, err := r.client.Do(req)
+	if err != nil {
+		resp.Err = fmt.Errorf("failed to reach shard %s: %w", s.ID, err)
+		return resp
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	resp.Status = res.StatusCode
+	resp.Instance = res.Header.Get(InstanceHeader)
+	resp.Body, err = io.ReadAll(io.LimitReader(res.Body, maxResponseSize))
+	if err != nil {
+		resp.Err = fmt.Errorf("failed to read response from shard %s: %w", s.ID, err)
+	}
+	return resp
+}
+
+// Gather forwards body to path on every peer concurrently and returns their
+// responses in routing table order
+func (r *Router) Gather(ctx context.Context, path string, body []byte) []PeerResponse {
+	peers := r.Peers()
+	out := make([]PeerResponse, len(peers))
+	var wg sync.WaitGroup
+	for i, s := range peers {
+		wg.Add(1)
+		go func(i int, s Shard) {
+			defer wg.Done()
+			out[i] = r.Forward(ctx, s, path, body)
+		}(i, s)
+	}
+	wg.Wait()
+	return out
+}
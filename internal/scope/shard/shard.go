@@ -0,0 +1,184 @@
+// Package shard partitions documents across Selfstack nodes by doc ID hash.
+// Each node owns a contiguous range of the 32-bit hash space; the routing
+// table mapping ranges to nodes lives in Postgres (or a JSON file) so every
+// node routes the same way.
+package shard
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Shard is one node and the hash range it owns
+type Shard struct {
+	ID    string `json:"id"`
+	URL   string `json:"url"`   // Base URL of the node's API, e.g. http://node-a:8080
+	Start uint32 `json:"start"` // First hash owned (inclusive)
+	End   uint32 `json:"end"`   // Last hash owned (inclusive)
+}
+
+// Owns reports whether the shard owns hash h
+func (s Shard) Owns(h uint32) bool {
+	return h >= s.Start && h <= s.End
+}
+
+// Hash maps a doc ID onto the hash space (FNV-1a)
+func Hash(docID string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(docID))
+	return h.Sum32()
+}
+
+// Table is a routing table whose shards cover the whole hash space
+type Table struct {
+	Shards []Shard // Sorted by Start
+}
+
+// NewTable sorts and validates shards: ranges must not overlap and must
+// cover every hash, and shard IDs must be unique
+func NewTable(shards []Shard) (*Table, error) {
+	if len(shards) == 0 {
+		return nil, fmt.Errorf("routing table has no shards")
+	}
+	sorted := append([]Shard(nil), shards...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start < sorted[j].Start })
+
+	ids := make(map[string]bool, len(sorted))
+	var next uint64 // First hash not yet covered
+	for _, s := range sorted {
+		if s.ID == "" || s.URL == "" {
+			return nil, fmt.Errorf("shard %q needs an id and a url", s.ID)
+		}
+		if ids[s.ID] {
+			return nil, fmt.Errorf("duplicate shard %s", s.ID)
+		}
+		ids[s.ID] = true
+		if s.End < s.Start {
+			return nil, fmt.Errorf("shard %s: range end %d is before start %d", s.ID, s.End, s.Start)
+		}
+		if uint64(s.Start) != next {
+			return nil, fmt.Errorf("shard %s: range starts at %d, expected %d (gap or overlap)", s.ID, s.Start, next)
+		}
+		next = uint64(s.End) + 1
+	}
+	if next != math.MaxUint32+1 {
+		return nil, fmt.Errorf("routing table leaves hashes from %d up uncovered", next)
+	}
+	return &Table{Shards: sorted}, nil
+}
+
+// EvenTable splits the hash space evenly between the given shards, in order.
+// Only IDs and URLs are read from shards.
+func EvenTable(shards []Shard) (*Table, error) {
+	if len(shards) == 0 {
+		return nil, fmt.Errorf("routing table has no shards")
+	}
+	width := (uint64(math.MaxUint32) + 1) / uint64(len(shards))
+	out := make([]Shard, len(shards))
+	for i, s := range shards {
+		s.Start = uint32(uint64(i) * width)
+		s.End = uint32(uint64(i+1)*width - 1)
+		if i == len(shards)-1 {
+			s.End = math.MaxUint32
+		}
+		out[i] = s
+	}
+	return NewTable(out)
+}
+
+// Owner returns the shard owning docID
+func (t *Table) Owner(docID string) Shard {
+	h := Hash(docID)
+	i := sort.Search(len(t.Shards), func(i int) bool { return t.Shards[i].End >= h })
+	return t.Shards[i]
+}
+
+// Get returns the shard with the given ID
+func (t *Table) Get(id string) (Shard, bool) {
+	for _, s := range t.Shards {
+		if s.ID == id {
+			return s, true
+		}
+	}
+	return Shard{}, false
+}
+
+// Source loads the current routing table
+type Source interface {
+	Load(ctx context.Context) (*Table, error)
+}
+
+// FileSource reads the routing table from a JSON array of shards
+type FileSource string
+
+// Load reads and validates the file
+func (f FileSource) Load(_ context.Context) (*Table, error) {
+	data, err := os.ReadFile(string(f))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read shard routes: %w", err)
+	}
+	var shards []Shard
+	if err := json.Unmarshal(data, &shards); err != nil {
+		return nil, fmt.Errorf("failed to parse shard routes %s: %w", f, err)
+	}
+	return NewTable(shards)
+}
+
+// PostgresSource reads the routing table from the shard_routes table
+type PostgresSource struct {
+	db *pgxpool.Pool
+}
+
+// NewPostgresSource connects to the database holding the routing table
+func NewPostgresSource(ctx context.Context, url string) (*PostgresSource, error) {
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+	return &PostgresSource{db: pool}, nil
+}
+
+// Close closes the database connection
+func (p *PostgresSource) Close() {
+	p.db.Close()
+}
+
+// Load reads and validates the routes
+func (p *PostgresSource) Load(ctx context.Context) (*Table, error) {
+	rows, err := p.db.Query(ctx, `SELECT shard_id, url, hash_start, hash_end FROM shard_routes`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load shard routes: %w", err)
+	}
+	defer rows.Close()
+
+	var shards []Shard
+	for rows.Next() {
+		var (
+			s          Shard
+			start, end int64
+		)
+		if err := rows.Scan(&s.ID, &s.URL, &start, &end); err != nil {
+			return nil, fmt.Errorf("failed to scan shard route: %w", err)
+		}
+		if start < 0 || end > math.MaxUint32 {
+			return nil, fmt.Errorf("shard %s: range %d-%d is outside the hash space", s.ID, start, end)
+		}
+		s.Start, s.End = uint32(start), uint32(end)
+		shards = append(shards, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load shard routes: %w", err)
+	}
+	return NewTable(shards)
+}
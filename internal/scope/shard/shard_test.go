@@ -0,0 +1,182 @@
+package shard
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type staticSource struct{ t *Table }
+
+func (s staticSource) Load(context.Context) (*Table, error) { return s.t, nil }
+
+func TestNewTableValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		shards []Shard
+		ok     bool
+	}{
+		{"single", []Shard{{ID: "a", URL: "http://a", Start: 0, End: math.MaxUint32}}, true},
+		{"unsorted", []Shard{{ID: "b", URL: "http://b", Start: 100, End: math.MaxUint32}, {ID: "a", URL: "http://a", Start: 0, End: 99}}, true},
+		{"gap", []Shard{{ID: "a", URL: "http://a", Start: 0, End: 98}, {ID: "b", URL: "http://b", Start: 100, End: math.MaxUint32}}, false},
+		{"overlap", []Shard{{ID: "a", URL: "http://a", Start: 0, End: 100}, {ID: "b", URL: "http://b", Start: 100, End: math.MaxUint32}}, false},
+		{"short", []Shard{{ID: "a", URL: "http://a", Start: 0, End: 100}}, false},
+		{"duplicate", []Shard{{ID: "a", URL: "http://a", Start: 0, End: 99}, {ID: "a", URL: "http://b", Start: 100, End: math.MaxUint32}}, false},
+		{"no url", []Shard{{ID: "a", Start: 0, End: math.MaxUint32}}, false},
+		{"empty", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewTable(tt.shards)
+			if (err == nil) != tt.ok {
+				t.Errorf("NewTable() error = %v, want ok=%v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestEvenTableOwner(t *testing.T) {
+	table, err := EvenTable([]Shard{{ID: "a", URL: "http://a"}, {ID: "b", URL: "http://b"}, {ID: "c", URL: "http://c"}})
+	if err != nil {
+		t.Fatalf("EvenTable() failed: %v", err)
+	}
+
+	counts := make(map[string]int)
+	for i := 0; i < 3000; i++ {
+		id := fmt.Sprintf("doc-%d", i)
+		owner := table.Owner(id)
+		if !owner.Owns(Hash(id)) {
+			t.Fatalf("owner %s doesn't own the hash of %s", owner.ID, id)
+		}
+		if again := table.Owner(id); again.ID != owner.ID {
+			t.Fatalf("routing of %s isn't stable", id)
+		}
+		counts[owner.ID]++
+	}
+	for _, id := range []string{"a", "b", "c"} {
+		if counts[id] < 800 {
+			t.Errorf("shard %s owns only %d of 3000 docs", id, counts[id])
+		}
+	}
+}
+
+func TestFileSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "routes.json")
+	routes := `[{"id":"a","url":"http://a","start":0,"end":2147483647},{"id":"b","url":"http://b","start":2147483648,"end":4294967295}]`
+	if err := os.WriteFile(path, []byte(routes), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	table, err := FileSource(path).Load(context.Background())
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if len(table.Shards) != 2 {
+		t.Errorf("expected 2 shards, got %d", len(table.Shards))
+	}
+}
+
+func TestRouterGather(t *testing.T) {
+	var hops, instances []string
+	var peer *Router
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if peer.IsHop(r) {
+			hops = append(hops, r.Header.Get(HopHeader))
+		}
+		instances = append(instances, r.Header.Get(InstanceHeader))
+		w.Header().Set(InstanceHeader, "peer-instance")
+		_, _ = w.Write([]byte(`{"results":[]}`))
+	}))
+	defer ok.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	table, err := EvenTable([]Shard{{ID: "self", URL: "http://self"}, {ID: "ok", URL: ok.URL}, {ID: "down", URL: down.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	router, err := NewRouter(context.Background(), "self", "s3cret", staticSource{table}, time.Second, WithInstanceID("self-instance"))
+	if err != nil {
+		t.Fatalf("NewRouter() failed: %v", err)
+	}
+	if peer, err = NewRouter(context.Background(), "ok", "s3cret", staticSource{table}, time.Second); err != nil {
+		t.Fatalf("NewRouter() failed: %v", err)
+	}
+
+	resps := router.Gather(context.Background(), "/search", []byte(`{}`))
+	if len(resps) != 2 {
+		t.Fatalf("expected 2 peer responses, got %d", len(resps))
+	}
+	for _, resp := range resps {
+		switch resp.Shard.ID {
+		case "ok":
+			if resp.Err != nil || resp.Status != http.StatusOK {
+				t.Errorf("expected a reply from ok, got %d %v", resp.Status, resp.Err)
+			}
+			if resp.Instance != "peer-instance" {
+				t.Errorf("expected the peer's instance ID, got %q", resp.Instance)
+			}
+		case "down":
+			if resp.Err == nil {
+				t.Error("expected an error from the stopped shard")
+			}
+		default:
+			t.Errorf("unexpected shard %s", resp.Shard.ID)
+		}
+	}
+	if len(hops) != 1 || hops[0] != "self" {
+		t.Errorf("expected one authenticated hop from self, got %q", hops)
+	}
+	if len(instances) != 1 || instances[0] != "self-instance" {
+		t.Errorf("expected the sender's instance ID, got %q", instances)
+	}
+
+	if _, err := NewRouter(context.Background(), "missing", "s3cret", staticSource{table}, time.Second); err == nil {
+		t.Error("expected an error for a shard that isn't in the table")
+	}
+	if _, err := NewRouter(context.Background(), "self", "", staticSource{table}, time.Second); err == nil {
+		t.Error("expected an error without a shard secret")
+	}
+}
+
+func TestRouterIsHop(t *testing.T) {
+	table, _ := EvenTable([]Shard{{ID: "a", URL: "http://a"}, {ID: "b", URL: "http://b"}})
+	router, err := NewRouter(context.Background(), "a", "s3cret", staticSource{table}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The hop header is only a claim; the secret proves it
+	for _, tc := range []struct {
+		hop, secret string
+		want        bool
+	}{
+		{"b", "s3cret", true},
+		{"b", "", false},
+		{"b", "guess", false},
+		{"", "s3cret", false},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/search", nil)
+		if tc.hop != "" {
+			req.Header.Set(HopHeader, tc.hop)
+		}
+		if tc.secret != "" {
+			req.Header.Set(SecretHeader, tc.secret)
+		}
+		if got := router.IsHop(req); got != tc.want {
+			t.Errorf("hop %q with secret %q: IsHop() = %v", tc.hop, tc.secret, got)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/search", nil)
+	req.Header.Set(HopHeader, "b")
+	if (*Router)(nil).IsHop(req) {
+		t.Error("expected an unsharded node to trust no hop")
+	}
+}
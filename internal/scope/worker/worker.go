@@ -0,0 +1,141 @@
+// Package worker runs the background work that doesn't serve requests: the
+// refresh policies that re-fetch and expire connector-fed documents.
+// cmd/worker runs it in a process of its own; the API runs it in-process in
+// all-in-one mode, sharing its storage and scheduler.
+package worker
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/clock"
+	"github.com/dsjohal14/selfstack/internal/libs/events"
+	"github.com/dsjohal14/selfstack/internal/libs/httpclient"
+	"github.com/dsjohal14/selfstack/internal/libs/jobs"
+	"github.com/dsjohal14/selfstack/internal/relay"
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+	"github.com/dsjohal14/selfstack/internal/scope/refresh"
+	"github.com/rs/zerolog"
+)
+
+// Config selects the worker's tasks
+type Config struct {
+	// RefreshPolicies is a JSON file of per-source refresh policies; empty
+	// disables refreshes
+	RefreshPolicies string
+	RefreshInterval time.Duration
+
+	// Ranges refetches may reach despite the default deny list, and ranges
+	// they never reach
+	OutboundAllow []string
+	OutboundDeny  []string
+
+	// Clock is read by the refresher for seen and fetched stamps (nil for
+	// the system clock)
+	Clock clock.Clock
+
+	// Events receives the report of each refresh run on
+	// events.TopicRefreshRun (nil publishes none)
+	Events *events.Bus
+}
+
+// Worker holds the background tasks of one store
+type Worker struct {
+	refresher *refresh.Refresher
+	interval  time.Duration
+	events    *events.Bus
+	logger    zerolog.Logger
+}
+
+// New loads the worker's tasks for store. Refresh policies need a store
+// that supports deletes and iteration, like the WAL.
+func New(store db.Storage, collections db.CollectionRegistry, cfg Config, logger zerolog.Logger) (*Worker, error) {
+	w := &Worker{interval: cfg.RefreshInterval, events: cfg.Events, logger: logger}
+	if cfg.RefreshPolicies == "" {
+		return w, nil
+	}
+
+	refresher, err := newRefresher(store, collections, cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+	w.refresher = refresher
+	return w, nil
+}
+
+// Refresher returns the refresher, or nil without refresh policies. Its
+// StampSeen hook belongs in whichever process ingests, which is the API
+// whether or not the worker runs there.
+func (w *Worker) Refresher() *refresh.Refresher {
+	return w.refresher
+}
+
+// RefreshRun is the payload of events.TopicRefreshRun
+type RefreshRun struct {
+	refresh.Report
+	Error string `json:"error,omitempty"` // Why the run stopped early
+}
+
+// Schedule adds the worker's tasks to s
+func (w *Worker) Schedule(s *jobs.Scheduler) {
+	if w.refresher == nil {
+		return
+	}
+	s.Every("refresh", w.interval, func(ctx context.Context) error {
+		report, err := w.refresher.Run(ctx)
+		w.logger.Info().Interface("report", report).Msg("refresh run complete")
+		run := RefreshRun{Report: report}
+		if err != nil {
+			run.Error = err.Error()
+		}
+		w.events.Publish(events.TopicRefreshRun, run)
+		return err
+	})
+}
+
+// CheckStandalone returns an error if a worker in a process of its own
+// can't reach the API's documents. The API locks the WAL directory, so a
+// separate worker on the WAL backend could only refresh a DATA_DIR the API
+// never reads, whatever ALL_IN_ONE is set to.
+func CheckStandalone(backend db.Backend) error {
+	if backend == "" || backend == db.BackendWAL {
+		return fmt.Errorf("the worker can't run apart from the API on the WAL backend, whose directory the API locks; run it in the API with ALL_IN_ONE=true")
+	}
+	return nil
+}
+
+// newRefresher loads the refresh policies in cfg for a store that supports
+// deletes and iteration. Fetches are limited to the addresses the outbound
+// ranges allow.
+func newRefresher(store db.Storage, collections db.CollectionRegistry, cfg Config, logger zerolog.Logger) (*refresh.Refresher, error) {
+	rs, ok := store.(refresh.Store)
+	if !ok {
+		return nil, fmt.Errorf("refresh policies need the WAL storage backend")
+	}
+	policies, err := refresh.LoadPolicies(cfg.RefreshPolicies)
+	if err != nil {
+		return nil, err
+	}
+
+	embedder := func(ctx context.Context, name string) (relay.Embedder, error) {
+		c, found, err := collections.Get(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, fmt.Errorf("collection not found: %s", name)
+		}
+		embedder, _, err := c.Models()
+		return embedder, err
+	}
+
+	guard, err := httpclient.NewGuard(cfg.OutboundAllow, cfg.OutboundDeny)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OUTBOUND_ALLOW or OUTBOUND_DENY: %w", err)
+	}
+	client := httpclient.New(httpclient.WithGuard(guard))
+
+	logger.Info().Int("policies", len(policies)).Str("file", cfg.RefreshPolicies).Msg("loaded refresh policies")
+	return refresh.NewRefresher(rs, policies, embedder, logger, refresh.WithHTTPClient(client), refresh.WithClock(cfg.Clock)), nil
+}
@@ -0,0 +1,106 @@
+package worker
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/jobs"
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+	"github.com/dsjohal14/selfstack/internal/scope/db/wal"
+	"github.com/rs/zerolog"
+)
+
+func writePolicies(t *testing.T, policies string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "policies.json")
+	if err := os.WriteFile(path, []byte(policies), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestWorkerWithoutPolicies(t *testing.T) {
+	store, err := db.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := New(store, nil, Config{}, zerolog.Nop())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if w.Refresher() != nil {
+		t.Error("expected no refresher without policies")
+	}
+}
+
+func TestWorkerNeedsWALForPolicies(t *testing.T) {
+	store, err := db.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := Config{RefreshPolicies: writePolicies(t, `[{"source":"feed","drop_after_days":30}]`), RefreshInterval: time.Hour}
+	if _, err := New(store, nil, cfg, zerolog.Nop()); err == nil {
+		t.Fatal("expected refresh policies on the file backend to fail")
+	}
+}
+
+func TestCheckStandalone(t *testing.T) {
+	tests := []struct {
+		backend db.Backend
+		ok      bool
+	}{
+		{"", false},
+		{db.BackendWAL, false},
+		{db.BackendFile, true},
+		{db.BackendPGVector, true},
+	}
+	for _, tt := range tests {
+		if err := CheckStandalone(tt.backend); (err == nil) != tt.ok {
+			t.Errorf("CheckStandalone(%q) = %v, want ok %v", tt.backend, err, tt.ok)
+		}
+	}
+}
+
+func TestWorkerSchedulesRefresh(t *testing.T) {
+	config := db.DefaultWALStoreConfig(t.TempDir())
+	config.SyncPolicy = wal.ImmediateSyncPolicy()
+	store, err := db.NewWALStore(context.Background(), config)
+	if err != nil {
+		t.Fatalf("failed to create WAL store: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	stale := db.Document{ID: "stale", Source: "feed", Text: "stale", CreatedAt: time.Now().AddDate(0, 0, -40)}
+	if err := store.Add(stale); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Config{RefreshPolicies: writePolicies(t, `[{"source":"feed","drop_after_days":30}]`), RefreshInterval: time.Hour}
+	w, err := New(store, nil, cfg, zerolog.Nop())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if w.Refresher() == nil {
+		t.Fatal("expected a refresher")
+	}
+
+	// Tasks run once as soon as the scheduler starts
+	scheduler := jobs.NewScheduler(zerolog.Nop())
+	w.Schedule(scheduler)
+	scheduler.Start(context.Background())
+	defer scheduler.Stop()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, found := store.Get("stale"); !found {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("stale document was not dropped by the scheduled refresh")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
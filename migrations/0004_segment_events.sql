@@ -0,0 +1,18 @@
+-- Audit trail of segment lifecycle transitions
+-- Every status change (active -> sealed -> compacting -> archived) is recorded
+-- with the component that made it, so operators can answer
+-- "how did this segment end up archived?"
+
+CREATE TABLE IF NOT EXISTS wal_segment_events (
+    id              BIGSERIAL PRIMARY KEY,
+    segment_id      BIGINT NOT NULL,
+    segment_type    TEXT NOT NULL DEFAULT 'wal',
+    from_status     TEXT,            -- NULL when the segment was created
+    to_status       TEXT NOT NULL,
+    actor           TEXT NOT NULL,   -- writer, compactor, admin, recovery, system
+    reason          TEXT,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_segment_events_segment ON wal_segment_events(segment_type, segment_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_segment_events_created ON wal_segment_events(created_at);
@@ -0,0 +1,10 @@
+-- Named collections with per-collection model settings
+-- config holds the JSON-encoded settings (embedder, dimensions, reranker)
+-- so new settings don't need a schema change
+
+CREATE TABLE IF NOT EXISTS collections (
+    name        TEXT PRIMARY KEY,
+    config      JSONB NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,11 @@
+-- Routing table for sharded deployments: each node owns the doc IDs whose
+-- FNV-1a hash falls in [hash_start, hash_end]. Ranges must cover the whole
+-- 32-bit hash space without overlapping.
+
+CREATE TABLE IF NOT EXISTS shard_routes (
+    shard_id    TEXT PRIMARY KEY,
+    url         TEXT NOT NULL,
+    hash_start  BIGINT NOT NULL CHECK (hash_start >= 0 AND hash_start <= 4294967295),
+    hash_end    BIGINT NOT NULL CHECK (hash_end >= hash_start AND hash_end <= 4294967295),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
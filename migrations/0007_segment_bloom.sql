@@ -0,0 +1,6 @@
+-- Bloom filter of the doc IDs in each sealed or compacted segment, so
+-- lookups by doc ID can skip segments that can't contain it. A copy is kept
+-- next to each segment file (*.seg.bloom); NULL for active segments and
+-- segments sealed before filters existed.
+
+ALTER TABLE wal_segments ADD COLUMN IF NOT EXISTS bloom BYTEA;
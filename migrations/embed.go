@@ -0,0 +1,10 @@
+// Package migrations embeds the SQL schema migrations so the binary can
+// apply them on startup (see db.Open).
+package migrations
+
+import "embed"
+
+// FS holds the numbered *.sql migration files
+//
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,267 @@
+// Package cluster is a client for deployments that run several Selfstack
+// instances. It sends each search to every instance concurrently and merges
+// the results by score, tolerating instances that are slow or down.
+//
+//	c, err := cluster.New([]string{"http://node-a:8080", "http://node-b:8080"},
+//		cluster.WithNodeTimeout(2*time.Second), cluster.WithDedupe())
+//	res, err := c.Search(ctx, cluster.SearchRequest{Query: "quarterly planning"})
+//	// res.Hits is the merged top 10; res.Failed lists instances that didn't answer
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dsjohal14/selfstack/internal/libs/httpclient"
+)
+
+// DefaultLimit is the number of hits returned when a request has no limit,
+// matching the server's default
+const DefaultLimit = 10
+
+// maxResponseSize caps a search response read into memory
+const maxResponseSize = 64 << 20
+
+// ErrAllNodesFailed is returned (wrapped with each node's error) when no
+// instance answered
+var ErrAllNodesFailed = errors.New("all nodes failed")
+
+// Client fans searches out to a fixed set of instances
+type Client struct {
+	endpoints []string
+	http      *http.Client
+	timeout   time.Duration
+	dedupe    bool
+	header    http.Header
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sends requests with hc instead of a client that retries
+// 429 and 5xx responses within the node timeout
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.http = hc
+	}
+}
+
+// WithNodeTimeout bounds each instance's request; an instance that doesn't
+// answer in time is reported in SearchResult.Failed (default: 5s, 0 for none)
+func WithNodeTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = d
+	}
+}
+
+// WithDedupe keeps only the highest-scoring hit for each doc ID, for
+// deployments where instances hold overlapping documents
+func WithDedupe() Option {
+	return func(c *Client) {
+		c.dedupe = true
+	}
+}
+
+// WithHeader sets a header on every request, e.g. for authentication
+func WithHeader(key, value string) Option {
+	return func(c *Client) {
+		c.header.Set(key, value)
+	}
+}
+
+// New creates a client for the instances at endpoints (base URLs such as
+// http://node-a:8080)
+func New(endpoints []string, opts ...Option) (*Client, error) {
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("cluster needs at least one endpoint")
+	}
+	c := &Client{
+		endpoints: make([]string, len(endpoints)),
+		http:      httpclient.New(),
+		timeout:   5 * time.Second,
+		header:    make(http.Header),
+	}
+	for i, e := range endpoints {
+		if e == "" {
+			return nil, fmt.Errorf("endpoint %d is empty", i)
+		}
+		c.endpoints[i] = strings.TrimRight(e, "/")
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// SearchRequest is a search sent to every instance
+type SearchRequest struct {
+	Query      string `json:"query"`
+	Limit      int    `json:"limit,omitempty"`      // Hits in the merged result (default: DefaultLimit)
+	Mode       string `json:"mode,omitempty"`       // semantic (default) or keyword
+	Collection string `json:"collection,omitempty"` // Default: "default"
+}
+
+// Hit is a search result and the instance it came from
+type Hit struct {
+	DocID      string            `json:"doc_id"`
+	Score      float32           `json:"score"`
+	Title      string            `json:"title"`
+	Text       string            `json:"text"`
+	Source     string            `json:"source"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+	CreatedAt  time.Time         `json:"created_at"`
+	Collection string            `json:"collection"`
+
+	Node string `json:"-"` // Endpoint that returned the hit
+}
+
+// NodeError is an instance that failed to answer
+type NodeError struct {
+	Node string
+	Err  error
+}
+
+func (e *NodeError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Node, e.Err)
+}
+
+func (e *NodeError) Unwrap() error {
+	return e.Err
+}
+
+// SearchResult is the merged result of a search
+type SearchResult struct {
+	Hits   []Hit        // Highest score first
+	Failed []*NodeError // Instances whose hits are missing
+}
+
+// Partial reports whether some instances failed to answer
+func (r *SearchResult) Partial() bool {
+	return len(r.Failed) > 0
+}
+
+// Search sends req to every instance concurrently and merges their hits by
+// score. It only fails when no instance answered; otherwise failed instances
+// are listed in the result.
+func (c *Client) Search(ctx context.Context, req SearchRequest) (*SearchResult, error) {
+	if req.Query == "" {
+		return nil, fmt.Errorf("query is required")
+	}
+	if req.Limit <= 0 {
+		req.Limit = DefaultLimit
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	hits := make([][]Hit, len(c.endpoints))
+	errs := make([]error, len(c.endpoints))
+	var wg sync.WaitGroup
+	for i, endpoint := range c.endpoints {
+		wg.Add(1)
+		go func(i int, endpoint string) {
+			defer wg.Done()
+			hits[i], errs[i] = c.searchNode(ctx, endpoint, body)
+		}(i, endpoint)
+	}
+	wg.Wait()
+
+	res := &SearchResult{}
+	for i, endpoint := range c.endpoints {
+		if errs[i] != nil {
+			res.Failed = append(res.Failed, &NodeError{Node: endpoint, Err: errs[i]})
+			continue
+		}
+		res.Hits = append(res.Hits, hits[i]...)
+	}
+	if len(res.Failed) == len(c.endpoints) {
+		nodeErrs := make([]error, len(res.Failed))
+		for i, e := range res.Failed {
+			nodeErrs[i] = e
+		}
+		return nil, fmt.Errorf("%w: %w", ErrAllNodesFailed, errors.Join(nodeErrs...))
+	}
+
+	sort.SliceStable(res.Hits, func(i, j int) bool { return res.Hits[i].Score > res.Hits[j].Score })
+	if c.dedupe {
+		res.Hits = dedupe(res.Hits)
+	}
+	if len(res.Hits) > req.Limit {
+		res.Hits = res.Hits[:req.Limit]
+	}
+	return res, nil
+}
+
+// searchNode runs one instance's search
+func (c *Client) searchNode(ctx context.Context, endpoint string, body []byte) ([]Hit, error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"/search", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	for k, v := range c.header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error string `json:"error"`
+			Code  string `json:"code"`
+		}
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Code != "" {
+			return nil, fmt.Errorf("status %d: %s (%s)", resp.StatusCode, apiErr.Error, apiErr.Code)
+		}
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	var out struct {
+		Results []Hit `json:"results"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	for i := range out.Results {
+		out.Results[i].Node = endpoint
+	}
+	return out.Results, nil
+}
+
+// dedupe keeps the first (highest-scoring) hit for each doc ID
+func dedupe(hits []Hit) []Hit {
+	seen := make(map[string]bool, len(hits))
+	out := hits[:0]
+	for _, h := range hits {
+		if seen[h.DocID] {
+			continue
+		}
+		seen[h.DocID] = true
+		out = append(out, h)
+	}
+	return out
+}
@@ -0,0 +1,125 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// node serves /search with fixed hits
+func node(t *testing.T, hits ...Hit) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req SearchRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || r.URL.Path != "/search" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"results": hits, "count": len(hits)})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestSearchMergesByScore(t *testing.T) {
+	a := node(t, Hit{DocID: "a1", Score: 0.9}, Hit{DocID: "a2", Score: 0.3})
+	b := node(t, Hit{DocID: "b1", Score: 0.7}, Hit{DocID: "b2", Score: 0.5})
+
+	c, err := New([]string{a.URL, b.URL + "/"})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	res, err := c.Search(context.Background(), SearchRequest{Query: "q", Limit: 3})
+	if err != nil {
+		t.Fatalf("Search() failed: %v", err)
+	}
+
+	want := []string{"a1", "b1", "b2"}
+	if len(res.Hits) != len(want) {
+		t.Fatalf("expected %d hits, got %d", len(want), len(res.Hits))
+	}
+	for i, id := range want {
+		if res.Hits[i].DocID != id {
+			t.Errorf("hit %d: expected %s, got %s", i, id, res.Hits[i].DocID)
+		}
+	}
+	if res.Hits[1].Node != b.URL {
+		t.Errorf("expected b1 attributed to %s, got %s", b.URL, res.Hits[1].Node)
+	}
+	if res.Partial() {
+		t.Errorf("unexpected failures: %v", res.Failed)
+	}
+}
+
+func TestSearchPartialFailure(t *testing.T) {
+	ok := node(t, Hit{DocID: "a1", Score: 0.9})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer slow.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotImplemented)
+		_, _ = w.Write([]byte(`{"error":"keyword index is not enabled","code":"NOT_SUPPORTED"}`))
+	}))
+	defer broken.Close()
+
+	c, _ := New([]string{ok.URL, slow.URL, broken.URL}, WithNodeTimeout(50*time.Millisecond))
+	res, err := c.Search(context.Background(), SearchRequest{Query: "q"})
+	if err != nil {
+		t.Fatalf("Search() failed: %v", err)
+	}
+	if len(res.Hits) != 1 || !res.Partial() || len(res.Failed) != 2 {
+		t.Fatalf("expected 1 hit and 2 failures, got %d hits, failed %v", len(res.Hits), res.Failed)
+	}
+	if !errors.Is(res.Failed[0].Err, context.DeadlineExceeded) {
+		t.Errorf("expected the slow node to time out, got %v", res.Failed[0])
+	}
+	if res.Failed[1].Node != broken.URL {
+		t.Errorf("expected the broken node second, got %s", res.Failed[1].Node)
+	}
+
+	// With no node answering, the search fails
+	c, _ = New([]string{slow.URL, broken.URL}, WithNodeTimeout(50*time.Millisecond))
+	if _, err := c.Search(context.Background(), SearchRequest{Query: "q"}); !errors.Is(err, ErrAllNodesFailed) {
+		t.Errorf("expected ErrAllNodesFailed, got %v", err)
+	}
+}
+
+func TestSearchDedupe(t *testing.T) {
+	a := node(t, Hit{DocID: "shared", Score: 0.4}, Hit{DocID: "a1", Score: 0.6})
+	b := node(t, Hit{DocID: "shared", Score: 0.8})
+
+	c, _ := New([]string{a.URL, b.URL}, WithDedupe())
+	res, err := c.Search(context.Background(), SearchRequest{Query: "q"})
+	if err != nil {
+		t.Fatalf("Search() failed: %v", err)
+	}
+	if len(res.Hits) != 2 || res.Hits[0].DocID != "shared" || res.Hits[0].Score != 0.8 {
+		t.Errorf("expected shared once with its best score, got %+v", res.Hits)
+	}
+
+	c, _ = New([]string{a.URL, b.URL})
+	if res, _ := c.Search(context.Background(), SearchRequest{Query: "q"}); len(res.Hits) != 3 {
+		t.Errorf("expected duplicates without dedupe, got %d hits", len(res.Hits))
+	}
+}
+
+func TestNewValidation(t *testing.T) {
+	if _, err := New(nil); err == nil {
+		t.Error("expected an error without endpoints")
+	}
+	if _, err := New([]string{""}); err == nil {
+		t.Error("expected an error for an empty endpoint")
+	}
+	c, _ := New([]string{"http://localhost:1"})
+	if _, err := c.Search(context.Background(), SearchRequest{}); err == nil {
+		t.Error("expected an error without a query")
+	}
+}
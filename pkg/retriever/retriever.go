@@ -0,0 +1,152 @@
+// Package retriever is a client for Selfstack's /retrieve endpoint, the
+// contract retriever plugins of RAG frameworks expect: a query in, scored
+// chunks with metadata out.
+//
+//	r, err := retriever.New("http://localhost:8080", retriever.WithHeader("Authorization", "Bearer "+key))
+//	docs, err := r.Retrieve(ctx, retriever.Request{Query: "how do we deploy?", TopK: 4})
+//	// docs[0].PageContent, docs[0].Score, docs[0].SourceURI()
+package retriever
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/dsjohal14/selfstack/internal/libs/httpclient"
+)
+
+// maxResponseSize caps a response read into memory
+const maxResponseSize = 64 << 20
+
+// Client retrieves documents from one Selfstack instance
+type Client struct {
+	endpoint string
+	http     *http.Client
+	header   http.Header
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sends requests with hc instead of a client that retries
+// 429 and 5xx responses
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.http = hc
+	}
+}
+
+// WithHeader sets a header on every request, e.g. for authentication
+func WithHeader(key, value string) Option {
+	return func(c *Client) {
+		c.header.Set(key, value)
+	}
+}
+
+// New creates a client for the instance at endpoint (a base URL such as
+// http://localhost:8080)
+func New(endpoint string, opts ...Option) (*Client, error) {
+	if endpoint == "" {
+		return nil, fmt.Errorf("endpoint is required")
+	}
+	c := &Client{
+		endpoint: strings.TrimRight(endpoint, "/"),
+		http:     httpclient.New(),
+		header:   make(http.Header),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// Request is a retrieval
+type Request struct {
+	Query      string  `json:"query"`
+	TopK       int     `json:"top_k,omitempty"`      // Default: 4
+	Collection string  `json:"collection,omitempty"` // Default: "default"
+	Mode       string  `json:"mode,omitempty"`       // semantic (default) or keyword
+	MinScore   float32 `json:"min_score,omitempty"`
+}
+
+// Document is a retrieved chunk
+type Document struct {
+	ID          string            `json:"id"`
+	PageContent string            `json:"page_content"`
+	Score       float32           `json:"score"`
+	Metadata    map[string]string `json:"metadata"`
+}
+
+// DocID is the document the chunk belongs to
+func (d Document) DocID() string { return d.Metadata["doc_id"] }
+
+// SourceURI is where the document came from
+func (d Document) SourceURI() string { return d.Metadata["source_uri"] }
+
+// Error is an error response from the server
+type Error struct {
+	Status  int
+	Message string
+	Code    string
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("status %d", e.Status)
+	}
+	return fmt.Sprintf("status %d: %s (%s)", e.Status, e.Message, e.Code)
+}
+
+// Retrieve returns the documents best matching req, best first
+func (c *Client) Retrieve(ctx context.Context, req Request) ([]Document, error) {
+	if req.Query == "" {
+		return nil, fmt.Errorf("query is required")
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint+"/retrieve", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	for k, v := range c.header {
+		httpReq.Header[k] = v
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.http.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		apiErr := &Error{Status: resp.StatusCode}
+		var body struct {
+			Error string `json:"error"`
+			Code  string `json:"code"`
+		}
+		if json.Unmarshal(data, &body) == nil {
+			apiErr.Message, apiErr.Code = body.Error, body.Code
+		}
+		return nil, apiErr
+	}
+
+	var out struct {
+		Documents []Document `json:"documents"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return out.Documents, nil
+}
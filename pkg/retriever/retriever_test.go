@@ -0,0 +1,51 @@
+package retriever
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRetrieve(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || r.URL.Path != "/retrieve" || r.Header.Get("Authorization") != "Bearer k" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if req.Collection == "missing" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error": "collection not found: missing", "code": "COLLECTION_NOT_FOUND"}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"query": req.Query, "documents": []Document{{
+			ID: "doc-1:chunk:2", PageContent: "deploy steps", Score: 0.8,
+			Metadata: map[string]string{"doc_id": "doc-1", "source_uri": "https://wiki/deploys"},
+		}}})
+	}))
+	defer srv.Close()
+
+	c, err := New(srv.URL+"/", WithHTTPClient(srv.Client()), WithHeader("Authorization", "Bearer k"))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	docs, err := c.Retrieve(context.Background(), Request{Query: "deploy", TopK: 2})
+	if err != nil {
+		t.Fatalf("Retrieve failed: %v", err)
+	}
+	if len(docs) != 1 || docs[0].DocID() != "doc-1" || docs[0].SourceURI() != "https://wiki/deploys" || docs[0].Score != 0.8 {
+		t.Errorf("docs = %+v", docs)
+	}
+
+	_, err = c.Retrieve(context.Background(), Request{Query: "deploy", Collection: "missing"})
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusNotFound || apiErr.Code != "COLLECTION_NOT_FOUND" {
+		t.Errorf("missing collection = %v", err)
+	}
+	if _, err := c.Retrieve(context.Background(), Request{}); err == nil {
+		t.Error("expected an empty query to fail")
+	}
+}
@@ -0,0 +1,289 @@
+package selfstack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// SegmentEventsQuery filters the segment audit trail; zero fields don't
+type SegmentEventsQuery struct {
+	SegmentID   *uint64
+	SegmentType string // wal or cmp
+	Since       time.Time
+	Limit       int
+}
+
+// SegmentEvents returns the WAL segment lifecycle audit trail
+func (c *Client) SegmentEvents(ctx context.Context, query SegmentEventsQuery) (*SegmentEventsResponse, error) {
+	q := url.Values{"segment_type": {query.SegmentType}}
+	if query.SegmentID != nil {
+		q.Set("segment_id", strconv.FormatUint(*query.SegmentID, 10))
+	}
+	if !query.Since.IsZero() {
+		q.Set("since", query.Since.Format(time.RFC3339))
+	}
+	if query.Limit > 0 {
+		q.Set("limit", strconv.Itoa(query.Limit))
+	}
+	var resp SegmentEventsResponse
+	if _, err := c.do(ctx, http.MethodGet, withQuery("/admin/segments/events", q), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// CompactionPlan returns what compaction would do; with force, as if it
+// were forced
+func (c *Client) CompactionPlan(ctx context.Context, force bool) (*CompactionPlan, error) {
+	path := "/admin/compaction/plan"
+	if force {
+		path += "?force=true"
+	}
+	var plan CompactionPlan
+	if _, err := c.do(ctx, http.MethodGet, path, nil, &plan); err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+// Compact forces compaction of the sealed WAL segments
+func (c *Client) Compact(ctx context.Context) error {
+	_, err := c.do(ctx, http.MethodPost, "/admin/compaction", nil, nil)
+	return err
+}
+
+// CollectGarbage quarantines orphaned files in the WAL directory and
+// deletes the ones past their grace period, or with dryRun only reports
+// what it would do
+func (c *Client) CollectGarbage(ctx context.Context, dryRun bool) (*GCReport, error) {
+	path := "/admin/gc"
+	if dryRun {
+		path += "?dry_run=true"
+	}
+	var report GCReport
+	if _, err := c.do(ctx, http.MethodPost, path, nil, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// Reset wipes every document, alias, and WAL segment from the store. The
+// client's API key must be listed in the server's RESET_KEYS.
+func (c *Client) Reset(ctx context.Context) (*ResetReport, error) {
+	var report ResetReport
+	if _, err := c.do(ctx, http.MethodPost, "/admin/reset?confirm=true", nil, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// CreateKey creates an API key. The response holds its secret, which the
+// server never shows again. The client's API key must be listed in the
+// server's KEY_ADMIN_KEYS, as for the other key methods.
+func (c *Client) CreateKey(ctx context.Context, req CreateKeyRequest) (*KeySecretResponse, error) {
+	var resp KeySecretResponse
+	if _, err := c.do(ctx, http.MethodPost, "/admin/keys", req, &resp, http.StatusCreated); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Keys lists the API keys, oldest first
+func (c *Client) Keys(ctx context.Context) (*KeyListResponse, error) {
+	var resp KeyListResponse
+	if _, err := c.do(ctx, http.MethodGet, "/admin/keys", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Key returns an API key
+func (c *Client) Key(ctx context.Context, id string) (*APIKey, error) {
+	var key APIKey
+	if _, err := c.do(ctx, http.MethodGet, pathOf("admin", "keys", id), nil, &key); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// UpdateKey renames an API key or changes its namespaces or expiry
+func (c *Client) UpdateKey(ctx context.Context, id string, req UpdateKeyRequest) (*APIKey, error) {
+	var key APIKey
+	if _, err := c.do(ctx, http.MethodPatch, pathOf("admin", "keys", id), req, &key); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// RotateKey replaces an API key and returns the new one with its secret.
+// The old key keeps working for overlap; 0 keeps the server's default
+// (24h).
+func (c *Client) RotateKey(ctx context.Context, id string, overlap time.Duration) (*KeySecretResponse, error) {
+	q := url.Values{}
+	if overlap > 0 {
+		q.Set("overlap", overlap.String())
+	}
+	var resp KeySecretResponse
+	if _, err := c.do(ctx, http.MethodPost, withQuery(pathOf("admin", "keys", id, "rotate"), q), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// DeleteKey revokes an API key at once
+func (c *Client) DeleteKey(ctx context.Context, id string) error {
+	_, err := c.do(ctx, http.MethodDelete, pathOf("admin", "keys", id), nil, nil)
+	return err
+}
+
+// Flags lists the feature flags
+func (c *Client) Flags(ctx context.Context) (*FlagsResponse, error) {
+	var resp FlagsResponse
+	if _, err := c.do(ctx, http.MethodGet, "/admin/flags", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// SetFlag overrides a feature flag
+func (c *Client) SetFlag(ctx context.Context, name string, enabled bool) (*FlagState, error) {
+	var resp FlagState
+	body := SetFlagRequest{Enabled: &enabled}
+	if _, err := c.do(ctx, http.MethodPut, pathOf("admin", "flags", name), body, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ClearFlag drops a feature flag's override
+func (c *Client) ClearFlag(ctx context.Context, name string) (*FlagState, error) {
+	var resp FlagState
+	if _, err := c.do(ctx, http.MethodDelete, pathOf("admin", "flags", name), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// UsageQuery selects metered usage; zero fields don't filter
+type UsageQuery struct {
+	Key    string
+	Period string    // month (default) or day
+	From   time.Time // Dates, in UTC
+	To     time.Time
+}
+
+// Usage returns metered usage per key and period
+func (c *Client) Usage(ctx context.Context, query UsageQuery) (*UsageResponse, error) {
+	q := url.Values{"key": {query.Key}, "period": {query.Period}}
+	if !query.From.IsZero() {
+		q.Set("from", query.From.Format("2006-01-02"))
+	}
+	if !query.To.IsZero() {
+		q.Set("to", query.To.Format("2006-01-02"))
+	}
+	var resp UsageResponse
+	if _, err := c.do(ctx, http.MethodGet, withQuery("/admin/usage", q), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// BulkStatus returns the state of the bulk ingest queue
+func (c *Client) BulkStatus(ctx context.Context) (*BulkStatusResponse, error) {
+	var resp BulkStatusResponse
+	if _, err := c.do(ctx, http.MethodGet, "/admin/ingest/bulk", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Backfill streams ingest requests, one JSON object per line, through the
+// bulk load path. It runs for as long as r lasts, bounded only by ctx.
+// Documents the server rejects are listed in the response, not returned as
+// an error.
+func (c *Client) Backfill(ctx context.Context, r io.Reader) (*BackfillResponse, error) {
+	resp, err := c.send(ctx, c.stream, http.MethodPost, "/admin/backfill", r, "application/x-ndjson")
+	if err != nil {
+		return nil, err
+	}
+	var report BackfillResponse
+	if err := decode(resp, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// BackfillDocuments streams docs through the bulk load path as Backfill
+// does, encoding them as they're sent
+func (c *Client) BackfillDocuments(ctx context.Context, docs []IngestRequest) (*BackfillResponse, error) {
+	pr, pw := io.Pipe()
+	go func() {
+		enc := json.NewEncoder(pw)
+		for i := range docs {
+			if err := enc.Encode(&docs[i]); err != nil {
+				_ = pw.CloseWithError(fmt.Errorf("failed to encode document %d: %w", i+1, err))
+				return
+			}
+		}
+		_ = pw.Close()
+	}()
+	defer func() { _ = pr.Close() }()
+	return c.Backfill(ctx, pr)
+}
+
+// SLO returns the service level objectives and whether they're met
+func (c *Client) SLO(ctx context.Context) (*SLOResponse, error) {
+	var resp SLOResponse
+	if _, err := c.do(ctx, http.MethodGet, "/admin/slo", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Capacity returns the size of the index and WAL, with growth projected
+// days ahead (the server's default if 0)
+func (c *Client) Capacity(ctx context.Context, days int) (*CapacityResponse, error) {
+	q := url.Values{}
+	if days > 0 {
+		q.Set("days", strconv.Itoa(days))
+	}
+	var resp CapacityResponse
+	if _, err := c.do(ctx, http.MethodGet, withQuery("/admin/capacity", q), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// LogLevels returns the global log level and per-module overrides
+func (c *Client) LogLevels(ctx context.Context) (*LogLevels, error) {
+	var resp LogLevels
+	if _, err := c.do(ctx, http.MethodGet, "/admin/log-levels", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// SetLogLevel overrides a module's log level until restart
+func (c *Client) SetLogLevel(ctx context.Context, module, level string) (*LogLevels, error) {
+	var resp LogLevels
+	body := SetLogLevelRequest{Level: level}
+	if _, err := c.do(ctx, http.MethodPut, pathOf("admin", "log-levels", module), body, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ClearLogLevel drops a module's log level override
+func (c *Client) ClearLogLevel(ctx context.Context, module string) (*LogLevels, error) {
+	var resp LogLevels
+	if _, err := c.do(ctx, http.MethodDelete, pathOf("admin", "log-levels", module), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
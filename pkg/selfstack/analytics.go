@@ -0,0 +1,23 @@
+package selfstack
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Duplicates returns the latest near-duplicate report, optionally only the
+// groups in collection and at most limit of them (the server's default if
+// 0). The server answers 503 until its first report is built.
+func (c *Client) Duplicates(ctx context.Context, collection string, limit int) (*DuplicatesResponse, error) {
+	q := url.Values{"collection": {collection}}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	var resp DuplicatesResponse
+	if _, err := c.do(ctx, http.MethodGet, withQuery("/analytics/duplicates", q), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
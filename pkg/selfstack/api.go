@@ -0,0 +1,175 @@
+package selfstack
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Health returns the server's health and capabilities
+func (c *Client) Health(ctx context.Context) (*HealthResponse, error) {
+	var resp HealthResponse
+	if _, err := c.do(ctx, http.MethodGet, "/health", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Ready returns whether the server is ready for traffic. A server that is
+// still warming up isn't an error: its response has Ready false.
+func (c *Client) Ready(ctx context.Context) (*ReadyResponse, error) {
+	var resp ReadyResponse
+	if _, err := c.do(ctx, http.MethodGet, "/readyz", nil, &resp, http.StatusOK, http.StatusServiceUnavailable); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Version returns the server's build
+func (c *Client) Version(ctx context.Context) (*VersionResponse, error) {
+	var resp VersionResponse
+	if _, err := c.do(ctx, http.MethodGet, "/version", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Ingest stores a document. Bulk-priority ingests are queued: the response
+// has Queued set and the document is written shortly after.
+func (c *Client) Ingest(ctx context.Context, req IngestRequest) (*IngestResponse, error) {
+	var resp IngestResponse
+	if _, err := c.do(ctx, http.MethodPost, "/ingest", req, &resp, http.StatusOK, http.StatusAccepted); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Search returns the documents best matching req, best first
+func (c *Client) Search(ctx context.Context, req SearchRequest) (*SearchResponse, error) {
+	var resp SearchResponse
+	if _, err := c.do(ctx, http.MethodPost, "/search", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Run answers req's query from the documents, with citations
+func (c *Client) Run(ctx context.Context, req RunRequest) (*RunResponse, error) {
+	var resp RunResponse
+	if _, err := c.do(ctx, http.MethodPost, "/run", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Retrieve returns scored chunks in the shape retriever plugins expect
+func (c *Client) Retrieve(ctx context.Context, req RetrieveRequest) (*RetrieveResponse, error) {
+	var resp RetrieveResponse
+	if _, err := c.do(ctx, http.MethodPost, "/retrieve", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Suggest returns past queries of collection starting with prefix, most
+// used first; limit 0 uses the server's default
+func (c *Client) Suggest(ctx context.Context, prefix, collection string, limit int) (*SuggestResponse, error) {
+	q := url.Values{"q": {prefix}, "collection": {collection}}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	var resp SuggestResponse
+	if _, err := c.do(ctx, http.MethodGet, withQuery("/suggest", q), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Resolve returns the document an alias points to
+func (c *Client) Resolve(ctx context.Context, alias string) (*ResolveResponse, error) {
+	var resp ResolveResponse
+	if _, err := c.do(ctx, http.MethodGet, withQuery("/resolve", url.Values{"alias": {alias}}), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GetDocument returns a stored document
+func (c *Client) GetDocument(ctx context.Context, id string) (*DocumentResponse, error) {
+	var resp DocumentResponse
+	if _, err := c.do(ctx, http.MethodGet, pathOf("documents", id), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GetDocumentWithEmbedding returns a stored document and its embedding.
+// The API key must be listed in the server's EMBEDDING_EXPORT_KEYS.
+func (c *Client) GetDocumentWithEmbedding(ctx context.Context, id string) (*DocumentResponse, error) {
+	var resp DocumentResponse
+	path := withQuery(pathOf("documents", id), url.Values{"include_embedding": {"true"}})
+	if _, err := c.do(ctx, http.MethodGet, path, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// SimilarDocuments returns the documents most like a stored one, up to
+// limit (the server's default if 0)
+func (c *Client) SimilarDocuments(ctx context.Context, id string, limit int) (*SimilarResponse, error) {
+	q := url.Values{}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	var resp SimilarResponse
+	if _, err := c.do(ctx, http.MethodGet, withQuery(pathOf("documents", id, "similar"), q), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// DeleteDocument deletes a document
+func (c *Client) DeleteDocument(ctx context.Context, id string) (*DeleteResponse, error) {
+	var resp DeleteResponse
+	if _, err := c.do(ctx, http.MethodDelete, pathOf("documents", id), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ListDeleted returns documents deleted since since (all if zero), up to
+// limit (the server's default if 0)
+func (c *Client) ListDeleted(ctx context.Context, since time.Time, limit int) (*DeletedListResponse, error) {
+	q := url.Values{}
+	if !since.IsZero() {
+		q.Set("since", since.Format(time.RFC3339))
+	}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	var resp DeletedListResponse
+	if _, err := c.do(ctx, http.MethodGet, withQuery("/documents/deleted", q), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// RestoreDocument undeletes a document
+func (c *Client) RestoreDocument(ctx context.Context, id string) (*DocumentResponse, error) {
+	var resp DocumentResponse
+	if _, err := c.do(ctx, http.MethodPost, pathOf("documents", id, "restore"), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// MoveDocument renames a document or moves it to another collection
+func (c *Client) MoveDocument(ctx context.Context, id string, req MoveRequest) (*DocumentResponse, error) {
+	var resp DocumentResponse
+	if _, err := c.do(ctx, http.MethodPost, pathOf("documents", id, "move"), req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
@@ -0,0 +1,122 @@
+package selfstack
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// ChangelogStream reads the document and collection changes of a
+// changelog, ending at its end line
+//
+//	changes, err := c.Changelog(ctx, from, false)
+//	defer changes.Close()
+//	for changes.Next() {
+//		apply(changes.Entry())
+//	}
+//	err = changes.Err()
+//	from = changes.NextLSN()
+type ChangelogStream struct {
+	body    io.ReadCloser
+	scanner *bufio.Scanner
+	entry   ChangelogEntry
+	next    uint64
+	err     error
+}
+
+// Changelog streams the changes from fromLSN up to the server's index
+// watermark, for a mirror to bootstrap from 0 and then call again from
+// each stream's NextLSN. With embeddings each document carries its
+// embedding, which the server allows only for export keys.
+func (c *Client) Changelog(ctx context.Context, fromLSN uint64, embeddings bool) (*ChangelogStream, error) {
+	q := url.Values{"from_lsn": {strconv.FormatUint(fromLSN, 10)}}
+	if embeddings {
+		q.Set("include_embeddings", "true")
+	}
+	resp, err := c.send(ctx, c.stream, http.MethodGet, withQuery("/admin/changelog", q), nil, "")
+	if err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxResponseSize)
+	return &ChangelogStream{body: resp.Body, scanner: scanner}, nil
+}
+
+// ImportChangelog replays a changelog, as Changelog streams it, through
+// the server's WAL in the order r holds it. Like Backfill it runs for as
+// long as r lasts; changes the server rejects are listed in the response,
+// not returned as an error. With dryRun the server only validates it.
+func (c *Client) ImportChangelog(ctx context.Context, r io.Reader, dryRun bool) (*ChangelogImportResponse, error) {
+	q := url.Values{}
+	if dryRun {
+		q.Set("dry_run", "true")
+	}
+	resp, err := c.send(ctx, c.stream, http.MethodPost, withQuery("/admin/changelog", q), r, "application/x-ndjson")
+	if err != nil {
+		return nil, err
+	}
+	var report ChangelogImportResponse
+	if err := decode(resp, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// Next reads the next change, returning false at the end of the changelog
+// or on an error
+func (s *ChangelogStream) Next() bool {
+	if s.err != nil || s.next != 0 {
+		return false
+	}
+	for s.scanner.Scan() {
+		if len(s.scanner.Bytes()) == 0 {
+			continue
+		}
+		s.entry = ChangelogEntry{}
+		if err := json.Unmarshal(s.scanner.Bytes(), &s.entry); err != nil {
+			s.err = fmt.Errorf("failed to decode change: %w", err)
+			return false
+		}
+		switch s.entry.Op {
+		case "end":
+			s.next = s.entry.NextLSN
+			return false
+		case "error":
+			s.err = fmt.Errorf("changelog failed on the server: %s", s.entry.Error)
+			return false
+		}
+		return true
+	}
+	if err := s.scanner.Err(); err != nil {
+		s.err = fmt.Errorf("failed to read changelog: %w", err)
+	} else {
+		s.err = io.ErrUnexpectedEOF // The changelog ended without its end line
+	}
+	return false
+}
+
+// Entry returns the change Next read
+func (s *ChangelogStream) Entry() ChangelogEntry {
+	return s.entry
+}
+
+// NextLSN returns the LSN to continue from once the changelog has been
+// read to its end, and 0 before then
+func (s *ChangelogStream) NextLSN() uint64 {
+	return s.next
+}
+
+// Err returns the error that ended the changelog, if any
+func (s *ChangelogStream) Err() error {
+	return s.err
+}
+
+// Close releases the changelog
+func (s *ChangelogStream) Close() error {
+	return s.body.Close()
+}
@@ -0,0 +1,241 @@
+// Package selfstack is the Go client for the Selfstack API. It covers every
+// endpoint the server mounts, with request and response types shared with
+// the server so the two can't drift apart. Requests take a context, are
+// retried on 429 and 5xx responses when their body can be replayed, and
+// fail with an *Error carrying the API's status and error code.
+//
+//	c, err := selfstack.New("http://localhost:8080", selfstack.WithHeader("Authorization", "Bearer "+key))
+//	_, err = c.Ingest(ctx, selfstack.IngestRequest{ID: "doc-1", Title: "Deploys", Text: "..."})
+//	resp, err := c.Search(ctx, selfstack.SearchRequest{Query: "how do we deploy?"})
+//	if selfstack.IsNotFound(err) { ... }
+package selfstack
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/dsjohal14/selfstack/internal/libs/httpclient"
+)
+
+// maxResponseSize caps a response read into memory
+const maxResponseSize = 64 << 20
+
+// Client calls one Selfstack instance
+type Client struct {
+	endpoint string
+	http     *http.Client
+	stream   *http.Client // For requests and responses that last as long as their stream
+	header   http.Header
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sends requests with hc instead of a client that retries
+// 429 and 5xx responses. Streaming calls use it too, so hc shouldn't have a
+// timeout shorter than a backfill.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.http = hc
+		c.stream = hc
+	}
+}
+
+// WithTLS connects with cfg, e.g. to present a client certificate to a
+// server using mutual TLS. Requests are still retried; it replaces a client
+// set by WithHTTPClient.
+func WithTLS(cfg *tls.Config) Option {
+	return func(c *Client) {
+		c.http = httpclient.New(httpclient.WithTLS(cfg))
+		c.stream = newStreamClient(httpclient.WithTLS(cfg))
+	}
+}
+
+// newStreamClient returns a client for streams. A stream can't be replayed
+// and runs for as long as its input, so it's bounded only by the caller's
+// context.
+func newStreamClient(opts ...httpclient.Option) *http.Client {
+	opts = append(opts, httpclient.WithTimeout(0), httpclient.WithMaxElapsed(0), httpclient.WithRetries(0))
+	return httpclient.New(opts...)
+}
+
+// WithHeader sets a header on every request, e.g. for authentication
+func WithHeader(key, value string) Option {
+	return func(c *Client) {
+		c.header.Set(key, value)
+	}
+}
+
+// WithAPIKey authenticates every request, and attributes its usage, with key
+func WithAPIKey(key string) Option {
+	return WithHeader("X-API-Key", key)
+}
+
+// New creates a client for the instance at endpoint (a base URL such as
+// http://localhost:8080)
+func New(endpoint string, opts ...Option) (*Client, error) {
+	if endpoint == "" {
+		return nil, fmt.Errorf("endpoint is required")
+	}
+	c := &Client{
+		endpoint: strings.TrimRight(endpoint, "/"),
+		http:     httpclient.New(),
+		stream:   newStreamClient(),
+		header:   make(http.Header),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// Endpoint returns the base URL the client calls
+func (c *Client) Endpoint() string {
+	return c.endpoint
+}
+
+// Error is an error response from the server
+type Error struct {
+	Status  int
+	Message string
+	Code    string // e.g. NOT_FOUND or INVALID_PARAM
+	Details string
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" && e.Message == "" {
+		return fmt.Sprintf("status %d", e.Status)
+	}
+	return fmt.Sprintf("status %d: %s (%s)", e.Status, e.Message, e.Code)
+}
+
+// IsNotFound reports whether err is a 404 response
+func IsNotFound(err error) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound
+}
+
+// responseError reads the error in a failed response's body. Most endpoints
+// answer with {"error": "...", "code": "..."}, the /v1 ones with OpenAI's
+// {"error": {"message": "...", "code": "..."}}.
+func responseError(status int, data []byte) *Error {
+	apiErr := &Error{Status: status}
+	var body struct {
+		Error   json.RawMessage `json:"error"`
+		Code    string          `json:"code"`
+		Details string          `json:"details"`
+	}
+	if json.Unmarshal(data, &body) != nil {
+		apiErr.Message = strings.TrimSpace(string(data))
+		return apiErr
+	}
+	apiErr.Code, apiErr.Details = body.Code, body.Details
+	if json.Unmarshal(body.Error, &apiErr.Message) != nil {
+		var openAI struct {
+			Message string `json:"message"`
+			Code    string `json:"code"`
+		}
+		if json.Unmarshal(body.Error, &openAI) == nil {
+			apiErr.Message, apiErr.Code = openAI.Message, openAI.Code
+		}
+	}
+	return apiErr
+}
+
+// send makes a request with hc and returns the response if its status is
+// one of ok (200 when none are given), closing it and returning an *Error
+// otherwise
+func (c *Client) send(ctx context.Context, hc *http.Client, method, path string, body io.Reader, contentType string, ok ...int) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.endpoint+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	for k, v := range c.header {
+		req.Header[k] = v
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if len(ok) == 0 {
+		ok = []int{http.StatusOK}
+	}
+	for _, status := range ok {
+		if resp.StatusCode == status {
+			return resp, nil
+		}
+	}
+	defer func() { _ = resp.Body.Close() }()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	return nil, responseError(resp.StatusCode, data)
+}
+
+// do sends in (if non-nil) as JSON and decodes a JSON response into out (if
+// non-nil). It returns the response's status, one of ok.
+func (c *Client) do(ctx context.Context, method, path string, in, out any, ok ...int) (int, error) {
+	var body io.Reader
+	var contentType string
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return 0, fmt.Errorf("failed to encode request: %w", err)
+		}
+		body, contentType = bytes.NewReader(data), "application/json"
+	}
+	resp, err := c.send(ctx, c.http, method, path, body, contentType, ok...)
+	if err != nil {
+		return 0, err
+	}
+	return resp.StatusCode, decode(resp, out)
+}
+
+// decode reads a JSON response into out (if non-nil) and closes it
+func decode(resp *http.Response, out any) error {
+	defer func() { _ = resp.Body.Close() }()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// pathOf joins path segments, escaping each
+func pathOf(segments ...string) string {
+	var b strings.Builder
+	for _, s := range segments {
+		b.WriteByte('/')
+		b.WriteString(url.PathEscape(s))
+	}
+	return b.String()
+}
+
+// withQuery appends the non-empty values in q to path
+func withQuery(path string, q url.Values) string {
+	for k, v := range q {
+		if len(v) == 0 || v[0] == "" {
+			delete(q, k)
+		}
+	}
+	if len(q) == 0 {
+		return path
+	}
+	return path + "?" + q.Encode()
+}
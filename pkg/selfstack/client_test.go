@@ -0,0 +1,299 @@
+package selfstack
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	httpapi "github.com/dsjohal14/selfstack/internal/http"
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+	"github.com/dsjohal14/selfstack/internal/scope/db/wal"
+	"github.com/go-chi/chi/v5"
+)
+
+// newTestClient serves the API's routes from a WAL store and returns a
+// client for them
+func newTestClient(t *testing.T) *Client {
+	t.Helper()
+	config := db.DefaultWALStoreConfig(t.TempDir())
+	config.SyncPolicy = wal.ImmediateSyncPolicy()
+	store, err := db.NewWALStore(context.Background(), config)
+	if err != nil {
+		t.Fatalf("failed to create WAL store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	reg, err := db.NewFileCollectionRegistry(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to open registry: %v", err)
+	}
+
+	keys, _ := db.NewAPIKeyStore("")
+	const secret = "sk-sdk"
+	sum := sha256.Sum256([]byte(secret))
+	admin := []string{httpapi.KeyHashPrefix + hex.EncodeToString(sum[:])}
+
+	obs.InitLogger("error")
+	r := chi.NewRouter()
+	httpapi.NewHandler(store, obs.Logger("test"), httpapi.WithCollections(reg), httpapi.WithEmbeddingExport(admin),
+		httpapi.WithAPIKeys(keys, admin, false)).Routes(r)
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+
+	c, err := New(srv.URL+"/", WithHTTPClient(srv.Client()), WithAPIKey(secret))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return c
+}
+
+func TestClientDocuments(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+
+	if health, err := c.Health(ctx); err != nil || health.Status != "healthy" {
+		t.Fatalf("Health = %+v, %v", health, err)
+	}
+	if ready, err := c.Ready(ctx); err != nil || !ready.Ready {
+		t.Fatalf("Ready = %+v, %v", ready, err)
+	}
+
+	for _, doc := range []IngestRequest{
+		{ID: "deploys", Source: "wiki", Title: "Deploy runbook", Text: "how do we deploy to production"},
+		{ID: "oncall", Source: "wiki", Title: "On-call", Text: "who is on call this week"},
+	} {
+		if resp, err := c.Ingest(ctx, doc); err != nil || !resp.Success {
+			t.Fatalf("Ingest(%s) = %+v, %v", doc.ID, resp, err)
+		}
+	}
+
+	doc, err := c.GetDocument(ctx, "deploys")
+	if err != nil || doc.Title != "Deploy runbook" {
+		t.Fatalf("GetDocument = %+v, %v", doc, err)
+	}
+	search, err := c.Search(ctx, SearchRequest{Query: "deploy to production", Limit: 1})
+	if err != nil || search.Count != 1 || search.Results[0].DocID != "deploys" {
+		t.Fatalf("Search = %+v, %v", search, err)
+	}
+	run, err := c.Run(ctx, RunRequest{Query: "how do we deploy?"})
+	if err != nil || len(run.Citations) == 0 {
+		t.Fatalf("Run = %+v, %v", run, err)
+	}
+	retrieved, err := c.Retrieve(ctx, RetrieveRequest{Query: "deploy", TopK: 1})
+	if err != nil || len(retrieved.Documents) != 1 {
+		t.Fatalf("Retrieve = %+v, %v", retrieved, err)
+	}
+
+	if doc, err := c.GetDocumentWithEmbedding(ctx, "deploys"); err != nil || len(doc.Embedding) == 0 {
+		t.Fatalf("GetDocumentWithEmbedding = %+v, %v", doc, err)
+	}
+	similar, err := c.SimilarDocuments(ctx, "deploys", 5)
+	if err != nil || similar.Count != 1 || similar.Results[0].DocID != "oncall" {
+		t.Fatalf("SimilarDocuments = %+v, %v", similar, err)
+	}
+
+	if _, err := c.DeleteDocument(ctx, "deploys"); err != nil {
+		t.Fatalf("DeleteDocument failed: %v", err)
+	}
+	if _, err := c.GetDocument(ctx, "deploys"); !IsNotFound(err) {
+		t.Errorf("expected a deleted document to be not found, got %v", err)
+	}
+	deleted, err := c.ListDeleted(ctx, time.Time{}, 10)
+	if err != nil || deleted.Count != 1 || deleted.Documents[0].ID != "deploys" {
+		t.Fatalf("ListDeleted = %+v, %v", deleted, err)
+	}
+	if doc, err := c.RestoreDocument(ctx, "deploys"); err != nil || doc.ID != "deploys" {
+		t.Fatalf("RestoreDocument = %+v, %v", doc, err)
+	}
+	if doc, err := c.MoveDocument(ctx, "deploys", MoveRequest{ID: "deploy-runbook"}); err != nil || doc.ID != "deploy-runbook" {
+		t.Fatalf("MoveDocument = %+v, %v", doc, err)
+	}
+
+	report, err := c.BackfillDocuments(ctx, []IngestRequest{
+		{ID: "a", Source: "archive", Title: "Alpha"},
+		{Source: "archive", Title: "No ID"},
+	})
+	if err != nil || report.Documents != 1 || report.Failed != 1 || report.Errors[0].Code != "MISSING_ID" {
+		t.Fatalf("BackfillDocuments = %+v, %v", report, err)
+	}
+	if _, err := c.GetDocument(ctx, "a"); err != nil {
+		t.Errorf("backfilled document: %v", err)
+	}
+}
+
+func TestClientCollections(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+
+	if _, created, err := c.PutCollection(ctx, CollectionConfig{Name: "notes"}); err != nil || !created {
+		t.Fatalf("PutCollection = %v, %v", created, err)
+	}
+	if _, created, err := c.PutCollection(ctx, CollectionConfig{Name: "notes", RetentionDays: 30}); err != nil || created {
+		t.Fatalf("replacing PutCollection = %v, %v", created, err)
+	}
+	if coll, err := c.GetCollection(ctx, "notes"); err != nil || coll.RetentionDays != 30 {
+		t.Fatalf("GetCollection = %+v, %v", coll, err)
+	}
+	if list, err := c.ListCollections(ctx); err != nil || list.Count != 2 {
+		t.Fatalf("ListCollections = %+v, %v", list, err)
+	}
+	if _, err := c.DeleteCollection(ctx, "notes"); err != nil {
+		t.Fatalf("DeleteCollection failed: %v", err)
+	}
+
+	_, _, err := c.PutCollection(ctx, CollectionConfig{Name: "Bad Name"})
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusBadRequest || apiErr.Code != "INVALID_COLLECTION" {
+		t.Errorf("invalid collection = %v", err)
+	}
+}
+
+func TestClientOpenAI(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+	if _, err := c.Ingest(ctx, IngestRequest{ID: "deploys", Source: "wiki", Title: "Deploy runbook", Text: "how do we deploy"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if models, err := c.Models(ctx); err != nil || len(models.Data) != 1 || models.Data[0].ID != "default" {
+		t.Fatalf("Models = %+v, %v", models, err)
+	}
+	if emb, err := c.Embeddings(ctx, OpenAIEmbeddingRequest{Input: json.RawMessage(`"deploy"`)}); err != nil || len(emb.Data) != 1 {
+		t.Fatalf("Embeddings = %+v, %v", emb, err)
+	}
+
+	messages := []OpenAIChatMessage{{Role: "user", Content: json.RawMessage(`"how do we deploy?"`)}}
+	resp, err := c.ChatCompletion(ctx, OpenAIChatRequest{Messages: messages})
+	if err != nil || len(resp.Choices) != 1 || resp.Choices[0].Message.Content == "" {
+		t.Fatalf("ChatCompletion = %+v, %v", resp, err)
+	}
+
+	stream, err := c.ChatCompletionStream(ctx, OpenAIChatRequest{Messages: messages})
+	if err != nil {
+		t.Fatalf("ChatCompletionStream failed: %v", err)
+	}
+	defer func() { _ = stream.Close() }()
+	var answer strings.Builder
+	chunks := 0
+	for stream.Next() {
+		chunk := stream.Chunk()
+		if d := chunk.Choices[0].Delta; d != nil {
+			answer.WriteString(d.Content)
+		}
+		chunks++
+	}
+	if err := stream.Err(); err != nil || chunks != 3 || answer.String() != resp.Choices[0].Message.Content {
+		t.Errorf("stream = %d chunks %q, %v", chunks, answer.String(), err)
+	}
+
+	// OpenAI-shaped errors are typed too
+	_, err = c.ChatCompletion(ctx, OpenAIChatRequest{})
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusBadRequest || apiErr.Code != "INVALID_MESSAGES" || apiErr.Message == "" {
+		t.Errorf("empty chat = %v", err)
+	}
+}
+
+func TestClientAdmin(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+
+	if plan, err := c.CompactionPlan(ctx, true); err != nil || plan == nil {
+		t.Fatalf("CompactionPlan = %+v, %v", plan, err)
+	}
+	var apiErr *Error
+	if err := c.Compact(ctx); !errors.As(err, &apiErr) || apiErr.Code != "COMPACTION_DISABLED" {
+		t.Errorf("Compact without compaction = %v", err)
+	}
+	if events, err := c.SegmentEvents(ctx, SegmentEventsQuery{SegmentType: "wal", Limit: 10}); err != nil || events.Count != len(events.Events) {
+		t.Fatalf("SegmentEvents = %+v, %v", events, err)
+	}
+
+	if _, err := c.Ingest(ctx, IngestRequest{ID: "deploys", Source: "wiki", Title: "Deploy runbook", Text: "how do we deploy"}); err != nil {
+		t.Fatal(err)
+	}
+	changes, err := c.Changelog(ctx, 0, true)
+	if err != nil {
+		t.Fatalf("Changelog failed: %v", err)
+	}
+	var ids []string
+	var export bytes.Buffer
+	enc := json.NewEncoder(&export)
+	for changes.Next() {
+		if e := changes.Entry(); e.Op == "insert" && len(e.Embedding) > 0 {
+			ids = append(ids, e.DocID)
+		}
+		_ = enc.Encode(changes.Entry())
+	}
+	_ = changes.Close()
+	if err := changes.Err(); err != nil || len(ids) != 1 || ids[0] != "deploys" || changes.NextLSN() == 0 {
+		t.Fatalf("Changelog = %v next %d, %v", ids, changes.NextLSN(), err)
+	}
+	_ = enc.Encode(ChangelogEntry{Op: "end", NextLSN: changes.NextLSN()})
+	clone := newTestClient(t)
+	if report, err := clone.ImportChangelog(ctx, &export, false); err != nil || report.Documents != 1 || report.Error != "" {
+		t.Fatalf("ImportChangelog = %+v, %v", report, err)
+	}
+	if doc, err := clone.GetDocument(ctx, "deploys"); err != nil || doc.Text != "how do we deploy" {
+		t.Fatalf("GetDocument after import = %+v, %v", doc, err)
+	}
+
+	levels, err := c.SetLogLevel(ctx, "sdk-test", "debug")
+	if err != nil || levels.Modules["sdk-test"] != "debug" {
+		t.Fatalf("SetLogLevel = %+v, %v", levels, err)
+	}
+	if levels, err := c.ClearLogLevel(ctx, "sdk-test"); err != nil || levels.Modules["sdk-test"] != "" {
+		t.Fatalf("ClearLogLevel = %+v, %v", levels, err)
+	}
+
+	created, err := c.CreateKey(ctx, CreateKeyRequest{Name: "sdk", Namespaces: []string{"default"}})
+	if err != nil || created.Secret == "" {
+		t.Fatalf("CreateKey = %+v, %v", created, err)
+	}
+	rotated, err := c.RotateKey(ctx, created.ID, time.Hour)
+	if err != nil || rotated.Name != "sdk" {
+		t.Fatalf("RotateKey = %+v, %v", rotated, err)
+	}
+	if old, err := c.Key(ctx, created.ID); err != nil || old.RotatedTo != rotated.ID || old.ExpiresAt == nil {
+		t.Errorf("Key = %+v, %v; want it rotated to %s", old, err, rotated.ID)
+	}
+	if err := c.DeleteKey(ctx, created.ID); err != nil {
+		t.Fatalf("DeleteKey failed: %v", err)
+	}
+	if keys, err := c.Keys(ctx); err != nil || keys.Count != 1 || keys.Keys[0].ID != rotated.ID {
+		t.Errorf("Keys = %+v, %v; want only %s", keys, err, rotated.ID)
+	}
+
+	// Endpoints whose feature is off say so with a typed error
+	_, err = c.BulkStatus(ctx)
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusNotImplemented || apiErr.Code != "NOT_SUPPORTED" {
+		t.Errorf("BulkStatus without bulk ingest = %v", err)
+	}
+}
+
+func TestResponseError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		_, _ = io.WriteString(w, "upstream down")
+	}))
+	defer srv.Close()
+
+	c, _ := New(srv.URL, WithHTTPClient(srv.Client()))
+	_, err := c.Health(context.Background())
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusBadGateway || apiErr.Message != "upstream down" {
+		t.Errorf("non-JSON error = %v", err)
+	}
+	if _, err := New(""); err == nil {
+		t.Error("expected an empty endpoint to fail")
+	}
+}
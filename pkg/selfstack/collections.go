@@ -0,0 +1,44 @@
+package selfstack
+
+import (
+	"context"
+	"net/http"
+)
+
+// PutCollection creates or replaces a collection. Created is true when the
+// collection didn't exist before.
+func (c *Client) PutCollection(ctx context.Context, cfg CollectionConfig) (resp *CollectionResponse, created bool, err error) {
+	resp = &CollectionResponse{}
+	status, err := c.do(ctx, http.MethodPost, "/collections", cfg, resp, http.StatusOK, http.StatusCreated)
+	if err != nil {
+		return nil, false, err
+	}
+	return resp, status == http.StatusCreated, nil
+}
+
+// ListCollections lists the collections, including the default one
+func (c *Client) ListCollections(ctx context.Context) (*CollectionListResponse, error) {
+	var resp CollectionListResponse
+	if _, err := c.do(ctx, http.MethodGet, "/collections", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GetCollection returns a collection's config and document count
+func (c *Client) GetCollection(ctx context.Context, name string) (*CollectionResponse, error) {
+	var resp CollectionResponse
+	if _, err := c.do(ctx, http.MethodGet, pathOf("collections", name), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// DeleteCollection deletes an empty collection
+func (c *Client) DeleteCollection(ctx context.Context, name string) (*DeleteResponse, error) {
+	var resp DeleteResponse
+	if _, err := c.do(ctx, http.MethodDelete, pathOf("collections", name), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
@@ -0,0 +1,117 @@
+package selfstack
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Models lists the collections as OpenAI models
+func (c *Client) Models(ctx context.Context) (*OpenAIModelList, error) {
+	var resp OpenAIModelList
+	if _, err := c.do(ctx, http.MethodGet, "/v1/models", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Embeddings embeds req's input with the embedder of the collection its
+// model names
+func (c *Client) Embeddings(ctx context.Context, req OpenAIEmbeddingRequest) (*OpenAIEmbeddingResponse, error) {
+	var resp OpenAIEmbeddingResponse
+	if _, err := c.do(ctx, http.MethodPost, "/v1/embeddings", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ChatCompletion answers req's last user message. req.Stream is ignored;
+// use ChatCompletionStream for a stream.
+func (c *Client) ChatCompletion(ctx context.Context, req OpenAIChatRequest) (*OpenAIChatResponse, error) {
+	req.Stream = false
+	var resp OpenAIChatResponse
+	if _, err := c.do(ctx, http.MethodPost, "/v1/chat/completions", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ChatStream reads the chunks of a streamed chat completion
+//
+//	stream, err := c.ChatCompletionStream(ctx, req)
+//	defer stream.Close()
+//	for stream.Next() {
+//		chunk := stream.Chunk()
+//	}
+//	err = stream.Err()
+type ChatStream struct {
+	body    io.ReadCloser
+	scanner *bufio.Scanner
+	chunk   OpenAIChatResponse
+	err     error
+}
+
+// ChatCompletionStream answers req's last user message as a stream of
+// server-sent chunks
+func (c *Client) ChatCompletionStream(ctx context.Context, req OpenAIChatRequest) (*ChatStream, error) {
+	req.Stream = true
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+	resp, err := c.send(ctx, c.stream, http.MethodPost, "/v1/chat/completions", bytes.NewReader(data), "application/json")
+	if err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxResponseSize)
+	return &ChatStream{body: resp.Body, scanner: scanner}, nil
+}
+
+// Next reads the next chunk, returning false at the end of the stream or on
+// an error
+func (s *ChatStream) Next() bool {
+	if s.err != nil {
+		return false
+	}
+	for s.scanner.Scan() {
+		data, ok := bytes.CutPrefix(s.scanner.Bytes(), []byte("data: "))
+		if !ok {
+			continue // Blank separators and comments
+		}
+		if string(data) == "[DONE]" {
+			return false
+		}
+		s.chunk = OpenAIChatResponse{}
+		if err := json.Unmarshal(data, &s.chunk); err != nil {
+			s.err = fmt.Errorf("failed to decode chunk: %w", err)
+			return false
+		}
+		return true
+	}
+	if err := s.scanner.Err(); err != nil {
+		s.err = fmt.Errorf("failed to read stream: %w", err)
+	} else {
+		s.err = io.ErrUnexpectedEOF // The stream ended without [DONE]
+	}
+	return false
+}
+
+// Chunk returns the chunk Next read
+func (s *ChatStream) Chunk() OpenAIChatResponse {
+	return s.chunk
+}
+
+// Err returns the error that ended the stream, if any
+func (s *ChatStream) Err() error {
+	return s.err
+}
+
+// Close releases the stream
+func (s *ChatStream) Close() error {
+	return s.body.Close()
+}
@@ -0,0 +1,96 @@
+package selfstack
+
+import (
+	httpapi "github.com/dsjohal14/selfstack/internal/http"
+	"github.com/dsjohal14/selfstack/internal/libs/flags"
+	"github.com/dsjohal14/selfstack/internal/libs/obs"
+	"github.com/dsjohal14/selfstack/internal/scope/analytics"
+	"github.com/dsjohal14/selfstack/internal/scope/db"
+	"github.com/dsjohal14/selfstack/internal/scope/db/wal"
+)
+
+// The request and response types are the server's own, so a change to the
+// API's contract changes the client with it
+
+// Health and readiness
+type (
+	HealthResponse  = httpapi.HealthResponse
+	ReadyResponse   = httpapi.ReadyResponse
+	VersionResponse = httpapi.VersionResponse
+)
+
+// Ingest, search, and answers
+type (
+	IngestRequest     = httpapi.IngestRequest
+	IngestResponse    = httpapi.IngestResponse
+	SearchRequest     = httpapi.SearchRequest
+	SearchResponse    = httpapi.SearchResponse
+	SearchResult      = httpapi.SearchResult
+	RunRequest        = httpapi.RunRequest
+	RunResponse       = httpapi.RunResponse
+	Citation          = httpapi.Citation
+	RetrieveRequest   = httpapi.RetrieveRequest
+	RetrieveResponse  = httpapi.RetrieveResponse
+	RetrievedDocument = httpapi.RetrievedDocument
+	SuggestResponse   = httpapi.SuggestResponse
+	ResolveResponse   = httpapi.ResolveResponse
+)
+
+// Documents
+type (
+	DocumentResponse        = httpapi.DocumentResponse
+	DeleteResponse          = httpapi.DeleteResponse
+	DeletedListResponse     = httpapi.DeletedListResponse
+	DeletedDocumentResponse = httpapi.DeletedDocumentResponse
+	MoveRequest             = httpapi.MoveRequest
+	SimilarResponse         = httpapi.SimilarResponse
+)
+
+// Collections
+type (
+	CollectionConfig       = db.CollectionConfig
+	CollectionResponse     = httpapi.CollectionResponse
+	CollectionListResponse = httpapi.CollectionListResponse
+)
+
+// OpenAI-compatible facade
+type (
+	OpenAIModelList         = httpapi.OpenAIModelList
+	OpenAIEmbeddingRequest  = httpapi.OpenAIEmbeddingRequest
+	OpenAIEmbeddingResponse = httpapi.OpenAIEmbeddingResponse
+	OpenAIChatRequest       = httpapi.OpenAIChatRequest
+	OpenAIChatMessage       = httpapi.OpenAIChatMessage
+	OpenAIChatResponse      = httpapi.OpenAIChatResponse
+)
+
+// Admin
+type (
+	SegmentEventsResponse   = httpapi.SegmentEventsResponse
+	ChangelogEntry          = httpapi.ChangelogEntry
+	ChangelogImportResponse = httpapi.ChangelogImportResponse
+	CompactionPlan          = wal.CompactionPlan
+	GCReport                = wal.GCReport
+	ResetReport             = db.ResetReport
+	APIKey                  = db.APIKey
+	CreateKeyRequest        = httpapi.CreateKeyRequest
+	UpdateKeyRequest        = httpapi.UpdateKeyRequest
+	KeySecretResponse       = httpapi.KeySecretResponse
+	KeyListResponse         = httpapi.KeyListResponse
+	FlagsResponse           = httpapi.FlagsResponse
+	FlagState               = flags.State
+	SetFlagRequest          = httpapi.SetFlagRequest
+	UsageResponse           = httpapi.UsageResponse
+	BulkStatusResponse      = httpapi.BulkStatusResponse
+	BackfillResponse        = httpapi.BackfillResponse
+	SLOResponse             = httpapi.SLOResponse
+	CapacityResponse        = httpapi.CapacityResponse
+	LogLevels               = obs.LevelState
+	SetLogLevelRequest      = httpapi.SetLogLevelRequest
+)
+
+// Analytics
+type (
+	DuplicatesResponse = httpapi.DuplicatesResponse
+	DuplicateGroup     = analytics.DuplicateGroup
+	DuplicateDoc       = analytics.DuplicateDoc
+)
@@ -104,6 +104,8 @@ if ! docker exec selfstack-db psql -U selfstack -d selfstack -c "SELECT 1" > /de
     # Run migrations
     cat migrations/0001_init.sql | docker exec -i selfstack-db psql -U selfstack -d selfstack 2>/dev/null || true
     cat migrations/0002_wal_segments.sql | docker exec -i selfstack-db psql -U selfstack -d selfstack 2>/dev/null || true
+    cat migrations/0003_segment_type.sql | docker exec -i selfstack-db psql -U selfstack -d selfstack 2>/dev/null || true
+    cat migrations/0004_segment_events.sql | docker exec -i selfstack-db psql -U selfstack -d selfstack 2>/dev/null || true
 fi
 log_pass "Postgres is running"
 
@@ -111,6 +113,7 @@ log_pass "Postgres is running"
 log_info "Cleaning up previous test data..."
 rm -rf "$DATA_DIR"
 docker exec selfstack-db psql -U selfstack -d selfstack -c "TRUNCATE wal_segments CASCADE" 2>/dev/null || true
+docker exec selfstack-db psql -U selfstack -d selfstack -c "TRUNCATE wal_segment_events" 2>/dev/null || true
 docker exec selfstack-db psql -U selfstack -d selfstack -c "DELETE FROM wal_state" 2>/dev/null || true
 docker exec selfstack-db psql -U selfstack -d selfstack -c "INSERT INTO wal_state (id, current_segment_id, next_lsn, checkpoint_lsn) VALUES (1, 1, 1, 0) ON CONFLICT (id) DO UPDATE SET current_segment_id = 1, next_lsn = 1, checkpoint_lsn = 0" 2>/dev/null || true
 log_pass "Test data cleaned"